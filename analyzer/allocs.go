@@ -1,61 +1,118 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 
 	"github.com/google/pprof/profile"
 )
 
+// AllocsAnalysisResult represents the overall result of an Allocs analysis (JSON)
+type AllocsAnalysisResult struct {
+	ProfileType         string             `json:"profileType"`
+	ValueType           string             `json:"valueType"`
+	ValueUnit           string             `json:"valueUnit"`
+	TotalValue          int64              `json:"totalValue"`
+	TotalValueFormatted string             `json:"totalValueFormatted"`
+	TotalObjects        int64              `json:"totalObjects,omitempty"`
+	TopN                int                `json:"topN"`
+	Functions           []HeapFunctionStat `json:"functions"`
+	AllocationSites     []AllocSiteStat    `json:"allocationSites"`
+	CaptureConfig       *CaptureConfig     `json:"captureConfig,omitempty"`
+	SkippedSamples      *SkippedSamples    `json:"skippedSamples,omitempty"` // Samples skipped for lacking a call stack or the selected value
+	numbers             NumberFormatter    // 生成格式化字段时使用的数值格式，Format 函数沿用同一格式
+}
+
+// AllocsAnalysisOptions defines optional parameters for Allocs analysis
+type AllocsAnalysisOptions struct {
+	// Numbers is the format of numbers in the report (see NumberStyles); the zero value is NumberStyleHuman
+	Numbers NumberFormatter
+}
+
 // AnalyzeAllocsProfile analyzes an Allocs profile (allocation patterns) and returns formatted results.
 func AnalyzeAllocsProfile(p *profile.Profile, topN int, format string) (string, error) {
-	log.Printf("Analyzing Allocs profile (Top %d, Format: %s)", topN, format)
+	return AnalyzeAllocsProfileWithOptions(p, topN, format, AllocsAnalysisOptions{})
+}
+
+// AnalyzeAllocsProfileWithOptions analyzes an Allocs profile with the given options and returns formatted results.
+func AnalyzeAllocsProfileWithOptions(p *profile.Profile, topN int, format string, opts AllocsAnalysisOptions) (string, error) {
+	return AnalyzeAllocsProfileContext(context.Background(), p, topN, format, opts)
+}
+
+// AnalyzeAllocsProfileContext is AnalyzeAllocsProfileWithOptions, but checks ctx periodically while aggregating
+// samples and stops promptly once it is canceled.
+func AnalyzeAllocsProfileContext(ctx context.Context, p *profile.Profile, topN int, format string, opts AllocsAnalysisOptions) (string, error) {
+	logDebug("Analyzing Allocs profile (Top %d, Format: %s)", topN, format)
+	result, err := AllocsProfileStatsContext(ctx, p, topN, opts)
+	if err != nil {
+		return "", err
+	}
+	if format != "flamegraph-json" {
+		return FormatAllocsResult(result, format)
+	}
 
+	// The flame graph needs full call stacks, so it is built from the profile directly
+	valueIndex, _, _ := findValueColumn(p, "allocs")
+	logDebug("Generating flame graph JSON for Allocs profile (%s) using value index %d", result.ValueType, valueIndex)
+	// BuildFlameGraphTree will automatically detect this is a memory profile and find the objectsIndex
+	// based on the valueType and valueUnit
+	flameGraphRoot, err := BuildFlameGraphTree(p, valueIndex)
+	if err != nil {
+		logError("Error building flame graph tree for allocs: %v", err)
+		errorResult := ErrorResult{Error: fmt.Sprintf("Failed to build flame graph tree for allocs: %v", err)}
+		errJsonBytes, _ := json.Marshal(errorResult)
+		return string(errJsonBytes), nil
+	}
+	jsonBytes, err := json.Marshal(flameGraphRoot)
+	if err != nil {
+		logError("Error marshaling allocs flame graph tree to JSON: %v", err)
+		errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal allocs flame graph tree to JSON: %v", err)}
+		errJsonBytes, _ := json.Marshal(errorResult)
+		return string(errJsonBytes), nil
+	}
+	return string(jsonBytes), nil
+}
+
+// AllocsProfileStats aggregates an Allocs profile by function and allocation site and returns the
+// top entries as a structured result, for callers that want the numbers directly. TopN is the requested count.
+func AllocsProfileStats(p *profile.Profile, topN int) (*AllocsAnalysisResult, error) {
+	return AllocsProfileStatsWithOptions(p, topN, AllocsAnalysisOptions{})
+}
+
+// AllocsProfileStatsWithOptions is AllocsProfileStats with options.
+func AllocsProfileStatsWithOptions(p *profile.Profile, topN int, opts AllocsAnalysisOptions) (*AllocsAnalysisResult, error) {
+	return AllocsProfileStatsContext(context.Background(), p, topN, opts)
+}
+
+// AllocsProfileStatsContext is AllocsProfileStatsWithOptions, but checks ctx periodically while aggregating
+// samples and returns an error wrapping ctx.Err() once it is canceled.
+func AllocsProfileStatsContext(ctx context.Context, p *profile.Profile, topN int, opts AllocsAnalysisOptions) (*AllocsAnalysisResult, error) {
 	// --- 1. Find the 'alloc_space' sample value index ---
-	valueIndex := -1
 	objectsIndex := -1 // For tracking object counts
 
 	for i, st := range p.SampleType {
-		if st.Type == "alloc_space" && st.Unit == "bytes" {
-			valueIndex = i
-		}
 		if st.Type == "alloc_objects" && st.Unit == "count" {
 			objectsIndex = i
 		}
 	}
 
-	// If alloc_space is not found, try other possible memory allocation types
-	if valueIndex == -1 && len(p.SampleType) > 0 {
-		for i, st := range p.SampleType {
-			if (st.Type == "alloc" || st.Type == "allocation") && st.Unit == "bytes" {
-				valueIndex = i
-				log.Printf("Warning: 'alloc_space' not found, using '%s/%s' instead", st.Type, st.Unit)
-				break
-			}
-		}
-	}
-
-	// Final fallback
-	if valueIndex == -1 && len(p.SampleType) > 0 {
-		valueIndex = 0 // Use the first sample type
-		log.Printf("Warning: Could not find allocation space sample type, defaulting to index 0: %s/%s",
-			p.SampleType[valueIndex].Type, p.SampleType[valueIndex].Unit)
-	}
-
-	if valueIndex == -1 {
-		return "", fmt.Errorf("could not determine value type from profile sample types (e.g., alloc_space bytes)")
+	// Locate alloc_space (or another allocation type) by name; positional fallback is a last resort
+	valueIndex, _, err := findValueColumn(p, "allocs")
+	if err != nil {
+		return nil, fmt.Errorf("could not determine value type from profile sample types (e.g., alloc_space bytes): %w", err)
 	}
 
 	valueUnit := p.SampleType[valueIndex].Unit
 	valueType := p.SampleType[valueIndex].Type
-	log.Printf("Using index %d (%s/%s) for Allocs analysis", valueIndex, valueType, valueUnit)
+	logDebug("Using index %d (%s/%s) for Allocs analysis", valueIndex, valueType, valueUnit)
 
 	// --- 2. Aggregate memory allocation values by function and allocation site ---
 	// Create two maps: one for aggregating by function, one for aggregating by allocation site
 	funcValue := make(map[string]int64)        // Aggregate by function name
+	funcCum := make(map[string]int64)          // Aggregate by every function on the allocation stack
 	allocSiteValue := make(map[string]int64)   // Aggregate by allocation site (function+file+line)
 	funcObjects := make(map[string]int64)      // Object count aggregated by function
 	allocSiteObjects := make(map[string]int64) // Object count aggregated by allocation site
@@ -63,10 +120,14 @@ func AnalyzeAllocsProfile(p *profile.Profile, topN int, format string) (string,
 	totalValue := int64(0)
 	totalObjects := int64(0)
 
-	for _, s := range p.Sample {
+	for i, s := range p.Sample {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, err
+		}
 		if len(s.Location) > 0 && len(s.Value) > valueIndex {
 			v := s.Value[valueIndex] // Allocated bytes
 			totalValue += v
+			addCumulativeValue(funcCum, s, v, functionNameKey)
 
 			// If object count information is available, collect it too
 			var objCount int64 = 0
@@ -75,42 +136,36 @@ func AnalyzeAllocsProfile(p *profile.Profile, topN int, format string) (string,
 				totalObjects += objCount
 			}
 
-			// Attribute memory to the topmost function in the allocation stack
-			loc := s.Location[0]
-			for _, line := range loc.Line {
-				if line.Function != nil {
-					funcName := line.Function.Name
-					fileName := line.Function.Filename
-					lineNum := line.Line
-
-					// Aggregate by function
-					funcValue[funcName] += v
-					if objCount > 0 {
-						funcObjects[funcName] += objCount
-					}
-
-					// Aggregate by allocation site (function+file+line)
-					allocSiteKey := fmt.Sprintf("%s at %s:%d", funcName, fileName, lineNum)
-					allocSiteValue[allocSiteKey] += v
-					if objCount > 0 {
-						allocSiteObjects[allocSiteKey] += objCount
-					}
-
-					break // Only attribute to the first function found in the top frame
-				}
+			// Attribute memory to the topmost function in the allocation stack ("unknown" when the top frame has no function)
+			funcName, allocSiteKey := unknownFunction, unknownFunction
+			if line, ok := topLine(s); ok {
+				funcName = line.Function.Name
+				allocSiteKey = fmt.Sprintf("%s at %s:%d", funcName, line.Function.Filename, line.Line)
+			}
+
+			// Aggregate by function
+			funcValue[funcName] += v
+			if objCount > 0 {
+				funcObjects[funcName] += objCount
+			}
+
+			// Aggregate by allocation site (function+file+line)
+			allocSiteValue[allocSiteKey] += v
+			if objCount > 0 {
+				allocSiteObjects[allocSiteKey] += objCount
 			}
 		}
 	}
 
 	if totalValue == 0 {
-		log.Printf("Warning: Total value for the selected sample type (%s/%s) is zero.", valueType, valueUnit)
+		logWarn("Total value for the selected sample type (%s/%s) is zero.", valueType, valueUnit)
 	}
 
 	// --- 3. Sort functions and allocation sites by aggregated values ---
 	// Sort by function
 	funcStats := make([]functionStat, 0, len(funcValue))
 	for name, val := range funcValue {
-		funcStats = append(funcStats, functionStat{Name: name, Flat: val})
+		funcStats = append(funcStats, functionStat{Name: name, Flat: val, Cum: funcCum[name]})
 	}
 	sort.Slice(funcStats, func(i, j int) bool {
 		return funcStats[i].Flat > funcStats[j].Flat // Sort in descending order
@@ -131,8 +186,6 @@ func AnalyzeAllocsProfile(p *profile.Profile, topN int, format string) (string,
 		return allocSiteStats[i].Value > allocSiteStats[j].Value // Sort in descending order
 	})
 
-	// --- 4. Format output ---
-	var b strings.Builder
 	limit := topN
 	if limit > len(funcStats) {
 		limit = len(funcStats)
@@ -143,160 +196,113 @@ func AnalyzeAllocsProfile(p *profile.Profile, topN int, format string) (string,
 		allocSiteLimit = len(allocSiteStats)
 	}
 
+	result := &AllocsAnalysisResult{
+		ProfileType:         "allocs",
+		ValueType:           valueType,
+		ValueUnit:           valueUnit,
+		TotalValue:          totalValue,
+		TotalValueFormatted: opts.Numbers.Bytes(totalValue),
+		TotalObjects:        totalObjects,
+		TopN:                topN,
+		Functions:           make([]HeapFunctionStat, 0, limit),
+		AllocationSites:     make([]AllocSiteStat, 0, allocSiteLimit),
+		CaptureConfig:       ParseCaptureConfig(p),
+		SkippedSamples:      countSkippedSamples(p, valueIndex),
+		numbers:             opts.Numbers,
+	}
+
+	// Add function statistics
+	running := int64(0)
+	for i := 0; i < limit; i++ {
+		stat := funcStats[i]
+		running += stat.Flat
+		result.Functions = append(result.Functions, HeapFunctionStat{
+			FunctionName:      stat.Name,
+			FunctionID:        FunctionID(stat.Name),
+			Value:             stat.Flat,
+			ValueFormatted:    opts.Numbers.Bytes(stat.Flat),
+			Percentage:        percentOf(stat.Flat, totalValue),
+			SumPercentage:     percentOf(running, totalValue),
+			CumValue:          stat.Cum,
+			CumValueFormatted: opts.Numbers.Bytes(stat.Cum),
+			CumPercentage:     percentOf(stat.Cum, totalValue),
+			ObjectCount:       funcObjects[stat.Name],
+		})
+	}
+
+	// Add allocation site statistics
+	running = 0
+	for i := 0; i < allocSiteLimit; i++ {
+		stat := allocSiteStats[i]
+		running += stat.Value
+		siteStat := AllocSiteStat{
+			Site:           stat.Site,
+			Value:          stat.Value,
+			ValueFormatted: opts.Numbers.Bytes(stat.Value),
+			Percentage:     percentOf(stat.Value, totalValue),
+			SumPercentage:  percentOf(running, totalValue),
+		}
+
+		if stat.Count > 0 {
+			siteStat.ObjectCount = stat.Count
+			// Calculate average allocation size
+			avgSize := stat.Value / stat.Count
+			siteStat.AvgSize = avgSize
+			siteStat.AvgSizeFormatted = opts.Numbers.Bytes(avgSize)
+		}
+
+		result.AllocationSites = append(result.AllocationSites, siteStat)
+	}
+	return result, nil
+}
+
+// FormatAllocsResult formats the result of AllocsProfileStats as text, markdown, json, compact or summary output.
+// flamegraph-json needs the full call stacks and is only available through AnalyzeAllocsProfile.
+func FormatAllocsResult(result *AllocsAnalysisResult, format string) (string, error) {
+	// --- 4. Format output ---
+	var b strings.Builder
+	valueType := result.ValueType
+	capture := result.CaptureConfig
+
 	switch format {
 	case "text", "markdown":
 		if format == "markdown" {
 			b.WriteString("```text\n")
 		}
-		b.WriteString(fmt.Sprintf("Allocation Profile Analysis (Top %d Functions by %s)\n", topN, valueType))
-		b.WriteString(fmt.Sprintf("Total %s (%s): %s\n", valueType, valueUnit, FormatBytes(totalValue)))
-		if totalObjects > 0 {
-			b.WriteString(fmt.Sprintf("Total Objects: %d\n", totalObjects))
+		b.WriteString(fmt.Sprintf("Allocation Profile Analysis (Top %d Functions by %s)\n", result.TopN, valueType))
+		b.WriteString(fmt.Sprintf("Total %s (%s): %s\n", valueType, result.ValueUnit, result.TotalValueFormatted))
+		if result.TotalObjects > 0 {
+			b.WriteString(fmt.Sprintf("Total Objects: %d\n", result.TotalObjects))
 		}
-
-		// Output by function
-		b.WriteString("\n=== By Function ===\n")
-		b.WriteString("--------------------------------------------------\n")
-		b.WriteString(fmt.Sprintf("%-15s %-15s %s\n", valueType, "%", "Function Name"))
-		b.WriteString("--------------------------------------------------\n")
-		for i := 0; i < limit; i++ {
-			stat := funcStats[i]
-			percent := 0.0
-			if totalValue != 0 {
-				percent = (float64(stat.Flat) / float64(totalValue)) * 100
-			}
-			objStr := ""
-			if count, ok := funcObjects[stat.Name]; ok && count > 0 {
-				objStr = fmt.Sprintf(" (%d objects)", count)
-			}
-			b.WriteString(fmt.Sprintf("%-15s %-15.2f %s%s\n",
-				FormatBytes(stat.Flat), percent, stat.Name, objStr))
+		if capture != nil {
+			b.WriteString(fmt.Sprintf("Capture Config: %s\n", capture.format(result.numbers)))
 		}
-
-		// Output by allocation site
-		b.WriteString("\n=== By Allocation Site ===\n")
-		b.WriteString("--------------------------------------------------\n")
-		b.WriteString(fmt.Sprintf("%-15s %-15s %s\n", valueType, "%", "Allocation Site"))
-		b.WriteString("--------------------------------------------------\n")
-		for i := 0; i < allocSiteLimit; i++ {
-			stat := allocSiteStats[i]
-			percent := 0.0
-			if totalValue != 0 {
-				percent = (float64(stat.Value) / float64(totalValue)) * 100
-			}
-			objStr := ""
-			if stat.Count > 0 {
-				objStr = fmt.Sprintf(" (%d objects)", stat.Count)
-			}
-			b.WriteString(fmt.Sprintf("%-15s %-15.2f %s%s\n",
-				FormatBytes(stat.Value), percent, stat.Site, objStr))
+		if result.SkippedSamples != nil {
+			b.WriteString(fmt.Sprintf("Skipped: %s\n", result.SkippedSamples))
 		}
+		writeMemoryFunctionsAndSites(&b, valueType, result.Functions, result.AllocationSites)
 
 		if format == "markdown" {
 			b.WriteString("```\n")
 		}
 
+	case "summary":
+		b.WriteString(formatSummary(memorySummary("allocs", valueType, result.TotalValueFormatted, result.Functions)))
+	case "compact":
+		b.WriteString(formatMemoryCompact("allocs", valueType, result.TotalValueFormatted, result.Functions, capture.compactSuffix()+result.SkippedSamples.compactSuffix()))
 	case "json":
-		// Use JSON output structure from types.go
-
-		result := struct {
-			ProfileType         string             `json:"profileType"`
-			ValueType           string             `json:"valueType"`
-			ValueUnit           string             `json:"valueUnit"`
-			TotalValue          int64              `json:"totalValue"`
-			TotalValueFormatted string             `json:"totalValueFormatted"`
-			TotalObjects        int64              `json:"totalObjects,omitempty"`
-			TopN                int                `json:"topN"`
-			Functions           []HeapFunctionStat `json:"functions"`
-			AllocationSites     []AllocSiteStat    `json:"allocationSites"`
-		}{
-			ProfileType:         "allocs",
-			ValueType:           valueType,
-			ValueUnit:           valueUnit,
-			TotalValue:          totalValue,
-			TotalValueFormatted: FormatBytes(totalValue),
-			TopN:                limit,
-			Functions:           make([]HeapFunctionStat, 0, limit),
-			AllocationSites:     make([]AllocSiteStat, 0, allocSiteLimit),
-		}
-
-		if totalObjects > 0 {
-			result.TotalObjects = totalObjects
-		}
-
-		// Add function statistics
-		for i := 0; i < limit; i++ {
-			stat := funcStats[i]
-			percent := 0.0
-			if totalValue != 0 {
-				percent = (float64(stat.Flat) / float64(totalValue)) * 100
-			}
-
-			funcStat := HeapFunctionStat{
-				FunctionName:   stat.Name,
-				Value:          stat.Flat,
-				ValueFormatted: FormatBytes(stat.Flat),
-				Percentage:     percent,
-			}
-
-			result.Functions = append(result.Functions, funcStat)
-		}
-
-		// Add allocation site statistics
-		for i := 0; i < allocSiteLimit; i++ {
-			stat := allocSiteStats[i]
-			percent := 0.0
-			if totalValue != 0 {
-				percent = (float64(stat.Value) / float64(totalValue)) * 100
-			}
-
-			siteStat := AllocSiteStat{
-				Site:           stat.Site,
-				Value:          stat.Value,
-				ValueFormatted: FormatBytes(stat.Value),
-				Percentage:     percent,
-			}
-
-			if stat.Count > 0 {
-				siteStat.ObjectCount = stat.Count
-				// Calculate average allocation size
-				avgSize := stat.Value / stat.Count
-				siteStat.AvgSize = avgSize
-				siteStat.AvgSizeFormatted = FormatBytes(avgSize)
-			}
-
-			result.AllocationSites = append(result.AllocationSites, siteStat)
-		}
-
-		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		// topN in the JSON output is the number of functions actually returned
+		output := *result
+		output.TopN = len(result.Functions)
+		jsonBytes, err := json.MarshalIndent(output, "", "  ")
 		if err != nil {
-			log.Printf("Error marshaling Allocs analysis to JSON: %v", err)
+			logError("Error marshaling Allocs analysis to JSON: %v", err)
 			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal result to JSON: %v", err)}
 			errJsonBytes, _ := json.Marshal(errorResult)
 			return string(errJsonBytes), nil
 		}
 		return string(jsonBytes), nil
 
-	case "flamegraph-json":
-		log.Printf("Generating flame graph JSON for Allocs profile (%s) using value index %d", valueType, valueIndex)
-		// BuildFlameGraphTree will automatically detect this is a memory profile and find the objectsIndex
-		// based on the valueType and valueUnit
-		flameGraphRoot, err := BuildFlameGraphTree(p, valueIndex)
-		if err != nil {
-			log.Printf("Error building flame graph tree for allocs: %v", err)
-			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to build flame graph tree for allocs: %v", err)}
-			errJsonBytes, _ := json.Marshal(errorResult)
-			return string(errJsonBytes), nil
-		}
-		jsonBytes, err := json.Marshal(flameGraphRoot)
-		if err != nil {
-			log.Printf("Error marshaling allocs flame graph tree to JSON: %v", err)
-			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal allocs flame graph tree to JSON: %v", err)}
-			errJsonBytes, _ := json.Marshal(errorResult)
-			return string(errJsonBytes), nil
-		}
-		return string(jsonBytes), nil
-
 	default:
 		return "", fmt.Errorf("unsupported output format: %s", format)
 	}
@@ -0,0 +1,160 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// BatchDiffEntry 是批量比较中单个 target 相对 baseline 的差异摘要 (JSON)
+type BatchDiffEntry struct {
+	Label              string      `json:"label"`
+	Summary            DiffSummary `json:"summary"`
+	ChangeFromPrevious int64       `json:"changeFromPrevious"`          // 总值相对上一个 target 的变化 (第一个 target 相对 baseline)
+	TopRegression      string      `json:"topRegression,omitempty"`     // 增长最多的函数
+	TopRegressionID    string      `json:"topRegressionId,omitempty"`   // 该函数的 functionId
+	TopRegressionDiff  int64       `json:"topRegressionDiff,omitempty"` // 该函数的增长值
+}
+
+// BatchDiffResult 是一个 baseline 与多个 target 的批量比较结果 (JSON)
+type BatchDiffResult struct {
+	ProfileType   string           `json:"profileType"`
+	Aggregation   string           `json:"aggregation"`
+	ValueType     string           `json:"valueType"`
+	ValueUnit     string           `json:"valueUnit"`
+	BaselineTotal int64            `json:"baselineTotal"`
+	Entries       []BatchDiffEntry `json:"entries"`
+}
+
+// CompareProfilesBatch 将多个 target (例如一周内的每日构建) 分别与同一个 baseline 比较，
+// 汇总每个 target 的差异摘要，并给出总值随 target 序列变化的趋势表。
+// 每个 target 的比较与 CompareProfilesWithOptions 完全相同，opts.Format 决定输出格式 (text、markdown、json)。
+func CompareProfilesBatch(baseline *profile.Profile, targets []*profile.Profile, labels []string, profileTypeName string, opts CompareOptions) (string, error) {
+	return CompareProfilesBatchContext(context.Background(), baseline, targets, labels, profileTypeName, opts)
+}
+
+// CompareProfilesBatchContext 与 CompareProfilesBatch 相同，但在聚合样本时定期检查 ctx，ctx 被取消时尽快停止
+func CompareProfilesBatchContext(ctx context.Context, baseline *profile.Profile, targets []*profile.Profile, labels []string, profileTypeName string, opts CompareOptions) (string, error) {
+	if len(targets) == 0 {
+		return "", fmt.Errorf("至少需要 1 个 target profile")
+	}
+	if len(labels) != len(targets) {
+		return "", fmt.Errorf("标签数量 (%d) 与 target 数量 (%d) 不匹配", len(labels), len(targets))
+	}
+	aggregation := opts.Aggregation
+	if aggregation == "" {
+		aggregation = AggregationLeaf
+	}
+	logDebug("Comparing %d targets against one baseline: type=%s, aggregation=%s", len(targets), profileTypeName, aggregation)
+
+	result := BatchDiffResult{ProfileType: profileTypeName, Aggregation: aggregation}
+	previousTotal := int64(0)
+	for i, target := range targets {
+		diffs, summary, valueType, err := computeProfileDiff(ctx, baseline, target, profileTypeName, aggregation, opts)
+		if err != nil {
+			return "", fmt.Errorf("target %s: %w", labels[i], err)
+		}
+		if i == 0 {
+			result.ValueType, result.ValueUnit = valueType.Type, valueType.Unit
+			result.BaselineTotal = summary.BaselineTotal
+			previousTotal = summary.BaselineTotal
+		}
+
+		entry := BatchDiffEntry{Label: labels[i], Summary: summary, ChangeFromPrevious: summary.TargetTotal - previousTotal}
+		for _, d := range diffs {
+			if d.DiffValue > entry.TopRegressionDiff && !(opts.ExcludeLowConfidence && d.LowConfidence) {
+				entry.TopRegression, entry.TopRegressionID, entry.TopRegressionDiff = d.FunctionName, d.FunctionID, d.DiffValue
+			}
+		}
+		result.Entries = append(result.Entries, entry)
+		previousTotal = summary.TargetTotal
+	}
+
+	switch opts.Format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatBatchDiff(result, opts.Format), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", opts.Format)
+	}
+}
+
+// formatBatchDiff 将批量比较结果格式化为趋势表
+func formatBatchDiff(r BatchDiffResult, format string) string {
+	var b strings.Builder
+	header := []string{"Target", "总值", "相对 Baseline", "相对上一个", "回归", "提升", "新增", "移除", "增长最多的函数"}
+	rows := make([][]string, 0, len(r.Entries))
+	for _, e := range r.Entries {
+		top := "-"
+		if e.TopRegression != "" {
+			top = fmt.Sprintf("%s (+%s)", truncateString(e.TopRegression, 40), formatUnitValue(e.TopRegressionDiff, r.ValueUnit))
+		}
+		rows = append(rows, []string{
+			sanitizeName(e.Label),
+			formatUnitValue(e.Summary.TargetTotal, r.ValueUnit),
+			fmt.Sprintf("%s (%+.2f%%)", signedUnitValue(e.Summary.TotalDiff, r.ValueUnit), e.Summary.TotalDiffPercent),
+			signedUnitValue(e.ChangeFromPrevious, r.ValueUnit),
+			fmt.Sprintf("%d", e.Summary.RegressedFuncs),
+			fmt.Sprintf("%d", e.Summary.ImprovedFuncs),
+			fmt.Sprintf("%d", e.Summary.AddedFuncs),
+			fmt.Sprintf("%d", e.Summary.RemovedFuncs),
+			top,
+		})
+	}
+
+	last := r.Entries[len(r.Entries)-1].Summary
+	worst := r.Entries[0]
+	for _, e := range r.Entries[1:] {
+		if e.Summary.TotalDiff > worst.Summary.TotalDiff {
+			worst = e
+		}
+	}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("# 批量差异分析 (%s, %d 个 target)\n\n", r.ProfileType, len(r.Entries)))
+		b.WriteString(fmt.Sprintf("- **样本类型**: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("- **聚合方式**: %s\n", r.Aggregation))
+		b.WriteString(fmt.Sprintf("- **Baseline 总值**: %s\n\n", formatUnitValue(r.BaselineTotal, r.ValueUnit)))
+		b.WriteString("| " + strings.Join(header, " | ") + " |\n")
+		b.WriteString("|" + strings.Repeat("------|", len(header)) + "\n")
+		for _, row := range rows {
+			b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		}
+	} else {
+		b.WriteString(fmt.Sprintf("批量差异分析 (%s, %d 个 target)\n", r.ProfileType, len(r.Entries)))
+		b.WriteString("==============================\n\n")
+		b.WriteString(fmt.Sprintf("样本类型: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("聚合方式: %s\n", r.Aggregation))
+		b.WriteString(fmt.Sprintf("Baseline 总值: %s\n\n", formatUnitValue(r.BaselineTotal, r.ValueUnit)))
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	}
+
+	b.WriteString(fmt.Sprintf("\n趋势: 最后一个 target 相对 baseline 变化 %s (%+.2f%%)；相对 baseline 总值最高的是 %s (%+.2f%%)。\n",
+		signedUnitValue(last.TotalDiff, r.ValueUnit), last.TotalDiffPercent, sanitizeName(worst.Label), worst.Summary.TotalDiffPercent))
+	return b.String()
+}
+
+// signedUnitValue 按单位格式化带符号的差值，例如 "+1.50s"
+func signedUnitValue(v int64, unit string) string {
+	if v > 0 {
+		return "+" + formatUnitValue(v, unit)
+	}
+	if v < 0 {
+		return "-" + formatUnitValue(-v, unit)
+	}
+	return formatUnitValue(0, unit)
+}
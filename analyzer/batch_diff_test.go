@@ -0,0 +1,56 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestCompareProfilesBatch 测试一个 baseline 与多个 target 的批量比较
+func TestCompareProfilesBatch(t *testing.T) {
+	baseline := newCPUProfile(map[string]int64{"main.work": 100000000, "main.idle": 100000000})
+	targets := []*profile.Profile{
+		newCPUProfile(map[string]int64{"main.work": 150000000, "main.idle": 100000000}),
+		newCPUProfile(map[string]int64{"main.work": 300000000, "main.idle": 100000000, "main.new": 50000000}),
+		newCPUProfile(map[string]int64{"main.work": 100000000}),
+	}
+	labels := []string{"mon", "tue", "wed"}
+
+	jsonResult, err := CompareProfilesBatch(baseline, targets, labels, "cpu", CompareOptions{Format: "json"})
+	if err != nil {
+		t.Fatalf("CompareProfilesBatch() error = %v", err)
+	}
+	var result BatchDiffResult
+	if err := json.Unmarshal([]byte(jsonResult), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.BaselineTotal != 200000000 || len(result.Entries) != 3 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	tue := result.Entries[1]
+	if tue.Summary.TotalDiff != 250000000 || tue.ChangeFromPrevious != 200000000 {
+		t.Errorf("Unexpected tue entry: %+v", tue)
+	}
+	if tue.TopRegression != "main.work" || tue.TopRegressionDiff != 200000000 || tue.Summary.AddedFuncs != 1 {
+		t.Errorf("Unexpected tue top regression: %+v", tue)
+	}
+	wed := result.Entries[2]
+	if wed.Summary.TotalDiff != -100000000 || wed.Summary.RemovedFuncs != 1 || wed.TopRegression != "" {
+		t.Errorf("Unexpected wed entry: %+v", wed)
+	}
+
+	markdown, err := CompareProfilesBatch(baseline, targets, labels, "cpu", CompareOptions{Format: "markdown"})
+	if err != nil {
+		t.Fatalf("CompareProfilesBatch() error = %v", err)
+	}
+	for _, want := range []string{"# 批量差异分析 (cpu, 3 个 target)", "| tue |", "main.work (+200.00ms)", "总值最高的是 tue (+125.00%)"} {
+		if !containsString(markdown, want) {
+			t.Errorf("Markdown output should contain %q, got:\n%s", want, markdown)
+		}
+	}
+
+	if _, err := CompareProfilesBatch(baseline, targets, labels[:2], "cpu", CompareOptions{Format: "text"}); err == nil {
+		t.Error("Expected error when label count does not match target count")
+	}
+}
@@ -0,0 +1,76 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"text/tabwriter"
+)
+
+// formatBenchstatReport 以 benchstat 的列布局输出差异：name、old、new、delta。
+// 单个 profile 没有多次运行的方差，因此 "±" 使用采样事件数 (见 sampleEventCounter，不是 Sample 记录数) 的泊松噪声估计 (1/√n)，
+// delta 的 p 值由 diffZScore 的 z 值换算；不显著的变化与 benchstat 一样显示为 "~"。
+func formatBenchstatReport(diffs []FunctionDiff, summary DiffSummary, valueType, valueUnit string, topN int) string {
+	var b strings.Builder
+	metric := valueType
+	if valueUnit != "" && valueUnit != "count" {
+		metric = valueType + "/" + valueUnit
+	}
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "name\told %s\tnew %s\tdelta\n", metric, metric)
+
+	limit := topN
+	if limit > len(diffs) {
+		limit = len(diffs)
+	}
+	for i := 0; i < limit; i++ {
+		d := diffs[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			truncateString(d.FunctionName, 60),
+			benchstatValue(d.BaselineValue, d.BaselineSamples, valueUnit),
+			benchstatValue(d.TargetValue, d.TargetSamples, valueUnit),
+			benchstatDelta(d))
+	}
+	fmt.Fprintf(w, "[Total]\t%s\t%s\t%s\n",
+		formatUnitValue(summary.BaselineTotal, valueUnit),
+		formatUnitValue(summary.TargetTotal, valueUnit),
+		fmt.Sprintf("%+.2f%%", summary.TotalDiffPercent))
+	w.Flush()
+
+	b.WriteString("\n± 为根据样本数估计的采样噪声 (1/√n)，并非多次运行的方差；")
+	b.WriteString(fmt.Sprintf("p 值由样本数差异的 z 值换算，p ≥ %.2f 的变化显示为 \"~\"，? 表示函数只出现在其中一个 profile 中。\n", benchstatAlpha()))
+	if normalization := normalizationDescription(summary); normalization != "" {
+		b.WriteString(fmt.Sprintf("时长归一化: %s。\n", normalization))
+	}
+	if crossMetric := crossMetricDescription(summary); crossMetric != "" {
+		b.WriteString(fmt.Sprintf("警告: 跨指标比较，%s。\n", crossMetric))
+	}
+	return b.String()
+}
+
+// benchstatValue 格式化 "值 ± 噪声%"，没有样本时只输出值
+func benchstatValue(value, samples int64, unit string) string {
+	if samples <= 0 {
+		return formatUnitValue(value, unit)
+	}
+	return fmt.Sprintf("%s ±%.0f%%", formatUnitValue(value, unit), 100/math.Sqrt(float64(samples)))
+}
+
+// benchstatDelta 格式化 delta 列，例如 "-20.00%  (p=0.001 n=25+16)" 或 "~  (p=0.480 n=3+4)"
+func benchstatDelta(d FunctionDiff) string {
+	n := fmt.Sprintf("n=%d+%d", d.BaselineSamples, d.TargetSamples)
+	if d.BaselineValue == 0 || d.TargetValue == 0 {
+		return fmt.Sprintf("?  (%s)", n)
+	}
+	p := math.Erfc(d.ZScore / math.Sqrt2)
+	if d.DiffValue == 0 || d.LowConfidence {
+		return fmt.Sprintf("~  (p=%.3f %s)", p, n)
+	}
+	return fmt.Sprintf("%+.2f%%  (p=%.3f %s)", d.DiffPercentage, p, n)
+}
+
+// benchstatAlpha 返回与 significanceZThreshold 对应的双侧显著性水平
+func benchstatAlpha() float64 {
+	return math.Erfc(significanceZThreshold / math.Sqrt2)
+}
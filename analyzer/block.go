@@ -1,10 +1,9 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"sort"
 	"strings"
 
 	"github.com/google/pprof/profile"
@@ -12,14 +11,16 @@ import (
 
 // BlockContentionStat 代表 Block 阻塞的统计信息
 type BlockContentionStat struct {
-	FunctionName     string  `json:"functionName"`
-	Contentions      int64   `json:"contentions"`       // 阻塞次数
-	DelayNanos       int64   `json:"delayNanos"`        // 总延迟时间（纳秒）
-	DelayFormatted   string  `json:"delayFormatted"`    // 格式化后的延迟时间
-	ContentionsPct   float64 `json:"contentionsPct"`    // 阻塞次数占比
-	DelayPct         float64 `json:"delayPct"`          // 延迟时间占比
-	AvgDelayNanos    int64   `json:"avgDelayNanos"`     // 平均每次阻塞的延迟（纳秒）
-	AvgDelayFormatted string `json:"avgDelayFormatted"` // 格式化后的平均延迟
+	FunctionName      string  `json:"functionName"`
+	FunctionID        string  `json:"functionId"`        // 完整函数名的稳定哈希，用于跨报告关联
+	Contentions       int64   `json:"contentions"`       // 阻塞次数
+	DelayNanos        int64   `json:"delayNanos"`        // 总延迟时间（纳秒）
+	DelayFormatted    string  `json:"delayFormatted"`    // 格式化后的延迟时间
+	ContentionsPct    float64 `json:"contentionsPct"`    // 阻塞次数占比
+	DelayPct          float64 `json:"delayPct"`          // 延迟时间占比
+	SumPct            float64 `json:"sumPct"`            // 按列表顺序累加到该函数为止的主要指标占总量的百分比
+	AvgDelayNanos     int64   `json:"avgDelayNanos"`     // 平均每次阻塞的延迟（纳秒）
+	AvgDelayFormatted string  `json:"avgDelayFormatted"` // 格式化后的平均延迟
 }
 
 // BlockAnalysisResult 代表 Block 分析的整体结果 (JSON)
@@ -28,13 +29,71 @@ type BlockAnalysisResult struct {
 	TotalContentions    int64                 `json:"totalContentions"`
 	TotalDelayNanos     int64                 `json:"totalDelayNanos"`
 	TotalDelayFormatted string                `json:"totalDelayFormatted"`
+	PrimaryMetric       string                `json:"primaryMetric"`    // 排序和展示使用的主要指标 (delay 或 contentions)
+	SortBy              string                `json:"sortBy,omitempty"` // 显式指定的排序方式 (见 ContentionSortKeys)，为空时按主要指标排序
 	TopN                int                   `json:"topN"`
 	Blocks              []BlockContentionStat `json:"blocks"`
+	CaptureConfig       *CaptureConfig        `json:"captureConfig,omitempty"`  // 从 profile 推断的采集配置 (如 block rate)
+	NoiseFilter         *NoiseFilterSummary   `json:"noiseFilter,omitempty"`    // 按 MinPercent 过滤掉的长尾函数 (设置了 MinPercent 时)
+	SkippedSamples      *SkippedSamples       `json:"skippedSamples,omitempty"` // 没有调用栈或缺少样本值而被跳过的样本 (有样本被跳过时)
+	numbers             NumberFormatter       // 生成格式化字段时使用的数值格式，Format 函数沿用同一格式
 }
 
-// AnalyzeBlockProfile 分析 Block profile 文件并返回格式化结果。
+// AnalyzeBlockProfile 分析 Block profile 文件并返回格式化结果，按总延迟排序。
 func AnalyzeBlockProfile(p *profile.Profile, topN int, format string) (string, error) {
-	log.Printf("Analyzing Block profile (Top %d, Format: %s)", topN, format)
+	return AnalyzeBlockProfileByMetric(p, topN, format, PrimaryMetricDelay)
+}
+
+// AnalyzeBlockProfileByMetric 与 AnalyzeBlockProfile 相同，但使用 primaryMetric (delay 或 contentions) 作为主要指标：
+// 按该指标排序，并在标题总值和表格中优先展示它。关心锁被阻塞的频率而不是总等待时间时使用 contentions。
+func AnalyzeBlockProfileByMetric(p *profile.Profile, topN int, format string, primaryMetric string) (string, error) {
+	return AnalyzeBlockProfileWithOptions(p, topN, format, ContentionAnalysisOptions{PrimaryMetric: primaryMetric})
+}
+
+// AnalyzeBlockProfileWithOptions 与 AnalyzeBlockProfileByMetric 相同，但支持 ContentionAnalysisOptions，
+// 例如按 MinPercent 过滤长尾函数。
+func AnalyzeBlockProfileWithOptions(p *profile.Profile, topN int, format string, opts ContentionAnalysisOptions) (string, error) {
+	return AnalyzeBlockProfileContext(context.Background(), p, topN, format, opts)
+}
+
+// AnalyzeBlockProfileContext 与 AnalyzeBlockProfileWithOptions 相同，但在聚合样本时定期检查 ctx，ctx 被取消时尽快停止
+func AnalyzeBlockProfileContext(ctx context.Context, p *profile.Profile, topN int, format string, opts ContentionAnalysisOptions) (string, error) {
+	result, err := BlockProfileStatsContext(ctx, p, topN, opts)
+	if err != nil {
+		return "", err
+	}
+	return FormatBlockResult(result, format)
+}
+
+// BlockProfileStats 按函数聚合 Block profile 的阻塞次数和延迟，返回按 primaryMetric 排序的结构化结果，
+// 供需要直接使用数值的调用方使用。Blocks 包含所有函数，topN 只决定格式化时展示的行数。
+func BlockProfileStats(p *profile.Profile, topN int, primaryMetric string) (*BlockAnalysisResult, error) {
+	return BlockProfileStatsWithOptions(p, topN, ContentionAnalysisOptions{PrimaryMetric: primaryMetric})
+}
+
+// BlockProfileStatsWithOptions 与 BlockProfileStats 相同，但支持 ContentionAnalysisOptions。
+func BlockProfileStatsWithOptions(p *profile.Profile, topN int, opts ContentionAnalysisOptions) (*BlockAnalysisResult, error) {
+	return BlockProfileStatsContext(context.Background(), p, topN, opts)
+}
+
+// BlockProfileStatsContext 与 BlockProfileStatsWithOptions 相同，但在聚合样本时定期检查 ctx，ctx 被取消时返回包装了 ctx.Err() 的错误
+func BlockProfileStatsContext(ctx context.Context, p *profile.Profile, topN int, opts ContentionAnalysisOptions) (*BlockAnalysisResult, error) {
+	primaryMetric := opts.PrimaryMetric
+	if primaryMetric == "" {
+		primaryMetric = PrimaryMetricDelay
+	}
+	if primaryMetric != PrimaryMetricDelay && primaryMetric != PrimaryMetricContentions {
+		return nil, fmt.Errorf("unsupported primary metric: %s (expected delay or contentions)", primaryMetric)
+	}
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = primaryMetric
+	}
+	if sortBy != PrimaryMetricDelay && sortBy != PrimaryMetricContentions && sortBy != SortByAvgDelay {
+		return nil, fmt.Errorf("unsupported sort_by: %s (expected %s)", sortBy, strings.Join(ContentionSortKeys, ", "))
+	}
+	byContentions := primaryMetric == PrimaryMetricContentions
+	logDebug("Analyzing Block profile (Top %d, Primary metric: %s)", topN, primaryMetric)
 
 	// --- 1. 确定用于分析的值的索引 ---
 	// Block profile 有两个样本类型：
@@ -53,17 +112,20 @@ func AnalyzeBlockProfile(p *profile.Profile, topN int, format string) (string, e
 	}
 
 	if contentionIndex == -1 || delayIndex == -1 {
-		return "", fmt.Errorf("无法从 profile 中找到必需的样本类型 (contentions, delay)")
+		return nil, fmt.Errorf("无法从 profile 中找到必需的样本类型 (contentions, delay)")
 	}
 
-	log.Printf("使用索引 %d (contentions) 和 %d (delay) 进行 Block 分析", contentionIndex, delayIndex)
+	logDebug("使用索引 %d (contentions) 和 %d (delay) 进行 Block 分析", contentionIndex, delayIndex)
 
 	// --- 2. 按函数聚合阻塞统计 ---
 	blockData := make(map[string]*BlockContentionStat)
 	totalContentions := int64(0)
 	totalDelay := int64(0)
 
-	for _, s := range p.Sample {
+	for i, s := range p.Sample {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, err
+		}
 		if len(s.Location) == 0 || len(s.Value) <= max(contentionIndex, delayIndex) {
 			continue
 		}
@@ -72,18 +134,7 @@ func AnalyzeBlockProfile(p *profile.Profile, topN int, format string) (string, e
 		delay := s.Value[delayIndex]
 
 		// 获取最顶层函数名
-		loc := s.Location[0]
-		functionName := ""
-		for _, line := range loc.Line {
-			if line.Function != nil {
-				functionName = line.Function.Name
-				break
-			}
-		}
-
-		if functionName == "" {
-			functionName = "unknown"
-		}
+		functionName := topFunctionName(s)
 
 		// 聚合统计数据
 		if stat, exists := blockData[functionName]; exists {
@@ -91,10 +142,10 @@ func AnalyzeBlockProfile(p *profile.Profile, topN int, format string) (string, e
 			stat.DelayNanos += delay
 		} else {
 			blockData[functionName] = &BlockContentionStat{
-				FunctionName:  functionName,
-				Contentions:   contentions,
-				DelayNanos:    delay,
-				AvgDelayNanos: delay / contentions, // 计算平均延迟
+				FunctionName: functionName,
+				FunctionID:   FunctionID(functionName),
+				Contentions:  contentions,
+				DelayNanos:   delay,
 			}
 		}
 
@@ -102,41 +153,81 @@ func AnalyzeBlockProfile(p *profile.Profile, topN int, format string) (string, e
 		totalDelay += delay
 	}
 
-	if totalContentions == 0 {
-		return "Block profile 分析完成：未发现阻塞操作。", nil
+	result := &BlockAnalysisResult{
+		ProfileType:         "block",
+		TotalContentions:    totalContentions,
+		TotalDelayNanos:     totalDelay,
+		TotalDelayFormatted: opts.Numbers.Nanos(totalDelay),
+		PrimaryMetric:       primaryMetric,
+		SortBy:              opts.SortBy,
+		TopN:                topN,
+		Blocks:              []BlockContentionStat{},
+		CaptureConfig:       ParseCaptureConfig(p),
+		SkippedSamples:      countSkippedSamples(p, contentionIndex, delayIndex),
+		numbers:             opts.Numbers,
+	}
+	if totalContentions == 0 && totalDelay == 0 {
+		return result, nil
 	}
 
-	// --- 3. 按延迟时间排序（优先显示延迟最长的函数）---
+	// --- 3. 按 sortBy 排序（默认按主要指标，即延迟时间，优先显示延迟最长的函数）---
 	stats := make([]*BlockContentionStat, 0, len(blockData))
 	for _, stat := range blockData {
 		// 计算百分比
-		stat.ContentionsPct = float64(stat.Contentions) / float64(totalContentions) * 100
-		stat.DelayPct = float64(stat.DelayNanos) / float64(totalDelay) * 100
+		stat.ContentionsPct = percentOf(stat.Contentions, totalContentions)
+		stat.DelayPct = percentOf(stat.DelayNanos, totalDelay)
+		// 平均延迟在所有样本聚合完成后计算，同一函数出现在多个样本中时才正确
+		stat.AvgDelayNanos = avgDelayNanos(stat.DelayNanos, stat.Contentions)
 		// 格式化时间
-		stat.DelayFormatted = formatNanos(stat.DelayNanos)
-		stat.AvgDelayFormatted = formatNanos(stat.AvgDelayNanos)
+		stat.DelayFormatted = opts.Numbers.Nanos(stat.DelayNanos)
+		stat.AvgDelayFormatted = opts.Numbers.Nanos(stat.AvgDelayNanos)
 		stats = append(stats, stat)
 	}
 
-	sort.Slice(stats, func(i, j int) bool {
-		return stats[i].DelayNanos > stats[j].DelayNanos // 按延迟降序
+	sortContentions(stats, sortBy, func(s *BlockContentionStat) (int64, int64, int64) {
+		return s.Contentions, s.DelayNanos, s.AvgDelayNanos
 	})
 
+	stats, result.NoiseFilter = dropContentionNoise(stats, func(s *BlockContentionStat) (int64, int64) { return s.Contentions, s.DelayNanos },
+		byContentions, totalContentions, totalDelay, opts.MinPercent, opts.Numbers)
+
+	// 将指针切片转换为值切片，并按排序后的顺序累加主要指标得到累计占比
+	result.Blocks = make([]BlockContentionStat, len(stats))
+	running := int64(0)
+	for i, stat := range stats {
+		if byContentions {
+			running += stat.Contentions
+			stat.SumPct = percentOf(running, totalContentions)
+		} else {
+			running += stat.DelayNanos
+			stat.SumPct = percentOf(running, totalDelay)
+		}
+		result.Blocks[i] = *stat
+	}
+	return result, nil
+}
+
+// FormatBlockResult 将 BlockProfileStats 的结果格式化为 text、markdown、json、compact 或 summary 输出，
+// 表格只展示前 result.TopN 个函数。
+func FormatBlockResult(result *BlockAnalysisResult, format string) (string, error) {
+	totalContentions := result.TotalContentions
+	totalDelay := result.TotalDelayNanos
+	numbers := result.numbers
+	if format == "summary" {
+		return formatSummary(blockSummary(result)), nil
+	}
+	if totalContentions == 0 && totalDelay == 0 {
+		return "Block profile 分析完成：未发现阻塞操作。\n\n" +
+			"提示：block profiling 默认是关闭的，profile 为空最常见的原因是程序没有开启它。\n" +
+			"请在程序启动时调用 runtime.SetBlockProfileRate(1) (记录所有阻塞事件；设为更大的纳秒值可降低开销，只采样超过该时长的阻塞)，" +
+			"然后重新采集 /debug/pprof/block。如果已经开启，则说明采集期间确实没有发生阻塞。" + formatContentionSkippedSamples(result.SkippedSamples, "\n\n"), nil
+	}
+	byContentions := result.PrimaryMetric == PrimaryMetricContentions
+	stats := result.Blocks
+	capture := result.CaptureConfig
+
 	// --- 4. 格式化输出 ---
 	if format == "json" {
-		// 将指针切片转换为值切片
-		blocks := make([]BlockContentionStat, len(stats))
-		for i, stat := range stats {
-			blocks[i] = *stat
-		}
-		result := BlockAnalysisResult{
-			ProfileType:         "block",
-			TotalContentions:    totalContentions,
-			TotalDelayNanos:     totalDelay,
-			TotalDelayFormatted: formatNanos(totalDelay),
-			TopN:                topN,
-			Blocks:              blocks,
-		}
 		jsonBytes, err := json.MarshalIndent(result, "", "  ")
 		if err != nil {
 			return "", fmt.Errorf("failed to marshal JSON: %w", err)
@@ -144,59 +235,127 @@ func AnalyzeBlockProfile(p *profile.Profile, topN int, format string) (string, e
 		return string(jsonBytes), nil
 	}
 
+	limit := result.TopN
+	if limit > len(stats) {
+		limit = len(stats)
+	}
+
+	if format == "compact" {
+		rows := make([]compactRow, 0, limit)
+		for i := 0; i < limit; i++ {
+			if byContentions {
+				rows = append(rows, compactRow{Name: stats[i].FunctionName, Value: numbers.Number(stats[i].Contentions), Percent: stats[i].ContentionsPct})
+			} else {
+				rows = append(rows, compactRow{Name: stats[i].FunctionName, Value: stats[i].DelayFormatted, Percent: stats[i].DelayPct})
+			}
+		}
+		if byContentions {
+			return formatCompact(fmt.Sprintf("block contentions=%d delay=%s top=%d", totalContentions, numbers.Nanos(totalDelay), limit)+capture.compactSuffix()+result.NoiseFilter.compactSuffix()+result.SkippedSamples.compactSuffix(), rows), nil
+		}
+		return formatCompact(fmt.Sprintf("block delay=%s contentions=%d top=%d", numbers.Nanos(totalDelay), totalContentions, limit)+capture.compactSuffix()+result.NoiseFilter.compactSuffix()+result.SkippedSamples.compactSuffix(), rows), nil
+	}
+
 	// Text/Markdown 输出
 	var b strings.Builder
 
 	if format == "markdown" {
 		b.WriteString("# Block Profile 分析报告\n\n")
-		b.WriteString(fmt.Sprintf("**总阻塞次数**: %s\n", formatNumber(totalContentions)))
-		b.WriteString(fmt.Sprintf("**总延迟时间**: %s\n\n", formatNanos(totalDelay)))
-		b.WriteString("## Top 阻塞点\n\n")
-		b.WriteString("| 排名 | 函数名 | 阻塞次数 | 阻塞占比 | 总延迟 | 延迟占比 | 平均延迟 |\n")
-		b.WriteString("|------|--------|----------|----------|--------|----------|----------|\n")
+		b.WriteString(fmt.Sprintf("**总阻塞次数**: %s\n", numbers.Number(totalContentions)))
+		if byContentions {
+			b.WriteString(fmt.Sprintf("**平均每次阻塞延迟**: %s\n", numbers.Nanos(totalDelay/totalContentions)))
+		}
+		b.WriteString(fmt.Sprintf("**总延迟时间**: %s\n", numbers.Nanos(totalDelay)))
+		if capture != nil {
+			b.WriteString(fmt.Sprintf("**采集配置**: %s\n", capture))
+		}
+		b.WriteString("\n")
+		if byContentions {
+			b.WriteString("## Top 阻塞点" + contentionSortTitle(result.SortBy, result.PrimaryMetric, "阻塞次数") + "\n\n")
+			b.WriteString("| 排名 | 函数名 | 阻塞次数 | 阻塞占比 | 累计占比 | 平均延迟 | 总延迟 | 延迟占比 |\n")
+			b.WriteString("|------|--------|----------|----------|----------|----------|--------|----------|\n")
+		} else {
+			b.WriteString("## Top 阻塞点" + contentionSortTitle(result.SortBy, result.PrimaryMetric, "阻塞次数") + "\n\n")
+			b.WriteString("| 排名 | 函数名 | 阻塞次数 | 阻塞占比 | 总延迟 | 延迟占比 | 累计占比 | 平均延迟 |\n")
+			b.WriteString("|------|--------|----------|----------|--------|----------|----------|----------|\n")
+		}
 	} else {
 		b.WriteString("Block Profile 分析结果\n")
 		b.WriteString("========================\n\n")
-		b.WriteString(fmt.Sprintf("总阻塞次数: %s\n", formatNumber(totalContentions)))
-		b.WriteString(fmt.Sprintf("总延迟时间: %s\n\n", formatNanos(totalDelay)))
-		b.WriteString("Top 阻塞点:\n")
-		b.WriteString(strings.Repeat("-", 120) + "\n")
-		b.WriteString(fmt.Sprintf("%-6s %-50s %12s %10s %12s %10s %12s\n",
-			"排名", "函数名", "阻塞次数", "阻塞占比", "总延迟", "延迟占比", "平均延迟"))
+		b.WriteString(fmt.Sprintf("总阻塞次数: %s\n", numbers.Number(totalContentions)))
+		if byContentions {
+			b.WriteString(fmt.Sprintf("平均每次阻塞延迟: %s\n", numbers.Nanos(totalDelay/totalContentions)))
+		}
+		b.WriteString(fmt.Sprintf("总延迟时间: %s\n", numbers.Nanos(totalDelay)))
+		if capture != nil {
+			b.WriteString(fmt.Sprintf("采集配置: %s\n", capture))
+		}
+		b.WriteString("\n")
+		if byContentions {
+			b.WriteString("Top 阻塞点" + contentionSortTitle(result.SortBy, result.PrimaryMetric, "阻塞次数") + ":\n")
+			b.WriteString(strings.Repeat("-", 120) + "\n")
+			b.WriteString(fmt.Sprintf("%-6s %-50s %12s %10s %10s %12s %12s %10s\n",
+				"排名", "函数名", "阻塞次数", "阻塞占比", "累计占比", "平均延迟", "总延迟", "延迟占比"))
+		} else {
+			b.WriteString("Top 阻塞点" + contentionSortTitle(result.SortBy, result.PrimaryMetric, "阻塞次数") + ":\n")
+			b.WriteString(strings.Repeat("-", 120) + "\n")
+			b.WriteString(fmt.Sprintf("%-6s %-50s %12s %10s %12s %10s %10s %12s\n",
+				"排名", "函数名", "阻塞次数", "阻塞占比", "总延迟", "延迟占比", "累计占比", "平均延迟"))
+		}
 		b.WriteString(strings.Repeat("-", 120) + "\n")
 	}
 
-	limit := topN
-	if limit > len(stats) {
-		limit = len(stats)
-	}
-
 	for i := 0; i < limit; i++ {
-		stat := stats[i]
-		if format == "markdown" {
-			b.WriteString(fmt.Sprintf("| %d | `%s` | %s | %.2f%% | %s | %.2f%% | %s |\n",
+		stat := &stats[i]
+		if byContentions {
+			rowFormat := "%-6d %-50s %12s %9.2f%% %9.2f%% %12s %12s %9.2f%%\n"
+			nameWidth := 50
+			if format == "markdown" {
+				rowFormat = "| %d | `%s` | %s | %.2f%% | %.2f%% | %s | %s | %.2f%% |\n"
+				nameWidth = 40
+			}
+			b.WriteString(fmt.Sprintf(rowFormat,
+				i+1,
+				truncateString(stat.FunctionName, nameWidth),
+				numbers.Number(stat.Contentions),
+				stat.ContentionsPct,
+				stat.SumPct,
+				stat.AvgDelayFormatted,
+				stat.DelayFormatted,
+				stat.DelayPct,
+			))
+		} else if format == "markdown" {
+			b.WriteString(fmt.Sprintf("| %d | `%s` | %s | %.2f%% | %s | %.2f%% | %.2f%% | %s |\n",
 				i+1,
 				truncateString(stat.FunctionName, 40),
-				formatNumber(stat.Contentions),
+				numbers.Number(stat.Contentions),
 				stat.ContentionsPct,
 				stat.DelayFormatted,
 				stat.DelayPct,
+				stat.SumPct,
 				stat.AvgDelayFormatted,
 			))
 		} else {
-			b.WriteString(fmt.Sprintf("%-6d %-50s %12s %9.2f%% %12s %9.2f%% %12s\n",
+			b.WriteString(fmt.Sprintf("%-6d %-50s %12s %9.2f%% %12s %9.2f%% %9.2f%% %12s\n",
 				i+1,
 				truncateString(stat.FunctionName, 50),
-				formatNumber(stat.Contentions),
+				numbers.Number(stat.Contentions),
 				stat.ContentionsPct,
 				stat.DelayFormatted,
 				stat.DelayPct,
+				stat.SumPct,
 				stat.AvgDelayFormatted,
 			))
 		}
 	}
+	if result.NoiseFilter != nil {
+		b.WriteString(fmt.Sprintf("\n%s\n", formatContentionNoiseFilter(result.NoiseFilter)))
+	}
+	b.WriteString(formatContentionSkippedSamples(result.SkippedSamples, "\n"))
 
 	b.WriteString("\n**分析建议**:\n")
+	if byContentions {
+		b.WriteString("- 关注阻塞次数最多的函数，频繁的短暂阻塞会累积成明显的调度开销\n")
+	}
 	b.WriteString("- 关注总延迟时间最长的函数，这些可能是通道操作、网络 I/O 或系统调用导致的阻塞\n")
 	b.WriteString("- 高阻塞次数但低延迟可能表明频繁但短暂的阻塞操作（如无缓冲通道的发送/接收）\n")
 	b.WriteString("- 考虑使用带缓冲的通道、超时机制或异步处理来减少阻塞\n")
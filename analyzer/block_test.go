@@ -1,6 +1,7 @@
 package analyzer
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/google/pprof/profile"
@@ -145,6 +146,11 @@ func TestAnalyzeBlockProfileEmpty(t *testing.T) {
 	if !containsString(result, "未发现阻塞操作") {
 		t.Errorf("Empty profile should return friendly message, got: %s", result)
 	}
+
+	// 应该提示如何开启 block profiling
+	if !containsString(result, "runtime.SetBlockProfileRate") {
+		t.Errorf("Empty profile should explain how to enable block profiling, got: %s", result)
+	}
 }
 
 // TestAnalyzeBlockProfileInvalidSampleTypes 测试缺少样本类型的情况
@@ -248,3 +254,166 @@ func TestAnalyzeBlockProfileAverageDelay(t *testing.T) {
 		t.Errorf("Result should contain average delay, got: %s", result)
 	}
 }
+
+// TestAnalyzeBlockProfilePrimaryMetric 测试 primary_metric 决定排序、列顺序和标题总值
+func TestAnalyzeBlockProfilePrimaryMetric(t *testing.T) {
+	newSample := func(name string, contentions, delay int64) *profile.Sample {
+		return &profile.Sample{
+			Value:    []int64{contentions, delay},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+		}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "contentions", Unit: "count"},
+			{Type: "delay", Unit: "nanoseconds"},
+		},
+		Sample: []*profile.Sample{
+			newSample("main.frequent", 1000, 10000000), // 次数多但总延迟短
+			newSample("main.slow", 10, 500000000),      // 次数少但总延迟长
+		},
+	}
+
+	byDelay, err := AnalyzeBlockProfileByMetric(p, 1, "text", PrimaryMetricDelay)
+	if err != nil {
+		t.Fatalf("AnalyzeBlockProfileByMetric(delay) error = %v", err)
+	}
+	if !containsString(byDelay, "main.slow") || containsString(byDelay, "main.frequent") {
+		t.Errorf("delay metric should rank main.slow first, got:\n%s", byDelay)
+	}
+	if legacy, _ := AnalyzeBlockProfile(p, 1, "text"); legacy != byDelay {
+		t.Errorf("AnalyzeBlockProfile should default to the delay metric")
+	}
+
+	byCount, err := AnalyzeBlockProfileByMetric(p, 1, "markdown", PrimaryMetricContentions)
+	if err != nil {
+		t.Fatalf("AnalyzeBlockProfileByMetric(contentions) error = %v", err)
+	}
+	if !containsString(byCount, "main.frequent") || containsString(byCount, "main.slow") {
+		t.Errorf("contentions metric should rank main.frequent first, got:\n%s", byCount)
+	}
+	for _, want := range []string{"按阻塞次数排序", "| 排名 | 函数名 | 阻塞次数 | 阻塞占比 | 累计占比 | 平均延迟 | 总延迟 | 延迟占比 |", "**平均每次阻塞延迟**"} {
+		if !containsString(byCount, want) {
+			t.Errorf("contentions report should contain %q, got:\n%s", want, byCount)
+		}
+	}
+
+	compact, err := AnalyzeBlockProfileByMetric(p, 1, "compact", PrimaryMetricContentions)
+	if err != nil {
+		t.Fatalf("AnalyzeBlockProfileByMetric(compact) error = %v", err)
+	}
+	if !containsString(compact, "block contentions=1010 delay=") || !containsString(compact, "frequent 1.0K") {
+		t.Errorf("compact header should lead with the contention total, got:\n%s", compact)
+	}
+
+	jsonOut, err := AnalyzeBlockProfileByMetric(p, 5, "json", PrimaryMetricContentions)
+	if err != nil {
+		t.Fatalf("AnalyzeBlockProfileByMetric(json) error = %v", err)
+	}
+	if !containsString(jsonOut, `"primaryMetric": "contentions"`) {
+		t.Errorf("JSON should record the primary metric, got:\n%s", jsonOut)
+	}
+
+	if _, err := AnalyzeBlockProfileByMetric(p, 5, "text", "latency"); err == nil {
+		t.Error("Expected error for unsupported primary metric, got nil")
+	}
+}
+
+// TestAnalyzeBlockProfileZeroContentions 测试次数为 0 但记录了延迟的样本不会导致除以零，平均延迟按整个延迟计算
+func TestAnalyzeBlockProfileZeroContentions(t *testing.T) {
+	sample := func(name string, contentions, delay int64) *profile.Sample {
+		return &profile.Sample{
+			Value:    []int64{contentions, delay},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+		}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "contentions", Unit: "count"},
+			{Type: "delay", Unit: "nanoseconds"},
+		},
+		Sample: []*profile.Sample{
+			sample("main.instrumented", 0, 5000000), // 插桩 profile 只记录了 5ms 延迟，没有次数
+			sample("main.wait", 10, 1000000),
+		},
+	}
+
+	for _, format := range []string{"text", "markdown", "compact"} {
+		if _, err := AnalyzeBlockProfile(p, 5, format); err != nil {
+			t.Fatalf("AnalyzeBlockProfile(%s) error = %v", format, err)
+		}
+	}
+	result, err := AnalyzeBlockProfile(p, 5, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeBlockProfile(json) error = %v", err)
+	}
+	var parsed BlockAnalysisResult
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	avg := map[string]int64{}
+	for _, c := range parsed.Blocks {
+		avg[c.FunctionName] = c.AvgDelayNanos
+	}
+	if avg["main.instrumented"] != 5000000 {
+		t.Errorf("avg delay of zero-count sample = %d, want 5000000 (the whole delay)", avg["main.instrumented"])
+	}
+	if avg["main.wait"] != 100000 {
+		t.Errorf("avg delay of main.wait = %d, want 100000", avg["main.wait"])
+	}
+
+	// 只有一个次数为 0 的样本时总次数为 0，但延迟不为 0，不能被当作空 profile
+	p.Sample = p.Sample[:1]
+	text, err := AnalyzeBlockProfile(p, 5, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeBlockProfile(single zero-count sample) error = %v", err)
+	}
+	if containsString(text, "未发现阻塞操作") || !containsString(text, "main.instrumented") {
+		t.Errorf("single zero-count sample reported as empty profile:\n%s", text)
+	}
+	result, err = AnalyzeBlockProfile(p, 5, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeBlockProfile(single zero-count sample, json) error = %v", err)
+	}
+	parsed = BlockAnalysisResult{}
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(parsed.Blocks) != 1 || parsed.Blocks[0].DelayNanos != 5000000 || parsed.Blocks[0].AvgDelayNanos != 5000000 {
+		t.Errorf("single zero-count sample Blocks = %+v, want main.instrumented with 5ms delay", parsed.Blocks)
+	}
+}
+
+// TestAnalyzeBlockProfileAverageDelayAggregated 测试同一函数出现在多个样本中时，平均延迟按聚合后的总延迟和总次数计算
+func TestAnalyzeBlockProfileAverageDelayAggregated(t *testing.T) {
+	fn := &profile.Function{Name: "main.wait"}
+	sample := func(contentions, delay int64) *profile.Sample {
+		return &profile.Sample{
+			Value:    []int64{contentions, delay},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: fn}}}},
+		}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "contentions", Unit: "count"},
+			{Type: "delay", Unit: "nanoseconds"},
+		},
+		// 两个不同调用栈的样本落在同一个函数：(10ms + 90ms) / (10 + 30) = 2.5ms，而不是第一个样本的 1ms
+		Sample: []*profile.Sample{sample(10, 10000000), sample(30, 90000000)},
+	}
+
+	result, err := AnalyzeBlockProfile(p, 5, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeBlockProfile() error = %v", err)
+	}
+	var parsed BlockAnalysisResult
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(parsed.Blocks) != 1 {
+		t.Fatalf("expected samples to be aggregated into 1 function, got %d", len(parsed.Blocks))
+	}
+	if got := parsed.Blocks[0]; got.Contentions != 40 || got.AvgDelayNanos != 2500000 {
+		t.Errorf("aggregated stat = %+v, want 40 events with avg delay 2500000", got)
+	}
+}
@@ -0,0 +1,26 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+)
+
+// cancelCheckInterval 是长循环中检查 ctx 是否已取消的间隔 (迭代次数)，避免每次迭代都检查
+const cancelCheckInterval = 4096
+
+// checkCanceled 每 cancelCheckInterval 次迭代检查一次 ctx，已取消或超时时返回包装了 ctx.Err() 的错误，
+// 调用方可以用 errors.Is(err, context.Canceled) 区分取消和真正的失败。
+func checkCanceled(ctx context.Context, i int) error {
+	if i%cancelCheckInterval != 0 {
+		return nil
+	}
+	return canceledErr(ctx)
+}
+
+// canceledErr 在 ctx 已取消或超时时返回包装了 ctx.Err() 的错误，否则返回 nil
+func canceledErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("analysis canceled: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// newSingleSampleProfile 构造只有一个样本的测试 profile，样本类型为 "类型/单位" 对，values 与样本类型一一对应
+func newSingleSampleProfile(types [][2]string, values ...int64) *profile.Profile {
+	fn := &profile.Function{ID: 1, Name: "main.work", Filename: "main.go"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn, Line: 10}}}
+	p := &profile.Profile{Function: []*profile.Function{fn}, Location: []*profile.Location{loc}}
+	for _, st := range types {
+		p.SampleType = append(p.SampleType, &profile.ValueType{Type: st[0], Unit: st[1]})
+	}
+	p.Sample = []*profile.Sample{{Location: []*profile.Location{loc}, Value: values}}
+	return p
+}
+
+// TestAnalyzersContextCanceled 测试核心分析器、内存泄漏检测和 heap 时序分析在 ctx 已取消时停止，并返回可以用 errors.Is 识别的取消错误
+func TestAnalyzersContextCanceled(t *testing.T) {
+	cpu := newCPUProfile(map[string]int64{"main.work": 100})
+	heap := newSingleSampleProfile([][2]string{{"alloc_objects", "count"}, {"alloc_space", "bytes"}, {"inuse_objects", "count"}, {"inuse_space", "bytes"}}, 1, 1024, 1, 1024)
+	goroutine := newGoroutineProfile(map[string]int64{"main.work": 3})
+	contention := newSingleSampleProfile([][2]string{{"contentions", "count"}, {"delay", "nanoseconds"}}, 2, 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	analyses := map[string]func(context.Context) error{
+		"cpu": func(ctx context.Context) error {
+			_, err := AnalyzeCPUProfileContext(ctx, cpu, 10, "text", CPUAnalysisOptions{})
+			return err
+		},
+		"heap": func(ctx context.Context) error {
+			_, err := AnalyzeHeapProfileContext(ctx, heap, 10, "text", HeapAnalysisOptions{})
+			return err
+		},
+		"allocs": func(ctx context.Context) error {
+			_, err := AnalyzeAllocsProfileContext(ctx, heap, 10, "text", AllocsAnalysisOptions{})
+			return err
+		},
+		"goroutine": func(ctx context.Context) error {
+			_, err := AnalyzeGoroutineProfileContext(ctx, goroutine, 10, "text", GoroutineAnalysisOptions{})
+			return err
+		},
+		"mutex": func(ctx context.Context) error {
+			_, err := AnalyzeMutexProfileContext(ctx, contention, 10, "text", ContentionAnalysisOptions{})
+			return err
+		},
+		"block": func(ctx context.Context) error {
+			_, err := AnalyzeBlockProfileContext(ctx, contention, 10, "text", ContentionAnalysisOptions{})
+			return err
+		},
+		"memory leaks": func(ctx context.Context) error {
+			_, err := DetectPotentialMemoryLeaksContext(ctx, heap, heap, LeakDetectionOptions{})
+			return err
+		},
+		"time series": func(ctx context.Context) error {
+			_, err := AnalyzeHeapTimeSeriesContext(ctx, []*profile.Profile{heap, heap, heap}, []string{"T1", "T2", "T3"}, "text", TimeSeriesOptions{})
+			return err
+		},
+	}
+	for name, analyze := range analyses {
+		if err := analyze(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected a context.Canceled error, got %v", name, err)
+		}
+		if err := analyze(context.Background()); err != nil {
+			t.Errorf("%s: with a live context error = %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// CaptureConfig 是从 profile 自身推断出的采集配置 (JSON)。
+// 采样率/比例决定了 profile 中的数值能代表多少真实事件，例如 mutex fraction 很低时竞争次数看起来会很少。
+type CaptureConfig struct {
+	CPUSamplingHz        int64 `json:"cpuSamplingHz,omitempty"`        // CPU 采样频率，来自 Period (cpu/nanoseconds)
+	MemProfileRate       int64 `json:"memProfileRate,omitempty"`       // runtime.MemProfileRate (字节)，来自 Period (space/bytes)
+	MutexProfileFraction int64 `json:"mutexProfileFraction,omitempty"` // runtime.SetMutexProfileFraction 的参数
+	BlockProfileRate     int64 `json:"blockProfileRate,omitempty"`     // runtime.SetBlockProfileRate 的参数 (纳秒)
+}
+
+// captureSettingPattern 匹配 Comments 中记录的采集命令/参数，例如
+// "-test.mutexprofilefraction=5"、"SetBlockProfileRate(10000)"、"mem_profile_rate: 4096"
+var captureSettingPattern = regexp.MustCompile(`(?i)(mutex[_.-]?(?:profile[_.-]?)?fraction|block[_.-]?(?:profile[_.-]?)?rate|mem[_.-]?profile[_.-]?rate|cpu[_.-]?(?:profile[_.-]?rate|hz))\s*[=:(\s]\s*(\d+)`)
+
+// ParseCaptureConfig 从 profile 的 Period 和 Comments 中提取采集配置，没有任何可识别的配置时返回 nil。
+// Period 只能给出 CPU 采样频率和 MemProfileRate；mutex fraction 和 block rate 不会写入 Period，只能来自 Comments。
+func ParseCaptureConfig(p *profile.Profile) *CaptureConfig {
+	var c CaptureConfig
+	for _, comment := range p.Comments {
+		for _, m := range captureSettingPattern.FindAllStringSubmatch(comment, -1) {
+			v, err := strconv.ParseInt(m[2], 10, 64)
+			if err != nil || v <= 0 {
+				continue
+			}
+			key := strings.ToLower(m[1])
+			switch {
+			case strings.HasPrefix(key, "mutex"):
+				c.MutexProfileFraction = v
+			case strings.HasPrefix(key, "block"):
+				c.BlockProfileRate = v
+			case strings.HasPrefix(key, "mem"):
+				c.MemProfileRate = v
+			default:
+				c.CPUSamplingHz = v
+			}
+		}
+	}
+
+	// Period 是 profile 本身记录的采样周期，优先于 Comments
+	if p.PeriodType != nil && p.Period > 0 {
+		switch {
+		case p.PeriodType.Type == "cpu" && p.PeriodType.Unit == "nanoseconds":
+			c.CPUSamplingHz = 1e9 / p.Period
+		case p.PeriodType.Type == "space" && p.PeriodType.Unit == "bytes":
+			c.MemProfileRate = p.Period
+		}
+	}
+
+	if c == (CaptureConfig{}) {
+		return nil
+	}
+	return &c
+}
+
+// String 返回可读的采集配置，例如 "CPU 100 Hz, MutexProfileFraction 5 (1/5 of events sampled)"
+func (c *CaptureConfig) String() string {
+	return c.format(NumberFormatter{})
+}
+
+// format 与 String 相同，但 MemProfileRate 和 BlockProfileRate 按 numbers 格式化
+func (c *CaptureConfig) format(numbers NumberFormatter) string {
+	if c == nil {
+		return ""
+	}
+	var parts []string
+	if c.CPUSamplingHz > 0 {
+		parts = append(parts, fmt.Sprintf("CPU %d Hz", c.CPUSamplingHz))
+	}
+	if c.MemProfileRate > 0 {
+		parts = append(parts, fmt.Sprintf("MemProfileRate %s", numbers.Bytes(c.MemProfileRate)))
+	}
+	if c.MutexProfileFraction > 0 {
+		parts = append(parts, fmt.Sprintf("MutexProfileFraction %d (1/%d of events sampled)", c.MutexProfileFraction, c.MutexProfileFraction))
+	}
+	if c.BlockProfileRate > 0 {
+		parts = append(parts, fmt.Sprintf("BlockProfileRate %s", numbers.Nanos(c.BlockProfileRate)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// compactSuffix 返回附加到 compact 格式首行的 key=value 配置，例如 " hz=100 mutex_fraction=5"
+func (c *CaptureConfig) compactSuffix() string {
+	if c == nil {
+		return ""
+	}
+	var b strings.Builder
+	if c.CPUSamplingHz > 0 {
+		b.WriteString(fmt.Sprintf(" hz=%d", c.CPUSamplingHz))
+	}
+	if c.MemProfileRate > 0 {
+		b.WriteString(fmt.Sprintf(" mem_rate=%d", c.MemProfileRate))
+	}
+	if c.MutexProfileFraction > 0 {
+		b.WriteString(fmt.Sprintf(" mutex_fraction=%d", c.MutexProfileFraction))
+	}
+	if c.BlockProfileRate > 0 {
+		b.WriteString(fmt.Sprintf(" block_rate=%d", c.BlockProfileRate))
+	}
+	return b.String()
+}
+
+// DefaultCPUPeriodTolerance 是 CPU profile 隐含采样周期与记录的 Period 之间默认允许的相对偏差 (10%)
+const DefaultCPUPeriodTolerance = 0.1
+
+// CPUPeriodWarning 检查 CPU profile 中 samples/count 与 cpu/nanoseconds 两列的总值是否与 Period 一致。
+// cpu 总值除以样本数是平均每个样本代表的 CPU 时间 (隐含采样周期)，正常情况下应等于 Period；
+// 相对偏差超过 tolerance (例如 0.1 表示 10%，<= 0 时使用 DefaultCPUPeriodTolerance) 时返回警告，否则返回空字符串。
+// 偏差通常说明采集配置异常，或机器过载导致样本丢失，此时 CPU profile 可能不具代表性。
+// profile 缺少这两列、没有样本或 Period 无效时不做检查。
+func CPUPeriodWarning(p *profile.Profile, tolerance float64) string {
+	if tolerance <= 0 {
+		tolerance = DefaultCPUPeriodTolerance
+	}
+	if p.PeriodType == nil || p.PeriodType.Unit != "nanoseconds" || p.Period <= 0 {
+		return ""
+	}
+	countIndex, cpuIndex := -1, -1
+	for i, st := range p.SampleType {
+		switch {
+		case st.Type == "samples" && st.Unit == "count":
+			countIndex = i
+		case st.Type == "cpu" && st.Unit == "nanoseconds":
+			cpuIndex = i
+		}
+	}
+	if countIndex < 0 || cpuIndex < 0 {
+		return ""
+	}
+
+	var samples, nanos int64
+	for _, s := range p.Sample {
+		if countIndex < len(s.Value) && cpuIndex < len(s.Value) {
+			samples += s.Value[countIndex]
+			nanos += s.Value[cpuIndex]
+		}
+	}
+	if samples <= 0 || nanos <= 0 {
+		return ""
+	}
+
+	impliedPeriod := float64(nanos) / float64(samples)
+	deviation := (impliedPeriod - float64(p.Period)) / float64(p.Period)
+	if deviation >= -tolerance && deviation <= tolerance {
+		return ""
+	}
+	return fmt.Sprintf("CPU profile 的样本数 (%d) 与 CPU 时间 (%s) 推算出的平均采样周期为 %s (约 %.0f Hz)，"+
+		"与 profile 记录的 Period %s (%d Hz) 相差 %+.0f%%，超过允许的 %.0f%%。"+
+		"这通常说明采集配置异常 (例如实际采样频率与记录不一致、profile 由不同采样频率的 profile 合并而来)，"+
+		"或机器负载过高导致样本丢失，此时 CPU profile 可能不具代表性。",
+		samples, formatNanos(nanos), formatNanos(int64(impliedPeriod)), 1e9/impliedPeriod,
+		formatNanos(p.Period), 1e9/p.Period, deviation*100, tolerance*100)
+}
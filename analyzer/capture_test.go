@@ -0,0 +1,108 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestParseCaptureConfig 测试从 Period 和 Comments 中提取采集配置
+func TestParseCaptureConfig(t *testing.T) {
+	cpu := &profile.Profile{PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}, Period: 10000000}
+	if c := ParseCaptureConfig(cpu); c == nil || c.CPUSamplingHz != 100 {
+		t.Errorf("ParseCaptureConfig(cpu) = %+v, want 100 Hz", c)
+	}
+
+	heap := &profile.Profile{PeriodType: &profile.ValueType{Type: "space", Unit: "bytes"}, Period: 512 * 1024}
+	if c := ParseCaptureConfig(heap); c == nil || c.MemProfileRate != 512*1024 {
+		t.Errorf("ParseCaptureConfig(heap) = %+v, want MemProfileRate 524288", c)
+	}
+
+	commented := &profile.Profile{
+		PeriodType: &profile.ValueType{Type: "contentions", Unit: "count"},
+		Period:     1,
+		Comments:   []string{"go test -bench . -test.mutexprofilefraction=5", "runtime.SetBlockProfileRate(10000)"},
+	}
+	c := ParseCaptureConfig(commented)
+	if c == nil || c.MutexProfileFraction != 5 || c.BlockProfileRate != 10000 || c.CPUSamplingHz != 0 {
+		t.Fatalf("ParseCaptureConfig(commented) = %+v", c)
+	}
+	if got, want := c.String(), "MutexProfileFraction 5 (1/5 of events sampled), BlockProfileRate 10.00 μs"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if c := ParseCaptureConfig(&profile.Profile{Comments: []string{"built from main.go"}}); c != nil {
+		t.Errorf("ParseCaptureConfig() = %+v, want nil when nothing is recorded", c)
+	}
+}
+
+// TestCaptureConfigInReports 测试采集配置出现在 mutex 报告的各个格式中
+func TestCaptureConfigInReports(t *testing.T) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+		Comments:   []string{"mutex_profile_fraction=100"},
+		Sample: []*profile.Sample{{
+			Value:    []int64{3, 3000000},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: "main.lock"}}}}},
+		}},
+	}
+	for format, want := range map[string]string{
+		"text":     "采集配置: MutexProfileFraction 100",
+		"markdown": "**采集配置**: MutexProfileFraction 100",
+		"compact":  "mutex_fraction=100",
+		"json":     `"mutexProfileFraction": 100`,
+	} {
+		out, err := AnalyzeMutexProfile(p, 5, format)
+		if err != nil {
+			t.Fatalf("AnalyzeMutexProfile(%s) error = %v", format, err)
+		}
+		if !containsString(out, want) {
+			t.Errorf("%s output does not contain %q\nGot:\n%s", format, want, out)
+		}
+	}
+}
+
+// TestCPUPeriodWarning 测试样本数与 CPU 时间推算出的采样周期与 Period 不一致时给出警告
+func TestCPUPeriodWarning(t *testing.T) {
+	newProfile := func(period int64, rows ...[2]int64) *profile.Profile {
+		p := &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+			PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+			Period:     period,
+		}
+		for _, r := range rows {
+			p.Sample = append(p.Sample, &profile.Sample{Value: []int64{r[0], r[1]}})
+		}
+		return p
+	}
+
+	consistent := newProfile(10000000, [2]int64{100, 1000000000}, [2]int64{5, 50000000})
+	if w := CPUPeriodWarning(consistent, 0); w != "" {
+		t.Errorf("consistent profile should not warn, got %q", w)
+	}
+
+	// 100 个样本却只有 0.5 秒 CPU 时间：平均每个样本 5ms，而 Period 记录为 10ms (100 Hz)
+	mismatched := newProfile(10000000, [2]int64{100, 500000000})
+	w := CPUPeriodWarning(mismatched, 0)
+	for _, want := range []string{"5.00 ms", "200 Hz", "100 Hz", "-50%", "样本丢失"} {
+		if !containsString(w, want) {
+			t.Errorf("warning should contain %q, got %q", want, w)
+		}
+	}
+	if w := CPUPeriodWarning(mismatched, 0.6); w != "" {
+		t.Errorf("a tolerance of 60%% should accept a 50%% deviation, got %q", w)
+	}
+
+	if w := CPUPeriodWarning(newProfile(0, [2]int64{100, 500000000}), 0); w != "" {
+		t.Errorf("zero Period should not be checked, got %q", w)
+	}
+	cpuOnly := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     10000000,
+		Sample:     []*profile.Sample{{Value: []int64{500000000}}},
+	}
+	if w := CPUPeriodWarning(cpuOnly, 0); w != "" {
+		t.Errorf("profile without samples/count should not be checked, got %q", w)
+	}
+}
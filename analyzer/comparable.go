@@ -0,0 +1,263 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// 可比性检查项的名称和状态
+const (
+	CheckSampleType    = "sample_type"
+	CheckUnit          = "unit"
+	CheckBuildID       = "build_id"
+	CheckDurationRatio = "duration_ratio"
+
+	CheckStatusPass    = "pass"
+	CheckStatusFail    = "fail"
+	CheckStatusWarn    = "warn"    // 不影响结果，但值得注意 (例如未要求时 build ID 不同)
+	CheckStatusSkipped = "skipped" // profile 缺少所需信息，无法检查
+)
+
+// defaultMaxDurationRatio 是两个 profile 采集时长允许的最大倍数
+const defaultMaxDurationRatio = 2.0
+
+// ComparabilityOptions 定义可比性检查的参数
+type ComparabilityOptions struct {
+	ProfileType      string  // 要比较的 profile 类型；为空时要求两个 profile 的样本类型完全一致
+	MaxDurationRatio float64 // 较长与较短采集时长的最大比值，<= 0 时使用 2
+	RequireSameBuild bool    // 为 true 时 build ID 不同判定为失败，否则只给出警告
+}
+
+// ComparabilityCheck 是单个检查项的结果 (JSON)
+type ComparabilityCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"` // pass、fail、warn、skipped
+	Reason   string `json:"reason,omitempty"`
+	Baseline string `json:"baseline,omitempty"` // baseline 中被检查的值
+	Target   string `json:"target,omitempty"`   // target 中被检查的值
+}
+
+// ComparabilityResult 是可比性检查的结果 (JSON)
+type ComparabilityResult struct {
+	Comparable   bool                 `json:"comparable"`
+	ProfileType  string               `json:"profileType,omitempty"`
+	Checks       []ComparabilityCheck `json:"checks"`
+	FailedChecks []string             `json:"failedChecks,omitempty"`
+}
+
+// AssertComparable 检查两个 profile 是否可以比较，适合在 CI 中作为 compare_profiles 之前的门禁。
+// 只读取 profile 的元数据 (样本类型、Mapping、DurationNanos)，不做任何聚合分析。
+// 检查项：样本类型兼容、单位一致、主程序 build ID 一致、采集时长比值不超过 MaxDurationRatio。
+func AssertComparable(baseline, target *profile.Profile, opts ComparabilityOptions, format string) (string, error) {
+	if opts.MaxDurationRatio <= 0 {
+		opts.MaxDurationRatio = defaultMaxDurationRatio
+	}
+	logDebug("Checking profile comparability: type=%s, maxDurationRatio=%.2f, requireSameBuild=%t",
+		opts.ProfileType, opts.MaxDurationRatio, opts.RequireSameBuild)
+
+	result := ComparabilityResult{ProfileType: opts.ProfileType}
+	result.Checks = append(result.Checks, checkSampleTypes(baseline, target, opts.ProfileType)...)
+	result.Checks = append(result.Checks, checkBuildID(baseline, target, opts.RequireSameBuild))
+	result.Checks = append(result.Checks, checkDurationRatio(baseline, target, opts.MaxDurationRatio))
+
+	result.Comparable = true
+	for _, c := range result.Checks {
+		if c.Status == CheckStatusFail {
+			result.Comparable = false
+			result.FailedChecks = append(result.FailedChecks, c.Name)
+		}
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatComparability(result, format), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// checkSampleTypes 检查样本类型和单位。指定 profileType 时只检查用于比较的那一列 (必须按名称找到)，
+// 否则要求两个 profile 的样本类型列表一致 (顺序可以不同)。
+func checkSampleTypes(baseline, target *profile.Profile, profileType string) []ComparabilityCheck {
+	typeCheck := ComparabilityCheck{Name: CheckSampleType, Status: CheckStatusPass}
+	unitCheck := ComparabilityCheck{Name: CheckUnit, Status: CheckStatusPass}
+
+	if profileType != "" {
+		b, bErr := comparableValueType(baseline, profileType)
+		t, tErr := comparableValueType(target, profileType)
+		if bErr != nil || tErr != nil {
+			typeCheck.Status = CheckStatusFail
+			typeCheck.Reason = fmt.Sprintf("未按名称找到 %s profile 的样本类型: %s", profileType, joinErrors(bErr, tErr))
+			unitCheck.Status = CheckStatusSkipped
+			unitCheck.Reason = "样本类型检查未通过"
+			return []ComparabilityCheck{typeCheck, unitCheck}
+		}
+		typeCheck.Baseline, typeCheck.Target = b.Type, t.Type
+		unitCheck.Baseline, unitCheck.Target = b.Unit, t.Unit
+		if b.Type != t.Type {
+			typeCheck.Status = CheckStatusFail
+			typeCheck.Reason = fmt.Sprintf("baseline 使用 %s，target 使用 %s，比较的是不同的指标", b.Type, t.Type)
+		}
+		if b.Unit != t.Unit {
+			unitCheck.Status = CheckStatusFail
+			unitCheck.Reason = fmt.Sprintf("单位不一致 (%s vs %s)，数值不能直接相减", b.Unit, t.Unit)
+		}
+		return []ComparabilityCheck{typeCheck, unitCheck}
+	}
+
+	typeCheck.Baseline, typeCheck.Target = sampleTypeNames(baseline), sampleTypeNames(target)
+	targetUnits := make(map[string]string, len(target.SampleType))
+	for _, st := range target.SampleType {
+		targetUnits[st.Type] = st.Unit
+	}
+	var missing, unitMismatch []string
+	for _, st := range baseline.SampleType {
+		unit, ok := targetUnits[st.Type]
+		if !ok {
+			missing = append(missing, st.Type)
+		} else if unit != st.Unit {
+			unitMismatch = append(unitMismatch, fmt.Sprintf("%s (%s vs %s)", st.Type, st.Unit, unit))
+		}
+		delete(targetUnits, st.Type)
+	}
+	for typ := range targetUnits {
+		missing = append(missing, typ)
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		typeCheck.Status = CheckStatusFail
+		typeCheck.Reason = fmt.Sprintf("样本类型只出现在其中一个 profile 中: %s；请指定 profile_type 只检查要比较的指标", strings.Join(missing, ", "))
+	}
+	if len(unitMismatch) > 0 {
+		unitCheck.Status = CheckStatusFail
+		unitCheck.Reason = fmt.Sprintf("同名样本类型的单位不一致: %s", strings.Join(unitMismatch, ", "))
+	}
+	return []ComparabilityCheck{typeCheck, unitCheck}
+}
+
+// comparableValueType 返回 profileType 用于比较的样本类型；只能按位置猜测时视为错误
+func comparableValueType(p *profile.Profile, profileType string) (*profile.ValueType, error) {
+	index, warning, err := findValueColumn(p, profileType)
+	if err != nil {
+		return nil, err
+	}
+	if warning != "" {
+		return nil, fmt.Errorf("%s", warning)
+	}
+	return p.SampleType[index], nil
+}
+
+// checkBuildID 比较两个 profile 主程序 (第一个 Mapping) 的 build ID
+func checkBuildID(baseline, target *profile.Profile, requireSameBuild bool) ComparabilityCheck {
+	check := ComparabilityCheck{Name: CheckBuildID, Status: CheckStatusPass, Baseline: mainBuildID(baseline), Target: mainBuildID(target)}
+	switch {
+	case check.Baseline == "" || check.Target == "":
+		check.Status = CheckStatusSkipped
+		check.Reason = "profile 中没有记录主程序的 build ID"
+	case check.Baseline != check.Target && requireSameBuild:
+		check.Status = CheckStatusFail
+		check.Reason = "两个 profile 来自不同的构建"
+	case check.Baseline != check.Target:
+		check.Status = CheckStatusWarn
+		check.Reason = "两个 profile 来自不同的构建，函数可能已被重命名或内联方式不同"
+	}
+	return check
+}
+
+// mainBuildID 返回主程序 Mapping 的 build ID
+func mainBuildID(p *profile.Profile) string {
+	if len(p.Mapping) == 0 {
+		return ""
+	}
+	return p.Mapping[0].BuildID
+}
+
+// checkDurationRatio 检查两个 profile 的采集时长是否相近；时长相差太大时总值不可直接比较
+func checkDurationRatio(baseline, target *profile.Profile, maxRatio float64) ComparabilityCheck {
+	check := ComparabilityCheck{Name: CheckDurationRatio, Status: CheckStatusPass}
+	if baseline.DurationNanos <= 0 || target.DurationNanos <= 0 {
+		check.Status = CheckStatusSkipped
+		check.Reason = "profile 中没有记录采集时长 (DurationNanos)"
+		return check
+	}
+	check.Baseline, check.Target = formatNanos(baseline.DurationNanos), formatNanos(target.DurationNanos)
+	longer, shorter := baseline.DurationNanos, target.DurationNanos
+	if shorter > longer {
+		longer, shorter = shorter, longer
+	}
+	if ratio := float64(longer) / float64(shorter); ratio > maxRatio {
+		check.Status = CheckStatusFail
+		check.Reason = fmt.Sprintf("采集时长相差 %.2f 倍，超过允许的 %.2f 倍；请使用相同的采集时长，或只比较百分比", ratio, maxRatio)
+	}
+	return check
+}
+
+// sampleTypeNames 将样本类型列表格式化为 "type/unit, type/unit"
+func sampleTypeNames(p *profile.Profile) string {
+	names := make([]string, len(p.SampleType))
+	for i, st := range p.SampleType {
+		names[i] = st.Type + "/" + st.Unit
+	}
+	return strings.Join(names, ", ")
+}
+
+// joinErrors 以 "baseline: ...; target: ..." 的形式合并两个 profile 的错误
+func joinErrors(baselineErr, targetErr error) string {
+	var parts []string
+	if baselineErr != nil {
+		parts = append(parts, "baseline: "+baselineErr.Error())
+	}
+	if targetErr != nil {
+		parts = append(parts, "target: "+targetErr.Error())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatComparability 以文本或 Markdown 格式输出可比性检查结果
+func formatComparability(r ComparabilityResult, format string) string {
+	var b strings.Builder
+	status := "PASS"
+	if !r.Comparable {
+		status = "FAIL"
+	}
+	icons := map[string]string{CheckStatusPass: "✅", CheckStatusFail: "❌", CheckStatusWarn: "⚠️", CheckStatusSkipped: "⏭️"}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("# 可比性检查: %s\n\n", status))
+		for _, c := range r.Checks {
+			b.WriteString(fmt.Sprintf("- %s **%s**: %s", icons[c.Status], c.Name, c.Status))
+			if c.Baseline != "" || c.Target != "" {
+				b.WriteString(fmt.Sprintf(" (baseline: `%s`, target: `%s`)", c.Baseline, c.Target))
+			}
+			if c.Reason != "" {
+				b.WriteString(" — " + c.Reason)
+			}
+			b.WriteString("\n")
+		}
+		return b.String()
+	}
+
+	b.WriteString(fmt.Sprintf("可比性检查: %s\n", status))
+	b.WriteString("==================\n\n")
+	for _, c := range r.Checks {
+		b.WriteString(fmt.Sprintf("[%s] %s", strings.ToUpper(c.Status), c.Name))
+		if c.Baseline != "" || c.Target != "" {
+			b.WriteString(fmt.Sprintf(" (baseline: %s, target: %s)", c.Baseline, c.Target))
+		}
+		if c.Reason != "" {
+			b.WriteString(": " + c.Reason)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestAssertComparable 测试比较前的可比性检查
+func TestAssertComparable(t *testing.T) {
+	newProfile := func(buildID string, duration time.Duration, types ...string) *profile.Profile {
+		p := &profile.Profile{
+			DurationNanos: int64(duration),
+			Mapping:       []*profile.Mapping{{ID: 1, File: "/bin/app", BuildID: buildID}},
+		}
+		for _, typ := range types {
+			p.SampleType = append(p.SampleType, &profile.ValueType{Type: typ, Unit: "bytes"})
+		}
+		return p
+	}
+	check := func(baseline, target *profile.Profile, opts ComparabilityOptions) ComparabilityResult {
+		t.Helper()
+		out, err := AssertComparable(baseline, target, opts, "json")
+		if err != nil {
+			t.Fatalf("AssertComparable() error = %v", err)
+		}
+		var result ComparabilityResult
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		return result
+	}
+	status := func(r ComparabilityResult, name string) string {
+		for _, c := range r.Checks {
+			if c.Name == name {
+				return c.Status
+			}
+		}
+		return ""
+	}
+
+	heap := []string{"alloc_space", "inuse_space"}
+	result := check(newProfile("abc", 30*time.Second, heap...), newProfile("def", 40*time.Second, heap...), ComparabilityOptions{ProfileType: "heap"})
+	if !result.Comparable || status(result, CheckBuildID) != CheckStatusWarn || status(result, CheckDurationRatio) != CheckStatusPass {
+		t.Errorf("Expected comparable profiles with a build ID warning, got %+v", result)
+	}
+
+	result = check(newProfile("abc", 10*time.Second, heap...), newProfile("def", 60*time.Second, "alloc_space"), ComparabilityOptions{RequireSameBuild: true})
+	if result.Comparable || len(result.FailedChecks) != 3 {
+		t.Fatalf("Expected sample_type, build_id and duration_ratio to fail, got %+v", result)
+	}
+	for i, want := range []string{CheckSampleType, CheckBuildID, CheckDurationRatio} {
+		if result.FailedChecks[i] != want {
+			t.Errorf("FailedChecks = %v, want %s at %d", result.FailedChecks, want, i)
+		}
+	}
+
+	result = check(newProfile("", 0, "inuse_space"), newProfile("", 0, "inuse_space"), ComparabilityOptions{ProfileType: "heap"})
+	if !result.Comparable || status(result, CheckBuildID) != CheckStatusSkipped || status(result, CheckDurationRatio) != CheckStatusSkipped {
+		t.Errorf("Expected skipped checks for missing metadata, got %+v", result)
+	}
+}
@@ -1,81 +1,143 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/pprof/profile"
 )
 
+// CPUAnalysisOptions 定义 CPU 分析的可选参数
+type CPUAnalysisOptions struct {
+	IncludeSourceLocation bool // 为 true 时按 "函数 (文件:行号)" 区分热点，并在输出中包含源文件位置
+	// NormalizeByDuration 为 true 时按 profile 的 DurationNanos 归一化：报告每个函数的 CPU 秒数和占采集墙钟时间的百分比，
+	// 使不同采集时长的 profile 可以直接比较
+	NormalizeByDuration bool
+	// MinPercent 大于 0 时，在应用 Top N 之前丢弃 Flat 时间占总量百分比低于该值的函数，
+	// 并在结果中报告被过滤的函数数量和累计值
+	MinPercent float64
+	// Numbers 是报告中数值的格式 (见 NumberStyles)，零值为 NumberStyleHuman
+	Numbers NumberFormatter
+	// SortBy 是函数列表的排序方式 (见 FunctionSortKeys)，为空时按 Flat 时间排序；
+	// 按 SortByCum 排序时包括 Flat 时间为 0 的函数，MinPercent 也按 Cum 时间的占比过滤
+	SortBy string
+}
+
 // AnalyzeCPUProfile 分析 CPU profile 文件并返回格式化结果。
 func AnalyzeCPUProfile(p *profile.Profile, topN int, format string) (string, error) {
-	log.Printf("Analyzing CPU profile (Top %d, Format: %s)", topN, format)
+	return AnalyzeCPUProfileWithOptions(p, topN, format, CPUAnalysisOptions{})
+}
 
-	// --- 1. 确定用于分析的值的索引 (通常是 CPU 时间) ---
-	valueIndex := -1 // CPU 时间样本值的索引 (通常是 1, 'samples/count' 是 0)
-	for i, st := range p.SampleType {
-		// 查找 'cpu' 和 'nanoseconds' 或类似的样本类型
-		if (st.Type == "cpu" || st.Type == "samples") && (st.Unit == "nanoseconds" || st.Unit == "count") {
-			// 优先选择 'cpu'/'nanoseconds'，否则选择 'samples'/'count'
-			if valueIndex == -1 || st.Type == "cpu" {
-				valueIndex = i
-			}
-		}
+// AnalyzeCPUProfileWithOptions 与 AnalyzeCPUProfile 相同，但支持 CPUAnalysisOptions，
+// 例如按源文件位置区分同一函数中的不同热点行。
+func AnalyzeCPUProfileWithOptions(p *profile.Profile, topN int, format string, opts CPUAnalysisOptions) (string, error) {
+	return AnalyzeCPUProfileContext(context.Background(), p, topN, format, opts)
+}
+
+// AnalyzeCPUProfileContext 与 AnalyzeCPUProfileWithOptions 相同，但在聚合样本时定期检查 ctx，ctx 被取消时尽快停止
+func AnalyzeCPUProfileContext(ctx context.Context, p *profile.Profile, topN int, format string, opts CPUAnalysisOptions) (string, error) {
+	logDebug("Analyzing CPU profile (Top %d, Format: %s, Source locations: %t)", topN, format, opts.IncludeSourceLocation)
+	result, err := CPUProfileStatsContext(ctx, p, topN, opts)
+	if err != nil {
+		return "", err
 	}
-	if valueIndex == -1 {
-		if len(p.SampleType) > 1 {
-			valueIndex = 1 // 如果未找到特定类型，则默认为第二个值类型
-			log.Printf("Warning: Could not definitively identify CPU time value type, defaulting to index 1: %s/%s", p.SampleType[valueIndex].Type, p.SampleType[valueIndex].Unit)
-		} else if len(p.SampleType) == 1 {
-			valueIndex = 0 // 使用唯一可用的类型
-			log.Printf("Warning: Only one sample type found, using index 0: %s/%s", p.SampleType[valueIndex].Type, p.SampleType[valueIndex].Unit)
-		} else {
-			return "", fmt.Errorf("无法从 profile 样本类型中确定值类型 (例如 cpu nanoseconds)")
-		}
+	if format != "flamegraph-json" {
+		return FormatCPUResult(result, format)
+	}
+
+	// 火焰图需要完整的调用栈，直接从 profile 构建
+	valueIndex, _, _ := findValueColumn(p, "cpu")
+	logDebug("Generating flame graph JSON for CPU profile using value index %d", valueIndex)
+	flameGraphRoot, err := BuildFlameGraphTree(p, valueIndex) // 调用新函数
+	if err != nil {
+		logError("Error building flame graph tree: %v", err)
+		errorResult := ErrorResult{Error: fmt.Sprintf("Failed to build flame graph tree: %v", err)}
+		errJsonBytes, _ := json.Marshal(errorResult)
+		return string(errJsonBytes), nil // 返回错误信息，但不标记为分析错误
+	}
+	jsonBytes, err := json.Marshal(flameGraphRoot) // 使用 Marshal 生成紧凑 JSON
+	if err != nil {
+		logError("Error marshaling flame graph tree to JSON: %v", err)
+		errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal flame graph tree to JSON: %v", err)}
+		errJsonBytes, _ := json.Marshal(errorResult)
+		return string(errJsonBytes), nil // 返回错误信息，但不标记为分析错误
+	}
+	return string(jsonBytes), nil
+}
+
+// CPUProfileStats 按 Flat 时间聚合 CPU profile，返回 Flat 时间最多的 topN 个函数的结构化结果，
+// 供需要直接使用数值的调用方使用。结果中的 TopN 是请求的数量。
+func CPUProfileStats(p *profile.Profile, topN int, opts CPUAnalysisOptions) (*CPUAnalysisResult, error) {
+	return CPUProfileStatsContext(context.Background(), p, topN, opts)
+}
+
+// CPUProfileStatsContext 与 CPUProfileStats 相同，但在聚合样本时定期检查 ctx，ctx 被取消时返回包装了 ctx.Err() 的错误
+func CPUProfileStatsContext(ctx context.Context, p *profile.Profile, topN int, opts CPUAnalysisOptions) (*CPUAnalysisResult, error) {
+	// --- 1. 确定用于分析的值的索引 (通常是 CPU 时间) ---
+	// 按样本类型名称查找，优先选择 'cpu'/'nanoseconds'，否则选择 'samples'/'count'
+	valueIndex, _, err := findValueColumn(p, "cpu")
+	if err != nil {
+		return nil, fmt.Errorf("无法从 profile 样本类型中确定值类型 (例如 cpu nanoseconds): %w", err)
 	}
 	valueUnit := p.SampleType[valueIndex].Unit
-	log.Printf("使用索引 %d (%s/%s) 进行 CPU 分析", valueIndex, p.SampleType[valueIndex].Type, valueUnit)
+	logDebug("使用索引 %d (%s/%s) 进行 CPU 分析", valueIndex, p.SampleType[valueIndex].Type, valueUnit)
 
 	// --- 2. 按函数聚合 Flat 时间 ---
 	flatTime := make(map[string]int64)
+	cumTime := make(map[string]int64)           // 函数 (或源文件位置) 出现在调用栈任意位置的样本值
+	sources := make(map[string]*sourceLocation) // IncludeSourceLocation 时记录每个键对应的函数和源文件位置
 	totalValue := int64(0)
+	cumKey := functionNameKey
+	if opts.IncludeSourceLocation {
+		// 只有 Cum 时间的位置也需要函数和源文件位置
+		cumKey = func(line profile.Line) string {
+			key := sourceLocationKey(line)
+			if sources[key] == nil {
+				sources[key] = &sourceLocation{Function: line.Function.Name, File: line.Function.Filename, Line: line.Line}
+			}
+			return key
+		}
+	}
 
-	for _, s := range p.Sample {
+	for i, s := range p.Sample {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, err
+		}
 		if len(s.Location) > 0 && len(s.Value) > valueIndex {
 			v := s.Value[valueIndex]
 			totalValue += v
-			// Flat 时间归因于堆栈中最顶层的函数
-			loc := s.Location[0]
-			for _, line := range loc.Line {
-				if line.Function != nil {
-					flatTime[line.Function.Name] += v
-					// 每个样本的顶层框架只计算一次函数
-					break
-				}
+			addCumulativeValue(cumTime, s, v, cumKey)
+			// Flat 时间归因于堆栈中最顶层的函数，最顶层没有函数信息时归为 unknown
+			line, ok := topLine(s)
+			if !ok {
+				flatTime[unknownFunction] += v
+				continue
 			}
+			key := line.Function.Name
+			if opts.IncludeSourceLocation {
+				key = sourceLocationKey(line)
+				sources[key] = &sourceLocation{Function: line.Function.Name, File: line.Function.Filename, Line: line.Line}
+			}
+			flatTime[key] += v
 		}
 	}
 
 	if totalValue == 0 {
-		log.Printf("Warning: Total value for the selected sample type (%s/%s) is zero.", p.SampleType[valueIndex].Type, valueUnit)
+		logWarn("Total value for the selected sample type (%s/%s) is zero.", p.SampleType[valueIndex].Type, valueUnit)
 		// 继续处理，可能只是一个空的 profile 或选择了错误的样本类型
 	}
 
-	// --- 3. 按 Flat 时间对函数进行排序 ---
-	stats := make([]functionStat, 0, len(flatTime))
-	for name, flat := range flatTime {
-		stats = append(stats, functionStat{Name: name, Flat: flat})
+	// --- 3. 按 Flat (或 Cum) 时间对函数进行排序 ---
+	stats, sortValue, err := sortedFunctionStats(flatTime, cumTime, sources, opts.SortBy)
+	if err != nil {
+		return nil, err
 	}
-	sort.Slice(stats, func(i, j int) bool {
-		return stats[i].Flat > stats[j].Flat // 降序排列
-	})
+	stats, noiseFilter := dropBelowPercent(stats, sortValue, totalValue, opts.MinPercent,
+		func(v int64) string { return opts.Numbers.SampleValue(v, valueUnit) })
 
-	// --- 4. 格式化输出 ---
-	var b strings.Builder
 	limit := topN
 	if limit > len(stats) {
 		limit = len(stats)
@@ -86,93 +148,197 @@ func AnalyzeCPUProfile(p *profile.Profile, topN int, format string) (string, err
 	if totalDuration == 0 && totalValue > 0 && valueUnit == "nanoseconds" {
 		// 如果 DurationNanos 为零，则从样本总值估算持续时间
 		totalDuration = time.Duration(totalValue) * time.Nanosecond
-		log.Printf("Profile DurationNanos is 0, estimated total duration from samples: %s", totalDuration)
+		logDebug("Profile DurationNanos is 0, estimated total duration from samples: %s", totalDuration)
+	}
+
+	result := &CPUAnalysisResult{ // 使用 types.go 中的结构体
+		ProfileType:         "cpu",
+		ValueType:           p.SampleType[valueIndex].Type,
+		ValueUnit:           valueUnit,
+		TotalValue:          totalValue,
+		TotalValueFormatted: opts.Numbers.SampleValue(totalValue, valueUnit),
+		TopN:                topN,
+		Functions:           make([]CPUFunctionStat, 0, limit), // 使用 types.go 中的结构体
+		CaptureConfig:       ParseCaptureConfig(p),
+		NoiseFilter:         noiseFilter,
+		SkippedSamples:      countSkippedSamples(p, valueIndex),
+		SortBy:              opts.SortBy,
+		numbers:             opts.Numbers,
+	}
+	if totalDuration > 0 {
+		result.TotalDurationNanos = totalDuration.Nanoseconds()
+	}
+
+	running := int64(0) // 按排序累加的 Flat 值，用于 Sum%
+	for i := 0; i < limit; i++ {
+		stat := stats[i]
+		running += stat.Flat
+		funcStat := CPUFunctionStat{ // 使用 types.go 中的结构体
+			FunctionName:       stat.Name,
+			FunctionID:         FunctionID(stat.Name),
+			FlatValue:          stat.Flat,
+			FlatValueFormatted: opts.Numbers.SampleValue(stat.Flat, valueUnit),
+			Percentage:         percentOf(stat.Flat, totalValue),
+			SumPercentage:      percentOf(running, totalValue),
+			CumValue:           stat.Cum,
+			CumValueFormatted:  opts.Numbers.SampleValue(stat.Cum, valueUnit),
+			CumPercentage:      percentOf(stat.Cum, totalValue),
+		}
+		if stat.Source != nil {
+			funcStat.FunctionName = stat.Source.Function
+			funcStat.FunctionID = FunctionID(stat.Source.Function)
+			funcStat.FileName = stat.Source.File
+			funcStat.LineNumber = stat.Source.Line
+		}
+		result.Functions = append(result.Functions, funcStat)
+	}
+	if opts.NormalizeByDuration {
+		normalizeCPUByDuration(result, p)
+	}
+	return result, nil
+}
+
+// normalizeCPUByDuration 将 CPU 结果按采集时长 (p.DurationNanos) 归一化。样本单位为 nanoseconds 时直接换算；
+// 单位为 count 时按 nanoseconds 的采样周期换算为 CPU 时间。无法归一化时只设置 NormalizationWarning。
+func normalizeCPUByDuration(result *CPUAnalysisResult, p *profile.Profile) {
+	if p.DurationNanos <= 0 {
+		result.NormalizationWarning = "profile 未记录采集时长 (DurationNanos)，无法按时长归一化"
+		return
+	}
+	nanosPerUnit := int64(0)
+	switch {
+	case result.ValueUnit == "nanoseconds":
+		nanosPerUnit = 1
+	case result.ValueUnit == "count" && p.PeriodType != nil && p.PeriodType.Unit == "nanoseconds" && p.Period > 0:
+		nanosPerUnit = p.Period
+	default:
+		result.NormalizationWarning = fmt.Sprintf("样本单位 %s 无法换算为 CPU 时间，无法按时长归一化", result.ValueUnit)
+		return
 	}
 
+	duration := float64(p.DurationNanos)
+	cpuSeconds := func(v int64) float64 { return float64(v) * float64(nanosPerUnit) / 1e9 }
+	wallPercent := func(v int64) float64 { return float64(v) * float64(nanosPerUnit) / duration * 100 }
+	result.DurationNormalized = true
+	result.TotalCPUSeconds = cpuSeconds(result.TotalValue)
+	result.TotalWallTimePercent = wallPercent(result.TotalValue)
+	for i := range result.Functions {
+		f := &result.Functions[i]
+		f.CPUSeconds = cpuSeconds(f.FlatValue)
+		f.WallTimePercent = wallPercent(f.FlatValue)
+	}
+}
+
+// FormatCPUResult 将 CPUProfileStats 的结果格式化为 text、markdown、json、compact 或 summary 输出。
+// flamegraph-json 需要完整的调用栈，只能通过 AnalyzeCPUProfile 生成。
+func FormatCPUResult(result *CPUAnalysisResult, format string) (string, error) {
+	// --- 4. 格式化输出 ---
+	var b strings.Builder
+	valueUnit := result.ValueUnit
+	capture := result.CaptureConfig
+
 	switch format {
 	case "text", "markdown": // 目前两者使用相似格式
 		if format == "markdown" {
 			b.WriteString("```text\n") // 使用文本块以获得更好的对齐效果
 		}
-		b.WriteString(fmt.Sprintf("CPU Profile Analysis (Top %d Functions by Flat Time)\n", topN))
-		b.WriteString(fmt.Sprintf("Total Samples/Time (%s): %s\n", valueUnit, FormatSampleValue(totalValue, valueUnit))) // 使用导出的 FormatSampleValue
-		if totalDuration > 0 {
-			b.WriteString(fmt.Sprintf("Total Duration: %s\n", totalDuration))
+		sortedBy := "Flat Time"
+		if result.SortBy == SortByCum {
+			sortedBy = "Cum Time"
+		}
+		b.WriteString(fmt.Sprintf("CPU Profile Analysis (Top %d Functions by %s)\n", result.TopN, sortedBy))
+		b.WriteString(fmt.Sprintf("Total Samples/Time (%s): %s\n", valueUnit, result.TotalValueFormatted))
+		if result.TotalDurationNanos > 0 {
+			b.WriteString(fmt.Sprintf("Total Duration: %s\n", time.Duration(result.TotalDurationNanos)))
+		}
+		if capture != nil {
+			b.WriteString(fmt.Sprintf("Capture Config: %s\n", capture.format(result.numbers)))
+		}
+		if result.SkippedSamples != nil {
+			b.WriteString(fmt.Sprintf("Skipped: %s\n", result.SkippedSamples))
+		}
+		if result.DurationNormalized {
+			b.WriteString(fmt.Sprintf("CPU Time: %.2f s (%.2f%% of wall time, normalized by duration)\n", result.TotalCPUSeconds, result.TotalWallTimePercent))
+		} else if result.NormalizationWarning != "" {
+			b.WriteString(fmt.Sprintf("Warning: %s\n", result.NormalizationWarning))
 		}
 		b.WriteString("--------------------------------------------------\n")
-		b.WriteString(fmt.Sprintf("%-15s %-15s %s\n", "Flat Time", "%", "Function Name"))
+		if result.DurationNormalized {
+			b.WriteString(fmt.Sprintf("%-15s %-10s %-10s %-15s %-10s %-12s %-12s %s\n", "Flat Time", "Flat%", "Sum%", "Cum Time", "Cum%", "CPU s", "% Wall", "Function Name"))
+		} else {
+			b.WriteString(fmt.Sprintf("%-15s %-10s %-10s %-15s %-10s %s\n", "Flat Time", "Flat%", "Sum%", "Cum Time", "Cum%", "Function Name"))
+		}
 		b.WriteString("--------------------------------------------------\n")
-		for i := 0; i < limit; i++ {
-			stat := stats[i]
-			percent := 0.0
-			// 如果 totalValue 不为零，则计算百分比
-			if totalValue != 0 {
-				percent = (float64(stat.Flat) / float64(totalValue)) * 100
+		for _, stat := range result.Functions {
+			if result.DurationNormalized {
+				b.WriteString(fmt.Sprintf("%-15s %-10.2f %-10.2f %-15s %-10.2f %-12.3f %-12.2f %s\n", stat.FlatValueFormatted, stat.Percentage, stat.SumPercentage, stat.CumValueFormatted, stat.CumPercentage, stat.CPUSeconds, stat.WallTimePercent, sanitizeName(stat.displayName())))
+				continue
 			}
-			b.WriteString(fmt.Sprintf("%-15s %-15.2f %s\n", FormatSampleValue(stat.Flat, valueUnit), percent, stat.Name)) // 使用导出的 FormatSampleValue
+			b.WriteString(fmt.Sprintf("%-15s %-10.2f %-10.2f %-15s %-10.2f %s\n", stat.FlatValueFormatted, stat.Percentage, stat.SumPercentage, stat.CumValueFormatted, stat.CumPercentage, sanitizeName(stat.displayName())))
+		}
+		if result.NoiseFilter != nil {
+			b.WriteString(fmt.Sprintf("Filtered: %s\n", result.NoiseFilter))
 		}
 		if format == "markdown" {
 			b.WriteString("```\n")
 		}
-	case "json":
-		result := CPUAnalysisResult{ // 使用 types.go 中的结构体
-			ProfileType:         "cpu",
-			ValueType:           p.SampleType[valueIndex].Type,
-			ValueUnit:           valueUnit,
-			TotalValue:          totalValue,
-			TotalValueFormatted: FormatSampleValue(totalValue, valueUnit), // 使用导出的 FormatSampleValue
-			TopN:                limit,
-			Functions:           make([]CPUFunctionStat, 0, limit), // 使用 types.go 中的结构体
-		}
-		if totalDuration > 0 {
-			result.TotalDurationNanos = totalDuration.Nanoseconds()
-		}
-
-		for i := 0; i < limit; i++ {
-			stat := stats[i]
-			percent := 0.0
-			if totalValue != 0 {
-				percent = (float64(stat.Flat) / float64(totalValue)) * 100
-			}
-			result.Functions = append(result.Functions, CPUFunctionStat{ // 使用 types.go 中的结构体
-				FunctionName:       stat.Name,
-				FlatValue:          stat.Flat,
-				FlatValueFormatted: FormatSampleValue(stat.Flat, valueUnit), // 使用导出的 FormatSampleValue
-				Percentage:         percent,
-			})
+	case "summary":
+		b.WriteString(formatSummary(cpuSummary(result)))
+	case "compact":
+		rows := make([]compactRow, 0, len(result.Functions))
+		for _, stat := range result.Functions {
+			rows = append(rows, compactRow{Name: stat.displayName(), Value: stat.FlatValueFormatted, Percent: stat.Percentage})
 		}
-
-		jsonBytes, err := json.MarshalIndent(result, "", "  ") // 使用缩进美化输出
+		header := fmt.Sprintf("cpu total=%s top=%d", result.TotalValueFormatted, len(result.Functions))
+		if result.DurationNormalized {
+			header += fmt.Sprintf(" cpu_seconds=%.2f wall=%.2f%%", result.TotalCPUSeconds, result.TotalWallTimePercent)
+		}
+		b.WriteString(formatCompact(header+capture.compactSuffix()+result.NoiseFilter.compactSuffix()+result.SkippedSamples.compactSuffix(), rows))
+	case "json":
+		// JSON 中的 topN 是实际返回的函数数量
+		output := *result
+		output.TopN = len(result.Functions)
+		jsonBytes, err := json.MarshalIndent(output, "", "  ") // 使用缩进美化输出
 		if err != nil {
-			log.Printf("Error marshaling CPU analysis to JSON: %v", err)
+			logError("Error marshaling CPU analysis to JSON: %v", err)
 			// 返回一个简单的 JSON 错误
 			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal result to JSON: %v", err)} // 使用 types.go 中的结构体
 			errJsonBytes, _ := json.Marshal(errorResult)
 			return string(errJsonBytes), nil // 返回错误信息，但不标记为分析错误
 		}
 		return string(jsonBytes), nil
-
-	case "flamegraph-json":
-		log.Printf("Generating flame graph JSON for CPU profile using value index %d", valueIndex)
-		flameGraphRoot, err := BuildFlameGraphTree(p, valueIndex) // 调用新函数
-		if err != nil {
-			log.Printf("Error building flame graph tree: %v", err)
-			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to build flame graph tree: %v", err)}
-			errJsonBytes, _ := json.Marshal(errorResult)
-			return string(errJsonBytes), nil // 返回错误信息，但不标记为分析错误
-		}
-		jsonBytes, err := json.Marshal(flameGraphRoot) // 使用 Marshal 生成紧凑 JSON
-		if err != nil {
-			log.Printf("Error marshaling flame graph tree to JSON: %v", err)
-			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal flame graph tree to JSON: %v", err)}
-			errJsonBytes, _ := json.Marshal(errorResult)
-			return string(errJsonBytes), nil // 返回错误信息，但不标记为分析错误
-		}
-		return string(jsonBytes), nil
-
 	default:
 		return "", fmt.Errorf("unsupported output format: %s", format)
 	}
 
 	return b.String(), nil
 }
+
+// sourceLocation 是热点所在的函数和源文件位置
+type sourceLocation struct {
+	Function string
+	File     string
+	Line     int64
+}
+
+// sourceLocationKey 返回 "函数 (文件:行号)" 形式的聚合键；没有文件名或行号时退化为只包含已有的部分
+func sourceLocationKey(line profile.Line) string {
+	return formatSourceLocation(line.Function.Name, line.Function.Filename, line.Line)
+}
+
+// displayName 返回函数在文本输出中的名称，包含源文件位置时与聚合键相同
+func (f CPUFunctionStat) displayName() string {
+	return formatSourceLocation(f.FunctionName, f.FileName, f.LineNumber)
+}
+
+// formatSourceLocation 将函数名和源文件位置格式化为 "函数 (文件:行号)"
+func formatSourceLocation(name, file string, line int64) string {
+	switch {
+	case file == "":
+		return name
+	case line <= 0:
+		return fmt.Sprintf("%s (%s)", name, file)
+	default:
+		return fmt.Sprintf("%s (%s:%d)", name, file, line)
+	}
+}
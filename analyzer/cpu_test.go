@@ -0,0 +1,201 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestAnalyzeCPUProfileSourceLocation 测试 IncludeSourceLocation 按源文件位置区分同一函数中的不同热点行
+func TestAnalyzeCPUProfileSourceLocation(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.process", Filename: "app/main.go"}
+	noFile := &profile.Function{ID: 2, Name: "runtime.memmove"}
+	sample := func(v int64, line profile.Line) *profile.Sample {
+		return &profile.Sample{Value: []int64{v}, Location: []*profile.Location{{Line: []profile.Line{line}}}}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			sample(300000000, profile.Line{Function: fn, Line: 42}),
+			sample(100000000, profile.Line{Function: fn, Line: 57}),
+			sample(50000000, profile.Line{Function: noFile}),
+		},
+	}
+
+	// 默认按函数聚合，同一函数的两行合并为一项
+	text, err := AnalyzeCPUProfile(p, 10, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile() error = %v", err)
+	}
+	if strings.Contains(text, "app/main.go") || !strings.Contains(text, "main.process") {
+		t.Errorf("default output should aggregate by function only, got:\n%s", text)
+	}
+
+	text, err = AnalyzeCPUProfileWithOptions(p, 10, "text", CPUAnalysisOptions{IncludeSourceLocation: true})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfileWithOptions() error = %v", err)
+	}
+	for _, want := range []string{"main.process (app/main.go:42)", "main.process (app/main.go:57)", "runtime.memmove"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text output missing %q, got:\n%s", want, text)
+		}
+	}
+
+	out, err := AnalyzeCPUProfileWithOptions(p, 10, "json", CPUAnalysisOptions{IncludeSourceLocation: true})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfileWithOptions(json) error = %v", err)
+	}
+	var result CPUAnalysisResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(result.Functions) != 3 {
+		t.Fatalf("len(Functions) = %d, want 3", len(result.Functions))
+	}
+	top := result.Functions[0]
+	if top.FunctionName != "main.process" || top.FileName != "app/main.go" || top.LineNumber != 42 {
+		t.Errorf("top entry = %+v, want main.process at app/main.go:42", top)
+	}
+	if top.FunctionID != FunctionID("main.process") {
+		t.Errorf("FunctionID = %s, want the ID of the plain function name", top.FunctionID)
+	}
+	if last := result.Functions[2]; last.FunctionName != "runtime.memmove" || last.FileName != "" || last.LineNumber != 0 {
+		t.Errorf("entry without source info = %+v", last)
+	}
+	if strings.Count(out, `"fileName"`) != 2 {
+		t.Errorf("fileName should be omitted for functions without a file, got:\n%s", out)
+	}
+}
+
+// TestAnalyzeCPUProfileNormalizeByDuration 测试 NormalizeByDuration 报告 CPU 秒数和占墙钟时间的百分比
+func TestAnalyzeCPUProfileNormalizeByDuration(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.process"}
+	other := &profile.Function{ID: 2, Name: "main.idle"}
+	sample := func(v int64, f *profile.Function) *profile.Sample {
+		return &profile.Sample{Value: []int64{v / 10000000, v}, Location: []*profile.Location{{Line: []profile.Line{{Function: f}}}}}
+	}
+	p := &profile.Profile{
+		SampleType:    []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType:    &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:        10000000,
+		DurationNanos: 10e9,
+		Sample:        []*profile.Sample{sample(15e9, fn), sample(5e9, other)},
+	}
+
+	result, err := CPUProfileStats(p, 10, CPUAnalysisOptions{NormalizeByDuration: true})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	if !result.DurationNormalized || result.TotalCPUSeconds != 20 || result.TotalWallTimePercent != 200 {
+		t.Fatalf("Unexpected normalized totals: normalized=%t cpu=%v wall=%v", result.DurationNormalized, result.TotalCPUSeconds, result.TotalWallTimePercent)
+	}
+	if f := result.Functions[0]; f.FunctionName != "main.process" || f.CPUSeconds != 15 || f.WallTimePercent != 150 {
+		t.Errorf("Unexpected top function: %+v", f)
+	}
+
+	text, err := FormatCPUResult(result, "text")
+	if err != nil {
+		t.Fatalf("FormatCPUResult() error = %v", err)
+	}
+	if !strings.Contains(text, "CPU Time: 20.00 s (200.00% of wall time, normalized by duration)") || !strings.Contains(text, "% Wall") {
+		t.Errorf("Expected the normalized totals and column in text output, got:\n%s", text)
+	}
+
+	// 没有采集时长时不归一化，只给出原因
+	p.DurationNanos = 0
+	result, err = CPUProfileStats(p, 10, CPUAnalysisOptions{NormalizeByDuration: true})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	if result.DurationNormalized || result.NormalizationWarning == "" || result.Functions[0].CPUSeconds != 0 {
+		t.Errorf("Expected no normalization and a warning without DurationNanos, got %+v", result)
+	}
+}
+
+// TestCPUProfileStatsCumulative 测试 Cum 值计入调用栈上的每个函数 (包括内联帧)，递归调用在一个样本中只计一次
+func TestCPUProfileStatsCumulative(t *testing.T) {
+	fns := map[string]*profile.Function{}
+	for i, name := range []string{"main.main", "main.walk", "main.visit", "runtime.memmove"} {
+		fns[name] = &profile.Function{ID: uint64(i + 1), Name: name}
+	}
+	loc := func(names ...string) *profile.Location {
+		l := &profile.Location{}
+		for _, name := range names {
+			l.Line = append(l.Line, profile.Line{Function: fns[name]})
+		}
+		return l
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			// main.visit 内联在 main.walk 中，main.walk 递归调用自身
+			{Value: []int64{300}, Location: []*profile.Location{loc("runtime.memmove"), loc("main.visit", "main.walk"), loc("main.walk"), loc("main.main")}},
+			{Value: []int64{100}, Location: []*profile.Location{loc("main.walk"), loc("main.main")}},
+		},
+	}
+
+	result, err := CPUProfileStats(p, 10, CPUAnalysisOptions{})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	want := map[string][2]int64{"runtime.memmove": {300, 300}, "main.walk": {100, 400}}
+	for _, f := range result.Functions {
+		if w, ok := want[f.FunctionName]; ok && (f.FlatValue != w[0] || f.CumValue != w[1]) {
+			t.Errorf("%s: flat = %d, cum = %d, want %v", f.FunctionName, f.FlatValue, f.CumValue, w)
+		}
+	}
+	if len(result.Functions) != 2 || result.Functions[1].CumPercentage != 100 {
+		t.Errorf("Unexpected functions: %+v", result.Functions)
+	}
+}
+
+// TestTopNSumPercentage 测试 Top N 列表的累计占比 (Sum%) 按排序顺序累加，并且各 profile 类型使用相同的口径
+func TestTopNSumPercentage(t *testing.T) {
+	cpu := newCPUProfile(map[string]int64{"main.a": 500, "main.b": 300, "main.c": 150, "main.d": 50})
+	cpuResult, err := CPUProfileStats(cpu, 3, CPUAnalysisOptions{})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	wantSum := []float64{50, 80, 95}
+	for i, f := range cpuResult.Functions {
+		if f.SumPercentage != wantSum[i] {
+			t.Errorf("CPU function %d (%s): sum%% = %v, want %v", i, f.FunctionName, f.SumPercentage, wantSum[i])
+		}
+	}
+	text, _ := FormatCPUResult(cpuResult, "text")
+	if !strings.Contains(text, "Sum%") || !strings.Contains(text, "95.00") {
+		t.Errorf("CPU text output missing Sum%% column:\n%s", text)
+	}
+
+	contention := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+	}
+	for name, v := range map[string][2]int64{"main.slow": {10, 600}, "main.mid": {30, 300}, "main.fast": {60, 100}} {
+		contention.Sample = append(contention.Sample, &profile.Sample{
+			Value:    []int64{v[0], v[1]},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+		})
+	}
+	// 累计占比跟随主要指标：按 delay 为 60/90/100，按 contentions 为 60/90/100 (顺序相反)
+	mutexResult, err := MutexProfileStatsWithOptions(contention, 10, ContentionAnalysisOptions{})
+	if err != nil {
+		t.Fatalf("MutexProfileStatsWithOptions() error = %v", err)
+	}
+	blockResult, err := BlockProfileStatsWithOptions(contention, 10, ContentionAnalysisOptions{PrimaryMetric: PrimaryMetricContentions})
+	if err != nil {
+		t.Fatalf("BlockProfileStatsWithOptions() error = %v", err)
+	}
+	for i, want := range []float64{60, 90, 100} {
+		if got := mutexResult.Contentions[i].SumPct; got != want {
+			t.Errorf("Mutex contention %d: sum%% = %v, want %v", i, got, want)
+		}
+		if got := blockResult.Blocks[i].SumPct; got != want {
+			t.Errorf("Block %d: sum%% = %v, want %v", i, got, want)
+		}
+	}
+	if mutexResult.Contentions[0].FunctionName != "main.slow" || blockResult.Blocks[0].FunctionName != "main.fast" {
+		t.Errorf("unexpected order: mutex %v, block %v", mutexResult.Contentions, blockResult.Blocks)
+	}
+}
@@ -0,0 +1,172 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// DeltaFunctionStat 代表差值 profile 中单个函数的净变化 (JSON)
+type DeltaFunctionStat struct {
+	FunctionName    string  `json:"functionName"`
+	FunctionID      string  `json:"functionId"`      // 完整函数名的稳定哈希，用于跨报告关联
+	NetValue        int64   `json:"netValue"`        // 正值表示增加 (回归)，负值表示减少 (改进)
+	NetFormatted    string  `json:"netFormatted"`    // 带符号的格式化值
+	BaselinePercent float64 `json:"baselinePercent"` // 净变化占 baseline 总值的百分比
+}
+
+// DeltaAnalysisResult 代表差值 profile 分析的整体结果 (JSON)
+type DeltaAnalysisResult struct {
+	ProfileType       string              `json:"profileType"`
+	ValueType         string              `json:"valueType"`
+	ValueUnit         string              `json:"valueUnit"`
+	BaselineTotal     int64               `json:"baselineTotal"`
+	NetTotal          int64               `json:"netTotal"`
+	NetTotalFormatted string              `json:"netTotalFormatted"`
+	TopN              int                 `json:"topN"`
+	Functions         []DeltaFunctionStat `json:"functions"`
+}
+
+// AnalyzeDeltaProfile 构造差值 profile (target - baseline) 并对其执行常规的 Top N 分析，
+// 以单一排序列表的形式展示每个函数的净变化 (按绝对值排序，包含负值)。
+func AnalyzeDeltaProfile(baseline, target *profile.Profile, profileTypeName string, topN int, format string) (string, error) {
+	logDebug("Analyzing delta profile: type=%s (Top %d, Format: %s)", profileTypeName, topN, format)
+
+	delta, err := DeltaProfile(baseline, target)
+	if err != nil {
+		return "", err
+	}
+
+	valueIndex, err := getValueIndex(delta, profileTypeName, "")
+	if err != nil {
+		return "", err
+	}
+	if valueIndex >= len(delta.SampleType) {
+		return "", fmt.Errorf("profile 没有可用于比较的样本类型")
+	}
+	valueType := delta.SampleType[valueIndex].Type
+	valueUnit := delta.SampleType[valueIndex].Unit
+
+	baselineValues, _ := aggregateFunctionValues(baseline, valueIndex)
+	baselineTotal := int64(0)
+	for _, v := range baselineValues {
+		baselineTotal += v
+	}
+
+	netValues, _ := aggregateFunctionValues(delta, valueIndex)
+	netTotal := int64(0)
+	stats := make([]functionStat, 0, len(netValues))
+	for name, v := range netValues {
+		netTotal += v
+		if v != 0 {
+			stats = append(stats, functionStat{Name: name, Flat: v})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		ai, aj := absInt64(stats[i].Flat), absInt64(stats[j].Flat)
+		if ai != aj {
+			return ai > aj
+		}
+		return stats[i].Name < stats[j].Name
+	})
+
+	limit := topN
+	if limit > len(stats) {
+		limit = len(stats)
+	}
+
+	baselinePercent := func(v int64) float64 {
+		if baselineTotal == 0 {
+			return 0
+		}
+		return float64(v) / float64(baselineTotal) * 100
+	}
+
+	switch format {
+	case "json":
+		result := DeltaAnalysisResult{
+			ProfileType:       profileTypeName,
+			ValueType:         valueType,
+			ValueUnit:         valueUnit,
+			BaselineTotal:     baselineTotal,
+			NetTotal:          netTotal,
+			NetTotalFormatted: formatSignedValue(netTotal, valueUnit),
+			TopN:              limit,
+			Functions:         make([]DeltaFunctionStat, 0, limit),
+		}
+		for i := 0; i < limit; i++ {
+			result.Functions = append(result.Functions, DeltaFunctionStat{
+				FunctionName:    stats[i].Name,
+				FunctionID:      FunctionID(stats[i].Name),
+				NetValue:        stats[i].Flat,
+				NetFormatted:    formatSignedValue(stats[i].Flat, valueUnit),
+				BaselinePercent: baselinePercent(stats[i].Flat),
+			})
+		}
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		var b strings.Builder
+		if format == "markdown" {
+			b.WriteString(fmt.Sprintf("# 差值 Profile 分析 (%s, target - baseline)\n\n", profileTypeName))
+			b.WriteString(fmt.Sprintf("- **样本类型**: %s/%s\n", valueType, valueUnit))
+			b.WriteString(fmt.Sprintf("- **Baseline 总值**: %s\n", formatUnitValue(baselineTotal, valueUnit)))
+			b.WriteString(fmt.Sprintf("- **净变化**: %s (%+.2f%%)\n\n", formatSignedValue(netTotal, valueUnit), baselinePercent(netTotal)))
+			b.WriteString("| 排名 | 函数名 | 净变化 | 占 Baseline% |\n")
+			b.WriteString("|------|--------|--------|--------------|\n")
+			for i := 0; i < limit; i++ {
+				stat := stats[i]
+				indicator := "🟢"
+				if stat.Flat > 0 {
+					indicator = "🔴"
+				}
+				b.WriteString(fmt.Sprintf("| %d | %s `%s` | %s | %+.2f%% |\n",
+					i+1, indicator, truncateString(stat.Name, 60), formatSignedValue(stat.Flat, valueUnit), baselinePercent(stat.Flat)))
+			}
+			b.WriteString("\n🔴 正值表示增加 (回归)，🟢 负值表示减少 (改进)。\n")
+		} else {
+			b.WriteString(fmt.Sprintf("差值 Profile 分析 (%s, target - baseline)\n", profileTypeName))
+			b.WriteString("==============================\n\n")
+			b.WriteString(fmt.Sprintf("样本类型: %s/%s\n", valueType, valueUnit))
+			b.WriteString(fmt.Sprintf("Baseline 总值: %s\n", formatUnitValue(baselineTotal, valueUnit)))
+			b.WriteString(fmt.Sprintf("净变化: %s (%+.2f%%)\n", formatSignedValue(netTotal, valueUnit), baselinePercent(netTotal)))
+			b.WriteString("--------------------------------------------------\n")
+			b.WriteString(fmt.Sprintf("%-15s %-12s %s\n", "净变化", "占Baseline%", "函数名"))
+			b.WriteString("--------------------------------------------------\n")
+			for i := 0; i < limit; i++ {
+				stat := stats[i]
+				b.WriteString(fmt.Sprintf("%-15s %-+12.2f %s\n", formatSignedValue(stat.Flat, valueUnit), baselinePercent(stat.Flat), sanitizeName(stat.Name)))
+			}
+			b.WriteString("\n正值表示增加 (回归)，负值表示减少 (改进)。\n")
+		}
+		return b.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// formatSignedValue 按单位格式化带符号的值，正值带 "+" 前缀，负值带 "-" 前缀
+func formatSignedValue(value int64, unit string) string {
+	switch {
+	case value > 0:
+		return "+" + formatUnitValue(value, unit)
+	case value < 0:
+		return "-" + formatUnitValue(-value, unit)
+	default:
+		return formatUnitValue(0, unit)
+	}
+}
+
+// absInt64 返回 int64 的绝对值
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
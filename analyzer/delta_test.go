@@ -0,0 +1,64 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// newCPUProfile 构造一个测试用的 CPU profile，values 的键为函数名
+func newCPUProfile(values map[string]int64) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     10000000,
+	}
+	id := uint64(1)
+	for name, v := range values {
+		fn := &profile.Function{ID: id, Name: name}
+		loc := &profile.Location{ID: id, Line: []profile.Line{{Function: fn}}}
+		p.Function = append(p.Function, fn)
+		p.Location = append(p.Location, loc)
+		p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{v}})
+		id++
+	}
+	return p
+}
+
+// TestAnalyzeDeltaProfile 测试差值 profile 的构造与分析
+func TestAnalyzeDeltaProfile(t *testing.T) {
+	baseline := newCPUProfile(map[string]int64{"main.slow": 300000000, "main.same": 100000000, "main.gone": 50000000})
+	target := newCPUProfile(map[string]int64{"main.slow": 100000000, "main.same": 100000000, "main.new": 80000000})
+
+	delta, err := DeltaProfile(baseline, target)
+	if err != nil {
+		t.Fatalf("DeltaProfile() error = %v", err)
+	}
+	netValues, _ := aggregateFunctionValues(delta, 0)
+	if netValues["main.slow"] != -200000000 || netValues["main.new"] != 80000000 || netValues["main.same"] != 0 {
+		t.Errorf("Unexpected net values: %v", netValues)
+	}
+
+	result, err := AnalyzeDeltaProfile(baseline, target, "cpu", 10, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeDeltaProfile() error = %v", err)
+	}
+	for _, want := range []string{"净变化: -170.00ms", "-200.00ms", "+80.00ms", "-50.00ms"} {
+		if !containsString(result, want) {
+			t.Errorf("Result does not contain expected string %q\nGot:\n%s", want, result)
+		}
+	}
+	if containsString(result, "main.same") {
+		t.Errorf("Unchanged function should not be listed\nGot:\n%s", result)
+	}
+
+	jsonResult, err := AnalyzeDeltaProfile(baseline, target, "cpu", 1, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeDeltaProfile() json error = %v", err)
+	}
+	for _, want := range []string{`"functionName": "main.slow"`, `"netValue": -200000000`, `"netTotal": -170000000`} {
+		if !containsString(jsonResult, want) {
+			t.Errorf("JSON result does not contain %q\nGot:\n%s", want, jsonResult)
+		}
+	}
+}
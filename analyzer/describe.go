@@ -0,0 +1,161 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// SampleTypeSummary 代表 profile 中单个样本类型的汇总信息 (JSON)
+type SampleTypeSummary struct {
+	Type           string `json:"type"`
+	Unit           string `json:"unit"`
+	Total          int64  `json:"total"`          // 所有样本在该类型上的值之和
+	TotalFormatted string `json:"totalFormatted"` // 按单位格式化后的总值
+	NonZeroSamples int    `json:"nonZeroSamples"` // 该类型值非零的样本数
+}
+
+// ProfileDescription 代表 describe_profile 的整体结果 (JSON)
+type ProfileDescription struct {
+	SampleCount       int                 `json:"sampleCount"`
+	SampleTypes       []SampleTypeSummary `json:"sampleTypes"`
+	DefaultSampleType string              `json:"defaultSampleType,omitempty"`
+	PeriodType        string              `json:"periodType,omitempty"`
+	PeriodUnit        string              `json:"periodUnit,omitempty"`
+	Period            int64               `json:"period"`
+	TimeNanos         int64               `json:"timeNanos"`          // 采集开始时间 (Unix 纳秒)，0 表示未记录
+	Time              string              `json:"time,omitempty"`     // 采集开始时间 (RFC 3339, UTC)
+	DurationNanos     int64               `json:"durationNanos"`      // 采集时长，0 表示未记录
+	Duration          string              `json:"duration,omitempty"` // 格式化后的采集时长
+	Comments          []string            `json:"comments,omitempty"`
+	Mappings          *MappingReport      `json:"mappings,omitempty"` // 按 Mapping (主程序、插件、共享库) 汇总的样本归属
+}
+
+// DescribeProfile 扫描整个 profile，列出每个样本类型及其总值、采样周期、采集时间和时长、注释，
+// 以及样本在各 Mapping 之间的分布，帮助用户在分析前快速了解 profile 内容 (例如应该使用哪种 profile_type)。
+func DescribeProfile(p *profile.Profile, format string) (string, error) {
+	logDebug("Describing profile (Format: %s)", format)
+
+	desc := ProfileDescription{
+		SampleCount:       len(p.Sample),
+		SampleTypes:       make([]SampleTypeSummary, len(p.SampleType)),
+		DefaultSampleType: p.DefaultSampleType,
+		Period:            p.Period,
+		TimeNanos:         p.TimeNanos,
+		DurationNanos:     p.DurationNanos,
+		Comments:          p.Comments,
+	}
+	if p.PeriodType != nil {
+		desc.PeriodType, desc.PeriodUnit = p.PeriodType.Type, p.PeriodType.Unit
+	}
+	if p.TimeNanos != 0 {
+		desc.Time = time.Unix(0, p.TimeNanos).UTC().Format(time.RFC3339)
+	}
+	if p.DurationNanos > 0 {
+		desc.Duration = formatUnitValue(p.DurationNanos, "nanoseconds")
+	}
+	for i, st := range p.SampleType {
+		desc.SampleTypes[i] = SampleTypeSummary{Type: st.Type, Unit: st.Unit}
+	}
+
+	for _, s := range p.Sample {
+		for i := range desc.SampleTypes {
+			if i >= len(s.Value) {
+				break
+			}
+			desc.SampleTypes[i].Total += s.Value[i]
+			if s.Value[i] != 0 {
+				desc.SampleTypes[i].NonZeroSamples++
+			}
+		}
+	}
+	for i := range desc.SampleTypes {
+		desc.SampleTypes[i].TotalFormatted = formatUnitValue(desc.SampleTypes[i].Total, desc.SampleTypes[i].Unit)
+	}
+	desc.Mappings = AnalyzeMappingCoverage(p)
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(desc, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		var b strings.Builder
+		if format == "markdown" {
+			b.WriteString("# Profile 概览\n\n")
+			b.WriteString(fmt.Sprintf("**样本数**: %d\n\n", desc.SampleCount))
+			for _, field := range describeMetadata(desc) {
+				b.WriteString(fmt.Sprintf("- **%s**: %s\n", field[0], field[1]))
+			}
+			b.WriteString("\n")
+			b.WriteString("| 样本类型 | 单位 | 总值 | 非零样本数 |\n")
+			b.WriteString("|----------|------|------|------------|\n")
+			for _, st := range desc.SampleTypes {
+				b.WriteString(fmt.Sprintf("| `%s` | %s | %s | %d |\n", st.Type, st.Unit, st.TotalFormatted, st.NonZeroSamples))
+			}
+			if desc.Mappings != nil {
+				b.WriteString(fmt.Sprintf("\n## Mapping 覆盖 (按 %s)\n\n", desc.Mappings.ValueType))
+				b.WriteString("| Mapping | Build ID | 样本数 | 值 | 占比 | 符号 |\n")
+				b.WriteString("|---------|----------|--------|----|------|------|\n")
+				for _, m := range desc.Mappings.Mappings {
+					b.WriteString(fmt.Sprintf("| `%s` | %s | %d | %s | %.2f%% | %s |\n",
+						mappingDisplayName(m), truncateString(m.BuildID, 16), m.Samples, m.ValueFormatted, m.Percent, mappingSymbolStatus(m)))
+				}
+			}
+		} else {
+			b.WriteString("Profile 概览\n")
+			b.WriteString("============\n\n")
+			b.WriteString(fmt.Sprintf("样本数: %d\n", desc.SampleCount))
+			for _, field := range describeMetadata(desc) {
+				b.WriteString(fmt.Sprintf("%s: %s\n", field[0], field[1]))
+			}
+			b.WriteString("\n")
+			b.WriteString("样本类型:\n")
+			for _, st := range desc.SampleTypes {
+				b.WriteString(fmt.Sprintf("  %s (%s): %s across %d samples\n", st.Type, st.Unit, st.TotalFormatted, st.NonZeroSamples))
+			}
+			if desc.Mappings != nil {
+				b.WriteString(fmt.Sprintf("\nMapping 覆盖 (按 %s):\n", desc.Mappings.ValueType))
+				for _, m := range desc.Mappings.Mappings {
+					b.WriteString(fmt.Sprintf("  %s: %s (%.2f%%) across %d samples, %s\n",
+						mappingDisplayName(m), m.ValueFormatted, m.Percent, m.Samples, mappingSymbolStatus(m)))
+				}
+			}
+		}
+		return b.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// describeMetadata 返回概览中样本类型之外的元数据 (名称, 值)；注释放在最后，每条一行
+func describeMetadata(desc ProfileDescription) [][2]string {
+	var fields [][2]string
+	if desc.DefaultSampleType != "" {
+		fields = append(fields, [2]string{"默认样本类型", desc.DefaultSampleType})
+	}
+	period := "未记录"
+	if desc.PeriodType != "" || desc.Period != 0 {
+		period = fmt.Sprintf("%s/%s, %s", desc.PeriodType, desc.PeriodUnit, formatUnitValue(desc.Period, desc.PeriodUnit))
+	}
+	fields = append(fields, [2]string{"采样周期", period})
+	startTime := "未记录"
+	if desc.Time != "" {
+		startTime = desc.Time
+	}
+	fields = append(fields, [2]string{"采集时间", startTime})
+	duration := "未记录"
+	if desc.Duration != "" {
+		duration = desc.Duration
+	}
+	fields = append(fields, [2]string{"采集时长", duration})
+	for _, c := range desc.Comments {
+		fields = append(fields, [2]string{"注释", c})
+	}
+	return fields
+}
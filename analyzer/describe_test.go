@@ -0,0 +1,201 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestDescribeProfile 测试样本类型总值的汇总
+func TestDescribeProfile(t *testing.T) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "inuse_objects", Unit: "count"},
+			{Type: "inuse_space", Unit: "bytes"},
+		},
+		Sample: []*profile.Sample{
+			{Value: []int64{10, 1024 * 1024}},
+			{Value: []int64{0, 1024 * 1024}},
+			{Value: []int64{5, 0}},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		format       string
+		wantContains []string
+	}{
+		{
+			name:   "Text format",
+			format: "text",
+			wantContains: []string{
+				"样本数: 3",
+				"inuse_objects (count): 15 across 2 samples",
+				"inuse_space (bytes): 2.00 MB across 2 samples",
+			},
+		},
+		{
+			name:   "Markdown format",
+			format: "markdown",
+			wantContains: []string{
+				"# Profile 概览",
+				"| `inuse_space` | bytes | 2.00 MB | 2 |",
+			},
+		},
+		{
+			name:   "JSON format",
+			format: "json",
+			wantContains: []string{
+				`"sampleCount": 3`,
+				`"total": 2097152`,
+				`"totalFormatted": "2.00 MB"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := DescribeProfile(p, tt.format)
+			if err != nil {
+				t.Fatalf("DescribeProfile() error = %v", err)
+			}
+			for _, want := range tt.wantContains {
+				if !containsString(result, want) {
+					t.Errorf("Result does not contain expected string %q\nGot:\n%s", want, result)
+				}
+			}
+		})
+	}
+
+	if _, err := DescribeProfile(p, "yaml"); err == nil {
+		t.Error("Expected error for unsupported format, got nil")
+	}
+}
+
+// TestDescribeProfileMappings 测试按 Mapping 汇总样本：同一文件的多个段合并，标记主程序和无符号的 Mapping
+func TestDescribeProfileMappings(t *testing.T) {
+	mainBin := &profile.Mapping{ID: 1, File: "/usr/local/bin/server", BuildID: "abc123", HasFunctions: true}
+	plugin := &profile.Mapping{ID: 2, File: "/opt/plugins/auth.so"}
+	libcText := &profile.Mapping{ID: 3, File: "/lib/x86_64-linux-gnu/libc.so.6", BuildID: "libc1"}
+	libcData := &profile.Mapping{ID: 4, File: "/lib/x86_64-linux-gnu/libc.so.6", BuildID: "libc1"}
+	fn := &profile.Function{ID: 1, Name: "main.handle"}
+	locMain := &profile.Location{ID: 1, Mapping: mainBin, Line: []profile.Line{{Function: fn}}}
+	locPlugin := &profile.Location{ID: 2, Mapping: plugin, Address: 0x2000}
+	locLibc1 := &profile.Location{ID: 3, Mapping: libcText, Address: 0x3000}
+	locLibc2 := &profile.Location{ID: 4, Mapping: libcData, Address: 0x4000}
+	locNone := &profile.Location{ID: 5, Address: 0x5000}
+
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Mapping:    []*profile.Mapping{mainBin, plugin, libcText, libcData},
+		Location:   []*profile.Location{locMain, locPlugin, locLibc1, locLibc2, locNone},
+		Function:   []*profile.Function{fn},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{locMain}, Value: []int64{5, 500}},
+			{Location: []*profile.Location{locPlugin, locMain}, Value: []int64{3, 300}},
+			{Location: []*profile.Location{locLibc1, locMain}, Value: []int64{1, 100}},
+			{Location: []*profile.Location{locLibc2, locMain}, Value: []int64{1, 50}},
+			{Location: []*profile.Location{locNone}, Value: []int64{1, 50}},
+		},
+	}
+
+	report := AnalyzeMappingCoverage(p)
+	if report == nil {
+		t.Fatal("AnalyzeMappingCoverage() returned nil for a profile with mappings")
+	}
+	if report.ValueType != "cpu" {
+		t.Errorf("ValueType = %q, want the last sample type cpu", report.ValueType)
+	}
+	want := []struct {
+		file       string
+		samples    int
+		value      int64
+		isMain     bool
+		hasSymbols bool
+	}{
+		{"/usr/local/bin/server", 1, 500, true, true},
+		{"/opt/plugins/auth.so", 1, 300, false, false},
+		{"/lib/x86_64-linux-gnu/libc.so.6", 2, 150, false, false},
+		{"(unmapped)", 1, 50, false, false},
+	}
+	if len(report.Mappings) != len(want) {
+		t.Fatalf("got %d mappings, want %d: %+v", len(report.Mappings), len(want), report.Mappings)
+	}
+	for i, w := range want {
+		m := report.Mappings[i]
+		if m.File != w.file || m.Samples != w.samples || m.Value != w.value || m.IsMain != w.isMain || m.HasSymbols != w.hasSymbols {
+			t.Errorf("mapping #%d = %+v, want %+v", i+1, m, w)
+		}
+	}
+	if report.Mappings[0].Percent != 50 {
+		t.Errorf("main binary percent = %.2f, want 50", report.Mappings[0].Percent)
+	}
+
+	result, err := DescribeProfile(p, "markdown")
+	if err != nil {
+		t.Fatalf("DescribeProfile() error = %v", err)
+	}
+	for _, want := range []string{"## Mapping 覆盖 (按 cpu)", "| `server (主程序)` | abc123 | 1 | ", "| `auth.so` |  | 1 | ", "| 30.00% | 无符号 |"} {
+		if !containsString(result, want) {
+			t.Errorf("Result does not contain expected string %q\nGot:\n%s", want, result)
+		}
+	}
+
+	if AnalyzeMappingCoverage(&profile.Profile{SampleType: p.SampleType}) != nil {
+		t.Error("AnalyzeMappingCoverage() should return nil when the profile has no mappings")
+	}
+}
+
+// TestDescribeProfileMetadata 测试概览中包含采样周期、采集时间和时长以及注释
+func TestDescribeProfileMetadata(t *testing.T) {
+	p := &profile.Profile{
+		SampleType:        []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		DefaultSampleType: "cpu",
+		PeriodType:        &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:            10000000,
+		TimeNanos:         1704067200000000000, // 2024-01-01 00:00:00 UTC
+		DurationNanos:     30000000000,
+		Comments:          []string{"collected by ci", "build 42"},
+		Sample:            []*profile.Sample{{Value: []int64{1, 10000000}}},
+	}
+
+	result, err := DescribeProfile(p, "json")
+	if err != nil {
+		t.Fatalf("DescribeProfile(json) error = %v", err)
+	}
+	var desc ProfileDescription
+	if err := json.Unmarshal([]byte(result), &desc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if desc.PeriodType != "cpu" || desc.PeriodUnit != "nanoseconds" || desc.Period != 10000000 {
+		t.Errorf("period = %s/%s %d, want cpu/nanoseconds 10000000", desc.PeriodType, desc.PeriodUnit, desc.Period)
+	}
+	if desc.TimeNanos != p.TimeNanos || desc.Time != "2024-01-01T00:00:00Z" || desc.DurationNanos != p.DurationNanos {
+		t.Errorf("time = %d (%s), duration = %d", desc.TimeNanos, desc.Time, desc.DurationNanos)
+	}
+	if desc.DefaultSampleType != "cpu" || len(desc.Comments) != 2 || desc.Comments[1] != "build 42" {
+		t.Errorf("defaultSampleType = %q, comments = %v", desc.DefaultSampleType, desc.Comments)
+	}
+
+	text, err := DescribeProfile(p, "text")
+	if err != nil {
+		t.Fatalf("DescribeProfile(text) error = %v", err)
+	}
+	for _, want := range []string{"默认样本类型: cpu", "采样周期: cpu/nanoseconds, 10.00ms", "采集时间: 2024-01-01T00:00:00Z", "采集时长: 30.00s", "注释: collected by ci", "注释: build 42"} {
+		if !containsString(text, want) {
+			t.Errorf("text output does not contain %q\nGot:\n%s", want, text)
+		}
+	}
+
+	// 没有记录的元数据明确标出，而不是输出零值
+	empty, err := DescribeProfile(&profile.Profile{SampleType: []*profile.ValueType{{Type: "goroutine", Unit: "count"}}}, "markdown")
+	if err != nil {
+		t.Fatalf("DescribeProfile(markdown) error = %v", err)
+	}
+	for _, want := range []string{"- **采样周期**: 未记录", "- **采集时间**: 未记录", "- **采集时长**: 未记录"} {
+		if !containsString(empty, want) {
+			t.Errorf("markdown output does not contain %q\nGot:\n%s", want, empty)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// DetectProfileType 根据样本类型推断 profile 的类型 (cpu, heap, allocs, goroutine, mutex, block)。
+// mutex 与 block profile 的样本类型相同 (contentions/delay)，仅凭内容无法区分，此时返回 "mutex"
+// 并应视为与 "block" 兼容；无法识别时返回空字符串。
+func DetectProfileType(p *profile.Profile) string {
+	has := make(map[string]bool, len(p.SampleType))
+	for _, st := range p.SampleType {
+		has[st.Type+"/"+st.Unit] = true
+	}
+
+	switch {
+	case has["cpu/nanoseconds"] || (has["samples/count"] && p.PeriodType != nil && p.PeriodType.Type == "cpu"):
+		return "cpu"
+	case has["goroutine/count"] || has["goroutines/count"]:
+		return "goroutine"
+	case has["contentions/count"] && has["delay/nanoseconds"]:
+		return "mutex"
+	case has["inuse_space/bytes"]:
+		// heap 与 allocs profile 包含相同的样本类型，allocs 默认展示 alloc_space
+		if p.DefaultSampleType == "alloc_space" {
+			return "allocs"
+		}
+		return "heap"
+	case has["alloc_space/bytes"]:
+		return "allocs"
+	}
+	return ""
+}
+
+// ProfileTypeFromName 根据文件名推断 profile 的类型，例如 "cpu.pb.gz" -> "cpu"；无法推断时返回空字符串。
+func ProfileTypeFromName(name string) string {
+	base := strings.ToLower(path.Base(name))
+	for _, hint := range []struct {
+		keyword     string
+		profileType string
+	}{
+		{"goroutine", "goroutine"},
+		{"mutex", "mutex"},
+		{"block", "block"},
+		{"allocs", "allocs"},
+		{"heap", "heap"},
+		{"mem", "heap"},
+		{"cpu", "cpu"},
+	} {
+		if strings.Contains(base, hint.keyword) {
+			return hint.profileType
+		}
+	}
+	return ""
+}
+
+// profileTypesCompatible 判断两个 profile 类型是否可以互换分析：
+// heap 与 allocs 的内容相同，mutex 与 block 的样本类型相同。
+func profileTypesCompatible(a, b string) bool {
+	family := func(t string) string {
+		switch t {
+		case "heap", "allocs":
+			return "memory"
+		case "mutex", "block":
+			return "contention"
+		}
+		return t
+	}
+	return family(a) == family(b)
+}
+
+// CheckProfileTypeMismatch 比较请求的类型、文件名暗示的类型与内容推断的类型，返回需要提示用户的警告。
+// 只给出警告而不报错，因为推断可能不准确。
+func CheckProfileTypeMismatch(p *profile.Profile, requestedType, fileName string) []string {
+	detected := DetectProfileType(p)
+	if detected == "" {
+		return nil
+	}
+
+	var warnings []string
+	if requestedType != "" && !profileTypesCompatible(requestedType, detected) {
+		warnings = append(warnings, fmt.Sprintf("请求的 profile_type=%s，但文件内容看起来是 %s profile，分析结果可能不正确。", requestedType, detected))
+	}
+	if hint := ProfileTypeFromName(fileName); hint != "" && !profileTypesCompatible(hint, detected) {
+		warnings = append(warnings, fmt.Sprintf("文件名 '%s' 暗示这是 %s profile，但文件内容看起来是 %s profile，请确认文件是否保存错误。", path.Base(fileName), hint, detected))
+	}
+	return warnings
+}
@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestDetectProfileType 测试根据样本类型推断 profile 类型
+func TestDetectProfileType(t *testing.T) {
+	tests := []struct {
+		name        string
+		sampleTypes []*profile.ValueType
+		defaultType string
+		want        string
+	}{
+		{"CPU", []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}}, "", "cpu"},
+		{"Heap", []*profile.ValueType{{Type: "alloc_space", Unit: "bytes"}, {Type: "inuse_space", Unit: "bytes"}}, "", "heap"},
+		{"Allocs", []*profile.ValueType{{Type: "alloc_space", Unit: "bytes"}, {Type: "inuse_space", Unit: "bytes"}}, "alloc_space", "allocs"},
+		{"Goroutine", []*profile.ValueType{{Type: "goroutine", Unit: "count"}}, "", "goroutine"},
+		{"Mutex", []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}, "", "mutex"},
+		{"Unknown", []*profile.ValueType{{Type: "custom", Unit: "widgets"}}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &profile.Profile{SampleType: tt.sampleTypes, DefaultSampleType: tt.defaultType}
+			if got := DetectProfileType(p); got != tt.want {
+				t.Errorf("DetectProfileType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCheckProfileTypeMismatch 测试文件名/请求类型与内容不一致时的警告
+func TestCheckProfileTypeMismatch(t *testing.T) {
+	heap := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}}
+
+	warnings := CheckProfileTypeMismatch(heap, "cpu", "/tmp/cpu.pb.gz")
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %d: %v", len(warnings), warnings)
+	}
+	if !containsString(warnings[0], "profile_type=cpu") || !containsString(warnings[1], "cpu.pb.gz") {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+
+	// heap 与 allocs 内容相同，不应警告
+	if warnings := CheckProfileTypeMismatch(heap, "allocs", "allocs.pb.gz"); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for compatible types, got %v", warnings)
+	}
+	if warnings := CheckProfileTypeMismatch(heap, "heap", "profile.pb.gz"); len(warnings) != 0 {
+		t.Errorf("Expected no warnings without a filename hint, got %v", warnings)
+	}
+}
@@ -1,10 +1,11 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -13,63 +14,156 @@ import (
 
 // DiffResult 表示两个 profile 之间的差异结果
 type DiffResult struct {
-	ProfileType     string           `json:"profileType"`
-	BaselineURI     string           `json:"baselineUri"`
-	TargetURI       string           `json:"targetUri"`
-	TopN            int              `json:"topN"`
-	Functions       []FunctionDiff   `json:"functions"`
-	Summary         DiffSummary      `json:"summary"`
+	ProfileType string             `json:"profileType"`
+	BaselineURI string             `json:"baselineUri"`
+	TargetURI   string             `json:"targetUri"`
+	TopN        int                `json:"topN"`
+	Aggregation string             `json:"aggregation"`
+	ValueType   string             `json:"valueType"`
+	Functions   []FunctionDiff     `json:"functions"`
+	Summary     DiffSummary        `json:"summary"`
+	Verdict     *RegressionVerdict `json:"verdict,omitempty"` // 设置了回归阈值时的判定结果
 }
 
 // FunctionDiff 表示单个函数的差异统计
 type FunctionDiff struct {
-	FunctionName       string  `json:"functionName"`
-	BaselineValue      int64   `json:"baselineValue"`
-	TargetValue        int64   `json:"targetValue"`
-	DiffValue          int64   `json:"diffValue"`
-	DiffPercentage     float64 `json:"diffPercentage"`
-	BaselineFormatted  string  `json:"baselineFormatted"`
-	TargetFormatted    string  `json:"targetFormatted"`
-	DiffFormatted      string  `json:"diffFormatted"`
+	FunctionName      string  `json:"functionName"`
+	FunctionID        string  `json:"functionId"` // 完整函数名的稳定哈希，用于跨报告关联
+	BaselineValue     int64   `json:"baselineValue"`
+	TargetValue       int64   `json:"targetValue"`
+	DiffValue         int64   `json:"diffValue"`
+	DiffPercentage    float64 `json:"diffPercentage"`
+	BaselineFormatted string  `json:"baselineFormatted"`
+	TargetFormatted   string  `json:"targetFormatted"`
+	DiffFormatted     string  `json:"diffFormatted"`
+	BaselineSamples   int64   `json:"baselineSamples"` // baseline 中支撑该函数的样本数
+	TargetSamples     int64   `json:"targetSamples"`   // target 中支撑该函数的样本数
+	ZScore            float64 `json:"zScore"`          // 样本数差异的显著性估计
+	LowConfidence     bool    `json:"lowConfidence"`   // 样本数过少，差异可能只是噪声
 }
 
 // DiffSummary 提供差异分析的总体摘要
 type DiffSummary struct {
-	BaselineTotal      int64   `json:"baselineTotal"`
-	TargetTotal        int64   `json:"targetTotal"`
-	TotalDiff          int64   `json:"totalDiff"`
-	TotalDiffPercent   float64 `json:"totalDiffPercent"`
-	ImprovedFuncs      int     `json:"improvedFuncs"`    // 性能提升的函数数量
-	RegressedFuncs     int     `json:"regressedFuncs"`   // 性能回归的函数数量
-	AddedFuncs         int     `json:"addedFuncs"`       // 新增的函数
-	RemovedFuncs       int     `json:"removedFuncs"`     // 移除的函数
+	BaselineTotal         int64   `json:"baselineTotal"`
+	TargetTotal           int64   `json:"targetTotal"`
+	TotalDiff             int64   `json:"totalDiff"`
+	TotalDiffPercent      float64 `json:"totalDiffPercent"`
+	ImprovedFuncs         int     `json:"improvedFuncs"`                   // 性能提升的函数数量
+	RegressedFuncs        int     `json:"regressedFuncs"`                  // 性能回归的函数数量
+	AddedFuncs            int     `json:"addedFuncs"`                      // 新增的函数
+	RemovedFuncs          int     `json:"removedFuncs"`                    // 移除的函数
+	LowConfidenceFuncs    int     `json:"lowConfidenceFuncs"`              // 低置信度差异的函数数量
+	ExcludedLowConfidence bool    `json:"excludedLowConfidence"`           // 上述统计是否已排除低置信度差异
+	IncludeRegex          string  `json:"includeRegex,omitempty"`          // 只比较匹配的函数
+	ExcludeRegex          string  `json:"excludeRegex,omitempty"`          // 不比较匹配的函数 (优先于 includeRegex)
+	FilteredOutFuncs      int     `json:"filteredOutFuncs,omitempty"`      // 被 include/exclude 过滤掉、不计入上述统计的函数数量
+	NormalizedByDuration  bool    `json:"normalizedByDuration,omitempty"`  // target 的值是否已按采集时长缩放到 baseline 的时长
+	BaselineDurationNanos int64   `json:"baselineDurationNanos,omitempty"` // baseline 的采集时长 (仅在归一化时输出)
+	TargetDurationNanos   int64   `json:"targetDurationNanos,omitempty"`   // target 的采集时长 (仅在归一化时输出)
+	DurationScale         float64 `json:"durationScale,omitempty"`         // target 值的缩放系数 (baseline 时长 / target 时长)
+	CrossMetric           bool    `json:"crossMetric,omitempty"`           // baseline 与 target 比较的是不同的样本类型 (见 CompareOptions.BaselineValueType)，结果只是近似
+	BaselineValueType     string  `json:"baselineValueType,omitempty"`     // 跨指标比较时 baseline 使用的样本类型
+	TargetValueType       string  `json:"targetValueType,omitempty"`       // 跨指标比较时 target 使用的样本类型
 }
 
-// CompareProfiles 比较两个 profile 并生成差异分析
-func CompareProfiles(baseline, target *profile.Profile, profileTypeName string, topN int, format string) (string, error) {
-	log.Printf("Comparing profiles: type=%s, baseline samples=%d, target samples=%d",
-		profileTypeName, len(baseline.Sample), len(target.Sample))
+// 差异聚合方式
+const (
+	// AggregationLeaf 只按叶子帧 (样本的第一个函数) 聚合
+	AggregationLeaf = "leaf"
+	// AggregationCumulative 将样本值计入调用栈上的每个函数，同一样本中每个函数只计一次
+	AggregationCumulative = "cumulative"
+	// AggregationFullStack 按完整调用栈聚合，区分经由不同调用者到达的同一叶子函数
+	AggregationFullStack = "full_stack"
+)
 
-	// 确定要比较的值索引
-	valueIndex, err := getValueIndex(baseline, profileTypeName)
-	if err != nil {
-		return "", err
+// 差异的排序方式 (CompareOptions.SortBy)
+const (
+	DiffSortAbsPercent = "abs_percent" // 按变化百分比的绝对值 (默认)
+	DiffSortAbsValue   = "abs_value"   // 按变化量的绝对值，变化最大的函数排在前面，不受基数大小影响
+	DiffSortValue      = "value"       // 按变化量从大到小，增长最多 (回归最严重) 的函数排在前面
+)
+
+// DiffSortKeys 是 CompareOptions.SortBy 的可选值
+var DiffSortKeys = []string{DiffSortAbsPercent, DiffSortAbsValue, DiffSortValue}
+
+// significanceZThreshold 是判定差异显著的 z 值阈值 (约 95% 置信度)
+const significanceZThreshold = 2.0
+
+// CompareOptions 定义 profile 比较的可选参数
+type CompareOptions struct {
+	TopN   int
+	Format string
+	// ExcludeLowConfidence 为 true 时，低置信度的差异不计入提升/回归等统计，并排在结果末尾
+	ExcludeLowConfidence bool
+	// Aggregation 是差异的聚合方式 (leaf、cumulative、full_stack)，为空时使用 leaf
+	Aggregation string
+	// ValueType 显式指定比较的样本类型 (例如 inuse_space、inuse_objects、alloc_space、alloc_objects)，
+	// 两个 profile 中任意一个缺少该类型时报错；为空时按 profileTypeName 选择
+	ValueType string
+	// Include 非 nil 时只比较完整函数名 (full_stack 聚合时为调用栈签名) 匹配的函数
+	Include *regexp.Regexp
+	// Exclude 非 nil 时不比较匹配的函数；与 Include 冲突时 Exclude 优先
+	Exclude *regexp.Regexp
+	// NormalizeByDuration 为 true 时按采集时长 (DurationNanos) 将 target 的值缩放到 baseline 的时长再比较，
+	// 避免采集时间更长的 target 被误判为回归；两个 profile 都必须记录了采集时长
+	NormalizeByDuration bool
+	// RegressionThresholdPercent 大于 0 时启用单函数回归判定：值增长超过该百分比的函数判定为回归 (见 RegressionVerdict)
+	RegressionThresholdPercent float64
+	// TotalRegressionThresholdPercent 大于 0 时启用总量回归判定：profile 总值增长超过该百分比时判定为回归
+	TotalRegressionThresholdPercent float64
+	// SortBy 是差异的排序方式 (见 DiffSortKeys)，为空时使用 abs_percent
+	SortBy string
+	// BaselineValueType 和 TargetValueType 分别为 baseline 和 target 指定样本类型，优先于 ValueType，
+	// 用于跨指标比较 (例如 allocs profile 的 alloc_space 与 heap profile 的 inuse_space)。
+	// 指定后两边的样本类型可以不同，但单位必须相同；任意一边找不到指定的类型时报错
+	BaselineValueType string
+	TargetValueType   string
+}
+
+// functionFilter 按 CompareOptions 的 Include/Exclude 过滤参与比较的函数
+type functionFilter struct {
+	include, exclude *regexp.Regexp
+}
+
+// allows 判断函数是否参与比较：先检查 exclude，再检查 include
+func (f functionFilter) allows(name string) bool {
+	if f.exclude != nil && f.exclude.MatchString(name) {
+		return false
 	}
+	return f.include == nil || f.include.MatchString(name)
+}
 
-	// 聚合 baseline 和 target 的函数级统计
-	baselineFuncs := aggregateFunctionValues(baseline, valueIndex)
-	targetFuncs := aggregateFunctionValues(target, valueIndex)
+// CompareProfiles 比较两个 profile 并生成差异分析
+func CompareProfiles(baseline, target *profile.Profile, profileTypeName string, topN int, format string) (string, error) {
+	return CompareProfilesWithOptions(baseline, target, profileTypeName, CompareOptions{TopN: topN, Format: format})
+}
 
-	// 计算差异
-	diffs := computeFunctionDiffs(baselineFuncs, targetFuncs)
+// CompareProfilesWithOptions 比较两个 profile 并生成差异分析，支持 CompareOptions 中的额外选项
+func CompareProfilesWithOptions(baseline, target *profile.Profile, profileTypeName string, opts CompareOptions) (string, error) {
+	out, _, err := CompareProfilesWithVerdict(baseline, target, profileTypeName, opts)
+	return out, err
+}
 
-	// 按差异绝对值排序（最大的变化排在前面）
-	sort.Slice(diffs, func(i, j int) bool {
-		return math.Abs(diffs[i].DiffPercentage) > math.Abs(diffs[j].DiffPercentage)
-	})
+// CompareProfilesWithVerdict 与 CompareProfilesWithOptions 相同，同时返回回归判定，
+// 便于调用方 (例如 CI 门禁) 不解析报告文本即可判断是否存在回归。未设置任何回归阈值时判定为 nil。
+func CompareProfilesWithVerdict(baseline, target *profile.Profile, profileTypeName string, opts CompareOptions) (string, *RegressionVerdict, error) {
+	return CompareProfilesContext(context.Background(), baseline, target, profileTypeName, opts)
+}
 
-	// 计算总体摘要
-	summary := computeDiffSummary(baselineFuncs, targetFuncs, diffs)
+// CompareProfilesContext 与 CompareProfilesWithVerdict 相同，但在聚合样本时定期检查 ctx，
+// ctx 被取消或超时时尽快停止并返回包装了 ctx.Err() 的错误。
+func CompareProfilesContext(ctx context.Context, baseline, target *profile.Profile, profileTypeName string, opts CompareOptions) (string, *RegressionVerdict, error) {
+	topN, format := opts.TopN, opts.Format
+	aggregation := opts.Aggregation
+	if aggregation == "" {
+		aggregation = AggregationLeaf
+	}
+
+	diffs, summary, valueType, err := computeProfileDiff(ctx, baseline, target, profileTypeName, aggregation, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	verdict := computeRegressionVerdict(diffs, summary, opts)
 
 	// 格式化输出
 	if format == "json" {
@@ -78,51 +172,289 @@ func CompareProfiles(baseline, target *profile.Profile, profileTypeName string,
 			BaselineURI: "baseline",
 			TargetURI:   "target",
 			TopN:        topN,
+			Aggregation: aggregation,
+			ValueType:   valueType.Type,
 			Functions:   diffs,
 			Summary:     summary,
+			Verdict:     verdict,
 		}
 		jsonBytes, err := json.MarshalIndent(result, "", "  ")
 		if err != nil {
-			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+			return "", nil, fmt.Errorf("failed to marshal JSON: %w", err)
 		}
-		return string(jsonBytes), nil
+		return string(jsonBytes), verdict, nil
+	}
+
+	if format == "benchstat" {
+		var b strings.Builder
+		b.WriteString(formatBenchstatReport(diffs, summary, valueType.Type, valueType.Unit, topN))
+		writeRegressionVerdict(&b, verdict, format)
+		return b.String(), verdict, nil
 	}
 
 	// Text/Markdown 输出
-	return formatDiffReport(diffs, summary, profileTypeName, topN, format), nil
+	return formatDiffReport(diffs, summary, verdict, profileTypeName, aggregation, topN, format), verdict, nil
 }
 
-// getValueIndex 根据profile类型获取值的索引
-func getValueIndex(p *profile.Profile, profileType string) (int, error) {
-	for i, st := range p.SampleType {
-		switch profileType {
-		case "cpu":
-			if st.Type == "cpu" || (st.Type == "samples" && st.Unit == "nanoseconds") {
-				return i, nil
-			}
-		case "heap", "allocs":
-			if st.Type == "inuse_space" || st.Type == "alloc_space" {
-				return i, nil
+// computeProfileDiff 按 aggregation 聚合两个 profile 并计算排序后的差异和摘要，同时返回比较所用的样本类型。
+// opts.ValueType 非空时两个 profile 都必须包含该样本类型，opts.BaselineValueType/TargetValueType 分别覆盖对应一边的类型；Include/Exclude 之外的函数不出现在差异中，也不计入摘要中的函数统计。
+func computeProfileDiff(ctx context.Context, baseline, target *profile.Profile, profileTypeName, aggregation string, opts CompareOptions) ([]FunctionDiff, DiffSummary, *profile.ValueType, error) {
+	excludeLowConfidence := opts.ExcludeLowConfidence
+	baselineValueType, targetValueType := opts.ValueType, opts.ValueType
+	if opts.BaselineValueType != "" {
+		baselineValueType = opts.BaselineValueType
+	}
+	if opts.TargetValueType != "" {
+		targetValueType = opts.TargetValueType
+	}
+	mapped := opts.BaselineValueType != "" || opts.TargetValueType != ""
+	filter := functionFilter{include: opts.Include, exclude: opts.Exclude}
+	sortKey, err := diffSortKey(opts.SortBy)
+	if err != nil {
+		return nil, DiffSummary{}, nil, err
+	}
+	logDebug("Comparing profiles: type=%s, aggregation=%s, baseline samples=%d, target samples=%d",
+		profileTypeName, aggregation, len(baseline.Sample), len(target.Sample))
+
+	// 确定要比较的值索引：两个 profile 的列顺序可能不同，因此分别按名称查找
+	baselineIndex, err := getValueIndex(baseline, profileTypeName, baselineValueType)
+	if err != nil {
+		return nil, DiffSummary{}, nil, fmt.Errorf("baseline: %w", err)
+	}
+	targetIndex, err := getValueIndex(target, profileTypeName, targetValueType)
+	if err != nil {
+		return nil, DiffSummary{}, nil, fmt.Errorf("target: %w", err)
+	}
+	b, t := baseline.SampleType[baselineIndex], target.SampleType[targetIndex]
+	// 显式指定了两边的样本类型时允许比较不同的指标，但单位不同的值没有可比性
+	if b.Unit != t.Unit || (b.Type != t.Type && !mapped) {
+		return nil, DiffSummary{}, nil, fmt.Errorf("baseline 与 target 的样本类型不一致 (%s/%s vs %s/%s)，无法比较", b.Type, b.Unit, t.Type, t.Unit)
+	}
+
+	// 按聚合方式聚合 baseline 和 target 的统计
+	baselineFuncs, baselineSamples, baselineTotal, err := aggregateValues(ctx, baseline, baselineIndex, aggregation)
+	if err != nil {
+		return nil, DiffSummary{}, nil, err
+	}
+	targetFuncs, targetSamples, targetTotal, err := aggregateValues(ctx, target, targetIndex, aggregation)
+	if err != nil {
+		return nil, DiffSummary{}, nil, err
+	}
+
+	// 按采集时长归一化：把 target 的值和样本数缩放到 baseline 的时长
+	scale := 0.0
+	if opts.NormalizeByDuration {
+		if baseline.DurationNanos <= 0 || target.DurationNanos <= 0 {
+			return nil, DiffSummary{}, nil, fmt.Errorf("无法按采集时长归一化：baseline 或 target 未记录采集时长 (DurationNanos)")
+		}
+		scale = float64(baseline.DurationNanos) / float64(target.DurationNanos)
+		targetTotal = scaleValues(targetFuncs, targetSamples, targetTotal, scale)
+	}
+
+	// 计算差异
+	diffs, filteredOut := computeFunctionDiffs(baselineFuncs, targetFuncs, baselineSamples, targetSamples, filter)
+
+	// 按 sortBy 降序排序（默认按差异百分比的绝对值，最大的变化排在前面）
+	sort.Slice(diffs, func(i, j int) bool {
+		if excludeLowConfidence && diffs[i].LowConfidence != diffs[j].LowConfidence {
+			return !diffs[i].LowConfidence
+		}
+		return sortKey(diffs[i]) > sortKey(diffs[j])
+	})
+
+	// 计算总体摘要
+	summary := computeDiffSummary(baselineTotal, targetTotal, diffs, excludeLowConfidence)
+	summary.FilteredOutFuncs = filteredOut
+	if scale != 0 {
+		summary.NormalizedByDuration = true
+		summary.BaselineDurationNanos = baseline.DurationNanos
+		summary.TargetDurationNanos = target.DurationNanos
+		summary.DurationScale = scale
+	}
+	if b.Type != t.Type {
+		summary.CrossMetric = true
+		summary.BaselineValueType, summary.TargetValueType = b.Type, t.Type
+	}
+	if filter.include != nil {
+		summary.IncludeRegex = filter.include.String()
+	}
+	if filter.exclude != nil {
+		summary.ExcludeRegex = filter.exclude.String()
+	}
+	return diffs, summary, b, nil
+}
+
+// diffSortKey 返回 sortBy 对应的排序键，差异按该键降序排列；sortBy 为空时使用 abs_percent
+func diffSortKey(sortBy string) (func(FunctionDiff) float64, error) {
+	switch sortBy {
+	case "", DiffSortAbsPercent:
+		return func(d FunctionDiff) float64 { return math.Abs(d.DiffPercentage) }, nil
+	case DiffSortAbsValue:
+		return func(d FunctionDiff) float64 { return math.Abs(float64(d.DiffValue)) }, nil
+	case DiffSortValue:
+		return func(d FunctionDiff) float64 { return float64(d.DiffValue) }, nil
+	}
+	return nil, fmt.Errorf("unsupported sort_by: %s (expected %s)", sortBy, strings.Join(DiffSortKeys, ", "))
+}
+
+// scaleValues 将聚合后的值和样本数原地乘以 scale (四舍五入)，返回缩放后的总值
+func scaleValues(values, samples map[string]int64, total int64, scale float64) int64 {
+	for name, v := range values {
+		values[name] = int64(math.Round(float64(v) * scale))
+	}
+	for name, n := range samples {
+		samples[name] = int64(math.Round(float64(n) * scale))
+	}
+	return int64(math.Round(float64(total) * scale))
+}
+
+// getValueIndex 根据profile类型获取值的索引 (按样本类型名称查找，见 findValueColumn)
+// valueType 非空时只接受 Type 与之相同的样本类型，找不到时报错而不是按位置选择其它列。
+func getValueIndex(p *profile.Profile, profileType, valueType string) (int, error) {
+	if valueType != "" {
+		if i := findSampleTypeIndex(p, valueType); i >= 0 {
+			return i, nil
+		}
+		available := make([]string, len(p.SampleType))
+		for i, st := range p.SampleType {
+			available[i] = st.Type
+		}
+		return 0, fmt.Errorf("profile 中没有样本类型 %s (可用: %s)", valueType, strings.Join(available, ", "))
+	}
+	index, _, err := findValueColumn(p, profileType)
+	return index, err
+}
+
+// sampleEventCounter 返回计算一个 pprof Sample 代表多少次采样事件的函数，用作差异显著性检验的样本数。
+// pprof 通常把调用栈相同的采样合并为一个 Sample (例如 CPU profile 的 {samples: 1000, cpu: 10s})，
+// 因此不能按 Sample 记录计数：有 count 列时使用该列 (见 eventCountIndex)，否则在 Period 与值单位相同时
+// 用值除以 Period，都不满足时才退回到每个非零 Sample 计一次。
+func sampleEventCounter(p *profile.Profile, valueIndex int) func(*profile.Sample) int64 {
+	if countIndex := eventCountIndex(p, valueIndex); countIndex >= 0 {
+		return func(s *profile.Sample) int64 {
+			if countIndex >= len(s.Value) {
+				return 0
 			}
-		case "mutex", "block":
-			if st.Type == "delay" {
-				return i, nil
+			return absInt64(s.Value[countIndex])
+		}
+	}
+	if p.Period > 0 && p.PeriodType != nil && p.PeriodType.Unit == p.SampleType[valueIndex].Unit {
+		period := float64(p.Period)
+		return func(s *profile.Sample) int64 {
+			return int64(math.Round(float64(absInt64(s.Value[valueIndex])) / period))
+		}
+	}
+	return func(s *profile.Sample) int64 {
+		if s.Value[valueIndex] != 0 {
+			return 1
+		}
+		return 0
+	}
+}
+
+// eventCountIndex 返回记录 valueIndex 采样次数的 count 列：valueIndex 本身的单位是 count 时返回它，
+// 否则优先选择同前缀的 count 列 (inuse_space 对应 inuse_objects、alloc_space 对应 alloc_objects)，
+// 再选择第一个 count 列 (cpu 对应 samples)；没有 count 列时返回 -1
+func eventCountIndex(p *profile.Profile, valueIndex int) int {
+	st := p.SampleType[valueIndex]
+	if st.Unit == "count" {
+		return valueIndex
+	}
+	if prefix, _, ok := strings.Cut(st.Type, "_"); ok {
+		for i, t := range p.SampleType {
+			if t.Unit == "count" && strings.HasPrefix(t.Type, prefix+"_") {
+				return i
 			}
 		}
 	}
+	for i, t := range p.SampleType {
+		if t.Unit == "count" {
+			return i
+		}
+	}
+	return -1
+}
+
+// aggregateValues 按聚合方式聚合样本值，返回每个键的值、每个键的采样事件数 (见 sampleEventCounter)，以及参与聚合的样本总值。
+// cumulative 方式下各函数的值之和会超过总值，因此总值单独计算，而不是对各键求和。
+// 聚合过程中定期检查 ctx，ctx 被取消时返回包装了 ctx.Err() 的错误。
+func aggregateValues(ctx context.Context, p *profile.Profile, valueIndex int, aggregation string) (map[string]int64, map[string]int64, int64, error) {
+	if aggregation == AggregationLeaf {
+		values, samples, err := aggregateFunctionValuesContext(ctx, p, valueIndex)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		total := int64(0)
+		for _, v := range values {
+			total += v
+		}
+		return values, samples, total, nil
+	}
+	if aggregation != AggregationCumulative && aggregation != AggregationFullStack {
+		return nil, nil, 0, fmt.Errorf("unsupported aggregation: %s (expected leaf, cumulative or full_stack)", aggregation)
+	}
+
+	result := make(map[string]int64)
+	samples := make(map[string]int64)
+	events := sampleEventCounter(p, valueIndex)
+	total := int64(0)
+	for i, sample := range p.Sample {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, nil, 0, err
+		}
+		if len(sample.Location) == 0 || len(sample.Value) <= valueIndex {
+			continue
+		}
+		value := sample.Value[valueIndex]
+		stack := sampleStack(sample)
+		if len(stack) == 0 {
+			stack = []string{"unknown"}
+		}
+		total += value
 
-	// 如果没找到特定的，使用第二个值（通常是延迟/空间）
-	if len(p.SampleType) > 1 {
-		return 1, nil
+		var keys []string
+		if aggregation == AggregationFullStack {
+			keys = []string{stackSignature(stack)}
+		} else {
+			// 递归调用时同一函数会在栈上出现多次，每个样本只计一次
+			seen := make(map[string]bool, len(stack))
+			for _, name := range stack {
+				if !seen[name] {
+					seen[name] = true
+					keys = append(keys, name)
+				}
+			}
+		}
+		n := events(sample)
+		for _, key := range keys {
+			result[key] += value
+			samples[key] += n
+		}
 	}
-	return 0, nil
+	return result, samples, total, nil
 }
 
-// aggregateFunctionValues 聚合函数级别的值
-func aggregateFunctionValues(p *profile.Profile, valueIndex int) map[string]int64 {
+// stackSignature 将叶子在前的调用栈连接为 "leaf <- caller <- ... <- root"，截断显示时优先保留叶子帧
+func stackSignature(stack []string) string {
+	return strings.Join(stack, " <- ")
+}
+
+// aggregateFunctionValues 聚合函数级别的值，同时返回每个函数的采样事件数 (见 sampleEventCounter)
+func aggregateFunctionValues(p *profile.Profile, valueIndex int) (map[string]int64, map[string]int64) {
+	result, samples, _ := aggregateFunctionValuesContext(context.Background(), p, valueIndex)
+	return result, samples
+}
+
+// aggregateFunctionValuesContext 与 aggregateFunctionValues 相同，但定期检查 ctx 是否已取消
+func aggregateFunctionValuesContext(ctx context.Context, p *profile.Profile, valueIndex int) (map[string]int64, map[string]int64, error) {
 	result := make(map[string]int64)
+	samples := make(map[string]int64)
+	events := sampleEventCounter(p, valueIndex)
 
-	for _, sample := range p.Sample {
+	for i, sample := range p.Sample {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, nil, err
+		}
 		if len(sample.Location) == 0 || len(sample.Value) <= valueIndex {
 			continue
 		}
@@ -130,24 +462,29 @@ func aggregateFunctionValues(p *profile.Profile, valueIndex int) map[string]int6
 		value := sample.Value[valueIndex]
 
 		// 获取最顶层函数名
-		loc := sample.Location[0]
-		functionName := "unknown"
-		for _, line := range loc.Line {
-			if line.Function != nil {
-				functionName = line.Function.Name
-				break
-			}
-		}
+		functionName := topFunctionName(sample)
 
 		result[functionName] += value
+		samples[functionName] += events(sample)
 	}
 
-	return result
+	return result, samples, nil
 }
 
-// computeFunctionDiffs 计算函数差异
-func computeFunctionDiffs(baselineFuncs, targetFuncs map[string]int64) []FunctionDiff {
+// diffZScore 估计两个样本数之间差异的显著性。
+// 将样本数视为泊松分布，差值的标准差约为 sqrt(n1+n2)；例如 2 个样本对 3 个样本的 z 值只有 0.45。
+func diffZScore(baselineSamples, targetSamples int64) float64 {
+	total := baselineSamples + targetSamples
+	if total == 0 {
+		return 0
+	}
+	return math.Abs(float64(targetSamples-baselineSamples)) / math.Sqrt(float64(total))
+}
+
+// computeFunctionDiffs 计算 filter 允许的函数的差异，同时返回被过滤掉的函数数量
+func computeFunctionDiffs(baselineFuncs, targetFuncs, baselineSamples, targetSamples map[string]int64, filter functionFilter) ([]FunctionDiff, int) {
 	var diffs []FunctionDiff
+	filteredOut := 0
 
 	// 收集所有函数名
 	allFuncs := make(map[string]bool)
@@ -159,6 +496,10 @@ func computeFunctionDiffs(baselineFuncs, targetFuncs map[string]int64) []Functio
 	}
 
 	for name := range allFuncs {
+		if !filter.allows(name) {
+			filteredOut++
+			continue
+		}
 		baselineVal := baselineFuncs[name]
 		targetVal := targetFuncs[name]
 
@@ -170,8 +511,11 @@ func computeFunctionDiffs(baselineFuncs, targetFuncs map[string]int64) []Functio
 			diffPercent = 100.0 // 新增的函数
 		}
 
+		zScore := diffZScore(baselineSamples[name], targetSamples[name])
+
 		diffs = append(diffs, FunctionDiff{
 			FunctionName:      name,
+			FunctionID:        FunctionID(name),
 			BaselineValue:     baselineVal,
 			TargetValue:       targetVal,
 			DiffValue:         diff,
@@ -179,24 +523,18 @@ func computeFunctionDiffs(baselineFuncs, targetFuncs map[string]int64) []Functio
 			BaselineFormatted: formatValue(baselineVal),
 			TargetFormatted:   formatValue(targetVal),
 			DiffFormatted:     formatDiffValue(diff),
+			BaselineSamples:   baselineSamples[name],
+			TargetSamples:     targetSamples[name],
+			ZScore:            zScore,
+			LowConfidence:     diff != 0 && zScore < significanceZThreshold,
 		})
 	}
 
-	return diffs
+	return diffs, filteredOut
 }
 
 // computeDiffSummary 计算总体摘要
-func computeDiffSummary(baselineFuncs, targetFuncs map[string]int64, diffs []FunctionDiff) DiffSummary {
-	baselineTotal := int64(0)
-	targetTotal := int64(0)
-
-	for _, v := range baselineFuncs {
-		baselineTotal += v
-	}
-	for _, v := range targetFuncs {
-		targetTotal += v
-	}
-
+func computeDiffSummary(baselineTotal, targetTotal int64, diffs []FunctionDiff, excludeLowConfidence bool) DiffSummary {
 	totalDiff := targetTotal - baselineTotal
 	totalDiffPercent := 0.0
 	if baselineTotal > 0 {
@@ -207,8 +545,15 @@ func computeDiffSummary(baselineFuncs, targetFuncs map[string]int64, diffs []Fun
 	regressed := 0
 	added := 0
 	removed := 0
+	lowConfidence := 0
 
 	for _, diff := range diffs {
+		if diff.LowConfidence {
+			lowConfidence++
+			if excludeLowConfidence {
+				continue
+			}
+		}
 		if diff.BaselineValue == 0 && diff.TargetValue > 0 {
 			added++
 		} else if diff.TargetValue == 0 && diff.BaselineValue > 0 {
@@ -221,31 +566,45 @@ func computeDiffSummary(baselineFuncs, targetFuncs map[string]int64, diffs []Fun
 	}
 
 	return DiffSummary{
-		BaselineTotal:    baselineTotal,
-		TargetTotal:      targetTotal,
-		TotalDiff:        totalDiff,
-		TotalDiffPercent: totalDiffPercent,
-		ImprovedFuncs:    improved,
-		RegressedFuncs:   regressed,
-		AddedFuncs:       added,
-		RemovedFuncs:     removed,
+		BaselineTotal:         baselineTotal,
+		TargetTotal:           targetTotal,
+		TotalDiff:             totalDiff,
+		TotalDiffPercent:      totalDiffPercent,
+		ImprovedFuncs:         improved,
+		RegressedFuncs:        regressed,
+		AddedFuncs:            added,
+		RemovedFuncs:          removed,
+		LowConfidenceFuncs:    lowConfidence,
+		ExcludedLowConfidence: excludeLowConfidence,
 	}
 }
 
 // formatDiffReport 格式化差异报告
-func formatDiffReport(diffs []FunctionDiff, summary DiffSummary, profileType string, topN int, format string) string {
+func formatDiffReport(diffs []FunctionDiff, summary DiffSummary, verdict *RegressionVerdict, profileType, aggregation string, topN int, format string) string {
 	var b strings.Builder
 
 	if format == "markdown" {
 		b.WriteString(fmt.Sprintf("# Profile 差异分析报告 (%s)\n\n", profileType))
 		b.WriteString("## 总体摘要\n\n")
+		b.WriteString(fmt.Sprintf("- **聚合方式**: %s\n", aggregation))
 		b.WriteString(fmt.Sprintf("- **Baseline 总值**: %s\n", formatValue(summary.BaselineTotal)))
 		b.WriteString(fmt.Sprintf("- **Target 总值**: %s\n", formatValue(summary.TargetTotal)))
 		b.WriteString(fmt.Sprintf("- **总差异**: %s (%.2f%%)\n\n", formatDiffValue(summary.TotalDiff), summary.TotalDiffPercent))
 		b.WriteString(fmt.Sprintf("- **性能提升**: %d 个函数\n", summary.ImprovedFuncs))
 		b.WriteString(fmt.Sprintf("- **性能回归**: %d 个函数\n", summary.RegressedFuncs))
 		b.WriteString(fmt.Sprintf("- **新增函数**: %d 个\n", summary.AddedFuncs))
-		b.WriteString(fmt.Sprintf("- **移除函数**: %d 个\n\n", summary.RemovedFuncs))
+		b.WriteString(fmt.Sprintf("- **移除函数**: %d 个\n", summary.RemovedFuncs))
+		b.WriteString(fmt.Sprintf("- **低置信度差异**: %d 个函数%s\n", summary.LowConfidenceFuncs, lowConfidenceSuffix(summary)))
+		if filter := filterDescription(summary); filter != "" {
+			b.WriteString(fmt.Sprintf("- **函数过滤**: %s\n", filter))
+		}
+		if normalization := normalizationDescription(summary); normalization != "" {
+			b.WriteString(fmt.Sprintf("- **时长归一化**: %s\n", normalization))
+		}
+		if crossMetric := crossMetricDescription(summary); crossMetric != "" {
+			b.WriteString(fmt.Sprintf("- **⚠️ 跨指标比较**: %s\n", crossMetric))
+		}
+		b.WriteString("\n")
 		b.WriteString("## Top 变化函数\n\n")
 		b.WriteString("| 排名 | 函数名 | Baseline | Target | 差异 | 变化%% |\n")
 		b.WriteString("|------|--------|----------|--------|------|-------|\n")
@@ -253,13 +612,25 @@ func formatDiffReport(diffs []FunctionDiff, summary DiffSummary, profileType str
 		b.WriteString(fmt.Sprintf("Profile 差异分析报告 (%s)\n", profileType))
 		b.WriteString("==============================\n\n")
 		b.WriteString("总体摘要:\n")
+		b.WriteString(fmt.Sprintf("  聚合方式:       %s\n", aggregation))
 		b.WriteString(fmt.Sprintf("  Baseline 总值: %s\n", formatValue(summary.BaselineTotal)))
 		b.WriteString(fmt.Sprintf("  Target 总值:   %s\n", formatValue(summary.TargetTotal)))
 		b.WriteString(fmt.Sprintf("  总差异:         %s (%.2f%%)\n\n", formatDiffValue(summary.TotalDiff), summary.TotalDiffPercent))
 		b.WriteString(fmt.Sprintf("  性能提升: %d 个函数\n", summary.ImprovedFuncs))
 		b.WriteString(fmt.Sprintf("  性能回归: %d 个函数\n", summary.RegressedFuncs))
 		b.WriteString(fmt.Sprintf("  新增函数: %d 个\n", summary.AddedFuncs))
-		b.WriteString(fmt.Sprintf("  移除函数: %d 个\n\n", summary.RemovedFuncs))
+		b.WriteString(fmt.Sprintf("  移除函数: %d 个\n", summary.RemovedFuncs))
+		b.WriteString(fmt.Sprintf("  低置信度: %d 个函数%s\n", summary.LowConfidenceFuncs, lowConfidenceSuffix(summary)))
+		if filter := filterDescription(summary); filter != "" {
+			b.WriteString(fmt.Sprintf("  函数过滤: %s\n", filter))
+		}
+		if normalization := normalizationDescription(summary); normalization != "" {
+			b.WriteString(fmt.Sprintf("  时长归一化: %s\n", normalization))
+		}
+		if crossMetric := crossMetricDescription(summary); crossMetric != "" {
+			b.WriteString(fmt.Sprintf("  警告: 跨指标比较，%s\n", crossMetric))
+		}
+		b.WriteString("\n")
 		b.WriteString("Top 变化函数:\n")
 		b.WriteString(strings.Repeat("-", 140) + "\n")
 		b.WriteString(fmt.Sprintf("%-6s %-50s %15s %15s %15s %10s\n",
@@ -284,10 +655,15 @@ func formatDiffReport(diffs []FunctionDiff, summary DiffSummary, profileType str
 				indicator = "❌"
 			}
 
-			b.WriteString(fmt.Sprintf("| %d | %s `%s` | %s | %s | %s | %.2f%% |\n",
+			confidence := ""
+			if diff.LowConfidence {
+				confidence = " ⚠️"
+			}
+
+			b.WriteString(fmt.Sprintf("| %d | %s `%s` | %s | %s | %s | %.2f%%%s |\n",
 				i+1, indicator, truncateString(diff.FunctionName, 40),
 				diff.BaselineFormatted, diff.TargetFormatted,
-				diff.DiffFormatted, diff.DiffPercentage))
+				diff.DiffFormatted, diff.DiffPercentage, confidence))
 		} else {
 			indicator := ""
 			if diff.DiffValue > 0 {
@@ -295,6 +671,9 @@ func formatDiffReport(diffs []FunctionDiff, summary DiffSummary, profileType str
 			} else if diff.DiffValue < 0 {
 				indicator = " ⬇"
 			}
+			if diff.LowConfidence {
+				indicator += " ?"
+			}
 
 			b.WriteString(fmt.Sprintf("%-6d %-50s %15s %15s %15s %9.2f%%%s\n",
 				i+1, truncateString(diff.FunctionName, 50),
@@ -303,11 +682,14 @@ func formatDiffReport(diffs []FunctionDiff, summary DiffSummary, profileType str
 		}
 	}
 
+	writeRegressionVerdict(&b, verdict, format)
+
 	b.WriteString("\n**符号说明**:\n")
 	b.WriteString("- 🔴/⬆ : 性能回归（增加）\n")
 	b.WriteString("- 🟢/⬇ : 性能提升（减少）\n")
 	b.WriteString("- 🆕 : 新增函数\n")
 	b.WriteString("- ❌ : 移除函数\n")
+	b.WriteString("- ⚠️/? : 低置信度（支撑该差异的样本数过少，可能只是噪声）\n")
 
 	if format == "markdown" {
 		b.WriteString("\n```")
@@ -316,6 +698,47 @@ func formatDiffReport(diffs []FunctionDiff, summary DiffSummary, profileType str
 	return b.String()
 }
 
+// lowConfidenceSuffix 返回低置信度统计后的说明文字
+func lowConfidenceSuffix(summary DiffSummary) string {
+	if summary.ExcludedLowConfidence && summary.LowConfidenceFuncs > 0 {
+		return " (已从上述统计中排除)"
+	}
+	return ""
+}
+
+// filterDescription 描述比较时使用的函数过滤条件；没有过滤时返回空字符串
+func filterDescription(summary DiffSummary) string {
+	var parts []string
+	if summary.IncludeRegex != "" {
+		parts = append(parts, fmt.Sprintf("include `%s`", summary.IncludeRegex))
+	}
+	if summary.ExcludeRegex != "" {
+		parts = append(parts, fmt.Sprintf("exclude `%s`", summary.ExcludeRegex))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s，过滤掉 %d 个函数 (总值仍为整个 profile)", strings.Join(parts, ", "), summary.FilteredOutFuncs)
+}
+
+// normalizationDescription 描述 target 如何按采集时长缩放；没有归一化时返回空字符串
+func normalizationDescription(summary DiffSummary) string {
+	if !summary.NormalizedByDuration {
+		return ""
+	}
+	return fmt.Sprintf("target (%s) 的值已缩放到 baseline 的采集时长 (%s)，系数 ×%.3f",
+		formatUnitValue(summary.TargetDurationNanos, "nanoseconds"), formatUnitValue(summary.BaselineDurationNanos, "nanoseconds"), summary.DurationScale)
+}
+
+// crossMetricDescription 返回跨指标比较的警告，两边比较的是同一样本类型时为空
+func crossMetricDescription(summary DiffSummary) string {
+	if !summary.CrossMetric {
+		return ""
+	}
+	return fmt.Sprintf("baseline 的 %s 与 target 的 %s 是不同的指标，差异只是近似结果",
+		summary.BaselineValueType, summary.TargetValueType)
+}
+
 // formatValue 格式化值
 func formatValue(value int64) string {
 	if value < 1024 {
@@ -1,6 +1,11 @@
 package analyzer
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/google/pprof/profile"
@@ -251,3 +256,559 @@ func TestCompareProfilesRemovedFunctions(t *testing.T) {
 		t.Errorf("Expected to contain old function name, got:\n%s", result)
 	}
 }
+
+// TestCompareProfilesSignificance 测试基于样本数的显著性估计
+func TestCompareProfilesSignificance(t *testing.T) {
+	noisy := &profile.Function{Name: "main.noisy"}
+	steady := &profile.Function{Name: "main.steady"}
+	newProfile := func(noisySamples, steadySamples int) *profile.Profile {
+		p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}}}
+		for i := 0; i < noisySamples; i++ {
+			p.Sample = append(p.Sample, &profile.Sample{
+				Value:    []int64{10000000},
+				Location: []*profile.Location{{Line: []profile.Line{{Function: noisy}}}},
+			})
+		}
+		for i := 0; i < steadySamples; i++ {
+			p.Sample = append(p.Sample, &profile.Sample{
+				Value:    []int64{10000000},
+				Location: []*profile.Location{{Line: []profile.Line{{Function: steady}}}},
+			})
+		}
+		return p
+	}
+
+	// main.noisy: 2 -> 3 个样本 (+50%，但不显著)；main.steady: 100 -> 150 个样本 (+50%，显著)
+	baseline := newProfile(2, 100)
+	target := newProfile(3, 150)
+
+	result, err := CompareProfiles(baseline, target, "cpu", 10, "json")
+	if err != nil {
+		t.Fatalf("CompareProfiles() error = %v", err)
+	}
+	for _, want := range []string{`"baselineSamples": 2`, `"targetSamples": 150`, `"lowConfidenceFuncs": 1`, `"regressedFuncs": 2`} {
+		if !containsString(result, want) {
+			t.Errorf("Result does not contain expected string %q\nGot:\n%s", want, result)
+		}
+	}
+
+	result, err = CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "text", ExcludeLowConfidence: true})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions() error = %v", err)
+	}
+	for _, want := range []string{"性能回归: 1 个函数", "低置信度: 1 个函数 (已从上述统计中排除)", "⬆ ?"} {
+		if !containsString(result, want) {
+			t.Errorf("Result does not contain expected string %q\nGot:\n%s", want, result)
+		}
+	}
+	// benchstat 格式：显著的变化显示百分比，不显著的显示 "~"
+	result, err = CompareProfiles(baseline, target, "cpu", 10, "benchstat")
+	if err != nil {
+		t.Fatalf("CompareProfiles() error = %v", err)
+	}
+	for _, want := range []string{"name", "old cpu/nanoseconds", "new cpu/nanoseconds", "delta", "+50.00%  (p=0.002 n=100+150)", "~  (p=0.655 n=2+3)", "±10%", "[Total]"} {
+		if !containsString(result, want) {
+			t.Errorf("Benchstat result does not contain expected string %q\nGot:\n%s", want, result)
+		}
+	}
+}
+
+// TestCompareProfilesAggregatedSamples 测试显著性检验的样本数按采样事件计算，而不是按 Sample 记录计算：
+// 真实的 profile 把调用栈相同的采样合并为一个 Sample，样本数取自 count 列，没有 count 列时取值除以 Period
+func TestCompareProfilesAggregatedSamples(t *testing.T) {
+	hot := &profile.Function{Name: "main.hot"}
+	loc := &profile.Location{Line: []profile.Line{{Function: hot}}}
+	second := int64(1000000000)
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	tests := []struct {
+		name        string
+		newProfile  func(samples int64) *profile.Profile
+		wantSamples [2]int64
+	}{
+		{
+			name: "samples column",
+			newProfile: func(samples int64) *profile.Profile {
+				return &profile.Profile{
+					SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, cpuType},
+					PeriodType: cpuType, Period: 10000000,
+					Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{samples, samples * 10000000}}},
+				}
+			},
+			wantSamples: [2]int64{1000, 2000},
+		},
+		{
+			name: "value over period",
+			newProfile: func(samples int64) *profile.Profile {
+				return &profile.Profile{
+					SampleType: []*profile.ValueType{cpuType},
+					PeriodType: cpuType, Period: 10000000,
+					Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{samples * 10000000}}},
+				}
+			},
+			wantSamples: [2]int64{1000, 2000},
+		},
+		{
+			name: "matching objects column",
+			newProfile: func(samples int64) *profile.Profile {
+				return &profile.Profile{
+					SampleType: []*profile.ValueType{
+						{Type: "alloc_objects", Unit: "count"}, {Type: "alloc_space", Unit: "bytes"},
+						{Type: "inuse_objects", Unit: "count"}, {Type: "inuse_space", Unit: "bytes"},
+					},
+					Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1, 1024, samples, samples * 1024}}},
+				}
+			},
+			wantSamples: [2]int64{1000, 2000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, _, _, err := computeProfileDiff(context.Background(), tt.newProfile(1000), tt.newProfile(2000), "", AggregationLeaf, CompareOptions{})
+			if err != nil {
+				t.Fatalf("computeProfileDiff() error = %v", err)
+			}
+			if len(diffs) != 1 {
+				t.Fatalf("Expected one function diff, got %+v", diffs)
+			}
+			d := diffs[0]
+			if d.BaselineSamples != tt.wantSamples[0] || d.TargetSamples != tt.wantSamples[1] {
+				t.Errorf("samples = %d+%d, want %d+%d", d.BaselineSamples, d.TargetSamples, tt.wantSamples[0], tt.wantSamples[1])
+			}
+			if d.LowConfidence || d.ZScore < 10 {
+				t.Errorf("A 2x regression over 1000 samples should be significant, got zScore=%.2f lowConfidence=%v", d.ZScore, d.LowConfidence)
+			}
+		})
+	}
+
+	// 没有 count 列、也没有可用的 Period 时仍按非零 Sample 记录计数
+	noPeriod := func(value int64) *profile.Profile {
+		return &profile.Profile{SampleType: []*profile.ValueType{cpuType}, Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{value}}}}
+	}
+	diffs, _, _, err := computeProfileDiff(context.Background(), noPeriod(10*second), noPeriod(20*second), "", AggregationCumulative, CompareOptions{})
+	if err != nil {
+		t.Fatalf("computeProfileDiff(no period) error = %v", err)
+	}
+	if d := diffs[0]; d.BaselineSamples != 1 || d.TargetSamples != 1 || !d.LowConfidence {
+		t.Errorf("Without a count column or period, expected one sample per record and low confidence, got %+v", d)
+	}
+}
+
+// TestBenchstatAggregatedSamples 测试 benchstat 格式的 n 和 ± 来自采样事件数：
+// 调用栈相同的 1000 个采样合并为一个 Sample 时显示 n=1000+2000 和 ±3%，而不是 n=1+1 和 ±100%
+func TestBenchstatAggregatedSamples(t *testing.T) {
+	hot := &profile.Function{Name: "main.hot"}
+	loc := &profile.Location{Line: []profile.Line{{Function: hot}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	newProfile := func(samples int64) *profile.Profile {
+		return &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, cpuType},
+			PeriodType: cpuType, Period: 10000000,
+			Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{samples, samples * 10000000}}},
+		}
+	}
+
+	result, err := CompareProfilesWithOptions(newProfile(1000), newProfile(2000), "cpu", CompareOptions{TopN: 10, Format: "benchstat", ValueType: "cpu"})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions(benchstat) error = %v", err)
+	}
+	for _, want := range []string{"10.00s ±3%", "20.00s ±2%", "+100.00%  (p=0.000 n=1000+2000)"} {
+		if !containsString(result, want) {
+			t.Errorf("Benchstat result does not contain expected string %q\nGot:\n%s", want, result)
+		}
+	}
+	for _, unwanted := range []string{"±100%", "n=1+1", "~  ("} {
+		if containsString(result, unwanted) {
+			t.Errorf("Benchstat result should not contain %q\nGot:\n%s", unwanted, result)
+		}
+	}
+}
+
+// TestCompareProfilesAggregation 测试 leaf、cumulative、full_stack 三种聚合方式
+func TestCompareProfilesAggregation(t *testing.T) {
+	work := &profile.Function{Name: "main.work"}
+	callerA := &profile.Function{Name: "main.a"}
+	callerB := &profile.Function{Name: "main.b"}
+	stack := func(value int64, funcs ...*profile.Function) *profile.Sample {
+		s := &profile.Sample{Value: []int64{value}}
+		for _, f := range funcs {
+			s.Location = append(s.Location, &profile.Location{Line: []profile.Line{{Function: f}}})
+		}
+		return s
+	}
+	newProfile := func(samples ...*profile.Sample) *profile.Profile {
+		return &profile.Profile{SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}}, Sample: samples}
+	}
+
+	// main.work 的总值不变，但调用路径从 main.b 全部转移到了 main.a；
+	// 最后一个样本递归调用 main.a，cumulative 方式下每个样本只计一次
+	baseline := newProfile(stack(100, work, callerA), stack(100, work, callerB), stack(10, callerA, callerA))
+	target := newProfile(stack(200, work, callerA), stack(10, callerA, callerA))
+
+	compare := func(aggregation string) DiffResult {
+		t.Helper()
+		out, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "json", Aggregation: aggregation})
+		if err != nil {
+			t.Fatalf("CompareProfilesWithOptions(%s) error = %v", aggregation, err)
+		}
+		var result DiffResult
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatalf("Failed to unmarshal result: %v", err)
+		}
+		return result
+	}
+	values := func(r DiffResult) map[string][2]int64 {
+		m := make(map[string][2]int64)
+		for _, f := range r.Functions {
+			m[f.FunctionName] = [2]int64{f.BaselineValue, f.TargetValue}
+		}
+		return m
+	}
+
+	leaf := compare("")
+	if leaf.Aggregation != AggregationLeaf {
+		t.Errorf("Default aggregation = %q, want leaf", leaf.Aggregation)
+	}
+	if got := values(leaf)["main.work"]; got != [2]int64{200, 200} {
+		t.Errorf("leaf main.work = %v, want [200 200]", got)
+	}
+	if leaf.Summary.RegressedFuncs != 0 || leaf.Summary.RemovedFuncs != 0 {
+		t.Errorf("leaf summary = %+v, want no regressed or removed functions", leaf.Summary)
+	}
+
+	cumulative := compare(AggregationCumulative)
+	got := values(cumulative)
+	if got["main.a"] != [2]int64{110, 210} || got["main.b"] != [2]int64{100, 0} || got["main.work"] != [2]int64{200, 200} {
+		t.Errorf("Unexpected cumulative values: %v", got)
+	}
+	if cumulative.Summary.BaselineTotal != 210 || cumulative.Summary.TargetTotal != 210 {
+		t.Errorf("cumulative totals = %d/%d, want 210/210", cumulative.Summary.BaselineTotal, cumulative.Summary.TargetTotal)
+	}
+	if cumulative.Summary.RegressedFuncs != 1 || cumulative.Summary.RemovedFuncs != 1 {
+		t.Errorf("cumulative summary = %+v, want 1 regressed and 1 removed", cumulative.Summary)
+	}
+
+	fullStack := compare(AggregationFullStack)
+	got = values(fullStack)
+	if got["main.work <- main.a"] != [2]int64{100, 200} || got["main.work <- main.b"] != [2]int64{100, 0} {
+		t.Errorf("Unexpected full_stack values: %v", got)
+	}
+	if fullStack.Summary.RegressedFuncs != 1 || fullStack.Summary.RemovedFuncs != 1 {
+		t.Errorf("full_stack summary = %+v, want 1 regressed and 1 removed", fullStack.Summary)
+	}
+
+	text, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "text", Aggregation: AggregationFullStack})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions() error = %v", err)
+	}
+	if !containsString(text, "聚合方式:       full_stack") {
+		t.Errorf("Text report does not mention the aggregation\nGot:\n%s", text)
+	}
+
+	if _, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{Aggregation: "caller"}); err == nil {
+		t.Error("Expected error for unsupported aggregation")
+	}
+}
+
+// TestCompareProfilesValueType 测试显式指定比较的样本类型
+func TestCompareProfilesValueType(t *testing.T) {
+	loc := &profile.Location{Line: []profile.Line{{Function: &profile.Function{Name: "main.alloc"}}}}
+	newHeap := func(types []string, values ...int64) *profile.Profile {
+		p := &profile.Profile{Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: values}}}
+		for _, typ := range types {
+			p.SampleType = append(p.SampleType, &profile.ValueType{Type: typ, Unit: "bytes"})
+		}
+		return p
+	}
+	full := []string{"alloc_space", "inuse_space"}
+	baseline := newHeap(full, 1000, 100)
+	target := newHeap(full, 3000, 150)
+
+	out, err := CompareProfilesWithOptions(baseline, target, "heap", CompareOptions{TopN: 5, Format: "json", ValueType: "alloc_space"})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions() error = %v", err)
+	}
+	var result DiffResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.ValueType != "alloc_space" || result.Summary.TotalDiff != 2000 {
+		t.Errorf("Expected alloc_space diff of 2000, got %s %d", result.ValueType, result.Summary.TotalDiff)
+	}
+
+	// 目标 profile 缺少指定的样本类型时应报错，而不是按位置改用其它列
+	inuseOnly := newHeap([]string{"inuse_space"}, 150)
+	if _, err := CompareProfilesWithOptions(baseline, inuseOnly, "heap", CompareOptions{Format: "json", ValueType: "alloc_space"}); err == nil || !containsString(err.Error(), "target") {
+		t.Errorf("Expected missing value type error for target, got %v", err)
+	}
+
+	// 跨指标比较：baseline 的 alloc_space 对 target 的 inuse_space，报告中给出近似结果的警告
+	allocsOnly := newHeap([]string{"alloc_space"}, 1000)
+	crossOpts := CompareOptions{TopN: 5, Format: "json", BaselineValueType: "alloc_space", TargetValueType: "inuse_space"}
+	out, err = CompareProfilesWithOptions(allocsOnly, inuseOnly, "heap", crossOpts)
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions(cross-metric) error = %v", err)
+	}
+	result = DiffResult{}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if !result.Summary.CrossMetric || result.Summary.BaselineValueType != "alloc_space" || result.Summary.TargetValueType != "inuse_space" || result.Summary.TotalDiff != -850 {
+		t.Errorf("Unexpected cross-metric summary: %+v", result.Summary)
+	}
+	crossOpts.Format = "text"
+	if text, _ := CompareProfilesWithOptions(allocsOnly, inuseOnly, "heap", crossOpts); !containsString(text, "跨指标比较") {
+		t.Errorf("Expected a cross-metric warning in text output:\n%s", text)
+	}
+	// 同一类型的比较不标记为跨指标
+	crossOpts.Format, crossOpts.TargetValueType = "json", "alloc_space"
+	out, _ = CompareProfilesWithOptions(allocsOnly, baseline, "heap", crossOpts)
+	if containsString(out, "crossMetric") {
+		t.Errorf("Same value type should not be marked as cross-metric:\n%s", out)
+	}
+	// 任意一边找不到指定的类型、或两边单位不同时报错
+	crossOpts.TargetValueType = "inuse_objects"
+	if _, err := CompareProfilesWithOptions(allocsOnly, inuseOnly, "heap", crossOpts); err == nil || !containsString(err.Error(), "target") {
+		t.Errorf("Expected missing value type error for target, got %v", err)
+	}
+	objects := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "inuse_objects", Unit: "count"}},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{3}}},
+	}
+	if _, err := CompareProfilesWithOptions(allocsOnly, objects, "heap", crossOpts); err == nil || !containsString(err.Error(), "bytes vs inuse_objects/count") {
+		t.Errorf("Expected unit mismatch error, got %v", err)
+	}
+}
+
+// TestCompareProfilesFunctionFilter 测试 Include/Exclude 过滤参与比较的函数，摘要中的函数统计只包含过滤后的函数
+func TestCompareProfilesFunctionFilter(t *testing.T) {
+	newCPU := func(values map[string]int64) *profile.Profile {
+		p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}}}
+		for name, v := range values {
+			loc := &profile.Location{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}
+			p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{v}})
+		}
+		return p
+	}
+	baseline := newCPU(map[string]int64{"myapp/api.Handle": 100, "myapp/internal.Debug": 50, "runtime.mallocgc": 100})
+	target := newCPU(map[string]int64{"myapp/api.Handle": 300, "myapp/internal.Debug": 80, "runtime.mallocgc": 400})
+
+	out, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{
+		TopN:    10,
+		Format:  "json",
+		Include: regexp.MustCompile(`^myapp/`),
+		Exclude: regexp.MustCompile(`internal`), // 与 include 冲突时 exclude 优先
+	})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions() error = %v", err)
+	}
+	var result DiffResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(result.Functions) != 1 || result.Functions[0].FunctionName != "myapp/api.Handle" {
+		t.Fatalf("Expected only myapp/api.Handle after filtering, got %+v", result.Functions)
+	}
+	s := result.Summary
+	if s.RegressedFuncs != 1 || s.FilteredOutFuncs != 2 {
+		t.Errorf("Expected 1 regressed and 2 filtered-out functions, got %d and %d", s.RegressedFuncs, s.FilteredOutFuncs)
+	}
+	if s.IncludeRegex != "^myapp/" || s.ExcludeRegex != "internal" {
+		t.Errorf("Expected the filter patterns in the summary, got include=%q exclude=%q", s.IncludeRegex, s.ExcludeRegex)
+	}
+
+	text, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "markdown", Exclude: regexp.MustCompile(`^runtime\.`)})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions(markdown) error = %v", err)
+	}
+	if containsString(text, "runtime.mallocgc") || !containsString(text, "- **函数过滤**: exclude `^runtime\\.`，过滤掉 1 个函数") {
+		t.Errorf("Expected runtime functions to be excluded and the filter described, got:\n%s", text)
+	}
+}
+
+// TestCompareProfilesSortBy 测试 SortBy 按百分比绝对值、变化量绝对值或带符号的变化量排序差异
+func TestCompareProfilesSortBy(t *testing.T) {
+	baseline := newCPUProfile(map[string]int64{"main.tiny": 10, "main.big": 10000, "main.shrunk": 8000})
+	target := newCPUProfile(map[string]int64{"main.tiny": 40, "main.big": 13000, "main.shrunk": 2000})
+
+	for sortBy, want := range map[string][]string{
+		"":                 {"main.tiny", "main.shrunk", "main.big"}, // +300%, -75%, +30%
+		DiffSortAbsPercent: {"main.tiny", "main.shrunk", "main.big"},
+		DiffSortAbsValue:   {"main.shrunk", "main.big", "main.tiny"}, // -6000, +3000, +30
+		DiffSortValue:      {"main.big", "main.tiny", "main.shrunk"}, // +3000, +30, -6000
+	} {
+		out, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "json", SortBy: sortBy})
+		if err != nil {
+			t.Fatalf("CompareProfilesWithOptions(%q) error = %v", sortBy, err)
+		}
+		var result DiffResult
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		var got []string
+		for _, fn := range result.Functions {
+			got = append(got, fn.FunctionName)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("sort_by=%q: order = %v, want %v", sortBy, got, want)
+		}
+	}
+
+	if _, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "json", SortBy: "percent"}); err == nil || !containsString(err.Error(), "abs_percent, abs_value, value") {
+		t.Errorf("Expected an error listing the valid sort keys, got %v", err)
+	}
+}
+
+// TestCompareProfilesNormalizeByDuration 测试按采集时长归一化后，采集时间更长但速率相同的 target 不会被判定为回归
+func TestCompareProfilesNormalizeByDuration(t *testing.T) {
+	newCPU := func(duration int64, values map[string]int64) *profile.Profile {
+		p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}}, DurationNanos: duration}
+		for name, v := range values {
+			loc := &profile.Location{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}
+			for i := int64(0); i < v; i++ {
+				p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{10000000}})
+			}
+		}
+		return p
+	}
+	// target 采集时长是 baseline 的两倍，main.work 的速率不变，main.slow 的速率翻倍
+	baseline := newCPU(10e9, map[string]int64{"main.work": 100, "main.slow": 50})
+	target := newCPU(20e9, map[string]int64{"main.work": 200, "main.slow": 200})
+
+	out, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "json"})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions() error = %v", err)
+	}
+	var raw DiffResult
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if raw.Summary.RegressedFuncs != 2 || raw.Summary.NormalizedByDuration {
+		t.Errorf("Without normalization both functions should regress, got %+v", raw.Summary)
+	}
+
+	out, err = CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "json", NormalizeByDuration: true})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions(normalized) error = %v", err)
+	}
+	var result DiffResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	s := result.Summary
+	if !s.NormalizedByDuration || s.DurationScale != 0.5 || s.TargetTotal != s.BaselineTotal+500000000 {
+		t.Errorf("Unexpected normalized summary: %+v", s)
+	}
+	if s.RegressedFuncs != 1 {
+		t.Errorf("Expected only main.slow to regress after normalization, got %d regressed", s.RegressedFuncs)
+	}
+	for _, d := range result.Functions {
+		if d.FunctionName == "main.work" && d.DiffValue != 0 {
+			t.Errorf("main.work has the same rate and should not change, got diff %d", d.DiffValue)
+		}
+	}
+
+	text, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "text", NormalizeByDuration: true})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions(text) error = %v", err)
+	}
+	if !containsString(text, "时长归一化: target (20.00s) 的值已缩放到 baseline 的采集时长 (10.00s)，系数 ×0.500") {
+		t.Errorf("Expected the normalization to be described, got:\n%s", text)
+	}
+
+	baseline.DurationNanos = 0
+	if _, err := CompareProfilesWithOptions(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "json", NormalizeByDuration: true}); err == nil {
+		t.Error("Expected an error when a profile has no duration")
+	}
+}
+
+// TestCompareProfilesRegressionVerdict 测试单函数阈值和总量阈值的回归判定相互独立
+func TestCompareProfilesRegressionVerdict(t *testing.T) {
+	newCPU := func(values map[string]int64) *profile.Profile {
+		p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}}}
+		for name, v := range values {
+			loc := &profile.Location{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}
+			for i := int64(0); i < v; i++ {
+				p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{10000000}})
+			}
+		}
+		return p
+	}
+	// main.work 增长 5%，main.slow 增长 100%，总值增长约 36.67%
+	baseline := newCPU(map[string]int64{"main.work": 100, "main.slow": 50})
+	target := newCPU(map[string]int64{"main.work": 105, "main.slow": 100})
+
+	_, verdict, err := CompareProfilesWithVerdict(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "text"})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithVerdict() error = %v", err)
+	}
+	if verdict != nil {
+		t.Errorf("Expected no verdict without thresholds, got %+v", verdict)
+	}
+
+	out, verdict, err := CompareProfilesWithVerdict(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "json", RegressionThresholdPercent: 10})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithVerdict(per-function) error = %v", err)
+	}
+	if verdict == nil || !verdict.HasRegression || verdict.TotalRegressed {
+		t.Fatalf("Expected a per-function regression only, got %+v", verdict)
+	}
+	if len(verdict.RegressedFunctions) != 1 || verdict.RegressedFunctions[0].FunctionName != "main.slow" {
+		t.Errorf("Expected only main.slow over the 10%% threshold, got %+v", verdict.RegressedFunctions)
+	}
+	var result DiffResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.Verdict == nil || !result.Verdict.HasRegression {
+		t.Errorf("Expected verdict.hasRegression in the JSON output, got %+v", result.Verdict)
+	}
+
+	// 总量阈值单独生效：没有函数超过 200%，但总值增长超过 30%
+	text, verdict, err := CompareProfilesWithVerdict(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "text", RegressionThresholdPercent: 200, TotalRegressionThresholdPercent: 30})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithVerdict(total) error = %v", err)
+	}
+	if !verdict.HasRegression || !verdict.TotalRegressed || len(verdict.RegressedFunctions) != 0 {
+		t.Errorf("Expected only the total gate to trip, got %+v", verdict)
+	}
+	if !containsString(text, "回归判定: 存在回归") || !containsString(text, "总量阈值 30.00%") {
+		t.Errorf("Expected the verdict in the text report, got:\n%s", text)
+	}
+
+	_, verdict, err = CompareProfilesWithVerdict(baseline, target, "cpu", CompareOptions{TopN: 10, Format: "markdown", RegressionThresholdPercent: 200, TotalRegressionThresholdPercent: 50})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithVerdict(no regression) error = %v", err)
+	}
+	if verdict.HasRegression {
+		t.Errorf("Expected no regression under both thresholds, got %+v", verdict)
+	}
+}
+
+// TestCompareProfilesContextCanceled 测试 ctx 被取消时比较立即停止，并返回可以用 errors.Is 识别的取消错误
+func TestCompareProfilesContextCanceled(t *testing.T) {
+	newCPU := func(n int) *profile.Profile {
+		p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}}}
+		loc := &profile.Location{Line: []profile.Line{{Function: &profile.Function{Name: "main.work"}}}}
+		for i := 0; i < n; i++ {
+			p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{10000000}})
+		}
+		return p
+	}
+	baseline, target := newCPU(10), newCPU(20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, aggregation := range []string{AggregationLeaf, AggregationCumulative} {
+		_, _, err := CompareProfilesContext(ctx, baseline, target, "cpu", CompareOptions{TopN: 10, Format: "text", Aggregation: aggregation})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected a context.Canceled error, got %v", aggregation, err)
+		}
+	}
+	if _, err := CompareProfilesBatchContext(ctx, baseline, []*profile.Profile{target}, []string{"t1"}, "cpu", CompareOptions{Format: "text"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("batch: expected a context.Canceled error, got %v", err)
+	}
+
+	if _, _, err := CompareProfilesContext(context.Background(), baseline, target, "cpu", CompareOptions{TopN: 10, Format: "text"}); err != nil {
+		t.Errorf("CompareProfilesContext() with a live context error = %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package analyzer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// 内置 SVG 火焰图的布局参数
+const (
+	svgWidth       = 1200.0
+	svgFrameHeight = 16.0
+	svgPadding     = 10.0
+	svgTitleHeight = 30.0
+	svgFontSize    = 12.0
+	svgCharWidth   = 7.0 // 等宽字体下每个字符的近似宽度，用于截断函数名
+	svgMinWidth    = 0.1 // 宽度小于该值的帧不绘制
+)
+
+// svgFrame 是由折叠调用栈构建的火焰图节点
+type svgFrame struct {
+	name     string
+	value    int64
+	children map[string]*svgFrame
+}
+
+// RenderFlameGraphSVG 使用纯 Go 实现将 profile 渲染为 SVG 火焰图，不依赖 Graphviz。
+// 调用栈先折叠为 "root;caller;...;leaf" 形式，再按函数名排序布局，
+// 因此相同的 profile 总是生成完全相同的 SVG，便于复现和比较。
+func RenderFlameGraphSVG(p *profile.Profile, profileType string) ([]byte, error) {
+	valueIndex, err := flameGraphValueIndex(p, profileType)
+	if err != nil {
+		return nil, err
+	}
+	sampleType := p.SampleType[valueIndex]
+	logDebug("Rendering builtin flamegraph: type=%s, sample type=%s/%s", profileType, sampleType.Type, sampleType.Unit)
+
+	folded := FoldStacks(p, valueIndex)
+	root := &svgFrame{name: "all", children: make(map[string]*svgFrame)}
+	maxDepth := 0
+	for stack, value := range folded {
+		if value <= 0 {
+			continue
+		}
+		root.value += value
+		node := root
+		frames := strings.Split(stack, ";")
+		for _, name := range frames {
+			child, ok := node.children[name]
+			if !ok {
+				child = &svgFrame{name: name, children: make(map[string]*svgFrame)}
+				node.children[name] = child
+			}
+			child.value += value
+			node = child
+		}
+		if len(frames) > maxDepth {
+			maxDepth = len(frames)
+		}
+	}
+	if root.value == 0 {
+		return nil, fmt.Errorf("profile 中没有 %s 值大于零的样本，无法生成火焰图", sampleType.Type)
+	}
+
+	height := svgTitleHeight + float64(maxDepth+1)*svgFrameHeight + 2*svgPadding
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	b.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`+"\n",
+		svgWidth, height, svgWidth, height))
+	b.WriteString(fmt.Sprintf(`<style>text { font-family: monospace; font-size: %.0fpx; fill: #000; } rect { stroke: #fff; stroke-width: 0.5; }</style>`+"\n", svgFontSize))
+	b.WriteString(fmt.Sprintf(`<rect x="0" y="0" width="%.0f" height="%.0f" fill="#f8f8f8"/>`+"\n", svgWidth, height))
+	b.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" text-anchor="middle" style="font-size: 16px">%s</text>`+"\n",
+		svgWidth/2, svgPadding+svgFontSize+4, html.EscapeString(fmt.Sprintf("%s flame graph (%s/%s, total %s)",
+			profileType, sampleType.Type, sampleType.Unit, formatUnitValue(root.value, sampleType.Unit)))))
+
+	scale := (svgWidth - 2*svgPadding) / float64(root.value)
+	bottom := height - svgPadding - svgFrameHeight
+	writeSVGFrame(&b, root, root.value, sampleType.Unit, svgPadding, bottom, scale)
+	b.WriteString("</svg>\n")
+	return []byte(b.String()), nil
+}
+
+// writeSVGFrame 绘制一个帧及其所有子帧；火焰图中调用者在下、被调用者在上，子帧按函数名排序
+func writeSVGFrame(b *strings.Builder, f *svgFrame, total int64, unit string, x, y, scale float64) {
+	width := float64(f.value) * scale
+	if width < svgMinWidth {
+		return
+	}
+
+	title := fmt.Sprintf("%s (%s, %.2f%%)", f.name, formatUnitValue(f.value, unit), float64(f.value)/float64(total)*100)
+	b.WriteString("<g>\n")
+	b.WriteString(fmt.Sprintf("<title>%s</title>\n", html.EscapeString(title)))
+	b.WriteString(fmt.Sprintf(`<rect x="%.2f" y="%.1f" width="%.2f" height="%.1f" fill="%s"/>`+"\n",
+		x, y, width, svgFrameHeight, frameColor(f.name)))
+	if maxChars := int((width - 6) / svgCharWidth); maxChars >= 3 {
+		// 按字符截断，避免把中文等多字节函数名截成无效的 UTF-8
+		label := f.name
+		if runes := []rune(label); len(runes) > maxChars {
+			label = string(runes[:maxChars-2]) + ".."
+		}
+		b.WriteString(fmt.Sprintf(`<text x="%.2f" y="%.1f">%s</text>`+"\n", x+3, y+svgFrameHeight-4, html.EscapeString(label)))
+	}
+	b.WriteString("</g>\n")
+
+	names := make([]string, 0, len(f.children))
+	for name := range f.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	childX := x
+	for _, name := range names {
+		child := f.children[name]
+		writeSVGFrame(b, child, total, unit, childX, y-svgFrameHeight, scale)
+		childX += float64(child.value) * scale
+	}
+}
+
+// frameColor 根据函数名的哈希选取暖色调，使同一函数在不同次渲染中颜色一致
+func frameColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	r := 205 + v%50
+	g := (v >> 8) % 230
+	bl := (v >> 16) % 55
+	return fmt.Sprintf("rgb(%d,%d,%d)", r, g, bl)
+}
+
+// FoldStacks 将 profile 折叠为 "root;caller;...;leaf" 形式的调用栈及其累计值 (包括内联帧)
+func FoldStacks(p *profile.Profile, valueIndex int) map[string]int64 {
+	folded := make(map[string]int64)
+	for _, s := range p.Sample {
+		if len(s.Value) <= valueIndex {
+			continue
+		}
+		stack := sampleStack(s)
+		if len(stack) == 0 {
+			continue
+		}
+		frames := make([]string, len(stack))
+		for i, name := range stack {
+			frames[len(stack)-1-i] = name
+		}
+		folded[strings.Join(frames, ";")] += s.Value[valueIndex]
+	}
+	return folded
+}
+
+// RenderFoldedStacks 将 profile 输出为 Brendan Gregg 的折叠调用栈格式，每行 "root;caller;leaf <value>"，
+// 可直接交给 flamegraph.pl 等工具渲染。输出按调用栈排序，值不大于 0 的调用栈会被跳过。
+func RenderFoldedStacks(p *profile.Profile, profileType string) (string, error) {
+	valueIndex, err := flameGraphValueIndex(p, profileType)
+	if err != nil {
+		return "", err
+	}
+	folded := FoldStacks(p, valueIndex)
+	stacks := make([]string, 0, len(folded))
+	for stack, value := range folded {
+		if value > 0 {
+			stacks = append(stacks, stack)
+		}
+	}
+	sort.Strings(stacks)
+
+	var b strings.Builder
+	for _, stack := range stacks {
+		b.WriteString(fmt.Sprintf("%s %d\n", stack, folded[stack]))
+	}
+	return b.String(), nil
+}
+
+// flameGraphValueIndex 选择火焰图使用的样本类型索引，与 generate_flamegraph 支持的类型一致
+func flameGraphValueIndex(p *profile.Profile, profileType string) (int, error) {
+	if profileType == "heap_growth" {
+		if i := findSampleTypeIndex(p, GrowthSampleType); i >= 0 {
+			return i, nil
+		}
+		return 0, fmt.Errorf("profile 中没有 %s 样本类型，请使用 export_heap_growth_profile 生成的文件", GrowthSampleType)
+	}
+	return metricValueIndex(p, profileType)
+}
@@ -0,0 +1,90 @@
+package analyzer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestRenderFlameGraphSVG 测试内置 SVG 火焰图渲染及输出的确定性
+func TestRenderFlameGraphSVG(t *testing.T) {
+	p := newCPUProfile(map[string]int64{"main.work": 300, "main.idle": 100})
+
+	svg, err := RenderFlameGraphSVG(p, "cpu")
+	if err != nil {
+		t.Fatalf("RenderFlameGraphSVG() error = %v", err)
+	}
+	out := string(svg)
+	if !strings.HasPrefix(out, "<?xml") || !strings.HasSuffix(out, "</svg>\n") {
+		t.Error("Expected a complete SVG document")
+	}
+	for _, want := range []string{"<title>main.work", "<title>main.idle", "<title>all", "75.00%"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected SVG to contain %q", want)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		again, err := RenderFlameGraphSVG(p, "cpu")
+		if err != nil {
+			t.Fatalf("RenderFlameGraphSVG() error = %v", err)
+		}
+		if !bytes.Equal(svg, again) {
+			t.Fatal("Expected identical SVG output for the same profile")
+		}
+	}
+
+	empty := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}}}
+	if _, err := RenderFlameGraphSVG(empty, "cpu"); err == nil {
+		t.Error("Expected error for profile without samples, got nil")
+	}
+}
+
+// TestRenderFlameGraphSVGTruncatesRunes 测试帧宽度不足时按字符截断标签，多字节函数名不会产生无效的 UTF-8
+func TestRenderFlameGraphSVGTruncatesRunes(t *testing.T) {
+	name := "main." + strings.Repeat("处理请求", 100)
+	p := newCPUProfile(map[string]int64{name: 100})
+
+	svg, err := RenderFlameGraphSVG(p, "cpu")
+	if err != nil {
+		t.Fatalf("RenderFlameGraphSVG() error = %v", err)
+	}
+	if !utf8.Valid(svg) {
+		t.Fatal("Expected the SVG to be valid UTF-8")
+	}
+	if !strings.Contains(string(svg), "..</text>") {
+		t.Error("Expected the long label to be truncated on a character boundary with \"..\"")
+	}
+}
+
+// TestFoldStacks 测试调用栈折叠
+func TestFoldStacks(t *testing.T) {
+	fnMain := &profile.Function{ID: 1, Name: "main.main"}
+	fnWork := &profile.Function{ID: 2, Name: "main.work"}
+	locMain := &profile.Location{ID: 1, Line: []profile.Line{{Function: fnMain}}}
+	locWork := &profile.Location{ID: 2, Line: []profile.Line{{Function: fnWork}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{locWork, locMain}, Value: []int64{10}},
+			{Location: []*profile.Location{locWork, locMain}, Value: []int64{5}},
+			{Location: []*profile.Location{locMain}, Value: []int64{2}},
+		},
+	}
+
+	folded := FoldStacks(p, 0)
+	if folded["main.main;main.work"] != 15 || folded["main.main"] != 2 || len(folded) != 2 {
+		t.Errorf("Unexpected folded stacks: %v", folded)
+	}
+
+	text, err := RenderFoldedStacks(p, "cpu")
+	if err != nil {
+		t.Fatalf("RenderFoldedStacks() error = %v", err)
+	}
+	if want := "main.main 2\nmain.main;main.work 15\n"; text != want {
+		t.Errorf("RenderFoldedStacks() = %q, want %q", text, want)
+	}
+}
@@ -0,0 +1,239 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	// passthroughMinRatio 是判定 "透传" 函数所需的 cumulative/flat 最小倍数
+	passthroughMinRatio = 10.0
+	// passthroughMinCumPercent 是判定 "透传" 函数所需的最小 cumulative 占比 (%)，避免把冷门函数标记出来
+	passthroughMinCumPercent = 5.0
+)
+
+// FlatCumulativeStat 是单个函数的 flat 与 cumulative 值 (JSON)
+type FlatCumulativeStat struct {
+	FunctionName      string  `json:"functionName"`
+	FunctionID        string  `json:"functionId"` // 完整函数名的稳定哈希，用于跨报告关联
+	FlatValue         int64   `json:"flatValue"`
+	FlatPercent       float64 `json:"flatPercent"`
+	CumulativeValue   int64   `json:"cumulativeValue"`
+	CumulativePercent float64 `json:"cumulativePercent"`
+	Passthrough       bool    `json:"passthrough"` // 自身开销很小但 cumulative 很大：热点在它调用的函数中
+}
+
+// FlatCumulativeResult 是 flat/cumulative 对照视图的结果 (JSON)
+type FlatCumulativeResult struct {
+	ProfileType string               `json:"profileType"`
+	ValueType   string               `json:"valueType"`
+	ValueUnit   string               `json:"valueUnit"`
+	Total       int64                `json:"total"`
+	TopN        int                  `json:"topN"`
+	Functions   []FlatCumulativeStat `json:"functions"`
+}
+
+// AnalyzeFlatCumulative 将函数的 flat (自身) 值和 cumulative (含调用的函数) 值并列展示，按 cumulative 排序。
+// cumulative 不低于 flat 的 10 倍且占总值至少 5% 的函数标记为透传 (passthrough)：它自身并不慢，
+// 真正需要优化的是它调用的函数；flat 接近 cumulative 的函数才是应该直接优化的热点。
+func AnalyzeFlatCumulative(p *profile.Profile, profileType string, topN int, format string) (string, error) {
+	return AnalyzeFlatCumulativeContext(context.Background(), p, profileType, topN, format)
+}
+
+// AnalyzeFlatCumulativeContext 与 AnalyzeFlatCumulative 相同，但在聚合样本时定期检查 ctx，ctx 被取消时尽快停止
+func AnalyzeFlatCumulativeContext(ctx context.Context, p *profile.Profile, profileType string, topN int, format string) (string, error) {
+	logDebug("Analyzing flat vs cumulative: type=%s (Top %d, Format: %s)", profileType, topN, format)
+
+	valueIndex, _, err := findValueColumn(p, profileType)
+	if err != nil {
+		return "", err
+	}
+	st := p.SampleType[valueIndex]
+
+	flat, _, total, err := aggregateValues(ctx, p, valueIndex, AggregationLeaf)
+	if err != nil {
+		return "", err
+	}
+	cumulative, _, _, err := aggregateValues(ctx, p, valueIndex, AggregationCumulative)
+	if err != nil {
+		return "", err
+	}
+
+	percent := func(v int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(v) / float64(total) * 100
+	}
+	stats := make([]FlatCumulativeStat, 0, len(cumulative))
+	for name, cum := range cumulative {
+		stat := FlatCumulativeStat{
+			FunctionName:      name,
+			FunctionID:        FunctionID(name),
+			FlatValue:         flat[name],
+			FlatPercent:       percent(flat[name]),
+			CumulativeValue:   cum,
+			CumulativePercent: percent(cum),
+		}
+		stat.Passthrough = stat.CumulativePercent >= passthroughMinCumPercent && float64(cum) >= passthroughMinRatio*float64(stat.FlatValue)
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].CumulativeValue != stats[j].CumulativeValue {
+			return stats[i].CumulativeValue > stats[j].CumulativeValue
+		}
+		return stats[i].FunctionName < stats[j].FunctionName
+	})
+	if topN > 0 && len(stats) > topN {
+		stats = stats[:topN]
+	}
+
+	result := FlatCumulativeResult{
+		ProfileType: profileType,
+		ValueType:   st.Type,
+		ValueUnit:   st.Unit,
+		Total:       total,
+		TopN:        len(stats),
+		Functions:   stats,
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatFlatCumulative(result, format), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// formatFlatCumulative 将 flat/cumulative 对照视图格式化为文本或 Markdown 表格
+func formatFlatCumulative(r FlatCumulativeResult, format string) string {
+	var b strings.Builder
+	header := []string{"Flat", "Flat%", "Cum", "Cum%", "透传", "函数"}
+	rows := make([][]string, 0, len(r.Functions))
+	passthrough := 0
+	for _, f := range r.Functions {
+		marker := ""
+		if f.Passthrough {
+			marker = "⤵"
+			passthrough++
+		}
+		name := sanitizeName(f.FunctionName)
+		if format == "markdown" {
+			name = "`" + name + "`"
+		}
+		rows = append(rows, []string{
+			formatUnitValue(f.FlatValue, r.ValueUnit),
+			fmt.Sprintf("%.2f%%", f.FlatPercent),
+			formatUnitValue(f.CumulativeValue, r.ValueUnit),
+			fmt.Sprintf("%.2f%%", f.CumulativePercent),
+			marker,
+			name,
+		})
+	}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("# Flat 与 Cumulative 对照 (%s, Top %d)\n\n", r.ProfileType, r.TopN))
+		b.WriteString(fmt.Sprintf("- **样本类型**: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("- **总值**: %s\n\n", formatUnitValue(r.Total, r.ValueUnit)))
+		b.WriteString("| " + strings.Join(header, " | ") + " |\n")
+		b.WriteString("|" + strings.Repeat("------|", len(header)) + "\n")
+		for _, row := range rows {
+			b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		}
+	} else {
+		b.WriteString(fmt.Sprintf("Flat 与 Cumulative 对照 (%s, Top %d)\n", r.ProfileType, r.TopN))
+		b.WriteString("==============================\n\n")
+		b.WriteString(fmt.Sprintf("样本类型: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("总值: %s\n\n", formatUnitValue(r.Total, r.ValueUnit)))
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	}
+
+	if passthrough > 0 {
+		b.WriteString(fmt.Sprintf("\n⤵ 标记的 %d 个函数是透传函数 (cumulative ≥ %.0f × flat 且占总值 ≥ %.0f%%)：它们自身开销很小，热点在其调用的函数中，应沿调用链向下优化。\n",
+			passthrough, passthroughMinRatio, passthroughMinCumPercent))
+	}
+	b.WriteString("flat 接近 cumulative 的函数自身就是热点，优化它们能直接降低总值。\n")
+	return b.String()
+}
+
+// CPU 与 Heap 函数列表的排序方式 (CPUAnalysisOptions.SortBy、HeapAnalysisOptions.SortBy)
+const (
+	SortByFlat = "flat" // 按函数自身的值排序 (默认)
+	SortByCum  = "cum"  // 按函数出现在调用栈任意位置的值排序，包括自身值为 0 的函数
+)
+
+// FunctionSortKeys 是 CPU 与 Heap 函数列表的可选排序方式
+var FunctionSortKeys = []string{SortByFlat, SortByCum}
+
+// sortedFunctionStats 合并 flat 与 cum 值得到函数列表，并按 sortBy 指定的值降序排序，值相同时按名称排序。
+// 按 flat 排序 (sortBy 为空或 SortByFlat) 时只包括 flat 中的函数；按 cum 排序时包括 cum 中的所有函数，
+// 使只出现在调用栈中间、自身值为 0 的函数也能进入 Top N。返回的 value 是排序所用的值，供 MinPercent 过滤使用。
+func sortedFunctionStats(flat, cum map[string]int64, sources map[string]*sourceLocation, sortBy string) (stats []functionStat, value func(functionStat) int64, err error) {
+	keys := flat
+	switch sortBy {
+	case "", SortByFlat:
+		value = func(s functionStat) int64 { return s.Flat }
+	case SortByCum:
+		keys = cum
+		value = func(s functionStat) int64 { return s.Cum }
+	default:
+		return nil, nil, fmt.Errorf("unsupported sort_by: %s (expected %s)", sortBy, strings.Join(FunctionSortKeys, ", "))
+	}
+
+	stats = make([]functionStat, 0, len(keys))
+	for name := range keys {
+		stats = append(stats, functionStat{Name: name, Flat: flat[name], Cum: cum[name], Source: sources[name]})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if vi, vj := value(stats[i]), value(stats[j]); vi != vj {
+			return vi > vj
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats, value, nil
+}
+
+// addCumulativeValue 将样本值 v 计入样本调用栈上的每个函数 (包括内联帧)，用于 CPU 与 Heap 报告的 Cum 列。
+// key 返回一帧对应的键 (函数名，或按源文件位置区分时的 "函数 (文件:行号)")；递归调用时同一键在一个样本中只计一次。
+// 最顶层没有函数信息的样本也计入 unknownFunction，与 flat 值的归属 (见 topLine) 保持一致。
+func addCumulativeValue(cum map[string]int64, s *profile.Sample, v int64, key func(profile.Line) string) {
+	seen := make(map[string]bool, len(s.Location))
+	if _, ok := topLine(s); !ok {
+		seen[unknownFunction] = true
+		cum[unknownFunction] += v
+	}
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			k := key(line)
+			if !seen[k] {
+				seen[k] = true
+				cum[k] += v
+			}
+		}
+	}
+}
+
+// functionNameKey 是按函数名聚合时 addCumulativeValue 使用的键
+func functionNameKey(line profile.Line) string {
+	return line.Function.Name
+}
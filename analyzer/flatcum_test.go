@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestAnalyzeFlatCumulative 测试 flat/cumulative 对照视图与透传函数标记
+func TestAnalyzeFlatCumulative(t *testing.T) {
+	handler := &profile.Function{Name: "main.handler"}
+	encode := &profile.Function{Name: "json.Marshal"}
+	hot := &profile.Function{Name: "main.hot"}
+	stack := func(value int64, funcs ...*profile.Function) *profile.Sample {
+		s := &profile.Sample{Value: []int64{value}}
+		for _, f := range funcs {
+			s.Location = append(s.Location, &profile.Location{Line: []profile.Line{{Function: f}}})
+		}
+		return s
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			stack(600, encode, handler),
+			stack(10, handler),
+			stack(390, hot),
+		},
+	}
+
+	out, err := AnalyzeFlatCumulative(p, "cpu", 10, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeFlatCumulative() error = %v", err)
+	}
+	var result FlatCumulativeResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.Total != 1000 || len(result.Functions) != 3 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	first := result.Functions[0]
+	if first.FunctionName != "main.handler" || first.FlatValue != 10 || first.CumulativeValue != 610 || !first.Passthrough {
+		t.Errorf("main.handler should be a passthrough function sorted first, got %+v", first)
+	}
+	for _, f := range result.Functions[1:] {
+		if f.Passthrough {
+			t.Errorf("%s should not be a passthrough function: %+v", f.FunctionName, f)
+		}
+	}
+
+	text, err := AnalyzeFlatCumulative(p, "cpu", 10, "markdown")
+	if err != nil {
+		t.Fatalf("AnalyzeFlatCumulative() error = %v", err)
+	}
+	for _, want := range []string{"| Flat | Flat% | Cum | Cum% | 透传 | 函数 |", "| ⤵ | `main.handler` |", "1 个函数是透传函数"} {
+		if !containsString(text, want) {
+			t.Errorf("Output should contain %q, got:\n%s", want, text)
+		}
+	}
+}
+
+// TestSortByCum 测试 CPU 与 Heap 函数列表按 Cum 排序时包括 Flat 为 0、只出现在调用栈中间的函数，按 Flat 排序时不包括
+func TestSortByCum(t *testing.T) {
+	caller := &profile.Function{Name: "main.serve", Filename: "server.go"}
+	work := &profile.Function{Name: "main.work", Filename: "work.go"}
+	idle := &profile.Function{Name: "main.idle", Filename: "idle.go"}
+	stack := func(values []int64, leaf *profile.Function, callers ...*profile.Function) *profile.Sample {
+		s := &profile.Sample{Value: values, Location: []*profile.Location{{Line: []profile.Line{{Function: leaf, Line: 10}}}}}
+		for _, f := range callers {
+			s.Location = append(s.Location, &profile.Location{Line: []profile.Line{{Function: f, Line: 20}}})
+		}
+		return s
+	}
+
+	cpu := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			stack([]int64{600}, work, caller),
+			stack([]int64{400}, idle),
+		},
+	}
+	names := func(result *CPUAnalysisResult) []string {
+		var got []string
+		for _, f := range result.Functions {
+			got = append(got, f.FunctionName)
+		}
+		return got
+	}
+
+	flat, err := CPUProfileStats(cpu, 10, CPUAnalysisOptions{})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	if got := names(flat); len(got) != 2 || got[0] != "main.work" || got[1] != "main.idle" {
+		t.Errorf("sorted by flat = %v, want [main.work main.idle]", got)
+	}
+
+	cum, err := CPUProfileStats(cpu, 10, CPUAnalysisOptions{SortBy: SortByCum, MinPercent: 50})
+	if err != nil {
+		t.Fatalf("CPUProfileStats(cum) error = %v", err)
+	}
+	// main.serve 和 main.work 的 Cum 相同，按名称排序；main.idle 的 Cum 占 40%，被 MinPercent 过滤
+	if got := names(cum); len(got) != 2 || got[0] != "main.serve" || got[1] != "main.work" {
+		t.Errorf("sorted by cum = %v, want [main.serve main.work]", got)
+	}
+	if f := cum.Functions[0]; f.FlatValue != 0 || f.CumValue != 600 {
+		t.Errorf("main.serve: flat = %d, cum = %d, want 0 and 600", f.FlatValue, f.CumValue)
+	}
+	if cum.SortBy != SortByCum {
+		t.Errorf("SortBy = %q, want %q", cum.SortBy, SortByCum)
+	}
+
+	// 按源文件位置统计时，只有 Cum 的位置同样带有函数和文件
+	withSource, err := CPUProfileStats(cpu, 10, CPUAnalysisOptions{SortBy: SortByCum, IncludeSourceLocation: true})
+	if err != nil {
+		t.Fatalf("CPUProfileStats(cum, source) error = %v", err)
+	}
+	if f := withSource.Functions[0]; f.FlatValue != 0 || f.FileName != "server.go" || f.LineNumber != 20 {
+		t.Errorf("Cum-only location should keep its source location, got %+v", f)
+	}
+
+	text, err := AnalyzeCPUProfileWithOptions(cpu, 10, "text", CPUAnalysisOptions{SortBy: SortByCum})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfileWithOptions() error = %v", err)
+	}
+	if !containsString(text, "Functions by Cum Time") || !containsString(text, "main.serve") {
+		t.Errorf("Text output should be sorted by cum time and list main.serve, got:\n%s", text)
+	}
+
+	if _, err := CPUProfileStats(cpu, 10, CPUAnalysisOptions{SortBy: "avg_delay"}); err == nil {
+		t.Error("CPUProfileStats() should reject an unknown sort_by")
+	}
+
+	heap := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "inuse_objects", Unit: "count"}, {Type: "inuse_space", Unit: "bytes"}},
+		Sample: []*profile.Sample{
+			stack([]int64{6, 6144}, work, caller),
+			stack([]int64{1, 4096}, idle),
+		},
+	}
+	heapResult, err := HeapProfileStatsWithOptions(heap, 10, HeapAnalysisOptions{SortBy: SortByCum})
+	if err != nil {
+		t.Fatalf("HeapProfileStatsWithOptions(cum) error = %v", err)
+	}
+	if len(heapResult.Functions) != 3 || heapResult.Functions[0].FunctionName != "main.serve" || heapResult.Functions[0].Value != 0 || heapResult.Functions[0].CumValue != 6144 {
+		t.Errorf("Heap functions sorted by cum = %+v, want main.serve first with no flat value", heapResult.Functions)
+	}
+}
@@ -0,0 +1,348 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// fleetOutlierMinScore 是将副本标记为离群 (outlier) 所需的最小偏离分数 (%)
+const fleetOutlierMinScore = 20.0
+
+// FleetReplica 是 AnalyzeFleet 的单个输入：一个副本的 profile，或获取失败时的错误信息
+type FleetReplica struct {
+	Label   string
+	Profile *profile.Profile // 获取或解析失败时为 nil
+	Error   string           // 获取或解析失败的原因
+}
+
+// FleetFunction 是合并视图中单个函数的值 (JSON)
+type FleetFunction struct {
+	FunctionName string  `json:"functionName"`
+	FunctionID   string  `json:"functionId"` // 完整函数名的稳定哈希，用于跨报告关联
+	Value        int64   `json:"value"`
+	Percent      float64 `json:"percent"`
+}
+
+// FleetReplicaStat 是单个副本相对集群平均水平的偏离程度 (JSON)
+type FleetReplicaStat struct {
+	Label             string  `json:"label"`
+	Total             int64   `json:"total"`
+	Rate              float64 `json:"rate"`                        // RateNormalized 时为每秒的值，否则等于 Total
+	RateDeviation     float64 `json:"rateDeviation"`               // Rate 相对所有副本中位数的偏差 (%)
+	ShapeDistance     float64 `json:"shapeDistance"`               // 函数占比与集群典型占比 (各函数占比的中位数) 的差异之和的一半 (0-100%)
+	Score             float64 `json:"score"`                       // 偏离分数：|RateDeviation| 与 ShapeDistance 中较大的一个
+	Outlier           bool    `json:"outlier"`                     // 至少 3 个副本且 Score 达到阈值
+	TopDeviation      string  `json:"topDeviation,omitempty"`      // 占比偏离集群典型占比最多的函数
+	TopDeviationID    string  `json:"topDeviationId,omitempty"`    // 该函数的 functionId
+	TopDeviationDelta float64 `json:"topDeviationDelta,omitempty"` // 该函数的占比与集群典型占比的差 (百分点)
+}
+
+// FleetFailure 是没有参与分析的副本及原因 (JSON)
+type FleetFailure struct {
+	Label string `json:"label"`
+	Error string `json:"error"`
+}
+
+// FleetResult 是集群 (fleet) 分析的结果 (JSON)
+type FleetResult struct {
+	ProfileType    string             `json:"profileType"`
+	ValueType      string             `json:"valueType"`
+	ValueUnit      string             `json:"valueUnit"`
+	Replicas       int                `json:"replicas"` // 输入的副本总数
+	Analyzed       int                `json:"analyzed"` // 成功获取并参与合并的副本数
+	FleetTotal     int64              `json:"fleetTotal"`
+	RateNormalized bool               `json:"rateNormalized"` // 所有副本都记录了采集时长时，按每秒的值比较
+	TopN           int                `json:"topN"`
+	Functions      []FleetFunction    `json:"functions"`
+	Outliers       []FleetReplicaStat `json:"outliers"` // 按 Score 从高到低排序
+	Failed         []FleetFailure     `json:"failed,omitempty"`
+}
+
+// AnalyzeFleet 合并多个副本 (例如同一服务的每个 pod) 的 profile 得到集群整体视图，并按偏离集群平均水平的程度对副本排序，
+// 用于排查 "只有一个 pod 很慢" 一类的问题。偏离从两个角度衡量：总量 (按采集时长归一化后) 相对所有副本的偏差，
+// 以及函数占比分布与集群典型分布的差异。集群的平均水平取各副本的中位数，避免离群副本本身拉偏基准，
+// 使正常副本也显得偏离。获取失败或样本类型与第一个成功副本不一致的副本不参与分析，在结果中单独列出。
+func AnalyzeFleet(replicas []FleetReplica, profileType string, topN int, format string) (string, error) {
+	return AnalyzeFleetContext(context.Background(), replicas, profileType, topN, format)
+}
+
+// AnalyzeFleetContext 与 AnalyzeFleet 相同，但在合并和聚合各副本的样本时检查 ctx，ctx 被取消时尽快停止
+func AnalyzeFleetContext(ctx context.Context, replicas []FleetReplica, profileType string, topN int, format string) (string, error) {
+	logDebug("Analyzing fleet: %d replicas, type=%s (Top %d, Format: %s)", len(replicas), profileType, topN, format)
+
+	result := FleetResult{ProfileType: profileType, Replicas: len(replicas)}
+	var (
+		reference *profile.Profile
+		analyzed  []FleetReplica
+	)
+	for _, r := range replicas {
+		switch {
+		case r.Profile == nil:
+			result.Failed = append(result.Failed, FleetFailure{Label: r.Label, Error: r.Error})
+		case reference == nil:
+			reference = r.Profile
+			analyzed = append(analyzed, r)
+		case !sameSampleTypes(reference.SampleType, r.Profile.SampleType):
+			result.Failed = append(result.Failed, FleetFailure{Label: r.Label, Error: fmt.Sprintf(
+				"样本类型 [%s] 与 %s 的 [%s] 不一致，已排除", sampleTypeNames(r.Profile), analyzed[0].Label, sampleTypeNames(reference))})
+		case !samePeriodType(reference.PeriodType, r.Profile.PeriodType):
+			result.Failed = append(result.Failed, FleetFailure{Label: r.Label, Error: fmt.Sprintf(
+				"采样周期类型 %s 与 %s 的 %s 不一致，已排除", periodTypeName(r.Profile.PeriodType), analyzed[0].Label, periodTypeName(reference.PeriodType))})
+		default:
+			analyzed = append(analyzed, r)
+		}
+	}
+	if len(analyzed) == 0 {
+		return "", fmt.Errorf("所有 %d 个副本的 profile 都获取失败，无法进行集群分析", len(replicas))
+	}
+	result.Analyzed = len(analyzed)
+
+	valueIndex, _, err := findValueColumn(reference, profileType)
+	if err != nil {
+		return "", err
+	}
+	st := reference.SampleType[valueIndex]
+	result.ValueType, result.ValueUnit = st.Type, st.Unit
+
+	// --- 合并视图 ---
+	profiles := make([]*profile.Profile, len(analyzed))
+	for i, r := range analyzed {
+		profiles[i] = r.Profile
+	}
+	merged, err := MergeProfiles(profiles)
+	if err != nil {
+		return "", err
+	}
+	// 合并本身无法中途取消，合并完成后立即检查
+	if err := canceledErr(ctx); err != nil {
+		return "", err
+	}
+	fleetValues, _, fleetTotal, err := aggregateValues(ctx, merged, valueIndex, AggregationLeaf)
+	if err != nil {
+		return "", err
+	}
+	result.FleetTotal = fleetTotal
+	for name, v := range fleetValues {
+		fn := FleetFunction{FunctionName: name, FunctionID: FunctionID(name), Value: v}
+		if fleetTotal != 0 {
+			fn.Percent = float64(v) / float64(fleetTotal) * 100
+		}
+		result.Functions = append(result.Functions, fn)
+	}
+	sort.Slice(result.Functions, func(i, j int) bool {
+		if result.Functions[i].Value != result.Functions[j].Value {
+			return result.Functions[i].Value > result.Functions[j].Value
+		}
+		return result.Functions[i].FunctionName < result.Functions[j].FunctionName
+	})
+	if topN > 0 && len(result.Functions) > topN {
+		result.Functions = result.Functions[:topN]
+	}
+	result.TopN = len(result.Functions)
+
+	// --- 副本偏离排名 ---
+	result.RateNormalized = true
+	for _, r := range analyzed {
+		if r.Profile.DurationNanos <= 0 {
+			result.RateNormalized = false
+		}
+	}
+	shares := make([]map[string]float64, len(analyzed))
+	rates := make([]float64, 0, len(analyzed))
+	functions := make(map[string]bool)
+	for i, r := range analyzed {
+		values, _, total, err := aggregateValues(ctx, r.Profile, valueIndex, AggregationLeaf)
+		if err != nil {
+			return "", err
+		}
+		stat := FleetReplicaStat{Label: r.Label, Total: total, Rate: float64(total)}
+		if result.RateNormalized {
+			stat.Rate = float64(total) / (float64(r.Profile.DurationNanos) / 1e9)
+		}
+		rates = append(rates, stat.Rate)
+		shares[i] = make(map[string]float64, len(values))
+		for name, v := range values {
+			functions[name] = true
+			if total != 0 {
+				shares[i][name] = float64(v) / float64(total) * 100
+			}
+		}
+		result.Outliers = append(result.Outliers, stat)
+	}
+	medianRate := median(rates)
+	medianShare := make(map[string]float64, len(functions))
+	for name := range functions {
+		values := make([]float64, len(shares))
+		for i := range shares {
+			values[i] = shares[i][name]
+		}
+		medianShare[name] = median(values)
+	}
+	for i := range result.Outliers {
+		stat := &result.Outliers[i]
+		if medianRate != 0 {
+			stat.RateDeviation = (stat.Rate - medianRate) / medianRate * 100
+		}
+		// 与总变差距离相同：两个占比分布之差的绝对值之和的一半
+		topDelta := 0.0
+		for name, typical := range medianShare {
+			delta := shares[i][name] - typical
+			stat.ShapeDistance += math.Abs(delta) / 2
+			if math.Abs(delta) > math.Abs(topDelta) || (math.Abs(delta) == math.Abs(topDelta) && delta != 0 && name < stat.TopDeviation) {
+				topDelta = delta
+				stat.TopDeviation = name
+			}
+		}
+		if stat.TopDeviation != "" {
+			stat.TopDeviationID = FunctionID(stat.TopDeviation)
+			stat.TopDeviationDelta = topDelta
+		}
+		stat.Score = math.Max(math.Abs(stat.RateDeviation), stat.ShapeDistance)
+		stat.Outlier = len(analyzed) >= 3 && stat.Score >= fleetOutlierMinScore
+	}
+	sort.SliceStable(result.Outliers, func(i, j int) bool {
+		return result.Outliers[i].Score > result.Outliers[j].Score
+	})
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatFleet(result, format), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// formatFleet 将集群分析结果格式化为文本或 Markdown：合并后的热点函数表和副本偏离排名表
+func formatFleet(r FleetResult, format string) string {
+	var b strings.Builder
+	rateHeader := "总值"
+	if r.RateNormalized {
+		rateHeader = "每秒"
+	}
+
+	funcHeader := []string{"值", "占比", "函数"}
+	funcRows := make([][]string, 0, len(r.Functions))
+	for _, f := range r.Functions {
+		name := sanitizeName(f.FunctionName)
+		if format == "markdown" {
+			name = "`" + name + "`"
+		}
+		funcRows = append(funcRows, []string{formatUnitValue(f.Value, r.ValueUnit), fmt.Sprintf("%.2f%%", f.Percent), name})
+	}
+
+	replicaHeader := []string{"排名", "副本", rateHeader, "总量偏差", "分布差异", "偏离分数", "偏离最多的函数", "离群"}
+	replicaRows := make([][]string, 0, len(r.Outliers))
+	outliers := 0
+	for i, s := range r.Outliers {
+		top := "-"
+		if s.TopDeviation != "" {
+			name := truncateString(sanitizeName(s.TopDeviation), 40)
+			if format == "markdown" {
+				name = "`" + name + "`"
+			}
+			top = fmt.Sprintf("%s (%+.2f pp)", name, s.TopDeviationDelta)
+		}
+		marker := ""
+		if s.Outlier {
+			marker = "⚠️"
+			outliers++
+		}
+		replicaRows = append(replicaRows, []string{
+			fmt.Sprintf("%d", i+1),
+			sanitizeName(s.Label),
+			formatUnitValue(int64(math.Round(s.Rate)), r.ValueUnit),
+			fmt.Sprintf("%+.2f%%", s.RateDeviation),
+			fmt.Sprintf("%.2f%%", s.ShapeDistance),
+			fmt.Sprintf("%.2f", s.Score),
+			top,
+			marker,
+		})
+	}
+
+	writeTable := func(header []string, rows [][]string) {
+		if format == "markdown" {
+			b.WriteString("| " + strings.Join(header, " | ") + " |\n")
+			b.WriteString("|" + strings.Repeat("------|", len(header)) + "\n")
+			for _, row := range rows {
+				b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+			}
+			return
+		}
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("# 集群分析 (%s, %d/%d 个副本)\n\n", r.ProfileType, r.Analyzed, r.Replicas))
+		b.WriteString(fmt.Sprintf("- **样本类型**: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("- **合并后总值**: %s\n\n", formatUnitValue(r.FleetTotal, r.ValueUnit)))
+		b.WriteString(fmt.Sprintf("## 合并视图 (Top %d)\n\n", r.TopN))
+		writeTable(funcHeader, funcRows)
+		b.WriteString("\n## 副本偏离排名\n\n")
+		writeTable(replicaHeader, replicaRows)
+	} else {
+		b.WriteString(fmt.Sprintf("集群分析 (%s, %d/%d 个副本)\n", r.ProfileType, r.Analyzed, r.Replicas))
+		b.WriteString("==============================\n\n")
+		b.WriteString(fmt.Sprintf("样本类型: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("合并后总值: %s\n\n", formatUnitValue(r.FleetTotal, r.ValueUnit)))
+		b.WriteString(fmt.Sprintf("合并视图 (Top %d):\n", r.TopN))
+		writeTable(funcHeader, funcRows)
+		b.WriteString("\n副本偏离排名:\n")
+		writeTable(replicaHeader, replicaRows)
+	}
+
+	if !r.RateNormalized {
+		b.WriteString("\n部分副本没有记录采集时长，总量偏差按原始总值计算；采集时长不同时结果可能失真。\n")
+	}
+	switch {
+	case r.Analyzed < 3:
+		b.WriteString("\n参与分析的副本少于 3 个，无法可靠地判断哪个副本离群，排名仅供参考。\n")
+	case outliers > 0:
+		b.WriteString(fmt.Sprintf("\n⚠️ 标记的 %d 个副本偏离分数 ≥ %.0f：总量偏差 (%s) 或函数占比分布与集群中位数明显不同，可单独使用 analyze_pprof 或 compare_profiles 深入分析。\n",
+			outliers, fleetOutlierMinScore, rateHeader))
+	default:
+		b.WriteString("\n没有明显离群的副本，各副本的负载和热点分布与集群平均水平接近。\n")
+	}
+
+	if len(r.Failed) > 0 {
+		if format == "markdown" {
+			b.WriteString("\n## 未参与分析的副本\n\n")
+		} else {
+			b.WriteString("\n未参与分析的副本:\n")
+		}
+		for _, f := range r.Failed {
+			b.WriteString(fmt.Sprintf("- %s: %s\n", sanitizeName(f.Label), f.Error))
+		}
+	}
+	return b.String()
+}
+
+// median 返回 values 的中位数 (偶数个值时取中间两个的平均值)，会对 values 排序
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
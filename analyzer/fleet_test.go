@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// fleetReplica 构造一个 CPU profile 副本，rows 的格式与 goldenFixture 相同
+func fleetReplica(label string, rows [][]int64) FleetReplica {
+	p := goldenFixture([][2]string{{"samples", "count"}, {"cpu", "nanoseconds"}}, &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}, rows)
+	return FleetReplica{Label: label, Profile: p}
+}
+
+// TestAnalyzeFleet 测试合并视图、离群副本排名以及部分副本失败时的处理
+func TestAnalyzeFleet(t *testing.T) {
+	normal := [][]int64{{100, 1000000000, 2}, {50, 500000000, 1}}
+	replicas := []FleetReplica{
+		fleetReplica("pod-a", normal),
+		fleetReplica("pod-b", normal),
+		fleetReplica("pod-c", normal),
+		// pod-d 的总量是其它副本的 3 倍，且大部分时间花在 runtime.mallocgc
+		fleetReplica("pod-d", [][]int64{{100, 1000000000, 2}, {50, 500000000, 1}, {300, 3000000000, 3}}),
+		{Label: "pod-e", Error: "connection refused"},
+		{Label: "pod-f", Profile: goldenFixture([][2]string{{"goroutine", "count"}}, &profile.ValueType{Type: "goroutine", Unit: "count"}, [][]int64{{5, 0}})},
+	}
+
+	out, err := AnalyzeFleet(replicas, "cpu", 10, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeFleet() error = %v", err)
+	}
+	var result FleetResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if result.Replicas != 6 || result.Analyzed != 4 {
+		t.Errorf("Replicas/Analyzed = %d/%d, want 6/4", result.Replicas, result.Analyzed)
+	}
+	if result.FleetTotal != 3*1500000000+4500000000 {
+		t.Errorf("FleetTotal = %d", result.FleetTotal)
+	}
+	if !result.RateNormalized {
+		t.Error("RateNormalized = false, want true (all replicas have a duration)")
+	}
+	if len(result.Functions) != 3 || result.Functions[0].FunctionName != "encoding/json.Marshal" || result.Functions[1].FunctionName != "runtime.mallocgc" {
+		t.Errorf("merged functions = %+v, want encoding/json.Marshal then runtime.mallocgc", result.Functions)
+	}
+
+	top := result.Outliers[0]
+	if top.Label != "pod-d" || !top.Outlier {
+		t.Fatalf("top outlier = %+v, want pod-d flagged as outlier", top)
+	}
+	if top.TopDeviation != "runtime.mallocgc" || top.TopDeviationDelta <= 0 {
+		t.Errorf("pod-d top deviation = %s (%+.2f), want runtime.mallocgc with a positive delta", top.TopDeviation, top.TopDeviationDelta)
+	}
+	if top.RateDeviation <= 100 {
+		t.Errorf("pod-d RateDeviation = %.2f, want > 100%%", top.RateDeviation)
+	}
+	for _, s := range result.Outliers[1:] {
+		if s.Outlier {
+			t.Errorf("replica %s should not be an outlier: %+v", s.Label, s)
+		}
+	}
+
+	if len(result.Failed) != 2 || result.Failed[0].Label != "pod-e" || result.Failed[1].Label != "pod-f" {
+		t.Fatalf("Failed = %+v, want pod-e (fetch error) and pod-f (incompatible)", result.Failed)
+	}
+	if !strings.Contains(result.Failed[1].Error, "goroutine/count") {
+		t.Errorf("incompatible replica error = %q, want the mismatching sample types", result.Failed[1].Error)
+	}
+
+	for _, format := range []string{"text", "markdown"} {
+		out, err := AnalyzeFleet(replicas, "cpu", 10, format)
+		if err != nil {
+			t.Fatalf("AnalyzeFleet(%s) error = %v", format, err)
+		}
+		for _, want := range []string{"4/6 个副本", "副本偏离排名", "pod-d", "runtime.mallocgc", "connection refused", "⚠️"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s output missing %q:\n%s", format, want, out)
+			}
+		}
+	}
+}
+
+// TestAnalyzeFleetAllFailed 测试所有副本都获取失败时返回错误
+func TestAnalyzeFleetAllFailed(t *testing.T) {
+	_, err := AnalyzeFleet([]FleetReplica{{Label: "a", Error: "timeout"}, {Label: "b", Error: "timeout"}}, "cpu", 10, "text")
+	if err == nil {
+		t.Fatal("AnalyzeFleet() error = nil, want an error when no replica is available")
+	}
+}
@@ -1,67 +1,124 @@
 package analyzer
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"time"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// FormatSampleValue 将样本值 (如 CPU 时间或计数) 转换为人类可读的字符串。
-// 注意：已导出 (首字母大写)。
+// FormatSampleValue 将样本值 (如 CPU 时间或计数) 转换为人类可读的字符串 (NumberStyleHuman)。
+// 注意：已导出 (首字母大写)。不支持 number_style 的报告 (比较、时序、火焰图等) 固定使用这些包级函数，
+// 支持的报告应使用选项中的 NumberFormatter。
 func FormatSampleValue(value int64, unit string) string {
-	switch unit {
-	case "nanoseconds":
-		d := time.Duration(value) * time.Nanosecond
-		if d >= time.Second {
-			return fmt.Sprintf("%.2fs", d.Seconds())
-		}
-		if d >= time.Millisecond {
-			return fmt.Sprintf("%.2fms", float64(d.Milliseconds()))
-		}
-		if d >= time.Microsecond {
-			return fmt.Sprintf("%.2fus", float64(d.Microseconds()))
-		}
-		return fmt.Sprintf("%dns", d.Nanoseconds())
-	case "count":
-		return fmt.Sprintf("%d", value)
-	// 如果需要，可以添加其他潜在单位的处理
-	default:
-		return fmt.Sprintf("%d %s", value, unit) // 回退方案
-	}
+	return NumberFormatter{}.SampleValue(value, unit)
 }
 
-// FormatBytes 将字节数转换为人类可读的字符串 (KB, MB, GB)。
+// FormatBytes 将字节数转换为人类可读的字符串 (KB, MB, GB，1024 进制，NumberStyleHuman)。
 // 注意：已导出 (首字母大写)。
 func FormatBytes(b int64) string {
-	const unit = 1024
-	if b < unit {
-		return fmt.Sprintf("%d B", b)
-	}
-	div, exp := int64(unit), 0
-	for n := b / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	return NumberFormatter{}.Bytes(b)
+}
+
+// percentOf 返回 value 占 total 的百分比 (value / total * 100)，total 为零时返回 0。
+// 各 Top N 表格的占比列和累计占比 (Sum%) 列都用它计算，不同 profile 类型的口径因此一致
+func percentOf(value, total int64) float64 {
+	if total == 0 {
+		return 0
 	}
-	return fmt.Sprintf("%.2f %cB", float64(b)/float64(div), "KMGTPE"[exp]) // Kilo, Mega, Giga, Tera, Peta, Exa
+	return float64(value) / float64(total) * 100
 }
 
-// formatNumber 格式化数字为可读字符串（带千分位）
+// formatNumber 格式化数字为可读字符串（带千分位，NumberStyleHuman）
 func formatNumber(n int64) string {
-	if n < 1000 {
-		return fmt.Sprintf("%d", n)
-	}
-	if n < 1000000 {
-		return fmt.Sprintf("%.1fK", float64(n)/1000)
+	return NumberFormatter{}.Number(n)
+}
+
+// truncateString 截断字符串到指定长度 (按字符而不是字节计数)，截断时以 "..." 结尾，并先用 sanitizeName 去除控制字符。
+// 按字符截断不会拆开多字节字符，中文或其它非 ASCII 的函数名不会产生无效的 UTF-8。
+func truncateString(s string, maxLen int) string {
+	s = sanitizeName(s)
+	if utf8.RuneCountInString(s) <= maxLen {
+		return s
 	}
-	if n < 1000000000 {
-		return fmt.Sprintf("%.1fM", float64(n)/1000000)
+	keep := maxLen - 3
+	if keep < 0 {
+		keep = 0
 	}
-	return fmt.Sprintf("%.1fG", float64(n)/1000000000)
+	runes := []rune(s)
+	return string(runes[:keep]) + "..."
 }
 
-// truncateString 截断字符串到指定长度
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
+// sanitizeName 将名称中的控制字符 (换行、制表符等) 替换为空格。
+// 异常的符号名可能包含这些字符，直接输出会破坏 Markdown 表格或按行解析的文本报告。
+func sanitizeName(s string) string {
+	if strings.IndexFunc(s, unicode.IsControl) < 0 {
 		return s
 	}
-	return s[:maxLen-3] + "..."
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// formatUnitValue 根据样本单位选择合适的格式化方式 (NumberStyleHuman)
+func formatUnitValue(value int64, unit string) string {
+	return NumberFormatter{}.UnitValue(value, unit)
+}
+
+// compactRow 代表 compact 格式中的一行
+type compactRow struct {
+	Name    string
+	Value   string
+	Percent float64
+}
+
+// formatCompact 以每个函数一行的紧凑格式输出 (排名、短函数名、值、百分比)，
+// 不使用固定宽度的填充，适合窄终端和日志管道。
+func formatCompact(header string, rows []compactRow) string {
+	var b strings.Builder
+	b.WriteString(header + "\n")
+	for i, row := range rows {
+		b.WriteString(fmt.Sprintf("%d %s %s %.1f%%\n", i+1, sanitizeName(shortFunctionName(row.Name)), row.Value, row.Percent))
+	}
+	return b.String()
+}
+
+// FunctionID 返回函数的稳定标识 (完整函数名 SHA-256 的前 8 字节，十六进制)。
+// 必须在截断、缩短或清理显示名之前用 profile 中的原始函数名计算，
+// 这样 diff、时序和不同类型的报告即使显示名不同，也能按 functionId 关联同一个函数。
+func FunctionID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:8])
+}
+
+// shortFunctionName 去掉函数名中的包路径前缀，例如 "github.com/a/b/pkg.(*T).M" -> "pkg.(*T).M"
+func shortFunctionName(name string) string {
+	// 只在第一个 '(' 或 '[' 之前查找 '/'，避免截断接收者或泛型参数中的路径
+	prefix := name
+	if i := strings.IndexAny(prefix, "(["); i >= 0 {
+		prefix = prefix[:i]
+	}
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// packageName 返回函数所在的包路径，例如 "github.com/a/b/pkg.(*T).M" -> "github.com/a/b/pkg"、"main.main.func1" -> "main"。
+// 与 shortFunctionName 一样忽略接收者和泛型参数中的 '/' 和 '.'；名称中没有 '.' 时 (例如 C 函数) 返回 '(' 或 '[' 之前的部分。
+func packageName(name string) string {
+	pkg := name
+	if i := strings.IndexAny(pkg, "(["); i >= 0 {
+		pkg = pkg[:i]
+	}
+	slash := strings.LastIndex(pkg, "/")
+	if dot := strings.Index(pkg[slash+1:], "."); dot >= 0 {
+		pkg = pkg[:slash+1+dot]
+	}
+	return pkg
 }
@@ -0,0 +1,206 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestShortFunctionName 测试去掉包路径前缀
+func TestShortFunctionName(t *testing.T) {
+	tests := map[string]string{
+		"main.main":                           "main.main",
+		"github.com/a/b/pkg.(*T).Method":      "pkg.(*T).Method",
+		"net/http.(*conn).serve":              "http.(*conn).serve",
+		"pkg.Func[go.shape.*example.com/x.T]": "pkg.Func[go.shape.*example.com/x.T]",
+	}
+	for in, want := range tests {
+		if got := shortFunctionName(in); got != want {
+			t.Errorf("shortFunctionName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestPackageName 测试从函数名中提取包路径
+func TestPackageName(t *testing.T) {
+	tests := map[string]string{
+		"main.main":                           "main",
+		"main.main.func1":                     "main",
+		"runtime.(*mheap).alloc":              "runtime",
+		"github.com/a/b/pkg.(*T).Method":      "github.com/a/b/pkg",
+		"encoding/json.Marshal":               "encoding/json",
+		"pkg.Func[go.shape.*example.com/x.T]": "pkg",
+		"memcpy":                              "memcpy",
+	}
+	for in, want := range tests {
+		if got := packageName(in); got != want {
+			t.Errorf("packageName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestFunctionID 测试 functionId 由完整函数名计算，在不同报告的 JSON 中保持一致
+func TestFunctionID(t *testing.T) {
+	long := "github.com/acme/platform/internal/storage/engine.(*BTreeIndex).rebalanceSubtree"
+	if FunctionID(long) != FunctionID(long) || len(FunctionID(long)) != 16 {
+		t.Fatalf("FunctionID should be a stable 16-character hex string, got %q", FunctionID(long))
+	}
+	if FunctionID(long) == FunctionID(shortFunctionName(long)) {
+		t.Error("FunctionID of the full name should differ from that of the shortened name")
+	}
+
+	newProfile := func(v int64) *profile.Profile {
+		return &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+			Sample: []*profile.Sample{
+				{Value: []int64{v}, Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: long}}}}}},
+			},
+		}
+	}
+
+	cpuJSON, err := AnalyzeCPUProfile(newProfile(100000000), 5, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile() error = %v", err)
+	}
+	var cpu CPUAnalysisResult
+	if err := json.Unmarshal([]byte(cpuJSON), &cpu); err != nil {
+		t.Fatalf("invalid CPU JSON: %v", err)
+	}
+
+	diffJSON, err := CompareProfilesWithOptions(newProfile(100000000), newProfile(300000000), "cpu", CompareOptions{Format: "json"})
+	if err != nil {
+		t.Fatalf("CompareProfilesWithOptions() error = %v", err)
+	}
+	var diff DiffResult
+	if err := json.Unmarshal([]byte(diffJSON), &diff); err != nil {
+		t.Fatalf("invalid diff JSON: %v", err)
+	}
+
+	if len(cpu.Functions) != 1 || len(diff.Functions) != 1 {
+		t.Fatalf("expected one function in each report, got %d and %d", len(cpu.Functions), len(diff.Functions))
+	}
+	if cpu.Functions[0].FunctionID != FunctionID(long) || diff.Functions[0].FunctionID != cpu.Functions[0].FunctionID {
+		t.Errorf("functionId should join across reports: cpu=%q diff=%q want %q",
+			cpu.Functions[0].FunctionID, diff.Functions[0].FunctionID, FunctionID(long))
+	}
+}
+
+// TestTruncateStringRunes 测试按字符截断：不拆开多字节字符，截断时以 "..." 结尾
+func TestTruncateStringRunes(t *testing.T) {
+	tests := []struct {
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"main.处理请求", 10, "main.处理请求"},
+		{"main.处理用户登录请求并写入数据库", 12, "main.处理用户..."},
+		{"sync.Map[string,int]", 20, "sync.Map[string,int]"},
+		{"sync.Map[string,int].Load", 15, "sync.Map[str..."},
+		{"pkg.缓存[键,值].获取", 10, "pkg.缓存[..."},
+		{"函数", 2, "函数"},
+		{"函数名", 2, "..."},
+	}
+	for _, tt := range tests {
+		got := truncateString(tt.in, tt.maxLen)
+		if got != tt.want {
+			t.Errorf("truncateString(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateString(%q, %d) produced invalid UTF-8: %q", tt.in, tt.maxLen, got)
+		}
+		if n := utf8.RuneCountInString(got); n > tt.maxLen && n > 3 {
+			t.Errorf("truncateString(%q, %d) = %q has %d runes", tt.in, tt.maxLen, got, n)
+		}
+	}
+}
+
+// TestTruncateStringInReports 测试较长的中文和泛型函数名在 Mutex 报告中截断后仍是有效的 UTF-8
+func TestTruncateStringInReports(t *testing.T) {
+	names := []string{
+		"github.com/acme/服务/内部/存储.(*索引).重新平衡子树并更新统计信息",
+		"sync.(*Map[go.shape.string,go.shape.int]).LoadOrStore",
+	}
+	p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}}
+	for i, name := range names {
+		p.Sample = append(p.Sample, &profile.Sample{
+			Value:    []int64{int64(10 * (i + 1)), int64(1000000 * (i + 1))},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+		})
+	}
+	for _, format := range []string{"text", "markdown"} {
+		result, err := AnalyzeMutexProfile(p, 5, format)
+		if err != nil {
+			t.Fatalf("AnalyzeMutexProfile(%s) error = %v", format, err)
+		}
+		if !utf8.ValidString(result) {
+			t.Errorf("%s report contains invalid UTF-8:\n%q", format, result)
+		}
+		if !strings.Contains(result, "github.com/acme/服务/内部/存储.(*索引).") {
+			t.Errorf("%s report should keep whole CJK characters before the ellipsis, got:\n%s", format, result)
+		}
+	}
+}
+
+// TestCompactFormat 测试 compact 输出格式：每个函数一行，没有固定宽度的填充
+func TestCompactFormat(t *testing.T) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Value: []int64{300000000}, Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: "github.com/acme/svc/db.(*Pool).Query"}}}}}},
+			{Value: []int64{100000000}, Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: "main.main"}}}}}},
+		},
+	}
+
+	result, err := AnalyzeCPUProfile(p, 5, "compact")
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile() error = %v", err)
+	}
+	want := "cpu total=400.00ms top=2\n" +
+		"1 db.(*Pool).Query 300.00ms 75.0%\n" +
+		"2 main.main 100.00ms 25.0%\n"
+	if result != want {
+		t.Errorf("Unexpected compact output:\nGot:\n%s\nWant:\n%s", result, want)
+	}
+	if strings.Contains(result, "  ") {
+		t.Errorf("Compact output should not contain padding, got:\n%s", result)
+	}
+}
+
+// TestFunctionNameWithNewline 测试包含换行符的函数名不会破坏表格行
+func TestFunctionNameWithNewline(t *testing.T) {
+	if got := sanitizeName("main.evil\nname\twith\rcontrol"); got != "main.evil name with control" {
+		t.Errorf("sanitizeName() = %q", got)
+	}
+
+	evil := &profile.Function{Name: "main.evil\n| injected | row |"}
+	cpu := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample:     []*profile.Sample{{Value: []int64{100}, Location: []*profile.Location{{Line: []profile.Line{{Function: evil}}}}}},
+	}
+	for _, format := range []string{"text", "markdown", "compact"} {
+		result, err := AnalyzeCPUProfile(cpu, 5, format)
+		if err != nil {
+			t.Fatalf("AnalyzeCPUProfile(%s) error = %v", format, err)
+		}
+		if strings.Contains(result, "\n| injected") {
+			t.Errorf("%s: newline in function name leaked into output:\n%s", format, result)
+		}
+	}
+
+	mutex := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+		Sample:     []*profile.Sample{{Value: []int64{1, 100}, Location: []*profile.Location{{Line: []profile.Line{{Function: evil}}}}}},
+	}
+	result, err := AnalyzeMutexProfile(mutex, 5, "markdown")
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfile() error = %v", err)
+	}
+	for _, line := range strings.Split(result, "\n") {
+		if strings.Contains(line, "injected") && !strings.HasPrefix(line, "| 1 ") {
+			t.Errorf("Expected function name to stay within its table row, got line %q", line)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package analyzer
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// updateGolden 为 true 时重新生成 testdata/golden 下的期望输出: go test ./analyzer -run TestGoldenOutputs -update
+var updateGolden = flag.Bool("update", false, "regenerate golden files in testdata/golden")
+
+// goldenFixture 构造固定的 profile，函数、值和堆栈都是确定的，并且各函数的值互不相同，避免排序时出现并列
+func goldenFixture(sampleTypes [][2]string, period *profile.ValueType, rows [][]int64) *profile.Profile {
+	names := []string{"main.main", "main.handle", "encoding/json.Marshal", "runtime.mallocgc", "sync.(*Mutex).Lock"}
+	p := &profile.Profile{
+		PeriodType:    period,
+		Period:        10000000,
+		TimeNanos:     1704067200000000000, // 2024-01-01 00:00:00 UTC
+		DurationNanos: 30000000000,
+		Mapping:       []*profile.Mapping{{ID: 1, File: "/bin/app", BuildID: "golden"}},
+	}
+	for _, st := range sampleTypes {
+		p.SampleType = append(p.SampleType, &profile.ValueType{Type: st[0], Unit: st[1]})
+	}
+	var locations []*profile.Location
+	for i, name := range names {
+		fn := &profile.Function{ID: uint64(i + 1), Name: name, Filename: "app/" + name + ".go"}
+		loc := &profile.Location{ID: uint64(i + 1), Mapping: p.Mapping[0], Address: uint64(0x1000 * (i + 1)), Line: []profile.Line{{Function: fn, Line: int64(10 * (i + 1))}}}
+		p.Function = append(p.Function, fn)
+		p.Location = append(p.Location, loc)
+		locations = append(locations, loc)
+	}
+	// 每行的最后一个元素是叶子函数的下标，其余元素是样本值；堆栈从叶子一直到 main.main
+	for _, row := range rows {
+		values, leaf := row[:len(row)-1], int(row[len(row)-1])
+		s := &profile.Sample{Value: values}
+		for i := leaf; i >= 0; i-- {
+			s.Location = append(s.Location, locations[i])
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	return p
+}
+
+// TestGoldenOutputs 将每个分析器在所有输出格式下的完整输出与 testdata/golden 中的文件逐字节比较，
+// 以便发现子串检查无法发现的格式变化。输出有意变化时使用 -update 重新生成并检查 diff。
+func TestGoldenOutputs(t *testing.T) {
+	cpu := goldenFixture([][2]string{{"samples", "count"}, {"cpu", "nanoseconds"}}, &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		[][]int64{{120, 1200000000, 2}, {45, 450000000, 1}, {30, 300000000, 3}, {7, 70000000, 0}})
+	heap := goldenFixture([][2]string{{"alloc_objects", "count"}, {"alloc_space", "bytes"}, {"inuse_objects", "count"}, {"inuse_space", "bytes"}},
+		&profile.ValueType{Type: "space", Unit: "bytes"},
+		[][]int64{{9000, 48 << 20, 300, 6 << 20, 3}, {2500, 9 << 20, 40, 1 << 20, 2}, {700, 512 << 10, 15, 96 << 10, 1}})
+	heap.Period = 512 * 1024 // runtime.MemProfileRate 的默认值
+	goroutine := goldenFixture([][2]string{{"goroutine", "count"}}, &profile.ValueType{Type: "goroutine", Unit: "count"},
+		[][]int64{{250, 4}, {12, 2}, {1, 0}})
+	contention := goldenFixture([][2]string{{"contentions", "count"}, {"delay", "nanoseconds"}}, &profile.ValueType{Type: "contentions", Unit: "count"},
+		[][]int64{{800, 950000000, 4}, {120, 40000000, 2}, {9, 3000000, 1}})
+
+	type analyzeFunc func(*profile.Profile, int, string) (string, error)
+	cases := []struct {
+		name    string
+		analyze analyzeFunc
+		p       *profile.Profile
+		formats []string
+	}{
+		{"cpu", AnalyzeCPUProfile, cpu, []string{"text", "markdown", "json", "compact", "summary", "flamegraph-json"}},
+		{"heap", AnalyzeHeapProfile, heap, []string{"text", "markdown", "json", "compact", "summary", "flamegraph-json"}},
+		{"allocs", AnalyzeAllocsProfile, heap, []string{"text", "markdown", "json", "compact", "summary", "flamegraph-json"}},
+		{"goroutine", AnalyzeGoroutineProfile, goroutine, []string{"text", "markdown", "json", "compact", "summary"}},
+		{"mutex", AnalyzeMutexProfile, contention, []string{"text", "markdown", "json", "compact", "summary"}},
+		{"block", AnalyzeBlockProfile, contention, []string{"text", "markdown", "json", "compact", "summary"}},
+	}
+
+	for _, c := range cases {
+		for _, format := range c.formats {
+			t.Run(c.name+"/"+format, func(t *testing.T) {
+				got, err := c.analyze(c.p, 10, format)
+				if err != nil {
+					t.Fatalf("analyze error = %v", err)
+				}
+				// 同一输入必须总是得到相同的输出，否则 golden 文件不稳定
+				if again, _ := c.analyze(c.p, 10, format); again != got {
+					t.Fatalf("output is not deterministic:\n%s\n---\n%s", got, again)
+				}
+
+				path := filepath.Join("testdata", "golden", c.name+"."+format+".golden")
+				if *updateGolden {
+					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("missing golden file %s (run with -update to create it): %v", path, err)
+				}
+				if got != string(want) {
+					t.Errorf("output differs from %s (run with -update if the change is intended)\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+				}
+			})
+		}
+	}
+}
+
+// TestStructuredStats 测试 ...Stats 返回的结构化结果，以及 Format...Result 与对应的 Analyze... 输出完全一致
+func TestStructuredStats(t *testing.T) {
+	cpu := goldenFixture([][2]string{{"samples", "count"}, {"cpu", "nanoseconds"}}, &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		[][]int64{{120, 1200000000, 2}, {45, 450000000, 1}, {30, 300000000, 3}, {7, 70000000, 0}})
+	contention := goldenFixture([][2]string{{"contentions", "count"}, {"delay", "nanoseconds"}}, &profile.ValueType{Type: "contentions", Unit: "count"},
+		[][]int64{{800, 950000000, 4}, {120, 40000000, 2}, {9, 3000000, 1}})
+
+	cpuResult, err := CPUProfileStats(cpu, 2, CPUAnalysisOptions{})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	if cpuResult.TotalValue != 2020000000 || len(cpuResult.Functions) != 2 {
+		t.Fatalf("CPUProfileStats() total = %d, functions = %d, want 2020000000 and 2", cpuResult.TotalValue, len(cpuResult.Functions))
+	}
+	if top := cpuResult.Functions[0]; top.FunctionName != "encoding/json.Marshal" || top.FlatValue != 1200000000 {
+		t.Errorf("top CPU function = %s (%d), want encoding/json.Marshal (1200000000)", top.FunctionName, top.FlatValue)
+	}
+
+	mutexResult, err := MutexProfileStats(contention, 10, PrimaryMetricContentions)
+	if err != nil {
+		t.Fatalf("MutexProfileStats() error = %v", err)
+	}
+	if mutexResult.TotalContentions != 929 || len(mutexResult.Contentions) != 3 {
+		t.Fatalf("MutexProfileStats() contentions = %d, entries = %d, want 929 and 3", mutexResult.TotalContentions, len(mutexResult.Contentions))
+	}
+	if top := mutexResult.Contentions[0]; top.FunctionName != "sync.(*Mutex).Lock" || top.AvgDelayNanos != 950000000/800 {
+		t.Errorf("top mutex entry = %s (avg %d), want sync.(*Mutex).Lock (avg %d)", top.FunctionName, top.AvgDelayNanos, 950000000/800)
+	}
+
+	blockResult, err := BlockProfileStats(contention, 10, PrimaryMetricDelay)
+	if err != nil {
+		t.Fatalf("BlockProfileStats() error = %v", err)
+	}
+
+	// Format...Result(...Stats(p)) 必须与 Analyze... 的输出逐字节相同
+	type pair struct {
+		name    string
+		analyze func(string) (string, error)
+		format  func(string) (string, error)
+	}
+	pairs := []pair{
+		{"cpu", func(f string) (string, error) { return AnalyzeCPUProfile(cpu, 2, f) }, func(f string) (string, error) { return FormatCPUResult(cpuResult, f) }},
+		{"mutex", func(f string) (string, error) {
+			return AnalyzeMutexProfileByMetric(contention, 10, f, PrimaryMetricContentions)
+		}, func(f string) (string, error) { return FormatMutexResult(mutexResult, f) }},
+		{"block", func(f string) (string, error) { return AnalyzeBlockProfile(contention, 10, f) }, func(f string) (string, error) { return FormatBlockResult(blockResult, f) }},
+	}
+	for _, pr := range pairs {
+		for _, format := range []string{"text", "markdown", "json", "compact"} {
+			want, err := pr.analyze(format)
+			if err != nil {
+				t.Fatalf("%s analyze(%s) error = %v", pr.name, format, err)
+			}
+			got, err := pr.format(format)
+			if err != nil {
+				t.Fatalf("%s format(%s) error = %v", pr.name, format, err)
+			}
+			if got != want {
+				t.Errorf("%s/%s: formatted result differs from analyzer output\n--- got ---\n%s\n--- want ---\n%s", pr.name, format, got, want)
+			}
+		}
+	}
+
+	if _, err := FormatCPUResult(cpuResult, "flamegraph-json"); err == nil {
+		t.Error("FormatCPUResult(flamegraph-json) should report an unsupported format")
+	}
+}
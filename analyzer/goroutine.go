@@ -1,9 +1,9 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 
@@ -14,73 +14,57 @@ import (
 // stackInfo 保存有关唯一 goroutine 堆栈跟踪的信息。
 // 注意：保持未导出，因为它只在包内部使用。
 type stackInfo struct {
-	Stack []string // 格式化的堆栈跟踪行
-	Count int64    // 具有此堆栈的 goroutine 数量
+	Key     string   // 堆栈签名 (所有帧的函数、文件和行号，含内联帧)
+	Stack   []string // 格式化的堆栈跟踪行
+	Count   int64    // 具有此堆栈的 goroutine 数量
+	Samples int      // 合并到此堆栈的样本数
+}
+
+// GoroutineAnalysisOptions 定义 Goroutine 分析的可选参数
+type GoroutineAnalysisOptions struct {
+	// Numbers 是报告中数值的格式 (见 NumberStyles)，零值为 NumberStyleHuman。
+	// goroutine 数量总是整数，只影响采集配置中的 MemProfileRate 等数值
+	Numbers NumberFormatter
 }
 
 // AnalyzeGoroutineProfile 分析 Goroutine profile 并返回格式化结果。
 func AnalyzeGoroutineProfile(p *profile.Profile, topN int, format string) (string, error) {
-	log.Printf("Analyzing Goroutine profile (Top %d, Format: %s)", topN, format)
+	return AnalyzeGoroutineProfileContext(context.Background(), p, topN, format, GoroutineAnalysisOptions{})
+}
+
+// AnalyzeGoroutineProfileContext 与 AnalyzeGoroutineProfile 相同，但接受可选参数，并在聚合堆栈时定期检查 ctx，ctx 被取消时尽快停止
+func AnalyzeGoroutineProfileContext(ctx context.Context, p *profile.Profile, topN int, format string, opts GoroutineAnalysisOptions) (string, error) {
+	logDebug("Analyzing Goroutine profile (Top %d, Format: %s)", topN, format)
+	result, err := GoroutineProfileStatsContext(ctx, p, topN)
+	if err != nil {
+		return "", err
+	}
+	result.numbers = opts.Numbers
+	return FormatGoroutineResult(result, format)
+}
+
+// GoroutineProfileStats 按堆栈签名聚合 Goroutine profile，返回 goroutine 数量最多的 topN 个堆栈的结构化结果，
+// 供需要直接使用数值的调用方使用。调用栈完全相同的样本合并为一组，UniqueStacks 是去重后的堆栈数。结果中的 TopN 是请求的数量。
+func GoroutineProfileStats(p *profile.Profile, topN int) (*GoroutineAnalysisResult, error) {
+	return GoroutineProfileStatsContext(context.Background(), p, topN)
+}
 
+// GoroutineProfileStatsContext 与 GoroutineProfileStats 相同，但在聚合堆栈时定期检查 ctx，ctx 被取消时返回包装了 ctx.Err() 的错误
+func GoroutineProfileStatsContext(ctx context.Context, p *profile.Profile, topN int) (*GoroutineAnalysisResult, error) {
 	// --- 1. 确定 Goroutine 计数的样本值索引 ---
 	// Goroutine profile 通常只有一个样本类型："goroutines" / "count"
-	valueIndex := 0 // 假设第一个样本类型是 goroutine 计数
-	if len(p.SampleType) == 0 {
-		return "", fmt.Errorf("goroutine profile 没有样本类型")
-	}
-	if p.SampleType[0].Type != "goroutines" {
-		log.Printf("Warning: Expected 'goroutines' sample type, found: %v. Using index 0.", p.SampleType)
+	valueIndex, _, err := findValueColumn(p, "goroutine")
+	if err != nil {
+		return nil, fmt.Errorf("goroutine profile 没有样本类型")
 	}
 	valueType := p.SampleType[valueIndex].Type
 	valueUnit := p.SampleType[valueIndex].Unit
-	log.Printf("使用索引 %d (%s/%s) 进行 Goroutine 分析", valueIndex, valueType, valueUnit)
+	logDebug("使用索引 %d (%s/%s) 进行 Goroutine 分析", valueIndex, valueType, valueUnit)
 
 	// --- 2. 按堆栈跟踪聚合 Goroutine ---
-	stackCounts := make(map[string]*stackInfo) // Map 的键是堆栈的字符串表示形式
-	totalGoroutines := int64(0)
-
-	for _, s := range p.Sample {
-		if len(s.Value) > valueIndex {
-			count := s.Value[valueIndex] // 此堆栈的 Goroutine 数量
-			totalGoroutines += count
-
-			var stackKey strings.Builder
-			var formattedStack []string
-			// 同时构建字符串键和格式化的堆栈
-			// 遍历样本堆栈跟踪中的 location
-			// location 通常按从最新到最旧的帧排序
-			for _, loc := range s.Location {
-				// 每个 location 可能有多行 (由于内联)
-				// 为了简化聚合键，我们只取第一行
-				if len(loc.Line) > 0 {
-					line := loc.Line[0] // 使用第一行信息
-					if line.Function != nil {
-						funcName := line.Function.Name
-						fileName := line.Function.Filename
-						lineNumber := line.Line
-						// 格式化用于显示
-						lineStr := fmt.Sprintf("%s\n\t%s:%d", funcName, fileName, lineNumber)
-						formattedStack = append(formattedStack, lineStr)
-						// 格式化用于唯一键 (不易受微小格式更改影响)
-						keyLine := fmt.Sprintf("%s;%s;%d", funcName, fileName, lineNumber)
-						stackKey.WriteString(keyLine)
-						stackKey.WriteRune('|') // 键的唯一性分隔符
-					}
-				}
-			}
-
-			key := stackKey.String()
-			if key == "" { // 跳过没有 location 信息的样本
-				continue
-			}
-
-			if info, ok := stackCounts[key]; ok {
-				info.Count += count
-			} else {
-				// 仅当键是新的时候才存储格式化的堆栈
-				stackCounts[key] = &stackInfo{Stack: formattedStack, Count: count}
-			}
-		}
+	stackCounts, totalGoroutines, err := aggregateGoroutineStacksContext(ctx, p, valueIndex)
+	if err != nil {
+		return nil, err
 	}
 
 	// --- 3. 按 Goroutine 数量对堆栈进行排序 ---
@@ -89,29 +73,79 @@ func AnalyzeGoroutineProfile(p *profile.Profile, topN int, format string) (strin
 		stats = append(stats, info)
 	}
 	sort.Slice(stats, func(i, j int) bool {
-		return stats[i].Count > stats[j].Count // 降序排列
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count // 降序排列
+		}
+		return stats[i].Key < stats[j].Key // 数量相同时按签名排序，保证输出稳定
 	})
 
-	// --- 4. 格式化输出 ---
-	var b strings.Builder
 	limit := topN
 	if limit > len(stats) {
 		limit = len(stats)
 	}
+	result := &GoroutineAnalysisResult{ // 使用 types.go 中的结构体
+		ProfileType:     "goroutine",
+		ValueType:       valueType,
+		ValueUnit:       valueUnit,
+		TotalGoroutines: totalGoroutines,
+		UniqueStacks:    len(stats),
+		TopN:            topN,
+		Stacks:          make([]GoroutineStackInfo, 0, limit), // 使用 types.go 中的结构体
+		CaptureConfig:   ParseCaptureConfig(p),
+		StateBreakdown:  goroutineStateBreakdown(p, valueIndex),
+		SkippedSamples:  countSkippedSamples(p, valueIndex),
+	}
+	running := int64(0)
+	for i := 0; i < limit; i++ {
+		running += stats[i].Count
+		result.Stacks = append(result.Stacks, GoroutineStackInfo{ // 使用 types.go 中的结构体
+			Count:         stats[i].Count,
+			Samples:       stats[i].Samples,
+			Percentage:    percentOf(stats[i].Count, totalGoroutines),
+			SumPercentage: percentOf(running, totalGoroutines),
+			StackTrace:    stats[i].Stack, // 直接使用已格式化的堆栈
+		})
+	}
+	return result, nil
+}
+
+// FormatGoroutineResult 将 GoroutineProfileStats 的结果格式化为 text、markdown、json、compact 或 summary 输出。
+func FormatGoroutineResult(result *GoroutineAnalysisResult, format string) (string, error) {
+	// --- 4. 格式化输出 ---
+	var b strings.Builder
+	totalGoroutines := result.TotalGoroutines
+	capture := result.CaptureConfig
 
 	switch format {
 	case "text", "markdown":
 		if format == "markdown" {
 			b.WriteString("```text\n")
 		}
-		b.WriteString(fmt.Sprintf("Goroutine Profile Analysis (Top %d Stacks by Count)\n", topN))
-		b.WriteString(fmt.Sprintf("Total Goroutines (%s/%s): %d\n", valueType, valueUnit, totalGoroutines))
+		b.WriteString(fmt.Sprintf("Goroutine Profile Analysis (Top %d Stacks by Count)\n", result.TopN))
+		b.WriteString(fmt.Sprintf("Total Goroutines (%s/%s): %d\n", result.ValueType, result.ValueUnit, totalGoroutines))
+		b.WriteString(fmt.Sprintf("Unique Stacks: %d\n", result.UniqueStacks))
+		if capture != nil {
+			b.WriteString(fmt.Sprintf("Capture Config: %s\n", capture.format(result.numbers)))
+		}
+		if result.SkippedSamples != nil {
+			b.WriteString(fmt.Sprintf("Skipped: %s\n", result.SkippedSamples))
+		}
+		if len(result.StateBreakdown) > 0 {
+			// 状态分布：例如一眼看出 "5000 个 goroutine 阻塞在 chan receive"
+			b.WriteString("Goroutine States:\n")
+			for _, s := range sortedGoroutineStates(result.StateBreakdown) {
+				b.WriteString(fmt.Sprintf("  %8d  %s\n", s.Count, s.State))
+			}
+		}
 		b.WriteString("--------------------------------------------------\n")
-		for i := 0; i < limit; i++ {
-			stat := stats[i]
-			b.WriteString(fmt.Sprintf("\n%d goroutines with stack:\n", stat.Count))
+		for _, stat := range result.Stacks {
+			merged := ""
+			if stat.Samples > 1 {
+				merged = fmt.Sprintf(" (merged from %d samples)", stat.Samples)
+			}
+			b.WriteString(fmt.Sprintf("\n%d goroutines (%.2f%%, Sum%% %.2f%%) with stack%s:\n", stat.Count, stat.Percentage, stat.SumPercentage, merged))
 			// 打印堆栈跟踪
-			for _, line := range stat.Stack {
+			for _, line := range stat.StackTrace {
 				b.WriteString(fmt.Sprintf("  %s\n", line)) // 缩进堆栈行
 			}
 			b.WriteString("--------------------------------------------------\n")
@@ -119,27 +153,26 @@ func AnalyzeGoroutineProfile(p *profile.Profile, topN int, format string) (strin
 		if format == "markdown" {
 			b.WriteString("```\n")
 		}
-	case "json":
-		result := GoroutineAnalysisResult{ // 使用 types.go 中的结构体
-			ProfileType:     "goroutine",
-			TotalGoroutines: totalGoroutines,
-			TopN:            limit,
-			Stacks:          make([]GoroutineStackInfo, 0, limit), // 使用 types.go 中的结构体
-		}
-
-		for i := 0; i < limit; i++ {
-			stat := stats[i]
-			// 注意：这里直接复制了 stat.Stack。如果 StackInfo.Stack 在其他地方被修改，这里也会受影响。
-			// 但在这个场景下，stat 是局部变量，应该没问题。
-			result.Stacks = append(result.Stacks, GoroutineStackInfo{ // 使用 types.go 中的结构体
-				Count:      stat.Count,
-				StackTrace: stat.Stack, // 直接使用已格式化的堆栈
-			})
+	case "summary":
+		b.WriteString(formatSummary(goroutineSummary(result)))
+	case "compact":
+		rows := make([]compactRow, 0, len(result.Stacks))
+		for _, stat := range result.Stacks {
+			// 以堆栈最顶层的函数代表该堆栈
+			name := "unknown"
+			if len(stat.StackTrace) > 0 {
+				name, _, _ = strings.Cut(stat.StackTrace[0], "\n")
+			}
+			rows = append(rows, compactRow{Name: name, Value: fmt.Sprintf("%d", stat.Count), Percent: stat.Percentage})
 		}
-
-		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		b.WriteString(formatCompact(fmt.Sprintf("goroutine total=%d stacks=%d top=%d", totalGoroutines, result.UniqueStacks, len(result.Stacks))+capture.compactSuffix()+result.SkippedSamples.compactSuffix()+compactGoroutineStates(result.StateBreakdown), rows))
+	case "json":
+		// JSON 中的 topN 是实际返回的堆栈数量
+		output := *result
+		output.TopN = len(result.Stacks)
+		jsonBytes, err := json.MarshalIndent(output, "", "  ")
 		if err != nil {
-			log.Printf("Error marshaling Goroutine analysis to JSON: %v", err)
+			logError("Error marshaling Goroutine analysis to JSON: %v", err)
 			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal result to JSON: %v", err)} // 使用 types.go 中的结构体
 			errJsonBytes, _ := json.Marshal(errorResult)
 			return string(errJsonBytes), nil
@@ -151,3 +184,63 @@ func AnalyzeGoroutineProfile(p *profile.Profile, topN int, format string) (strin
 
 	return b.String(), nil
 }
+
+// aggregateGoroutineStacks 按堆栈签名聚合 goroutine，返回以签名为键的统计和 goroutine 总数。
+// 签名包含每个 location 的所有行 (内联帧)，只有调用栈完全相同的样本才会合并。
+func aggregateGoroutineStacks(p *profile.Profile, valueIndex int) (map[string]*stackInfo, int64) {
+	stackCounts, totalGoroutines, _ := aggregateGoroutineStacksContext(context.Background(), p, valueIndex) // context.Background() 不会被取消，不会返回错误
+	return stackCounts, totalGoroutines
+}
+
+// aggregateGoroutineStacksContext 与 aggregateGoroutineStacks 相同，但定期检查 ctx，ctx 被取消时返回包装了 ctx.Err() 的错误
+func aggregateGoroutineStacksContext(ctx context.Context, p *profile.Profile, valueIndex int) (map[string]*stackInfo, int64, error) {
+	stackCounts := make(map[string]*stackInfo) // Map 的键是堆栈的字符串表示形式
+	totalGoroutines := int64(0)
+
+	for i, s := range p.Sample {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, 0, err
+		}
+		if len(s.Value) > valueIndex {
+			count := s.Value[valueIndex] // 此堆栈的 Goroutine 数量
+			totalGoroutines += count
+
+			var stackKey strings.Builder
+			var formattedStack []string
+			// 同时构建字符串键和格式化的堆栈
+			// 遍历样本堆栈跟踪中的 location
+			// location 通常按从最新到最旧的帧排序
+			for _, loc := range s.Location {
+				// 每个 location 可能有多行 (由于内联)，从被内联的函数到外层函数依次排列
+				for _, line := range loc.Line {
+					if line.Function != nil {
+						funcName := line.Function.Name
+						fileName := line.Function.Filename
+						lineNumber := line.Line
+						// 格式化用于显示
+						lineStr := fmt.Sprintf("%s\n\t%s:%d", funcName, fileName, lineNumber)
+						formattedStack = append(formattedStack, lineStr)
+						// 格式化用于唯一键 (不易受微小格式更改影响)
+						keyLine := fmt.Sprintf("%s;%s;%d", funcName, fileName, lineNumber)
+						stackKey.WriteString(keyLine)
+						stackKey.WriteRune('|') // 键的唯一性分隔符
+					}
+				}
+			}
+
+			key := stackKey.String()
+			if key == "" { // 跳过没有 location 信息的样本
+				continue
+			}
+
+			if info, ok := stackCounts[key]; ok {
+				info.Count += count
+				info.Samples++
+			} else {
+				// 仅当键是新的时候才存储格式化的堆栈，作为该组的代表堆栈
+				stackCounts[key] = &stackInfo{Key: key, Stack: formattedStack, Count: count, Samples: 1}
+			}
+		}
+	}
+	return stackCounts, totalGoroutines, nil
+}
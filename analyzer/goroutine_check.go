@@ -0,0 +1,213 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// GoroutineCheckOptions 定义 goroutine 数量健康检查的参数
+type GoroutineCheckOptions struct {
+	MaxGoroutines int64            // goroutine 总数的绝对上限，0 表示不检查
+	Baseline      *profile.Profile // 可选的基线 goroutine profile
+	MaxIncrease   int64            // 相对基线允许增长的 goroutine 数量
+	TopN          int              // 检查未通过时展示的堆栈数量
+}
+
+// GoroutineStackDelta 代表检查结果中的单个堆栈 (JSON)
+type GoroutineStackDelta struct {
+	Count         int64    `json:"count"`                   // 当前 profile 中具有此堆栈的 goroutine 数量
+	BaselineCount int64    `json:"baselineCount,omitempty"` // 基线 profile 中的数量
+	Delta         int64    `json:"delta,omitempty"`         // 相对基线的变化
+	StackTrace    []string `json:"stackTrace"`
+}
+
+// GoroutineCheckResult 代表 goroutine 健康检查的结果 (JSON)
+type GoroutineCheckResult struct {
+	Passed             bool                  `json:"passed"`
+	TotalGoroutines    int64                 `json:"totalGoroutines"`
+	MaxGoroutines      int64                 `json:"maxGoroutines,omitempty"`
+	BaselineGoroutines *int64                `json:"baselineGoroutines,omitempty"`
+	Delta              *int64                `json:"delta,omitempty"` // 相对基线的 goroutine 数量变化
+	MaxIncrease        *int64                `json:"maxIncrease,omitempty"`
+	Violations         []string              `json:"violations,omitempty"` // 未通过的原因
+	TopStacks          []GoroutineStackDelta `json:"topStacks,omitempty"`  // 仅在未通过时给出
+}
+
+// CheckGoroutines 对 goroutine profile 做轻量级的数量检查，适合周期性监控 goroutine 泄漏。
+// 可以与绝对阈值比较，也可以与基线 profile 比较；未通过时给出增长最多（或数量最多）的堆栈。
+func CheckGoroutines(p *profile.Profile, opts GoroutineCheckOptions, format string) (string, error) {
+	logDebug("Checking goroutines (Max: %d, Baseline: %t, MaxIncrease: %d, Format: %s)",
+		opts.MaxGoroutines, opts.Baseline != nil, opts.MaxIncrease, format)
+
+	if opts.MaxGoroutines <= 0 && opts.Baseline == nil {
+		return "", fmt.Errorf("either a goroutine threshold or a baseline profile is required")
+	}
+	if len(p.SampleType) == 0 {
+		return "", fmt.Errorf("goroutine profile 没有样本类型")
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = 5
+	}
+
+	current, total := aggregateGoroutineStacks(p, 0)
+	result := GoroutineCheckResult{
+		Passed:          true,
+		TotalGoroutines: total,
+		MaxGoroutines:   opts.MaxGoroutines,
+	}
+
+	if opts.MaxGoroutines > 0 && total > opts.MaxGoroutines {
+		result.Passed = false
+		result.Violations = append(result.Violations,
+			fmt.Sprintf("goroutine 总数 %d 超过阈值 %d", total, opts.MaxGoroutines))
+	}
+
+	var baseline map[string]*stackInfo
+	if opts.Baseline != nil {
+		if len(opts.Baseline.SampleType) == 0 {
+			return "", fmt.Errorf("基线 goroutine profile 没有样本类型")
+		}
+		var baselineTotal int64
+		baseline, baselineTotal = aggregateGoroutineStacks(opts.Baseline, 0)
+		delta := total - baselineTotal
+		maxIncrease := opts.MaxIncrease
+		result.BaselineGoroutines = &baselineTotal
+		result.Delta = &delta
+		result.MaxIncrease = &maxIncrease
+		if delta > maxIncrease {
+			result.Passed = false
+			result.Violations = append(result.Violations,
+				fmt.Sprintf("相对基线增加了 %d 个 goroutine，超过允许的 %d", delta, maxIncrease))
+		}
+	}
+
+	if !result.Passed {
+		result.TopStacks = topGoroutineStacks(current, baseline, opts.TopN)
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatGoroutineCheck(result, format), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// topGoroutineStacks 选出最值得关注的堆栈。
+// 有基线时按增长量排序（只保留增长的堆栈），否则按当前数量排序。
+func topGoroutineStacks(current, baseline map[string]*stackInfo, topN int) []GoroutineStackDelta {
+	type keyedStack struct {
+		key string
+		GoroutineStackDelta
+	}
+	stacks := make([]keyedStack, 0, len(current))
+	for key, info := range current {
+		entry := keyedStack{key: key, GoroutineStackDelta: GoroutineStackDelta{Count: info.Count, StackTrace: info.Stack}}
+		if baseline != nil {
+			if old, ok := baseline[key]; ok {
+				entry.BaselineCount = old.Count
+			}
+			entry.Delta = entry.Count - entry.BaselineCount
+			if entry.Delta <= 0 {
+				continue
+			}
+		}
+		stacks = append(stacks, entry)
+	}
+
+	sort.Slice(stacks, func(i, j int) bool {
+		if stacks[i].Delta != stacks[j].Delta {
+			return stacks[i].Delta > stacks[j].Delta
+		}
+		if stacks[i].Count != stacks[j].Count {
+			return stacks[i].Count > stacks[j].Count
+		}
+		return stacks[i].key < stacks[j].key
+	})
+
+	if len(stacks) > topN {
+		stacks = stacks[:topN]
+	}
+	top := make([]GoroutineStackDelta, len(stacks))
+	for i, s := range stacks {
+		top[i] = s.GoroutineStackDelta
+	}
+	return top
+}
+
+// formatGoroutineCheck 以文本或 Markdown 格式输出检查结果
+func formatGoroutineCheck(result GoroutineCheckResult, format string) string {
+	var b strings.Builder
+	status := "PASS"
+	if !result.Passed {
+		status = "FAIL"
+	}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("# Goroutine 检查: %s\n\n", status))
+		b.WriteString(fmt.Sprintf("- **Goroutine 总数**: %d\n", result.TotalGoroutines))
+		if result.MaxGoroutines > 0 {
+			b.WriteString(fmt.Sprintf("- **阈值**: %d\n", result.MaxGoroutines))
+		}
+		if result.BaselineGoroutines != nil {
+			b.WriteString(fmt.Sprintf("- **基线**: %d (变化: %+d, 允许增长: %d)\n", *result.BaselineGoroutines, *result.Delta, *result.MaxIncrease))
+		}
+		for _, v := range result.Violations {
+			b.WriteString(fmt.Sprintf("- ❌ %s\n", v))
+		}
+		if len(result.TopStacks) > 0 {
+			b.WriteString("\n## 主要堆栈\n")
+			for _, s := range result.TopStacks {
+				b.WriteString(fmt.Sprintf("\n**%d goroutines**", s.Count))
+				if s.Delta != 0 {
+					b.WriteString(fmt.Sprintf(" (%+d)", s.Delta))
+				}
+				b.WriteString("\n```text\n")
+				for _, line := range s.StackTrace {
+					b.WriteString(line + "\n")
+				}
+				b.WriteString("```\n")
+			}
+		}
+		return b.String()
+	}
+
+	b.WriteString(fmt.Sprintf("Goroutine 检查: %s\n", status))
+	b.WriteString("==================\n\n")
+	b.WriteString(fmt.Sprintf("Goroutine 总数: %d\n", result.TotalGoroutines))
+	if result.MaxGoroutines > 0 {
+		b.WriteString(fmt.Sprintf("阈值: %d\n", result.MaxGoroutines))
+	}
+	if result.BaselineGoroutines != nil {
+		b.WriteString(fmt.Sprintf("基线: %d (变化: %+d, 允许增长: %d)\n", *result.BaselineGoroutines, *result.Delta, *result.MaxIncrease))
+	}
+	for _, v := range result.Violations {
+		b.WriteString(fmt.Sprintf("未通过: %s\n", v))
+	}
+	if len(result.TopStacks) > 0 {
+		b.WriteString("\n主要堆栈:\n")
+		b.WriteString("--------------------------------------------------\n")
+		for _, s := range result.TopStacks {
+			b.WriteString(fmt.Sprintf("%d goroutines", s.Count))
+			if s.Delta != 0 {
+				b.WriteString(fmt.Sprintf(" (%+d)", s.Delta))
+			}
+			b.WriteString(" with stack:\n")
+			for _, line := range s.StackTrace {
+				b.WriteString(fmt.Sprintf("  %s\n", line))
+			}
+			b.WriteString("--------------------------------------------------\n")
+		}
+	}
+	return b.String()
+}
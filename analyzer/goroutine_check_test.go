@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// newGoroutineProfile 构造一个测试用的 goroutine profile，counts 的键为函数名
+func newGoroutineProfile(counts map[string]int64) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "goroutines", Unit: "count"}},
+	}
+	id := uint64(1)
+	for name, count := range counts {
+		fn := &profile.Function{ID: id, Name: name, Filename: "main.go"}
+		loc := &profile.Location{ID: id, Line: []profile.Line{{Function: fn, Line: 10}}}
+		p.Function = append(p.Function, fn)
+		p.Location = append(p.Location, loc)
+		p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{count}})
+		id++
+	}
+	return p
+}
+
+// TestCheckGoroutines 测试 goroutine 数量检查
+func TestCheckGoroutines(t *testing.T) {
+	baseline := newGoroutineProfile(map[string]int64{"main.worker": 10, "main.server": 2})
+	current := newGoroutineProfile(map[string]int64{"main.worker": 10, "main.server": 2, "main.leak": 50})
+
+	tests := []struct {
+		name         string
+		opts         GoroutineCheckOptions
+		wantContains []string
+		wantMissing  []string
+	}{
+		{
+			name:         "Below threshold",
+			opts:         GoroutineCheckOptions{MaxGoroutines: 100},
+			wantContains: []string{"Goroutine 检查: PASS", "Goroutine 总数: 62"},
+			wantMissing:  []string{"主要堆栈"},
+		},
+		{
+			name:         "Above threshold",
+			opts:         GoroutineCheckOptions{MaxGoroutines: 20},
+			wantContains: []string{"Goroutine 检查: FAIL", "超过阈值 20", "50 goroutines with stack", "main.leak"},
+		},
+		{
+			name:         "Growth beyond baseline",
+			opts:         GoroutineCheckOptions{Baseline: baseline, MaxIncrease: 5},
+			wantContains: []string{"FAIL", "基线: 12 (变化: +50, 允许增长: 5)", "50 goroutines (+50)"},
+			wantMissing:  []string{"main.worker"},
+		},
+		{
+			name:         "Growth within tolerance",
+			opts:         GoroutineCheckOptions{Baseline: baseline, MaxIncrease: 60},
+			wantContains: []string{"PASS", "变化: +50"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CheckGoroutines(current, tt.opts, "text")
+			if err != nil {
+				t.Fatalf("CheckGoroutines() error = %v", err)
+			}
+			for _, want := range tt.wantContains {
+				if !containsString(result, want) {
+					t.Errorf("Result does not contain expected string %q\nGot:\n%s", want, result)
+				}
+			}
+			for _, missing := range tt.wantMissing {
+				if containsString(result, missing) {
+					t.Errorf("Result should not contain %q\nGot:\n%s", missing, result)
+				}
+			}
+		})
+	}
+
+	jsonResult, err := CheckGoroutines(current, GoroutineCheckOptions{Baseline: baseline}, "json")
+	if err != nil {
+		t.Fatalf("CheckGoroutines() json error = %v", err)
+	}
+	for _, want := range []string{`"passed": false`, `"delta": 50`, `"baselineGoroutines": 12`} {
+		if !containsString(jsonResult, want) {
+			t.Errorf("JSON result does not contain %q\nGot:\n%s", want, jsonResult)
+		}
+	}
+
+	if _, err := CheckGoroutines(current, GoroutineCheckOptions{}, "text"); err == nil {
+		t.Error("Expected error when neither threshold nor baseline is given, got nil")
+	}
+}
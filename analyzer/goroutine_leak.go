@@ -0,0 +1,170 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// defaultGoroutineLeakTopN 是 goroutine 泄漏报告中列出的增长堆栈数量
+const defaultGoroutineLeakTopN = 10
+
+// GoroutineLeak 代表一个 goroutine 数量增长的堆栈 (JSON)
+type GoroutineLeak struct {
+	StartFunction   string   `json:"startFunction"`   // goroutine 的起始函数 (堆栈最外层的帧)
+	StartFunctionID string   `json:"startFunctionId"` // 起始函数的 functionId
+	BaselineCount   int64    `json:"baselineCount"`
+	TargetCount     int64    `json:"targetCount"`
+	Delta           int64    `json:"delta"`
+	NewInTarget     bool     `json:"newInTarget"` // 该堆栈只出现在 target 中
+	StackTrace      []string `json:"stackTrace"`
+}
+
+// GoroutineLeakResult 是 goroutine 泄漏检测的结果 (JSON)
+type GoroutineLeakResult struct {
+	BaselineGoroutines int64           `json:"baselineGoroutines"`
+	TargetGoroutines   int64           `json:"targetGoroutines"`
+	Delta              int64           `json:"delta"`
+	GrowingStacks      int             `json:"growingStacks"` // goroutine 数量增长的堆栈数 (含新出现的堆栈)
+	NewStacks          int             `json:"newStacks"`     // 只出现在 target 中的堆栈数
+	Leaks              []GoroutineLeak `json:"leaks"`         // 增长最多的堆栈
+}
+
+// DetectGoroutineLeaks 比较两个 goroutine profile，按堆栈对 goroutine 分组，
+// 找出 goroutine 数量增长的堆栈，并标记只出现在 target 中的堆栈。
+// protobuf 格式的 goroutine profile 不记录 "created by" 信息，因此以完整堆栈 (含最外层的起始函数) 区分创建位置。
+func DetectGoroutineLeaks(baseline, target *profile.Profile, format string) (string, error) {
+	logDebug("Detecting goroutine leaks: baseline samples=%d, target samples=%d, format=%s", len(baseline.Sample), len(target.Sample), format)
+
+	baselineIndex, _, err := findValueColumn(baseline, "goroutine")
+	if err != nil {
+		return "", fmt.Errorf("baseline: %w", err)
+	}
+	targetIndex, _, err := findValueColumn(target, "goroutine")
+	if err != nil {
+		return "", fmt.Errorf("target: %w", err)
+	}
+
+	baselineStacks, baselineTotal := aggregateGoroutineStacks(baseline, baselineIndex)
+	targetStacks, targetTotal := aggregateGoroutineStacks(target, targetIndex)
+
+	result := GoroutineLeakResult{
+		BaselineGoroutines: baselineTotal,
+		TargetGoroutines:   targetTotal,
+		Delta:              targetTotal - baselineTotal,
+	}
+	type keyedLeak struct {
+		key string
+		GoroutineLeak
+	}
+	var leaks []keyedLeak
+	for key, info := range targetStacks {
+		leak := GoroutineLeak{TargetCount: info.Count, StackTrace: info.Stack, StartFunction: goroutineStartFunction(info.Stack)}
+		leak.StartFunctionID = FunctionID(leak.StartFunction)
+		if old, ok := baselineStacks[key]; ok {
+			leak.BaselineCount = old.Count
+		} else {
+			leak.NewInTarget = true
+		}
+		leak.Delta = leak.TargetCount - leak.BaselineCount
+		if leak.Delta <= 0 {
+			continue
+		}
+		result.GrowingStacks++
+		if leak.NewInTarget {
+			result.NewStacks++
+		}
+		leaks = append(leaks, keyedLeak{key: key, GoroutineLeak: leak})
+	}
+	sort.Slice(leaks, func(i, j int) bool {
+		if leaks[i].Delta != leaks[j].Delta {
+			return leaks[i].Delta > leaks[j].Delta
+		}
+		return leaks[i].key < leaks[j].key
+	})
+	if len(leaks) > defaultGoroutineLeakTopN {
+		leaks = leaks[:defaultGoroutineLeakTopN]
+	}
+	result.Leaks = make([]GoroutineLeak, len(leaks))
+	for i, l := range leaks {
+		result.Leaks[i] = l.GoroutineLeak
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatGoroutineLeaks(result, format), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// goroutineStartFunction 返回格式化堆栈中最外层帧的函数名
+func goroutineStartFunction(stack []string) string {
+	if len(stack) == 0 {
+		return "unknown"
+	}
+	name, _, _ := strings.Cut(stack[len(stack)-1], "\n")
+	return name
+}
+
+// formatGoroutineLeaks 以文本或 Markdown 格式输出 goroutine 泄漏检测结果
+func formatGoroutineLeaks(result GoroutineLeakResult, format string) string {
+	var b strings.Builder
+	if format == "markdown" {
+		b.WriteString("# Goroutine 泄漏检测\n\n")
+		b.WriteString(fmt.Sprintf("- **Baseline goroutine 总数**: %d\n", result.BaselineGoroutines))
+		b.WriteString(fmt.Sprintf("- **Target goroutine 总数**: %d (变化: %+d)\n", result.TargetGoroutines, result.Delta))
+		b.WriteString(fmt.Sprintf("- **增长的堆栈**: %d 个 (其中 %d 个只出现在 target 中)\n", result.GrowingStacks, result.NewStacks))
+		if len(result.Leaks) == 0 {
+			b.WriteString("\n没有发现 goroutine 数量增长的堆栈。\n")
+			return b.String()
+		}
+		b.WriteString("\n## 增长最多的堆栈\n")
+		for i, l := range result.Leaks {
+			marker := ""
+			if l.NewInTarget {
+				marker = " 🆕 仅出现在 target 中"
+			}
+			b.WriteString(fmt.Sprintf("\n### %d. `%s`: %d → %d (%+d)%s\n\n", i+1, sanitizeName(l.StartFunction), l.BaselineCount, l.TargetCount, l.Delta, marker))
+			b.WriteString("```text\n")
+			for _, line := range l.StackTrace {
+				b.WriteString(line + "\n")
+			}
+			b.WriteString("```\n")
+		}
+		return b.String()
+	}
+
+	b.WriteString("Goroutine 泄漏检测\n")
+	b.WriteString("==================\n\n")
+	b.WriteString(fmt.Sprintf("Baseline goroutine 总数: %d\n", result.BaselineGoroutines))
+	b.WriteString(fmt.Sprintf("Target goroutine 总数:   %d (变化: %+d)\n", result.TargetGoroutines, result.Delta))
+	b.WriteString(fmt.Sprintf("增长的堆栈: %d 个 (其中 %d 个只出现在 target 中)\n", result.GrowingStacks, result.NewStacks))
+	if len(result.Leaks) == 0 {
+		b.WriteString("\n没有发现 goroutine 数量增长的堆栈。\n")
+		return b.String()
+	}
+	b.WriteString("\n增长最多的堆栈:\n")
+	b.WriteString("--------------------------------------------------\n")
+	for i, l := range result.Leaks {
+		marker := ""
+		if l.NewInTarget {
+			marker = " [NEW]"
+		}
+		b.WriteString(fmt.Sprintf("#%d %s: %d -> %d (%+d)%s\n", i+1, sanitizeName(l.StartFunction), l.BaselineCount, l.TargetCount, l.Delta, marker))
+		for _, line := range l.StackTrace {
+			b.WriteString(fmt.Sprintf("  %s\n", line))
+		}
+		b.WriteString("--------------------------------------------------\n")
+	}
+	return b.String()
+}
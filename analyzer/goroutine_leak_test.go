@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestDetectGoroutineLeaks 测试按堆栈比较 goroutine 数量、排序及新堆栈标记
+func TestDetectGoroutineLeaks(t *testing.T) {
+	frame := func(name string, line int64) *profile.Location {
+		return &profile.Location{Line: []profile.Line{{Function: &profile.Function{Name: name, Filename: "main.go"}, Line: line}}}
+	}
+	park := frame("runtime.gopark", 1)
+	stack := func(count int64, root string) *profile.Sample {
+		return &profile.Sample{Value: []int64{count}, Location: []*profile.Location{park, frame(root, 10)}}
+	}
+	newProfile := func(samples ...*profile.Sample) *profile.Profile {
+		return &profile.Profile{SampleType: []*profile.ValueType{{Type: "goroutine", Unit: "count"}}, Sample: samples}
+	}
+
+	baseline := newProfile(stack(10, "main.worker"), stack(5, "main.poller"), stack(3, "main.shrinking"))
+	target := newProfile(stack(110, "main.worker"), stack(5, "main.poller"), stack(1, "main.shrinking"), stack(20, "main.leaky"))
+
+	out, err := DetectGoroutineLeaks(baseline, target, "json")
+	if err != nil {
+		t.Fatalf("DetectGoroutineLeaks() error = %v", err)
+	}
+	var result GoroutineLeakResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if result.BaselineGoroutines != 18 || result.TargetGoroutines != 136 || result.Delta != 118 {
+		t.Errorf("Unexpected totals: %+v", result)
+	}
+	// 只有增长的堆栈会被列出，按增量排序
+	if result.GrowingStacks != 2 || result.NewStacks != 1 || len(result.Leaks) != 2 {
+		t.Fatalf("Unexpected leaks: %+v", result)
+	}
+	if l := result.Leaks[0]; l.StartFunction != "main.worker" || l.BaselineCount != 10 || l.TargetCount != 110 || l.Delta != 100 || l.NewInTarget {
+		t.Errorf("Unexpected first leak: %+v", l)
+	}
+	if l := result.Leaks[1]; l.StartFunction != "main.leaky" || l.Delta != 20 || !l.NewInTarget {
+		t.Errorf("Unexpected second leak: %+v", l)
+	}
+
+	text, err := DetectGoroutineLeaks(baseline, target, "markdown")
+	if err != nil {
+		t.Fatalf("DetectGoroutineLeaks() error = %v", err)
+	}
+	for _, want := range []string{"# Goroutine 泄漏检测", "`main.worker`: 10 → 110 (+100)", "`main.leaky`: 0 → 20 (+20) 🆕"} {
+		if !containsString(text, want) {
+			t.Errorf("Markdown result does not contain %q\nGot:\n%s", want, text)
+		}
+	}
+
+	// 没有增长时给出明确的结论
+	text, err = DetectGoroutineLeaks(baseline, baseline, "text")
+	if err != nil {
+		t.Fatalf("DetectGoroutineLeaks() error = %v", err)
+	}
+	if !containsString(text, "没有发现 goroutine 数量增长的堆栈") {
+		t.Errorf("Expected a no-growth message\nGot:\n%s", text)
+	}
+}
@@ -0,0 +1,151 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	// goroutineStateRunning 是没有停在任何已知等待点上的 goroutine 的状态 (正在运行或等待调度)
+	goroutineStateRunning = "running/runnable"
+	// goroutineStateWaiting 是已经 park 但无法识别等待原因的 goroutine 的状态
+	goroutineStateWaiting = "waiting"
+	// goroutineStateUnknown 是没有调用栈的样本的状态
+	goroutineStateUnknown = "unknown"
+)
+
+// goroutineWaitFrames 将 runtime 和标准库中的等待函数映射为 goroutine 状态，名称与 debug=2 goroutine dump 中的等待原因一致。
+// 从叶子帧开始查找，离叶子最近的匹配帧决定状态。
+var goroutineWaitFrames = map[string]string{
+	"runtime.chanrecv":                   "chan receive",
+	"runtime.chanrecv1":                  "chan receive",
+	"runtime.chanrecv2":                  "chan receive",
+	"runtime.chansend":                   "chan send",
+	"runtime.chansend1":                  "chan send",
+	"runtime.selectgo":                   "select",
+	"runtime.block":                      "select (no cases)",
+	"runtime.netpollblock":               "IO wait",
+	"internal/poll.runtime_pollWait":     "IO wait",
+	"runtime.timeSleep":                  "sleep",
+	"time.Sleep":                         "sleep",
+	"sync.(*Mutex).lockSlow":             "sync.Mutex.Lock",
+	"internal/sync.(*Mutex).lockSlow":    "sync.Mutex.Lock",
+	"sync.(*RWMutex).RLock":              "sync.RWMutex.RLock",
+	"sync.(*RWMutex).Lock":               "sync.RWMutex.Lock",
+	"sync.(*Cond).Wait":                  "sync.Cond.Wait",
+	"sync.(*WaitGroup).Wait":             "sync.WaitGroup.Wait",
+	"runtime.gcAssistAlloc":              "GC assist wait",
+	"runtime.goroutineProfileWithLabels": goroutineStateRunning, // 采集 profile 的 goroutine 自身
+}
+
+// goroutineFallbackFrames 是在调用栈中没有 goroutineWaitFrames 中的函数时使用的较粗粒度的等待点
+// (信号量、系统调用和 runtime 的后台 goroutine)
+var goroutineFallbackFrames = map[string]string{
+	"sync.(*Mutex).Lock":                "sync.Mutex.Lock",
+	"runtime.semacquire1":               "semacquire",
+	"sync.runtime_Semacquire":           "semacquire",
+	"sync.runtime_SemacquireMutex":      "semacquire",
+	"sync.runtime_SemacquireRWMutex":    "semacquire",
+	"sync.runtime_SemacquireRWMutexR":   "semacquire",
+	"sync.runtime_SemacquireWaitGroup":  "semacquire",
+	"runtime.notifyListWait":            "sync.Cond.Wait",
+	"sync.runtime_notifyListWait":       "sync.Cond.Wait",
+	"syscall.Syscall":                   "syscall",
+	"syscall.Syscall6":                  "syscall",
+	"syscall.RawSyscall":                "syscall",
+	"syscall.RawSyscall6":               "syscall",
+	"syscall.syscall":                   "syscall",
+	"syscall.syscall6":                  "syscall",
+	"internal/runtime/syscall.Syscall6": "syscall",
+	"runtime.cgocall":                   "syscall",
+	"runtime.gcBgMarkWorker":            "GC worker (idle)",
+	"runtime.bgsweep":                   "GC sweep wait",
+	"runtime.bgscavenge":                "GC scavenge wait",
+	"runtime.forcegchelper":             "force gc (idle)",
+	"runtime.runfinq":                   "finalizer wait",
+}
+
+// goroutineState 根据调用栈顶部的 runtime 帧推断 goroutine 的状态。
+// protobuf 格式的 goroutine profile 不记录状态，因此按 goroutine 停下时所在的等待函数 (chanrecv、selectgo 等) 推断；
+// 停在 runtime.gopark 但无法识别原因时为 "waiting"，没有等待函数时为 "running/runnable"。
+func goroutineState(s *profile.Sample) string {
+	if len(s.Location) == 0 {
+		return goroutineStateUnknown
+	}
+	var fallback string
+	parked := false
+	for _, loc := range s.Location {
+		// 内联帧按从内到外的顺序排列，同样从叶子开始查找
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			name := line.Function.Name
+			if state, ok := goroutineWaitFrames[name]; ok {
+				return state
+			}
+			if state, ok := goroutineFallbackFrames[name]; ok && fallback == "" {
+				fallback = state
+			}
+			if name == "runtime.gopark" || name == "runtime.goparkunlock" {
+				parked = true
+			}
+		}
+	}
+	switch {
+	case fallback != "":
+		return fallback
+	case parked:
+		return goroutineStateWaiting
+	default:
+		return goroutineStateRunning
+	}
+}
+
+// goroutineStateBreakdown 统计每种状态的 goroutine 数量
+func goroutineStateBreakdown(p *profile.Profile, valueIndex int) map[string]int {
+	breakdown := make(map[string]int)
+	for _, s := range p.Sample {
+		if len(s.Value) > valueIndex {
+			breakdown[goroutineState(s)] += int(s.Value[valueIndex])
+		}
+	}
+	return breakdown
+}
+
+// goroutineStateCount 是一种状态及其 goroutine 数量
+type goroutineStateCount struct {
+	State string
+	Count int
+}
+
+// sortedGoroutineStates 按 goroutine 数量降序 (数量相同时按状态名) 返回状态分布
+func sortedGoroutineStates(breakdown map[string]int) []goroutineStateCount {
+	states := make([]goroutineStateCount, 0, len(breakdown))
+	for state, count := range breakdown {
+		states = append(states, goroutineStateCount{State: state, Count: count})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Count != states[j].Count {
+			return states[i].Count > states[j].Count
+		}
+		return states[i].State < states[j].State
+	})
+	return states
+}
+
+// compactGoroutineStates 返回 compact 输出头部的状态分布，例如 " states=chan_receive:5000,select:12"，
+// 状态名中的空格替换为下划线，使头部仍然是以空格分隔的 key=value
+func compactGoroutineStates(breakdown map[string]int) string {
+	if len(breakdown) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(breakdown))
+	for _, s := range sortedGoroutineStates(breakdown) {
+		parts = append(parts, fmt.Sprintf("%s:%d", strings.ReplaceAll(s.State, " ", "_"), s.Count))
+	}
+	return " states=" + strings.Join(parts, ",")
+}
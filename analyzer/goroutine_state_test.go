@@ -0,0 +1,85 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestGoroutineStateBreakdown 测试按调用栈顶部的 runtime 帧推断 goroutine 状态并汇总到所有输出格式中
+func TestGoroutineStateBreakdown(t *testing.T) {
+	frame := func(name string) *profile.Location {
+		return &profile.Location{Line: []profile.Line{{Function: &profile.Function{Name: name, Filename: "x.go"}}}}
+	}
+	stack := func(count int64, names ...string) *profile.Sample {
+		s := &profile.Sample{Value: []int64{count}}
+		for _, name := range names {
+			s.Location = append(s.Location, frame(name))
+		}
+		return s
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "goroutine", Unit: "count"}},
+		Sample: []*profile.Sample{
+			stack(5000, "runtime.gopark", "runtime.chanrecv", "runtime.chanrecv1", "main.consumer"),
+			stack(12, "runtime.gopark", "runtime.selectgo", "main.loop"),
+			stack(7, "runtime.gopark", "runtime.netpollblock", "internal/poll.runtime_pollWait", "net.(*conn).Read"),
+			// 信号量只是粗粒度的等待点，上层的 sync.(*WaitGroup).Wait 更具体
+			stack(3, "runtime.gopark", "runtime.semacquire1", "sync.runtime_SemacquireWaitGroup", "sync.(*WaitGroup).Wait", "main.main"),
+			stack(2, "runtime.gopark", "runtime.semacquire1", "sync.runtime_Semacquire", "main.custom"),
+			stack(1, "runtime.gopark", "main.unknownWait"),
+			stack(1, "main.busy"),
+		},
+	}
+
+	want := map[string]int{
+		"chan receive":        5000,
+		"select":              12,
+		"IO wait":             7,
+		"sync.WaitGroup.Wait": 3,
+		"semacquire":          2,
+		"waiting":             1,
+		"running/runnable":    1,
+	}
+	result, err := GoroutineProfileStats(p, 10)
+	if err != nil {
+		t.Fatalf("GoroutineProfileStats() error = %v", err)
+	}
+	if len(result.StateBreakdown) != len(want) {
+		t.Errorf("StateBreakdown = %v, want %v", result.StateBreakdown, want)
+	}
+	for state, count := range want {
+		if result.StateBreakdown[state] != count {
+			t.Errorf("StateBreakdown[%q] = %d, want %d", state, result.StateBreakdown[state], count)
+		}
+	}
+
+	out, err := FormatGoroutineResult(result, "json")
+	if err != nil {
+		t.Fatalf("FormatGoroutineResult(json) error = %v", err)
+	}
+	var decoded GoroutineAnalysisResult
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if decoded.StateBreakdown["chan receive"] != 5000 {
+		t.Errorf("JSON stateBreakdown = %v", decoded.StateBreakdown)
+	}
+
+	text, err := FormatGoroutineResult(result, "text")
+	if err != nil {
+		t.Fatalf("FormatGoroutineResult(text) error = %v", err)
+	}
+	if !containsString(text, "Goroutine States:\n      5000  chan receive\n        12  select\n") {
+		t.Errorf("Expected the state histogram sorted by count, got:\n%s", text)
+	}
+
+	compact, err := FormatGoroutineResult(result, "compact")
+	if err != nil {
+		t.Fatalf("FormatGoroutineResult(compact) error = %v", err)
+	}
+	if !containsString(compact, " states=chan_receive:5000,select:12,IO_wait:7,") {
+		t.Errorf("Expected the compact header to carry the states, got:\n%s", compact)
+	}
+}
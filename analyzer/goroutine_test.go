@@ -0,0 +1,51 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestGoroutineStackDeduplication 测试调用栈完全相同的样本按 goroutine 数合并为一组，并按数量降序报告代表堆栈
+func TestGoroutineStackDeduplication(t *testing.T) {
+	lock := &profile.Function{ID: 1, Name: "sync.(*Mutex).Lock", Filename: "sync/mutex.go"}
+	worker := &profile.Function{ID: 2, Name: "main.worker", Filename: "main.go"}
+	inlined := &profile.Function{ID: 3, Name: "main.acquire", Filename: "main.go"}
+	lockLoc := &profile.Location{ID: 1, Line: []profile.Line{{Function: lock, Line: 81}}}
+	workerLoc := &profile.Location{ID: 2, Line: []profile.Line{{Function: worker, Line: 10}}}
+	// 内联帧不同的调用栈不能与 workerLoc 合并，即使外层帧相同
+	inlinedLoc := &profile.Location{ID: 3, Line: []profile.Line{{Function: inlined, Line: 5}, {Function: worker, Line: 10}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "goroutine", Unit: "count"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{lockLoc, workerLoc}, Value: []int64{4000}},
+			{Location: []*profile.Location{lockLoc, inlinedLoc}, Value: []int64{7000}},
+			{Location: []*profile.Location{lockLoc, workerLoc}, Value: []int64{6000}},
+			{Location: []*profile.Location{workerLoc}, Value: []int64{1}},
+		},
+	}
+
+	result, err := GoroutineProfileStats(p, 10)
+	if err != nil {
+		t.Fatalf("GoroutineProfileStats() error = %v", err)
+	}
+	if result.TotalGoroutines != 17001 || result.UniqueStacks != 3 || len(result.Stacks) != 3 {
+		t.Fatalf("total = %d, unique stacks = %d, stacks = %d; want 17001, 3, 3", result.TotalGoroutines, result.UniqueStacks, len(result.Stacks))
+	}
+	top := result.Stacks[0]
+	if top.Count != 10000 || top.Samples != 2 || len(top.StackTrace) != 2 || !strings.HasPrefix(top.StackTrace[1], "main.worker") {
+		t.Errorf("top stack = %+v, want 10000 goroutines merged from 2 samples", top)
+	}
+	if second := result.Stacks[1]; second.Count != 7000 || second.Samples != 1 || len(second.StackTrace) != 3 || !strings.HasPrefix(second.StackTrace[1], "main.acquire") {
+		t.Errorf("second stack = %+v, want the inlined stack with 3 frames", second)
+	}
+
+	text, _ := FormatGoroutineResult(result, "text")
+	if !strings.Contains(text, "Unique Stacks: 3") || !strings.Contains(text, "10000 goroutines (58.82%, Sum% 58.82%) with stack (merged from 2 samples):") {
+		t.Errorf("text output missing deduplication summary:\n%s", text)
+	}
+	if compact, _ := FormatGoroutineResult(result, "compact"); !strings.Contains(compact, "goroutine total=17001 stacks=3 top=3") {
+		t.Errorf("compact output missing unique stack count:\n%s", compact)
+	}
+}
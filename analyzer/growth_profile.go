@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// GrowthSampleType 是合成的增长率 profile 使用的样本类型
+const GrowthSampleType = "growth_bytes_per_min"
+
+// HeapGrowthInfo 描述合成增长率 profile 时使用的时间信息
+type HeapGrowthInfo struct {
+	TimeSpanMinutes     float64 // 第一个到最后一个 profile 的时间跨度
+	TimestampsEstimated bool    // profile 缺少有效的 TimeNanos 时为 true，此时假设每个 profile 间隔 1 分钟
+}
+
+// BuildHeapGrowthProfile 将按时间顺序排列的多个 heap profile 合成一个新的 pprof，
+// 其中每个调用栈的值是该调用栈 inuse_space 随时间的增长率 (字节/分钟，最小二乘斜率)。
+// 只保留增长的调用栈，因此生成的 profile 可以直接用火焰图查看"增长最快的是什么"。
+func BuildHeapGrowthProfile(profiles []*profile.Profile) (*profile.Profile, HeapGrowthInfo, error) {
+	var info HeapGrowthInfo
+	if len(profiles) < 2 {
+		return nil, info, fmt.Errorf("至少需要 2 个 heap profile 来计算增长率，当前只有 %d 个", len(profiles))
+	}
+
+	for i, p := range profiles {
+		if findSampleTypeIndex(p, "inuse_space") < 0 {
+			return nil, info, fmt.Errorf("profile #%d 中没有 inuse_space 样本类型", i+1)
+		}
+	}
+
+	minutes, estimated := profileTimesMinutes(profiles)
+	info.TimeSpanMinutes = minutes[len(minutes)-1] - minutes[0]
+	info.TimestampsEstimated = estimated
+
+	// 每个调用栈的增长率是其取值对时间的最小二乘斜率：
+	// slope = Σ (t_i - t̄) * v_i / Σ (t_i - t̄)²
+	// 因此先按权重 (t_i - t̄) / Σ (t_i - t̄)² 缩放每个 profile，再合并即可得到每个调用栈的斜率。
+	mean := 0.0
+	for _, m := range minutes {
+		mean += m
+	}
+	mean /= float64(len(minutes))
+	denom := 0.0
+	for _, m := range minutes {
+		denom += (m - mean) * (m - mean)
+	}
+	if denom == 0 {
+		return nil, info, fmt.Errorf("profile 的时间戳完全相同，无法计算增长率")
+	}
+
+	scaled := make([]*profile.Profile, len(profiles))
+	for i, p := range profiles {
+		scaled[i] = p.Copy()
+		// heap 样本上的 bytes 等数值标签对增长率没有意义，并且同一调用栈按对象大小被拆成多个样本。
+		// 在合并之前去掉，使同一调用栈的样本合并为一个，按整个调用栈计算斜率并决定是否保留
+		for _, s := range scaled[i].Sample {
+			s.NumLabel = nil
+			s.NumUnit = nil
+		}
+		scaled[i].Scale((minutes[i] - mean) / denom)
+	}
+	merged, err := profile.Merge(scaled)
+	if err != nil {
+		return nil, info, fmt.Errorf("failed to merge heap profiles: %w", err)
+	}
+
+	valueIndex := findSampleTypeIndex(merged, "inuse_space")
+	growing := merged.Sample[:0]
+	for _, s := range merged.Sample {
+		rate := s.Value[valueIndex]
+		if rate <= 0 {
+			continue
+		}
+		s.Value = []int64{rate}
+		growing = append(growing, s)
+	}
+	merged.Sample = growing
+	merged.SampleType = []*profile.ValueType{{Type: GrowthSampleType, Unit: "bytes"}}
+	merged.DefaultSampleType = GrowthSampleType
+	merged.PeriodType = &profile.ValueType{Type: "space", Unit: "bytes"}
+	merged.Period = 1
+	merged.TimeNanos = profiles[0].TimeNanos
+	merged.DurationNanos = int64(info.TimeSpanMinutes * float64(time.Minute))
+	merged.Comments = append(merged.Comments,
+		fmt.Sprintf("synthetic heap growth profile built from %d snapshots over %.1f minutes", len(profiles), info.TimeSpanMinutes))
+	if estimated {
+		merged.Comments = append(merged.Comments, "snapshot timestamps missing; assumed 1 minute between snapshots")
+	}
+
+	logDebug("Built heap growth profile: %d growing stacks over %.1f minutes", len(merged.Sample), info.TimeSpanMinutes)
+	return merged.Compact(), info, nil
+}
+
+// profileTimesMinutes 返回每个 profile 相对第一个 profile 的采集时间 (分钟)。
+// 如果有 profile 缺少 TimeNanos 或时间戳不是严格递增的，则假设每个 profile 间隔 1 分钟，并返回 estimated=true。
+func profileTimesMinutes(profiles []*profile.Profile) ([]float64, bool) {
+	minutes := make([]float64, len(profiles))
+	for i, p := range profiles {
+		if p.TimeNanos <= 0 || (i > 0 && p.TimeNanos <= profiles[i-1].TimeNanos) {
+			for j := range minutes {
+				minutes[j] = float64(j)
+			}
+			return minutes, true
+		}
+		minutes[i] = float64(p.TimeNanos-profiles[0].TimeNanos) / float64(time.Minute)
+	}
+	return minutes, false
+}
+
+// findSampleTypeIndex 返回指定样本类型的索引，不存在时返回 -1
+func findSampleTypeIndex(p *profile.Profile, sampleType string) int {
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			return i
+		}
+	}
+	return -1
+}
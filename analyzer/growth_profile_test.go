@@ -0,0 +1,110 @@
+package analyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// newHeapSnapshot 构造一个测试用的 heap profile，包含一个持续增长和一个持续下降的调用栈
+func newHeapSnapshot(at time.Time, growingBytes, shrinkingBytes int64) *profile.Profile {
+	fnGrow := &profile.Function{ID: 1, Name: "main.cache"}
+	fnShrink := &profile.Function{ID: 2, Name: "main.buffer"}
+	locGrow := &profile.Location{ID: 1, Line: []profile.Line{{Function: fnGrow}}}
+	locShrink := &profile.Location{ID: 2, Line: []profile.Line{{Function: fnShrink}}}
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "inuse_objects", Unit: "count"},
+			{Type: "inuse_space", Unit: "bytes"},
+		},
+		PeriodType: &profile.ValueType{Type: "space", Unit: "bytes"},
+		Period:     512 * 1024,
+		TimeNanos:  at.UnixNano(),
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{locGrow}, Value: []int64{1, growingBytes}},
+			{Location: []*profile.Location{locShrink}, Value: []int64{1, shrinkingBytes}},
+		},
+		Location: []*profile.Location{locGrow, locShrink},
+		Function: []*profile.Function{fnGrow, fnShrink},
+	}
+}
+
+// TestBuildHeapGrowthProfile 测试增长率 profile 的合成
+func TestBuildHeapGrowthProfile(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	const mb = 1024 * 1024
+	profiles := []*profile.Profile{
+		newHeapSnapshot(start, 10*mb, 8*mb),
+		newHeapSnapshot(start.Add(2*time.Minute), 12*mb, 6*mb),
+		newHeapSnapshot(start.Add(4*time.Minute), 14*mb, 4*mb),
+	}
+
+	growth, info, err := BuildHeapGrowthProfile(profiles)
+	if err != nil {
+		t.Fatalf("BuildHeapGrowthProfile() error = %v", err)
+	}
+	if info.TimestampsEstimated || info.TimeSpanMinutes != 4 {
+		t.Errorf("Expected a 4 minute span from real timestamps, got %+v", info)
+	}
+	if len(growth.SampleType) != 1 || growth.SampleType[0].Type != GrowthSampleType {
+		t.Fatalf("Expected single %s sample type, got %v", GrowthSampleType, growth.SampleType)
+	}
+	if len(growth.Sample) != 1 {
+		t.Fatalf("Expected only the growing stack, got %d samples", len(growth.Sample))
+	}
+	if name := growth.Sample[0].Location[0].Line[0].Function.Name; name != "main.cache" {
+		t.Errorf("Expected main.cache to be growing, got %s", name)
+	}
+	if rate := growth.Sample[0].Value[0]; rate != mb {
+		t.Errorf("Expected growth rate of 1 MB/min, got %d", rate)
+	}
+	if err := growth.CheckValid(); err != nil {
+		t.Errorf("Synthetic profile is not valid: %v", err)
+	}
+
+	// 缺少时间戳时按每分钟一个快照估算
+	for _, p := range profiles {
+		p.TimeNanos = 0
+	}
+	growth, info, err = BuildHeapGrowthProfile(profiles)
+	if err != nil {
+		t.Fatalf("BuildHeapGrowthProfile() error = %v", err)
+	}
+	if !info.TimestampsEstimated || growth.Sample[0].Value[0] != 2*mb {
+		t.Errorf("Expected estimated timestamps and 2 MB/min, got %+v and %d", info, growth.Sample[0].Value[0])
+	}
+}
+
+// TestBuildHeapGrowthProfileMergesNumLabels 测试同一调用栈按 bytes 数值标签拆开的样本先合并再计算增长率，
+// 下降的对象大小抵消增长的对象大小，而不是只保留增长的那部分
+func TestBuildHeapGrowthProfileMergesNumLabels(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	const mb = 1024 * 1024
+	snapshot := func(at time.Time, smallBytes, largeBytes int64) *profile.Profile {
+		p := newHeapSnapshot(at, 0, 0)
+		loc := p.Location[0]
+		p.Sample = []*profile.Sample{
+			{Location: []*profile.Location{loc}, Value: []int64{1, smallBytes}, NumLabel: map[string][]int64{"bytes": {64}}},
+			{Location: []*profile.Location{loc}, Value: []int64{1, largeBytes}, NumLabel: map[string][]int64{"bytes": {4096}}},
+		}
+		return p
+	}
+	profiles := []*profile.Profile{
+		snapshot(start, 1*mb, 4*mb),
+		snapshot(start.Add(2*time.Minute), 3*mb, 3*mb),
+		snapshot(start.Add(4*time.Minute), 5*mb, 2*mb),
+	}
+
+	growth, _, err := BuildHeapGrowthProfile(profiles)
+	if err != nil {
+		t.Fatalf("BuildHeapGrowthProfile() error = %v", err)
+	}
+	if len(growth.Sample) != 1 {
+		t.Fatalf("Expected the stack to be merged into one sample, got %d samples", len(growth.Sample))
+	}
+	// 64B 的分配每分钟增长 1 MB，4KB 的分配每分钟下降 0.5 MB
+	if s := growth.Sample[0]; s.Value[0] != mb/2 || len(s.NumLabel) != 0 {
+		t.Errorf("Expected a merged growth rate of 0.5 MB/min without numeric labels, got %d and %v", s.Value[0], s.NumLabel)
+	}
+}
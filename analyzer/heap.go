@@ -1,9 +1,9 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 
@@ -12,30 +12,74 @@ import (
 
 // AnalyzeHeapProfile 分析 Heap profile (主要关注 inuse_space) 并返回格式化结果。
 func AnalyzeHeapProfile(p *profile.Profile, topN int, format string) (string, error) {
-	log.Printf("Analyzing Heap profile (Top %d, Format: %s)", topN, format)
+	return AnalyzeHeapProfileWithOptions(p, topN, format, HeapAnalysisOptions{})
+}
+
+// AnalyzeHeapProfileWithOptions 与 AnalyzeHeapProfile 相同，但支持 HeapAnalysisOptions，
+// 例如按平均对象大小汇总分配位置。
+func AnalyzeHeapProfileWithOptions(p *profile.Profile, topN int, format string, opts HeapAnalysisOptions) (string, error) {
+	return AnalyzeHeapProfileContext(context.Background(), p, topN, format, opts)
+}
+
+// AnalyzeHeapProfileContext 与 AnalyzeHeapProfileWithOptions 相同，但在聚合样本时定期检查 ctx，ctx 被取消时尽快停止
+func AnalyzeHeapProfileContext(ctx context.Context, p *profile.Profile, topN int, format string, opts HeapAnalysisOptions) (string, error) {
+	logDebug("Analyzing Heap profile (Top %d, Format: %s, Size buckets: %t)", topN, format, opts.SizeBuckets)
+	result, err := HeapProfileStatsContext(ctx, p, topN, opts)
+	if err != nil {
+		return "", err
+	}
+	if format != "flamegraph-json" {
+		return FormatHeapResult(result, format)
+	}
 
+	// 火焰图需要完整的调用栈，直接从 profile 构建
+	valueIndex, _, _ := findValueColumn(p, "heap")
+	logDebug("Generating flame graph JSON for Heap profile (%s) using value index %d", result.ValueType, valueIndex)
+	// BuildFlameGraphTree will automatically detect this is a memory profile and find the objectsIndex
+	// based on the valueType and valueUnit
+	flameGraphRoot, err := BuildFlameGraphTree(p, valueIndex)
+	if err != nil {
+		logError("Error building flame graph tree for heap: %v", err)
+		errorResult := ErrorResult{Error: fmt.Sprintf("Failed to build flame graph tree for heap: %v", err)}
+		errJsonBytes, _ := json.Marshal(errorResult)
+		return string(errJsonBytes), nil
+	}
+	jsonBytes, err := json.Marshal(flameGraphRoot) // 使用 Marshal 生成紧凑 JSON
+	if err != nil {
+		logError("Error marshaling heap flame graph tree to JSON: %v", err)
+		errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal heap flame graph tree to JSON: %v", err)}
+		errJsonBytes, _ := json.Marshal(errorResult)
+		return string(errJsonBytes), nil
+	}
+	return string(jsonBytes), nil
+}
+
+// HeapProfileStats 按函数、分配位置和对象类型聚合 Heap profile (主要关注 inuse_space)，
+// 返回各自前 topN 项的结构化结果，供需要直接使用数值的调用方使用。结果中的 TopN 是请求的数量。
+func HeapProfileStats(p *profile.Profile, topN int) (*HeapAnalysisResult, error) {
+	return HeapProfileStatsWithOptions(p, topN, HeapAnalysisOptions{})
+}
+
+// HeapProfileStatsWithOptions 与 HeapProfileStats 相同，但支持 HeapAnalysisOptions。
+func HeapProfileStatsWithOptions(p *profile.Profile, topN int, opts HeapAnalysisOptions) (*HeapAnalysisResult, error) {
+	return HeapProfileStatsContext(context.Background(), p, topN, opts)
+}
+
+// HeapProfileStatsContext 与 HeapProfileStatsWithOptions 相同，但在聚合样本时定期检查 ctx，ctx 被取消时返回包装了 ctx.Err() 的错误
+func HeapProfileStatsContext(ctx context.Context, p *profile.Profile, topN int, opts HeapAnalysisOptions) (*HeapAnalysisResult, error) {
 	// --- 1. 查找 'inuse_space' 的样本值索引 ---
 	// 常见的索引：0:alloc_objects, 1:alloc_space, 2:inuse_objects, 3:inuse_space
-	valueIndex := -1
 	objectsIndex := -1 // For tracking object counts
 
 	for i, st := range p.SampleType {
-		if st.Type == "inuse_space" && st.Unit == "bytes" {
-			valueIndex = i
-		}
 		if st.Type == "inuse_objects" && st.Unit == "count" {
 			objectsIndex = i
 		}
 	}
-	// 回退方案：如果找不到 inuse_space，则尝试 alloc_space
-	if valueIndex == -1 {
-		for i, st := range p.SampleType {
-			if st.Type == "alloc_space" && st.Unit == "bytes" {
-				valueIndex = i
-				log.Printf("Warning: 'inuse_space' not found, falling back to 'alloc_space'")
-				break
-			}
-		}
+	// 按名称查找 inuse_space，找不到时回退到 alloc_space，最后才按位置选择
+	valueIndex, _, err := findValueColumn(p, "heap")
+	if err != nil {
+		return nil, fmt.Errorf("无法从 profile 样本类型中确定值类型 (例如 inuse_space bytes): %w", err)
 	}
 
 	// Fallback: If inuse_objects is not found, try alloc_objects
@@ -43,33 +87,23 @@ func AnalyzeHeapProfile(p *profile.Profile, topN int, format string) (string, er
 		for i, st := range p.SampleType {
 			if st.Type == "alloc_objects" && st.Unit == "count" {
 				objectsIndex = i
-				log.Printf("Warning: 'inuse_objects' not found, falling back to 'alloc_objects'")
+				logWarn("'inuse_objects' not found, falling back to 'alloc_objects'")
 				break
 			}
 		}
 	}
 
-	// 回退方案：如果未找到特定类型，则尝试最后一个值 (通常是 inuse_space)
-	if valueIndex == -1 && len(p.SampleType) > 0 {
-		valueIndex = len(p.SampleType) - 1
-		log.Printf("Warning: Could not find 'inuse_space' or 'alloc_space', defaulting to last sample type index %d: %s/%s",
-			valueIndex, p.SampleType[valueIndex].Type, p.SampleType[valueIndex].Unit)
-	}
-
-	if valueIndex == -1 {
-		return "", fmt.Errorf("无法从 profile 样本类型中确定值类型 (例如 inuse_space bytes)")
-	}
-
 	valueUnit := p.SampleType[valueIndex].Unit
 	valueType := p.SampleType[valueIndex].Type
-	log.Printf("使用索引 %d (%s/%s) 进行 Heap 分析", valueIndex, valueType, valueUnit)
+	logDebug("使用索引 %d (%s/%s) 进行 Heap 分析", valueIndex, valueType, valueUnit)
 	if objectsIndex >= 0 {
-		log.Printf("使用索引 %d (%s/%s) 进行对象计数", objectsIndex, p.SampleType[objectsIndex].Type, p.SampleType[objectsIndex].Unit)
+		logDebug("使用索引 %d (%s/%s) 进行对象计数", objectsIndex, p.SampleType[objectsIndex].Type, p.SampleType[objectsIndex].Unit)
 	}
 
 	// --- 2. Aggregate memory usage values by function and allocation site ---
 	// Create two maps: one for aggregating by function, one for aggregating by allocation site
 	funcValue := make(map[string]int64)        // Aggregate by function name
+	funcCum := make(map[string]int64)          // Aggregate by every function on the allocation stack
 	allocSiteValue := make(map[string]int64)   // Aggregate by allocation site (function+file+line)
 	funcObjects := make(map[string]int64)      // Object count aggregated by function
 	allocSiteObjects := make(map[string]int64) // Object count aggregated by allocation site
@@ -81,10 +115,14 @@ func AnalyzeHeapProfile(p *profile.Profile, topN int, format string) (string, er
 	totalValue := int64(0)
 	totalObjects := int64(0)
 
-	for _, s := range p.Sample {
+	for i, s := range p.Sample {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, err
+		}
 		if len(s.Location) > 0 && len(s.Value) > valueIndex {
 			v := s.Value[valueIndex] // Memory usage (bytes)
 			totalValue += v
+			addCumulativeValue(funcCum, s, v, functionNameKey)
 
 			// If object count information is available, collect it too
 			var objCount int64 = 0
@@ -109,46 +147,37 @@ func AnalyzeHeapProfile(p *profile.Profile, topN int, format string) (string, er
 				typeObjects[typeName] += objCount
 			}
 
-			// Attribute memory to the topmost function in the allocation stack
-			loc := s.Location[0]
-			for _, line := range loc.Line {
-				if line.Function != nil {
-					funcName := line.Function.Name
-					fileName := line.Function.Filename
-					lineNum := line.Line
-
-					// Aggregate by function
-					funcValue[funcName] += v
-					if objCount > 0 {
-						funcObjects[funcName] += objCount
-					}
-
-					// Aggregate by allocation site (function+file+line)
-					allocSiteKey := fmt.Sprintf("%s at %s:%d", funcName, fileName, lineNum)
-					allocSiteValue[allocSiteKey] += v
-					if objCount > 0 {
-						allocSiteObjects[allocSiteKey] += objCount
-					}
-
-					break // Only attribute to the first function found in the top frame
-				}
+			// Attribute memory to the topmost function in the allocation stack ("unknown" when the top frame has no function)
+			funcName, allocSiteKey := unknownFunction, unknownFunction
+			if line, ok := topLine(s); ok {
+				funcName = line.Function.Name
+				allocSiteKey = fmt.Sprintf("%s at %s:%d", funcName, line.Function.Filename, line.Line)
+			}
+
+			// Aggregate by function
+			funcValue[funcName] += v
+			if objCount > 0 {
+				funcObjects[funcName] += objCount
+			}
+
+			// Aggregate by allocation site (function+file+line)
+			allocSiteValue[allocSiteKey] += v
+			if objCount > 0 {
+				allocSiteObjects[allocSiteKey] += objCount
 			}
 		}
 	}
 
 	if totalValue == 0 {
-		log.Printf("Warning: Total value for the selected sample type (%s/%s) is zero.", valueType, valueUnit)
+		logWarn("Total value for the selected sample type (%s/%s) is zero.", valueType, valueUnit)
 	}
 
 	// --- 3. Sort functions, allocation sites, and types by aggregated values ---
 	// Sort by function
-	funcStats := make([]functionStat, 0, len(funcValue))
-	for name, val := range funcValue {
-		funcStats = append(funcStats, functionStat{Name: name, Flat: val})
+	funcStats, sortValue, err := sortedFunctionStats(funcValue, funcCum, nil, opts.SortBy)
+	if err != nil {
+		return nil, err
 	}
-	sort.Slice(funcStats, func(i, j int) bool {
-		return funcStats[i].Flat > funcStats[j].Flat // Sort in descending order
-	})
 
 	// Sort by allocation site
 	type allocSiteStat struct {
@@ -180,8 +209,6 @@ func AnalyzeHeapProfile(p *profile.Profile, topN int, format string) (string, er
 		return typeStats[i].Value > typeStats[j].Value // Sort in descending order
 	})
 
-	// --- 4. Format output ---
-	var b strings.Builder
 	limit := topN
 	if limit > len(funcStats) {
 		limit = len(funcStats)
@@ -197,201 +224,164 @@ func AnalyzeHeapProfile(p *profile.Profile, topN int, format string) (string, er
 		typeLimit = len(typeStats)
 	}
 
-	switch format {
-	case "text", "markdown":
-		if format == "markdown" {
-			b.WriteString("```text\n")
-		}
-		b.WriteString(fmt.Sprintf("Heap Profile Analysis (Top %d Functions by %s)\n", topN, valueType))
-		b.WriteString(fmt.Sprintf("Total %s (%s): %s\n", valueType, valueUnit, FormatBytes(totalValue)))
-		if totalObjects > 0 {
-			b.WriteString(fmt.Sprintf("Total Objects: %d\n", totalObjects))
-		}
+	// 过滤只作用于函数列表，分配位置和类型的数量仍按过滤前的 limit 计算
+	funcStats, noiseFilter := dropBelowPercent(funcStats, sortValue, totalValue, opts.MinPercent, opts.Numbers.Bytes)
+	funcLimit := limit
+	if funcLimit > len(funcStats) {
+		funcLimit = len(funcStats)
+	}
 
-		// Output by function
-		b.WriteString("\n=== By Function ===\n")
-		b.WriteString("--------------------------------------------------\n")
-		b.WriteString(fmt.Sprintf("%-15s %-15s %s\n", valueType, "%", "Function Name"))
-		b.WriteString("--------------------------------------------------\n")
-		for i := 0; i < limit; i++ {
-			stat := funcStats[i]
-			percent := 0.0
-			if totalValue != 0 {
-				percent = (float64(stat.Flat) / float64(totalValue)) * 100
-			}
-			objStr := ""
-			if count, ok := funcObjects[stat.Name]; ok && count > 0 {
-				objStr = fmt.Sprintf(" (%d objects)", count)
-			}
-			b.WriteString(fmt.Sprintf("%-15s %-15.2f %s%s\n",
-				FormatBytes(stat.Flat), percent, stat.Name, objStr))
-		}
+	result := &HeapAnalysisResult{
+		ProfileType:         "heap",
+		ValueType:           valueType,
+		ValueUnit:           valueUnit,
+		TotalValue:          totalValue,
+		TotalValueFormatted: opts.Numbers.Bytes(totalValue),
+		TotalObjects:        totalObjects,
+		TopN:                topN,
+		Functions:           make([]HeapFunctionStat, 0, funcLimit),
+		CaptureConfig:       ParseCaptureConfig(p),
+		NoiseFilter:         noiseFilter,
+		SkippedSamples:      countSkippedSamples(p, valueIndex),
+		SortBy:              opts.SortBy,
+		numbers:             opts.Numbers,
+	}
 
-		// Output by allocation site
-		b.WriteString("\n=== By Allocation Site ===\n")
-		b.WriteString("--------------------------------------------------\n")
-		b.WriteString(fmt.Sprintf("%-15s %-15s %s\n", valueType, "%", "Allocation Site"))
-		b.WriteString("--------------------------------------------------\n")
+	running := int64(0)
+	for i := 0; i < funcLimit; i++ {
+		stat := funcStats[i]
+		running += stat.Flat
+		result.Functions = append(result.Functions, HeapFunctionStat{
+			FunctionName:      stat.Name,
+			FunctionID:        FunctionID(stat.Name),
+			Value:             stat.Flat,
+			ValueFormatted:    opts.Numbers.Bytes(stat.Flat),
+			Percentage:        percentOf(stat.Flat, totalValue),
+			SumPercentage:     percentOf(running, totalValue),
+			CumValue:          stat.Cum,
+			CumValueFormatted: opts.Numbers.Bytes(stat.Cum),
+			CumPercentage:     percentOf(stat.Cum, totalValue),
+			ObjectCount:       funcObjects[stat.Name],
+		})
+	}
+
+	if len(allocSiteStats) > 0 {
+		result.AllocationSites = make([]AllocSiteStat, 0, allocSiteLimit)
+		running = 0
 		for i := 0; i < allocSiteLimit; i++ {
 			stat := allocSiteStats[i]
-			percent := 0.0
-			if totalValue != 0 {
-				percent = (float64(stat.Value) / float64(totalValue)) * 100
+			running += stat.Value
+			siteStat := AllocSiteStat{
+				Site:           stat.Site,
+				Value:          stat.Value,
+				ValueFormatted: opts.Numbers.Bytes(stat.Value),
+				Percentage:     percentOf(stat.Value, totalValue),
+				SumPercentage:  percentOf(running, totalValue),
 			}
-			objStr := ""
+
 			if stat.Count > 0 {
-				objStr = fmt.Sprintf(" (%d objects)", stat.Count)
+				siteStat.ObjectCount = stat.Count
+				avgSize := stat.Value / stat.Count
+				siteStat.AvgSize = avgSize
+				siteStat.AvgSizeFormatted = opts.Numbers.Bytes(avgSize)
 			}
-			b.WriteString(fmt.Sprintf("%-15s %-15.2f %s%s\n",
-				FormatBytes(stat.Value), percent, stat.Site, objStr))
-		}
 
-		if len(typeStats) > 0 && typeStats[0].Type != "unknown" {
-			b.WriteString("\n=== By Type ===\n")
-			b.WriteString("--------------------------------------------------\n")
-			b.WriteString(fmt.Sprintf("%-15s %-15s %-15s %s\n", valueType, "%", "Avg Size", "Type"))
-			b.WriteString("--------------------------------------------------\n")
-			for i := 0; i < typeLimit; i++ {
-				stat := typeStats[i]
-				percent := 0.0
-				if totalValue != 0 {
-					percent = (float64(stat.Value) / float64(totalValue)) * 100
-				}
-
-				avgSize := int64(0)
-				if stat.Count > 0 {
-					avgSize = stat.Value / stat.Count
-				}
-
-				b.WriteString(fmt.Sprintf("%-15s %-15.2f %-15s %s (%d objects)\n",
-					FormatBytes(stat.Value), percent, FormatBytes(avgSize), stat.Type, stat.Count))
-			}
-		}
-		if format == "markdown" {
-			b.WriteString("```\n")
-		}
-	case "json":
-
-		result := struct {
-			ProfileType         string             `json:"profileType"`
-			ValueType           string             `json:"valueType"`
-			ValueUnit           string             `json:"valueUnit"`
-			TotalValue          int64              `json:"totalValue"`
-			TotalValueFormatted string             `json:"totalValueFormatted"`
-			TotalObjects        int64              `json:"totalObjects,omitempty"`
-			TopN                int                `json:"topN"`
-			Functions           []HeapFunctionStat `json:"functions"`
-			AllocationSites     []AllocSiteStat    `json:"allocationSites,omitempty"`
-			Types               []TypeStat         `json:"types,omitempty"`
-		}{
-			ProfileType:         "heap",
-			ValueType:           valueType,
-			ValueUnit:           valueUnit,
-			TotalValue:          totalValue,
-			TotalValueFormatted: FormatBytes(totalValue), // 使用导出的 FormatBytes
-			TopN:                limit,
-			Functions:           make([]HeapFunctionStat, 0, limit),
-		}
-
-		if totalObjects > 0 {
-			result.TotalObjects = totalObjects
+			result.AllocationSites = append(result.AllocationSites, siteStat)
 		}
+	}
 
-		for i := 0; i < limit; i++ {
-			stat := funcStats[i]
-			percent := 0.0
-			if totalValue != 0 {
-				percent = (float64(stat.Flat) / float64(totalValue)) * 100
+	if len(typeStats) > 0 && typeStats[0].Type != "unknown" {
+		result.Types = make([]TypeStat, 0, typeLimit)
+		running = 0
+		for i := 0; i < typeLimit; i++ {
+			stat := typeStats[i]
+			running += stat.Value
+			typeStat := TypeStat{
+				Type:           stat.Type,
+				Value:          stat.Value,
+				ValueFormatted: opts.Numbers.Bytes(stat.Value),
+				Percentage:     percentOf(stat.Value, totalValue),
+				SumPercentage:  percentOf(running, totalValue),
 			}
 
-			funcStat := HeapFunctionStat{
-				FunctionName:   stat.Name,
-				Value:          stat.Flat,
-				ValueFormatted: FormatBytes(stat.Flat),
-				Percentage:     percent,
+			if stat.Count > 0 {
+				typeStat.ObjectCount = stat.Count
+				avgSize := stat.Value / stat.Count
+				typeStat.AvgSize = avgSize
+				typeStat.AvgSizeFormatted = opts.Numbers.Bytes(avgSize)
 			}
 
-			result.Functions = append(result.Functions, funcStat)
+			result.Types = append(result.Types, typeStat)
 		}
+	}
 
-		if len(allocSiteStats) > 0 {
-			result.AllocationSites = make([]AllocSiteStat, 0, allocSiteLimit)
-			for i := 0; i < allocSiteLimit; i++ {
-				stat := allocSiteStats[i]
-				percent := 0.0
-				if totalValue != 0 {
-					percent = (float64(stat.Value) / float64(totalValue)) * 100
-				}
-
-				siteStat := AllocSiteStat{
-					Site:           stat.Site,
-					Value:          stat.Value,
-					ValueFormatted: FormatBytes(stat.Value),
-					Percentage:     percent,
-				}
+	if opts.SizeBuckets {
+		result.SizeBuckets = heapSizeBuckets(allocSiteValue, allocSiteObjects, totalValue, opts.Numbers)
+	}
+	return result, nil
+}
 
-				if stat.Count > 0 {
-					siteStat.ObjectCount = stat.Count
-					avgSize := stat.Value / stat.Count
-					siteStat.AvgSize = avgSize
-					siteStat.AvgSizeFormatted = FormatBytes(avgSize)
-				}
+// FormatHeapResult 将 HeapProfileStats 的结果格式化为 text、markdown、json、compact 或 summary 输出。
+// flamegraph-json 需要完整的调用栈，只能通过 AnalyzeHeapProfile 生成。
+func FormatHeapResult(result *HeapAnalysisResult, format string) (string, error) {
+	// --- 4. Format output ---
+	var b strings.Builder
+	valueType := result.ValueType
+	capture := result.CaptureConfig
 
-				result.AllocationSites = append(result.AllocationSites, siteStat)
-			}
+	switch format {
+	case "text", "markdown":
+		if format == "markdown" {
+			b.WriteString("```text\n")
+		}
+		sortedBy := valueType
+		if result.SortBy == SortByCum {
+			sortedBy = "Cum " + valueType
+		}
+		b.WriteString(fmt.Sprintf("Heap Profile Analysis (Top %d Functions by %s)\n", result.TopN, sortedBy))
+		b.WriteString(fmt.Sprintf("Total %s (%s): %s\n", valueType, result.ValueUnit, result.TotalValueFormatted))
+		if result.TotalObjects > 0 {
+			b.WriteString(fmt.Sprintf("Total Objects: %d\n", result.TotalObjects))
+		}
+		if capture != nil {
+			b.WriteString(fmt.Sprintf("Capture Config: %s\n", capture.format(result.numbers)))
+		}
+		if result.SkippedSamples != nil {
+			b.WriteString(fmt.Sprintf("Skipped: %s\n", result.SkippedSamples))
+		}
+		writeMemoryFunctionsAndSites(&b, valueType, result.Functions, result.AllocationSites)
+		if result.NoiseFilter != nil {
+			b.WriteString(fmt.Sprintf("Filtered: %s\n", result.NoiseFilter))
 		}
 
-		if len(typeStats) > 0 && typeStats[0].Type != "unknown" {
-			result.Types = make([]TypeStat, 0, typeLimit)
-			for i := 0; i < typeLimit; i++ {
-				stat := typeStats[i]
-				percent := 0.0
-				if totalValue != 0 {
-					percent = (float64(stat.Value) / float64(totalValue)) * 100
-				}
-
-				typeStat := TypeStat{
-					Type:           stat.Type,
-					Value:          stat.Value,
-					ValueFormatted: FormatBytes(stat.Value),
-					Percentage:     percent,
-				}
-
-				if stat.Count > 0 {
-					typeStat.ObjectCount = stat.Count
-					avgSize := stat.Value / stat.Count
-					typeStat.AvgSize = avgSize
-					typeStat.AvgSizeFormatted = FormatBytes(avgSize)
-				}
-
-				result.Types = append(result.Types, typeStat)
+		if len(result.Types) > 0 {
+			b.WriteString("\n=== By Type ===\n")
+			b.WriteString("--------------------------------------------------\n")
+			b.WriteString(fmt.Sprintf("%-15s %-10s %-10s %-15s %s\n", valueType, "Flat%", "Sum%", "Avg Size", "Type"))
+			b.WriteString("--------------------------------------------------\n")
+			for _, stat := range result.Types {
+				b.WriteString(fmt.Sprintf("%-15s %-10.2f %-10.2f %-15s %s (%d objects)\n",
+					stat.ValueFormatted, stat.Percentage, stat.SumPercentage, result.numbers.Bytes(stat.AvgSize), sanitizeName(stat.Type), stat.ObjectCount))
 			}
 		}
-
-		jsonBytes, err := json.MarshalIndent(result, "", "  ")
-		if err != nil {
-			log.Printf("Error marshaling Heap analysis to JSON: %v", err)
-			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal result to JSON: %v", err)} // 使用 types.go 中的结构体
-			errJsonBytes, _ := json.Marshal(errorResult)
-			return string(errJsonBytes), nil
+		if len(result.SizeBuckets) > 0 {
+			writeHeapSizeBuckets(&b, valueType, result.SizeBuckets)
 		}
-		return string(jsonBytes), nil
-
-	case "flamegraph-json":
-		log.Printf("Generating flame graph JSON for Heap profile (%s) using value index %d", valueType, valueIndex)
-		// BuildFlameGraphTree will automatically detect this is a memory profile and find the objectsIndex
-		// based on the valueType and valueUnit
-		flameGraphRoot, err := BuildFlameGraphTree(p, valueIndex)
-		if err != nil {
-			log.Printf("Error building flame graph tree for heap: %v", err)
-			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to build flame graph tree for heap: %v", err)}
-			errJsonBytes, _ := json.Marshal(errorResult)
-			return string(errJsonBytes), nil
+		if format == "markdown" {
+			b.WriteString("```\n")
 		}
-		jsonBytes, err := json.Marshal(flameGraphRoot) // 使用 Marshal 生成紧凑 JSON
+	case "summary":
+		b.WriteString(formatSummary(memorySummary("heap", valueType, result.TotalValueFormatted, result.Functions)))
+	case "compact":
+		b.WriteString(formatMemoryCompact("heap", valueType, result.TotalValueFormatted, result.Functions, capture.compactSuffix()+result.NoiseFilter.compactSuffix()+result.SkippedSamples.compactSuffix()))
+	case "json":
+		// JSON 中的 topN 是实际返回的函数数量
+		output := *result
+		output.TopN = len(result.Functions)
+		jsonBytes, err := json.MarshalIndent(output, "", "  ")
 		if err != nil {
-			log.Printf("Error marshaling heap flame graph tree to JSON: %v", err)
-			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal heap flame graph tree to JSON: %v", err)}
+			logError("Error marshaling Heap analysis to JSON: %v", err)
+			errorResult := ErrorResult{Error: fmt.Sprintf("Failed to marshal result to JSON: %v", err)} // 使用 types.go 中的结构体
 			errJsonBytes, _ := json.Marshal(errorResult)
 			return string(errJsonBytes), nil
 		}
@@ -402,3 +392,43 @@ func AnalyzeHeapProfile(p *profile.Profile, topN int, format string) (string, er
 
 	return b.String(), nil
 }
+
+// writeMemoryFunctionsAndSites 写入 Heap 与 Allocs 文本报告共有的 "By Function" 和 "By Allocation Site" 两个表格
+func writeMemoryFunctionsAndSites(b *strings.Builder, valueType string, functions []HeapFunctionStat, sites []AllocSiteStat) {
+	// Output by function
+	b.WriteString("\n=== By Function ===\n")
+	b.WriteString("--------------------------------------------------\n")
+	b.WriteString(fmt.Sprintf("%-15s %-10s %-10s %-15s %-10s %s\n", valueType, "Flat%", "Sum%", "Cum", "Cum%", "Function Name"))
+	b.WriteString("--------------------------------------------------\n")
+	for _, stat := range functions {
+		objStr := ""
+		if stat.ObjectCount > 0 {
+			objStr = fmt.Sprintf(" (%d objects)", stat.ObjectCount)
+		}
+		b.WriteString(fmt.Sprintf("%-15s %-10.2f %-10.2f %-15s %-10.2f %s%s\n",
+			stat.ValueFormatted, stat.Percentage, stat.SumPercentage, stat.CumValueFormatted, stat.CumPercentage, sanitizeName(stat.FunctionName), objStr))
+	}
+
+	// Output by allocation site
+	b.WriteString("\n=== By Allocation Site ===\n")
+	b.WriteString("--------------------------------------------------\n")
+	b.WriteString(fmt.Sprintf("%-15s %-10s %-10s %s\n", valueType, "Flat%", "Sum%", "Allocation Site"))
+	b.WriteString("--------------------------------------------------\n")
+	for _, stat := range sites {
+		objStr := ""
+		if stat.ObjectCount > 0 {
+			objStr = fmt.Sprintf(" (%d objects)", stat.ObjectCount)
+		}
+		b.WriteString(fmt.Sprintf("%-15s %-10.2f %-10.2f %s%s\n",
+			stat.ValueFormatted, stat.Percentage, stat.SumPercentage, sanitizeName(stat.Site), objStr))
+	}
+}
+
+// formatMemoryCompact 生成 Heap 与 Allocs 的 compact 输出，suffix 附加在首行末尾 (采集配置、过滤摘要等)
+func formatMemoryCompact(profileType, valueType, totalFormatted string, functions []HeapFunctionStat, suffix string) string {
+	rows := make([]compactRow, 0, len(functions))
+	for _, stat := range functions {
+		rows = append(rows, compactRow{Name: stat.FunctionName, Value: stat.ValueFormatted, Percent: stat.Percentage})
+	}
+	return formatCompact(fmt.Sprintf("%s %s total=%s top=%d", profileType, valueType, totalFormatted, len(functions))+suffix, rows)
+}
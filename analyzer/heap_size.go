@@ -0,0 +1,92 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HeapAnalysisOptions 定义 Heap 分析的可选参数
+type HeapAnalysisOptions struct {
+	// SizeBuckets 为 true 时按平均对象大小 (value/objects) 将分配位置分到 <64B、64B-1KB、1KB-1MB、>1MB 四个区间，
+	// 并报告每个区间的字节数和对象数，用于区分大量小分配 (适合减少分配次数) 与少量大分配 (适合对象池)
+	SizeBuckets bool
+	// MinPercent 大于 0 时，在应用 Top N 之前从按函数统计的列表中丢弃占总量百分比低于该值的函数，
+	// 并在结果中报告被过滤的函数数量和累计值 (分配位置和类型列表不受影响)
+	MinPercent float64
+	// Numbers 是报告中数值的格式 (见 NumberStyles)，零值为 NumberStyleHuman
+	Numbers NumberFormatter
+	// SortBy 是按函数统计的列表的排序方式 (见 FunctionSortKeys)，为空时按 Flat 值排序；
+	// 按 SortByCum 排序时包括 Flat 值为 0 的函数，MinPercent 也按 Cum 值的占比过滤
+	SortBy string
+}
+
+// HeapSizeBucket 是按平均对象大小划分的一个区间中所有分配位置的汇总 (JSON)
+type HeapSizeBucket struct {
+	Range          string  `json:"range"`          // 区间名称，例如 "64B-1KB"
+	MinSize        int64   `json:"minSize"`        // 区间下界 (bytes，含)
+	MaxSize        int64   `json:"maxSize"`        // 区间上界 (bytes，不含)，0 表示没有上界
+	Sites          int     `json:"sites"`          // 落在该区间的分配位置数量
+	Value          int64   `json:"value"`          // 这些分配位置的总值 (bytes)
+	ValueFormatted string  `json:"valueFormatted"` // 格式化后的总值
+	Percentage     float64 `json:"percentage"`     // 占总量的百分比
+	ObjectCount    int64   `json:"objectCount"`    // 这些分配位置的对象总数
+}
+
+// heapSizeBucketBounds 是平均对象大小区间的边界 (每个区间包含下界、不包含上界)
+var heapSizeBucketBounds = []struct {
+	name     string
+	min, max int64
+}{
+	{"<64B", 0, 64},
+	{"64B-1KB", 64, 1024},
+	{"1KB-1MB", 1024, 1024 * 1024},
+	{">1MB", 1024 * 1024, 0},
+}
+
+// heapSizeBuckets 按平均对象大小汇总分配位置 (所有位置，而不只是 Top N)。
+// 没有对象计数的位置无法计算平均大小，不计入任何区间；所有位置都没有对象计数时返回 nil。
+func heapSizeBuckets(values, objects map[string]int64, totalValue int64, numbers NumberFormatter) []HeapSizeBucket {
+	buckets := make([]HeapSizeBucket, len(heapSizeBucketBounds))
+	for i, bound := range heapSizeBucketBounds {
+		buckets[i] = HeapSizeBucket{Range: bound.name, MinSize: bound.min, MaxSize: bound.max}
+	}
+	counted := false
+	for site, value := range values {
+		count := objects[site]
+		if count <= 0 {
+			continue
+		}
+		counted = true
+		avgSize := value / count
+		for i, bound := range heapSizeBucketBounds {
+			if avgSize >= bound.min && (bound.max == 0 || avgSize < bound.max) {
+				buckets[i].Sites++
+				buckets[i].Value += value
+				buckets[i].ObjectCount += count
+				break
+			}
+		}
+	}
+	if !counted {
+		return nil
+	}
+	for i := range buckets {
+		buckets[i].ValueFormatted = numbers.Bytes(buckets[i].Value)
+		if totalValue != 0 {
+			buckets[i].Percentage = float64(buckets[i].Value) / float64(totalValue) * 100
+		}
+	}
+	return buckets
+}
+
+// writeHeapSizeBuckets 写入 Heap 文本报告的 "By Object Size" 表格
+func writeHeapSizeBuckets(b *strings.Builder, valueType string, buckets []HeapSizeBucket) {
+	b.WriteString("\n=== By Object Size (average size per allocation site) ===\n")
+	b.WriteString("--------------------------------------------------\n")
+	b.WriteString(fmt.Sprintf("%-15s %-15s %-15s %-10s %s\n", valueType, "%", "Objects", "Sites", "Size Range"))
+	b.WriteString("--------------------------------------------------\n")
+	for _, bucket := range buckets {
+		b.WriteString(fmt.Sprintf("%-15s %-15.2f %-15d %-10d %s\n",
+			bucket.ValueFormatted, bucket.Percentage, bucket.ObjectCount, bucket.Sites, bucket.Range))
+	}
+}
@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestHeapSizeBuckets 测试 SizeBuckets 按平均对象大小汇总所有分配位置 (包括 Top N 之外的位置)
+func TestHeapSizeBuckets(t *testing.T) {
+	site := func(name string, line int64, objects, bytes int64) *profile.Sample {
+		fn := &profile.Function{Name: name, Filename: "alloc.go"}
+		return &profile.Sample{
+			Location: []*profile.Location{{Line: []profile.Line{{Function: fn, Line: line}}}},
+			Value:    []int64{objects, bytes},
+		}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "inuse_objects", Unit: "count"}, {Type: "inuse_space", Unit: "bytes"}},
+		Sample: []*profile.Sample{
+			site("main.small", 10, 10000, 160000),   // 16B
+			site("main.small", 20, 1000, 32000),     // 32B
+			site("main.medium", 30, 100, 51200),     // 512B
+			site("main.large", 40, 10, 40960),       // 4KB
+			site("main.huge", 50, 2, 4*1024*1024),   // 2MB
+			site("main.nocount", 60, 0, 1024),       // 没有对象计数，不计入任何区间
+			site("main.boundary", 70, 1, 1024*1024), // 恰好 1MB，属于 >1MB
+		},
+	}
+
+	result, err := HeapProfileStatsWithOptions(p, 1, HeapAnalysisOptions{SizeBuckets: true})
+	if err != nil {
+		t.Fatalf("HeapProfileStatsWithOptions() error = %v", err)
+	}
+	want := []struct {
+		rng     string
+		sites   int
+		value   int64
+		objects int64
+	}{
+		{"<64B", 2, 192000, 11000},
+		{"64B-1KB", 1, 51200, 100},
+		{"1KB-1MB", 1, 40960, 10},
+		{">1MB", 2, 5 * 1024 * 1024, 3},
+	}
+	if len(result.SizeBuckets) != len(want) {
+		t.Fatalf("SizeBuckets = %+v, want %d buckets", result.SizeBuckets, len(want))
+	}
+	for i, w := range want {
+		got := result.SizeBuckets[i]
+		if got.Range != w.rng || got.Sites != w.sites || got.Value != w.value || got.ObjectCount != w.objects {
+			t.Errorf("SizeBuckets[%d] = %+v, want range=%s sites=%d value=%d objects=%d", i, got, w.rng, w.sites, w.value, w.objects)
+		}
+	}
+
+	text, err := FormatHeapResult(result, "text")
+	if err != nil {
+		t.Fatalf("FormatHeapResult(text) error = %v", err)
+	}
+	if !containsString(text, "=== By Object Size") || !containsString(text, "64B-1KB") {
+		t.Errorf("text output missing size bucket table:\n%s", text)
+	}
+
+	out, err := FormatHeapResult(result, "json")
+	if err != nil {
+		t.Fatalf("FormatHeapResult(json) error = %v", err)
+	}
+	var decoded struct {
+		SizeBuckets []HeapSizeBucket `json:"sizeBuckets"`
+	}
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(decoded.SizeBuckets) != len(want) || decoded.SizeBuckets[3].MinSize != 1024*1024 {
+		t.Errorf("json sizeBuckets = %+v", decoded.SizeBuckets)
+	}
+
+	// 默认不计算区间，输出与之前相同
+	plain, err := HeapProfileStats(p, 1)
+	if err != nil {
+		t.Fatalf("HeapProfileStats() error = %v", err)
+	}
+	if plain.SizeBuckets != nil {
+		t.Errorf("SizeBuckets without option = %+v, want nil", plain.SizeBuckets)
+	}
+}
@@ -0,0 +1,259 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	// labelMissingValue 表示样本上没有该标签
+	labelMissingValue = "(missing)"
+	// labelOtherValue 汇总超出 MaxValues 的标签值
+	labelOtherValue = "(other)"
+	// defaultLabelMaxValues 是每个维度默认保留的标签值数量
+	defaultLabelMaxValues = 10
+)
+
+// LabelPivotOptions 定义按标签分组/交叉分析的参数
+type LabelPivotOptions struct {
+	// Keys 是分组使用的标签键：1 个键按值分组，2 个键输出 行 × 列 的矩阵
+	Keys []string
+	// MaxValues 是每个维度保留的标签值数量上限，其余值合并为 "(other)"
+	MaxValues int
+	// Numbers 是 text 和 markdown 输出中数值的格式 (见 NumberStyles)，零值为 NumberStyleHuman
+	Numbers NumberFormatter
+}
+
+// LabelPivotResult 是按标签分组/交叉分析的结果 (JSON)
+type LabelPivotResult struct {
+	ProfileType  string    `json:"profileType"`
+	ValueType    string    `json:"valueType"`
+	ValueUnit    string    `json:"valueUnit"`
+	RowKey       string    `json:"rowKey"`
+	ColumnKey    string    `json:"columnKey,omitempty"`
+	Rows         []string  `json:"rows"`
+	Columns      []string  `json:"columns,omitempty"`
+	Values       [][]int64 `json:"values"` // Values[row][column]；单个键时每行只有一列
+	RowTotals    []int64   `json:"rowTotals"`
+	ColumnTotals []int64   `json:"columnTotals,omitempty"`
+	Total        int64     `json:"total"`
+	Unlabeled    int64     `json:"unlabeled"` // 所有分组标签都缺失的样本的值
+}
+
+// AnalyzeLabelPivot 按一个或两个标签键对样本值分组。两个键时输出透视表，
+// 例如 endpoint × status_code，可以看出 "/api/v1 返回 500 的请求花费了多少 CPU"。
+// 缺少某个标签的样本计入 "(missing)"，每个维度只保留值最大的 MaxValues 个标签值，其余合并为 "(other)"。
+func AnalyzeLabelPivot(p *profile.Profile, profileType string, opts LabelPivotOptions, format string) (string, error) {
+	if len(opts.Keys) < 1 || len(opts.Keys) > 2 {
+		return "", fmt.Errorf("需要 1 个或 2 个标签键，当前为 %d 个", len(opts.Keys))
+	}
+	if len(opts.Keys) == 2 && opts.Keys[0] == opts.Keys[1] {
+		return "", fmt.Errorf("两个标签键不能相同: %s", opts.Keys[0])
+	}
+	maxValues := opts.MaxValues
+	if maxValues <= 0 {
+		maxValues = defaultLabelMaxValues
+	}
+	logDebug("Analyzing label pivot: type=%s, keys=%v, maxValues=%d, format=%s", profileType, opts.Keys, maxValues, format)
+
+	valueIndex, _, err := findValueColumn(p, profileType)
+	if err != nil {
+		return "", err
+	}
+	st := p.SampleType[valueIndex]
+
+	rowKey := opts.Keys[0]
+	columnKey := ""
+	if len(opts.Keys) == 2 {
+		columnKey = opts.Keys[1]
+	}
+
+	// 先按原始标签值聚合，再裁剪维度
+	type cell struct{ row, column string }
+	cells := make(map[cell]int64)
+	rowTotals := make(map[string]int64)
+	columnTotals := make(map[string]int64)
+	result := LabelPivotResult{ProfileType: profileType, ValueType: st.Type, ValueUnit: st.Unit, RowKey: rowKey, ColumnKey: columnKey}
+	foundKey := false
+	for _, s := range p.Sample {
+		if len(s.Value) <= valueIndex {
+			continue
+		}
+		v := s.Value[valueIndex]
+		row, rowOK := sampleLabelValue(s, rowKey)
+		column, columnOK := "", false
+		if columnKey != "" {
+			column, columnOK = sampleLabelValue(s, columnKey)
+		}
+		foundKey = foundKey || rowOK || columnOK
+		if !rowOK && !columnOK {
+			result.Unlabeled += v
+		}
+		cells[cell{row, column}] += v
+		rowTotals[row] += v
+		columnTotals[column] += v
+		result.Total += v
+	}
+	if !foundKey {
+		return "", fmt.Errorf("profile 中没有样本带有标签 %s", strings.Join(opts.Keys, " 或 "))
+	}
+
+	var rowIndex, columnIndex map[string]int
+	rowIndex, result.Rows = topLabelValues(rowTotals, maxValues)
+	columnIndex, columns := map[string]int{"": 0}, 1
+	if columnKey != "" {
+		columnIndex, result.Columns = topLabelValues(columnTotals, maxValues)
+		columns = len(result.Columns)
+	}
+
+	result.Values = make([][]int64, len(result.Rows))
+	for i := range result.Values {
+		result.Values[i] = make([]int64, columns)
+	}
+	result.RowTotals = make([]int64, len(result.Rows))
+	if columnKey != "" {
+		result.ColumnTotals = make([]int64, columns)
+	}
+	for c, v := range cells {
+		r, col := rowIndex[c.row], columnIndex[c.column]
+		result.Values[r][col] += v
+		result.RowTotals[r] += v
+		if columnKey != "" {
+			result.ColumnTotals[col] += v
+		}
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatLabelPivot(result, format, opts.Numbers), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// sampleLabelValue 返回样本上 key 标签的值 (多个值以逗号连接)；字符串标签中没有 key 时查找数值标签 (NumLabel)，
+// 有单位时附加在值后面，例如 "4096 bytes"。两者都没有时返回 "(missing)" 和 false
+func sampleLabelValue(s *profile.Sample, key string) (string, bool) {
+	if values := s.Label[key]; len(values) > 0 {
+		return strings.Join(values, ","), true
+	}
+	if values := s.NumLabel[key]; len(values) > 0 {
+		units := s.NumUnit[key]
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = strconv.FormatInt(v, 10)
+			if i < len(units) && units[i] != "" {
+				parts[i] += " " + units[i]
+			}
+		}
+		return strings.Join(parts, ","), true
+	}
+	return labelMissingValue, false
+}
+
+// topLabelValues 为值最大的 maxValues 个标签值分配索引，其余值合并到最后一个 "(other)" 索引。
+// "(missing)" 与其它值一样参与排序。返回 标签值 -> 索引 的映射以及按索引排列的显示名称。
+func topLabelValues(totals map[string]int64, maxValues int) (map[string]int, []string) {
+	values := make([]string, 0, len(totals))
+	for v := range totals {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if totals[values[i]] != totals[values[j]] {
+			return totals[values[i]] > totals[values[j]]
+		}
+		return values[i] < values[j]
+	})
+
+	index := make(map[string]int, len(values))
+	for i, v := range values {
+		index[v] = min(i, maxValues)
+	}
+	if len(values) > maxValues {
+		return index, append(values[:maxValues:maxValues], labelOtherValue)
+	}
+	return index, values
+}
+
+// formatLabelPivot 将分组结果格式化为文本或 Markdown 表格，数值按 numbers 格式化
+func formatLabelPivot(r LabelPivotResult, format string, numbers NumberFormatter) string {
+	var b strings.Builder
+	percent := func(v int64) float64 {
+		if r.Total == 0 {
+			return 0
+		}
+		return float64(v) / float64(r.Total) * 100
+	}
+	cellText := func(v int64) string {
+		return fmt.Sprintf("%s (%.1f%%)", numbers.UnitValue(v, r.ValueUnit), percent(v))
+	}
+
+	title := fmt.Sprintf("标签分组分析 (%s, %s)", r.ProfileType, r.RowKey)
+	if r.ColumnKey != "" {
+		title = fmt.Sprintf("标签交叉分析 (%s, %s × %s)", r.ProfileType, r.RowKey, r.ColumnKey)
+	}
+	header := []string{sanitizeName(r.RowKey)}
+	if r.ColumnKey != "" {
+		for _, c := range r.Columns {
+			header = append(header, sanitizeName(r.ColumnKey+"="+c))
+		}
+	}
+	header = append(header, "合计")
+
+	rows := make([][]string, 0, len(r.Rows)+1)
+	for i, name := range r.Rows {
+		row := []string{sanitizeName(name)}
+		if r.ColumnKey != "" {
+			for _, v := range r.Values[i] {
+				row = append(row, cellText(v))
+			}
+		}
+		rows = append(rows, append(row, cellText(r.RowTotals[i])))
+	}
+	if r.ColumnKey != "" {
+		total := []string{"合计"}
+		for _, v := range r.ColumnTotals {
+			total = append(total, cellText(v))
+		}
+		rows = append(rows, append(total, cellText(r.Total)))
+	}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("# %s\n\n", title))
+		b.WriteString(fmt.Sprintf("- **样本类型**: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("- **总值**: %s\n\n", numbers.UnitValue(r.Total, r.ValueUnit)))
+		b.WriteString("| " + strings.Join(header, " | ") + " |\n")
+		b.WriteString("|" + strings.Repeat("------|", len(header)) + "\n")
+		for _, row := range rows {
+			b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		}
+	} else {
+		b.WriteString(title + "\n")
+		b.WriteString("==============================\n\n")
+		b.WriteString(fmt.Sprintf("样本类型: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("总值: %s\n\n", numbers.UnitValue(r.Total, r.ValueUnit)))
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	}
+
+	if r.Unlabeled > 0 {
+		b.WriteString(fmt.Sprintf("\n没有任何分组标签的样本: %s (%.1f%%)，计入 %s。\n", numbers.UnitValue(r.Unlabeled, r.ValueUnit), percent(r.Unlabeled), labelMissingValue))
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestAnalyzeLabelPivot 测试两个标签键的交叉分析、缺失标签及维度上限
+func TestAnalyzeLabelPivot(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handle"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	sample := func(v int64, labels map[string][]string) *profile.Sample {
+		return &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{v}, Label: labels}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			sample(500, map[string][]string{"endpoint": {"/api/v1"}, "status_code": {"500"}}),
+			sample(300, map[string][]string{"endpoint": {"/api/v1"}, "status_code": {"200"}}),
+			sample(100, map[string][]string{"endpoint": {"/health"}, "status_code": {"200"}}),
+			sample(40, map[string][]string{"endpoint": {"/debug"}}),
+			sample(60, nil),
+		},
+	}
+
+	out, err := AnalyzeLabelPivot(p, "cpu", LabelPivotOptions{Keys: []string{"endpoint", "status_code"}, MaxValues: 2}, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeLabelPivot() error = %v", err)
+	}
+	var result LabelPivotResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	// 行：/api/v1 (800)、(missing) 与 /health 同为 100 时按名称排序，其余合并为 (other)
+	if len(result.Rows) != 3 || result.Rows[0] != "/api/v1" || result.Rows[2] != labelOtherValue {
+		t.Fatalf("Unexpected rows: %v", result.Rows)
+	}
+	if len(result.Columns) != 3 || result.Columns[0] != "500" || result.Columns[1] != "200" {
+		t.Fatalf("Unexpected columns: %v", result.Columns)
+	}
+	if got := result.Values[0][0]; got != 500 {
+		t.Errorf("Expected /api/v1 × 500 = 500, got %d", got)
+	}
+	if result.Total != 1000 || result.Unlabeled != 60 {
+		t.Errorf("Expected total 1000 and unlabeled 60, got %d and %d", result.Total, result.Unlabeled)
+	}
+	sum := int64(0)
+	for _, row := range result.Values {
+		for _, v := range row {
+			sum += v
+		}
+	}
+	if sum != result.Total {
+		t.Errorf("Expected matrix to sum to total %d, got %d", result.Total, sum)
+	}
+
+	// 单个标签键：按值分组
+	text, err := AnalyzeLabelPivot(p, "cpu", LabelPivotOptions{Keys: []string{"endpoint"}}, "markdown")
+	if err != nil {
+		t.Fatalf("AnalyzeLabelPivot() error = %v", err)
+	}
+	for _, want := range []string{"标签分组分析", "/api/v1", "80.0%", labelMissingValue} {
+		if !containsString(text, want) {
+			t.Errorf("Expected markdown to contain %q, got:\n%s", want, text)
+		}
+	}
+
+	if _, err := AnalyzeLabelPivot(p, "cpu", LabelPivotOptions{Keys: []string{"tenant"}}, "text"); err == nil {
+		t.Error("Expected error when no sample has the label, got nil")
+	}
+}
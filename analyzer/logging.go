@@ -0,0 +1,82 @@
+package analyzer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevel 是日志级别，数值越大越重要。零值为 LogLevelInfo
+type LogLevel int
+
+// 日志级别 (LOG_LEVEL 环境变量的可选值)
+const (
+	LogLevelDebug LogLevel = iota - 1 // 分析过程中的细节，例如使用的样本类型索引
+	LogLevelInfo                      // 默认：工具调用和主要步骤
+	LogLevelWarn                      // 不影响结果但值得注意的问题，例如无效的配置被忽略
+	LogLevelError                     // 导致工具调用失败的错误
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelDebug: "debug",
+	LogLevelInfo:  "info",
+	LogLevelWarn:  "warn",
+	LogLevelError: "error",
+}
+
+// String 返回日志级别的名称，例如 "debug"
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// ParseLogLevel 解析日志级别名称 (不区分大小写，"warning" 等同于 "warn")，name 为空时返回 LogLevelInfo
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LogLevelDebug, nil
+	case "", "info":
+		return LogLevelInfo, nil
+	case "warn", "warning":
+		return LogLevelWarn, nil
+	case "error":
+		return LogLevelError, nil
+	}
+	return LogLevelInfo, fmt.Errorf("unsupported log level '%s' (expected debug, info, warn, error)", name)
+}
+
+// currentLogLevel 是进程级的日志级别，低于该级别的日志不输出
+var currentLogLevel atomic.Int64
+
+// SetLogLevel 设置进程级的日志级别
+func SetLogLevel(level LogLevel) {
+	currentLogLevel.Store(int64(level))
+}
+
+// CurrentLogLevel 返回当前的日志级别
+func CurrentLogLevel() LogLevel {
+	return LogLevel(currentLogLevel.Load())
+}
+
+// Logf 在 level 不低于当前日志级别时通过标准库 log 输出一条带级别前缀的日志，例如 "[WARN] ..."
+func Logf(level LogLevel, format string, args ...any) {
+	if level < CurrentLogLevel() {
+		return
+	}
+	log.Printf("["+strings.ToUpper(level.String())+"] "+format, args...)
+}
+
+// logDebug 输出 debug 级别的日志
+func logDebug(format string, args ...any) { Logf(LogLevelDebug, format, args...) }
+
+// logInfo 输出 info 级别的日志
+func logInfo(format string, args ...any) { Logf(LogLevelInfo, format, args...) }
+
+// logWarn 输出 warn 级别的日志
+func logWarn(format string, args ...any) { Logf(LogLevelWarn, format, args...) }
+
+// logError 输出 error 级别的日志
+func logError(format string, args ...any) { Logf(LogLevelError, format, args...) }
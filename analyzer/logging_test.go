@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// captureLogs 在 level 级别下运行 fn 并返回其输出的日志
+func captureLogs(t *testing.T, level LogLevel, fn func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	prevLevel, prevWriter, prevFlags := CurrentLogLevel(), log.Writer(), log.Flags()
+	SetLogLevel(level)
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		SetLogLevel(prevLevel)
+		log.SetOutput(prevWriter)
+		log.SetFlags(prevFlags)
+	}()
+	fn()
+	return buf.String()
+}
+
+// TestParseLogLevel 测试日志级别名称的解析：空值为 info，不区分大小写，无效值返回错误
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]LogLevel{"": LogLevelInfo, "debug": LogLevelDebug, "INFO": LogLevelInfo, "warning": LogLevelWarn, " error ": LogLevelError}
+	for name, want := range tests {
+		if got, err := ParseLogLevel(name); err != nil || got != want {
+			t.Errorf("ParseLogLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("ParseLogLevel(\"verbose\") error = nil, want unsupported log level")
+	}
+}
+
+// TestLogLevelFiltering 测试低于当前级别的日志不输出：默认的 info 级别下不输出 "使用索引" 等 debug 日志
+func TestLogLevelFiltering(t *testing.T) {
+	cpu := newCPUProfile(map[string]int64{"main.hot": 100})
+	analyze := func() {
+		if _, err := CPUProfileStats(cpu, 10, CPUAnalysisOptions{}); err != nil {
+			t.Fatalf("CPUProfileStats() error = %v", err)
+		}
+	}
+	if out := captureLogs(t, LogLevelInfo, analyze); strings.Contains(out, "使用索引") {
+		t.Errorf("info level logged debug messages:\n%s", out)
+	}
+	if out := captureLogs(t, LogLevelDebug, analyze); !strings.Contains(out, "[DEBUG] 使用索引 0") {
+		t.Errorf("debug level did not log the value index:\n%s", out)
+	}
+
+	out := captureLogs(t, LogLevelWarn, func() {
+		logInfo("info message")
+		logWarn("warn message")
+		logError("error message")
+	})
+	if out != "[WARN] warn message\n[ERROR] error message\n" {
+		t.Errorf("warn level output = %q, want only the warn and error messages", out)
+	}
+}
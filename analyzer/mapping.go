@@ -0,0 +1,141 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// unmappedName 是不属于任何 Mapping 的样本 (叶子帧没有 Mapping 或样本没有调用栈) 的汇总名称
+const unmappedName = "(unmapped)"
+
+// MappingCoverage 代表一个 Mapping (主程序、插件或共享库) 上的样本归属 (JSON)
+type MappingCoverage struct {
+	File           string  `json:"file"`
+	BuildID        string  `json:"buildId,omitempty"`
+	IsMain         bool    `json:"isMain"`     // profile 的第一个 Mapping 是主程序
+	HasSymbols     bool    `json:"hasSymbols"` // Mapping 记录了函数信息，或其 Location 已经符号化
+	Samples        int     `json:"samples"`
+	Value          int64   `json:"value"` // 叶子帧落在该 Mapping 中的样本在 ValueType 上的值之和
+	ValueFormatted string  `json:"valueFormatted"`
+	Percent        float64 `json:"percent"`
+}
+
+// MappingReport 代表按 Mapping 汇总的样本归属 (JSON)
+type MappingReport struct {
+	ValueType string            `json:"valueType"`
+	ValueUnit string            `json:"valueUnit"`
+	Mappings  []MappingCoverage `json:"mappings"`
+}
+
+// mappingDefaultValueIndex 返回用于 Mapping 汇总的样本类型：DefaultSampleType，未设置时使用最后一个 (与 go tool pprof 一致)
+func mappingDefaultValueIndex(p *profile.Profile) int {
+	for i, st := range p.SampleType {
+		if p.DefaultSampleType != "" && st.Type == p.DefaultSampleType {
+			return i
+		}
+	}
+	return len(p.SampleType) - 1
+}
+
+// AnalyzeMappingCoverage 按叶子帧所在的 Mapping 汇总样本数和值，揭示开销在主程序、插件和共享库之间的分布，
+// 并标出没有符号信息的 Mapping。profile 中没有任何 Mapping 时返回 nil。
+func AnalyzeMappingCoverage(p *profile.Profile) *MappingReport {
+	if len(p.Mapping) == 0 || len(p.SampleType) == 0 {
+		return nil
+	}
+	valueIndex := mappingDefaultValueIndex(p)
+	report := &MappingReport{ValueType: p.SampleType[valueIndex].Type, ValueUnit: p.SampleType[valueIndex].Unit}
+
+	// 同一个文件可能对应多个 Mapping (不同的段)，按文件和 build ID 合并为一行
+	byMapping := make(map[*profile.Mapping]*MappingCoverage, len(p.Mapping))
+	byFile := make(map[string]*MappingCoverage)
+	var coverages []*MappingCoverage
+	for i, m := range p.Mapping {
+		key := m.File + "\x00" + m.BuildID
+		c, ok := byFile[key]
+		if !ok {
+			c = &MappingCoverage{File: m.File, BuildID: m.BuildID}
+			byFile[key] = c
+			coverages = append(coverages, c)
+		}
+		c.IsMain = c.IsMain || i == 0
+		c.HasSymbols = c.HasSymbols || m.HasFunctions
+		byMapping[m] = c
+	}
+	for _, loc := range p.Location {
+		if loc.Mapping != nil && len(loc.Line) > 0 {
+			if c, ok := byMapping[loc.Mapping]; ok {
+				c.HasSymbols = true
+			}
+		}
+	}
+	unmapped := &MappingCoverage{File: unmappedName}
+
+	total := int64(0)
+	for _, s := range p.Sample {
+		c := unmapped
+		if len(s.Location) > 0 && s.Location[0].Mapping != nil {
+			if mc, ok := byMapping[s.Location[0].Mapping]; ok {
+				c = mc
+			}
+		}
+		c.Samples++
+		if valueIndex < len(s.Value) {
+			c.Value += s.Value[valueIndex]
+			total += s.Value[valueIndex]
+		}
+	}
+
+	for _, c := range coverages {
+		report.Mappings = append(report.Mappings, *c)
+	}
+	if unmapped.Samples > 0 {
+		report.Mappings = append(report.Mappings, *unmapped)
+	}
+	for i := range report.Mappings {
+		c := &report.Mappings[i]
+		c.ValueFormatted = formatUnitValue(c.Value, report.ValueUnit)
+		if total != 0 {
+			c.Percent = float64(c.Value) / float64(total) * 100
+		}
+	}
+	sort.Slice(report.Mappings, func(i, j int) bool {
+		a, b := report.Mappings[i], report.Mappings[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		if a.Samples != b.Samples {
+			return a.Samples > b.Samples
+		}
+		return a.File < b.File
+	})
+	return report
+}
+
+// mappingDisplayName 返回 Mapping 的显示名称：文件名 (去掉目录)，主程序加上标记
+func mappingDisplayName(c MappingCoverage) string {
+	name := c.File
+	if name == "" {
+		name = "(unknown)"
+	} else if name != unmappedName {
+		name = filepath.Base(name)
+	}
+	if c.IsMain {
+		name += " (主程序)"
+	}
+	return sanitizeName(name)
+}
+
+// mappingSymbolStatus 返回 Mapping 是否有符号信息的说明
+func mappingSymbolStatus(c MappingCoverage) string {
+	switch {
+	case c.File == unmappedName:
+		return "-"
+	case c.HasSymbols:
+		return "有符号"
+	default:
+		return "无符号"
+	}
+}
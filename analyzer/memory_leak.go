@@ -1,121 +1,105 @@
 package analyzer
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/google/pprof/profile"
 )
 
+// Leak detection metrics: the sample type compared between the two heap profiles.
+const (
+	LeakMetricInuseSpace   = "inuse_space"   // Live heap bytes (default)
+	LeakMetricAllocSpace   = "alloc_space"   // Bytes allocated since the program started, including freed memory
+	LeakMetricInuseObjects = "inuse_objects" // Live heap objects
+	LeakMetricAllocObjects = "alloc_objects" // Objects allocated since the program started
+)
+
+// LeakMetrics lists the supported values of LeakDetectionOptions.Metric.
+var LeakMetrics = []string{LeakMetricInuseSpace, LeakMetricAllocSpace, LeakMetricInuseObjects, LeakMetricAllocObjects}
+
+// LeakDetectionOptions holds the optional settings for memory leak detection.
+type LeakDetectionOptions struct {
+	Threshold  float64        // Minimum growth ratio to report (0.1 means 10%)
+	Limit      int            // Maximum number of potential leaks to show, sorted by absolute byte growth (default 10)
+	Ignore     *regexp.Regexp // Samples whose stack matches this pattern are excluded from both profiles
+	StackDepth int            // Maximum number of frames shown per allocation stack (0 shows the full stack)
+	Metric     string         // Sample type to compare, one of LeakMetrics (default inuse_space)
+}
+
+// allocationStack is the metric value of one allocation call path of an object type.
+type allocationStack struct {
+	Frames []string // Frames from the allocation site (leaf) to the root, including inlined frames
+	Value  int64
+}
+
+// excludedStats records how much of a profile was dropped by the ignore filter.
+type excludedStats struct {
+	Samples int
+	Value   int64 // Sum of the compared metric over the excluded samples
+	Types   map[string]bool
+}
+
 // DetectPotentialMemoryLeaks analyzes Heap profiles and attempts to detect potential memory leaks.
 // This function compares two Heap profiles (typically snapshots from different points in time) and identifies memory allocations with significant growth.
 func DetectPotentialMemoryLeaks(oldProfile, newProfile *profile.Profile, threshold float64, limit int) (string, error) {
+	return DetectPotentialMemoryLeaksWithOptions(oldProfile, newProfile, LeakDetectionOptions{
+		Threshold: threshold,
+		Limit:     limit,
+	})
+}
+
+// DetectPotentialMemoryLeaksWithOptions is like DetectPotentialMemoryLeaks but accepts additional options,
+// such as an ignore pattern for known-benign growing allocations.
+func DetectPotentialMemoryLeaksWithOptions(oldProfile, newProfile *profile.Profile, opts LeakDetectionOptions) (string, error) {
+	return DetectPotentialMemoryLeaksContext(context.Background(), oldProfile, newProfile, opts)
+}
+
+// DetectPotentialMemoryLeaksContext is DetectPotentialMemoryLeaksWithOptions, but checks ctx periodically while
+// aggregating samples and stops promptly once it is canceled.
+func DetectPotentialMemoryLeaksContext(ctx context.Context, oldProfile, newProfile *profile.Profile, opts LeakDetectionOptions) (string, error) {
+	threshold := opts.Threshold
+	limit := opts.Limit
+	metric := opts.Metric
 	if threshold <= 0 {
 		threshold = 0.1 // Default threshold: 10% growth
 	}
 	if limit <= 0 {
 		limit = 10 // Default: show top 10 potential leaks
 	}
-
-	// Analyze memory usage in the old profile
-	oldMemory := make(map[string]int64)
-	oldObjects := make(map[string]int64)
-
-	// Find indices for inuse_space and inuse_objects
-	oldValueIndex := -1
-	oldObjectsIndex := -1
-
-	for i, st := range oldProfile.SampleType {
-		if st.Type == "inuse_space" && st.Unit == "bytes" {
-			oldValueIndex = i
-		}
-		if st.Type == "inuse_objects" && st.Unit == "count" {
-			oldObjectsIndex = i
-		}
+	if metric == "" {
+		metric = LeakMetricInuseSpace
 	}
-
-	if oldValueIndex == -1 {
-		return "", fmt.Errorf("could not find inuse_space sample type in the old profile")
+	if !slices.Contains(LeakMetrics, metric) {
+		return "", fmt.Errorf("unsupported leak detection metric: '%s' (expected %s)", metric, strings.Join(LeakMetrics, ", "))
 	}
-
-	// Aggregate memory usage in the old profile
-	for _, s := range oldProfile.Sample {
-		if len(s.Location) > 0 && len(s.Value) > oldValueIndex {
-			v := s.Value[oldValueIndex]
-
-			// Get object count
-			var objCount int64 = 0
-			if oldObjectsIndex >= 0 && len(s.Value) > oldObjectsIndex {
-				objCount = s.Value[oldObjectsIndex]
-			}
-
-			// Extract type information (if available)
-			typeName := "unknown"
-			if len(s.Label) > 0 {
-				if typeLabels, ok := s.Label["type"]; ok && len(typeLabels) > 0 {
-					typeName = typeLabels[0]
-				} else if objLabels, ok := s.Label["object"]; ok && len(objLabels) > 0 {
-					typeName = objLabels[0]
-				}
-			}
-
-			// Aggregate by type
-			oldMemory[typeName] += v
-			if objCount > 0 {
-				oldObjects[typeName] += objCount
-			}
-		}
+	formatValue := FormatBytes
+	if strings.HasSuffix(metric, "_objects") {
+		formatValue = func(v int64) string { return fmt.Sprintf("%d", v) }
 	}
 
-	// Analyze memory usage in the new profile
-	newMemory := make(map[string]int64)
-	newObjects := make(map[string]int64)
-
-	// Find indices for inuse_space and inuse_objects
-	newValueIndex := -1
-	newObjectsIndex := -1
-
-	for i, st := range newProfile.SampleType {
-		if st.Type == "inuse_space" && st.Unit == "bytes" {
-			newValueIndex = i
-		}
-		if st.Type == "inuse_objects" && st.Unit == "count" {
-			newObjectsIndex = i
-		}
+	// Find the indices of the selected metric (and its object count) in both profiles
+	oldValueIndex, oldObjectsIndex := findLeakIndices(oldProfile, metric)
+	if oldValueIndex == -1 {
+		return "", fmt.Errorf("could not find %s sample type in the old profile (available: %s)", metric, sampleTypeNames(oldProfile))
 	}
-
+	newValueIndex, newObjectsIndex := findLeakIndices(newProfile, metric)
 	if newValueIndex == -1 {
-		return "", fmt.Errorf("could not find inuse_space sample type in the new profile")
+		return "", fmt.Errorf("could not find %s sample type in the new profile (available: %s)", metric, sampleTypeNames(newProfile))
 	}
 
-	// Aggregate memory usage in the new profile
-	for _, s := range newProfile.Sample {
-		if len(s.Location) > 0 && len(s.Value) > newValueIndex {
-			v := s.Value[newValueIndex]
-
-			// Get object count
-			var objCount int64 = 0
-			if newObjectsIndex >= 0 && len(s.Value) > newObjectsIndex {
-				objCount = s.Value[newObjectsIndex]
-			}
-
-			// Extract type information (if available)
-			typeName := "unknown"
-			if len(s.Label) > 0 {
-				if typeLabels, ok := s.Label["type"]; ok && len(typeLabels) > 0 {
-					typeName = typeLabels[0]
-				} else if objLabels, ok := s.Label["object"]; ok && len(objLabels) > 0 {
-					typeName = objLabels[0]
-				}
-			}
-
-			// Aggregate by type
-			newMemory[typeName] += v
-			if objCount > 0 {
-				newObjects[typeName] += objCount
-			}
-		}
+	// Aggregate memory usage in both profiles, applying the ignore filter before diffing
+	oldMemory, oldObjects, oldStacks, oldExcluded, err := aggregateMemoryByType(ctx, oldProfile, oldValueIndex, oldObjectsIndex, opts.Ignore)
+	if err != nil {
+		return "", err
+	}
+	newMemory, newObjects, newStacks, newExcluded, err := aggregateMemoryByType(ctx, newProfile, newValueIndex, newObjectsIndex, opts.Ignore)
+	if err != nil {
+		return "", err
 	}
 
 	// Calculate memory growth
@@ -173,28 +157,49 @@ func DetectPotentialMemoryLeaks(oldProfile, newProfile *profile.Profile, thresho
 		}
 	}
 
-	// Sort by memory growth
+	// Sort by absolute memory growth
 	sort.Slice(growthStats, func(i, j int) bool {
-		return growthStats[i].Growth > growthStats[j].Growth
+		if growthStats[i].Growth != growthStats[j].Growth {
+			return growthStats[i].Growth > growthStats[j].Growth
+		}
+		return growthStats[i].Type < growthStats[j].Type
 	})
 
 	// Format output
 	var b strings.Builder
 	b.WriteString("Memory Leak Detection Report\n")
 	b.WriteString("==========================\n\n")
+	b.WriteString(fmt.Sprintf("Metric: %s\n", metric))
+	if strings.HasPrefix(metric, "alloc_") {
+		b.WriteString("Note: alloc_* counts every allocation since the program started, so growth shows allocation churn rather than retained memory\n")
+	}
+	b.WriteString("\n")
+
+	if opts.Ignore != nil {
+		writeExcludedNote(&b, opts.Ignore, oldExcluded, newExcluded, formatValue)
+	}
 
 	if len(growthStats) == 0 {
 		b.WriteString("No significant memory growth detected.\n")
 		return b.String(), nil
 	}
 
-	b.WriteString(fmt.Sprintf("Found %d types with significant memory growth (threshold: %.1f%%)\n\n",
+	b.WriteString(fmt.Sprintf("Found %d types with significant memory growth (threshold: %.1f%%)\n",
 		len(growthStats), threshold*100))
+	if len(growthStats) > limit {
+		b.WriteString(fmt.Sprintf("Showing top %d of %d candidates by absolute growth; %d more not shown (raise top_n to see them)\n",
+			limit, len(growthStats), len(growthStats)-limit))
+	}
+	b.WriteString("\n")
 
 	b.WriteString("Top Potential Memory Leaks:\n")
 	b.WriteString("--------------------------------------------------\n")
+	oldHeader, newHeader := "Old Size", "New Size"
+	if strings.HasSuffix(metric, "_objects") {
+		oldHeader, newHeader = "Old Count", "New Count"
+	}
 	b.WriteString(fmt.Sprintf("%-20s %-15s %-15s %-15s %s\n",
-		"Type", "Old Size", "New Size", "Growth", "Growth %"))
+		"Type", oldHeader, newHeader, "Growth", "Growth %"))
 	b.WriteString("--------------------------------------------------\n")
 
 	displayLimit := limit
@@ -205,10 +210,10 @@ func DetectPotentialMemoryLeaks(oldProfile, newProfile *profile.Profile, thresho
 	for i := 0; i < displayLimit; i++ {
 		stat := growthStats[i]
 		b.WriteString(fmt.Sprintf("%-20s %-15s %-15s %-15s %.2f%%",
-			stat.Type,
-			FormatBytes(stat.OldValue),
-			FormatBytes(stat.NewValue),
-			FormatBytes(stat.Growth),
+			sanitizeName(stat.Type),
+			formatValue(stat.OldValue),
+			formatValue(stat.NewValue),
+			formatValue(stat.Growth),
 			stat.GrowthPercent))
 
 		if stat.OldCount > 0 || stat.NewCount > 0 {
@@ -219,6 +224,12 @@ func DetectPotentialMemoryLeaks(oldProfile, newProfile *profile.Profile, thresho
 		b.WriteString("\n")
 	}
 
+	// pprof has no reference graph, so the allocation call path is the best hint at what retains the memory
+	b.WriteString("\nAllocation Stacks (call path that allocated the growing memory, allocation site first):\n")
+	for i := 0; i < displayLimit; i++ {
+		writeGrowingStack(&b, sanitizeName(growthStats[i].Type), oldStacks[growthStats[i].Type], newStacks[growthStats[i].Type], opts.StackDepth, formatValue)
+	}
+
 	b.WriteString("\nRecommendations:\n")
 	b.WriteString("1. Focus on types with both high absolute growth and high percentage growth\n")
 	b.WriteString("2. Look for objects that grow in count but not significantly in size (may indicate collection leaks)\n")
@@ -226,3 +237,169 @@ func DetectPotentialMemoryLeaks(oldProfile, newProfile *profile.Profile, thresho
 
 	return b.String(), nil
 }
+
+// findLeakIndices returns the index of the metric's sample type and, for the *_space metrics, of the matching
+// *_objects sample type reported alongside it. Either index is -1 when absent; objectsIndex is always -1 for
+// the *_objects metrics, which already compare object counts.
+func findLeakIndices(p *profile.Profile, metric string) (valueIndex, objectsIndex int) {
+	valueIndex, objectsIndex = -1, -1
+	unit, objectsType := "bytes", strings.TrimSuffix(metric, "_space")+"_objects"
+	if strings.HasSuffix(metric, "_objects") {
+		unit, objectsType = "count", ""
+	}
+	for i, st := range p.SampleType {
+		if st.Type == metric && st.Unit == unit {
+			valueIndex = i
+		}
+		if objectsType != "" && st.Type == objectsType && st.Unit == "count" {
+			objectsIndex = i
+		}
+	}
+	return valueIndex, objectsIndex
+}
+
+// aggregateMemoryByType sums memory and object counts per object type, and memory per allocation stack
+// within each type (keyed by type, then by stack signature).
+// Samples whose stack matches ignore are skipped and accounted for in the returned excludedStats.
+// ctx is checked periodically; once it is canceled an error wrapping ctx.Err() is returned.
+func aggregateMemoryByType(ctx context.Context, p *profile.Profile, valueIndex, objectsIndex int, ignore *regexp.Regexp) (memory, objects map[string]int64, stacks map[string]map[string]*allocationStack, excluded excludedStats, err error) {
+	memory = make(map[string]int64)
+	objects = make(map[string]int64)
+	stacks = make(map[string]map[string]*allocationStack)
+	excluded.Types = make(map[string]bool)
+
+	for i, s := range p.Sample {
+		if err = checkCanceled(ctx, i); err != nil {
+			return nil, nil, nil, excludedStats{}, err
+		}
+		if len(s.Location) > 0 && len(s.Value) > valueIndex {
+			v := s.Value[valueIndex]
+
+			// Get object count
+			var objCount int64 = 0
+			if objectsIndex >= 0 && len(s.Value) > objectsIndex {
+				objCount = s.Value[objectsIndex]
+			}
+
+			// Extract type information (if available)
+			typeName := "unknown"
+			if len(s.Label) > 0 {
+				if typeLabels, ok := s.Label["type"]; ok && len(typeLabels) > 0 {
+					typeName = typeLabels[0]
+				} else if objLabels, ok := s.Label["object"]; ok && len(objLabels) > 0 {
+					typeName = objLabels[0]
+				}
+			}
+
+			if ignore != nil && sampleMatches(s, ignore) {
+				excluded.Samples++
+				excluded.Value += v
+				excluded.Types[typeName] = true
+				continue
+			}
+
+			// Aggregate by type
+			memory[typeName] += v
+			if objCount > 0 {
+				objects[typeName] += objCount
+			}
+
+			frames := allocationFrames(s)
+			key := strings.Join(frames, "|")
+			if stacks[typeName] == nil {
+				stacks[typeName] = make(map[string]*allocationStack)
+			}
+			if stack, ok := stacks[typeName][key]; ok {
+				stack.Value += v
+			} else {
+				stacks[typeName][key] = &allocationStack{Frames: frames, Value: v}
+			}
+		}
+	}
+
+	return memory, objects, stacks, excluded, nil
+}
+
+// allocationFrames renders the sample's call stack from the allocation site to the root, including inlined frames,
+// as "function (file:line)" (or just the function name when the profile has no file information).
+func allocationFrames(s *profile.Sample) []string {
+	var frames []string
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			frame := line.Function.Name
+			if line.Function.Filename != "" {
+				frame = fmt.Sprintf("%s (%s:%d)", frame, line.Function.Filename, line.Line)
+			}
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// writeGrowingStack writes the allocation stack whose metric value grew the most for one leaking type,
+// showing at most depth frames (0 shows the full stack).
+func writeGrowingStack(b *strings.Builder, typeName string, oldStacks, newStacks map[string]*allocationStack, depth int, formatValue func(int64) string) {
+	var top *allocationStack
+	var topGrowth int64
+	growing := 0
+	for key, stack := range newStacks {
+		growth := stack.Value
+		if old, ok := oldStacks[key]; ok {
+			growth -= old.Value
+		}
+		if growth <= 0 {
+			continue
+		}
+		growing++
+		// Ties are broken by signature so the report is stable
+		if top == nil || growth > topGrowth || (growth == topGrowth && strings.Join(stack.Frames, "|") < strings.Join(top.Frames, "|")) {
+			top, topGrowth = stack, growth
+		}
+	}
+
+	b.WriteString(fmt.Sprintf("\n%s:\n", typeName))
+	if top == nil {
+		b.WriteString("  (no single allocation stack grew; the growth is spread over stacks that also shrank)\n")
+		return
+	}
+	b.WriteString(fmt.Sprintf("  +%s (now %s)", formatValue(topGrowth), formatValue(top.Value)))
+	if growing > 1 {
+		b.WriteString(fmt.Sprintf(" (largest of %d growing stacks)", growing))
+	}
+	b.WriteString("\n")
+	frames := top.Frames
+	if depth > 0 && len(frames) > depth {
+		frames = frames[:depth]
+	}
+	for _, frame := range frames {
+		b.WriteString(fmt.Sprintf("    %s\n", frame))
+	}
+	if hidden := len(top.Frames) - len(frames); hidden > 0 {
+		b.WriteString(fmt.Sprintf("    ... %d more frames (raise stack_depth to see them)\n", hidden))
+	}
+}
+
+// writeExcludedNote describes what the ignore pattern removed from the comparison.
+func writeExcludedNote(b *strings.Builder, ignore *regexp.Regexp, oldExcluded, newExcluded excludedStats, formatValue func(int64) string) {
+	b.WriteString(fmt.Sprintf("Ignore pattern: %s\n", ignore.String()))
+	b.WriteString(fmt.Sprintf("Excluded from old profile: %d samples (%s)\n", oldExcluded.Samples, formatValue(oldExcluded.Value)))
+	b.WriteString(fmt.Sprintf("Excluded from new profile: %d samples (%s)\n", newExcluded.Samples, formatValue(newExcluded.Value)))
+
+	types := make([]string, 0, len(newExcluded.Types))
+	for typeName := range oldExcluded.Types {
+		types = append(types, typeName)
+	}
+	for typeName := range newExcluded.Types {
+		if !oldExcluded.Types[typeName] {
+			types = append(types, typeName)
+		}
+	}
+	if len(types) > 0 {
+		sort.Strings(types)
+		b.WriteString(fmt.Sprintf("Excluded types: %s\n", strings.Join(types, ", ")))
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,284 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// defaultMultiRegressionThresholdPercent 是未设置 RegressionThresholdPercent 时，多 profile 比较中判定函数回归的增长百分比
+const defaultMultiRegressionThresholdPercent = 5.0
+
+// MultiDiffCell 是矩阵中一个函数在一个输入 profile 中的值以及相对 baseline 的变化 (JSON)
+type MultiDiffCell struct {
+	Label          string  `json:"label"`
+	Value          int64   `json:"value"`
+	ValueFormatted string  `json:"valueFormatted"`
+	Diff           int64   `json:"diff"`           // 相对 baseline 的变化 (baseline 自身为 0)
+	DiffPercentage float64 `json:"diffPercentage"` // 相对 baseline 的变化百分比 (新增函数按 100% 计)
+	Regressed      bool    `json:"regressed"`      // 增长是否超过回归阈值
+}
+
+// MultiDiffRow 是矩阵中的一个函数：每个输入 profile 一个单元格，第一个单元格是 baseline (JSON)
+type MultiDiffRow struct {
+	FunctionName string          `json:"functionName"`
+	FunctionID   string          `json:"functionId"`
+	Cells        []MultiDiffCell `json:"cells"`
+	Divergent    bool            `json:"divergent"` // 只在部分 candidate 中回归
+}
+
+// MultiDiffCandidate 是一个 candidate 相对 baseline 的总体变化 (JSON)
+type MultiDiffCandidate struct {
+	Label              string  `json:"label"`
+	Total              int64   `json:"total"`
+	TotalDiff          int64   `json:"totalDiff"`
+	TotalDiffPercent   float64 `json:"totalDiffPercent"`
+	RegressedFunctions int     `json:"regressedFunctions"` // 增长超过回归阈值的函数数量
+}
+
+// MultiDiffResult 是一个 baseline 与多个 candidate 的矩阵比较结果 (JSON)
+type MultiDiffResult struct {
+	ProfileType        string               `json:"profileType"`
+	Aggregation        string               `json:"aggregation"`
+	ValueType          string               `json:"valueType"`
+	ValueUnit          string               `json:"valueUnit"`
+	ThresholdPercent   float64              `json:"thresholdPercent"` // 判定函数回归的增长百分比
+	BaselineLabel      string               `json:"baselineLabel"`
+	BaselineTotal      int64                `json:"baselineTotal"`
+	Candidates         []MultiDiffCandidate `json:"candidates"`
+	BestCandidate      string               `json:"bestCandidate"`      // 相对 baseline 总值增长最少的 candidate
+	DivergentFunctions int                  `json:"divergentFunctions"` // 只在部分 candidate 中回归的函数总数 (不受 TopN 限制)
+	TopN               int                  `json:"topN"`
+	Functions          []MultiDiffRow       `json:"functions"` // 按各 candidate 中最大的变化绝对值排序，分歧函数优先
+}
+
+// CompareProfilesMulti 将 profiles[1:] 中的每个 candidate 与 profiles[0] (baseline) 比较，
+// 生成每个函数在所有输入中的值矩阵，并标记只在部分 candidate 中回归的函数，用于判断哪个 candidate 的回归更少。
+// 单个 candidate 的比较与 CompareProfilesWithOptions 相同；opts.RegressionThresholdPercent 为判定回归的增长百分比 (默认 5)，
+// opts.TopN 限制矩阵的行数 (默认 20)，opts.Format 决定输出格式 (text、markdown、json)。
+func CompareProfilesMulti(profiles []*profile.Profile, labels []string, profileTypeName string, opts CompareOptions) (string, error) {
+	return CompareProfilesMultiContext(context.Background(), profiles, labels, profileTypeName, opts)
+}
+
+// CompareProfilesMultiContext 与 CompareProfilesMulti 相同，但在聚合样本时定期检查 ctx，ctx 被取消时尽快停止
+func CompareProfilesMultiContext(ctx context.Context, profiles []*profile.Profile, labels []string, profileTypeName string, opts CompareOptions) (string, error) {
+	result, err := compareProfilesMulti(ctx, profiles, labels, profileTypeName, opts)
+	if err != nil {
+		return "", err
+	}
+
+	switch opts.Format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatMultiDiff(result, opts.Format), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", opts.Format)
+	}
+}
+
+// compareProfilesMulti 计算 CompareProfilesMulti 的矩阵
+func compareProfilesMulti(ctx context.Context, profiles []*profile.Profile, labels []string, profileTypeName string, opts CompareOptions) (*MultiDiffResult, error) {
+	if len(profiles) < 2 {
+		return nil, fmt.Errorf("至少需要 2 个 profile (1 个 baseline 和至少 1 个 candidate)")
+	}
+	if len(labels) != len(profiles) {
+		return nil, fmt.Errorf("标签数量 (%d) 与 profile 数量 (%d) 不匹配", len(labels), len(profiles))
+	}
+	aggregation := opts.Aggregation
+	if aggregation == "" {
+		aggregation = AggregationLeaf
+	}
+	threshold := opts.RegressionThresholdPercent
+	if threshold <= 0 {
+		threshold = defaultMultiRegressionThresholdPercent
+	}
+	topN := opts.TopN
+	if topN <= 0 {
+		topN = 20
+	}
+	logDebug("Comparing %d candidates against one baseline: type=%s, aggregation=%s", len(profiles)-1, profileTypeName, aggregation)
+
+	result := &MultiDiffResult{
+		ProfileType:      profileTypeName,
+		Aggregation:      aggregation,
+		ThresholdPercent: threshold,
+		BaselineLabel:    labels[0],
+		TopN:             topN,
+	}
+	candidates := len(profiles) - 1
+	rows := make(map[string]*MultiDiffRow)
+	for i, candidate := range profiles[1:] {
+		label := labels[i+1]
+		diffs, summary, valueType, err := computeProfileDiff(ctx, profiles[0], candidate, profileTypeName, aggregation, opts)
+		if err != nil {
+			return nil, fmt.Errorf("candidate %s: %w", label, err)
+		}
+		if i == 0 {
+			result.ValueType, result.ValueUnit = valueType.Type, valueType.Unit
+			result.BaselineTotal = summary.BaselineTotal
+		}
+
+		entry := MultiDiffCandidate{Label: label, Total: summary.TargetTotal, TotalDiff: summary.TotalDiff, TotalDiffPercent: summary.TotalDiffPercent}
+		for _, d := range diffs {
+			row, ok := rows[d.FunctionName]
+			if !ok {
+				row = &MultiDiffRow{FunctionName: d.FunctionName, FunctionID: d.FunctionID, Cells: make([]MultiDiffCell, candidates+1)}
+				rows[d.FunctionName] = row
+			}
+			row.Cells[0].Value = d.BaselineValue
+			regressed := d.DiffValue > 0 && d.DiffPercentage > threshold && !(opts.ExcludeLowConfidence && d.LowConfidence)
+			if regressed {
+				entry.RegressedFunctions++
+			}
+			row.Cells[i+1] = MultiDiffCell{Value: d.TargetValue, Diff: d.DiffValue, DiffPercentage: d.DiffPercentage, Regressed: regressed}
+		}
+		result.Candidates = append(result.Candidates, entry)
+	}
+
+	best := result.Candidates[0]
+	for _, c := range result.Candidates[1:] {
+		if c.TotalDiff < best.TotalDiff {
+			best = c
+		}
+	}
+	result.BestCandidate = best.Label
+
+	all := make([]*MultiDiffRow, 0, len(rows))
+	maxChange := make(map[*MultiDiffRow]int64, len(rows))
+	for _, row := range rows {
+		// baseline 中的函数出现在每个 candidate 的比较中；没有出现的单元格表示该函数在 baseline 和该 candidate 中都不存在，保持 0
+		regressedIn := 0
+		for i := range row.Cells {
+			cell := &row.Cells[i]
+			cell.Label = labels[i]
+			cell.ValueFormatted = formatUnitValue(cell.Value, result.ValueUnit)
+			if cell.Regressed {
+				regressedIn++
+			}
+			if change := int64(math.Abs(float64(cell.Diff))); change > maxChange[row] {
+				maxChange[row] = change
+			}
+		}
+		row.Divergent = regressedIn > 0 && regressedIn < candidates
+		if row.Divergent {
+			result.DivergentFunctions++
+		}
+		all = append(all, row)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Divergent != all[j].Divergent {
+			return all[i].Divergent
+		}
+		if maxChange[all[i]] != maxChange[all[j]] {
+			return maxChange[all[i]] > maxChange[all[j]]
+		}
+		return all[i].FunctionName < all[j].FunctionName
+	})
+	if len(all) > topN {
+		all = all[:topN]
+	}
+	result.Functions = make([]MultiDiffRow, 0, len(all))
+	for _, row := range all {
+		result.Functions = append(result.Functions, *row)
+	}
+	return result, nil
+}
+
+// formatMultiDiff 将矩阵比较结果格式化为宽表：每个输入一列，分歧函数标出在哪些 candidate 中回归
+func formatMultiDiff(r *MultiDiffResult, format string) string {
+	var b strings.Builder
+
+	summaryHeader := []string{"Candidate", "总值", "相对 Baseline", "回归函数"}
+	summaryRows := make([][]string, 0, len(r.Candidates))
+	for _, c := range r.Candidates {
+		summaryRows = append(summaryRows, []string{
+			sanitizeName(c.Label),
+			formatUnitValue(c.Total, r.ValueUnit),
+			fmt.Sprintf("%s (%+.2f%%)", signedUnitValue(c.TotalDiff, r.ValueUnit), c.TotalDiffPercent),
+			fmt.Sprintf("%d", c.RegressedFunctions),
+		})
+	}
+
+	matrixHeader := []string{"函数", sanitizeName(r.BaselineLabel) + " (baseline)"}
+	for _, c := range r.Candidates {
+		matrixHeader = append(matrixHeader, sanitizeName(c.Label))
+	}
+	matrixHeader = append(matrixHeader, "回归于")
+	matrixRows := make([][]string, 0, len(r.Functions))
+	for _, row := range r.Functions {
+		cols := []string{truncateString(row.FunctionName, 60), row.Cells[0].ValueFormatted}
+		var regressedIn []string
+		for _, cell := range row.Cells[1:] {
+			mark := ""
+			if cell.Regressed {
+				mark = " ▲"
+				regressedIn = append(regressedIn, sanitizeName(cell.Label))
+			}
+			cols = append(cols, fmt.Sprintf("%s (%+.1f%%)%s", cell.ValueFormatted, cell.DiffPercentage, mark))
+		}
+		switch {
+		case len(regressedIn) == 0:
+			cols = append(cols, "-")
+		case row.Divergent:
+			cols = append(cols, "仅 "+strings.Join(regressedIn, ", "))
+		default:
+			cols = append(cols, "全部")
+		}
+		matrixRows = append(matrixRows, cols)
+	}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("# 多 Profile 差异矩阵 (%s, baseline + %d 个 candidate)\n\n", r.ProfileType, len(r.Candidates)))
+		b.WriteString(fmt.Sprintf("- **样本类型**: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("- **聚合方式**: %s\n", r.Aggregation))
+		b.WriteString(fmt.Sprintf("- **Baseline (%s) 总值**: %s\n", sanitizeName(r.BaselineLabel), formatUnitValue(r.BaselineTotal, r.ValueUnit)))
+		b.WriteString(fmt.Sprintf("- **回归阈值**: %.2f%%\n\n", r.ThresholdPercent))
+		writeMarkdownTable(&b, summaryHeader, summaryRows)
+		b.WriteString(fmt.Sprintf("\n## 函数矩阵 (Top %d，分歧函数 %d 个)\n\n", len(r.Functions), r.DivergentFunctions))
+		writeMarkdownTable(&b, matrixHeader, matrixRows)
+	} else {
+		b.WriteString(fmt.Sprintf("多 Profile 差异矩阵 (%s, baseline + %d 个 candidate)\n", r.ProfileType, len(r.Candidates)))
+		b.WriteString("==============================\n\n")
+		b.WriteString(fmt.Sprintf("样本类型: %s/%s\n", r.ValueType, r.ValueUnit))
+		b.WriteString(fmt.Sprintf("聚合方式: %s\n", r.Aggregation))
+		b.WriteString(fmt.Sprintf("Baseline (%s) 总值: %s\n", sanitizeName(r.BaselineLabel), formatUnitValue(r.BaselineTotal, r.ValueUnit)))
+		b.WriteString(fmt.Sprintf("回归阈值: %.2f%%\n\n", r.ThresholdPercent))
+		writeTabTable(&b, summaryHeader, summaryRows)
+		b.WriteString(fmt.Sprintf("\n函数矩阵 (Top %d，分歧函数 %d 个，▲ 表示超过回归阈值):\n", len(r.Functions), r.DivergentFunctions))
+		writeTabTable(&b, matrixHeader, matrixRows)
+	}
+
+	b.WriteString(fmt.Sprintf("\n结论: 相对 baseline 总值增长最少的 candidate 是 %s；%d 个函数只在部分 candidate 中回归。\n",
+		sanitizeName(r.BestCandidate), r.DivergentFunctions))
+	return b.String()
+}
+
+// writeMarkdownTable 写入一个 markdown 表格
+func writeMarkdownTable(b *strings.Builder, header []string, rows [][]string) {
+	b.WriteString("| " + strings.Join(header, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat("------|", len(header)) + "\n")
+	for _, row := range rows {
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+}
+
+// writeTabTable 用 tabwriter 写入一个按列对齐的文本表格
+func writeTabTable(b *strings.Builder, header []string, rows [][]string) {
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
@@ -0,0 +1,88 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestCompareProfilesMulti 测试 baseline 与两个 candidate 的矩阵比较以及分歧函数的标记
+func TestCompareProfilesMulti(t *testing.T) {
+	profiles := []*profile.Profile{
+		newCPUProfile(map[string]int64{"main.work": 100000000, "main.parse": 100000000, "main.io": 100000000}),
+		// c1: main.work 回归，main.parse 不变
+		newCPUProfile(map[string]int64{"main.work": 200000000, "main.parse": 100000000, "main.io": 110000000}),
+		// c2: main.parse 回归，总值增长更少
+		newCPUProfile(map[string]int64{"main.work": 100000000, "main.parse": 130000000, "main.io": 110000000}),
+	}
+	labels := []string{"base", "c1", "c2"}
+
+	jsonResult, err := CompareProfilesMulti(profiles, labels, "cpu", CompareOptions{Format: "json"})
+	if err != nil {
+		t.Fatalf("CompareProfilesMulti() error = %v", err)
+	}
+	var result MultiDiffResult
+	if err := json.Unmarshal([]byte(jsonResult), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.BaselineTotal != 300000000 || len(result.Candidates) != 2 || result.BestCandidate != "c2" {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if result.ThresholdPercent != defaultMultiRegressionThresholdPercent || result.DivergentFunctions != 2 {
+		t.Errorf("ThresholdPercent = %v, DivergentFunctions = %d, want %v and 2", result.ThresholdPercent, result.DivergentFunctions, defaultMultiRegressionThresholdPercent)
+	}
+
+	rows := make(map[string]MultiDiffRow)
+	for _, row := range result.Functions {
+		rows[row.FunctionName] = row
+		if len(row.Cells) != 3 || row.Cells[0].Label != "base" || row.Cells[2].Label != "c2" {
+			t.Errorf("Unexpected cells for %s: %+v", row.FunctionName, row.Cells)
+		}
+	}
+	work := rows["main.work"]
+	if !work.Divergent || !work.Cells[1].Regressed || work.Cells[2].Regressed || work.Cells[1].Diff != 100000000 {
+		t.Errorf("Unexpected main.work row: %+v", work)
+	}
+	parse := rows["main.parse"]
+	if !parse.Divergent || parse.Cells[1].Regressed || !parse.Cells[2].Regressed {
+		t.Errorf("Unexpected main.parse row: %+v", parse)
+	}
+	// 两个 candidate 都增长了 10%，不是分歧函数
+	io := rows["main.io"]
+	if io.Divergent || !io.Cells[1].Regressed || !io.Cells[2].Regressed {
+		t.Errorf("Unexpected main.io row: %+v", io)
+	}
+	if result.Functions[len(result.Functions)-1].FunctionName != "main.io" {
+		t.Errorf("Divergent functions should be listed first, got %+v", result.Functions)
+	}
+
+	text, err := CompareProfilesMulti(profiles, labels, "cpu", CompareOptions{Format: "text"})
+	if err != nil {
+		t.Fatalf("CompareProfilesMulti(text) error = %v", err)
+	}
+	for _, want := range []string{"base (baseline)", "仅 c1", "仅 c2", "全部", "增长最少的 candidate 是 c2"} {
+		if !containsString(text, want) {
+			t.Errorf("Text output should contain %q, got:\n%s", want, text)
+		}
+	}
+
+	// 阈值高于 10% 时 main.io 不再被判定为回归
+	jsonResult, err = CompareProfilesMulti(profiles, labels, "cpu", CompareOptions{Format: "json", RegressionThresholdPercent: 20})
+	if err != nil {
+		t.Fatalf("CompareProfilesMulti(threshold) error = %v", err)
+	}
+	if err := json.Unmarshal([]byte(jsonResult), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.Candidates[0].RegressedFunctions != 1 || result.Candidates[1].RegressedFunctions != 1 {
+		t.Errorf("Unexpected regressed counts with 20%% threshold: %+v", result.Candidates)
+	}
+
+	if _, err := CompareProfilesMulti(profiles[:1], labels[:1], "cpu", CompareOptions{Format: "text"}); err == nil {
+		t.Error("Expected error with only a baseline profile")
+	}
+	if _, err := CompareProfilesMulti(profiles, labels[:2], "cpu", CompareOptions{Format: "text"}); err == nil {
+		t.Error("Expected error when label count does not match profile count")
+	}
+}
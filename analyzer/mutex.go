@@ -1,25 +1,50 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 
 	"github.com/google/pprof/profile"
 )
 
+// Mutex 与 Block 报告的主要指标，决定排序、表格中优先展示的列和标题中突出的总值
+const (
+	PrimaryMetricDelay       = "delay"       // 总延迟 (默认)
+	PrimaryMetricContentions = "contentions" // 竞争/阻塞次数
+)
+
+// SortByAvgDelay 按平均每次竞争/阻塞的延迟排序 (ContentionAnalysisOptions.SortBy)，用于找出单次等待最长的锁或通道
+const SortByAvgDelay = "avg_delay"
+
+// ContentionSortKeys 是 ContentionAnalysisOptions.SortBy 的可选值
+var ContentionSortKeys = []string{PrimaryMetricDelay, PrimaryMetricContentions, SortByAvgDelay}
+
+// ContentionAnalysisOptions 定义 Mutex 与 Block 分析的可选参数
+type ContentionAnalysisOptions struct {
+	PrimaryMetric string // 主要指标 (PrimaryMetricDelay 或 PrimaryMetricContentions)，为空时使用 delay
+	// MinPercent 大于 0 时丢弃主要指标占总量百分比低于该值的函数，并在结果中报告被过滤的函数数量和累计值
+	MinPercent float64
+	// SortBy 是排序方式 (见 ContentionSortKeys)，为空时按 PrimaryMetric 排序；只改变顺序，不改变表格中优先展示的列
+	SortBy string
+	// Numbers 是报告中数值的格式 (见 NumberStyles)，零值为 NumberStyleHuman
+	Numbers NumberFormatter
+}
+
 // MutexContentionStat 代表 Mutex 竞争的统计信息
 type MutexContentionStat struct {
-	FunctionName     string  `json:"functionName"`
-	Contentions      int64   `json:"contentions"`       // 竞争次数
-	DelayNanos       int64   `json:"delayNanos"`        // 总延迟时间（纳秒）
-	DelayFormatted   string  `json:"delayFormatted"`    // 格式化后的延迟时间
-	ContentionsPct   float64 `json:"contentionsPct"`    // 竞争次数占比
-	DelayPct         float64 `json:"delayPct"`          // 延迟时间占比
-	AvgDelayNanos    int64   `json:"avgDelayNanos"`     // 平均每次竞争的延迟（纳秒）
-	AvgDelayFormatted string `json:"avgDelayFormatted"` // 格式化后的平均延迟
+	FunctionName      string  `json:"functionName"`
+	FunctionID        string  `json:"functionId"`        // 完整函数名的稳定哈希，用于跨报告关联
+	Contentions       int64   `json:"contentions"`       // 竞争次数
+	DelayNanos        int64   `json:"delayNanos"`        // 总延迟时间（纳秒）
+	DelayFormatted    string  `json:"delayFormatted"`    // 格式化后的延迟时间
+	ContentionsPct    float64 `json:"contentionsPct"`    // 竞争次数占比
+	DelayPct          float64 `json:"delayPct"`          // 延迟时间占比
+	SumPct            float64 `json:"sumPct"`            // 按列表顺序累加到该函数为止的主要指标占总量的百分比
+	AvgDelayNanos     int64   `json:"avgDelayNanos"`     // 平均每次竞争的延迟（纳秒）
+	AvgDelayFormatted string  `json:"avgDelayFormatted"` // 格式化后的平均延迟
 }
 
 // MutexAnalysisResult 代表 Mutex 分析的整体结果 (JSON)
@@ -28,13 +53,71 @@ type MutexAnalysisResult struct {
 	TotalContentions    int64                 `json:"totalContentions"`
 	TotalDelayNanos     int64                 `json:"totalDelayNanos"`
 	TotalDelayFormatted string                `json:"totalDelayFormatted"`
+	PrimaryMetric       string                `json:"primaryMetric"`    // 排序和展示使用的主要指标 (delay 或 contentions)
+	SortBy              string                `json:"sortBy,omitempty"` // 显式指定的排序方式 (见 ContentionSortKeys)，为空时按主要指标排序
 	TopN                int                   `json:"topN"`
 	Contentions         []MutexContentionStat `json:"contentions"`
+	CaptureConfig       *CaptureConfig        `json:"captureConfig,omitempty"`  // 从 profile 推断的采集配置 (如 mutex fraction)
+	NoiseFilter         *NoiseFilterSummary   `json:"noiseFilter,omitempty"`    // 按 MinPercent 过滤掉的长尾函数 (设置了 MinPercent 时)
+	SkippedSamples      *SkippedSamples       `json:"skippedSamples,omitempty"` // 没有调用栈或缺少样本值而被跳过的样本 (有样本被跳过时)
+	numbers             NumberFormatter       // 生成格式化字段时使用的数值格式，Format 函数沿用同一格式
 }
 
-// AnalyzeMutexProfile 分析 Mutex profile 文件并返回格式化结果。
+// AnalyzeMutexProfile 分析 Mutex profile 文件并返回格式化结果，按总延迟排序。
 func AnalyzeMutexProfile(p *profile.Profile, topN int, format string) (string, error) {
-	log.Printf("Analyzing Mutex profile (Top %d, Format: %s)", topN, format)
+	return AnalyzeMutexProfileByMetric(p, topN, format, PrimaryMetricDelay)
+}
+
+// AnalyzeMutexProfileByMetric 与 AnalyzeMutexProfile 相同，但使用 primaryMetric (delay 或 contentions) 作为主要指标：
+// 按该指标排序，并在标题总值和表格中优先展示它。关心锁被竞争的频率而不是总等待时间时使用 contentions。
+func AnalyzeMutexProfileByMetric(p *profile.Profile, topN int, format string, primaryMetric string) (string, error) {
+	return AnalyzeMutexProfileWithOptions(p, topN, format, ContentionAnalysisOptions{PrimaryMetric: primaryMetric})
+}
+
+// AnalyzeMutexProfileWithOptions 与 AnalyzeMutexProfileByMetric 相同，但支持 ContentionAnalysisOptions，
+// 例如按 MinPercent 过滤长尾函数。
+func AnalyzeMutexProfileWithOptions(p *profile.Profile, topN int, format string, opts ContentionAnalysisOptions) (string, error) {
+	return AnalyzeMutexProfileContext(context.Background(), p, topN, format, opts)
+}
+
+// AnalyzeMutexProfileContext 与 AnalyzeMutexProfileWithOptions 相同，但在聚合样本时定期检查 ctx，ctx 被取消时尽快停止
+func AnalyzeMutexProfileContext(ctx context.Context, p *profile.Profile, topN int, format string, opts ContentionAnalysisOptions) (string, error) {
+	result, err := MutexProfileStatsContext(ctx, p, topN, opts)
+	if err != nil {
+		return "", err
+	}
+	return FormatMutexResult(result, format)
+}
+
+// MutexProfileStats 按函数聚合 Mutex profile 的竞争次数和延迟，返回按 primaryMetric 排序的结构化结果，
+// 供需要直接使用数值的调用方使用。Contentions 包含所有函数，topN 只决定格式化时展示的行数。
+func MutexProfileStats(p *profile.Profile, topN int, primaryMetric string) (*MutexAnalysisResult, error) {
+	return MutexProfileStatsWithOptions(p, topN, ContentionAnalysisOptions{PrimaryMetric: primaryMetric})
+}
+
+// MutexProfileStatsWithOptions 与 MutexProfileStats 相同，但支持 ContentionAnalysisOptions。
+func MutexProfileStatsWithOptions(p *profile.Profile, topN int, opts ContentionAnalysisOptions) (*MutexAnalysisResult, error) {
+	return MutexProfileStatsContext(context.Background(), p, topN, opts)
+}
+
+// MutexProfileStatsContext 与 MutexProfileStatsWithOptions 相同，但在聚合样本时定期检查 ctx，ctx 被取消时返回包装了 ctx.Err() 的错误
+func MutexProfileStatsContext(ctx context.Context, p *profile.Profile, topN int, opts ContentionAnalysisOptions) (*MutexAnalysisResult, error) {
+	primaryMetric := opts.PrimaryMetric
+	if primaryMetric == "" {
+		primaryMetric = PrimaryMetricDelay
+	}
+	if primaryMetric != PrimaryMetricDelay && primaryMetric != PrimaryMetricContentions {
+		return nil, fmt.Errorf("unsupported primary metric: %s (expected delay or contentions)", primaryMetric)
+	}
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = primaryMetric
+	}
+	if sortBy != PrimaryMetricDelay && sortBy != PrimaryMetricContentions && sortBy != SortByAvgDelay {
+		return nil, fmt.Errorf("unsupported sort_by: %s (expected %s)", sortBy, strings.Join(ContentionSortKeys, ", "))
+	}
+	byContentions := primaryMetric == PrimaryMetricContentions
+	logDebug("Analyzing Mutex profile (Top %d, Primary metric: %s)", topN, primaryMetric)
 
 	// --- 1. 确定用于分析的值的索引 ---
 	// Mutex profile 有两个样本类型：
@@ -53,17 +136,20 @@ func AnalyzeMutexProfile(p *profile.Profile, topN int, format string) (string, e
 	}
 
 	if contentionIndex == -1 || delayIndex == -1 {
-		return "", fmt.Errorf("无法从 profile 中找到必需的样本类型 (contentions, delay)")
+		return nil, fmt.Errorf("无法从 profile 中找到必需的样本类型 (contentions, delay)")
 	}
 
-	log.Printf("使用索引 %d (contentions) 和 %d (delay) 进行 Mutex 分析", contentionIndex, delayIndex)
+	logDebug("使用索引 %d (contentions) 和 %d (delay) 进行 Mutex 分析", contentionIndex, delayIndex)
 
 	// --- 2. 按函数聚合竞争统计 ---
 	contentionData := make(map[string]*MutexContentionStat)
 	totalContentions := int64(0)
 	totalDelay := int64(0)
 
-	for _, s := range p.Sample {
+	for i, s := range p.Sample {
+		if err := checkCanceled(ctx, i); err != nil {
+			return nil, err
+		}
 		if len(s.Location) == 0 || len(s.Value) <= max(contentionIndex, delayIndex) {
 			continue
 		}
@@ -72,18 +158,7 @@ func AnalyzeMutexProfile(p *profile.Profile, topN int, format string) (string, e
 		delay := s.Value[delayIndex]
 
 		// 获取最顶层函数名
-		loc := s.Location[0]
-		functionName := ""
-		for _, line := range loc.Line {
-			if line.Function != nil {
-				functionName = line.Function.Name
-				break
-			}
-		}
-
-		if functionName == "" {
-			functionName = "unknown"
-		}
+		functionName := topFunctionName(s)
 
 		// 聚合统计数据
 		if stat, exists := contentionData[functionName]; exists {
@@ -91,10 +166,10 @@ func AnalyzeMutexProfile(p *profile.Profile, topN int, format string) (string, e
 			stat.DelayNanos += delay
 		} else {
 			contentionData[functionName] = &MutexContentionStat{
-				FunctionName:  functionName,
-				Contentions:   contentions,
-				DelayNanos:    delay,
-				AvgDelayNanos: delay / contentions, // 计算平均延迟
+				FunctionName: functionName,
+				FunctionID:   FunctionID(functionName),
+				Contentions:  contentions,
+				DelayNanos:   delay,
 			}
 		}
 
@@ -102,41 +177,81 @@ func AnalyzeMutexProfile(p *profile.Profile, topN int, format string) (string, e
 		totalDelay += delay
 	}
 
-	if totalContentions == 0 {
-		return "Mutex profile 分析完成：未发现锁竞争。", nil
+	result := &MutexAnalysisResult{
+		ProfileType:         "mutex",
+		TotalContentions:    totalContentions,
+		TotalDelayNanos:     totalDelay,
+		TotalDelayFormatted: opts.Numbers.Nanos(totalDelay),
+		PrimaryMetric:       primaryMetric,
+		SortBy:              opts.SortBy,
+		TopN:                topN,
+		Contentions:         []MutexContentionStat{},
+		CaptureConfig:       ParseCaptureConfig(p),
+		SkippedSamples:      countSkippedSamples(p, contentionIndex, delayIndex),
+		numbers:             opts.Numbers,
+	}
+	if totalContentions == 0 && totalDelay == 0 {
+		return result, nil
 	}
 
-	// --- 3. 按延迟时间排序（优先显示延迟最长的函数）---
+	// --- 3. 按 sortBy 排序（默认按主要指标，即延迟时间，优先显示延迟最长的函数）---
 	stats := make([]*MutexContentionStat, 0, len(contentionData))
 	for _, stat := range contentionData {
 		// 计算百分比
-		stat.ContentionsPct = float64(stat.Contentions) / float64(totalContentions) * 100
-		stat.DelayPct = float64(stat.DelayNanos) / float64(totalDelay) * 100
+		stat.ContentionsPct = percentOf(stat.Contentions, totalContentions)
+		stat.DelayPct = percentOf(stat.DelayNanos, totalDelay)
+		// 平均延迟在所有样本聚合完成后计算，同一函数出现在多个样本中时才正确
+		stat.AvgDelayNanos = avgDelayNanos(stat.DelayNanos, stat.Contentions)
 		// 格式化时间
-		stat.DelayFormatted = formatNanos(stat.DelayNanos)
-		stat.AvgDelayFormatted = formatNanos(stat.AvgDelayNanos)
+		stat.DelayFormatted = opts.Numbers.Nanos(stat.DelayNanos)
+		stat.AvgDelayFormatted = opts.Numbers.Nanos(stat.AvgDelayNanos)
 		stats = append(stats, stat)
 	}
 
-	sort.Slice(stats, func(i, j int) bool {
-		return stats[i].DelayNanos > stats[j].DelayNanos // 按延迟降序
+	sortContentions(stats, sortBy, func(s *MutexContentionStat) (int64, int64, int64) {
+		return s.Contentions, s.DelayNanos, s.AvgDelayNanos
 	})
 
+	stats, result.NoiseFilter = dropContentionNoise(stats, func(s *MutexContentionStat) (int64, int64) { return s.Contentions, s.DelayNanos },
+		byContentions, totalContentions, totalDelay, opts.MinPercent, opts.Numbers)
+
+	// 将指针切片转换为值切片，并按排序后的顺序累加主要指标得到累计占比
+	result.Contentions = make([]MutexContentionStat, len(stats))
+	running := int64(0)
+	for i, stat := range stats {
+		if byContentions {
+			running += stat.Contentions
+			stat.SumPct = percentOf(running, totalContentions)
+		} else {
+			running += stat.DelayNanos
+			stat.SumPct = percentOf(running, totalDelay)
+		}
+		result.Contentions[i] = *stat
+	}
+	return result, nil
+}
+
+// FormatMutexResult 将 MutexProfileStats 的结果格式化为 text、markdown、json、compact 或 summary 输出，
+// 表格只展示前 result.TopN 个函数。
+func FormatMutexResult(result *MutexAnalysisResult, format string) (string, error) {
+	totalContentions := result.TotalContentions
+	totalDelay := result.TotalDelayNanos
+	numbers := result.numbers
+	if format == "summary" {
+		return formatSummary(mutexSummary(result)), nil
+	}
+	if totalContentions == 0 && totalDelay == 0 {
+		return "Mutex profile 分析完成：未发现锁竞争。\n\n" +
+			"提示：mutex profiling 默认是关闭的，profile 为空最常见的原因是程序没有开启它。\n" +
+			"请在程序启动时调用 runtime.SetMutexProfileFraction(5) (平均每 5 次竞争事件采样 1 次，设为 1 则记录全部)，" +
+			"然后重新采集 /debug/pprof/mutex。如果已经开启，则说明采集期间确实没有发生锁竞争。" + formatContentionSkippedSamples(result.SkippedSamples, "\n\n"), nil
+	}
+	byContentions := result.PrimaryMetric == PrimaryMetricContentions
+	stats := result.Contentions
+	capture := result.CaptureConfig
+
 	// --- 4. 格式化输出 ---
 	if format == "json" {
-		// 将指针切片转换为值切片
-		contentions := make([]MutexContentionStat, len(stats))
-		for i, stat := range stats {
-			contentions[i] = *stat
-		}
-		result := MutexAnalysisResult{
-			ProfileType:         "mutex",
-			TotalContentions:    totalContentions,
-			TotalDelayNanos:     totalDelay,
-			TotalDelayFormatted: formatNanos(totalDelay),
-			TopN:                topN,
-			Contentions:         contentions,
-		}
 		jsonBytes, err := json.MarshalIndent(result, "", "  ")
 		if err != nil {
 			return "", fmt.Errorf("failed to marshal JSON: %w", err)
@@ -144,59 +259,127 @@ func AnalyzeMutexProfile(p *profile.Profile, topN int, format string) (string, e
 		return string(jsonBytes), nil
 	}
 
+	limit := result.TopN
+	if limit > len(stats) {
+		limit = len(stats)
+	}
+
+	if format == "compact" {
+		rows := make([]compactRow, 0, limit)
+		for i := 0; i < limit; i++ {
+			if byContentions {
+				rows = append(rows, compactRow{Name: stats[i].FunctionName, Value: numbers.Number(stats[i].Contentions), Percent: stats[i].ContentionsPct})
+			} else {
+				rows = append(rows, compactRow{Name: stats[i].FunctionName, Value: stats[i].DelayFormatted, Percent: stats[i].DelayPct})
+			}
+		}
+		if byContentions {
+			return formatCompact(fmt.Sprintf("mutex contentions=%d delay=%s top=%d", totalContentions, numbers.Nanos(totalDelay), limit)+capture.compactSuffix()+result.NoiseFilter.compactSuffix()+result.SkippedSamples.compactSuffix(), rows), nil
+		}
+		return formatCompact(fmt.Sprintf("mutex delay=%s contentions=%d top=%d", numbers.Nanos(totalDelay), totalContentions, limit)+capture.compactSuffix()+result.NoiseFilter.compactSuffix()+result.SkippedSamples.compactSuffix(), rows), nil
+	}
+
 	// Text/Markdown 输出
 	var b strings.Builder
 
 	if format == "markdown" {
 		b.WriteString("# Mutex Profile 分析报告\n\n")
-		b.WriteString(fmt.Sprintf("**总竞争次数**: %s\n", formatNumber(totalContentions)))
-		b.WriteString(fmt.Sprintf("**总延迟时间**: %s\n\n", formatNanos(totalDelay)))
-		b.WriteString("## Top Mutex 竞争点\n\n")
-		b.WriteString("| 排名 | 函数名 | 竞争次数 | 竞争占比 | 总延迟 | 延迟占比 | 平均延迟 |\n")
-		b.WriteString("|------|--------|----------|----------|--------|----------|----------|\n")
+		b.WriteString(fmt.Sprintf("**总竞争次数**: %s\n", numbers.Number(totalContentions)))
+		if byContentions {
+			b.WriteString(fmt.Sprintf("**平均每次竞争延迟**: %s\n", numbers.Nanos(totalDelay/totalContentions)))
+		}
+		b.WriteString(fmt.Sprintf("**总延迟时间**: %s\n", numbers.Nanos(totalDelay)))
+		if capture != nil {
+			b.WriteString(fmt.Sprintf("**采集配置**: %s\n", capture))
+		}
+		b.WriteString("\n")
+		if byContentions {
+			b.WriteString("## Top Mutex 竞争点" + contentionSortTitle(result.SortBy, result.PrimaryMetric, "竞争次数") + "\n\n")
+			b.WriteString("| 排名 | 函数名 | 竞争次数 | 竞争占比 | 累计占比 | 平均延迟 | 总延迟 | 延迟占比 |\n")
+			b.WriteString("|------|--------|----------|----------|----------|----------|--------|----------|\n")
+		} else {
+			b.WriteString("## Top Mutex 竞争点" + contentionSortTitle(result.SortBy, result.PrimaryMetric, "竞争次数") + "\n\n")
+			b.WriteString("| 排名 | 函数名 | 竞争次数 | 竞争占比 | 总延迟 | 延迟占比 | 累计占比 | 平均延迟 |\n")
+			b.WriteString("|------|--------|----------|----------|--------|----------|----------|----------|\n")
+		}
 	} else {
 		b.WriteString("Mutex Profile 分析结果\n")
 		b.WriteString("========================\n\n")
-		b.WriteString(fmt.Sprintf("总竞争次数: %s\n", formatNumber(totalContentions)))
-		b.WriteString(fmt.Sprintf("总延迟时间: %s\n\n", formatNanos(totalDelay)))
-		b.WriteString("Top Mutex 竞争点:\n")
-		b.WriteString(strings.Repeat("-", 120) + "\n")
-		b.WriteString(fmt.Sprintf("%-6s %-50s %12s %10s %12s %10s %12s\n",
-			"排名", "函数名", "竞争次数", "竞争占比", "总延迟", "延迟占比", "平均延迟"))
+		b.WriteString(fmt.Sprintf("总竞争次数: %s\n", numbers.Number(totalContentions)))
+		if byContentions {
+			b.WriteString(fmt.Sprintf("平均每次竞争延迟: %s\n", numbers.Nanos(totalDelay/totalContentions)))
+		}
+		b.WriteString(fmt.Sprintf("总延迟时间: %s\n", numbers.Nanos(totalDelay)))
+		if capture != nil {
+			b.WriteString(fmt.Sprintf("采集配置: %s\n", capture))
+		}
+		b.WriteString("\n")
+		if byContentions {
+			b.WriteString("Top Mutex 竞争点" + contentionSortTitle(result.SortBy, result.PrimaryMetric, "竞争次数") + ":\n")
+			b.WriteString(strings.Repeat("-", 120) + "\n")
+			b.WriteString(fmt.Sprintf("%-6s %-50s %12s %10s %10s %12s %12s %10s\n",
+				"排名", "函数名", "竞争次数", "竞争占比", "累计占比", "平均延迟", "总延迟", "延迟占比"))
+		} else {
+			b.WriteString("Top Mutex 竞争点" + contentionSortTitle(result.SortBy, result.PrimaryMetric, "竞争次数") + ":\n")
+			b.WriteString(strings.Repeat("-", 120) + "\n")
+			b.WriteString(fmt.Sprintf("%-6s %-50s %12s %10s %12s %10s %10s %12s\n",
+				"排名", "函数名", "竞争次数", "竞争占比", "总延迟", "延迟占比", "累计占比", "平均延迟"))
+		}
 		b.WriteString(strings.Repeat("-", 120) + "\n")
 	}
 
-	limit := topN
-	if limit > len(stats) {
-		limit = len(stats)
-	}
-
 	for i := 0; i < limit; i++ {
-		stat := stats[i]
-		if format == "markdown" {
-			b.WriteString(fmt.Sprintf("| %d | `%s` | %s | %.2f%% | %s | %.2f%% | %s |\n",
+		stat := &stats[i]
+		if byContentions {
+			rowFormat := "%-6d %-50s %12s %9.2f%% %9.2f%% %12s %12s %9.2f%%\n"
+			nameWidth := 50
+			if format == "markdown" {
+				rowFormat = "| %d | `%s` | %s | %.2f%% | %.2f%% | %s | %s | %.2f%% |\n"
+				nameWidth = 40
+			}
+			b.WriteString(fmt.Sprintf(rowFormat,
+				i+1,
+				truncateString(stat.FunctionName, nameWidth),
+				numbers.Number(stat.Contentions),
+				stat.ContentionsPct,
+				stat.SumPct,
+				stat.AvgDelayFormatted,
+				stat.DelayFormatted,
+				stat.DelayPct,
+			))
+		} else if format == "markdown" {
+			b.WriteString(fmt.Sprintf("| %d | `%s` | %s | %.2f%% | %s | %.2f%% | %.2f%% | %s |\n",
 				i+1,
 				truncateString(stat.FunctionName, 40),
-				formatNumber(stat.Contentions),
+				numbers.Number(stat.Contentions),
 				stat.ContentionsPct,
 				stat.DelayFormatted,
 				stat.DelayPct,
+				stat.SumPct,
 				stat.AvgDelayFormatted,
 			))
 		} else {
-			b.WriteString(fmt.Sprintf("%-6d %-50s %12s %9.2f%% %12s %9.2f%% %12s\n",
+			b.WriteString(fmt.Sprintf("%-6d %-50s %12s %9.2f%% %12s %9.2f%% %9.2f%% %12s\n",
 				i+1,
 				truncateString(stat.FunctionName, 50),
-				formatNumber(stat.Contentions),
+				numbers.Number(stat.Contentions),
 				stat.ContentionsPct,
 				stat.DelayFormatted,
 				stat.DelayPct,
+				stat.SumPct,
 				stat.AvgDelayFormatted,
 			))
 		}
 	}
+	if result.NoiseFilter != nil {
+		b.WriteString(fmt.Sprintf("\n%s\n", formatContentionNoiseFilter(result.NoiseFilter)))
+	}
+	b.WriteString(formatContentionSkippedSamples(result.SkippedSamples, "\n"))
 
 	b.WriteString("\n**分析建议**:\n")
+	if byContentions {
+		b.WriteString("- 关注竞争次数最多的函数，即使每次等待很短，频繁竞争也会带来调度开销并限制并发度\n")
+	}
 	b.WriteString("- 关注总延迟时间最长的函数，这些是性能瓶颈的根源\n")
 	b.WriteString("- 高竞争次数但低延迟可能表明锁粒度过小，频繁获取/释放\n")
 	b.WriteString("- 考虑使用细粒度锁、读写锁 (sync.RWMutex) 或无锁数据结构来减少竞争\n")
@@ -208,24 +391,77 @@ func AnalyzeMutexProfile(p *profile.Profile, topN int, format string) (string, e
 	return b.String(), nil
 }
 
-// formatNanos 将纳秒数格式化为可读的时间字符串
-func formatNanos(nanos int64) string {
-	if nanos < 1000 {
-		return fmt.Sprintf("%d ns", nanos)
+// sortContentions 按 sortBy (delay、contentions 或 avg_delay) 对 Mutex/Block 统计降序排序，取值相同时按总延迟降序；
+// values 返回每项的竞争次数、总延迟和平均延迟
+func sortContentions[T any](stats []T, sortBy string, values func(T) (int64, int64, int64)) {
+	sort.Slice(stats, func(i, j int) bool {
+		ci, di, ai := values(stats[i])
+		cj, dj, aj := values(stats[j])
+		switch {
+		case sortBy == PrimaryMetricContentions && ci != cj:
+			return ci > cj
+		case sortBy == SortByAvgDelay && ai != aj:
+			return ai > aj
+		}
+		return di > dj
+	})
+}
+
+// contentionSortTitle 返回 Mutex/Block 表格标题中的排序说明，countLabel 是次数的名称 (竞争次数或阻塞次数)。
+// 按主要指标默认排序时，delay 不加说明，contentions 为 "(按<countLabel>排序)"
+func contentionSortTitle(sortBy, primaryMetric, countLabel string) string {
+	if sortBy == "" {
+		sortBy = primaryMetric
+	}
+	switch {
+	case sortBy == PrimaryMetricContentions:
+		return fmt.Sprintf(" (按%s排序)", countLabel)
+	case sortBy == SortByAvgDelay:
+		return " (按平均延迟排序)"
+	case primaryMetric == PrimaryMetricContentions:
+		return " (按总延迟排序)"
+	}
+	return ""
+}
+
+// dropContentionNoise 按主要指标 (contentions 或 delay) 的占比过滤 Mutex/Block 统计中的长尾函数，
+// values 返回每项的竞争次数和延迟，numbers 用于格式化被过滤的累计值
+func dropContentionNoise[T any](stats []T, values func(T) (int64, int64), byContentions bool, totalContentions, totalDelay int64, minPercent float64, numbers NumberFormatter) ([]T, *NoiseFilterSummary) {
+	if byContentions {
+		return dropBelowPercent(stats, func(s T) int64 { c, _ := values(s); return c }, totalContentions, minPercent, numbers.Number)
 	}
-	micros := nanos / 1000
-	if micros < 1000 {
-		return fmt.Sprintf("%.2f μs", float64(nanos)/1000)
+	return dropBelowPercent(stats, func(s T) int64 { _, d := values(s); return d }, totalDelay, minPercent, numbers.Nanos)
+}
+
+// formatContentionNoiseFilter 返回 Mutex/Block 文本报告中的过滤摘要行
+func formatContentionNoiseFilter(s *NoiseFilterSummary) string {
+	return fmt.Sprintf("已过滤占比低于 %.2f%% 的 %d 个函数 (合计 %s，占总量 %.2f%%)",
+		s.MinPercent, s.FilteredFunctions, s.FilteredValueFormatted, s.FilteredPercentage)
+}
+
+// formatContentionSkippedSamples 返回 Mutex/Block 文本报告中以 prefix 开头、以换行结尾的跳过样本摘要行，没有样本被跳过时为空
+func formatContentionSkippedSamples(s *SkippedSamples, prefix string) string {
+	if s == nil {
+		return ""
 	}
-	millis := micros / 1000
-	if millis < 1000 {
-		return fmt.Sprintf("%.2f ms", float64(micros)/1000)
+	line := fmt.Sprintf("%s已跳过 %d/%d 个样本 (%.2f%%)：%d 个没有调用栈，%d 个缺少 contentions/delay 值", prefix,
+		s.Count, s.TotalSamples, s.Percentage, s.NoLocation, s.MissingValue)
+	if s.likelyWrongType() {
+		line += "。跳过的比例较高，通常说明 profile_type 与文件内容不一致"
 	}
-	seconds := millis / 1000
-	if seconds < 60 {
-		return fmt.Sprintf("%.2f s", float64(millis)/1000)
+	return line + "\n"
+}
+
+// formatNanos 将纳秒数格式化为可读的时间字符串 (NumberStyleHuman)
+func formatNanos(nanos int64) string {
+	return NumberFormatter{}.Nanos(nanos)
+}
+
+// avgDelayNanos 返回平均每次竞争/阻塞的延迟。部分插桩生成的 profile 只记录延迟而次数为 0，
+// 此时把整个延迟视为一次事件，避免除以零。
+func avgDelayNanos(delay, count int64) int64 {
+	if count <= 0 {
+		return delay
 	}
-	minutes := seconds / 60
-	secondsRemainder := seconds % 60
-	return fmt.Sprintf("%d m %d s", minutes, secondsRemainder)
+	return delay / count
 }
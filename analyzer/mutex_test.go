@@ -1,6 +1,7 @@
 package analyzer
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/google/pprof/profile"
@@ -144,6 +145,11 @@ func TestAnalyzeMutexProfileEmpty(t *testing.T) {
 	if !containsString(result, "未发现锁竞争") {
 		t.Errorf("Empty profile should return friendly message, got: %s", result)
 	}
+
+	// 应该提示如何开启 mutex profiling
+	if !containsString(result, "runtime.SetMutexProfileFraction") {
+		t.Errorf("Empty profile should explain how to enable mutex profiling, got: %s", result)
+	}
 }
 
 // TestAnalyzeMutexProfileInvalidSampleTypes 测试缺少样本类型的情况
@@ -169,6 +175,226 @@ func TestAnalyzeMutexProfileInvalidSampleTypes(t *testing.T) {
 	}
 }
 
+// TestAnalyzeMutexProfilePrimaryMetric 测试 primary_metric 决定排序、列顺序和标题总值
+func TestAnalyzeMutexProfilePrimaryMetric(t *testing.T) {
+	newSample := func(name string, contentions, delay int64) *profile.Sample {
+		return &profile.Sample{
+			Value:    []int64{contentions, delay},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+		}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "contentions", Unit: "count"},
+			{Type: "delay", Unit: "nanoseconds"},
+		},
+		Sample: []*profile.Sample{
+			newSample("main.frequent", 1000, 10000000), // 次数多但总延迟短
+			newSample("main.slow", 10, 500000000),      // 次数少但总延迟长
+		},
+	}
+
+	byDelay, err := AnalyzeMutexProfileByMetric(p, 1, "text", PrimaryMetricDelay)
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfileByMetric(delay) error = %v", err)
+	}
+	if !containsString(byDelay, "main.slow") || containsString(byDelay, "main.frequent") {
+		t.Errorf("delay metric should rank main.slow first, got:\n%s", byDelay)
+	}
+	if legacy, _ := AnalyzeMutexProfile(p, 1, "text"); legacy != byDelay {
+		t.Errorf("AnalyzeMutexProfile should default to the delay metric")
+	}
+
+	byCount, err := AnalyzeMutexProfileByMetric(p, 1, "markdown", PrimaryMetricContentions)
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfileByMetric(contentions) error = %v", err)
+	}
+	if !containsString(byCount, "main.frequent") || containsString(byCount, "main.slow") {
+		t.Errorf("contentions metric should rank main.frequent first, got:\n%s", byCount)
+	}
+	for _, want := range []string{"按竞争次数排序", "| 排名 | 函数名 | 竞争次数 | 竞争占比 | 累计占比 | 平均延迟 | 总延迟 | 延迟占比 |", "**平均每次竞争延迟**"} {
+		if !containsString(byCount, want) {
+			t.Errorf("contentions report should contain %q, got:\n%s", want, byCount)
+		}
+	}
+
+	compact, err := AnalyzeMutexProfileByMetric(p, 1, "compact", PrimaryMetricContentions)
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfileByMetric(compact) error = %v", err)
+	}
+	if !containsString(compact, "mutex contentions=1010 delay=") || !containsString(compact, "frequent 1.0K") {
+		t.Errorf("compact header should lead with the contention total, got:\n%s", compact)
+	}
+
+	jsonOut, err := AnalyzeMutexProfileByMetric(p, 5, "json", PrimaryMetricContentions)
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfileByMetric(json) error = %v", err)
+	}
+	if !containsString(jsonOut, `"primaryMetric": "contentions"`) {
+		t.Errorf("JSON should record the primary metric, got:\n%s", jsonOut)
+	}
+
+	if _, err := AnalyzeMutexProfileByMetric(p, 5, "text", "latency"); err == nil {
+		t.Error("Expected error for unsupported primary metric, got nil")
+	}
+}
+
+// TestAnalyzeMutexProfileSortBy 测试 SortBy 独立于 PrimaryMetric 决定 Top N 的顺序，并拒绝不支持的排序方式
+func TestAnalyzeMutexProfileSortBy(t *testing.T) {
+	newSample := func(name string, contentions, delay int64) *profile.Sample {
+		return &profile.Sample{
+			Value:    []int64{contentions, delay},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+		}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "contentions", Unit: "count"},
+			{Type: "delay", Unit: "nanoseconds"},
+		},
+		Sample: []*profile.Sample{
+			newSample("main.frequent", 1000, 100000000), // 次数最多，平均 100µs
+			newSample("main.slow", 100, 500000000),      // 总延迟最长，平均 5ms
+			newSample("main.rare", 2, 40000000),         // 平均延迟最长，20ms
+		},
+	}
+
+	for sortBy, want := range map[string]string{
+		"":                       "main.slow",
+		PrimaryMetricDelay:       "main.slow",
+		PrimaryMetricContentions: "main.frequent",
+		SortByAvgDelay:           "main.rare",
+	} {
+		result, err := MutexProfileStatsWithOptions(p, 3, ContentionAnalysisOptions{SortBy: sortBy})
+		if err != nil {
+			t.Fatalf("MutexProfileStatsWithOptions(%q) error = %v", sortBy, err)
+		}
+		if result.Contentions[0].FunctionName != want || result.SortBy != sortBy {
+			t.Errorf("sort_by=%q: first = %s, sortBy = %q, want %s", sortBy, result.Contentions[0].FunctionName, result.SortBy, want)
+		}
+	}
+
+	text, err := AnalyzeMutexProfileWithOptions(p, 3, "text", ContentionAnalysisOptions{SortBy: SortByAvgDelay})
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfileWithOptions(avg_delay) error = %v", err)
+	}
+	if !containsString(text, "按平均延迟排序") {
+		t.Errorf("avg_delay report should describe the sort order, got:\n%s", text)
+	}
+
+	// Block 使用相同的排序方式
+	block, err := BlockProfileStatsWithOptions(p, 3, ContentionAnalysisOptions{PrimaryMetric: PrimaryMetricContentions, SortBy: PrimaryMetricDelay})
+	if err != nil {
+		t.Fatalf("BlockProfileStatsWithOptions() error = %v", err)
+	}
+	if block.Blocks[0].FunctionName != "main.slow" {
+		t.Errorf("block sort_by=delay: first = %s, want main.slow", block.Blocks[0].FunctionName)
+	}
+
+	if _, err := MutexProfileStatsWithOptions(p, 3, ContentionAnalysisOptions{SortBy: "flat"}); err == nil || !containsString(err.Error(), "delay, contentions, avg_delay") {
+		t.Errorf("Expected an error listing the valid sort keys, got %v", err)
+	}
+}
+
+// TestAnalyzeMutexProfileZeroContentions 测试次数为 0 但记录了延迟的样本不会导致除以零，平均延迟按整个延迟计算
+func TestAnalyzeMutexProfileZeroContentions(t *testing.T) {
+	sample := func(name string, contentions, delay int64) *profile.Sample {
+		return &profile.Sample{
+			Value:    []int64{contentions, delay},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+		}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "contentions", Unit: "count"},
+			{Type: "delay", Unit: "nanoseconds"},
+		},
+		Sample: []*profile.Sample{
+			sample("main.instrumented", 0, 5000000), // 插桩 profile 只记录了 5ms 延迟，没有次数
+			sample("main.lock", 10, 1000000),
+		},
+	}
+
+	for _, format := range []string{"text", "markdown", "compact"} {
+		if _, err := AnalyzeMutexProfile(p, 5, format); err != nil {
+			t.Fatalf("AnalyzeMutexProfile(%s) error = %v", format, err)
+		}
+	}
+	result, err := AnalyzeMutexProfile(p, 5, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfile(json) error = %v", err)
+	}
+	var parsed MutexAnalysisResult
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	avg := map[string]int64{}
+	for _, c := range parsed.Contentions {
+		avg[c.FunctionName] = c.AvgDelayNanos
+	}
+	if avg["main.instrumented"] != 5000000 {
+		t.Errorf("avg delay of zero-count sample = %d, want 5000000 (the whole delay)", avg["main.instrumented"])
+	}
+	if avg["main.lock"] != 100000 {
+		t.Errorf("avg delay of main.lock = %d, want 100000", avg["main.lock"])
+	}
+
+	// 只有一个次数为 0 的样本时总次数为 0，但延迟不为 0，不能被当作空 profile
+	p.Sample = p.Sample[:1]
+	text, err := AnalyzeMutexProfile(p, 5, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfile(single zero-count sample) error = %v", err)
+	}
+	if containsString(text, "未发现锁竞争") || !containsString(text, "main.instrumented") {
+		t.Errorf("single zero-count sample reported as empty profile:\n%s", text)
+	}
+	result, err = AnalyzeMutexProfile(p, 5, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfile(single zero-count sample, json) error = %v", err)
+	}
+	parsed = MutexAnalysisResult{}
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(parsed.Contentions) != 1 || parsed.Contentions[0].DelayNanos != 5000000 || parsed.Contentions[0].AvgDelayNanos != 5000000 {
+		t.Errorf("single zero-count sample Contentions = %+v, want main.instrumented with 5ms delay", parsed.Contentions)
+	}
+}
+
+// TestAnalyzeMutexProfileAverageDelayAggregated 测试同一函数出现在多个样本中时，平均延迟按聚合后的总延迟和总次数计算
+func TestAnalyzeMutexProfileAverageDelayAggregated(t *testing.T) {
+	fn := &profile.Function{Name: "main.lock"}
+	sample := func(contentions, delay int64) *profile.Sample {
+		return &profile.Sample{
+			Value:    []int64{contentions, delay},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: fn}}}},
+		}
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "contentions", Unit: "count"},
+			{Type: "delay", Unit: "nanoseconds"},
+		},
+		// 两个不同调用栈的样本落在同一个函数：(10ms + 90ms) / (10 + 30) = 2.5ms，而不是第一个样本的 1ms
+		Sample: []*profile.Sample{sample(10, 10000000), sample(30, 90000000)},
+	}
+
+	result, err := AnalyzeMutexProfile(p, 5, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfile() error = %v", err)
+	}
+	var parsed MutexAnalysisResult
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(parsed.Contentions) != 1 {
+		t.Fatalf("expected samples to be aggregated into 1 function, got %d", len(parsed.Contentions))
+	}
+	if got := parsed.Contentions[0]; got.Contentions != 40 || got.AvgDelayNanos != 2500000 {
+		t.Errorf("aggregated stat = %+v, want 40 events with avg delay 2500000", got)
+	}
+}
+
 // containsString 检查字符串是否包含子字符串
 func containsString(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && containsSubstring(s, substr))
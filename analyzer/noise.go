@@ -0,0 +1,48 @@
+package analyzer
+
+import "fmt"
+
+// NoiseFilterSummary 记录按相对阈值 (MinPercent) 过滤掉的长尾函数 (JSON)
+type NoiseFilterSummary struct {
+	MinPercent             float64 `json:"minPercent"`             // 阈值：占总量百分比低于该值的函数被过滤
+	FilteredFunctions      int     `json:"filteredFunctions"`      // 被过滤的函数数量
+	FilteredValue          int64   `json:"filteredValue"`          // 被过滤函数的累计值 (与排序使用的指标单位相同)
+	FilteredValueFormatted string  `json:"filteredValueFormatted"` // 格式化后的累计值
+	FilteredPercentage     float64 `json:"filteredPercentage"`     // 累计值占总量的百分比
+}
+
+// String 返回用于文本报告的一行摘要，例如 "12 functions below 0.10% (1.20ms, 0.45% of total)"
+func (s *NoiseFilterSummary) String() string {
+	return fmt.Sprintf("%d functions below %.2f%% (%s, %.2f%% of total)",
+		s.FilteredFunctions, s.MinPercent, s.FilteredValueFormatted, s.FilteredPercentage)
+}
+
+// compactSuffix 返回附加在 compact 输出首行的过滤摘要，未过滤时为空
+func (s *NoiseFilterSummary) compactSuffix() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf(" filtered=%d(%.2f%%)", s.FilteredFunctions, s.FilteredPercentage)
+}
+
+// dropBelowPercent 在应用 Top N 之前丢弃 value 占 total 百分比低于 minPercent 的条目，保持原有顺序。
+// minPercent <= 0 或 total 为零时不过滤并返回 nil 摘要；否则即使没有条目被过滤也返回摘要，说明阈值已生效。
+func dropBelowPercent[T any](stats []T, value func(T) int64, total int64, minPercent float64, formatValue func(int64) string) ([]T, *NoiseFilterSummary) {
+	if minPercent <= 0 || total == 0 {
+		return stats, nil
+	}
+	summary := &NoiseFilterSummary{MinPercent: minPercent}
+	kept := make([]T, 0, len(stats))
+	for _, stat := range stats {
+		v := value(stat)
+		if float64(v)/float64(total)*100 < minPercent {
+			summary.FilteredFunctions++
+			summary.FilteredValue += v
+			continue
+		}
+		kept = append(kept, stat)
+	}
+	summary.FilteredValueFormatted = formatValue(summary.FilteredValue)
+	summary.FilteredPercentage = float64(summary.FilteredValue) / float64(total) * 100
+	return kept, summary
+}
@@ -0,0 +1,78 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestMinPercentNoiseFilter 测试 MinPercent 在 CPU、Heap、Mutex 和 Block 分析中一致地丢弃长尾函数并报告被过滤的数量和累计值
+func TestMinPercentNoiseFilter(t *testing.T) {
+	cpu := newCPUProfile(map[string]int64{"main.hot": 9900, "main.warm": 80, "main.tail1": 15, "main.tail2": 5})
+	cpuResult, err := CPUProfileStats(cpu, 10, CPUAnalysisOptions{MinPercent: 0.5})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	if len(cpuResult.Functions) != 2 || cpuResult.NoiseFilter == nil ||
+		cpuResult.NoiseFilter.FilteredFunctions != 2 || cpuResult.NoiseFilter.FilteredValue != 20 {
+		t.Errorf("CPU functions = %v, noise filter = %+v", cpuResult.Functions, cpuResult.NoiseFilter)
+	}
+	text, _ := FormatCPUResult(cpuResult, "text")
+	if !strings.Contains(text, "Filtered: 2 functions below 0.50% (20ns, 0.20% of total)") {
+		t.Errorf("CPU text output missing filter summary:\n%s", text)
+	}
+	if compact, _ := FormatCPUResult(cpuResult, "compact"); !strings.Contains(compact, "filtered=2(0.20%)") {
+		t.Errorf("CPU compact output missing filter summary:\n%s", compact)
+	}
+	// 未设置 MinPercent 时不过滤，也不输出摘要
+	if unfiltered, _ := CPUProfileStats(cpu, 10, CPUAnalysisOptions{}); len(unfiltered.Functions) != 4 || unfiltered.NoiseFilter != nil {
+		t.Errorf("CPU without MinPercent: functions = %d, noise filter = %+v", len(unfiltered.Functions), unfiltered.NoiseFilter)
+	}
+
+	heap := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}}
+	for name, v := range map[string]int64{"main.big": 1 << 20, "main.small": 100} {
+		fn := &profile.Function{ID: uint64(len(heap.Function) + 1), Name: name}
+		heap.Function = append(heap.Function, fn)
+		heap.Sample = append(heap.Sample, &profile.Sample{Value: []int64{v}, Location: []*profile.Location{{Line: []profile.Line{{Function: fn}}}}})
+	}
+	heapResult, err := HeapProfileStatsWithOptions(heap, 10, HeapAnalysisOptions{MinPercent: 0.1})
+	if err != nil {
+		t.Fatalf("HeapProfileStatsWithOptions() error = %v", err)
+	}
+	if len(heapResult.Functions) != 1 || heapResult.NoiseFilter == nil || heapResult.NoiseFilter.FilteredValueFormatted != FormatBytes(100) {
+		t.Errorf("Heap functions = %v, noise filter = %+v", heapResult.Functions, heapResult.NoiseFilter)
+	}
+	// 分配位置列表不受影响
+	if len(heapResult.AllocationSites) != 2 {
+		t.Errorf("Heap allocation sites = %d, want 2", len(heapResult.AllocationSites))
+	}
+
+	contention := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+	}
+	for name, v := range map[string][2]int64{"main.slow": {10, 990000000}, "main.frequent": {990, 10000000}} {
+		contention.Sample = append(contention.Sample, &profile.Sample{
+			Value:    []int64{v[0], v[1]},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+		})
+	}
+	// 按 delay 过滤掉 main.frequent，按 contentions 过滤掉 main.slow
+	mutexResult, err := MutexProfileStatsWithOptions(contention, 10, ContentionAnalysisOptions{MinPercent: 5})
+	if err != nil {
+		t.Fatalf("MutexProfileStatsWithOptions() error = %v", err)
+	}
+	if len(mutexResult.Contentions) != 1 || mutexResult.Contentions[0].FunctionName != "main.slow" || mutexResult.NoiseFilter.FilteredValue != 10000000 {
+		t.Errorf("Mutex contentions = %v, noise filter = %+v", mutexResult.Contentions, mutexResult.NoiseFilter)
+	}
+	if text, _ := FormatMutexResult(mutexResult, "text"); !strings.Contains(text, "已过滤占比低于 5.00% 的 1 个函数") {
+		t.Errorf("Mutex text output missing filter summary:\n%s", text)
+	}
+	blockResult, err := BlockProfileStatsWithOptions(contention, 10, ContentionAnalysisOptions{PrimaryMetric: PrimaryMetricContentions, MinPercent: 5})
+	if err != nil {
+		t.Fatalf("BlockProfileStatsWithOptions() error = %v", err)
+	}
+	if len(blockResult.Blocks) != 1 || blockResult.Blocks[0].FunctionName != "main.frequent" || blockResult.NoiseFilter.FilteredValue != 10 {
+		t.Errorf("Block blocks = %v, noise filter = %+v", blockResult.Blocks, blockResult.NoiseFilter)
+	}
+}
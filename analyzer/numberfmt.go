@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 数值格式 (NumberFormatter 的 style)
+const (
+	NumberStyleHuman = "human" // 默认：1024 进制的 KB/MB、"1.50 ms"、"1.2K" 等便于阅读的格式
+	NumberStyleRaw   = "raw"   // 纯整数：字节数、纳秒数和计数都不做换算，便于程序解析
+	NumberStyleSI    = "si"    // 与 human 相同，但字节数按 1000 进制换算并使用 kB/MB/GB
+	NumberStyleIEC   = "iec"   // 与 human 相同，但字节数使用 KiB/MiB/GiB 等 IEC 单位
+)
+
+// NumberStyles 是 NewNumberFormatter 的可选值
+var NumberStyles = []string{NumberStyleHuman, NumberStyleRaw, NumberStyleSI, NumberStyleIEC}
+
+// NumberFormatter 按数值格式 (见 NumberStyles) 格式化报告中的字节数、时长和计数。
+// 零值使用 NumberStyleHuman，输出与包级的 FormatBytes、FormatSampleValue 等函数相同。
+// 目前只有单个 profile 的报告 (cpu、heap、allocs、goroutine、mutex、block 及按标签分组) 通过选项接受 NumberFormatter，
+// 比较、时序、火焰图等其它报告固定使用 NumberStyleHuman。
+type NumberFormatter struct {
+	style string
+}
+
+// NewNumberFormatter 返回 style 对应的 NumberFormatter，style 为空时使用 NumberStyleHuman
+func NewNumberFormatter(style string) (NumberFormatter, error) {
+	if style == "" || style == NumberStyleHuman {
+		return NumberFormatter{}, nil
+	}
+	if !slices.Contains(NumberStyles, style) {
+		return NumberFormatter{}, fmt.Errorf("unsupported number style '%s' (expected %s)", style, strings.Join(NumberStyles, ", "))
+	}
+	return NumberFormatter{style: style}, nil
+}
+
+// Style 返回数值格式的名称
+func (f NumberFormatter) Style() string {
+	if f.style == "" {
+		return NumberStyleHuman
+	}
+	return f.style
+}
+
+// Bytes 格式化字节数：human 为 "1.50 MB" (1024 进制)，si 为 "1.57 MB" (1000 进制)，iec 为 "1.50 MiB"，raw 为 "1572864"
+func (f NumberFormatter) Bytes(b int64) string {
+	switch f.style {
+	case NumberStyleRaw:
+		return strconv.FormatInt(b, 10)
+	case NumberStyleSI:
+		return scaledBytes(b, 1000, "kMGTPE", "B")
+	case NumberStyleIEC:
+		return scaledBytes(b, 1024, "KMGTPE", "iB")
+	}
+	return scaledBytes(b, 1024, "KMGTPE", "B") // Kilo, Mega, Giga, Tera, Peta, Exa
+}
+
+// scaledBytes 将 b 按 unit 进制换算为带单位前缀的字符串，不足一个 unit 时以 "B" 为单位
+func scaledBytes(b, unit int64, prefixes, suffix string) string {
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := unit, 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %c%s", float64(b)/float64(div), prefixes[exp], suffix)
+}
+
+// Nanos 格式化纳秒数 (mutex/block 的延迟)，例如 "1.50 ms"；raw 时为纳秒整数
+func (f NumberFormatter) Nanos(nanos int64) string {
+	if f.style == NumberStyleRaw {
+		return strconv.FormatInt(nanos, 10)
+	}
+	if nanos < 1000 {
+		return fmt.Sprintf("%d ns", nanos)
+	}
+	micros := nanos / 1000
+	if micros < 1000 {
+		return fmt.Sprintf("%.2f μs", float64(nanos)/1000)
+	}
+	millis := micros / 1000
+	if millis < 1000 {
+		return fmt.Sprintf("%.2f ms", float64(micros)/1000)
+	}
+	seconds := millis / 1000
+	if seconds < 60 {
+		return fmt.Sprintf("%.2f s", float64(millis)/1000)
+	}
+	minutes := seconds / 60
+	secondsRemainder := seconds % 60
+	return fmt.Sprintf("%d m %d s", minutes, secondsRemainder)
+}
+
+// Number 格式化计数，例如 "1.2K"；raw 时为整数
+func (f NumberFormatter) Number(n int64) string {
+	if f.style == NumberStyleRaw || n < 1000 {
+		return strconv.FormatInt(n, 10)
+	}
+	if n < 1000000 {
+		return fmt.Sprintf("%.1fK", float64(n)/1000)
+	}
+	if n < 1000000000 {
+		return fmt.Sprintf("%.1fM", float64(n)/1000000)
+	}
+	return fmt.Sprintf("%.1fG", float64(n)/1000000000)
+}
+
+// SampleValue 按样本单位格式化样本值 (如 CPU 时间或计数)，例如 "1.23s"；raw 时为整数
+func (f NumberFormatter) SampleValue(value int64, unit string) string {
+	if f.style == NumberStyleRaw {
+		return strconv.FormatInt(value, 10)
+	}
+	switch unit {
+	case "nanoseconds":
+		d := time.Duration(value) * time.Nanosecond
+		if d >= time.Second {
+			return fmt.Sprintf("%.2fs", d.Seconds())
+		}
+		if d >= time.Millisecond {
+			return fmt.Sprintf("%.2fms", float64(d.Milliseconds()))
+		}
+		if d >= time.Microsecond {
+			return fmt.Sprintf("%.2fus", float64(d.Microseconds()))
+		}
+		return fmt.Sprintf("%dns", d.Nanoseconds())
+	case "count":
+		return fmt.Sprintf("%d", value)
+	// 如果需要，可以添加其他潜在单位的处理
+	default:
+		return fmt.Sprintf("%d %s", value, unit) // 回退方案
+	}
+}
+
+// UnitValue 根据样本单位选择合适的格式化方式 (bytes 用 Bytes，count 用 Number，其它用 SampleValue)
+func (f NumberFormatter) UnitValue(value int64, unit string) string {
+	switch unit {
+	case "bytes":
+		return f.Bytes(value)
+	case "count":
+		return f.Number(value)
+	default:
+		return f.SampleValue(value, unit)
+	}
+}
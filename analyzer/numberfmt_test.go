@@ -0,0 +1,79 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestNumberFormatter 测试各数值格式下字节数、时长和计数的输出，并且格式会贯穿 Heap 和 Mutex 报告
+func TestNumberFormatter(t *testing.T) {
+	const bytes = 1536 * 1024 // 1.50 MiB
+	tests := []struct {
+		style                string
+		bytes, nanos, number string
+	}{
+		{NumberStyleHuman, "1.50 MB", "1.50 ms", "1.2K"},
+		{NumberStyleRaw, "1572864", "1500000", "1234"},
+		{NumberStyleSI, "1.57 MB", "1.50 ms", "1.2K"},
+		{NumberStyleIEC, "1.50 MiB", "1.50 ms", "1.2K"},
+	}
+	for _, tt := range tests {
+		f, err := NewNumberFormatter(tt.style)
+		if err != nil {
+			t.Fatalf("NewNumberFormatter(%s) error = %v", tt.style, err)
+		}
+		if got := f.Bytes(bytes); got != tt.bytes {
+			t.Errorf("%s: Bytes() = %q, want %q", tt.style, got, tt.bytes)
+		}
+		if got := f.Nanos(1500000); got != tt.nanos {
+			t.Errorf("%s: Nanos() = %q, want %q", tt.style, got, tt.nanos)
+		}
+		if got := f.Number(1234); got != tt.number {
+			t.Errorf("%s: Number() = %q, want %q", tt.style, got, tt.number)
+		}
+	}
+	// 零值与包级函数一致
+	if got := (NumberFormatter{}).Bytes(bytes); got != FormatBytes(bytes) {
+		t.Errorf("zero NumberFormatter Bytes() = %q, want %q", got, FormatBytes(bytes))
+	}
+	if got, _ := NewNumberFormatter(NumberStyleSI); got.Bytes(999) != "999 B" {
+		t.Errorf("si Bytes(999) = %q, want 999 B", got.Bytes(999))
+	}
+	if _, err := NewNumberFormatter("metric"); err == nil {
+		t.Error("NewNumberFormatter(metric) error = nil, want an error")
+	}
+
+	raw, _ := NewNumberFormatter(NumberStyleRaw)
+	heap := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}, PeriodType: &profile.ValueType{Type: "space", Unit: "bytes"}, Period: 524288}
+	fn := &profile.Function{ID: 1, Name: "main.alloc"}
+	heap.Function = append(heap.Function, fn)
+	heap.Sample = append(heap.Sample, &profile.Sample{Value: []int64{bytes}, Location: []*profile.Location{{Line: []profile.Line{{Function: fn}}}}})
+	heapResult, err := HeapProfileStatsWithOptions(heap, 10, HeapAnalysisOptions{Numbers: raw})
+	if err != nil {
+		t.Fatalf("HeapProfileStatsWithOptions() error = %v", err)
+	}
+	if heapResult.TotalValueFormatted != "1572864" || heapResult.Functions[0].ValueFormatted != "1572864" {
+		t.Errorf("raw heap result = %s / %s, want 1572864", heapResult.TotalValueFormatted, heapResult.Functions[0].ValueFormatted)
+	}
+	if text, _ := FormatHeapResult(heapResult, "text"); !strings.Contains(text, "Capture Config: MemProfileRate 524288") {
+		t.Errorf("raw heap text output should format the capture config as raw numbers:\n%s", text)
+	}
+
+	contention := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{{
+			Value:    []int64{1234, 1500000},
+			Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: "main.lock"}}}}},
+		}},
+	}
+	mutexResult, err := MutexProfileStatsWithOptions(contention, 10, ContentionAnalysisOptions{Numbers: raw})
+	if err != nil {
+		t.Fatalf("MutexProfileStatsWithOptions() error = %v", err)
+	}
+	text, _ := FormatMutexResult(mutexResult, "text")
+	if !strings.Contains(text, "总竞争次数: 1234") || !strings.Contains(text, "总延迟时间: 1500000") {
+		t.Errorf("raw mutex text output:\n%s", text)
+	}
+}
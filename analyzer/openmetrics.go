@@ -0,0 +1,187 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/pprof/profile"
+)
+
+// openMetricsExemplarMaxRunes 是 OpenMetrics 规范对 exemplar 标签集 (名称与值的总长度) 的限制
+const openMetricsExemplarMaxRunes = 128
+
+// invalidMetricChars 匹配 OpenMetrics 指标名中不允许出现的字符
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// openMetricsFunction 保存导出的单个函数的值及其代表性调用栈
+type openMetricsFunction struct {
+	name       string
+	flat       int64
+	stack      []string // 代表性调用栈 (值最大的样本)，从叶子到根
+	stackValue int64    // 代表性样本的值
+}
+
+// ExportOpenMetrics 将 profile 的 Top N 函数导出为 OpenMetrics 文本格式。
+// 每个函数的 flat 值是一条 counter 样本，并附带 exemplar 指向其代表性调用栈 (值最大的样本)，
+// 以便支持 exemplar 的指标后端携带调用栈上下文。exemplar 的标签长度受规范限制，
+// 因此 exemplar 中只包含 stack_id 和截断后的调用栈，完整调用栈通过 pprof_stack_info 指标给出。
+// 通过 topN 限制基数。
+func ExportOpenMetrics(p *profile.Profile, profileType string, topN int) (string, error) {
+	logDebug("Exporting %s profile as OpenMetrics (Top %d)", profileType, topN)
+
+	valueIndex, err := metricValueIndex(p, profileType)
+	if err != nil {
+		return "", err
+	}
+	sampleType := p.SampleType[valueIndex]
+
+	functions := make(map[string]*openMetricsFunction)
+	for _, s := range p.Sample {
+		if len(s.Location) == 0 || len(s.Value) <= valueIndex {
+			continue
+		}
+		stack := sampleStack(s)
+		if len(stack) == 0 {
+			continue
+		}
+		v := s.Value[valueIndex]
+		fn, ok := functions[stack[0]]
+		if !ok {
+			fn = &openMetricsFunction{name: stack[0]}
+			functions[stack[0]] = fn
+		}
+		fn.flat += v
+		if fn.stack == nil || v > fn.stackValue {
+			fn.stack = stack
+			fn.stackValue = v
+		}
+	}
+
+	stats := make([]*openMetricsFunction, 0, len(functions))
+	for _, fn := range functions {
+		if fn.flat > 0 {
+			stats = append(stats, fn)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].flat != stats[j].flat {
+			return stats[i].flat > stats[j].flat
+		}
+		return stats[i].name < stats[j].name
+	})
+	if len(stats) > topN {
+		stats = stats[:topN]
+	}
+
+	family := metricFamilyName(profileType, sampleType)
+	exemplarTimestamp := ""
+	if p.TimeNanos > 0 {
+		exemplarTimestamp = fmt.Sprintf(" %.3f", float64(p.TimeNanos)/1e9)
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("# TYPE %s counter\n", family))
+	if unit := metricUnit(sampleType.Unit); unit != "" {
+		b.WriteString(fmt.Sprintf("# UNIT %s %s\n", family, unit))
+	}
+	b.WriteString(fmt.Sprintf("# HELP %s Flat %s/%s per function (top %d) from a pprof %s profile.\n",
+		family, sampleType.Type, sampleType.Unit, topN, profileType))
+	for _, fn := range stats {
+		id := stackID(fn.stack)
+		b.WriteString(fmt.Sprintf("%s_total{function=\"%s\"} %d # {stack_id=\"%s\",stack=\"%s\"} %d%s\n",
+			family, escapeLabelValue(fn.name), fn.flat,
+			id, escapeLabelValue(truncateStack(fn.stack, openMetricsExemplarMaxRunes-len("stack_id")-len(id)-len("stack"))),
+			fn.stackValue, exemplarTimestamp))
+	}
+
+	b.WriteString("# TYPE pprof_stack info\n")
+	b.WriteString("# HELP pprof_stack Full representative call stacks referenced by exemplar stack_id.\n")
+	for _, fn := range stats {
+		b.WriteString(fmt.Sprintf("pprof_stack_info{stack_id=\"%s\",function=\"%s\",stack=\"%s\"} 1\n",
+			stackID(fn.stack), escapeLabelValue(fn.name), escapeLabelValue(strings.Join(fn.stack, ";"))))
+	}
+	b.WriteString("# EOF\n")
+	return b.String(), nil
+}
+
+// metricValueIndex 选择导出使用的样本类型索引
+func metricValueIndex(p *profile.Profile, profileType string) (int, error) {
+	if _, ok := valueColumnCandidates[profileType]; !ok || profileType == "heap_growth" {
+		return 0, fmt.Errorf("unsupported profile type: '%s'", profileType)
+	}
+	index, _, err := findValueColumn(p, profileType)
+	return index, err
+}
+
+// sampleStack 返回样本调用栈中的函数名 (包括内联帧)，从叶子到根
+func sampleStack(s *profile.Sample) []string {
+	var stack []string
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function != nil {
+				stack = append(stack, line.Function.Name)
+			}
+		}
+	}
+	return stack
+}
+
+// metricFamilyName 构造符合 OpenMetrics 规范的指标族名称，单位 (如有) 必须作为后缀
+func metricFamilyName(profileType string, st *profile.ValueType) string {
+	name := "pprof_" + profileType
+	if st.Type != profileType {
+		name += "_" + st.Type
+	}
+	if unit := metricUnit(st.Unit); unit != "" {
+		name += "_" + unit
+	}
+	return invalidMetricChars.ReplaceAllString(name, "_")
+}
+
+// metricUnit 将 pprof 单位转换为 OpenMetrics 单位，"count" 等无量纲单位返回空字符串
+func metricUnit(unit string) string {
+	switch unit {
+	case "bytes", "nanoseconds", "seconds":
+		return unit
+	}
+	return ""
+}
+
+// stackID 返回调用栈的简短标识
+func stackID(stack []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(stack, ";")))
+	return hex.EncodeToString(sum[:4])
+}
+
+// truncateStack 将调用栈拼接为 "leaf;caller;..."，超过 maxRunes 时按帧截断并以 "..." 结尾
+func truncateStack(stack []string, maxRunes int) string {
+	joined := strings.Join(stack, ";")
+	if utf8.RuneCountInString(joined) <= maxRunes {
+		return joined
+	}
+	var b strings.Builder
+	for i, frame := range stack {
+		sep := ""
+		if i > 0 {
+			sep = ";"
+		}
+		if utf8.RuneCountInString(b.String()+sep+frame)+len(";...") > maxRunes {
+			break
+		}
+		b.WriteString(sep + frame)
+	}
+	if b.Len() == 0 {
+		return "..."
+	}
+	return b.String() + ";..."
+}
+
+// escapeLabelValue 按 OpenMetrics 规范转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,71 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestExportOpenMetrics 测试 OpenMetrics 导出及 exemplar 中的调用栈
+func TestExportOpenMetrics(t *testing.T) {
+	fnMain := &profile.Function{ID: 1, Name: "main.main"}
+	fnHot := &profile.Function{ID: 2, Name: `main.hot"quoted"`}
+	fnCold := &profile.Function{ID: 3, Name: "main.cold"}
+	locMain := &profile.Location{ID: 1, Line: []profile.Line{{Function: fnMain}}}
+	locHot := &profile.Location{ID: 2, Line: []profile.Line{{Function: fnHot}}}
+	locCold := &profile.Location{ID: 3, Line: []profile.Line{{Function: fnCold}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		TimeNanos:  1700000000000000000,
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{locHot, locMain}, Value: []int64{3, 300}},
+			{Location: []*profile.Location{locHot}, Value: []int64{1, 100}},
+			{Location: []*profile.Location{locCold, locMain}, Value: []int64{1, 50}},
+		},
+		Location: []*profile.Location{locMain, locHot, locCold},
+		Function: []*profile.Function{fnMain, fnHot, fnCold},
+	}
+
+	out, err := ExportOpenMetrics(p, "cpu", 1)
+	if err != nil {
+		t.Fatalf("ExportOpenMetrics() error = %v", err)
+	}
+	for _, want := range []string{
+		"# TYPE pprof_cpu_nanoseconds counter\n",
+		"# UNIT pprof_cpu_nanoseconds nanoseconds\n",
+		`pprof_cpu_nanoseconds_total{function="main.hot\"quoted\""} 400 # {stack_id="`,
+		`stack="main.hot\"quoted\";main.main"} 300 1700000000.000`,
+		"# TYPE pprof_stack info\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "main.cold") {
+		t.Error("Expected topN to limit exported functions")
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Error("Expected output to end with # EOF")
+	}
+
+	if _, err := ExportOpenMetrics(p, "unknown", 10); err == nil {
+		t.Error("Expected error for unsupported profile type, got nil")
+	}
+}
+
+// TestTruncateStack 测试 exemplar 调用栈按帧截断
+func TestTruncateStack(t *testing.T) {
+	stack := []string{strings.Repeat("a", 40), strings.Repeat("b", 40), strings.Repeat("c", 40)}
+	got := truncateStack(stack, 100)
+	if got != stack[0]+";"+stack[1]+";..." {
+		t.Errorf("Unexpected truncated stack: %q", got)
+	}
+	if utf8.RuneCountInString(got) > 100 {
+		t.Errorf("Truncated stack exceeds limit: %d", utf8.RuneCountInString(got))
+	}
+	if got := truncateStack(stack[:1], 100); got != stack[0] {
+		t.Errorf("Expected short stack unchanged, got %q", got)
+	}
+}
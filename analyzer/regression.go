@@ -0,0 +1,101 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RegressionVerdict 是 compare_profiles 的回归判定结果 (JSON)，供 CI 等调用方根据 HasRegression 决定是否失败。
+// 单函数阈值和总量阈值相互独立：任意一个启用的阈值被超过时 HasRegression 为 true。
+type RegressionVerdict struct {
+	HasRegression         bool           `json:"hasRegression"`
+	ThresholdPercent      float64        `json:"thresholdPercent,omitempty"`      // 单函数阈值：函数值增长超过该百分比时判定为回归 (0 表示不检查)
+	TotalThresholdPercent float64        `json:"totalThresholdPercent,omitempty"` // 总量阈值：profile 总值增长超过该百分比时判定为回归 (0 表示不检查)
+	TotalDiffPercent      float64        `json:"totalDiffPercent"`                // profile 总值的变化百分比
+	TotalRegressed        bool           `json:"totalRegressed"`                  // 总值的增长是否超过 TotalThresholdPercent
+	RegressedFunctions    []FunctionDiff `json:"regressedFunctions"`              // 增长超过 ThresholdPercent 的函数，按变化百分比降序
+}
+
+// computeRegressionVerdict 根据 opts 中的阈值判定回归；两个阈值都未设置时返回 nil。
+// 单函数阈值只统计值增长 (DiffValue > 0) 且 DiffPercentage 超过阈值的函数 (新增函数的变化按 100% 计)，
+// ExcludeLowConfidence 时忽略低置信度的差异。diffs 应已按 Include/Exclude 过滤。
+func computeRegressionVerdict(diffs []FunctionDiff, summary DiffSummary, opts CompareOptions) *RegressionVerdict {
+	if opts.RegressionThresholdPercent <= 0 && opts.TotalRegressionThresholdPercent <= 0 {
+		return nil
+	}
+	verdict := &RegressionVerdict{
+		ThresholdPercent:      opts.RegressionThresholdPercent,
+		TotalThresholdPercent: opts.TotalRegressionThresholdPercent,
+		TotalDiffPercent:      summary.TotalDiffPercent,
+		RegressedFunctions:    []FunctionDiff{},
+	}
+	if opts.RegressionThresholdPercent > 0 {
+		for _, d := range diffs {
+			if d.DiffValue <= 0 || d.DiffPercentage <= opts.RegressionThresholdPercent {
+				continue
+			}
+			if opts.ExcludeLowConfidence && d.LowConfidence {
+				continue
+			}
+			verdict.RegressedFunctions = append(verdict.RegressedFunctions, d)
+		}
+		regressed := verdict.RegressedFunctions
+		sort.Slice(regressed, func(i, j int) bool {
+			if regressed[i].DiffPercentage != regressed[j].DiffPercentage {
+				return regressed[i].DiffPercentage > regressed[j].DiffPercentage
+			}
+			return regressed[i].FunctionName < regressed[j].FunctionName
+		})
+	}
+	if opts.TotalRegressionThresholdPercent > 0 && summary.TotalDiff > 0 && summary.TotalDiffPercent > opts.TotalRegressionThresholdPercent {
+		verdict.TotalRegressed = true
+	}
+	verdict.HasRegression = verdict.TotalRegressed || len(verdict.RegressedFunctions) > 0
+	return verdict
+}
+
+// writeRegressionVerdict 将回归判定写入 text 或 markdown 报告；verdict 为 nil 时不输出
+func writeRegressionVerdict(b *strings.Builder, verdict *RegressionVerdict, format string) {
+	if verdict == nil {
+		return
+	}
+	status := "未发现回归"
+	if verdict.HasRegression {
+		status = "存在回归"
+	}
+	var lines []string
+	if verdict.ThresholdPercent > 0 {
+		lines = append(lines, fmt.Sprintf("单函数阈值 %.2f%%: %d 个函数超过", verdict.ThresholdPercent, len(verdict.RegressedFunctions)))
+	}
+	if verdict.TotalThresholdPercent > 0 {
+		exceeded := "未超过"
+		if verdict.TotalRegressed {
+			exceeded = "超过"
+		}
+		lines = append(lines, fmt.Sprintf("总量阈值 %.2f%%: 总差异 %+.2f%%，%s", verdict.TotalThresholdPercent, verdict.TotalDiffPercent, exceeded))
+	}
+
+	if format == "markdown" {
+		icon := "✅"
+		if verdict.HasRegression {
+			icon = "❌"
+		}
+		b.WriteString("\n## 回归判定\n\n")
+		b.WriteString(fmt.Sprintf("- **结果**: %s %s\n", icon, status))
+		for _, line := range lines {
+			b.WriteString(fmt.Sprintf("- %s\n", line))
+		}
+		for _, d := range verdict.RegressedFunctions {
+			b.WriteString(fmt.Sprintf("  - `%s`: %s → %s (%+.2f%%)\n", truncateString(d.FunctionName, 60), d.BaselineFormatted, d.TargetFormatted, d.DiffPercentage))
+		}
+		return
+	}
+	b.WriteString(fmt.Sprintf("\n回归判定: %s\n", status))
+	for _, line := range lines {
+		b.WriteString(fmt.Sprintf("  %s\n", line))
+	}
+	for _, d := range verdict.RegressedFunctions {
+		b.WriteString(fmt.Sprintf("    - %s: %s -> %s (%+.2f%%)\n", truncateString(d.FunctionName, 60), d.BaselineFormatted, d.TargetFormatted, d.DiffPercentage))
+	}
+}
@@ -0,0 +1,73 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+// valueColumnCandidates 按优先级列出每种 profile 类型用于分析的样本类型。
+// 分析器按 Type/Unit 名称查找列，而不是假设列的顺序，因为不同的 profile 生成工具列顺序可能不同。
+var valueColumnCandidates = map[string][]profile.ValueType{
+	"cpu":         {{Type: "cpu", Unit: "nanoseconds"}, {Type: "samples", Unit: "nanoseconds"}, {Type: "samples", Unit: "count"}},
+	"heap":        {{Type: "inuse_space", Unit: "bytes"}, {Type: "alloc_space", Unit: "bytes"}},
+	"allocs":      {{Type: "alloc_space", Unit: "bytes"}, {Type: "alloc", Unit: "bytes"}, {Type: "allocation", Unit: "bytes"}},
+	"goroutine":   {{Type: "goroutine", Unit: "count"}, {Type: "goroutines", Unit: "count"}},
+	"mutex":       {{Type: "delay", Unit: "nanoseconds"}},
+	"block":       {{Type: "delay", Unit: "nanoseconds"}},
+	"heap_growth": {{Type: GrowthSampleType, Unit: "bytes"}},
+}
+
+// findValueColumn 返回 profileType 类型的 profile 中用于分析的样本类型索引。
+// 依次尝试：Type 和 Unit 都匹配、仅 Type 匹配；都找不到时才按位置使用最后一列，并返回说明原因的警告。
+func findValueColumn(p *profile.Profile, profileType string) (int, string, error) {
+	if len(p.SampleType) == 0 {
+		return 0, "", fmt.Errorf("profile 没有样本类型")
+	}
+
+	candidates := valueColumnCandidates[profileType]
+	for _, c := range candidates {
+		for i, st := range p.SampleType {
+			if st.Type == c.Type && st.Unit == c.Unit {
+				return i, "", nil
+			}
+		}
+	}
+	for _, c := range candidates {
+		if i := findSampleTypeIndex(p, c.Type); i >= 0 {
+			return i, "", nil
+		}
+	}
+
+	// 最后的手段：按位置选择。单列 profile 只能使用唯一的一列；多列时使用最后一列 (Go 生成的 profile 中通常是主要的值)
+	index := len(p.SampleType) - 1
+	st := p.SampleType[index]
+	warning := fmt.Sprintf("未在 profile 中找到 %s profile 应有的样本类型 (%s)，已按位置使用第 %d 列 %s/%s，结果可能不正确。",
+		profileType, describeValueTypes(candidates), index+1, st.Type, st.Unit)
+	logWarn("%s", warning)
+	return index, warning, nil
+}
+
+// ValueColumnWarning 返回分析 profileType 类型的 profile 时需要按位置选择样本类型的警告；按名称找到时返回空字符串。
+func ValueColumnWarning(p *profile.Profile, profileType string) string {
+	_, warning, err := findValueColumn(p, profileType)
+	if err != nil {
+		return ""
+	}
+	return warning
+}
+
+// describeValueTypes 将样本类型列表格式化为 "type/unit, type/unit"
+func describeValueTypes(types []profile.ValueType) string {
+	if len(types) == 0 {
+		return "未知"
+	}
+	s := ""
+	for i, t := range types {
+		if i > 0 {
+			s += ", "
+		}
+		s += t.Type + "/" + t.Unit
+	}
+	return s
+}
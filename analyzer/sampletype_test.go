@@ -0,0 +1,70 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestFindValueColumn 测试按名称查找样本类型列，不依赖列的顺序
+func TestFindValueColumn(t *testing.T) {
+	heapTypes := []*profile.ValueType{
+		{Type: "alloc_objects", Unit: "count"},
+		{Type: "alloc_space", Unit: "bytes"},
+		{Type: "inuse_objects", Unit: "count"},
+		{Type: "inuse_space", Unit: "bytes"},
+	}
+	tests := []struct {
+		name        string
+		sampleTypes []*profile.ValueType
+		profileType string
+		want        int
+		wantWarning bool
+	}{
+		{"heap uses inuse_space", heapTypes, "heap", 3, false},
+		{"allocs uses alloc_space", heapTypes, "allocs", 1, false},
+		{"cpu columns reordered", []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}, {Type: "samples", Unit: "count"}}, "cpu", 0, false},
+		{"goroutine", []*profile.ValueType{{Type: "goroutine", Unit: "count"}}, "goroutine", 0, false},
+		{"mutex delay first", []*profile.ValueType{{Type: "delay", Unit: "nanoseconds"}, {Type: "contentions", Unit: "count"}}, "mutex", 0, false},
+		{"positional fallback", []*profile.ValueType{{Type: "foo", Unit: "count"}, {Type: "bar", Unit: "bytes"}}, "heap", 1, true},
+	}
+	for _, tt := range tests {
+		p := &profile.Profile{SampleType: tt.sampleTypes}
+		got, warning, err := findValueColumn(p, tt.profileType)
+		if err != nil {
+			t.Fatalf("%s: findValueColumn() error = %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected index %d, got %d", tt.name, tt.want, got)
+		}
+		if (warning != "") != tt.wantWarning {
+			t.Errorf("%s: unexpected warning %q", tt.name, warning)
+		}
+	}
+
+	if _, _, err := findValueColumn(&profile.Profile{}, "cpu"); err == nil {
+		t.Error("Expected error for profile without sample types, got nil")
+	}
+}
+
+// TestCompareProfilesColumnOrder 测试 baseline 与 target 列顺序不同时仍比较正确的列
+func TestCompareProfilesColumnOrder(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	baseline := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1, 100}}},
+	}
+	target := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}, {Type: "samples", Unit: "count"}},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{100, 1}}},
+	}
+
+	result, err := CompareProfiles(baseline, target, "cpu", 5, "json")
+	if err != nil {
+		t.Fatalf("CompareProfiles() error = %v", err)
+	}
+	if !containsString(result, `"diffValue": 0`) {
+		t.Errorf("Expected no change when only column order differs, got:\n%s", result)
+	}
+}
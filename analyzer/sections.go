@@ -0,0 +1,47 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ReportSections 是可以单独指定 Top N 的报告分区，与 profile 类型一一对应
+var ReportSections = []string{"cpu", "heap", "allocs", "goroutine", "mutex", "block"}
+
+// SectionTopN 为报告中的各个分区分别指定 Top N，例如 {"cpu": 20, "mutex": 5}。
+// 包含多个分区的报告用它来控制每个分区的长度，未指定的分区使用全局 top_n。
+type SectionTopN map[string]int
+
+// For 返回 section 分区的 Top N，未指定时返回 fallback
+func (s SectionTopN) For(section string, fallback int) int {
+	if n, ok := s[section]; ok {
+		return n
+	}
+	return fallback
+}
+
+// NewSectionTopN 校验工具参数中的分区 Top N 映射：分区名必须属于 ReportSections，值必须是正整数。
+func NewSectionTopN(values map[string]float64) (SectionTopN, error) {
+	result := make(SectionTopN, len(values))
+	for section, v := range values {
+		if !isReportSection(section) {
+			return nil, fmt.Errorf("unknown report section '%s' (expected one of: %s)", section, strings.Join(ReportSections, ", "))
+		}
+		if v <= 0 || v != math.Trunc(v) {
+			return nil, fmt.Errorf("top N for section '%s' must be a positive integer, got %v", section, v)
+		}
+		result[section] = int(v)
+	}
+	return result, nil
+}
+
+// isReportSection 判断 section 是否是已知的报告分区
+func isReportSection(section string) bool {
+	for _, s := range ReportSections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
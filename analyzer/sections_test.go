@@ -0,0 +1,32 @@
+package analyzer
+
+import "testing"
+
+// TestSectionTopN 测试按分区指定 Top N 及回退到全局值
+func TestSectionTopN(t *testing.T) {
+	s, err := NewSectionTopN(map[string]float64{"cpu": 20, "mutex": 5})
+	if err != nil {
+		t.Fatalf("NewSectionTopN() error = %v", err)
+	}
+	if got := s.For("cpu", 10); got != 20 {
+		t.Errorf("Expected cpu top N 20, got %d", got)
+	}
+	if got := s.For("heap", 10); got != 10 {
+		t.Errorf("Expected heap to fall back to 10, got %d", got)
+	}
+
+	var empty SectionTopN
+	if got := empty.For("cpu", 7); got != 7 {
+		t.Errorf("Expected nil map to fall back to 7, got %d", got)
+	}
+
+	for name, values := range map[string]map[string]float64{
+		"unknown section": {"gpu": 5},
+		"zero":            {"cpu": 0},
+		"fractional":      {"cpu": 2.5},
+	} {
+		if _, err := NewSectionTopN(values); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
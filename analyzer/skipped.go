@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+// skippedSampleWarnPercent 是被跳过样本占比的提示阈值：超过该比例通常说明 profile_type 与文件内容不一致
+const skippedSampleWarnPercent = 20.0
+
+// SkippedSamples 记录分析时因为没有调用栈或缺少所选样本类型的值而被跳过的样本 (JSON)
+type SkippedSamples struct {
+	Count        int     `json:"count"`        // 被跳过的样本数
+	NoLocation   int     `json:"noLocation"`   // 没有调用栈 (Location 为空) 的样本数
+	MissingValue int     `json:"missingValue"` // 值的数量不足、缺少所选样本类型的值的样本数
+	TotalSamples int     `json:"totalSamples"` // profile 中的样本总数
+	Percentage   float64 `json:"percentage"`   // 被跳过的样本占样本总数的百分比
+}
+
+// countSkippedSamples 统计 p 中分析时会被跳过的样本：没有调用栈，或者 Value 不包含 valueIndices 中的某一列。
+// 同时满足两个条件的样本按缺少值计算。没有样本被跳过时返回 nil。
+func countSkippedSamples(p *profile.Profile, valueIndices ...int) *SkippedSamples {
+	maxIndex := 0
+	for _, i := range valueIndices {
+		maxIndex = max(maxIndex, i)
+	}
+	s := &SkippedSamples{TotalSamples: len(p.Sample)}
+	for _, sample := range p.Sample {
+		switch {
+		case len(sample.Value) <= maxIndex:
+			s.MissingValue++
+		case len(sample.Location) == 0:
+			s.NoLocation++
+		}
+	}
+	s.Count = s.NoLocation + s.MissingValue
+	if s.Count == 0 {
+		return nil
+	}
+	s.Percentage = float64(s.Count) / float64(s.TotalSamples) * 100
+	return s
+}
+
+// likelyWrongType 判断被跳过的比例是否高到说明可能指定了错误的 profile 类型
+func (s *SkippedSamples) likelyWrongType() bool {
+	return s.Percentage >= skippedSampleWarnPercent
+}
+
+// String 返回用于文本报告的一行摘要，例如 "12/340 samples (3.53%): 10 without a call stack, 2 missing the selected value"
+func (s *SkippedSamples) String() string {
+	line := fmt.Sprintf("%d/%d samples (%.2f%%): %d without a call stack, %d missing the selected value",
+		s.Count, s.TotalSamples, s.Percentage, s.NoLocation, s.MissingValue)
+	if s.likelyWrongType() {
+		line += "; this many usually means profile_type does not match the profile"
+	}
+	return line
+}
+
+// compactSuffix 返回附加在 compact 输出首行的跳过摘要，没有样本被跳过时为空
+func (s *SkippedSamples) compactSuffix() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf(" skipped=%d(%.2f%%)", s.Count, s.Percentage)
+}
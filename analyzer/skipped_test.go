@@ -0,0 +1,50 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestSkippedSamples 测试没有调用栈或缺少样本值的样本被计入 SkippedSamples，并在文本和 compact 输出中说明
+func TestSkippedSamples(t *testing.T) {
+	cpu := newCPUProfile(map[string]int64{"main.work": 900})
+	cpu.Sample = append(cpu.Sample,
+		&profile.Sample{Value: []int64{100}},                                // 没有调用栈
+		&profile.Sample{Location: cpu.Sample[0].Location, Value: []int64{}}, // 缺少值
+	)
+	result, err := CPUProfileStats(cpu, 10, CPUAnalysisOptions{})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	s := result.SkippedSamples
+	if s == nil || s.Count != 2 || s.NoLocation != 1 || s.MissingValue != 1 || s.TotalSamples != 3 {
+		t.Fatalf("SkippedSamples = %+v, want 2 of 3 samples skipped", s)
+	}
+	text, _ := FormatCPUResult(result, "text")
+	if !strings.Contains(text, "Skipped: 2/3 samples (66.67%): 1 without a call stack, 1 missing the selected value; this many usually means profile_type does not match") {
+		t.Errorf("CPU text output missing skipped summary:\n%s", text)
+	}
+	if compact, _ := FormatCPUResult(result, "compact"); !strings.Contains(compact, "skipped=2(66.67%)") {
+		t.Errorf("CPU compact output missing skipped summary:\n%s", compact)
+	}
+
+	// 没有样本被跳过时不输出摘要
+	if clean, _ := CPUProfileStats(newCPUProfile(map[string]int64{"main.work": 900}), 10, CPUAnalysisOptions{}); clean.SkippedSamples != nil {
+		t.Errorf("SkippedSamples = %+v, want nil", clean.SkippedSamples)
+	}
+
+	// 所有样本都缺少 delay 值时 mutex 报告为空，但说明了跳过的原因
+	mutex := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+		Sample:     []*profile.Sample{{Location: cpu.Sample[0].Location, Value: []int64{5}}},
+	}
+	out, err := AnalyzeMutexProfile(mutex, 10, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfile() error = %v", err)
+	}
+	if !strings.Contains(out, "已跳过 1/1 个样本 (100.00%)：0 个没有调用栈，1 个缺少 contentions/delay 值。跳过的比例较高") {
+		t.Errorf("Mutex output missing skipped summary:\n%s", out)
+	}
+}
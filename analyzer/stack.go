@@ -0,0 +1,45 @@
+package analyzer
+
+import (
+	"regexp"
+
+	"github.com/google/pprof/profile"
+)
+
+// unknownFunction 是样本没有调用栈、或最顶层 location 没有带函数信息的行时使用的函数名
+const unknownFunction = "unknown"
+
+// topLine 返回样本最顶层 location 中第一个带函数信息的行 (有内联时为最内层的函数)。
+// 样本没有 location、最顶层 location 没有行信息或所有行的 Function 都为 nil 时返回 false，
+// 此时不会退而使用调用方的帧，避免把未符号化的叶子函数的开销算到调用方头上。
+func topLine(s *profile.Sample) (profile.Line, bool) {
+	if len(s.Location) == 0 || s.Location[0] == nil {
+		return profile.Line{}, false
+	}
+	for _, line := range s.Location[0].Line {
+		if line.Function != nil {
+			return line, true
+		}
+	}
+	return profile.Line{}, false
+}
+
+// topFunctionName 返回样本最顶层的函数名 (flat 值的归属)，无法确定时返回 unknownFunction
+func topFunctionName(s *profile.Sample) string {
+	if line, ok := topLine(s); ok {
+		return line.Function.Name
+	}
+	return unknownFunction
+}
+
+// sampleMatches 判断样本调用栈中是否有任意函数名匹配 re（包括内联帧）。
+func sampleMatches(s *profile.Sample, re *regexp.Regexp) bool {
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function != nil && re.MatchString(line.Function.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// degenerateSamples 返回三个调用栈不完整的样本：最顶层 location 没有行；最顶层的行 Function 为 nil (只有调用方帧有函数信息)；
+// 完全没有 location。前两个应归为 unknown，没有 location 的样本被跳过
+func degenerateSamples(values ...int64) []*profile.Sample {
+	caller := &profile.Location{ID: 3, Line: []profile.Line{{Function: &profile.Function{ID: 1, Name: "main.caller"}}}}
+	return []*profile.Sample{
+		{Location: []*profile.Location{{ID: 1}}, Value: values},
+		{Location: []*profile.Location{{ID: 2, Line: []profile.Line{{Line: 7}}}, caller}, Value: values},
+		{Location: nil, Value: values},
+	}
+}
+
+// TestTopFunctionName 测试最顶层 location 缺少函数信息时统一归为 unknown，而不是使用调用方的帧
+func TestTopFunctionName(t *testing.T) {
+	inlined := &profile.Function{Name: "main.inlined"}
+	outer := &profile.Function{Name: "main.outer"}
+	tests := []struct {
+		name   string
+		sample *profile.Sample
+		want   string
+	}{
+		{"no locations", &profile.Sample{}, unknownFunction},
+		{"no lines", &profile.Sample{Location: []*profile.Location{{}}}, unknownFunction},
+		{"nil function", &profile.Sample{Location: []*profile.Location{{Line: []profile.Line{{Line: 3}}}, {Line: []profile.Line{{Function: outer}}}}}, unknownFunction},
+		{"skips nil function line", &profile.Sample{Location: []*profile.Location{{Line: []profile.Line{{Line: 3}, {Function: outer}}}}}, "main.outer"},
+		{"inlined", &profile.Sample{Location: []*profile.Location{{Line: []profile.Line{{Function: inlined}, {Function: outer}}}}}, "main.inlined"},
+	}
+	for _, tt := range tests {
+		if got := topFunctionName(tt.sample); got != tt.want {
+			t.Errorf("%s: topFunctionName() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestAnalyzersWithDegenerateSamples 测试各分析器对没有行信息和没有 location 的样本处理一致：不会 panic，flat 值和 cum 值都归为 unknown
+func TestAnalyzersWithDegenerateSamples(t *testing.T) {
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	cpu := &profile.Profile{SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1, Sample: degenerateSamples(100)}
+	cpuResult, err := CPUProfileStats(cpu, 10, CPUAnalysisOptions{})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	if cpuResult.TotalValue != 200 || len(cpuResult.Functions) != 1 || cpuResult.Functions[0].FunctionName != unknownFunction ||
+		cpuResult.Functions[0].FlatValue != 200 || cpuResult.Functions[0].CumValue != 200 {
+		t.Errorf("CPU functions = %+v, want unknown with flat = cum = 200", cpuResult.Functions)
+	}
+	if cpuResult.SkippedSamples == nil || cpuResult.SkippedSamples.NoLocation != 1 {
+		t.Errorf("CPU skipped samples = %+v, want 1 without a call stack", cpuResult.SkippedSamples)
+	}
+	if _, err := FormatCPUResult(cpuResult, "text"); err != nil {
+		t.Errorf("FormatCPUResult() error = %v", err)
+	}
+
+	heap := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_objects", Unit: "count"}, {Type: "inuse_space", Unit: "bytes"}}, Sample: degenerateSamples(1, 64)}
+	heapResult, err := HeapProfileStats(heap, 10)
+	if err != nil {
+		t.Fatalf("HeapProfileStats() error = %v", err)
+	}
+	if len(heapResult.Functions) != 1 || heapResult.Functions[0].FunctionName != unknownFunction || heapResult.Functions[0].Value != 128 ||
+		len(heapResult.AllocationSites) != 1 || heapResult.AllocationSites[0].Value != 128 {
+		t.Errorf("Heap functions = %+v, sites = %+v, want unknown with 128 bytes", heapResult.Functions, heapResult.AllocationSites)
+	}
+
+	allocs := &profile.Profile{SampleType: []*profile.ValueType{{Type: "alloc_objects", Unit: "count"}, {Type: "alloc_space", Unit: "bytes"}}, Sample: degenerateSamples(1, 64)}
+	allocsResult, err := AllocsProfileStats(allocs, 10)
+	if err != nil {
+		t.Fatalf("AllocsProfileStats() error = %v", err)
+	}
+	if len(allocsResult.Functions) != 1 || allocsResult.Functions[0].FunctionName != unknownFunction {
+		t.Errorf("Allocs functions = %+v, want unknown", allocsResult.Functions)
+	}
+
+	contention := &profile.Profile{SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}, Sample: degenerateSamples(1, 1000)}
+	mutexResult, err := MutexProfileStats(contention, 10, PrimaryMetricDelay)
+	if err != nil {
+		t.Fatalf("MutexProfileStats() error = %v", err)
+	}
+	if len(mutexResult.Contentions) != 1 || mutexResult.Contentions[0].FunctionName != unknownFunction || mutexResult.Contentions[0].DelayNanos != 2000 {
+		t.Errorf("Mutex contentions = %+v, want unknown with 2000ns", mutexResult.Contentions)
+	}
+	blockResult, err := BlockProfileStats(contention, 10, PrimaryMetricDelay)
+	if err != nil {
+		t.Fatalf("BlockProfileStats() error = %v", err)
+	}
+	if len(blockResult.Blocks) != 1 || blockResult.Blocks[0].FunctionName != unknownFunction {
+		t.Errorf("Block blocks = %+v, want unknown", blockResult.Blocks)
+	}
+
+	goroutine := &profile.Profile{SampleType: []*profile.ValueType{{Type: "goroutine", Unit: "count"}}, Sample: degenerateSamples(5)}
+	if _, err := GoroutineProfileStats(goroutine, 10); err != nil {
+		t.Errorf("GoroutineProfileStats() error = %v", err)
+	}
+
+	values, _ := aggregateFunctionValues(cpu, 0)
+	if len(values) != 1 || values[unknownFunction] != 200 {
+		t.Errorf("aggregateFunctionValues() = %v, want unknown = 200", values)
+	}
+}
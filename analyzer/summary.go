@@ -0,0 +1,211 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// summaryTopContributors 是 summary 输出中列出的主要贡献者数量
+const summaryTopContributors = 3
+
+// summaryItem 是 summary 输出中的一个主要贡献者 (函数或调用栈)
+type summaryItem struct {
+	Name    string
+	Value   string
+	Percent float64
+}
+
+// resultSummary 是各 profile 类型的分析结果转换成的统一摘要，由 formatSummary 输出为一段话
+type resultSummary struct {
+	Subject    string        // 例如 "CPU profile" 或 "Heap profile (inuse_space)"
+	Total      string        // 总量的描述，例如 "1.20s of cpu in total"
+	Items      []summaryItem // 按占比降序排列的主要贡献者
+	Suggestion string        // 一条可以直接执行的建议
+}
+
+// formatSummary 将摘要输出为适合 LLM agent 阅读的一段话：总量、最多 summaryTopContributors 个主要贡献者及其占比，以及一条建议
+func formatSummary(s resultSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s.", s.Subject, s.Total)
+	items := s.Items
+	if len(items) > summaryTopContributors {
+		items = items[:summaryTopContributors]
+	}
+	if len(items) > 0 {
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = fmt.Sprintf("%s %.1f%% (%s)", sanitizeName(shortFunctionName(item.Name)), item.Percent, item.Value)
+		}
+		fmt.Fprintf(&b, " Top contributors: %s.", strings.Join(parts, ", "))
+	}
+	if s.Suggestion != "" {
+		fmt.Fprintf(&b, " Suggestion: %s", s.Suggestion)
+	}
+	return b.String() + "\n"
+}
+
+// summaryShare 返回前 summaryTopContributors 个贡献者的占比之和
+func summaryShare(items []summaryItem) float64 {
+	share := 0.0
+	for i, item := range items {
+		if i == summaryTopContributors {
+			break
+		}
+		share += item.Percent
+	}
+	return share
+}
+
+// gcFunctionPrefixes 是垃圾回收和内存分配相关的运行时函数，CPU 热点是它们时建议减少分配而不是优化业务函数
+var gcFunctionPrefixes = []string{"runtime.gcBgMarkWorker", "runtime.gcDrain", "runtime.scanobject", "runtime.markroot", "runtime.mallocgc", "runtime.gcAssist"}
+
+// isGCFunction 判断函数是否属于垃圾回收或内存分配
+func isGCFunction(name string) bool {
+	for _, prefix := range gcFunctionPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestionTarget 返回建议中指向的函数：第一个不属于 runtime 或 sync 包的贡献者，
+// 这些包的函数 (例如 runtime.mallocgc、sync.(*Mutex).Lock) 只是分配或等待发生的位置，需要修改的是调用它们的业务代码
+func suggestionTarget(items []summaryItem) string {
+	for _, item := range items {
+		if !strings.HasPrefix(item.Name, "runtime.") && !strings.HasPrefix(item.Name, "sync.") {
+			return shortFunctionName(item.Name)
+		}
+	}
+	return shortFunctionName(items[0].Name)
+}
+
+// cpuSummary 将 CPU 分析结果转换为摘要
+func cpuSummary(result *CPUAnalysisResult) resultSummary {
+	s := resultSummary{Subject: "CPU profile", Total: fmt.Sprintf("%s of %s in total", result.TotalValueFormatted, result.ValueType)}
+	for _, stat := range result.Functions {
+		s.Items = append(s.Items, summaryItem{Name: stat.displayName(), Value: stat.FlatValueFormatted, Percent: stat.Percentage})
+	}
+	switch {
+	case len(s.Items) == 0:
+		s.Suggestion = "the profile has no samples; capture it while the program is under load."
+	case isGCFunction(s.Items[0].Name):
+		s.Suggestion = "garbage collection dominates; reduce allocations (analyze the allocs profile) or tune GOGC/GOMEMLIMIT."
+	case summaryShare(s.Items) < 30:
+		s.Suggestion = fmt.Sprintf("no single function dominates (top %d = %.1f%%); use aggregate_by=package or analyze_flat_cumulative to find the expensive subsystem.",
+			min(len(s.Items), summaryTopContributors), summaryShare(s.Items))
+	default:
+		s.Suggestion = fmt.Sprintf("start with %s (%.1f%% of flat time); use root_function or generate_callgraph with focus to see what it calls.",
+			shortFunctionName(s.Items[0].Name), s.Items[0].Percent)
+	}
+	return s
+}
+
+// memorySummary 将 Heap 或 Allocs 分析结果转换为摘要，profileType 为 "heap" 或 "allocs"
+func memorySummary(profileType, valueType, totalFormatted string, functions []HeapFunctionStat) resultSummary {
+	subject := "Heap profile"
+	if profileType == "allocs" {
+		subject = "Allocs profile"
+	}
+	s := resultSummary{Subject: fmt.Sprintf("%s (%s)", subject, valueType), Total: totalFormatted + " in total"}
+	for _, stat := range functions {
+		s.Items = append(s.Items, summaryItem{Name: stat.FunctionName, Value: stat.ValueFormatted, Percent: stat.Percentage})
+	}
+	switch {
+	case len(s.Items) == 0:
+		s.Suggestion = "the profile has no allocations to act on."
+	case profileType == "heap" && !strings.HasPrefix(valueType, "alloc_"):
+		s.Suggestion = fmt.Sprintf("check what keeps the memory allocated in %s alive, and compare two heap profiles with detect_memory_leaks to see whether it keeps growing.",
+			suggestionTarget(s.Items))
+	default:
+		s.Suggestion = fmt.Sprintf("reduce allocations in %s, e.g. by preallocating slices or reusing buffers with sync.Pool; this also lowers GC CPU time.",
+			suggestionTarget(s.Items))
+	}
+	return s
+}
+
+// goroutineSummary 将 Goroutine 分析结果转换为摘要，以每个调用栈最顶层的函数代表该调用栈
+func goroutineSummary(result *GoroutineAnalysisResult) resultSummary {
+	s := resultSummary{Subject: "Goroutine profile", Total: fmt.Sprintf("%d goroutines in %d unique stacks", result.TotalGoroutines, result.UniqueStacks)}
+	for _, stat := range result.Stacks {
+		name := unknownFunction
+		if len(stat.StackTrace) > 0 {
+			name, _, _ = strings.Cut(stat.StackTrace[0], "\n")
+		}
+		s.Items = append(s.Items, summaryItem{Name: name, Value: fmt.Sprintf("%d goroutines", stat.Count), Percent: stat.Percentage})
+	}
+	if len(s.Items) == 0 {
+		s.Suggestion = "the profile has no goroutines to act on."
+		return s
+	}
+	s.Suggestion = fmt.Sprintf("the largest group (%.1f%%) is parked in %s; if the goroutine count keeps growing, compare two profiles with detect_goroutine_leaks.",
+		s.Items[0].Percent, shortFunctionName(s.Items[0].Name))
+	return s
+}
+
+// contentionEvent 返回 Mutex 或 Block 摘要中对竞争事件的称呼
+func contentionEvent(profileType string) string {
+	if profileType == "block" {
+		return "blocking events"
+	}
+	return "contentions"
+}
+
+// contentionItem 按主要指标 (次数或延迟) 生成 Mutex 或 Block 摘要中的一个贡献者
+func contentionItem(profileType, name string, count int64, countPct float64, delay string, delayPct float64, byContentions bool, numbers NumberFormatter) summaryItem {
+	if byContentions {
+		return summaryItem{Name: name, Value: numbers.Number(count) + " " + contentionEvent(profileType), Percent: countPct}
+	}
+	return summaryItem{Name: name, Value: delay, Percent: delayPct}
+}
+
+// contentionSummary 生成 Mutex 或 Block 的摘要，profileType 为 "mutex" 或 "block"
+func contentionSummary(profileType string, totalContentions int64, totalDelay string, items []summaryItem, numbers NumberFormatter) resultSummary {
+	subject := "Mutex profile"
+	if profileType == "block" {
+		subject = "Block profile"
+	}
+	s := resultSummary{
+		Subject: subject,
+		Total:   fmt.Sprintf("%s total delay over %s %s", totalDelay, numbers.Number(totalContentions), contentionEvent(profileType)),
+		Items:   items,
+	}
+	switch {
+	case totalContentions == 0 && profileType == "block":
+		s.Suggestion = "no blocking was recorded; block profiling is off by default, enable it with runtime.SetBlockProfileRate(1) and capture again."
+	case totalContentions == 0:
+		s.Suggestion = "no contention was recorded; mutex profiling is off by default, enable it with runtime.SetMutexProfileFraction(5) and capture again."
+	case len(items) == 0:
+	case profileType == "block":
+		s.Suggestion = fmt.Sprintf("most blocking happens under %s; check its channel, select and sync.WaitGroup usage for unnecessary blocking.", suggestionTarget(items))
+	default:
+		s.Suggestion = fmt.Sprintf("shorten the critical sections of the lock contended in %s, or shard the lock to reduce contention.", suggestionTarget(items))
+	}
+	return s
+}
+
+// mutexSummary 将 Mutex 分析结果转换为摘要
+func mutexSummary(result *MutexAnalysisResult) resultSummary {
+	byContentions := result.PrimaryMetric == PrimaryMetricContentions
+	var items []summaryItem
+	for i, stat := range result.Contentions {
+		if i == result.TopN {
+			break
+		}
+		items = append(items, contentionItem("mutex", stat.FunctionName, stat.Contentions, stat.ContentionsPct, stat.DelayFormatted, stat.DelayPct, byContentions, result.numbers))
+	}
+	return contentionSummary("mutex", result.TotalContentions, result.numbers.Nanos(result.TotalDelayNanos), items, result.numbers)
+}
+
+// blockSummary 将 Block 分析结果转换为摘要
+func blockSummary(result *BlockAnalysisResult) resultSummary {
+	byContentions := result.PrimaryMetric == PrimaryMetricContentions
+	var items []summaryItem
+	for i, stat := range result.Blocks {
+		if i == result.TopN {
+			break
+		}
+		items = append(items, contentionItem("block", stat.FunctionName, stat.Contentions, stat.ContentionsPct, stat.DelayFormatted, stat.DelayPct, byContentions, result.numbers))
+	}
+	return contentionSummary("block", result.TotalContentions, result.numbers.Nanos(result.TotalDelayNanos), items, result.numbers)
+}
@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestSummaryFormat 测试 summary 输出根据分析结果给出不同的建议
+func TestSummaryFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]int64
+		want   []string
+	}{
+		{
+			name:   "gc dominates",
+			values: map[string]int64{"runtime.gcBgMarkWorker": 600, "main.work": 300, "main.idle": 100},
+			want:   []string{"runtime.gcBgMarkWorker 60.0%", "garbage collection dominates"},
+		},
+		{
+			name:   "single hot function",
+			values: map[string]int64{"main.hot": 900, "main.cold": 100},
+			want:   []string{"Top contributors: main.hot 90.0%", "start with main.hot (90.0% of flat time)"},
+		},
+		{
+			name:   "flat profile",
+			values: map[string]int64{"main.a": 10, "main.b": 10, "main.c": 10, "main.d": 10, "main.e": 10, "main.f": 10, "main.g": 10, "main.h": 10, "main.i": 10, "main.j": 10, "main.k": 10, "main.l": 10},
+			want:   []string{"no single function dominates (top 3 = 25.0%)", "aggregate_by=package"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CPUProfileStats(newCPUProfile(tt.values), 10, CPUAnalysisOptions{})
+			if err != nil {
+				t.Fatalf("CPUProfileStats() error = %v", err)
+			}
+			got, err := FormatCPUResult(result, "summary")
+			if err != nil {
+				t.Fatalf("FormatCPUResult() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("summary missing %q:\n%s", want, got)
+				}
+			}
+			if strings.Count(got, "\n") != 1 {
+				t.Errorf("summary should be a single paragraph:\n%s", got)
+			}
+		})
+	}
+
+	// 空的 mutex profile 仍然输出摘要，并提示开启 mutex profiling
+	empty := &profile.Profile{SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}}
+	got, err := AnalyzeMutexProfile(empty, 10, "summary")
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfile() error = %v", err)
+	}
+	if !strings.HasPrefix(got, "Mutex profile: 0 ns total delay over 0 contentions.") || !strings.Contains(got, "runtime.SetMutexProfileFraction") {
+		t.Errorf("empty mutex summary = %q", got)
+	}
+}
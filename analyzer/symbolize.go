@@ -0,0 +1,241 @@
+package analyzer
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"debug/macho"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+// ErrBuildIDMismatch 表示用于符号化的二进制与 profile 记录的主程序不是同一次构建
+var ErrBuildIDMismatch = errors.New("binary build ID does not match the profile")
+
+// SymbolizeSummary 是使用本地二进制符号化 profile 的结果摘要
+type SymbolizeSummary struct {
+	BinaryPath      string
+	BuildID         string // 二进制的 GNU build ID (没有时为空)
+	BuildIDVerified bool   // profile 记录了主程序的 build ID，并且与二进制一致
+	Symbolized      int    // 成功符号化的 Location 数
+	Unresolved      int    // 地址不在二进制函数表中的 Location 数
+	CacheHits       int    // 从符号化缓存中直接得到结果的 Location 数
+}
+
+// String 返回用于工具附注的一行摘要
+func (s SymbolizeSummary) String() string {
+	line := fmt.Sprintf("已使用 %s 符号化 %d 个地址", s.BinaryPath, s.Symbolized)
+	if s.Unresolved > 0 {
+		line += fmt.Sprintf("，%d 个地址不在该二进制的函数表中", s.Unresolved)
+	}
+	if s.CacheHits > 0 {
+		line += fmt.Sprintf(" (其中 %d 个来自缓存)", s.CacheHits)
+	}
+	if !s.BuildIDVerified {
+		line += "。profile 没有记录主程序的 build ID，无法确认二进制与 profile 是否匹配，函数名可能不正确"
+	}
+	return line + "。"
+}
+
+// goBinary 是从本地 Go 二进制中读取的符号化所需信息
+type goBinary struct {
+	buildID  string
+	table    *gosym.Table
+	segments []binarySegment
+}
+
+// binarySegment 是二进制中一个加载段的文件偏移与虚拟地址范围
+type binarySegment struct {
+	off, filesz, vaddr uint64
+}
+
+// SymbolizeProfile 使用本地 Go 二进制 (ELF 或 Mach-O，需要包含 .gopclntab，strip 过的 Go 二进制也保留该表)
+// 为 profile 中主程序 Mapping 上没有符号信息的 Location 补全函数名、文件和行号，返回符号化后的副本。
+// profile 记录了主程序 build ID 而二进制的 build ID 不同时返回包装 ErrBuildIDMismatch 的错误。
+// 同一二进制的符号化结果保存在进程级缓存中，批量分析同一构建的多个 profile 时可以复用。
+// 内联的调用只解析到外层函数。
+func SymbolizeProfile(p *profile.Profile, binaryPath string) (*profile.Profile, SymbolizeSummary, error) {
+	summary := SymbolizeSummary{BinaryPath: binaryPath}
+	bin, err := openGoBinary(binaryPath)
+	if err != nil {
+		return nil, summary, err
+	}
+	summary.BuildID = bin.buildID
+
+	var mainMapping *profile.Mapping
+	if len(p.Mapping) > 0 {
+		mainMapping = p.Mapping[0]
+	}
+	if mainMapping != nil && mainMapping.BuildID != "" {
+		if mainMapping.BuildID != bin.buildID {
+			binaryID := bin.buildID
+			if binaryID == "" {
+				binaryID = "(none)"
+			}
+			return nil, summary, fmt.Errorf("%w: %s has build ID %s, but the profile's main binary %s has build ID %s",
+				ErrBuildIDMismatch, binaryPath, binaryID, mainMapping.File, mainMapping.BuildID)
+		}
+		summary.BuildIDVerified = true
+	}
+	logDebug("Symbolizing profile with %s (build ID %q, verified=%t)", binaryPath, bin.buildID, summary.BuildIDVerified)
+
+	out := p.Copy()
+	if len(out.Mapping) > 0 {
+		mainMapping = out.Mapping[0]
+	}
+	functions := make(map[symbolFrame]*profile.Function)
+	nextID := uint64(0)
+	for _, fn := range out.Function {
+		if fn.ID > nextID {
+			nextID = fn.ID
+		}
+	}
+	functionFor := func(f symbolFrame) *profile.Function {
+		key := symbolFrame{Function: f.Function, File: f.File}
+		if fn, ok := functions[key]; ok {
+			return fn
+		}
+		nextID++
+		fn := &profile.Function{ID: nextID, Name: f.Function, SystemName: f.Function, Filename: f.File}
+		functions[key] = fn
+		out.Function = append(out.Function, fn)
+		return fn
+	}
+
+	for _, loc := range out.Location {
+		// 只处理主程序中尚未符号化的地址，共享库等其他 Mapping 需要各自的二进制
+		if len(loc.Line) > 0 || loc.Address == 0 || (loc.Mapping != nil && loc.Mapping != mainMapping) {
+			continue
+		}
+		addr := bin.vaddr(loc.Mapping, loc.Address)
+		frames, ok := symbolizationCache.lookup(bin.buildID, addr)
+		if ok {
+			summary.CacheHits++
+		} else {
+			frames = bin.frames(addr)
+			symbolizationCache.store(bin.buildID, addr, frames)
+		}
+		if len(frames) == 0 {
+			summary.Unresolved++
+			continue
+		}
+		for _, f := range frames {
+			loc.Line = append(loc.Line, profile.Line{Function: functionFor(f), Line: f.Line})
+		}
+		summary.Symbolized++
+	}
+	if mainMapping != nil && summary.Symbolized > 0 {
+		mainMapping.HasFunctions, mainMapping.HasFilenames, mainMapping.HasLineNumbers = true, true, true
+	}
+	return out, summary, nil
+}
+
+// frames 返回二进制中 addr 对应的帧，地址不属于任何函数时返回 nil
+func (b *goBinary) frames(addr uint64) []symbolFrame {
+	file, line, fn := b.table.PCToLine(addr)
+	if fn == nil {
+		return nil
+	}
+	return []symbolFrame{{Function: fn.Name, File: file, Line: int64(line)}}
+}
+
+// vaddr 将 profile 中的运行时地址转换为二进制中的虚拟地址。没有 Mapping 信息时原样使用；
+// 否则按 Mapping 的加载地址和文件偏移换算，非 PIE 二进制得到的仍是原地址，PIE 二进制则去掉了加载基址。
+func (b *goBinary) vaddr(m *profile.Mapping, addr uint64) uint64 {
+	if m == nil || m.Start == 0 || addr < m.Start {
+		return addr
+	}
+	off := addr - m.Start + m.Offset
+	for _, seg := range b.segments {
+		if off >= seg.off && off < seg.off+seg.filesz {
+			return off - seg.off + seg.vaddr
+		}
+	}
+	return addr
+}
+
+// openGoBinary 读取 path 处 Go 二进制的 build ID、函数表和加载段
+func openGoBinary(path string) (*goBinary, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		return openELFBinary(path, f)
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		return openMachOBinary(path, f)
+	}
+	return nil, fmt.Errorf("failed to open binary '%s': not an ELF or Mach-O executable", path)
+}
+
+// openELFBinary 从 ELF 文件中读取符号化所需的信息
+func openELFBinary(path string, f *elf.File) (*goBinary, error) {
+	pclntab, text := f.Section(".gopclntab"), f.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, fmt.Errorf("binary '%s' has no .gopclntab section; only Go binaries can be used for symbolization", path)
+	}
+	table, err := newGoSymTable(path, pclntab.Data, text.Addr)
+	if err != nil {
+		return nil, err
+	}
+	bin := &goBinary{table: table}
+	if note := f.Section(".note.gnu.build-id"); note != nil {
+		if data, err := note.Data(); err == nil {
+			bin.buildID = gnuBuildID(data, f.ByteOrder)
+		}
+	}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD {
+			bin.segments = append(bin.segments, binarySegment{off: prog.Off, filesz: prog.Filesz, vaddr: prog.Vaddr})
+		}
+	}
+	return bin, nil
+}
+
+// openMachOBinary 从 Mach-O 文件中读取符号化所需的信息。macOS 上的 profile 不记录 build ID，因此不读取 LC_UUID
+func openMachOBinary(path string, f *macho.File) (*goBinary, error) {
+	pclntab, text := f.Section("__gopclntab"), f.Section("__text")
+	if pclntab == nil || text == nil {
+		return nil, fmt.Errorf("binary '%s' has no __gopclntab section; only Go binaries can be used for symbolization", path)
+	}
+	table, err := newGoSymTable(path, pclntab.Data, text.Addr)
+	if err != nil {
+		return nil, err
+	}
+	bin := &goBinary{table: table}
+	for _, load := range f.Loads {
+		if seg, ok := load.(*macho.Segment); ok && seg.Filesz > 0 {
+			bin.segments = append(bin.segments, binarySegment{off: seg.Offset, filesz: seg.Filesz, vaddr: seg.Addr})
+		}
+	}
+	return bin, nil
+}
+
+// newGoSymTable 从 pclntab 段的内容构建函数表
+func newGoSymTable(path string, data func() ([]byte, error), textAddr uint64) (*gosym.Table, error) {
+	pclntab, err := data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pclntab of '%s': %w", path, err)
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(pclntab, textAddr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pclntab of '%s': %w", path, err)
+	}
+	return table, nil
+}
+
+// gnuBuildID 从 .note.gnu.build-id 段中解析 GNU build ID，以十六进制返回 (与 runtime/pprof 记录的格式相同)
+func gnuBuildID(note []byte, order binary.ByteOrder) string {
+	const nameOffset = 12 // namesz、descsz、type 各 4 字节
+	if len(note) < nameOffset {
+		return ""
+	}
+	nameSize, descSize := order.Uint32(note[0:4]), order.Uint32(note[4:8])
+	descOffset := nameOffset + (uint64(nameSize)+3)&^3
+	if uint64(len(note)) < descOffset+uint64(descSize) {
+		return ""
+	}
+	return hex.EncodeToString(note[descOffset : descOffset+uint64(descSize)])
+}
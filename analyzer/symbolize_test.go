@@ -0,0 +1,67 @@
+package analyzer
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestSymbolizeProfile 测试使用本地二进制 (测试程序本身) 为只有地址的 profile 补全函数名，并在 build ID 不一致时返回 ErrBuildIDMismatch
+func TestSymbolizeProfile(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("symbolization test reads the running ELF test binary")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable() error = %v", err)
+	}
+	bin, err := openGoBinary(exe)
+	if err != nil {
+		t.Fatalf("openGoBinary() error = %v", err)
+	}
+
+	// 与 runtime/pprof 一样记录运行时地址和主程序的加载范围，不包含任何函数信息
+	pc := uint64(reflect.ValueOf(TestSymbolizeProfile).Pointer())
+	newProfile := func(buildID string) *profile.Profile {
+		mapping := &profile.Mapping{ID: 1, File: exe, BuildID: buildID}
+		if len(bin.segments) > 0 {
+			mapping.Start, mapping.Limit = bin.segments[0].vaddr, ^uint64(0)
+			mapping.Offset = bin.segments[0].off
+		}
+		loc := &profile.Location{ID: 1, Mapping: mapping, Address: pc}
+		return &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+			Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1, 10000000}}},
+			Mapping:    []*profile.Mapping{mapping},
+			Location:   []*profile.Location{loc},
+		}
+	}
+
+	original := newProfile(bin.buildID)
+	symbolized, summary, err := SymbolizeProfile(original, exe)
+	if err != nil {
+		t.Fatalf("SymbolizeProfile() error = %v", err)
+	}
+	lines := symbolized.Location[0].Line
+	want := "github.com/ZephyrDeng/pprof-analyzer-mcp/analyzer.TestSymbolizeProfile"
+	if len(lines) == 0 || lines[0].Function.Name != want || lines[0].Line == 0 {
+		t.Errorf("symbolized lines = %+v, want %s with a line number", lines, want)
+	}
+	if summary.Symbolized != 1 || summary.BuildIDVerified != (bin.buildID != "") {
+		t.Errorf("summary = %+v", summary)
+	}
+	if len(original.Location[0].Line) != 0 || len(original.Function) != 0 {
+		t.Errorf("SymbolizeProfile() modified the input profile")
+	}
+
+	if _, _, err := SymbolizeProfile(newProfile("deadbeef"), exe); !errors.Is(err, ErrBuildIDMismatch) {
+		t.Errorf("SymbolizeProfile(mismatched build ID) error = %v, want ErrBuildIDMismatch", err)
+	}
+	if _, _, err := SymbolizeProfile(newProfile(""), "testdata"); err == nil {
+		t.Errorf("SymbolizeProfile(non-binary path) error = nil, want an error")
+	}
+}
@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultSymbolCacheBytes 是进程级符号化缓存的默认内存上限 (近似值)
+const defaultSymbolCacheBytes = 64 << 20
+
+// symbolEntryOverhead 是每个缓存条目除字符串外的近似开销 (key、链表节点、map 槽位等)
+const symbolEntryOverhead = 96
+
+// symbolFrame 是一个地址符号化后得到的单个帧 (一个地址可能因内联对应多个帧)
+type symbolFrame struct {
+	Function string
+	File     string
+	Line     int64
+}
+
+// symbolKey 以 build ID 和地址唯一标识一次符号化结果
+type symbolKey struct {
+	buildID string
+	addr    uint64
+}
+
+// symbolEntry 是缓存中的一个条目
+type symbolEntry struct {
+	key    symbolKey
+	frames []symbolFrame
+	size   int64
+}
+
+// symbolCache 是按 build ID 区分的 地址 -> 函数 解析结果缓存，按近似内存占用做 LRU 淘汰。
+// 对同一构建产生的多个 profile 进行批量分析时，可以复用已经完成的符号化工作。
+type symbolCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[symbolKey]*list.Element
+	lru      *list.List // 前端为最近使用
+	hits     int64
+	misses   int64
+}
+
+// symbolizationCache 是进程级的符号化缓存，在多次工具调用之间共享
+var symbolizationCache = newSymbolCache(defaultSymbolCacheBytes)
+
+// newSymbolCache 创建一个内存上限约为 maxBytes 的符号化缓存
+func newSymbolCache(maxBytes int64) *symbolCache {
+	return &symbolCache{
+		maxBytes: maxBytes,
+		entries:  make(map[symbolKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// lookup 返回 buildID 对应二进制中 addr 的符号化结果。
+// build ID 为空时无法区分不同的二进制，因此总是返回未命中。
+func (c *symbolCache) lookup(buildID string, addr uint64) ([]symbolFrame, bool) {
+	if buildID == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[symbolKey{buildID, addr}]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*symbolEntry).frames, true
+}
+
+// store 记录 buildID 对应二进制中 addr 的符号化结果，超出内存上限时淘汰最久未使用的条目。
+func (c *symbolCache) store(buildID string, addr uint64, frames []symbolFrame) {
+	if buildID == "" {
+		return
+	}
+	entry := &symbolEntry{key: symbolKey{buildID, addr}, frames: frames, size: symbolEntrySize(buildID, frames)}
+	if entry.size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.key]; ok {
+		c.size -= elem.Value.(*symbolEntry).size
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[entry.key] = c.lru.PushFront(entry)
+	}
+	c.size += entry.size
+
+	for c.size > c.maxBytes {
+		oldest := c.lru.Back()
+		evicted := c.lru.Remove(oldest).(*symbolEntry)
+		delete(c.entries, evicted.key)
+		c.size -= evicted.size
+	}
+}
+
+// stats 返回缓存的命中次数、未命中次数和当前条目数
+func (c *symbolCache) stats() (hits, misses int64, entries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses, len(c.entries)
+}
+
+// symbolEntrySize 估算一个缓存条目占用的内存
+func symbolEntrySize(buildID string, frames []symbolFrame) int64 {
+	size := int64(symbolEntryOverhead + len(buildID))
+	for _, f := range frames {
+		size += int64(len(f.Function) + len(f.File) + 40)
+	}
+	return size
+}
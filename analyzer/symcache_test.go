@@ -0,0 +1,59 @@
+package analyzer
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestSymbolCache 测试符号化缓存的命中、build ID 隔离和按内存淘汰
+func TestSymbolCache(t *testing.T) {
+	frames := []symbolFrame{{Function: "main.work", File: "main.go", Line: 42}}
+	entrySize := symbolEntrySize("build-a", frames)
+	c := newSymbolCache(entrySize * 2)
+
+	c.store("build-a", 0x1000, frames)
+	got, ok := c.lookup("build-a", 0x1000)
+	if !ok || len(got) != 1 || got[0].Function != "main.work" {
+		t.Fatalf("Expected cached frames, got %v (ok=%t)", got, ok)
+	}
+	if _, ok := c.lookup("build-b", 0x1000); ok {
+		t.Error("Expected different build IDs to be cached separately")
+	}
+
+	// build ID 为空时不缓存
+	c.store("", 0x2000, frames)
+	if _, ok := c.lookup("", 0x2000); ok {
+		t.Error("Expected entries without build ID not to be cached")
+	}
+
+	// 超出内存上限时淘汰最久未使用的条目
+	c.store("build-a", 0x2000, frames)
+	c.lookup("build-a", 0x1000)
+	c.store("build-a", 0x3000, frames)
+	if _, ok := c.lookup("build-a", 0x2000); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if _, ok := c.lookup("build-a", 0x1000); !ok {
+		t.Error("Expected recently used entry to be kept")
+	}
+	if hits, misses, entries := c.stats(); entries != 2 || hits != 3 || misses != 2 {
+		t.Errorf("Unexpected stats: hits=%d misses=%d entries=%d", hits, misses, entries)
+	}
+}
+
+// TestSymbolCacheConcurrent 测试并发访问 (配合 -race 使用)
+func TestSymbolCacheConcurrent(t *testing.T) {
+	c := newSymbolCache(1 << 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for addr := uint64(0); addr < 100; addr++ {
+				c.store("build", addr, []symbolFrame{{Function: "f"}})
+				c.lookup("build", addr+uint64(i))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
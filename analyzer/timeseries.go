@@ -1,9 +1,10 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -13,44 +14,104 @@ import (
 
 // TimeSeriesData 表示单个时间点的数据
 type TimeSeriesData struct {
-	Timestamp   string  `json:"timestamp"`
-	Label       string  `json:"label"`
-	TotalBytes  int64   `json:"totalBytes"`
+	Timestamp    string `json:"timestamp"`
+	Label        string `json:"label"`
+	TotalBytes   int64  `json:"totalBytes"`
 	TotalObjects int64  `json:"totalObjects,omitempty"`
 }
 
 // TimeSeriesAnalysisResult 表示时序分析的结果
 type TimeSeriesAnalysisResult struct {
-	ProfileType   string            `json:"profileType"`
-	Series        []TimeSeriesData  `json:"series"`
-	Trends        []ObjectTrend     `json:"trends"`
-	Summary       TimeSeriesSummary  `json:"summary"`
+	ProfileType           string            `json:"profileType"`
+	Series                []TimeSeriesData  `json:"series"`
+	Trends                []ObjectTrend     `json:"trends"`
+	Summary               TimeSeriesSummary `json:"summary"`
+	AlertThresholdPercent float64           `json:"alertThresholdPercent"` // 告警所需的最小增长百分比 (见 TimeSeriesOptions)
+	Alerts                []TimeSeriesAlert `json:"alerts"`                // 增长超过阈值且在所有时间点上单调增长的对象类型
+}
+
+// TimeSeriesAlert 是告警列表中的一个对象类型：增长超过 alert 阈值，并且在所有时间点上单调增长
+type TimeSeriesAlert struct {
+	TypeName      string  `json:"typeName"`
+	GrowthBytes   int64   `json:"growthBytes"`
+	GrowthPercent float64 `json:"growthPercent"`
+	GrowthLabel   string  `json:"growthLabel"`
+	GrowthRate    float64 `json:"growthRate"` // MB per minute
+}
+
+// TimeSeriesOptions 定义时序分析的可选参数
+type TimeSeriesOptions struct {
+	// AlertThresholdPercent 是进入告警列表所需的最小增长百分比 (严格大于)，<= 0 时使用 defaultAlertThresholdPercent
+	AlertThresholdPercent float64
 }
 
 // ObjectTrend 表示单个对象类型随时间的变化趋势
 type ObjectTrend struct {
-	TypeName        string          `json:"typeName"`
-	Values          []int64         `json:"values"`
-	FormattedValues []string        `json:"formattedValues"`
-	GrowthBytes     int64           `json:"growthBytes"`
-	GrowthPercent   float64         `json:"growthPercent"`
-	GrowthRate      float64         `json:"growthRate"` // 每分钟增长率
-	TrendDirection  string          `json:"trendDirection"` // "increasing", "stable", "decreasing"
+	TypeName            string   `json:"typeName"`
+	Values              []int64  `json:"values"`
+	FormattedValues     []string `json:"formattedValues"`
+	GrowthBytes         int64    `json:"growthBytes"`
+	GrowthPercent       float64  `json:"growthPercent"`               // 已取整，并限制在 growthPercentCap 以内
+	GrowthLabel         string   `json:"growthLabel"`                 // 显示用的增长百分比，例如 "12.5%"、">999%"、"new"
+	GrowthRate          float64  `json:"growthRate"`                  // 每分钟增长率
+	TrendDirection      string   `json:"trendDirection"`              // "increasing", "stable", "decreasing"
+	Acceleration        float64  `json:"acceleration"`                // 加速度：每分钟增长量的变化 (MB/分钟²)，见 growthAcceleration
+	AccelerationTrend   string   `json:"accelerationTrend"`           // "accelerating", "linear", "decelerating"
+	Sawtooth            bool     `json:"sawtooth,omitempty"`          // 呈 GC 锯齿形波动 (上升后回落)，此时 TrendDirection 按谷值的增长判断
+	TroughGrowthBytes   int64    `json:"troughGrowthBytes,omitempty"` // 谷值拟合线在整段时间内的增长 (仅在 Sawtooth 时输出)
+	TroughGrowthRate    float64  `json:"troughGrowthRate,omitempty"`  // 谷值每分钟增长率 (MB/分钟，仅在 Sawtooth 时输出)
+	Amplitude           int64    `json:"amplitude,omitempty"`         // 平均每次回落的字节数 (仅在 Sawtooth 时输出)
+	GCChurn             bool     `json:"gcChurn,omitempty"`           // 锯齿形波动但谷值没有持续增长：更可能是正常的 GC 周期而不是泄漏
+	MonotonicIncreasing bool     `json:"monotonicIncreasing"`         // 每个时间点都不低于前一个时间点且整体有增长，而不只是最后一个点高于第一个点
 }
 
+const (
+	// growthPercentCap 是增长百分比的上限，超过时显示为 ">999%"，避免极小的初始值产生的巨大百分比主导排序
+	growthPercentCap = 999.0
+	// minGrowthBaseBytes 是判断加速度时平均增长率的下限 (字节/分钟)，避免接近 0 的增长率把微小变化放大为加速
+	minGrowthBaseBytes = 1024
+	// accelerationThreshold 是判定加速或减速增长所需的增长率相对变化：整段时间内每分钟增长量的变化超过平均增长率的 25% 时才算
+	accelerationThreshold = 0.25
+	// gcSwingRatio 是判定锯齿形波动所需的平均回落幅度占均值的最小比例，更小的回落视为噪声
+	gcSwingRatio = 0.1
+	// defaultAlertThresholdPercent 是未指定 AlertThresholdPercent 时进入告警列表所需的最小增长百分比
+	defaultAlertThresholdPercent = 20.0
+)
+
 // TimeSeriesSummary 提供时序分析的摘要
 type TimeSeriesSummary struct {
-	DataPoints      int     `json:"dataPoints"`
-	TimeSpanMinutes float64 `json:"timeSpanMinutes"`
-	TotalGrowth     int64   `json:"totalGrowth"`
-	AvgGrowthRate   float64 `json:"avgGrowthRate"` // MB per minute
-	GrowingObjects   int     `json:"growingObjects"`  // 持续增长的对象数量
-	StableObjects    int     `json:"stableObjects"`   // 稳定的对象数量
+	DataPoints          int     `json:"dataPoints"`
+	TimeSpanMinutes     float64 `json:"timeSpanMinutes"`
+	TotalGrowth         int64   `json:"totalGrowth"`
+	AvgGrowthRate       float64 `json:"avgGrowthRate"`              // MB per minute
+	TimestampSource     string  `json:"timestampSource"`            // "profile": 来自各 profile 的 TimeNanos；"estimated": 假设每个 profile 间隔 1 分钟
+	GrowingObjects      int     `json:"growingObjects"`             // 持续增长的对象数量
+	StableObjects       int     `json:"stableObjects"`              // 稳定的对象数量
+	AcceleratingObjects int     `json:"acceleratingObjects"`        // 加速增长的对象数量 (见 acceleratingTrends)
+	Sawtooth            bool    `json:"sawtooth,omitempty"`         // 总内存呈 GC 锯齿形波动
+	TroughGrowth        int64   `json:"troughGrowth,omitempty"`     // 总内存谷值拟合线在整段时间内的增长 (仅在 Sawtooth 时输出)
+	TroughGrowthRate    float64 `json:"troughGrowthRate,omitempty"` // 总内存谷值每分钟增长率 (MB/分钟，仅在 Sawtooth 时输出)
+	GCChurn             bool    `json:"gcChurn,omitempty"`          // 总内存锯齿形波动但谷值没有持续增长
+	GCChurnObjects      int     `json:"gcChurnObjects,omitempty"`   // 被判定为正常 GC 波动的对象类型数量
 }
 
 // AnalyzeHeapTimeSeries 分析多个 heap profile 的时序数据
 func AnalyzeHeapTimeSeries(profiles []*profile.Profile, labels []string, format string) (string, error) {
-	log.Printf("Analyzing heap time series: %d data points", len(profiles))
+	return AnalyzeHeapTimeSeriesWithOptions(profiles, labels, format, TimeSeriesOptions{})
+}
+
+// AnalyzeHeapTimeSeriesWithOptions 分析多个 heap profile 的时序数据，支持 TimeSeriesOptions 中的告警阈值
+func AnalyzeHeapTimeSeriesWithOptions(profiles []*profile.Profile, labels []string, format string, opts TimeSeriesOptions) (string, error) {
+	return AnalyzeHeapTimeSeriesContext(context.Background(), profiles, labels, format, opts)
+}
+
+// AnalyzeHeapTimeSeriesContext 与 AnalyzeHeapTimeSeriesWithOptions 相同，但在聚合各个 profile 的样本时定期检查 ctx，ctx 被取消时尽快停止
+func AnalyzeHeapTimeSeriesContext(ctx context.Context, profiles []*profile.Profile, labels []string, format string, opts TimeSeriesOptions) (string, error) {
+	alertThreshold := opts.AlertThresholdPercent
+	if alertThreshold <= 0 {
+		alertThreshold = defaultAlertThresholdPercent
+	}
+	logDebug("Analyzing heap time series: %d data points, alert threshold %.1f%%", len(profiles), alertThreshold)
 
 	if len(profiles) < 3 {
 		return "", fmt.Errorf("至少需要 3 个 profile 来进行时序分析，当前只有 %d 个", len(profiles))
@@ -60,25 +121,37 @@ func AnalyzeHeapTimeSeries(profiles []*profile.Profile, labels []string, format
 		return "", fmt.Errorf("标签数量 (%d) 与 profile 数量 (%d) 不匹配", len(labels), len(profiles))
 	}
 
+	// 采集时间优先取自 profile 的 TimeNanos，缺失时假设每个 profile 间隔 1 分钟
+	minutes, estimated := profileTimesMinutes(profiles)
+	if estimated {
+		logWarn("Some profiles lack increasing TimeNanos, assuming 1 minute between profiles")
+	}
+
 	// 1. 提取每个时间点的总体数据
-	series := extractTimeSeriesData(profiles, labels)
+	series, err := extractTimeSeriesData(ctx, profiles, labels, minutes, estimated)
+	if err != nil {
+		return "", err
+	}
 
 	// 2. 分析对象级别的趋势
-	trends, err := analyzeObjectTrends(profiles, labels)
+	trends, err := analyzeObjectTrends(ctx, profiles, labels, minutes)
 	if err != nil {
 		return "", fmt.Errorf("分析对象趋势失败: %w", err)
 	}
 
-	// 3. 计算摘要
-	summary := computeTimeSeriesSummary(series, trends)
+	// 3. 计算摘要和告警
+	summary := computeTimeSeriesSummary(series, trends, minutes, estimated)
+	alerts := growthAlerts(trends, alertThreshold)
 
 	// 4. 格式化输出
 	if format == "json" {
 		result := TimeSeriesAnalysisResult{
-			ProfileType: "heap",
-			Series:      series,
-			Trends:      trends,
-			Summary:     summary,
+			ProfileType:           "heap",
+			Series:                series,
+			Trends:                trends,
+			Summary:               summary,
+			AlertThresholdPercent: alertThreshold,
+			Alerts:                alerts,
 		}
 		jsonBytes, err := json.MarshalIndent(result, "", "  ")
 		if err != nil {
@@ -88,11 +161,12 @@ func AnalyzeHeapTimeSeries(profiles []*profile.Profile, labels []string, format
 	}
 
 	// Text/Markdown 输出
-	return formatTimeSeriesReport(series, trends, summary, format), nil
+	return formatTimeSeriesReport(series, trends, summary, alerts, alertThreshold, format), nil
 }
 
-// extractTimeSeriesData 提取时序数据
-func extractTimeSeriesData(profiles []*profile.Profile, labels []string) []TimeSeriesData {
+// extractTimeSeriesData 提取时序数据。minutes 是每个 profile 相对第一个 profile 的采集时间 (见 profileTimesMinutes)，
+// estimated 为 true 时时间戳以 "T+N分钟" 的相对形式给出。ctx 被取消时返回包装了 ctx.Err() 的错误。
+func extractTimeSeriesData(ctx context.Context, profiles []*profile.Profile, labels []string, minutes []float64, estimated bool) ([]TimeSeriesData, error) {
 	series := make([]TimeSeriesData, len(profiles))
 
 	for i, prof := range profiles {
@@ -111,7 +185,10 @@ func extractTimeSeriesData(profiles []*profile.Profile, labels []string) []TimeS
 		totalBytes := int64(0)
 		totalObjects := int64(0)
 
-		for _, sample := range prof.Sample {
+		for j, sample := range prof.Sample {
+			if err := checkCanceled(ctx, j); err != nil {
+				return nil, err
+			}
 			if valueIndex >= 0 && len(sample.Value) > valueIndex {
 				totalBytes += sample.Value[valueIndex]
 			}
@@ -120,8 +197,11 @@ func extractTimeSeriesData(profiles []*profile.Profile, labels []string) []TimeS
 			}
 		}
 
-		// 使用当前时间作为时间戳（实际应用中应该从 profile 元数据读取）
-		timestamp := time.Now().Add(time.Duration(i) * time.Minute).Format("2006-01-02 15:04:05")
+		// 使用 profile 的采集时间作为时间戳；缺少采集时间时只能给出估算的相对时间
+		timestamp := time.Unix(0, prof.TimeNanos).UTC().Format("2006-01-02 15:04:05")
+		if estimated {
+			timestamp = fmt.Sprintf("T+%.0f分钟 (估算)", minutes[i])
+		}
 
 		series[i] = TimeSeriesData{
 			Timestamp:    timestamp,
@@ -131,11 +211,13 @@ func extractTimeSeriesData(profiles []*profile.Profile, labels []string) []TimeS
 		}
 	}
 
-	return series
+	return series, nil
 }
 
-// analyzeObjectTrends 分析对象级别的趋势
-func analyzeObjectTrends(profiles []*profile.Profile, labels []string) ([]ObjectTrend, error) {
+// analyzeObjectTrends 分析对象级别的趋势，minutes 是每个 profile 相对第一个 profile 的采集时间 (见 profileTimesMinutes)。
+// ctx 被取消时返回包装了 ctx.Err() 的错误。
+func analyzeObjectTrends(ctx context.Context, profiles []*profile.Profile, labels []string, minutes []float64) ([]ObjectTrend, error) {
+	timeSpanMinutes := minutes[len(minutes)-1]
 	// 聚合每个时间点的对象类型数据
 	typeDataMap := make(map[string][]int64) // typeName -> []values
 
@@ -155,15 +237,18 @@ func analyzeObjectTrends(profiles []*profile.Profile, labels []string) ([]Object
 
 		// 按类型聚合
 		typeValues := make(map[string]int64)
-		for _, sample := range prof.Sample {
+		for j, sample := range prof.Sample {
+			if err := checkCanceled(ctx, j); err != nil {
+				return nil, err
+			}
 			if len(sample.Value) <= valueIndex {
 				continue
 			}
 
 			value := sample.Value[valueIndex]
 
-			// 获取对象类型（从 location 的 mapping 中获取）
-			typeName := getObjectTypeFromSample(sample)
+			// 以分配位置 (最顶层的函数) 作为对象类型
+			typeName := topFunctionName(sample)
 
 			typeValues[typeName] += value
 		}
@@ -189,105 +274,330 @@ func analyzeObjectTrends(profiles []*profile.Profile, labels []string) ([]Object
 		firstVal := values[0]
 		lastVal := values[len(values)-1]
 		growthBytes := lastVal - firstVal
-		growthPercent := 0.0
-		if firstVal > 0 {
-			growthPercent = float64(growthBytes) / float64(firstVal) * 100
-		}
+		growthPercent, growthLabel := growthPercentage(firstVal, growthBytes)
 
 		// 计算增长率（每分钟）
-		timePoints := len(values)
-		growthRate := float64(growthBytes) / float64(timePoints) / 1024 / 1024 // MB per minute
+		growthRate := 0.0
+		if timeSpanMinutes > 0 {
+			growthRate = float64(growthBytes) / timeSpanMinutes / 1024 / 1024 // MB per minute
+		}
 
-		// 判断趋势方向
-		trendDirection := "stable"
-		if growthPercent > 10 {
-			trendDirection = "increasing"
-		} else if growthPercent < -10 {
-			trendDirection = "decreasing"
+		// 判断趋势方向；锯齿形波动时首尾两点可能分别落在 GC 的波谷和波峰，改为按谷值的增长判断
+		trendDirection := trendDirectionFor(growthPercent)
+		fit := fitSawtooth(values, minutes)
+		if fit.Sawtooth {
+			troughPercent, _ := growthPercentage(fit.FirstTrough, fit.TroughGrowthBytes)
+			trendDirection = trendDirectionFor(troughPercent)
 		}
+		acceleration, accelerationTrend := growthAcceleration(values, minutes)
 
 		trends = append(trends, ObjectTrend{
-			TypeName:        typeName,
-			Values:          values,
-			FormattedValues: formattedValues,
-			GrowthBytes:     growthBytes,
-			GrowthPercent:   growthPercent,
-			GrowthRate:      growthRate,
-			TrendDirection:  trendDirection,
+			TypeName:            typeName,
+			Values:              values,
+			FormattedValues:     formattedValues,
+			GrowthBytes:         growthBytes,
+			GrowthPercent:       growthPercent,
+			GrowthLabel:         growthLabel,
+			GrowthRate:          growthRate,
+			TrendDirection:      trendDirection,
+			Acceleration:        acceleration,
+			AccelerationTrend:   accelerationTrend,
+			Sawtooth:            fit.Sawtooth,
+			TroughGrowthBytes:   fit.TroughGrowthBytes,
+			TroughGrowthRate:    fit.TroughGrowthRate / 1024 / 1024,
+			Amplitude:           fit.Amplitude,
+			GCChurn:             fit.Sawtooth && trendDirection != "increasing",
+			MonotonicIncreasing: isMonotonicIncreasing(values),
 		})
 	}
 
-	// 按增长率排序
+	// 按增长百分比排序，百分比相同 (例如都达到上限) 时按增长的字节数排序
 	sort.Slice(trends, func(i, j int) bool {
-		return trends[i].GrowthPercent > trends[j].GrowthPercent
+		if trends[i].GrowthPercent != trends[j].GrowthPercent {
+			return trends[i].GrowthPercent > trends[j].GrowthPercent
+		}
+		if trends[i].GrowthBytes != trends[j].GrowthBytes {
+			return trends[i].GrowthBytes > trends[j].GrowthBytes
+		}
+		return trends[i].TypeName < trends[j].TypeName
 	})
 
 	return trends, nil
 }
 
-// getObjectTypeFromSample 从样本中获取对象类型
-func getObjectTypeFromSample(sample *profile.Sample) string {
-	// 尝试从 location 的 mapping 中获取对象类型
-	for _, loc := range sample.Location {
-		for _, line := range loc.Line {
-			if line.Function != nil {
-				// 使用函数名作为类型标识
-				return line.Function.Name
-			}
+// trendDirectionFor 按增长百分比判断趋势方向：超过 ±10% 为 increasing/decreasing，否则为 stable
+func trendDirectionFor(growthPercent float64) string {
+	if growthPercent > 10 {
+		return "increasing"
+	} else if growthPercent < -10 {
+		return "decreasing"
+	}
+	return "stable"
+}
+
+// sawtoothFit 是 fitSawtooth 对一组时序值的锯齿形 (GC 周期) 检测结果
+type sawtoothFit struct {
+	Sawtooth          bool
+	FirstTrough       int64   // 第一个谷值
+	TroughGrowthBytes int64   // 谷值拟合线从第一个到最后一个 profile 的增长
+	TroughGrowthRate  float64 // 谷值拟合线的斜率 (bytes/分钟)
+	Amplitude         int64   // 平均每次回落的字节数
+}
+
+// fitSawtooth 检测 values 是否呈 GC 锯齿形波动：取局部最小值 (不高于相邻点的点) 作为谷值，
+// 至少有 2 个谷值且平均回落幅度不低于均值的 gcSwingRatio 时判定为锯齿形，并对谷值按采集时间做最小二乘拟合。
+// 健康的 heap 随 GC 起落，谷值基本持平；真正的泄漏表现为谷值线持续上升。
+func fitSawtooth(values []int64, minutes []float64) sawtoothFit {
+	if len(values) < 3 || len(minutes) != len(values) {
+		return sawtoothFit{}
+	}
+	var troughs []int
+	var drops, dropBytes, sum int64
+	for i, v := range values {
+		sum += v
+		if (i == 0 || v <= values[i-1]) && (i == len(values)-1 || v <= values[i+1]) {
+			troughs = append(troughs, i)
+		}
+		if i > 0 && v < values[i-1] {
+			drops++
+			dropBytes += values[i-1] - v
+		}
+	}
+	if len(troughs) < 2 || drops == 0 {
+		return sawtoothFit{}
+	}
+	amplitude := dropBytes / drops
+	if float64(amplitude) < gcSwingRatio*float64(sum)/float64(len(values)) {
+		return sawtoothFit{}
+	}
+
+	meanT, meanV := 0.0, 0.0
+	for _, i := range troughs {
+		meanT += minutes[i]
+		meanV += float64(values[i])
+	}
+	meanT /= float64(len(troughs))
+	meanV /= float64(len(troughs))
+	cov, varT := 0.0, 0.0
+	for _, i := range troughs {
+		cov += (minutes[i] - meanT) * (float64(values[i]) - meanV)
+		varT += (minutes[i] - meanT) * (minutes[i] - meanT)
+	}
+	slope := 0.0
+	if varT > 0 {
+		slope = cov / varT
+	}
+	return sawtoothFit{
+		Sawtooth:          true,
+		FirstTrough:       values[troughs[0]],
+		TroughGrowthBytes: int64(slope * (minutes[len(minutes)-1] - minutes[0])),
+		TroughGrowthRate:  slope,
+		Amplitude:         amplitude,
+	}
+}
+
+// growthAcceleration 计算 values 的二阶差分：先算出相邻两个 profile 之间每分钟的增长量，再按区间中点对这些增长率做最小二乘拟合，
+// 斜率即加速度 (MB/分钟²)。整段时间内增长率的变化超过平均增长率 (至少按 minGrowthBaseBytes/分钟计) 的 accelerationThreshold 倍时
+// 判定为 accelerating 或 decelerating，否则为 linear。少于 3 个数据点时无法计算，返回 0 和 linear。
+func growthAcceleration(values []int64, minutes []float64) (float64, string) {
+	if len(values) < 3 || len(minutes) != len(values) {
+		return 0, "linear"
+	}
+	rates := make([]float64, 0, len(values)-1) // bytes/分钟
+	mids := make([]float64, 0, len(values)-1)
+	for i := 0; i+1 < len(values); i++ {
+		if dt := minutes[i+1] - minutes[i]; dt > 0 {
+			rates = append(rates, float64(values[i+1]-values[i])/dt)
+			mids = append(mids, (minutes[i]+minutes[i+1])/2)
+		}
+	}
+	if len(rates) < 2 {
+		return 0, "linear"
+	}
+
+	meanMid, meanRate := 0.0, 0.0
+	for i := range rates {
+		meanMid += mids[i]
+		meanRate += rates[i]
+	}
+	meanMid /= float64(len(rates))
+	meanRate /= float64(len(rates))
+	cov, varMid := 0.0, 0.0
+	for i := range rates {
+		cov += (mids[i] - meanMid) * (rates[i] - meanRate)
+		varMid += (mids[i] - meanMid) * (mids[i] - meanMid)
+	}
+	acceleration := cov / varMid // bytes/分钟²
+
+	rateChange := acceleration * (mids[len(mids)-1] - mids[0])
+	base := math.Max(math.Abs(meanRate), minGrowthBaseBytes)
+	trend := "linear"
+	if rateChange > accelerationThreshold*base {
+		trend = "accelerating"
+	} else if rateChange < -accelerationThreshold*base {
+		trend = "decelerating"
+	}
+	return acceleration / 1024 / 1024, trend
+}
+
+// isMonotonicIncreasing 判断 values 是否在所有时间点上单调增长：每个值都不低于前一个值，且最后一个值高于第一个值。
+// 只有一次尖峰 (升高后回落) 的序列即使首尾两点相差很大也不算单调增长。
+func isMonotonicIncreasing(values []int64) bool {
+	for i := 1; i < len(values); i++ {
+		if values[i] < values[i-1] {
+			return false
+		}
+	}
+	return len(values) > 1 && values[len(values)-1] > values[0]
+}
+
+// growthAlerts 返回增长百分比超过 thresholdPercent 且单调增长的对象类型，顺序与 trends 相同 (按增长百分比降序)
+func growthAlerts(trends []ObjectTrend, thresholdPercent float64) []TimeSeriesAlert {
+	alerts := []TimeSeriesAlert{}
+	for _, trend := range trends {
+		if trend.MonotonicIncreasing && trend.GrowthPercent > thresholdPercent {
+			alerts = append(alerts, TimeSeriesAlert{
+				TypeName:      trend.TypeName,
+				GrowthBytes:   trend.GrowthBytes,
+				GrowthPercent: trend.GrowthPercent,
+				GrowthLabel:   trend.GrowthLabel,
+				GrowthRate:    trend.GrowthRate,
+			})
+		}
+	}
+	return alerts
+}
+
+// acceleratingTrends 返回持续增长且增长在加速的对象类型 (可能是复合型泄漏)，按加速度从大到小排序
+func acceleratingTrends(trends []ObjectTrend) []ObjectTrend {
+	var accelerating []ObjectTrend
+	for _, trend := range trends {
+		if trend.AccelerationTrend == "accelerating" && trend.GrowthBytes > 0 && !trend.GCChurn {
+			accelerating = append(accelerating, trend)
 		}
 	}
-	return "unknown"
+	sort.SliceStable(accelerating, func(i, j int) bool {
+		return accelerating[i].Acceleration > accelerating[j].Acceleration
+	})
+	return accelerating
+}
+
+// growthPercentage 计算取整后的增长百分比及其显示文本。
+// 只有初始值为 0 且出现增长时才视为新类型 ("new")，初始值很小的类型照常计算百分比，超过上限时显示为 ">999%"；
+// 绝对值小于 10% 的百分比保留 1 位小数，其余取整。
+func growthPercentage(firstVal, growthBytes int64) (float64, string) {
+	if firstVal == 0 && growthBytes > 0 {
+		return growthPercentCap, "new"
+	}
+	if firstVal <= 0 {
+		return 0, "0%"
+	}
+	percent := float64(growthBytes) / float64(firstVal) * 100
+	if percent > growthPercentCap {
+		return growthPercentCap, fmt.Sprintf(">%.0f%%", growthPercentCap)
+	}
+	if math.Abs(percent) < 10 {
+		percent = math.Round(percent*10) / 10
+		return percent, fmt.Sprintf("%.1f%%", percent)
+	}
+	percent = math.Round(percent)
+	return percent, fmt.Sprintf("%.0f%%", percent)
 }
 
-// computeTimeSeriesSummary 计算时序摘要
-func computeTimeSeriesSummary(series []TimeSeriesData, trends []ObjectTrend) TimeSeriesSummary {
+// computeTimeSeriesSummary 计算时序摘要，minutes 为每个 profile 相对第一个 profile 的实际 (或估算的) 采集时间
+func computeTimeSeriesSummary(series []TimeSeriesData, trends []ObjectTrend, minutes []float64, estimated bool) TimeSeriesSummary {
+	timeSpanMinutes := minutes[len(minutes)-1]
+	timestampSource := "profile"
+	if estimated {
+		timestampSource = "estimated"
+	}
 	if len(series) < 2 {
 		return TimeSeriesSummary{
-			DataPoints: len(series),
+			DataPoints:      len(series),
+			TimestampSource: timestampSource,
 		}
 	}
 
-	// 计算时间跨度（假设每个点间隔 1 分钟，实际应该从时间戳计算）
-	timeSpanMinutes := float64(len(series) - 1)
-
 	// 计算总增长
 	totalGrowth := series[len(series)-1].TotalBytes - series[0].TotalBytes
 
 	// 计算平均增长率
-	avgGrowthRate := float64(totalGrowth) / timeSpanMinutes / 1024 / 1024 // MB per minute
+	avgGrowthRate := 0.0
+	if timeSpanMinutes > 0 {
+		avgGrowthRate = float64(totalGrowth) / timeSpanMinutes / 1024 / 1024 // MB per minute
+	}
 
 	// 统计趋势方向
 	growing := 0
 	stable := 0
+	gcChurn := 0
 	for _, trend := range trends {
 		if trend.TrendDirection == "increasing" {
 			growing++
 		} else if trend.TrendDirection == "stable" || trend.TrendDirection == "decreasing" {
 			stable++
 		}
+		if trend.GCChurn {
+			gcChurn++
+		}
+	}
+
+	// 总内存的锯齿形检测：泄漏判断基于谷值的增长，而不是首尾两点
+	totals := make([]int64, len(series))
+	for i, data := range series {
+		totals[i] = data.TotalBytes
 	}
+	fit := fitSawtooth(totals, minutes)
+	troughPercent, _ := growthPercentage(fit.FirstTrough, fit.TroughGrowthBytes)
 
 	return TimeSeriesSummary{
-		DataPoints:      len(series),
-		TimeSpanMinutes: timeSpanMinutes,
-		TotalGrowth:     totalGrowth,
-		AvgGrowthRate:   avgGrowthRate,
-		GrowingObjects:  growing,
-		StableObjects:   stable,
+		DataPoints:          len(series),
+		TimeSpanMinutes:     timeSpanMinutes,
+		TotalGrowth:         totalGrowth,
+		AvgGrowthRate:       avgGrowthRate,
+		TimestampSource:     timestampSource,
+		GrowingObjects:      growing,
+		StableObjects:       stable,
+		AcceleratingObjects: len(acceleratingTrends(trends)),
+		Sawtooth:            fit.Sawtooth,
+		TroughGrowth:        fit.TroughGrowthBytes,
+		TroughGrowthRate:    fit.TroughGrowthRate / 1024 / 1024,
+		GCChurn:             fit.Sawtooth && trendDirectionFor(troughPercent) != "increasing",
+		GCChurnObjects:      gcChurn,
+	}
+}
+
+// sawtoothVerdict 说明锯齿形波动的总内存是正常的 GC 周期还是谷值在上升的泄漏
+func sawtoothVerdict(gcChurn bool) string {
+	if gcChurn {
+		return "总内存呈 GC 锯齿形波动，谷值没有持续上升，更可能是正常的 GC 周期"
 	}
+	return "总内存呈 GC 锯齿形波动，且谷值持续上升，疑似泄漏"
+}
+
+// timestampSourceNote 说明时间跨度的来源
+func timestampSourceNote(summary TimeSeriesSummary) string {
+	if summary.TimestampSource == "estimated" {
+		return " (部分 profile 缺少采集时间，按每个 profile 间隔 1 分钟估算)"
+	}
+	return " (根据 profile 的采集时间计算)"
 }
 
 // formatTimeSeriesReport 格式化时序分析报告
-func formatTimeSeriesReport(series []TimeSeriesData, trends []ObjectTrend, summary TimeSeriesSummary, format string) string {
+func formatTimeSeriesReport(series []TimeSeriesData, trends []ObjectTrend, summary TimeSeriesSummary, alerts []TimeSeriesAlert, alertThreshold float64, format string) string {
 	var b strings.Builder
 
 	if format == "markdown" {
 		b.WriteString("# 内存时序分析报告\n\n")
 		b.WriteString("## 概述\n\n")
 		b.WriteString(fmt.Sprintf("- **数据点数**: %d\n", summary.DataPoints))
-		b.WriteString(fmt.Sprintf("- **时间跨度**: %.0f 分钟\n", summary.TimeSpanMinutes))
+		b.WriteString(fmt.Sprintf("- **时间跨度**: %.1f 分钟%s\n", summary.TimeSpanMinutes, timestampSourceNote(summary)))
 		b.WriteString(fmt.Sprintf("- **总内存增长**: %s\n", FormatBytes(summary.TotalGrowth)))
-		b.WriteString(fmt.Sprintf("- **平均增长率**: %.2f MB/分钟\n\n", summary.AvgGrowthRate))
+		b.WriteString(fmt.Sprintf("- **平均增长率**: %.2f MB/分钟\n", summary.AvgGrowthRate))
+		if summary.Sawtooth {
+			b.WriteString(fmt.Sprintf("- **谷值增长率**: %.2f MB/分钟 (%s)\n", summary.TroughGrowthRate, sawtoothVerdict(summary.GCChurn)))
+		}
+		b.WriteString("\n")
 
 		b.WriteString("## 时序数据\n\n")
 		b.WriteString("| 时间点 | 标签 | 总内存 | 对象数 |\n")
@@ -297,6 +607,9 @@ func formatTimeSeriesReport(series []TimeSeriesData, trends []ObjectTrend, summa
 				data.Timestamp, data.Label, FormatBytes(data.TotalBytes), data.TotalObjects))
 		}
 
+		writeGrowthAlerts(&b, alerts, alertThreshold, format)
+		writeAcceleratingTrends(&b, trends, format)
+
 		b.WriteString("\n## Top 增长对象类型\n\n")
 		b.WriteString("| 对象类型 | 初始值 | 最终值 | 增长 | 增长率 | 趋势 |\n")
 		b.WriteString("|----------|--------|--------|------|--------|------|\n")
@@ -305,9 +618,13 @@ func formatTimeSeriesReport(series []TimeSeriesData, trends []ObjectTrend, summa
 		b.WriteString("==================\n\n")
 		b.WriteString("概述:\n")
 		b.WriteString(fmt.Sprintf("  数据点数: %d\n", summary.DataPoints))
-		b.WriteString(fmt.Sprintf("  时间跨度: %.0f 分钟\n", summary.TimeSpanMinutes))
+		b.WriteString(fmt.Sprintf("  时间跨度: %.1f 分钟%s\n", summary.TimeSpanMinutes, timestampSourceNote(summary)))
 		b.WriteString(fmt.Sprintf("  总内存增长: %s\n", FormatBytes(summary.TotalGrowth)))
-		b.WriteString(fmt.Sprintf("  平均增长率: %.2f MB/分钟\n\n", summary.AvgGrowthRate))
+		b.WriteString(fmt.Sprintf("  平均增长率: %.2f MB/分钟\n", summary.AvgGrowthRate))
+		if summary.Sawtooth {
+			b.WriteString(fmt.Sprintf("  谷值增长率: %.2f MB/分钟 (%s)\n", summary.TroughGrowthRate, sawtoothVerdict(summary.GCChurn)))
+		}
+		b.WriteString("\n")
 
 		b.WriteString("时序数据:\n")
 		for _, data := range series {
@@ -315,6 +632,9 @@ func formatTimeSeriesReport(series []TimeSeriesData, trends []ObjectTrend, summa
 				data.Timestamp, data.Label, FormatBytes(data.TotalBytes), data.TotalObjects))
 		}
 
+		writeGrowthAlerts(&b, alerts, alertThreshold, format)
+		writeAcceleratingTrends(&b, trends, format)
+
 		b.WriteString("\nTop 增长对象类型:\n")
 		b.WriteString(strings.Repeat("-", 120) + "\n")
 		b.WriteString(fmt.Sprintf("%-30s %15s %15s %12s %10s %10s\n",
@@ -336,33 +656,58 @@ func formatTimeSeriesReport(series []TimeSeriesData, trends []ObjectTrend, summa
 		} else if trend.TrendDirection == "stable" {
 			trendIndicator = "➡️"
 		}
+		if trend.GCChurn {
+			trendIndicator = "♻️"
+		}
 
 		if format == "markdown" {
-			b.WriteString(fmt.Sprintf("| %s `%s` | %s | %s | %s | %.1f%% | %s %s |\n",
+			b.WriteString(fmt.Sprintf("| %s `%s` | %s | %s | %s | %s | %s %s |\n",
 				trendIndicator,
 				truncateString(trend.TypeName, 25),
 				trend.FormattedValues[0],
 				trend.FormattedValues[len(trend.FormattedValues)-1],
 				FormatBytes(trend.GrowthBytes),
-				trend.GrowthPercent,
+				trend.GrowthLabel,
 				trend.TrendDirection,
 				trendIndicator,
 			))
 		} else {
-			b.WriteString(fmt.Sprintf("%-30s %15s %15s %12s %9.1f%% %10s %s\n",
+			b.WriteString(fmt.Sprintf("%-30s %15s %15s %12s %10s %10s %s\n",
 				truncateString(trend.TypeName, 30),
 				trend.FormattedValues[0],
 				trend.FormattedValues[len(trend.FormattedValues)-1],
 				FormatBytes(trend.GrowthBytes),
-				trend.GrowthPercent,
+				trend.GrowthLabel,
 				trend.TrendDirection,
 				trendIndicator,
 			))
 		}
 	}
 
+	var churnTypes []string
+	for _, trend := range trends {
+		if trend.GCChurn {
+			churnTypes = append(churnTypes, trend.TypeName)
+		}
+	}
+	if len(churnTypes) > 0 {
+		if len(churnTypes) > 10 {
+			churnTypes = append(churnTypes[:10], "...")
+		}
+		b.WriteString(fmt.Sprintf("\n♻️ 以下类型随 GC 起落但谷值没有持续上升，更可能是正常的 GC 周期而不是泄漏: %s\n", strings.Join(churnTypes, ", ")))
+	}
+
 	b.WriteString("\n**建议**:\n")
+	if len(alerts) > 0 {
+		b.WriteString("- 告警列表中的对象类型在每个时间点都在增长，比只看首尾两点更可靠，应首先排查\n")
+	}
+	if summary.AcceleratingObjects > 0 {
+		b.WriteString("- 优先排查加速增长的对象类型：增长率本身在上升，通常比匀速增长的泄漏更快耗尽内存\n")
+	}
 	b.WriteString("- 关注增长率为正且增长率较高的对象类型\n")
+	if summary.Sawtooth || summary.GCChurnObjects > 0 {
+		b.WriteString("- 锯齿形波动的序列以谷值 (每次 GC 后的低点) 判断是否泄漏：谷值线持续上升才是泄漏，首尾两点可能恰好落在 GC 的波谷和波峰\n")
+	}
 	b.WriteString("- 检查是否有内存泄漏（持续增长的类型）\n")
 	b.WriteString("- 优化高频分配的对象类型\n")
 
@@ -372,3 +717,80 @@ func formatTimeSeriesReport(series []TimeSeriesData, trends []ObjectTrend, summa
 
 	return b.String()
 }
+
+// writeGrowthAlerts 在报告中列出告警的对象类型 (最多 10 个)，没有时只说明没有告警
+func writeGrowthAlerts(b *strings.Builder, alerts []TimeSeriesAlert, threshold float64, format string) {
+	shown := alerts
+	if len(shown) > 10 {
+		shown = shown[:10]
+	}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("\n## 🚨 告警 (增长超过 %.1f%% 且在所有时间点上单调增长)\n\n", threshold))
+		if len(shown) == 0 {
+			b.WriteString("无\n")
+			return
+		}
+		b.WriteString("| 对象类型 | 增长 | 增长百分比 | 增长率 |\n")
+		b.WriteString("|----------|------|------------|--------|\n")
+		for _, alert := range shown {
+			b.WriteString(fmt.Sprintf("| `%s` | %s | %s | %.2f MB/分钟 |\n",
+				truncateString(alert.TypeName, 25), FormatBytes(alert.GrowthBytes), alert.GrowthLabel, alert.GrowthRate))
+		}
+	} else {
+		b.WriteString(fmt.Sprintf("\n告警 (增长超过 %.1f%% 且在所有时间点上单调增长):\n", threshold))
+		if len(shown) == 0 {
+			b.WriteString("  无\n")
+			return
+		}
+		for _, alert := range shown {
+			b.WriteString(fmt.Sprintf("  %-30s +%s (%s), %.2f MB/分钟\n",
+				truncateString(alert.TypeName, 30), FormatBytes(alert.GrowthBytes), alert.GrowthLabel, alert.GrowthRate))
+		}
+	}
+	if len(alerts) > len(shown) {
+		indent := "  "
+		if format == "markdown" {
+			indent = "\n"
+		}
+		b.WriteString(fmt.Sprintf("%s另有 %d 个告警未列出\n", indent, len(alerts)-len(shown)))
+	}
+}
+
+// writeAcceleratingTrends 在报告中单独列出加速增长的对象类型 (最多 10 个)，没有时不输出
+func writeAcceleratingTrends(b *strings.Builder, trends []ObjectTrend, format string) {
+	accelerating := acceleratingTrends(trends)
+	if len(accelerating) == 0 {
+		return
+	}
+	if len(accelerating) > 10 {
+		accelerating = accelerating[:10]
+	}
+
+	if format == "markdown" {
+		b.WriteString("\n## 加速增长的对象类型\n\n")
+		b.WriteString("| 对象类型 | 初始值 | 最终值 | 增长率 | 加速度 |\n")
+		b.WriteString("|----------|--------|--------|--------|--------|\n")
+		for _, trend := range accelerating {
+			b.WriteString(fmt.Sprintf("| `%s` | %s | %s | %.2f MB/分钟 | %.3f MB/分钟² |\n",
+				truncateString(trend.TypeName, 25),
+				trend.FormattedValues[0],
+				trend.FormattedValues[len(trend.FormattedValues)-1],
+				trend.GrowthRate,
+				trend.Acceleration,
+			))
+		}
+		return
+	}
+
+	b.WriteString("\n加速增长的对象类型 (增长率持续上升，可能是复合型泄漏):\n")
+	for _, trend := range accelerating {
+		b.WriteString(fmt.Sprintf("  %-30s %s -> %s, %.2f MB/分钟, 加速度 %.3f MB/分钟²\n",
+			truncateString(trend.TypeName, 30),
+			trend.FormattedValues[0],
+			trend.FormattedValues[len(trend.FormattedValues)-1],
+			trend.GrowthRate,
+			trend.Acceleration,
+		))
+	}
+}
@@ -1,7 +1,12 @@
 package analyzer
 
 import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/pprof/profile"
 )
@@ -267,3 +272,267 @@ func TestAnalyzeHeapTimeSeriesMultipleTypes(t *testing.T) {
 		t.Error("Result should show growth rate")
 	}
 }
+
+// TestAnalyzeHeapTimeSeriesTimestamps 测试按 profile 的 TimeNanos 计算时间跨度和增长率
+func TestAnalyzeHeapTimeSeriesTimestamps(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newProfile := func(offset time.Duration, mb int64) *profile.Profile {
+		p := &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}},
+			Sample: []*profile.Sample{{
+				Value:    []int64{mb * 1024 * 1024},
+				Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: "main.cache"}}}}},
+			}},
+		}
+		if offset >= 0 {
+			p.TimeNanos = start.Add(offset).UnixNano()
+		}
+		return p
+	}
+	labels := []string{"a", "b", "c"}
+
+	// 间隔不均匀：0、2、10 分钟，共增长 20MB -> 2 MB/分钟
+	profiles := []*profile.Profile{newProfile(0, 10), newProfile(2*time.Minute, 12), newProfile(10*time.Minute, 30)}
+	out, err := AnalyzeHeapTimeSeries(profiles, labels, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeHeapTimeSeries() error = %v", err)
+	}
+	var result TimeSeriesAnalysisResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if result.Summary.TimestampSource != "profile" || result.Summary.TimeSpanMinutes != 10 || result.Summary.AvgGrowthRate != 2 {
+		t.Errorf("Unexpected summary: %+v", result.Summary)
+	}
+	if result.Series[2].Timestamp != "2024-01-01 12:10:00" {
+		t.Errorf("Series[2].Timestamp = %q, want 2024-01-01 12:10:00", result.Series[2].Timestamp)
+	}
+	if len(result.Trends) != 1 || result.Trends[0].GrowthRate != 2 {
+		t.Errorf("Unexpected trends: %+v", result.Trends)
+	}
+
+	// 任意一个 profile 缺少 TimeNanos 时退回到每个 profile 间隔 1 分钟的估算
+	profiles[1] = newProfile(-1, 12)
+	out, err = AnalyzeHeapTimeSeries(profiles, labels, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeHeapTimeSeries() error = %v", err)
+	}
+	for _, want := range []string{"时间跨度: 2.0 分钟 (部分 profile 缺少采集时间", "平均增长率: 10.00 MB/分钟", "T+1分钟 (估算)"} {
+		if !containsString(out, want) {
+			t.Errorf("Result does not contain %q\nGot:\n%s", want, out)
+		}
+	}
+}
+
+// TestAnalyzeObjectTrendsGrowthPercent 测试增长百分比的取整与上限：只有初始值为 0 的类型显示为 "new"，初始值很小的类型照常计算百分比
+func TestAnalyzeObjectTrendsGrowthPercent(t *testing.T) {
+	newProfile := func(values map[string]int64) *profile.Profile {
+		p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}}
+		for name, v := range values {
+			p.Sample = append(p.Sample, &profile.Sample{
+				Value:    []int64{v},
+				Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+			})
+		}
+		return p
+	}
+	profiles := []*profile.Profile{
+		newProfile(map[string]int64{"main.tiny": 8, "main.small": 512, "main.huge": 2048, "main.steady": 1000000, "main.big": 10 << 20}),
+		newProfile(map[string]int64{"main.tiny": 4096, "main.small": 640, "main.huge": 1 << 20, "main.steady": 1012345, "main.big": 15 << 20, "main.fresh": 1 << 20}),
+		newProfile(map[string]int64{"main.tiny": 8192, "main.small": 768, "main.huge": 2 << 20, "main.steady": 1012345, "main.big": 20 << 20, "main.fresh": 2 << 20}),
+	}
+
+	trends, err := analyzeObjectTrends(context.Background(), profiles, []string{"T1", "T2", "T3"}, []float64{0, 1, 2})
+	if err != nil {
+		t.Fatalf("analyzeObjectTrends() error = %v", err)
+	}
+	got := make(map[string]ObjectTrend)
+	for _, trend := range trends {
+		got[trend.TypeName] = trend
+	}
+	for name, want := range map[string]string{"main.tiny": ">999%", "main.small": "50%", "main.fresh": "new", "main.huge": ">999%", "main.steady": "1.2%", "main.big": "100%"} {
+		if got[name].GrowthLabel != want {
+			t.Errorf("%s GrowthLabel = %q, want %q", name, got[name].GrowthLabel, want)
+		}
+	}
+	if got["main.fresh"].TrendDirection != "increasing" {
+		t.Errorf("New type should be increasing, got %s", got["main.fresh"].TrendDirection)
+	}
+
+	// 达到上限的类型按增长的字节数排序，普通百分比排在其后
+	order := make([]string, len(trends))
+	for i, trend := range trends {
+		order[i] = trend.TypeName
+	}
+	want := []string{"main.fresh", "main.huge", "main.tiny", "main.big", "main.small", "main.steady"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Unexpected order %v, want %v", order, want)
+		}
+	}
+}
+
+// TestGrowthAcceleration 测试按每分钟增长量的变化区分加速、匀速和减速增长，并在报告中单独列出加速增长的类型
+func TestGrowthAcceleration(t *testing.T) {
+	minutes := []float64{0, 1, 2, 3}
+	for _, tt := range []struct {
+		values []int64
+		want   string
+	}{
+		{[]int64{1 << 20, 2 << 20, 4 << 20, 8 << 20}, "accelerating"},
+		{[]int64{1 << 20, 2 << 20, 3 << 20, 4 << 20}, "linear"},
+		{[]int64{1 << 20, 5 << 20, 7 << 20, 8 << 20}, "decelerating"},
+		{[]int64{4096, 4096, 4096, 4096}, "linear"},
+	} {
+		acceleration, trend := growthAcceleration(tt.values, minutes)
+		if trend != tt.want {
+			t.Errorf("growthAcceleration(%v) = %v, %s, want %s", tt.values, acceleration, trend, tt.want)
+		}
+	}
+	// 每分钟增长量依次为 1、2、4 MB，按区间中点拟合的斜率为 1.5 MB/分钟²
+	if acceleration, _ := growthAcceleration([]int64{1 << 20, 2 << 20, 4 << 20, 8 << 20}, minutes); math.Abs(acceleration-1.5) > 1e-9 {
+		t.Errorf("acceleration = %v, want 1.5", acceleration)
+	}
+
+	newProfile := func(values map[string]int64) *profile.Profile {
+		p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}}
+		for name, v := range values {
+			p.Sample = append(p.Sample, &profile.Sample{
+				Value:    []int64{v},
+				Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+			})
+		}
+		return p
+	}
+	profiles := []*profile.Profile{
+		newProfile(map[string]int64{"main.compound": 1 << 20, "main.steady": 10 << 20}),
+		newProfile(map[string]int64{"main.compound": 2 << 20, "main.steady": 20 << 20}),
+		newProfile(map[string]int64{"main.compound": 4 << 20, "main.steady": 30 << 20}),
+		newProfile(map[string]int64{"main.compound": 8 << 20, "main.steady": 40 << 20}),
+	}
+	text, err := AnalyzeHeapTimeSeries(profiles, []string{"T1", "T2", "T3", "T4"}, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeHeapTimeSeries() error = %v", err)
+	}
+	section := text[strings.Index(text, "加速增长的对象类型"):strings.Index(text, "Top 增长对象类型")]
+	if !strings.Contains(section, "main.compound") || strings.Contains(section, "main.steady") {
+		t.Errorf("accelerating section should list only main.compound, got:\n%s", section)
+	}
+}
+
+// TestSawtoothTimeSeries 测试 GC 锯齿形波动按谷值判断趋势：谷值持平的类型视为正常 GC 周期，谷值上升的类型才是泄漏
+func TestSawtoothTimeSeries(t *testing.T) {
+	minutes := []float64{0, 1, 2, 3, 4, 5}
+	// 在 GC 峰值结束采集：首尾相比增长了 3 倍，但谷值持平
+	churn := fitSawtooth([]int64{10 << 20, 30 << 20, 10 << 20, 30 << 20, 10 << 20, 30 << 20}, minutes)
+	if !churn.Sawtooth || churn.TroughGrowthBytes != 0 || churn.Amplitude != 20<<20 {
+		t.Errorf("fitSawtooth(churn) = %+v", churn)
+	}
+	leak := fitSawtooth([]int64{10 << 20, 30 << 20, 14 << 20, 34 << 20, 18 << 20, 38 << 20}, minutes)
+	if !leak.Sawtooth || leak.TroughGrowthRate != 2<<20 || leak.TroughGrowthBytes != 10<<20 {
+		t.Errorf("fitSawtooth(leak) = %+v", leak)
+	}
+	if fit := fitSawtooth([]int64{1 << 20, 2 << 20, 3 << 20, 4 << 20, 5 << 20, 6 << 20}, minutes); fit.Sawtooth {
+		t.Errorf("monotonic series should not be sawtooth: %+v", fit)
+	}
+
+	newProfile := func(timeMinutes int, values map[string]int64) *profile.Profile {
+		p := &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}},
+			TimeNanos:  time.Date(2024, 1, 1, 0, timeMinutes, 0, 0, time.UTC).UnixNano(),
+		}
+		for name, v := range values {
+			p.Sample = append(p.Sample, &profile.Sample{
+				Value:    []int64{v},
+				Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+			})
+		}
+		return p
+	}
+	var profiles []*profile.Profile
+	for i, pair := range [][2]int64{{10, 10}, {30, 30}, {10, 14}, {30, 34}, {10, 18}, {30, 38}} {
+		profiles = append(profiles, newProfile(i, map[string]int64{"main.cache": pair[0] << 20, "main.leak": pair[1] << 20}))
+	}
+	labels := []string{"T1", "T2", "T3", "T4", "T5", "T6"}
+	trends, err := analyzeObjectTrends(context.Background(), profiles, labels, minutes)
+	if err != nil {
+		t.Fatalf("analyzeObjectTrends() error = %v", err)
+	}
+	got := make(map[string]ObjectTrend)
+	for _, trend := range trends {
+		got[trend.TypeName] = trend
+	}
+	if c := got["main.cache"]; !c.GCChurn || c.TrendDirection != "stable" {
+		t.Errorf("main.cache = %+v, want GC churn and stable", c)
+	}
+	if l := got["main.leak"]; l.GCChurn || l.TrendDirection != "increasing" || !l.Sawtooth {
+		t.Errorf("main.leak = %+v, want a sawtooth leak", l)
+	}
+
+	text, err := AnalyzeHeapTimeSeries(profiles, labels, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeHeapTimeSeries() error = %v", err)
+	}
+	for _, want := range []string{"谷值增长率", "疑似泄漏", "更可能是正常的 GC 周期而不是泄漏: main.cache"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text output missing %q:\n%s", want, text)
+		}
+	}
+}
+
+// TestTimeSeriesGrowthAlerts 测试告警只列出增长超过阈值且在所有时间点上单调增长的类型，排除只出现一次尖峰的类型
+func TestTimeSeriesGrowthAlerts(t *testing.T) {
+	newProfile := func(values map[string]int64) *profile.Profile {
+		p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}}
+		for name, v := range values {
+			p.Sample = append(p.Sample, &profile.Sample{
+				Value:    []int64{v},
+				Location: []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: name}}}}},
+			})
+		}
+		return p
+	}
+	// main.leak 每个点都增长 (中间持平一次)；main.spike 首尾相比增长 50%，但中间先冲高再回落；main.slow 单调增长但只增长 10%
+	var profiles []*profile.Profile
+	for _, v := range [][3]int64{{10, 10, 100}, {15, 40, 105}, {15, 12, 108}, {20, 15, 110}} {
+		profiles = append(profiles, newProfile(map[string]int64{"main.leak": v[0] << 20, "main.spike": v[1] << 20, "main.slow": v[2] << 20}))
+	}
+	labels := []string{"T1", "T2", "T3", "T4"}
+
+	trends, err := analyzeObjectTrends(context.Background(), profiles, labels, []float64{0, 1, 2, 3})
+	if err != nil {
+		t.Fatalf("analyzeObjectTrends() error = %v", err)
+	}
+	got := make(map[string]ObjectTrend)
+	for _, trend := range trends {
+		got[trend.TypeName] = trend
+	}
+	if !got["main.leak"].MonotonicIncreasing || got["main.spike"].MonotonicIncreasing || !got["main.slow"].MonotonicIncreasing {
+		t.Errorf("MonotonicIncreasing: leak=%t spike=%t slow=%t", got["main.leak"].MonotonicIncreasing, got["main.spike"].MonotonicIncreasing, got["main.slow"].MonotonicIncreasing)
+	}
+	if isMonotonicIncreasing([]int64{5, 5, 5}) {
+		t.Error("a flat series should not be monotonic increasing")
+	}
+
+	out, err := AnalyzeHeapTimeSeries(profiles, labels, "json")
+	if err != nil {
+		t.Fatalf("AnalyzeHeapTimeSeries() error = %v", err)
+	}
+	var result TimeSeriesAnalysisResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.AlertThresholdPercent != defaultAlertThresholdPercent || len(result.Alerts) != 1 || result.Alerts[0].TypeName != "main.leak" {
+		t.Errorf("default alerts = %+v (threshold %.1f), want only main.leak", result.Alerts, result.AlertThresholdPercent)
+	}
+
+	// 降低阈值后单调增长的 main.slow 也进入告警，main.spike 仍被排除
+	text, err := AnalyzeHeapTimeSeriesWithOptions(profiles, labels, "text", TimeSeriesOptions{AlertThresholdPercent: 5})
+	if err != nil {
+		t.Fatalf("AnalyzeHeapTimeSeriesWithOptions() error = %v", err)
+	}
+	alertSection := text[strings.Index(text, "告警 (增长超过 5.0%"):strings.Index(text, "Top 增长对象类型")]
+	if !strings.Contains(alertSection, "main.leak") || !strings.Contains(alertSection, "main.slow") || strings.Contains(alertSection, "main.spike") {
+		t.Errorf("unexpected alert section:\n%s", alertSection)
+	}
+}
@@ -0,0 +1,566 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// RerootProfile 以匹配 re 的函数为根重新构造 profile，用于"放大到某个函数"的迭代分析。
+// 只保留调用栈中包含匹配函数的样本，并截掉最靠近根的匹配帧之上的所有调用者帧
+// (与 go tool pprof 的 -show_from 语义一致)，因此后续分析的百分比都是相对于该子树的总值，
+// 且只展示其后代函数。返回的是新的 profile，原 profile 不会被修改。
+func RerootProfile(p *profile.Profile, re *regexp.Regexp) (*profile.Profile, error) {
+	rerooted := p.Copy()
+	if !rerooted.ShowFrom(re) || len(rerooted.Sample) == 0 {
+		return nil, fmt.Errorf("no samples contain a function matching '%s'", re.String())
+	}
+	return rerooted.Compact(), nil
+}
+
+// AggregateByPackage 返回 profile 的副本，其中每一帧的函数都被替换为它所在的包 (见 packageName)，
+// 同一 Location 中相邻的同包内联帧合并为一帧。之后的任何分析 (cpu、heap、mutex、block 等) 都按包而不是按函数
+// 汇总：同一个包中所有函数的值相加后再排序取 Top N。返回的是新的 profile，原 profile 不会被修改。
+func AggregateByPackage(p *profile.Profile) *profile.Profile {
+	aggregated := p.Copy()
+	packages := make(map[string]*profile.Function)
+	var functions []*profile.Function
+	for _, loc := range aggregated.Location {
+		lines := loc.Line[:0]
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				lines = append(lines, line)
+				continue
+			}
+			pkg := packageName(line.Function.Name)
+			if pkg == "" {
+				pkg = line.Function.Name
+			}
+			fn, ok := packages[pkg]
+			if !ok {
+				fn = &profile.Function{ID: uint64(len(functions) + 1), Name: pkg, SystemName: pkg}
+				packages[pkg] = fn
+				functions = append(functions, fn)
+			}
+			if n := len(lines); n > 0 && lines[n-1].Function == fn {
+				continue
+			}
+			lines = append(lines, profile.Line{Function: fn})
+		}
+		loc.Line = lines
+	}
+	aggregated.Function = functions
+	return aggregated
+}
+
+// CollapseRecursion 返回 profile 的副本，其中每个样本的调用栈里同名函数只保留最靠近叶子的一次出现 (包括内联帧)，
+// 直接递归 (a -> a -> a) 和间接递归 (a -> b -> a) 都折叠为一帧。之后按完整调用栈 (full_stack) 聚合或生成火焰图时，
+// 递归深度不同的调用栈会合并为同一个，每个函数在一个样本中也只计一次。叶子帧保持不变，因此 flat 值不受影响。
+// 只有部分行被去掉的 Location 会被替换为新的 Location。返回的是新的 profile，原 profile 不会被修改。
+func CollapseRecursion(p *profile.Profile) *profile.Profile {
+	collapsed := p.Copy()
+	nextID := uint64(0)
+	for _, loc := range collapsed.Location {
+		if loc.ID > nextID {
+			nextID = loc.ID
+		}
+	}
+	// 同一个 Location 按相同的方式裁剪时复用同一个新 Location
+	type trimmedKey struct {
+		id   uint64
+		kept string
+	}
+	trimmed := make(map[trimmedKey]*profile.Location)
+
+	for _, s := range collapsed.Sample {
+		seen := make(map[string]bool, len(s.Location))
+		locations := make([]*profile.Location, 0, len(s.Location))
+		for _, loc := range s.Location {
+			var lines []profile.Line
+			var kept strings.Builder
+			for i, line := range loc.Line {
+				if line.Function != nil {
+					if seen[line.Function.Name] {
+						continue
+					}
+					seen[line.Function.Name] = true
+				}
+				lines = append(lines, line)
+				fmt.Fprintf(&kept, "%d,", i)
+			}
+			switch {
+			case len(lines) == len(loc.Line):
+				locations = append(locations, loc)
+			case len(lines) > 0:
+				key := trimmedKey{id: loc.ID, kept: kept.String()}
+				newLoc, ok := trimmed[key]
+				if !ok {
+					nextID++
+					copied := *loc
+					newLoc = &copied
+					newLoc.ID = nextID
+					newLoc.Line = lines
+					trimmed[key] = newLoc
+					collapsed.Location = append(collapsed.Location, newLoc)
+				}
+				locations = append(locations, newLoc)
+			}
+		}
+		s.Location = locations
+	}
+	return collapsed
+}
+
+// SampleFilterOptions 定义与 go tool pprof 的 -focus、-ignore、-hide、-show 和 -tagfocus 对应的样本过滤条件，
+// 每个条件都是正则表达式，为空时不生效。函数条件匹配函数名或源文件名
+type SampleFilterOptions struct {
+	Focus    string // 只保留调用栈中有匹配函数的样本
+	Ignore   string // 丢弃调用栈中有匹配函数的样本
+	Hide     string // 从调用栈中去掉匹配的帧，样本的值计入调用栈中其余的帧；调用栈全部被去掉的样本被丢弃
+	Show     string // 只保留调用栈中匹配的帧 (与 Hide 相反)
+	TagFocus string // 只保留字符串标签值匹配的样本，可以写成 "key=regex" 只匹配该标签键的值
+}
+
+// SampleFilterSummary 是 FilterSamples 的结果摘要
+type SampleFilterSummary struct {
+	TotalSamples int      // 过滤前的样本数
+	KeptSamples  int      // 过滤后剩余的样本数
+	Unmatched    []string // 没有匹配任何函数或标签的条件，例如 "hide=runtime\\."
+}
+
+// FilterSamples 返回按 opts 过滤后的 profile 副本 (与 go tool pprof 的同名选项语义一致)，之后的任何分析都只统计剩余的样本和帧。
+// 条件不是有效的正则表达式，或者过滤后没有剩下任何样本时返回错误。原 profile 不会被修改。
+func FilterSamples(p *profile.Profile, opts SampleFilterOptions) (*profile.Profile, SampleFilterSummary, error) {
+	summary := SampleFilterSummary{TotalSamples: len(p.Sample)}
+	var focus, ignore, hide, show, tagFocus *regexp.Regexp
+	tagKey, tagPattern := "", opts.TagFocus
+	if key, value, ok := strings.Cut(opts.TagFocus, "="); ok {
+		tagKey, tagPattern = key, value
+	}
+	for _, c := range []struct {
+		name, pattern string
+		re            **regexp.Regexp
+	}{{"focus", opts.Focus, &focus}, {"ignore", opts.Ignore, &ignore}, {"hide", opts.Hide, &hide}, {"show", opts.Show, &show}, {"tagfocus", tagPattern, &tagFocus}} {
+		if c.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(c.pattern)
+		if err != nil {
+			return nil, summary, fmt.Errorf("invalid %s regex '%s': %v", c.name, c.pattern, err)
+		}
+		*c.re = re
+	}
+
+	filtered := p.Copy()
+	fm, im, hm, hnm := filtered.FilterSamplesByName(focus, ignore, hide, show)
+	tm := true
+	if tagFocus != nil {
+		tm, _ = filtered.FilterSamplesByTag(func(s *profile.Sample) bool {
+			for key, values := range s.Label {
+				if tagKey != "" && key != tagKey {
+					continue
+				}
+				for _, v := range values {
+					if tagFocus.MatchString(v) {
+						return true
+					}
+				}
+			}
+			return false
+		}, nil)
+	}
+	for _, c := range []struct {
+		name, pattern string
+		matched       bool
+	}{{"focus", opts.Focus, fm}, {"ignore", opts.Ignore, im}, {"hide", opts.Hide, hm}, {"show", opts.Show, hnm}, {"tagfocus", opts.TagFocus, tm}} {
+		if c.pattern != "" && !c.matched {
+			summary.Unmatched = append(summary.Unmatched, c.name+"="+c.pattern)
+		}
+	}
+	summary.KeptSamples = len(filtered.Sample)
+	if summary.KeptSamples == 0 {
+		return nil, summary, fmt.Errorf("no samples left after filtering (%d samples before)", summary.TotalSamples)
+	}
+	return filtered.Compact(), summary, nil
+}
+
+// CleanNamesOptions 定义函数名清理规则，用于去掉闭包、泛型等让输出难以阅读的部分
+type CleanNamesOptions struct {
+	TrimClosures     bool   // 去掉 .funcN、.funcN.M 等闭包后缀 (以及编译器生成的 .gowrapN / .deferwrapN)，例如 "main.(*Server).handle.func1.2" -> "main.(*Server).handle"
+	CollapseGenerics bool   // 将泛型类型参数折叠为 [...]，例如 "main.Map[go.shape.int,go.shape.string]" -> "main.Map[...]"
+	StripPrefix      string // 非空时去掉函数名开头的 module path，例如 "github.com/acme/svc" 使 "github.com/acme/svc/internal/db.Get" -> "internal/db.Get"
+}
+
+// closureSuffixRe 匹配函数名末尾的闭包后缀 (Go 1.21 之前嵌套闭包为 .func1.func2，之后为 .func1.2)
+var closureSuffixRe = regexp.MustCompile(`(\.(func|gowrap|deferwrap)\d+)(\.func\d+|\.\d+)*$`)
+
+// CleanFunctionNames 返回 profile 的副本，其中每个函数名都按 opts 清理 (见 CleanFunctionName)。
+// 只修改名字，文件名和行号保持不变；清理后同名的函数在按函数名汇总的分析中会被合并为一项
+// (例如一个方法与它的所有闭包)。返回的是新的 profile，原 profile 不会被修改。
+func CleanFunctionNames(p *profile.Profile, opts CleanNamesOptions) *profile.Profile {
+	cleaned := p.Copy()
+	for _, fn := range cleaned.Function {
+		fn.Name = CleanFunctionName(fn.Name, opts)
+	}
+	return cleaned
+}
+
+// CleanFunctionName 按 opts 清理单个函数名，清理后为空时返回原名
+func CleanFunctionName(name string, opts CleanNamesOptions) string {
+	cleaned := name
+	if opts.StripPrefix != "" {
+		prefix := strings.TrimSuffix(opts.StripPrefix, "/")
+		if rest, ok := strings.CutPrefix(cleaned, prefix+"/"); ok {
+			cleaned = rest
+		} else if rest, ok := strings.CutPrefix(cleaned, prefix+"."); ok {
+			// module 根包中的函数保留包名，例如 "github.com/acme/svc.Run" -> "svc.Run"
+			cleaned = path.Base(prefix) + "." + rest
+		}
+	}
+	if opts.CollapseGenerics {
+		cleaned = collapseTypeParams(cleaned)
+	}
+	if opts.TrimClosures {
+		cleaned = strings.TrimRight(closureSuffixRe.ReplaceAllString(cleaned, ""), ".")
+	}
+	if cleaned == "" {
+		return name
+	}
+	return cleaned
+}
+
+// collapseTypeParams 将最外层方括号中的内容替换为 "..."，括号不匹配时保留剩余部分
+func collapseTypeParams(name string) string {
+	if !strings.Contains(name, "[") {
+		return name
+	}
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c == '[':
+			if depth == 0 {
+				b.WriteString("[...")
+			}
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+			if depth == 0 {
+				b.WriteByte(']')
+			}
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	if depth > 0 {
+		return name
+	}
+	return b.String()
+}
+
+// RedactLabels 将 keys 中指定的标签的值替换为其哈希值，避免在输出中暴露用户 ID、带 token 的 URL 等敏感信息。
+// 使用确定性的哈希而不是统一的掩码，这样相同的原始值仍会被归为同一组，在多个 profile 之间也可以比较。
+// 数值标签 (NumLabel) 同样会被展示 (见 sampleLabelValue)，因此也会被替换为字符串标签形式的哈希值，并移除原来的数值和单位。
+// 返回的是新的 profile，原 profile 不会被修改。
+func RedactLabels(p *profile.Profile, keys []string) *profile.Profile {
+	redacted := p.Copy()
+	if len(keys) == 0 {
+		return redacted
+	}
+	redact := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		redact[k] = true
+	}
+
+	for _, s := range redacted.Sample {
+		for key, values := range s.Label {
+			if !redact[key] {
+				continue
+			}
+			for i, v := range values {
+				values[i] = redactValue(v)
+			}
+		}
+		for key, values := range s.NumLabel {
+			if !redact[key] {
+				continue
+			}
+			units := s.NumUnit[key]
+			hashed := make([]string, len(values))
+			for i, v := range values {
+				raw := strconv.FormatInt(v, 10)
+				if i < len(units) && units[i] != "" {
+					raw += " " + units[i]
+				}
+				hashed[i] = redactValue(raw)
+			}
+			if s.Label == nil {
+				s.Label = make(map[string][]string)
+			}
+			s.Label[key] = append(s.Label[key], hashed...)
+			delete(s.NumLabel, key)
+			delete(s.NumUnit, key)
+		}
+	}
+	return redacted
+}
+
+// redactValue 返回标签值的脱敏表示
+func redactValue(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return fmt.Sprintf("<redacted:%s>", hex.EncodeToString(sum[:4]))
+}
+
+// DeltaProfile 构造差值 profile (target - baseline)：将 baseline 的副本取反后与 target 合并。
+// 同一调用栈的值相加得到净变化，正值表示增加 (回归)，负值表示减少 (改进)。
+// 两个 profile 必须具有相同的样本类型和采样周期类型。
+func DeltaProfile(baseline, target *profile.Profile) (*profile.Profile, error) {
+	negated := baseline.Copy()
+	negated.Scale(-1)
+	delta, err := profile.Merge([]*profile.Profile{target.Copy(), negated})
+	if err != nil {
+		return nil, fmt.Errorf("profiles are not compatible for diffing: %w", err)
+	}
+	return delta, nil
+}
+
+// MergeProfiles 将多个同类型的 profile (例如集群中每个实例的 CPU profile) 合并为一个，
+// 相同调用栈的样本值相加，采集时长累加，可以把结果交给 analyze_pprof 查看整个集群的视图。
+// 所有 profile 的样本类型列表 (类型、单位和顺序) 以及采样周期类型必须一致，否则返回说明差异的错误。
+// 输入的 profile 不会被修改。
+func MergeProfiles(profiles []*profile.Profile) (*profile.Profile, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("至少需要 1 个 profile 才能合并")
+	}
+	first := profiles[0]
+	for i, p := range profiles[1:] {
+		if !sameSampleTypes(first.SampleType, p.SampleType) {
+			return nil, fmt.Errorf("profile #%d 的样本类型 [%s] 与 profile #1 的 [%s] 不一致，只能合并同一类型的 profile",
+				i+2, sampleTypeNames(p), sampleTypeNames(first))
+		}
+		if !samePeriodType(first.PeriodType, p.PeriodType) {
+			return nil, fmt.Errorf("profile #%d 的采样周期类型 %s 与 profile #1 的 %s 不一致",
+				i+2, periodTypeName(p.PeriodType), periodTypeName(first.PeriodType))
+		}
+	}
+
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge profiles: %w", err)
+	}
+	return merged, nil
+}
+
+// sameSampleTypes 判断两个样本类型列表的类型、单位和顺序是否完全一致
+func sameSampleTypes(a, b []*profile.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Unit != b[i].Unit {
+			return false
+		}
+	}
+	return true
+}
+
+// samePeriodType 判断两个采样周期类型是否一致 (都为空也视为一致)
+func samePeriodType(a, b *profile.ValueType) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Type == b.Type && a.Unit == b.Unit
+}
+
+// periodTypeName 将采样周期类型格式化为 "type/unit"
+func periodTypeName(pt *profile.ValueType) string {
+	if pt == nil {
+		return "(无)"
+	}
+	return pt.Type + "/" + pt.Unit
+}
+
+// OverridePeriod 用 period 替代 profile 中记录的采样周期，并据此修正由周期推导出的样本值。
+// 单位与 PeriodType 相同的样本类型 (例如 CPU profile 中的 cpu/nanoseconds = 样本数 × 周期)：
+//   - 原周期有效时，按 period / 原周期 的比例缩放；
+//   - 原周期为零时，由 "samples"/"count" 样本数乘以 period 重新计算。
+//
+// 返回的是新的 profile，原 profile 不会被修改。
+func OverridePeriod(p *profile.Profile, period int64) (*profile.Profile, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("period override must be positive, got %d", period)
+	}
+	overridden := p.Copy()
+	oldPeriod := overridden.Period
+	overridden.Period = period
+	if overridden.PeriodType == nil || oldPeriod == period {
+		return overridden, nil
+	}
+
+	countIndex := -1
+	for i, st := range overridden.SampleType {
+		if st.Type == "samples" && st.Unit == "count" {
+			countIndex = i
+		}
+	}
+
+	for i, st := range overridden.SampleType {
+		if i == countIndex || st.Unit != overridden.PeriodType.Unit {
+			continue
+		}
+		for _, s := range overridden.Sample {
+			if i >= len(s.Value) {
+				continue
+			}
+			if oldPeriod > 0 {
+				s.Value[i] = int64(float64(s.Value[i]) * float64(period) / float64(oldPeriod))
+			} else if countIndex >= 0 && countIndex < len(s.Value) {
+				s.Value[i] = s.Value[countIndex] * period
+			}
+		}
+	}
+	return overridden, nil
+}
+
+// heapSamplePairs 是 heap/allocs profile 中需要一起修正的 (对象数, 字节数) 样本类型
+var heapSamplePairs = [][2]string{{"inuse_objects", "inuse_space"}, {"alloc_objects", "alloc_space"}}
+
+// UnsampleHeapProfile 按 profile 记录的采样率 (Period，平均每分配多少字节采样一次) 修正 heap/allocs 样本值，
+// 使其近似实际的分配量，返回修正后的副本和被修正的样本数。修正方式与 pprof 解析旧版文本 heap profile 时相同：
+// 每个样本的对象数和字节数都乘以 1 / (1 - exp(-平均对象大小 / 采样率))。
+// Go runtime 写出的 protobuf heap profile 已经做过这一修正 (go tool pprof 直接显示其中的值)，
+// 只有样本值仍是原始采样值的 profile 才需要修正，否则数值会被高估。
+// 原 profile 不会被修改。
+func UnsampleHeapProfile(p *profile.Profile) (*profile.Profile, int, error) {
+	if p.Period <= 1 {
+		return nil, 0, fmt.Errorf("profile does not record a heap sampling rate (period = %d)", p.Period)
+	}
+	index := make(map[string]int, len(p.SampleType))
+	for i, st := range p.SampleType {
+		index[st.Type] = i
+	}
+	var pairs [][2]int
+	for _, pair := range heapSamplePairs {
+		countIndex, okCount := index[pair[0]]
+		sizeIndex, okSize := index[pair[1]]
+		if okCount && okSize {
+			pairs = append(pairs, [2]int{countIndex, sizeIndex})
+		}
+	}
+	if len(pairs) == 0 {
+		return nil, 0, fmt.Errorf("profile has no object count and byte sample types to unsample (sample types: %s)", sampleTypeNames(p))
+	}
+
+	unsampled := p.Copy()
+	scaled := 0
+	rate := float64(p.Period)
+	for _, s := range unsampled.Sample {
+		changed := false
+		for _, pair := range pairs {
+			if pair[0] >= len(s.Value) || pair[1] >= len(s.Value) {
+				continue
+			}
+			count, size := s.Value[pair[0]], s.Value[pair[1]]
+			if count == 0 || size == 0 {
+				continue
+			}
+			scale := 1 / (1 - math.Exp(-float64(size)/float64(count)/rate))
+			s.Value[pair[0]] = int64(float64(count) * scale)
+			s.Value[pair[1]] = int64(float64(size) * scale)
+			changed = true
+		}
+		if changed {
+			scaled++
+		}
+	}
+	return unsampled, scaled, nil
+}
+
+// SanitizeOptions 定义 profile 脱敏的参数
+type SanitizeOptions struct {
+	KeepStdlib bool   // 为 true 时保留 Go 标准库 (runtime、net/http 等) 的函数名，便于排查问题
+	Salt       string // 可选的哈希盐值；对多个 profile 使用相同的盐值可以保持它们之间的可比较性
+}
+
+// SanitizeStats 记录脱敏过程中处理的条目数量
+type SanitizeStats struct {
+	Functions int `json:"functions"`
+	Files     int `json:"files"`
+	Mappings  int `json:"mappings"`
+	Labels    int `json:"labels"`
+}
+
+// SanitizeProfile 对 profile 中可能泄露内部代码结构的信息进行脱敏：函数名、文件路径、
+// mapping 文件及 build ID、字符串标签的键和值都会被替换为确定性的哈希 token，注释会被删除。
+// 样本值和调用栈结构保持不变，且相同的名字总是映射为相同的 token，因此脱敏后的 profile 仍可用于分析和比较。
+// 返回的是新的 profile，原 profile 不会被修改。
+func SanitizeProfile(p *profile.Profile, opts SanitizeOptions) (*profile.Profile, SanitizeStats) {
+	sanitized := p.Copy()
+	var stats SanitizeStats
+	files := make(map[string]bool)
+
+	for _, fn := range sanitized.Function {
+		if !(opts.KeepStdlib && isStdlibFunction(fn.Name)) {
+			fn.Name = sanitizeToken("fn", opts.Salt, fn.Name)
+			fn.SystemName = sanitizeToken("fn", opts.Salt, fn.SystemName)
+			stats.Functions++
+		}
+		if fn.Filename != "" {
+			files[fn.Filename] = true
+			fn.Filename = sanitizeToken("file", opts.Salt, fn.Filename) + ".go"
+		}
+	}
+	stats.Files = len(files)
+
+	for _, m := range sanitized.Mapping {
+		if m.File != "" {
+			m.File = sanitizeToken("bin", opts.Salt, m.File)
+			stats.Mappings++
+		}
+		if m.BuildID != "" {
+			m.BuildID = sanitizeToken("build", opts.Salt, m.BuildID)
+		}
+	}
+
+	for _, s := range sanitized.Sample {
+		if len(s.Label) == 0 {
+			continue
+		}
+		labels := make(map[string][]string, len(s.Label))
+		for key, values := range s.Label {
+			hashed := make([]string, len(values))
+			for i, v := range values {
+				hashed[i] = sanitizeToken("val", opts.Salt, v)
+				stats.Labels++
+			}
+			labels[sanitizeToken("key", opts.Salt, key)] = hashed
+		}
+		s.Label = labels
+	}
+
+	sanitized.Comments = nil
+	return sanitized, stats
+}
+
+// sanitizeToken 将 v 替换为形如 "<prefix>_1a2b3c4d" 的确定性哈希 token，空字符串保持为空
+func sanitizeToken(prefix, salt, v string) string {
+	if v == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(salt + v))
+	return prefix + "_" + hex.EncodeToString(sum[:4])
+}
+
+// isStdlibFunction 判断函数是否属于 Go 标准库：包路径的第一段不含 '.' 且不是 main 包
+func isStdlibFunction(name string) bool {
+	pkg := packageName(name)
+	first, _, _ := strings.Cut(pkg, "/")
+	return pkg != "" && pkg != "main" && !strings.Contains(first, ".")
+}
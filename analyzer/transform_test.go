@@ -0,0 +1,522 @@
+package analyzer
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestRerootProfile 测试以指定函数为根重新构造 profile
+func TestRerootProfile(t *testing.T) {
+	fnMain := &profile.Function{ID: 1, Name: "main.main"}
+	fnHandler := &profile.Function{ID: 2, Name: "main.handler"}
+	fnWork := &profile.Function{ID: 3, Name: "main.work"}
+	fnOther := &profile.Function{ID: 4, Name: "main.other"}
+	locMain := &profile.Location{ID: 1, Line: []profile.Line{{Function: fnMain}}}
+	locHandler := &profile.Location{ID: 2, Line: []profile.Line{{Function: fnHandler}}}
+	locWork := &profile.Location{ID: 3, Line: []profile.Line{{Function: fnWork}}}
+	locOther := &profile.Location{ID: 4, Line: []profile.Line{{Function: fnOther}}}
+
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{locWork, locHandler, locMain}, Value: []int64{300}},
+			{Location: []*profile.Location{locOther, locMain}, Value: []int64{700}},
+		},
+		Location: []*profile.Location{locMain, locHandler, locWork, locOther},
+		Function: []*profile.Function{fnMain, fnHandler, fnWork, fnOther},
+	}
+
+	rerooted, err := RerootProfile(p, regexp.MustCompile(`^main\.handler$`))
+	if err != nil {
+		t.Fatalf("RerootProfile() error = %v", err)
+	}
+	if len(rerooted.Sample) != 1 {
+		t.Fatalf("Expected 1 sample after re-root, got %d", len(rerooted.Sample))
+	}
+	stack := rerooted.Sample[0].Location
+	if len(stack) != 2 || stack[len(stack)-1].Line[0].Function.Name != "main.handler" {
+		t.Errorf("Expected stack rooted at main.handler, got %d frames", len(stack))
+	}
+	if len(p.Sample) != 2 || len(p.Sample[0].Location) != 3 {
+		t.Error("Original profile should not be modified")
+	}
+
+	if _, err := RerootProfile(p, regexp.MustCompile(`nonexistent`)); err == nil {
+		t.Error("Expected error when no function matches, got nil")
+	}
+}
+
+// TestRedactLabels 测试标签值脱敏
+func TestRedactLabels(t *testing.T) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Value: []int64{1}, Label: map[string][]string{"user_id": {"alice"}, "endpoint": {"/api"}}},
+			{Value: []int64{2}, Label: map[string][]string{"user_id": {"alice"}}},
+			{Value: []int64{3}, Label: map[string][]string{"user_id": {"bob"}}},
+		},
+	}
+
+	redacted := RedactLabels(p, []string{"user_id"})
+
+	first := redacted.Sample[0].Label["user_id"][0]
+	if first == "alice" || !containsString(first, "redacted") {
+		t.Errorf("Expected user_id to be redacted, got %q", first)
+	}
+	if redacted.Sample[1].Label["user_id"][0] != first {
+		t.Error("Expected identical values to redact to the same hash")
+	}
+	if redacted.Sample[2].Label["user_id"][0] == first {
+		t.Error("Expected different values to redact to different hashes")
+	}
+	if got := redacted.Sample[0].Label["endpoint"][0]; got != "/api" {
+		t.Errorf("Expected unlisted label to be kept, got %q", got)
+	}
+	if p.Sample[0].Label["user_id"][0] != "alice" {
+		t.Error("Original profile should not be modified")
+	}
+
+	// 数值标签也会被展示，脱敏后改为字符串标签形式的哈希值
+	numeric := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Value: []int64{1}, NumLabel: map[string][]int64{"tenant_id": {4242}, "bytes": {64}}, NumUnit: map[string][]string{"bytes": {"bytes"}}},
+		},
+	}
+	redacted = RedactLabels(numeric, []string{"tenant_id"})
+	s := redacted.Sample[0]
+	if _, ok := s.NumLabel["tenant_id"]; ok {
+		t.Errorf("Expected numeric tenant_id to be removed, got %v", s.NumLabel)
+	}
+	if got, _ := sampleLabelValue(s, "tenant_id"); got == "4242" || !containsString(got, "redacted") {
+		t.Errorf("Expected numeric tenant_id to be redacted, got %q", got)
+	}
+	if got, _ := sampleLabelValue(s, "bytes"); got != "64 bytes" {
+		t.Errorf("Expected unlisted numeric label to be kept, got %q", got)
+	}
+	if numeric.Sample[0].NumLabel["tenant_id"][0] != 4242 {
+		t.Error("Original profile should not be modified")
+	}
+}
+
+// TestOverridePeriod 测试采样周期覆盖及样本值修正
+func TestOverridePeriod(t *testing.T) {
+	newProfile := func(period int64, cpu int64) *profile.Profile {
+		return &profile.Profile{
+			SampleType: []*profile.ValueType{
+				{Type: "samples", Unit: "count"},
+				{Type: "cpu", Unit: "nanoseconds"},
+			},
+			PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+			Period:     period,
+			Sample:     []*profile.Sample{{Value: []int64{5, cpu}}},
+		}
+	}
+
+	// 原周期错误：按比例缩放
+	p := newProfile(1000000, 5000000)
+	overridden, err := OverridePeriod(p, 10000000)
+	if err != nil {
+		t.Fatalf("OverridePeriod() error = %v", err)
+	}
+	if got := overridden.Sample[0].Value; got[0] != 5 || got[1] != 50000000 {
+		t.Errorf("Expected values [5 50000000], got %v", got)
+	}
+	if p.Sample[0].Value[1] != 5000000 {
+		t.Error("Original profile should not be modified")
+	}
+
+	// 原周期为零：由样本数重新计算
+	overridden, err = OverridePeriod(newProfile(0, 0), 10000000)
+	if err != nil {
+		t.Fatalf("OverridePeriod() error = %v", err)
+	}
+	if overridden.Period != 10000000 || overridden.Sample[0].Value[1] != 50000000 {
+		t.Errorf("Expected period 10000000 and cpu 50000000, got %d and %d", overridden.Period, overridden.Sample[0].Value[1])
+	}
+
+	if _, err := OverridePeriod(p, 0); err == nil {
+		t.Error("Expected error for non-positive period, got nil")
+	}
+}
+
+// TestUnsampleHeapProfile 测试按采样率修正 heap 样本：大对象几乎都会被采到，修正幅度小；小对象按比例放大
+func TestUnsampleHeapProfile(t *testing.T) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "alloc_objects", Unit: "count"},
+			{Type: "alloc_space", Unit: "bytes"},
+			{Type: "inuse_objects", Unit: "count"},
+			{Type: "inuse_space", Unit: "bytes"},
+		},
+		Period: 512 * 1024,
+		Sample: []*profile.Sample{
+			{Value: []int64{2, 512 * 1024, 0, 0}},      // 平均 256 KB，修正系数约 2.54
+			{Value: []int64{100, 102400, 100, 102400}}, // 平均 1 KB，修正系数约 512.5
+		},
+	}
+	unsampled, scaled, err := UnsampleHeapProfile(p)
+	if err != nil {
+		t.Fatalf("UnsampleHeapProfile() error = %v", err)
+	}
+	if scaled != 2 {
+		t.Errorf("scaled samples = %d, want 2", scaled)
+	}
+	if got := unsampled.Sample[0].Value; got[0] != 5 || got[1] != 1332474 || got[2] != 0 || got[3] != 0 {
+		t.Errorf("Expected values [5 1332474 0 0], got %v", got)
+	}
+	if got := unsampled.Sample[1].Value; got[0] != 51250 || got[1] != 52480016 || got[2] != 51250 || got[3] != 52480016 {
+		t.Errorf("Expected values [51250 52480016 51250 52480016], got %v", got)
+	}
+	if p.Sample[0].Value[1] != 512*1024 {
+		t.Error("Original profile should not be modified")
+	}
+
+	p.Period = 0
+	if _, _, err := UnsampleHeapProfile(p); err == nil {
+		t.Error("Expected error for a profile without a sampling rate, got nil")
+	}
+	cpu := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}}, Period: 10000000}
+	if _, _, err := UnsampleHeapProfile(cpu); err == nil {
+		t.Error("Expected error for a profile without heap sample types, got nil")
+	}
+}
+
+// TestCollapseRecursion 测试折叠递归后，递归深度不同的调用栈在 full_stack 聚合中合并，flat 值不变
+func TestCollapseRecursion(t *testing.T) {
+	walk := &profile.Function{ID: 1, Name: "main.walk"}
+	visit := &profile.Function{ID: 2, Name: "main.visit"}
+	mainFn := &profile.Function{ID: 3, Name: "main.main"}
+	walkLoc := &profile.Location{ID: 1, Line: []profile.Line{{Function: walk}}}
+	mainLoc := &profile.Location{ID: 2, Line: []profile.Line{{Function: mainFn}}}
+	// visit 内联在 walk 中：间接递归 walk -> visit -> walk
+	inlinedLoc := &profile.Location{ID: 3, Line: []profile.Line{{Function: walk}, {Function: visit}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{walk, visit, mainFn},
+		Location:   []*profile.Location{walkLoc, mainLoc, inlinedLoc},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{walkLoc, mainLoc}, Value: []int64{100}},
+			{Location: []*profile.Location{walkLoc, walkLoc, walkLoc, mainLoc}, Value: []int64{200}},
+			{Location: []*profile.Location{walkLoc, inlinedLoc, mainLoc}, Value: []int64{300}},
+		},
+	}
+
+	collapsed := CollapseRecursion(p)
+	fullStack, _, total, err := aggregateValues(context.Background(), collapsed, 0, AggregationFullStack)
+	if err != nil {
+		t.Fatalf("aggregateValues() error = %v", err)
+	}
+	if total != 600 || fullStack["main.walk <- main.main"] != 300 || fullStack["main.walk <- main.visit <- main.main"] != 300 || len(fullStack) != 2 {
+		t.Errorf("full_stack after collapsing = %v (total %d), want the recursive stacks merged", fullStack, total)
+	}
+	flat, _, _, _ := aggregateValues(context.Background(), collapsed, 0, AggregationLeaf)
+	if flat["main.walk"] != 600 {
+		t.Errorf("flat after collapsing = %v, want main.walk = 600", flat)
+	}
+	if len(p.Sample[1].Location) != 4 || len(inlinedLoc.Line) != 2 {
+		t.Error("Original profile should not be modified")
+	}
+	if err := collapsed.CheckValid(); err != nil {
+		t.Errorf("collapsed profile is invalid: %v", err)
+	}
+}
+
+// TestFilterSamples 测试 focus/ignore/hide/show/tagfocus 过滤：focus 和 ignore 按调用栈保留或丢弃样本，hide 去掉帧后值计入调用方，
+// tagfocus 按标签值过滤，没有匹配的条件记录在摘要中
+func TestFilterSamples(t *testing.T) {
+	handle := &profile.Function{ID: 1, Name: "main.handle"}
+	query := &profile.Function{ID: 2, Name: "db.Query"}
+	gc := &profile.Function{ID: 3, Name: "runtime.gcBgMarkWorker"}
+	handleLoc := &profile.Location{ID: 1, Line: []profile.Line{{Function: handle}}}
+	queryLoc := &profile.Location{ID: 2, Line: []profile.Line{{Function: query}}}
+	gcLoc := &profile.Location{ID: 3, Line: []profile.Line{{Function: gc}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{handle, query, gc},
+		Location:   []*profile.Location{handleLoc, queryLoc, gcLoc},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{queryLoc, handleLoc}, Value: []int64{300}, Label: map[string][]string{"endpoint": {"/api/users"}}},
+			{Location: []*profile.Location{handleLoc}, Value: []int64{100}, Label: map[string][]string{"endpoint": {"/health"}}},
+			{Location: []*profile.Location{gcLoc}, Value: []int64{600}},
+		},
+	}
+	flatOf := func(opts SampleFilterOptions) (map[string]int64, SampleFilterSummary) {
+		t.Helper()
+		filtered, summary, err := FilterSamples(p, opts)
+		if err != nil {
+			t.Fatalf("FilterSamples(%+v) error = %v", opts, err)
+		}
+		flat, _, _, err := aggregateValues(context.Background(), filtered, 0, AggregationLeaf)
+		if err != nil {
+			t.Fatalf("aggregateValues() error = %v", err)
+		}
+		return flat, summary
+	}
+
+	if flat, summary := flatOf(SampleFilterOptions{Focus: `^main\.`}); len(flat) != 2 || flat["db.Query"] != 300 || summary.KeptSamples != 2 || summary.TotalSamples != 3 {
+		t.Errorf("focus: flat = %v, summary = %+v", flat, summary)
+	}
+	if flat, _ := flatOf(SampleFilterOptions{Ignore: `^runtime\.`}); flat["runtime.gcBgMarkWorker"] != 0 || flat["main.handle"] != 100 {
+		t.Errorf("ignore: flat = %v", flat)
+	}
+	// 去掉 db.Query 后其值计入调用方 main.handle；调用栈全部被去掉的 GC 样本被丢弃
+	if flat, summary := flatOf(SampleFilterOptions{Hide: `^(db|runtime)\.`}); len(flat) != 1 || flat["main.handle"] != 400 || summary.KeptSamples != 2 {
+		t.Errorf("hide: flat = %v, summary = %+v", flat, summary)
+	}
+	if flat, _ := flatOf(SampleFilterOptions{Show: `^db\.`}); len(flat) != 1 || flat["db.Query"] != 300 {
+		t.Errorf("show: flat = %v", flat)
+	}
+	if flat, _ := flatOf(SampleFilterOptions{TagFocus: "endpoint=^/api/"}); len(flat) != 1 || flat["db.Query"] != 300 {
+		t.Errorf("tagfocus: flat = %v", flat)
+	}
+	if _, summary := flatOf(SampleFilterOptions{Ignore: "main.nothing", TagFocus: "/health"}); len(summary.Unmatched) != 1 || summary.Unmatched[0] != "ignore=main.nothing" {
+		t.Errorf("unmatched = %v, want only the ignore pattern", summary.Unmatched)
+	}
+
+	if _, _, err := FilterSamples(p, SampleFilterOptions{Focus: "main.(handle"}); err == nil || !strings.Contains(err.Error(), "invalid focus regex") {
+		t.Errorf("FilterSamples(invalid focus) error = %v", err)
+	}
+	if _, _, err := FilterSamples(p, SampleFilterOptions{Focus: "main.nothing"}); err == nil || !strings.Contains(err.Error(), "no samples left") {
+		t.Errorf("FilterSamples(focus matching nothing) error = %v", err)
+	}
+	if len(p.Sample) != 3 || len(p.Sample[0].Location) != 2 {
+		t.Error("Original profile should not be modified")
+	}
+}
+
+// TestSanitizeProfile 测试 profile 脱敏
+func TestSanitizeProfile(t *testing.T) {
+	fnSecret := &profile.Function{ID: 1, Name: "github.com/acme/secret.(*Engine).Run", Filename: "/home/dev/acme/secret/engine.go"}
+	fnRuntime := &profile.Function{ID: 2, Name: "runtime.mallocgc", Filename: "/usr/local/go/src/runtime/malloc.go"}
+	locSecret := &profile.Location{ID: 1, Line: []profile.Line{{Function: fnSecret}}}
+	locRuntime := &profile.Location{ID: 2, Line: []profile.Line{{Function: fnRuntime}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{locRuntime, locSecret}, Value: []int64{100}, Label: map[string][]string{"tenant": {"acme-corp"}}},
+			{Location: []*profile.Location{locSecret}, Value: []int64{50}},
+		},
+		Location: []*profile.Location{locSecret, locRuntime},
+		Function: []*profile.Function{fnSecret, fnRuntime},
+		Comments: []string{"captured on build-host.acme.internal"},
+	}
+
+	sanitized, stats := SanitizeProfile(p, SanitizeOptions{KeepStdlib: true})
+	if stats.Functions != 1 || stats.Files != 2 || stats.Labels != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	names := make(map[string]bool)
+	for _, fn := range sanitized.Function {
+		names[fn.Name] = true
+		if containsString(fn.Filename, "acme") || containsString(fn.Filename, "/home/") {
+			t.Errorf("File path was not sanitized: %s", fn.Filename)
+		}
+	}
+	if !names["runtime.mallocgc"] {
+		t.Error("Expected stdlib function name to be kept with KeepStdlib")
+	}
+	if names[fnSecret.Name] {
+		t.Error("Expected proprietary function name to be hashed")
+	}
+	for _, s := range sanitized.Sample {
+		for key, values := range s.Label {
+			if key == "tenant" || values[0] == "acme-corp" {
+				t.Errorf("Label was not sanitized: %s=%v", key, values)
+			}
+		}
+	}
+	if len(sanitized.Comments) != 0 {
+		t.Error("Expected comments to be removed")
+	}
+	if len(sanitized.Sample) != 2 || sanitized.Sample[0].Value[0] != 100 || len(sanitized.Sample[0].Location) != 2 {
+		t.Error("Expected sample values and stack structure to be preserved")
+	}
+
+	// 相同的名字应映射为相同的 token，以保持可比较性
+	again, _ := SanitizeProfile(p, SanitizeOptions{})
+	other, _ := SanitizeProfile(p, SanitizeOptions{})
+	if again.Function[0].Name != other.Function[0].Name {
+		t.Error("Expected consistent hashing across runs")
+	}
+	salted, _ := SanitizeProfile(p, SanitizeOptions{Salt: "s3cret"})
+	if salted.Function[0].Name == again.Function[0].Name {
+		t.Error("Expected salt to change the hash")
+	}
+	if p.Function[0].Name != "github.com/acme/secret.(*Engine).Run" {
+		t.Error("Original profile should not be modified")
+	}
+
+	for name, want := range map[string]bool{
+		"runtime.mallocgc":                       true,
+		"net/http.(*conn).serve":                 true,
+		"main.main":                              false,
+		"github.com/acme/secret.Run":             false,
+		"golang.org/x/sync/errgroup.(*Group).Go": false,
+	} {
+		if got := isStdlibFunction(name); got != want {
+			t.Errorf("isStdlibFunction(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
+
+// TestMergeProfiles 测试合并多个同类型 profile：相同函数的值相加，样本类型不一致时拒绝合并
+func TestMergeProfiles(t *testing.T) {
+	instances := []*profile.Profile{
+		newCPUProfile(map[string]int64{"main.handle": 100, "main.encode": 40}),
+		newCPUProfile(map[string]int64{"main.handle": 200}),
+		newCPUProfile(map[string]int64{"main.handle": 50, "main.gc": 10}),
+	}
+	for i, p := range instances {
+		p.DurationNanos = int64(i+1) * 1000
+	}
+
+	merged, err := MergeProfiles(instances)
+	if err != nil {
+		t.Fatalf("MergeProfiles() error = %v", err)
+	}
+	values := make(map[string]int64)
+	for _, s := range merged.Sample {
+		values[s.Location[0].Line[0].Function.Name] += s.Value[0]
+	}
+	want := map[string]int64{"main.handle": 350, "main.encode": 40, "main.gc": 10}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("merged value of %s = %d, want %d", name, values[name], v)
+		}
+	}
+	if merged.DurationNanos != 6000 {
+		t.Errorf("merged DurationNanos = %d, want 6000", merged.DurationNanos)
+	}
+	if len(instances[1].Sample) != 1 || instances[1].Sample[0].Value[0] != 200 {
+		t.Error("MergeProfiles should not modify its inputs")
+	}
+
+	heap := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}},
+		PeriodType: &profile.ValueType{Type: "space", Unit: "bytes"},
+	}
+	_, err = MergeProfiles([]*profile.Profile{instances[0], heap})
+	if err == nil {
+		t.Fatal("Expected error when merging profiles with different sample types")
+	}
+	if !containsString(err.Error(), "profile #2") || !containsString(err.Error(), "inuse_space/bytes") || !containsString(err.Error(), "cpu/nanoseconds") {
+		t.Errorf("Error should describe the mismatching sample types, got: %v", err)
+	}
+
+	noPeriod := newCPUProfile(map[string]int64{"main.handle": 1})
+	noPeriod.PeriodType = nil
+	if _, err := MergeProfiles([]*profile.Profile{instances[0], noPeriod}); err == nil {
+		t.Error("Expected error when merging profiles with different period types")
+	}
+	if _, err := MergeProfiles(nil); err == nil {
+		t.Error("Expected error when merging no profiles")
+	}
+}
+
+// TestAggregateByPackage 测试按包汇总后各分析器都按包排序，同一个包的值相加
+func TestAggregateByPackage(t *testing.T) {
+	fn := func(id uint64, name string) *profile.Function {
+		return &profile.Function{ID: id, Name: name, Filename: "x.go"}
+	}
+	handle, encode := fn(1, "github.com/app/api.(*Server).Handle"), fn(2, "github.com/app/api.encode")
+	marshal, malloc := fn(3, "encoding/json.Marshal"), fn(4, "runtime.mallocgc")
+	loc := func(id uint64, fns ...*profile.Function) *profile.Location {
+		l := &profile.Location{ID: id}
+		for _, f := range fns {
+			l.Line = append(l.Line, profile.Line{Function: f, Line: 10})
+		}
+		return l
+	}
+	// Location 1 中 encode 内联进了 Handle，两帧属于同一个包
+	apiLoc, jsonLoc, mallocLoc := loc(1, encode, handle), loc(2, marshal), loc(3, malloc)
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{handle, encode, marshal, malloc},
+		Location:   []*profile.Location{apiLoc, jsonLoc, mallocLoc},
+		Sample: []*profile.Sample{
+			{Value: []int64{1, 40}, Location: []*profile.Location{apiLoc}},
+			{Value: []int64{1, 35}, Location: []*profile.Location{jsonLoc, apiLoc}},
+			{Value: []int64{1, 30}, Location: []*profile.Location{mallocLoc, jsonLoc, apiLoc}},
+		},
+	}
+
+	aggregated := AggregateByPackage(p)
+	if p.Function[0].Name != "github.com/app/api.(*Server).Handle" {
+		t.Fatal("AggregateByPackage modified the original profile")
+	}
+	if len(aggregated.Function) != 3 {
+		t.Errorf("Expected 3 package functions, got %d", len(aggregated.Function))
+	}
+	if lines := aggregated.Location[0].Line; len(lines) != 1 || lines[0].Function.Name != "github.com/app/api" {
+		t.Errorf("Expected inlined frames of the same package to collapse into one, got %+v", lines)
+	}
+
+	// 按函数时 api 包的两个函数各占一行；按包时只有一行 api，值为两者之和
+	values, _, _, err := aggregateValues(context.Background(), aggregated, 1, AggregationCumulative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["github.com/app/api"] != 105 || values["encoding/json"] != 65 || values["runtime"] != 30 {
+		t.Errorf("Unexpected cumulative package values: %v", values)
+	}
+	out, err := AnalyzeMutexProfile(aggregated, 5, "text")
+	if err != nil {
+		t.Fatalf("AnalyzeMutexProfile() error = %v", err)
+	}
+	if !containsString(out, "github.com/app/api") || containsString(out, "Handle") {
+		t.Errorf("Expected the mutex report to list packages, got:\n%s", out)
+	}
+}
+
+// TestCleanFunctionNames 测试去掉闭包后缀、折叠泛型参数和去掉 module path 前缀
+func TestCleanFunctionNames(t *testing.T) {
+	all := CleanNamesOptions{TrimClosures: true, CollapseGenerics: true, StripPrefix: "github.com/acme/svc/"}
+	tests := []struct {
+		name string
+		opts CleanNamesOptions
+		want string
+	}{
+		{"main.(*Server).handle.func1.2", CleanNamesOptions{TrimClosures: true}, "main.(*Server).handle"},
+		{"main.handle.func1.func2", CleanNamesOptions{TrimClosures: true}, "main.handle"},
+		{"main.glob..func1", CleanNamesOptions{TrimClosures: true}, "main.glob"},
+		{"main.run.gowrap1", CleanNamesOptions{TrimClosures: true}, "main.run"},
+		{"main.function2", CleanNamesOptions{TrimClosures: true}, "main.function2"},
+		{"main.Map[go.shape.int,go.shape.string]", CleanNamesOptions{CollapseGenerics: true}, "main.Map[...]"},
+		{"main.(*Cache[go.shape.struct { K []int }]).Get", CleanNamesOptions{CollapseGenerics: true}, "main.(*Cache[...]).Get"},
+		{"main.broken[int", CleanNamesOptions{CollapseGenerics: true}, "main.broken[int"},
+		{"github.com/acme/svc/internal/db.(*Pool[go.shape.int]).Get.func3", all, "internal/db.(*Pool[...]).Get"},
+		{"github.com/acme/svc.Run", all, "svc.Run"},
+		{"github.com/acme/svcfoo.Run", all, "github.com/acme/svcfoo.Run"},
+		{"main.handle.func1", CleanNamesOptions{}, "main.handle.func1"},
+	}
+	for _, tt := range tests {
+		if got := CleanFunctionName(tt.name, tt.opts); got != tt.want {
+			t.Errorf("CleanFunctionName(%q, %+v) = %q, want %q", tt.name, tt.opts, got, tt.want)
+		}
+	}
+
+	// 清理后方法和它的闭包合并为同一项
+	p := newCPUProfile(map[string]int64{"main.handle": 100, "main.handle.func1": 200, "main.other": 50})
+	cleaned := CleanFunctionNames(p, CleanNamesOptions{TrimClosures: true})
+	result, err := CPUProfileStats(cleaned, 5, CPUAnalysisOptions{})
+	if err != nil {
+		t.Fatalf("CPUProfileStats() error = %v", err)
+	}
+	if len(result.Functions) != 2 || result.Functions[0].FunctionName != "main.handle" || result.Functions[0].FlatValue != 300 {
+		t.Errorf("Unexpected functions after cleaning: %+v", result.Functions)
+	}
+	original := 0
+	for _, fn := range p.Function {
+		if fn.Name == "main.handle.func1" {
+			original++
+		}
+	}
+	if original != 1 {
+		t.Error("Original profile should not be modified")
+	}
+}
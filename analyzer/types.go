@@ -11,54 +11,97 @@ type ErrorResult struct {
 // CPUFunctionStat 代表 CPU 分析中的单个函数统计信息 (JSON)
 type CPUFunctionStat struct {
 	FunctionName       string  `json:"functionName"`
-	FlatValue          int64   `json:"flatValue"`          // 原始值
-	FlatValueFormatted string  `json:"flatValueFormatted"` // 格式化后的值 (e.g., "1.23s")
-	Percentage         float64 `json:"percentage"`         // 占总量的百分比
+	FunctionID         string  `json:"functionId"`                // 完整函数名的稳定哈希，用于跨报告关联
+	FlatValue          int64   `json:"flatValue"`                 // 原始值
+	FlatValueFormatted string  `json:"flatValueFormatted"`        // 格式化后的值 (e.g., "1.23s")
+	Percentage         float64 `json:"percentage"`                // 占总量的百分比
+	SumPercentage      float64 `json:"sumPercentage"`             // 按列表顺序累加到该函数为止的 Flat 值占总量的百分比 (pprof 的 sum%)
+	CumValue           int64   `json:"cumValue"`                  // 函数出现在调用栈任意位置的样本总值 (含调用的函数)
+	CumValueFormatted  string  `json:"cumValueFormatted"`         // 格式化后的 Cum 值
+	CumPercentage      float64 `json:"cumPercentage"`             // Cum 值占总量的百分比
+	FileName           string  `json:"fileName,omitempty"`        // 源文件 (仅在 include_source_location 时输出)
+	LineNumber         int64   `json:"lineNumber,omitempty"`      // 源代码行号 (仅在 include_source_location 时输出)
+	CPUSeconds         float64 `json:"cpuSeconds,omitempty"`      // CPU 时间 (秒，仅在按采集时长归一化时输出)
+	WallTimePercent    float64 `json:"wallTimePercent,omitempty"` // 占采集墙钟时间的百分比，超过 100% 表示使用了多个核心 (仅在归一化时输出)
 }
 
 // CPUAnalysisResult 代表 CPU 分析的整体结果 (JSON)
 type CPUAnalysisResult struct {
-	ProfileType         string            `json:"profileType"`
-	ValueType           string            `json:"valueType"`                    // e.g., "cpu", "samples"
-	ValueUnit           string            `json:"valueUnit"`                    // e.g., "nanoseconds", "count"
-	TotalValue          int64             `json:"totalValue"`                   // 样本总值
-	TotalValueFormatted string            `json:"totalValueFormatted"`          // 格式化后的总值
-	TotalDurationNanos  int64             `json:"totalDurationNanos,omitempty"` // 可选的总持续时间 (纳秒)
-	TopN                int               `json:"topN"`                         // 返回的 Top N 数量
-	Functions           []CPUFunctionStat `json:"functions"`                    // Top N 函数列表
+	ProfileType          string              `json:"profileType"`
+	ValueType            string              `json:"valueType"`                      // e.g., "cpu", "samples"
+	ValueUnit            string              `json:"valueUnit"`                      // e.g., "nanoseconds", "count"
+	TotalValue           int64               `json:"totalValue"`                     // 样本总值
+	TotalValueFormatted  string              `json:"totalValueFormatted"`            // 格式化后的总值
+	TotalDurationNanos   int64               `json:"totalDurationNanos,omitempty"`   // 可选的总持续时间 (纳秒)
+	TopN                 int                 `json:"topN"`                           // 返回的 Top N 数量
+	Functions            []CPUFunctionStat   `json:"functions"`                      // Top N 函数列表
+	CaptureConfig        *CaptureConfig      `json:"captureConfig,omitempty"`        // 从 profile 推断的采集配置
+	DurationNormalized   bool                `json:"durationNormalized,omitempty"`   // 是否已按采集时长 (DurationNanos) 归一化
+	TotalCPUSeconds      float64             `json:"totalCpuSeconds,omitempty"`      // 总 CPU 时间 (秒，仅在归一化时输出)
+	TotalWallTimePercent float64             `json:"totalWallTimePercent,omitempty"` // 总 CPU 时间占采集墙钟时间的百分比 (仅在归一化时输出)
+	NormalizationWarning string              `json:"normalizationWarning,omitempty"` // 请求了归一化但无法进行时的原因
+	NoiseFilter          *NoiseFilterSummary `json:"noiseFilter,omitempty"`          // 按 MinPercent 过滤掉的长尾函数 (设置了 MinPercent 时)
+	SkippedSamples       *SkippedSamples     `json:"skippedSamples,omitempty"`       // 没有调用栈或缺少样本值而被跳过的样本 (有样本被跳过时)
+	SortBy               string              `json:"sortBy,omitempty"`               // 显式指定的函数列表排序方式 (见 FunctionSortKeys)，为空时按 Flat 时间排序
+	numbers              NumberFormatter     // 生成格式化字段时使用的数值格式，Format 函数沿用同一格式
 }
 
 // HeapFunctionStat 代表 Heap 分析中的单个函数统计信息 (JSON)
 type HeapFunctionStat struct {
-	FunctionName   string  `json:"functionName"`
-	Value          int64   `json:"value"`          // 原始值 (bytes)
-	ValueFormatted string  `json:"valueFormatted"` // 格式化后的值 (e.g., "1.23 MiB")
-	Percentage     float64 `json:"percentage"`     // 占总量的百分比
+	FunctionName      string  `json:"functionName"`
+	FunctionID        string  `json:"functionId"`        // 完整函数名的稳定哈希，用于跨报告关联
+	Value             int64   `json:"value"`             // 原始值 (bytes)
+	ValueFormatted    string  `json:"valueFormatted"`    // 格式化后的值 (e.g., "1.23 MiB")
+	Percentage        float64 `json:"percentage"`        // 占总量的百分比
+	SumPercentage     float64 `json:"sumPercentage"`     // 按列表顺序累加到该函数为止的值占总量的百分比 (pprof 的 sum%)
+	CumValue          int64   `json:"cumValue"`          // 函数出现在分配调用栈任意位置的总值 (bytes，含调用的函数)
+	CumValueFormatted string  `json:"cumValueFormatted"` // 格式化后的 Cum 值
+	CumPercentage     float64 `json:"cumPercentage"`     // Cum 值占总量的百分比
+	ObjectCount       int64   `json:"-"`                 // 对象数量，只在文本输出中展示
 }
 
 // HeapAnalysisResult 代表 Heap 分析的整体结果 (JSON)
 type HeapAnalysisResult struct {
-	ProfileType         string             `json:"profileType"`
-	ValueType           string             `json:"valueType"`           // e.g., "inuse_space", "alloc_space"
-	ValueUnit           string             `json:"valueUnit"`           // e.g., "bytes"
-	TotalValue          int64              `json:"totalValue"`          // 总值 (bytes)
-	TotalValueFormatted string             `json:"totalValueFormatted"` // 格式化后的总值
-	TopN                int                `json:"topN"`                // 返回的 Top N 数量
-	Functions           []HeapFunctionStat `json:"functions"`           // Top N 函数列表
+	ProfileType         string              `json:"profileType"`
+	ValueType           string              `json:"valueType"`                 // e.g., "inuse_space", "alloc_space"
+	ValueUnit           string              `json:"valueUnit"`                 // e.g., "bytes"
+	TotalValue          int64               `json:"totalValue"`                // 总值 (bytes)
+	TotalValueFormatted string              `json:"totalValueFormatted"`       // 格式化后的总值
+	TotalObjects        int64               `json:"totalObjects,omitempty"`    // 对象总数 (profile 包含对象计数时)
+	TopN                int                 `json:"topN"`                      // 返回的 Top N 数量
+	Functions           []HeapFunctionStat  `json:"functions"`                 // Top N 函数列表
+	AllocationSites     []AllocSiteStat     `json:"allocationSites,omitempty"` // Top N 分配位置 (函数+文件+行号)
+	Types               []TypeStat          `json:"types,omitempty"`           // Top N 对象类型 (样本带有 type/object 标签时)
+	SizeBuckets         []HeapSizeBucket    `json:"sizeBuckets,omitempty"`     // 按平均对象大小汇总的分配位置 (HeapAnalysisOptions.SizeBuckets 时)
+	CaptureConfig       *CaptureConfig      `json:"captureConfig,omitempty"`   // 从 profile 推断的采集配置
+	NoiseFilter         *NoiseFilterSummary `json:"noiseFilter,omitempty"`     // 按 MinPercent 过滤掉的长尾函数 (设置了 MinPercent 时)
+	SkippedSamples      *SkippedSamples     `json:"skippedSamples,omitempty"`  // 没有调用栈或缺少样本值而被跳过的样本 (有样本被跳过时)
+	SortBy              string              `json:"sortBy,omitempty"`          // 显式指定的函数列表排序方式 (见 FunctionSortKeys)，为空时按 Flat 值排序
+	numbers             NumberFormatter     // 生成格式化字段时使用的数值格式，Format 函数沿用同一格式
 }
 
 // GoroutineStackInfo 代表 Goroutine 分析中的单个堆栈信息 (JSON)
 type GoroutineStackInfo struct {
-	Count      int64    `json:"count"`      // 具有此堆栈的 Goroutine 数量
-	StackTrace []string `json:"stackTrace"` // 格式化的堆栈跟踪行
+	Count         int64    `json:"count"`         // 具有此堆栈的 Goroutine 数量
+	Samples       int      `json:"samples"`       // 合并到此堆栈的样本数 (profile 中调用栈完全相同的样本)
+	Percentage    float64  `json:"percentage"`    // 占 Goroutine 总数的百分比
+	SumPercentage float64  `json:"sumPercentage"` // 按列表顺序累加到该堆栈为止的 Goroutine 数占总数的百分比
+	StackTrace    []string `json:"stackTrace"`    // 格式化的堆栈跟踪行
 }
 
 // GoroutineAnalysisResult 代表 Goroutine 分析的整体结果 (JSON)
 type GoroutineAnalysisResult struct {
 	ProfileType     string               `json:"profileType"`
+	ValueType       string               `json:"-"` // 样本类型 (e.g., "goroutine")，只在文本输出中展示
+	ValueUnit       string               `json:"-"` // 样本单位 (e.g., "count")，只在文本输出中展示
 	TotalGoroutines int64                `json:"totalGoroutines"`
-	TopN            int                  `json:"topN"`   // 返回的 Top N 数量
-	Stacks          []GoroutineStackInfo `json:"stacks"` // Top N 堆栈列表
+	UniqueStacks    int                  `json:"uniqueStacks"`             // 按调用栈去重后的堆栈数
+	TopN            int                  `json:"topN"`                     // 返回的 Top N 数量
+	Stacks          []GoroutineStackInfo `json:"stacks"`                   // Top N 堆栈列表
+	CaptureConfig   *CaptureConfig       `json:"captureConfig,omitempty"`  // 从 profile 推断的采集配置
+	StateBreakdown  map[string]int       `json:"stateBreakdown"`           // 每种状态 (chan receive、select、IO wait 等) 的 goroutine 数量
+	SkippedSamples  *SkippedSamples      `json:"skippedSamples,omitempty"` // 没有调用栈或缺少样本值而未计入堆栈列表的样本 (有样本被跳过时)
+	numbers         NumberFormatter      // 生成格式化字段时使用的数值格式，Format 函数沿用同一格式
 }
 
 // FlameGraphNode 代表火焰图中的一个节点 (JSON)
@@ -83,9 +126,10 @@ type FlameGraphNode struct {
 // functionStat 保存函数的聚合统计信息。
 // 注意：保持未导出，因为它只在包内部使用。
 type functionStat struct {
-	Name string
-	Flat int64 // 函数自身的消耗值 (例如 CPU 时间、内存分配)
-	Cum  int64 // 函数及其调用链的总消耗值 (当前未使用)
+	Name   string
+	Flat   int64           // 函数自身的消耗值 (例如 CPU 时间、内存分配)
+	Cum    int64           // 函数出现在调用栈任意位置的样本总值 (含调用的函数)
+	Source *sourceLocation // 按源文件位置聚合时热点所在的函数和位置，否则为 nil
 }
 
 // stackInfo 结构体已移至 goroutine.go
@@ -97,6 +141,7 @@ type AllocSiteStat struct {
 	ValueFormatted   string  `json:"valueFormatted"`
 	ObjectCount      int64   `json:"objectCount,omitempty"`
 	Percentage       float64 `json:"percentage"`
+	SumPercentage    float64 `json:"sumPercentage"`
 	AvgSize          int64   `json:"avgSize,omitempty"`
 	AvgSizeFormatted string  `json:"avgSizeFormatted,omitempty"`
 }
@@ -108,6 +153,7 @@ type TypeStat struct {
 	ValueFormatted   string  `json:"valueFormatted"`
 	ObjectCount      int64   `json:"objectCount,omitempty"`
 	Percentage       float64 `json:"percentage"`
+	SumPercentage    float64 `json:"sumPercentage"`
 	AvgSize          int64   `json:"avgSize,omitempty"`
 	AvgSizeFormatted string  `json:"avgSizeFormatted,omitempty"`
 }
@@ -0,0 +1,196 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// profile 校验问题的类别
+const (
+	ValidationParse      = "parse"       // profile 文件无法解析 (由调用方在加载失败时填写)
+	ValidationCheckValid = "check_valid" // profile.CheckValid 报告的问题
+	ValidationValueCount = "value_count" // 样本值的数量与样本类型的数量不一致
+	ValidationReference  = "reference"   // 引用了 profile 表中不存在的 Location、Function 或 Mapping
+	ValidationUnit       = "unit"        // 无法识别的样本类型单位
+)
+
+// maxValidationExamples 是每类问题最多逐条列出的数量，超出的部分合并为一条计数
+const maxValidationExamples = 5
+
+// recognizedUnits 是 pprof 能够换算和展示的样本单位 (与 go tool pprof 识别的时间、内存和计数单位一致)
+var recognizedUnits = map[string]bool{
+	"nanoseconds": true, "microseconds": true, "milliseconds": true, "seconds": true, "minutes": true, "hours": true,
+	"ns": true, "us": true, "ms": true, "s": true,
+	"bytes": true, "kilobytes": true, "megabytes": true, "gigabytes": true, "terabytes": true,
+	"b": true, "kb": true, "mb": true, "gb": true, "tb": true,
+	"count": true,
+}
+
+// ValidationProblem 是校验发现的一个问题 (JSON)
+type ValidationProblem struct {
+	Check   string `json:"check"` // 问题类别，见 ValidationParse 等常量
+	Message string `json:"message"`
+}
+
+// ProfileValidation 是 validate_profile 的结果 (JSON)
+type ProfileValidation struct {
+	Valid       bool                `json:"valid"`
+	SampleCount int                 `json:"sampleCount"`
+	Problems    []ValidationProblem `json:"problems,omitempty"`
+}
+
+// ValidateProfile 检查 profile 的内部一致性：先执行 profile.CheckValid，再逐项检查
+// 每个样本的值数量与样本类型数量一致、样本和 Location 引用的 Location、Function、Mapping 都在 profile 的表中，
+// 以及样本类型和采样周期的单位可以识别。与 CheckValid 只返回第一个错误不同，这里列出所有问题。
+func ValidateProfile(p *profile.Profile) ProfileValidation {
+	logDebug("Validating profile with %d samples", len(p.Sample))
+	v := ProfileValidation{SampleCount: len(p.Sample)}
+	if err := p.CheckValid(); err != nil {
+		v.Problems = append(v.Problems, ValidationProblem{Check: ValidationCheckValid, Message: err.Error()})
+	}
+	v.Problems = append(v.Problems, checkValueCounts(p)...)
+	v.Problems = append(v.Problems, checkReferences(p)...)
+	v.Problems = append(v.Problems, checkUnits(p)...)
+	v.Valid = len(v.Problems) == 0
+	return v
+}
+
+// validationCollector 按类别收集问题，每类只保留前 maxValidationExamples 条，其余只计数
+type validationCollector struct {
+	check    string
+	problems []ValidationProblem
+	omitted  int
+}
+
+// add 记录一个问题
+func (c *validationCollector) add(format string, args ...any) {
+	if len(c.problems) == maxValidationExamples {
+		c.omitted++
+		return
+	}
+	c.problems = append(c.problems, ValidationProblem{Check: c.check, Message: fmt.Sprintf(format, args...)})
+}
+
+// result 返回收集到的问题，有被省略的问题时追加一条计数
+func (c *validationCollector) result() []ValidationProblem {
+	if c.omitted > 0 {
+		c.problems = append(c.problems, ValidationProblem{Check: c.check, Message: fmt.Sprintf("另有 %d 个同类问题未列出", c.omitted)})
+	}
+	return c.problems
+}
+
+// checkValueCounts 检查每个样本的 len(Value) 是否等于 len(SampleType)
+func checkValueCounts(p *profile.Profile) []ValidationProblem {
+	c := validationCollector{check: ValidationValueCount}
+	if len(p.SampleType) == 0 && len(p.Sample) > 0 {
+		c.add("profile 有 %d 个样本，但没有定义任何样本类型", len(p.Sample))
+		return c.result()
+	}
+	for i, s := range p.Sample {
+		if s != nil && len(s.Value) != len(p.SampleType) {
+			c.add("样本 #%d 有 %d 个值，而 profile 定义了 %d 个样本类型 (%s)", i, len(s.Value), len(p.SampleType), sampleTypeNames(p))
+		}
+	}
+	return c.result()
+}
+
+// checkReferences 检查样本引用的 Location、Location 引用的 Function 和 Mapping 是否都在 profile 的表中。
+// 只比较指针是否属于表，ID 重复和保留 ID 0 由 CheckValid 报告。
+func checkReferences(p *profile.Profile) []ValidationProblem {
+	c := validationCollector{check: ValidationReference}
+	locations := make(map[*profile.Location]bool, len(p.Location))
+	for _, loc := range p.Location {
+		locations[loc] = true
+	}
+	functions := make(map[*profile.Function]bool, len(p.Function))
+	for _, fn := range p.Function {
+		functions[fn] = true
+	}
+	mappings := make(map[*profile.Mapping]bool, len(p.Mapping))
+	for _, m := range p.Mapping {
+		mappings[m] = true
+	}
+
+	for i, s := range p.Sample {
+		if s == nil {
+			continue
+		}
+		for _, loc := range s.Location {
+			switch {
+			case loc == nil:
+				c.add("样本 #%d 引用了空的 Location", i)
+			case !locations[loc]:
+				c.add("样本 #%d 引用的 Location %d 不在 profile 的 Location 表中", i, loc.ID)
+			}
+		}
+	}
+	for _, loc := range p.Location {
+		if loc == nil {
+			continue
+		}
+		if loc.Mapping != nil && !mappings[loc.Mapping] {
+			c.add("Location %d 引用的 Mapping %d (%s) 不在 profile 的 Mapping 表中", loc.ID, loc.Mapping.ID, loc.Mapping.File)
+		}
+		for _, line := range loc.Line {
+			switch {
+			case line.Function == nil:
+				c.add("Location %d 的调用行没有 Function", loc.ID)
+			case !functions[line.Function]:
+				c.add("Location %d 引用的 Function %d (%s) 不在 profile 的 Function 表中", loc.ID, line.Function.ID, line.Function.Name)
+			}
+		}
+	}
+	return c.result()
+}
+
+// checkUnits 检查样本类型和采样周期的单位是否可以识别
+func checkUnits(p *profile.Profile) []ValidationProblem {
+	c := validationCollector{check: ValidationUnit}
+	for _, st := range p.SampleType {
+		if !recognizedUnits[strings.ToLower(st.Unit)] {
+			c.add("样本类型 %s 的单位 '%s' 无法识别，数值将无法按时间或字节换算", st.Type, st.Unit)
+		}
+	}
+	if p.PeriodType != nil && p.PeriodType.Unit != "" && !recognizedUnits[strings.ToLower(p.PeriodType.Unit)] {
+		c.add("采样周期类型 %s 的单位 '%s' 无法识别", p.PeriodType.Type, p.PeriodType.Unit)
+	}
+	return c.result()
+}
+
+// FormatProfileValidation 将校验结果格式化为 text、markdown 或 json 输出
+func FormatProfileValidation(v ProfileValidation, format string) (string, error) {
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		var b strings.Builder
+		if format == "markdown" {
+			b.WriteString("# Profile 校验\n\n")
+		} else {
+			b.WriteString("Profile 校验\n")
+			b.WriteString("============\n\n")
+		}
+		if v.Valid {
+			b.WriteString(fmt.Sprintf("valid: 未发现问题 (%d 个样本)。\n", v.SampleCount))
+			return b.String(), nil
+		}
+		b.WriteString("invalid: profile 存在以下问题。\n\n")
+		for _, problem := range v.Problems {
+			if format == "markdown" {
+				b.WriteString(fmt.Sprintf("- **%s**: %s\n", problem.Check, problem.Message))
+			} else {
+				b.WriteString(fmt.Sprintf("[%s] %s\n", problem.Check, problem.Message))
+			}
+		}
+		return b.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
@@ -0,0 +1,50 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestValidateProfile 测试校验能发现值数量不一致、引用缺失和无法识别的单位，并对合法的 profile 返回 valid
+func TestValidateProfile(t *testing.T) {
+	valid := newCPUProfile(map[string]int64{"main.a": 10, "main.b": 20})
+	if v := ValidateProfile(valid); !v.Valid || len(v.Problems) != 0 || v.SampleCount != 2 {
+		t.Errorf("ValidateProfile(valid) = %+v", v)
+	}
+
+	broken := newCPUProfile(map[string]int64{"main.a": 10})
+	broken.SampleType = append(broken.SampleType, &profile.ValueType{Type: "widgets", Unit: "furlongs"})
+	orphanFn := &profile.Function{ID: 99, Name: "main.orphan"}
+	orphanLoc := &profile.Location{ID: 99, Line: []profile.Line{{Function: orphanFn}}}
+	for i := 0; i < maxValidationExamples+2; i++ {
+		broken.Sample = append(broken.Sample, &profile.Sample{Location: []*profile.Location{orphanLoc}, Value: []int64{1, 2}})
+	}
+	v := ValidateProfile(broken)
+	if v.Valid {
+		t.Fatalf("ValidateProfile(broken) is valid")
+	}
+	counts := make(map[string]int)
+	for _, p := range v.Problems {
+		counts[p.Check]++
+	}
+	// 第一个样本只有 1 个值；其余样本引用了不在表中的 Location，超过 maxValidationExamples 的部分合并为一条
+	if counts[ValidationCheckValid] != 1 || counts[ValidationValueCount] != 1 || counts[ValidationUnit] != 1 ||
+		counts[ValidationReference] != maxValidationExamples+1 {
+		t.Errorf("problem counts = %v, problems = %+v", counts, v.Problems)
+	}
+
+	text, err := FormatProfileValidation(v, "text")
+	if err != nil {
+		t.Fatalf("FormatProfileValidation() error = %v", err)
+	}
+	for _, want := range []string{"invalid", "[unit] 样本类型 widgets 的单位 'furlongs' 无法识别", "Location 99 不在 profile 的 Location 表中", "另有 2 个同类问题未列出"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text output missing %q:\n%s", want, text)
+		}
+	}
+	if _, err := FormatProfileValidation(v, "compact"); err == nil {
+		t.Error("FormatProfileValidation(compact) should report an unsupported format")
+	}
+}
@@ -0,0 +1,188 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// 优化收益估算的归因方式
+const (
+	// AttributionFlat 只计入函数自身的 (flat) 值，即函数作为叶子帧时的样本
+	AttributionFlat = "flat"
+	// AttributionCumulative 计入函数及其调用的所有函数的 (cum) 值
+	AttributionCumulative = "cumulative"
+)
+
+// ImpactEstimate 是 "如果把 X 优化 N%，总值会下降多少" 的估算结果 (JSON)
+type ImpactEstimate struct {
+	ProfileType        string  `json:"profileType"`
+	Function           string  `json:"function"`
+	FunctionID         string  `json:"functionId"` // 完整函数名的稳定哈希，用于跨报告关联
+	ValueType          string  `json:"valueType"`
+	ValueUnit          string  `json:"valueUnit"`
+	Attribution        string  `json:"attribution"`
+	ReductionPercent   float64 `json:"reductionPercent"`
+	Total              int64   `json:"total"`
+	FlatValue          int64   `json:"flatValue"`
+	CumulativeValue    int64   `json:"cumulativeValue"`
+	AttributedValue    int64   `json:"attributedValue"` // 按所选归因方式参与估算的值
+	SavedValue         int64   `json:"savedValue"`
+	NewTotal           int64   `json:"newTotal"`
+	ImprovementPercent float64 `json:"improvementPercent"` // 总值下降的百分比
+}
+
+// EstimateOptimizationImpact 估算将 function 的开销降低 reductionPercent% 后 profile 总值的变化。
+// 默认 (flat) 只按函数自身的开销估算；cumulative 时按函数及其调用的函数的全部开销估算，
+// 这对应于 "整个调用子树都变快"，通常会高估只优化函数本身时的收益。
+// function 优先精确匹配函数名，否则使用唯一包含该字符串的函数名。
+func EstimateOptimizationImpact(p *profile.Profile, profileType, function string, reductionPercent float64, attribution, format string) (string, error) {
+	return EstimateOptimizationImpactContext(context.Background(), p, profileType, function, reductionPercent, attribution, format)
+}
+
+// EstimateOptimizationImpactContext 与 EstimateOptimizationImpact 相同，但在聚合样本时定期检查 ctx，ctx 被取消时尽快停止
+func EstimateOptimizationImpactContext(ctx context.Context, p *profile.Profile, profileType, function string, reductionPercent float64, attribution, format string) (string, error) {
+	if reductionPercent <= 0 || reductionPercent > 100 {
+		return "", fmt.Errorf("reduction_percent 必须在 (0, 100] 范围内，当前为 %v", reductionPercent)
+	}
+	if attribution == "" {
+		attribution = AttributionFlat
+	}
+	if attribution != AttributionFlat && attribution != AttributionCumulative {
+		return "", fmt.Errorf("unsupported attribution: %s (expected flat or cumulative)", attribution)
+	}
+	logDebug("Estimating optimization impact: type=%s, function=%s, reduction=%.1f%%, attribution=%s",
+		profileType, function, reductionPercent, attribution)
+
+	valueIndex, _, err := findValueColumn(p, profileType)
+	if err != nil {
+		return "", err
+	}
+	st := p.SampleType[valueIndex]
+
+	flat, _, total, err := aggregateValues(ctx, p, valueIndex, AggregationLeaf)
+	if err != nil {
+		return "", err
+	}
+	cumulative, _, _, err := aggregateValues(ctx, p, valueIndex, AggregationCumulative)
+	if err != nil {
+		return "", err
+	}
+	name, err := resolveFunctionName(cumulative, function)
+	if err != nil {
+		return "", err
+	}
+
+	estimate := ImpactEstimate{
+		ProfileType:      profileType,
+		Function:         name,
+		FunctionID:       FunctionID(name),
+		ValueType:        st.Type,
+		ValueUnit:        st.Unit,
+		Attribution:      attribution,
+		ReductionPercent: reductionPercent,
+		Total:            total,
+		FlatValue:        flat[name],
+		CumulativeValue:  cumulative[name],
+	}
+	estimate.AttributedValue = estimate.FlatValue
+	if attribution == AttributionCumulative {
+		estimate.AttributedValue = estimate.CumulativeValue
+	}
+	estimate.SavedValue = int64(float64(estimate.AttributedValue) * reductionPercent / 100)
+	estimate.NewTotal = total - estimate.SavedValue
+	if total != 0 {
+		estimate.ImprovementPercent = float64(estimate.SavedValue) / float64(total) * 100
+	}
+
+	switch format {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(estimate, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return string(jsonBytes), nil
+	case "text", "markdown":
+		return formatImpactEstimate(estimate, format), nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// resolveFunctionName 在 profile 的函数名中查找 function：优先精确匹配，否则要求只有一个函数名包含该字符串
+func resolveFunctionName(values map[string]int64, function string) (string, error) {
+	if _, ok := values[function]; ok {
+		return function, nil
+	}
+	var matches []string
+	for name := range values {
+		if strings.Contains(name, function) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if values[matches[i]] != values[matches[j]] {
+			return values[matches[i]] > values[matches[j]]
+		}
+		return matches[i] < matches[j]
+	})
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("profile 中没有函数 %s", function)
+	case 1:
+		return matches[0], nil
+	default:
+		if len(matches) > 5 {
+			matches = append(matches[:5], "...")
+		}
+		return "", fmt.Errorf("函数名 %s 匹配到多个函数，请使用完整的函数名: %s", function, strings.Join(matches, ", "))
+	}
+}
+
+// formatImpactEstimate 将估算结果格式化为文本或 Markdown
+func formatImpactEstimate(e ImpactEstimate, format string) string {
+	var b strings.Builder
+	percent := func(v int64) float64 {
+		if e.Total == 0 {
+			return 0
+		}
+		return float64(v) / float64(e.Total) * 100
+	}
+	lines := [][2]string{
+		{"函数", sanitizeName(e.Function)},
+		{"样本类型", e.ValueType + "/" + e.ValueUnit},
+		{"当前总值", formatUnitValue(e.Total, e.ValueUnit)},
+		{"Flat (自身)", fmt.Sprintf("%s (%.2f%%)", formatUnitValue(e.FlatValue, e.ValueUnit), percent(e.FlatValue))},
+		{"Cumulative (含调用的函数)", fmt.Sprintf("%s (%.2f%%)", formatUnitValue(e.CumulativeValue, e.ValueUnit), percent(e.CumulativeValue))},
+		{"假设", fmt.Sprintf("开销降低 %g%% (按 %s 归因)", e.ReductionPercent, e.Attribution)},
+		{"预计节省", formatUnitValue(e.SavedValue, e.ValueUnit)},
+		{"优化后总值", formatUnitValue(e.NewTotal, e.ValueUnit)},
+		{"总体改善", fmt.Sprintf("%.2f%%", e.ImprovementPercent)},
+	}
+
+	if format == "markdown" {
+		b.WriteString(fmt.Sprintf("# 优化收益估算 (%s)\n\n", e.ProfileType))
+		for _, l := range lines {
+			b.WriteString(fmt.Sprintf("- **%s**: %s\n", l[0], l[1]))
+		}
+	} else {
+		b.WriteString(fmt.Sprintf("优化收益估算 (%s)\n", e.ProfileType))
+		b.WriteString("==============================\n\n")
+		for _, l := range lines {
+			b.WriteString(fmt.Sprintf("%s: %s\n", l[0], l[1]))
+		}
+	}
+
+	b.WriteString(fmt.Sprintf("\n如果将 %s 优化 %g%%，总值预计从 %s 降至 %s，下降 %.2f%%。\n",
+		sanitizeName(e.Function), e.ReductionPercent, formatUnitValue(e.Total, e.ValueUnit), formatUnitValue(e.NewTotal, e.ValueUnit), e.ImprovementPercent))
+	if e.Attribution == AttributionCumulative {
+		b.WriteString("按 cumulative 归因时假设该函数调用的所有函数同样变快；只优化函数自身时，收益上限为 flat 值。\n")
+	} else if e.CumulativeValue > e.FlatValue {
+		b.WriteString("估算只包含函数自身的开销；如果优化同时减少了它对其它函数的调用，可使用 attribution: cumulative 估算上限。\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestEstimateOptimizationImpact 测试 flat 与 cumulative 两种归因方式下的优化收益估算
+func TestEstimateOptimizationImpact(t *testing.T) {
+	handle := &profile.Function{ID: 1, Name: "main.handle"}
+	encode := &profile.Function{ID: 2, Name: "encoding/json.Marshal"}
+	other := &profile.Function{ID: 3, Name: "main.other"}
+	stack := func(v int64, funcs ...*profile.Function) *profile.Sample {
+		s := &profile.Sample{Value: []int64{v}}
+		for _, f := range funcs {
+			s.Location = append(s.Location, &profile.Location{Line: []profile.Line{{Function: f}}})
+		}
+		return s
+	}
+	// main.handle: flat 200，cumulative 200 + 300 (调用 encoding/json.Marshal)；总值 1000
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			stack(200, handle),
+			stack(300, encode, handle),
+			stack(500, other),
+		},
+	}
+
+	estimate := func(function string, reduction float64, attribution string) ImpactEstimate {
+		t.Helper()
+		out, err := EstimateOptimizationImpact(p, "cpu", function, reduction, attribution, "json")
+		if err != nil {
+			t.Fatalf("EstimateOptimizationImpact() error = %v", err)
+		}
+		var e ImpactEstimate
+		if err := json.Unmarshal([]byte(out), &e); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		return e
+	}
+
+	flat := estimate("main.handle", 50, "")
+	if flat.Attribution != AttributionFlat || flat.FlatValue != 200 || flat.CumulativeValue != 500 {
+		t.Errorf("Unexpected flat estimate: %+v", flat)
+	}
+	if flat.SavedValue != 100 || flat.NewTotal != 900 || flat.ImprovementPercent != 10 {
+		t.Errorf("flat: saved=%d newTotal=%d improvement=%.2f, want 100/900/10", flat.SavedValue, flat.NewTotal, flat.ImprovementPercent)
+	}
+
+	cumulative := estimate("handle", 50, AttributionCumulative)
+	if cumulative.Function != "main.handle" || cumulative.SavedValue != 250 || cumulative.NewTotal != 750 || cumulative.ImprovementPercent != 25 {
+		t.Errorf("Unexpected cumulative estimate: %+v", cumulative)
+	}
+
+	text, err := EstimateOptimizationImpact(p, "cpu", "main.handle", 50, "", "markdown")
+	if err != nil {
+		t.Fatalf("EstimateOptimizationImpact() error = %v", err)
+	}
+	for _, want := range []string{"# 优化收益估算 (cpu)", "下降 10.00%", "attribution: cumulative"} {
+		if !containsString(text, want) {
+			t.Errorf("Markdown result does not contain %q\nGot:\n%s", want, text)
+		}
+	}
+
+	// 子串匹配到多个函数、不存在的函数、超出范围的百分比都应报错
+	for _, c := range []struct {
+		function  string
+		reduction float64
+	}{{"main.", 50}, {"main.missing", 50}, {"main.handle", 0}, {"main.handle", 150}} {
+		if _, err := EstimateOptimizationImpact(p, "cpu", c.function, c.reduction, "", "text"); err == nil {
+			t.Errorf("Expected error for function=%q reduction=%v", c.function, c.reduction)
+		}
+	}
+}
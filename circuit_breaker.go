@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 熔断参数：同一主机在 breakerFailureWindow 内失败达到 breakerFailureThreshold 次后，
+// 在 breakerCooldown 时间内直接拒绝对该主机的请求，避免 agent 反复重试时每次都等待超时。
+const (
+	breakerFailureThreshold = 3
+	breakerFailureWindow    = time.Minute
+	breakerCooldown         = 30 * time.Second
+)
+
+// hostBreakerState 记录单个主机的失败情况
+type hostBreakerState struct {
+	failures  []time.Time // 时间窗口内的失败时间点
+	openUntil time.Time   // 熔断打开的截止时间，零值表示未熔断
+}
+
+// circuitBreaker 按主机跟踪远程 profile 源的失败次数
+type circuitBreaker struct {
+	mu    sync.Mutex
+	hosts map[string]*hostBreakerState
+	now   func() time.Time // 便于替换时钟
+}
+
+// remoteBreaker 是下载远程 profile 时使用的全局熔断器
+var remoteBreaker = newCircuitBreaker()
+
+// newCircuitBreaker 创建一个新的熔断器
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		hosts: make(map[string]*hostBreakerState),
+		now:   time.Now,
+	}
+}
+
+// allow 判断当前是否允许访问 host。
+// 如果熔断处于打开状态，返回 false 以及距离恢复的剩余时间。
+func (cb *circuitBreaker) allow(host string) (bool, time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	state, ok := cb.hosts[host]
+	if !ok {
+		return true, 0
+	}
+
+	now := cb.now()
+	if now.Before(state.openUntil) {
+		return false, state.openUntil.Sub(now)
+	}
+	if !state.openUntil.IsZero() {
+		// 冷却结束，重置状态，允许重新尝试
+		delete(cb.hosts, host)
+	}
+	return true, 0
+}
+
+// recordFailure 记录一次对 host 的失败访问，达到阈值时打开熔断
+func (cb *circuitBreaker) recordFailure(host string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	state, ok := cb.hosts[host]
+	if !ok {
+		state = &hostBreakerState{}
+		cb.hosts[host] = state
+	}
+
+	// 丢弃时间窗口之外的失败记录
+	recent := state.failures[:0]
+	for _, t := range state.failures {
+		if now.Sub(t) <= breakerFailureWindow {
+			recent = append(recent, t)
+		}
+	}
+	state.failures = append(recent, now)
+
+	if len(state.failures) >= breakerFailureThreshold {
+		state.openUntil = now.Add(breakerCooldown)
+		state.failures = nil
+	}
+}
+
+// recordSuccess 记录一次成功访问，清除 host 的失败记录
+func (cb *circuitBreaker) recordSuccess(host string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.hosts, host)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestBreaker 创建一个使用可控时钟的熔断器，返回熔断器和推进时钟的函数
+func newTestBreaker() (*circuitBreaker, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker()
+	cb.now = func() time.Time { return now }
+	return cb, func(d time.Duration) { now = now.Add(d) }
+}
+
+// TestCircuitBreakerOpenAndRecover 测试熔断器从关闭到打开、冷却结束后允许重新尝试 (半开)，成功后回到关闭
+func TestCircuitBreakerOpenAndRecover(t *testing.T) {
+	cb, advance := newTestBreaker()
+	const host = "profiles.example.com"
+
+	for i := 0; i < breakerFailureThreshold; i++ {
+		if ok, _ := cb.allow(host); !ok {
+			t.Fatalf("allow() before failure #%d = false, want true", i+1)
+		}
+		cb.recordFailure(host)
+	}
+	ok, retryAfter := cb.allow(host)
+	if ok || retryAfter != breakerCooldown {
+		t.Fatalf("allow() after %d failures = (%t, %s), want (false, %s)", breakerFailureThreshold, ok, retryAfter, breakerCooldown)
+	}
+	if ok, _ := cb.allow("other.example.com"); !ok {
+		t.Error("an open breaker for one host should not block other hosts")
+	}
+
+	advance(breakerCooldown / 2)
+	if ok, retryAfter := cb.allow(host); ok || retryAfter != breakerCooldown/2 {
+		t.Errorf("allow() during cooldown = (%t, %s), want (false, %s)", ok, retryAfter, breakerCooldown/2)
+	}
+
+	// 冷却结束后放行一次尝试，成功后熔断器关闭，之后的单次失败不会再次打开熔断
+	advance(breakerCooldown / 2)
+	if ok, _ := cb.allow(host); !ok {
+		t.Fatal("allow() after cooldown = false, want true")
+	}
+	cb.recordSuccess(host)
+	cb.recordFailure(host)
+	if ok, _ := cb.allow(host); !ok {
+		t.Error("allow() after recovery and a single failure = false, want true")
+	}
+}
+
+// TestCircuitBreakerFailureThreshold 测试只有时间窗口内的失败计入阈值，成功访问清除失败记录
+func TestCircuitBreakerFailureThreshold(t *testing.T) {
+	cb, advance := newTestBreaker()
+	const host = "profiles.example.com"
+
+	// 窗口之外的失败被丢弃
+	for i := 0; i < breakerFailureThreshold-1; i++ {
+		cb.recordFailure(host)
+	}
+	advance(breakerFailureWindow + time.Second)
+	cb.recordFailure(host)
+	if ok, _ := cb.allow(host); !ok {
+		t.Error("failures outside the window should not open the breaker")
+	}
+
+	// 成功访问清除失败记录
+	cb.recordSuccess(host)
+	for i := 0; i < breakerFailureThreshold-1; i++ {
+		cb.recordFailure(host)
+	}
+	if ok, _ := cb.allow(host); !ok {
+		t.Error("failures below the threshold should not open the breaker")
+	}
+	cb.recordFailure(host)
+	if ok, _ := cb.allow(host); ok {
+		t.Errorf("%d failures within the window should open the breaker", breakerFailureThreshold)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
 // AppError 应用程序错误类型
@@ -26,12 +29,16 @@ func (e *AppError) Unwrap() error {
 
 // 预定义错误代码
 const (
-	ErrCodeInvalidArgument   = "INVALID_ARGUMENT"
-	ErrCodeFileNotFound      = "FILE_NOT_FOUND"
-	ErrCodeDownloadFailed    = "DOWNLOAD_FAILED"
-	ErrCodeParseFailed       = "PARSE_FAILED"
-	ErrCodeUnsupportedType   = "UNSUPPORTED_TYPE"
-	ErrCodeNetworkError      = "NETWORK_ERROR"
+	ErrCodeInvalidArgument    = "INVALID_ARGUMENT"
+	ErrCodeFileNotFound       = "FILE_NOT_FOUND"
+	ErrCodeDownloadFailed     = "DOWNLOAD_FAILED"
+	ErrCodeParseFailed        = "PARSE_FAILED"
+	ErrCodeUnsupportedType    = "UNSUPPORTED_TYPE"
+	ErrCodeNetworkError       = "NETWORK_ERROR"
+	ErrCodeSourceUnavailable  = "SOURCE_UNAVAILABLE"
+	ErrCodeCanceled           = "CANCELED"
+	ErrCodeCredentialsMissing = "CREDENTIALS_MISSING"
+	ErrCodeTimeout            = "TIMEOUT"
 )
 
 // NewInvalidArgumentError 创建参数错误
@@ -60,11 +67,11 @@ func NewDownloadFailedError(uri string, err error) *AppError {
 	}
 }
 
-// NewParseFailedError 创建解析失败错误
-func NewParseFailedError(path string, err error) *AppError {
+// NewParseFailedError 创建解析失败错误，detectedFormat 和 hint 说明检测到的文件格式及可能的原因
+func NewParseFailedError(path, detectedFormat, hint string, err error) *AppError {
 	return &AppError{
 		Code:    ErrCodeParseFailed,
-		Message: fmt.Sprintf("无法解析 profile 文件: %s。请确保文件格式正确。", path),
+		Message: fmt.Sprintf("无法解析 profile 文件: %s (检测到的格式: %s)。%s", path, detectedFormat, hint),
 		Err:     err,
 	}
 }
@@ -76,3 +83,56 @@ func NewUnsupportedTypeError(profileType string) *AppError {
 		Message: fmt.Sprintf("不支持的 profile 类型: %s。支持的类型: cpu, heap, goroutine, allocs, mutex, block", profileType),
 	}
 }
+
+// NewSourceUnavailableError 创建远程 profile 源暂时不可用错误（熔断打开时使用）
+func NewSourceUnavailableError(host string, retryAfter time.Duration) *AppError {
+	return &AppError{
+		Code:    ErrCodeSourceUnavailable,
+		Message: fmt.Sprintf("远程 profile 源 %s 暂时不可用（最近多次请求失败），请在 %s 后重试。", host, retryAfter.Round(time.Second)),
+	}
+}
+
+// NewCredentialsMissingError 创建缺少对象存储凭证错误，hint 说明可以通过哪些环境变量或文件提供凭证
+func NewCredentialsMissingError(scheme, hint string) *AppError {
+	return &AppError{
+		Code:    ErrCodeCredentialsMissing,
+		Message: fmt.Sprintf("没有找到访问 %s:// 对象所需的凭证: %s", scheme, hint),
+	}
+}
+
+// NewCanceledError 创建请求被取消错误 (MCP 客户端取消了请求或请求超时)。
+// err 应为 ctx.Err()，调用方可以用 errors.Is(err, context.Canceled) 区分取消和真正的失败。
+func NewCanceledError(operation string, err error) *AppError {
+	return &AppError{
+		Code:    ErrCodeCanceled,
+		Message: fmt.Sprintf("%s 已取消", operation),
+		Err:     err,
+	}
+}
+
+// NewTimeoutError 创建子进程超时错误：operation 在 timeout 内没有完成，已被终止。hint 说明如何避免超时
+func NewTimeoutError(operation string, timeout time.Duration, hint string) *AppError {
+	return &AppError{
+		Code:    ErrCodeTimeout,
+		Message: fmt.Sprintf("%s 超过 %s 仍未完成，已终止。%s", operation, timeout, hint),
+		Err:     context.DeadlineExceeded,
+	}
+}
+
+// isCanceled 判断错误是否由 context 取消或超时引起
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// wrapAnalysisError 包装分析器返回的错误。分析因请求被取消或超时而中止时 (见 isCanceled) 返回 CANCELED 错误，
+// 已经是 AppError 的这类错误 (例如加载 profile 时被取消) 原样返回；其它错误包装为 "<message>: <err>"，message 为空时原样返回。
+func wrapAnalysisError(operation, message string, err error) error {
+	var appErr *AppError
+	if isCanceled(err) && !errors.As(err, &appErr) {
+		return NewCanceledError(operation, err)
+	}
+	if message == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
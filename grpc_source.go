@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultGRPCProfileMethod 是 grpc:// URI 未指定方法路径时调用的 RPC。
+// 服务端需要实现如下约定 (proto3)：
+//
+//	package pprofanalyzer.v1;
+//
+//	service Profiler {
+//	  rpc GetProfile(GetProfileRequest) returns (GetProfileResponse);
+//	}
+//
+//	message GetProfileRequest {
+//	  string profile_type = 1; // 例如 "heap", "profile" (cpu), "goroutine"
+//	  int64 seconds = 2;       // CPU 等需要采集时长的 profile 使用，0 表示由服务端决定
+//	}
+//
+//	message GetProfileResponse {
+//	  bytes profile = 1; // 原始 pprof 文件内容 (gzip 压缩的 protobuf)
+//	}
+//
+// 只要请求/响应消息的字段编号与上面一致，也可以通过 URI 路径指定其它服务名或方法名。
+const defaultGRPCProfileMethod = "/pprofanalyzer.v1.Profiler/GetProfile"
+
+// grpcRequestTimeout 是 gRPC 调用在采集时长之外额外允许的时间
+const grpcRequestTimeout = 30 * time.Second
+
+// grpcClient 用于调用 gRPC profiling 服务。gRPC 需要 HTTP/2，
+// 标准库只在 TLS 连接上协商 HTTP/2，因此 grpc:// 始终使用 TLS。
+var grpcClient = &http.Client{
+	Transport: &http.Transport{ForceAttemptHTTP2: true},
+}
+
+// fetchGRPCProfile 通过 gRPC 一元调用获取 profile，写入临时文件并返回其路径和清理函数。
+// URI 格式: grpc://host:port[/package.Service/Method]?profile_type=heap&seconds=30
+func fetchGRPCProfile(ctx context.Context, parsedURI *url.URL) (string, func(), error) {
+	host := parsedURI.Host
+	if host == "" {
+		return "", nil, fmt.Errorf("invalid gRPC URI '%s': missing host", parsedURI.String())
+	}
+
+	method := parsedURI.Path
+	if method == "" || method == "/" {
+		method = defaultGRPCProfileMethod
+	}
+	if strings.Count(strings.Trim(method, "/"), "/") != 1 {
+		return "", nil, fmt.Errorf("invalid gRPC method path '%s', expected '/package.Service/Method'", method)
+	}
+
+	query := parsedURI.Query()
+	profileType := query.Get("profile_type")
+	if profileType == "" {
+		return "", nil, fmt.Errorf("invalid gRPC URI '%s': missing required query parameter 'profile_type'", parsedURI.String())
+	}
+	var seconds int64
+	if s := query.Get("seconds"); s != "" {
+		var err error
+		seconds, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || seconds < 0 {
+			return "", nil, fmt.Errorf("invalid 'seconds' query parameter '%s' in gRPC URI", s)
+		}
+	}
+
+	if ok, retryAfter := remoteBreaker.allow(host); !ok {
+		logWarn("Circuit breaker open for host %s, failing fast (retry after %s)", host, retryAfter)
+		return "", nil, NewSourceUnavailableError(host, retryAfter)
+	}
+
+	logInfo("Calling gRPC profiling service: host=%s, method=%s, type=%s, seconds=%d", host, method, profileType, seconds)
+	data, err := callGRPCProfile(ctx, host, method, profileType, seconds)
+	if err != nil {
+		if ctx.Err() != nil {
+			// 取消不是服务端的问题，不计入熔断
+			return "", nil, NewCanceledError(fmt.Sprintf("gRPC 请求 '%s%s'", host, method), ctx.Err())
+		}
+		remoteBreaker.recordFailure(host)
+		return "", nil, fmt.Errorf("failed to fetch profile via gRPC from '%s%s': %w", host, method, err)
+	}
+	remoteBreaker.recordSuccess(host)
+
+	tempFile, err := os.CreateTemp("", "pprof-grpc-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary file for gRPC profile: %w", err)
+	}
+	filePath := tempFile.Name()
+	cleanup := func() {
+		logDebug("Cleaning up temporary file: %s", filePath)
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			logWarn("failed to remove temporary file '%s': %v", filePath, err)
+		}
+	}
+	_, err = tempFile.Write(data)
+	closeErr := tempFile.Close()
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write gRPC profile to temporary file '%s': %w", filePath, err)
+	}
+	if closeErr != nil {
+		logWarn("failed to close temporary file handle for '%s': %v", filePath, closeErr)
+	}
+
+	logDebug("Successfully fetched %d bytes via gRPC to %s", len(data), filePath)
+	return filePath, cleanup, nil
+}
+
+// callGRPCProfile 执行一次 gRPC 一元调用并返回响应中的 profile 字节。
+// 消息按约定手工编码，避免为这一个 RPC 引入 gRPC 与 protobuf 依赖。
+func callGRPCProfile(ctx context.Context, host, method, profileType string, seconds int64) ([]byte, error) {
+	// GetProfileRequest: field 1 (string), field 2 (varint)
+	var msg []byte
+	msg = append(msg, 0x0a)
+	msg = binary.AppendUvarint(msg, uint64(len(profileType)))
+	msg = append(msg, profileType...)
+	if seconds > 0 {
+		msg = append(msg, 0x10)
+		msg = binary.AppendUvarint(msg, uint64(seconds))
+	}
+
+	// gRPC 帧: 1 字节压缩标志 + 4 字节大端长度 + 消息
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	client := *grpcClient
+	client.Timeout = time.Duration(seconds)*time.Second + grpcRequestTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("service unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		return nil, fmt.Errorf("server responded with %s, gRPC requires HTTP/2", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received HTTP status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gRPC response: %w", err)
+	}
+
+	// 只有 trailers 的响应会把状态放在响应头中，其余情况在 trailer 中
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if status != "" && status != "0" {
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+		return nil, fmt.Errorf("RPC failed with status %s: %s", status, message)
+	}
+
+	if len(body) < 5 {
+		return nil, fmt.Errorf("empty gRPC response")
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("compressed gRPC responses are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) < uint64(length) {
+		return nil, fmt.Errorf("truncated gRPC response: expected %d bytes, got %d", length, len(body)-5)
+	}
+	return decodeProfileField(body[5 : 5+length])
+}
+
+// decodeProfileField 从 GetProfileResponse 消息中取出 field 1 (bytes)，跳过其它未知字段。
+func decodeProfileField(msg []byte) ([]byte, error) {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, fmt.Errorf("malformed gRPC response message")
+		}
+		msg = msg[n:]
+		field, wireType := key>>3, key&0x7
+
+		switch wireType {
+		case 0: // varint
+			_, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, fmt.Errorf("malformed gRPC response message")
+			}
+			msg = msg[n:]
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return nil, fmt.Errorf("malformed gRPC response message")
+			}
+			msg = msg[8:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < length {
+				return nil, fmt.Errorf("malformed gRPC response message")
+			}
+			value := msg[n : n+int(length)]
+			if field == 1 {
+				if len(value) == 0 {
+					return nil, fmt.Errorf("gRPC response contains an empty profile")
+				}
+				return value, nil
+			}
+			msg = msg[n+int(length):]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return nil, fmt.Errorf("malformed gRPC response message")
+			}
+			msg = msg[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in gRPC response", wireType)
+		}
+	}
+	return nil, fmt.Errorf("gRPC response does not contain a profile (field 1)")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// grpcFrame 按 gRPC 帧格式 (1 字节压缩标志 + 4 字节大端长度) 封装消息
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// appendBytesField 追加一个 length-delimited 字段
+func appendBytesField(msg []byte, field int, value []byte) []byte {
+	msg = binary.AppendUvarint(msg, uint64(field<<3|2))
+	msg = binary.AppendUvarint(msg, uint64(len(value)))
+	return append(msg, value...)
+}
+
+// newGRPCTestServer 启动一个 HTTP/2 TLS 测试服务端，并在测试期间让 grpcClient 信任它的证书
+func newGRPCTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	original := grpcClient
+	grpcClient = server.Client()
+	t.Cleanup(func() { grpcClient = original })
+	return server
+}
+
+// TestDecodeProfileField 测试从 GetProfileResponse 中取出 field 1，跳过其它字段，并拒绝损坏或缺失 profile 的消息
+func TestDecodeProfileField(t *testing.T) {
+	profileBytes := []byte("profile-data")
+	var skipped []byte
+	skipped = append(skipped, 0x10, 0x96, 0x01)               // field 2, varint 150
+	skipped = append(skipped, 0x19, 1, 2, 3, 4, 5, 6, 7, 8)   // field 3, 64-bit
+	skipped = append(skipped, 0x25, 1, 2, 3, 4)               // field 4, 32-bit
+	skipped = appendBytesField(skipped, 5, []byte("ignored")) // field 5, bytes
+	withUnknownFields := appendBytesField(skipped, 1, profileBytes)
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    string
+		wantErr string
+	}{
+		{name: "profile only", msg: appendBytesField(nil, 1, profileBytes), want: "profile-data"},
+		{name: "unknown fields before profile", msg: withUnknownFields, want: "profile-data"},
+		{name: "empty message", msg: nil, wantErr: "does not contain a profile"},
+		{name: "only unknown fields", msg: skipped, wantErr: "does not contain a profile"},
+		{name: "empty profile", msg: appendBytesField(nil, 1, nil), wantErr: "empty profile"},
+		{name: "truncated bytes field", msg: appendBytesField(nil, 1, profileBytes)[:5], wantErr: "malformed"},
+		{name: "truncated varint", msg: []byte{0x10, 0x96}, wantErr: "malformed"},
+		{name: "truncated 64-bit", msg: []byte{0x19, 1, 2}, wantErr: "malformed"},
+		{name: "unsupported wire type", msg: []byte{0x0b}, wantErr: "unsupported wire type 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeProfileField(tt.msg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeProfileField() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeProfileField() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("decodeProfileField() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCallGRPCProfile 测试对进程内 HTTP/2 服务端的一元调用：请求帧和消息的编码、响应帧的解码，以及 grpc-status 错误
+func TestCallGRPCProfile(t *testing.T) {
+	var gotPath, gotContentType string
+	var gotRequest []byte
+	server := newGRPCTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotContentType = r.URL.Path, r.Header.Get("Content-Type")
+		gotRequest, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		if strings.HasSuffix(r.URL.Path, "/Missing") {
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", url.PathEscape("no such profile"))
+			return
+		}
+		msg := append([]byte{0x10, 0x01}, appendBytesField(nil, 1, []byte("profile-data"))...)
+		w.Write(grpcFrame(msg))
+		w.Header().Set("Grpc-Status", "0")
+	})
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	data, err := callGRPCProfile(context.Background(), host, defaultGRPCProfileMethod, "heap", 30)
+	if err != nil {
+		t.Fatalf("callGRPCProfile() error = %v", err)
+	}
+	if string(data) != "profile-data" {
+		t.Errorf("callGRPCProfile() = %q, want %q", data, "profile-data")
+	}
+	if gotPath != defaultGRPCProfileMethod || gotContentType != "application/grpc" {
+		t.Errorf("request path/content type = %q/%q", gotPath, gotContentType)
+	}
+	wantMsg := append(appendBytesField(nil, 1, []byte("heap")), 0x10, 30)
+	if string(gotRequest) != string(grpcFrame(wantMsg)) {
+		t.Errorf("request frame = %x, want %x", gotRequest, grpcFrame(wantMsg))
+	}
+
+	// seconds 为 0 时省略 field 2
+	if _, err := callGRPCProfile(context.Background(), host, defaultGRPCProfileMethod, "goroutine", 0); err != nil {
+		t.Fatalf("callGRPCProfile(seconds=0) error = %v", err)
+	}
+	if want := grpcFrame(appendBytesField(nil, 1, []byte("goroutine"))); string(gotRequest) != string(want) {
+		t.Errorf("request frame = %x, want %x", gotRequest, want)
+	}
+
+	_, err = callGRPCProfile(context.Background(), host, "/pprofanalyzer.v1.Profiler/Missing", "heap", 0)
+	if err == nil || !strings.Contains(err.Error(), "status 5: no such profile") {
+		t.Errorf("expected grpc-status error, got %v", err)
+	}
+}
+
+// TestFetchGRPCProfile 测试 grpc:// URI 的解析以及把响应写入临时文件
+func TestFetchGRPCProfile(t *testing.T) {
+	var gotRequest []byte
+	server := newGRPCTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		gotRequest, _ = io.ReadAll(r.Body)
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write(grpcFrame(appendBytesField(nil, 1, []byte("profile-data"))))
+		w.Header().Set("Grpc-Status", "0")
+	})
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	uri, _ := url.Parse("grpc://" + host + "?profile_type=profile&seconds=5")
+	path, cleanup, err := fetchGRPCProfile(context.Background(), uri)
+	if err != nil {
+		t.Fatalf("fetchGRPCProfile() error = %v", err)
+	}
+	defer cleanup()
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "profile-data" {
+		t.Errorf("temporary file content = %q (err %v), want %q", data, err, "profile-data")
+	}
+	if want := grpcFrame(append(appendBytesField(nil, 1, []byte("profile")), 0x10, 5)); string(gotRequest) != string(want) {
+		t.Errorf("request frame = %x, want %x", gotRequest, want)
+	}
+
+	for _, raw := range []string{
+		"grpc://" + host,
+		"grpc://" + host + "/OnlyMethod?profile_type=heap",
+		"grpc://" + host + "?profile_type=heap&seconds=-1",
+	} {
+		uri, _ := url.Parse(raw)
+		if _, _, err := fetchGRPCProfile(context.Background(), uri); err == nil {
+			t.Errorf("fetchGRPCProfile(%q) should fail", raw)
+		}
+	}
+}
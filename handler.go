@@ -1,13 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/google/pprof/profile"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -15,21 +25,109 @@ import (
 	"github.com/ZephyrDeng/pprof-analyzer-mcp/analyzer"
 )
 
+// profileURIs 是可以写成单个 URI 字符串或 URI 数组的 profile_uri 参数
+type profileURIs []string
+
+// UnmarshalJSON 同时接受 "uri" 和 ["uri1", "uri2"] 两种写法
+func (u *profileURIs) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*u = profileURIs{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("profile_uri must be a string or an array of strings")
+	}
+	*u = list
+	return nil
+}
+
 // AnalyzePprofArgs 定义 analyze_pprof 工具的输入参数
 type AnalyzePprofArgs struct {
-	ProfileURI   string  `json:"profile_uri" jsonschema:"要分析的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
-	ProfileType  string  `json:"profile_type" jsonschema:"要分析的 pprof profile 的类型 (cpu, heap, goroutine, allocs, mutex, block)"`
-	TopN         float64 `json:"top_n,omitempty" jsonschema:"返回结果的数量上限 (例如 Top 5, Top 10)"`
-	OutputFormat string  `json:"output_format,omitempty" jsonschema:"分析结果的输出格式 (text, markdown, json, flamegraph-json)"`
+	ProfileURI            profileURIs        `json:"profile_uri" jsonschema:"要分析的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)；也可以是 URI 数组，此时将这些同类型的 profile (例如同一服务的多个 CPU profile) 合并后给出一个整体的 Top N；profile_type 为 auto 且其中有多种类型时，生成每种类型一个分区的合并报告 (只支持 text、markdown 和 json)"`
+	ProfileType           string             `json:"profile_type" jsonschema:"要分析的 pprof profile 的类型 (cpu, heap, goroutine, allocs, mutex, block)；auto 表示根据 profile 的样本类型自动推断，并在结果附注中说明推断出的类型"`
+	TopN                  float64            `json:"top_n,omitempty" jsonschema:"返回结果的数量上限 (例如 Top 5, Top 10)"`
+	OutputFormat          string             `json:"output_format,omitempty" jsonschema:"分析结果的输出格式 (text, markdown, json, flamegraph-json, compact, openmetrics, summary)。summary 为一段简短的自然语言摘要 (总量、前 3 个主要贡献者及其占比和一条建议)，适合 agent 直接阅读"`
+	RootFunction          string             `json:"root_function,omitempty" jsonschema:"可选的正则表达式，以匹配的函数为根重新计算整个报告：百分比相对于该函数子树的总值，且只展示其后代函数"`
+	Focus                 string             `json:"focus,omitempty" jsonschema:"可选的正则表达式，只分析调用栈中有匹配函数 (函数名或文件名) 的样本，与 go tool pprof -focus 相同"`
+	Ignore                string             `json:"ignore,omitempty" jsonschema:"可选的正则表达式，丢弃调用栈中有匹配函数的样本，与 go tool pprof -ignore 相同"`
+	Hide                  string             `json:"hide,omitempty" jsonschema:"可选的正则表达式，在汇总之前从调用栈中去掉匹配的帧 (其值计入调用栈中其余的帧)，与 go tool pprof -hide 相同"`
+	Show                  string             `json:"show,omitempty" jsonschema:"可选的正则表达式，在汇总之前只保留调用栈中匹配的帧，与 go tool pprof -show 相同"`
+	TagFocus              string             `json:"tagfocus,omitempty" jsonschema:"可选的正则表达式，只分析字符串标签值匹配的样本；写成 'key=regex' 时只匹配该标签键的值 (例如 'endpoint=/api/.*')"`
+	RedactLabels          []string           `json:"redact_labels,omitempty" jsonschema:"需要脱敏的标签键列表，这些标签的值在输出中会被替换为哈希值"`
+	PeriodOverride        float64            `json:"period_override,omitempty" jsonschema:"可选，替代 profile 中记录的采样周期 (以 PeriodType 单位计，例如 CPU profile 为纳秒)，用于修正周期为零或错误的 profile"`
+	UnsampleHeap          bool               `json:"unsample_heap,omitempty" jsonschema:"仅 heap/allocs：为 true 时按 profile 记录的采样率 (Period) 修正样本值 (与 pprof 处理旧版文本 heap profile 的方式相同)。默认 false，直接使用 profile 中的值，与 go tool pprof 的输出一致；Go runtime 写出的 protobuf heap profile 已经修正过，只有样本值仍是原始采样值的 profile 才需要开启"`
+	TopNByType            map[string]float64 `json:"top_n_by_type,omitempty" jsonschema:"可选，按 profile 类型分别指定 Top N，例如 {\"cpu\": 20, \"mutex\": 5}；与 profile_type 对应的值优先于 top_n，未指定的类型使用 top_n。profile_type 为 auto 且 profile_uri 中有多种类型的 profile 时，合并报告中每种类型的分区分别使用对应的 Top N"`
+	PrimaryMetric         string             `json:"primary_metric,omitempty" jsonschema:"仅用于 mutex 和 block: 主要指标，delay (默认，按总延迟) 或 contentions (按竞争/阻塞次数)。决定排序、表格中优先展示的列以及标题中突出的总值"`
+	CPUPeriodCheck        string             `json:"cpu_period_check,omitempty" jsonschema:"仅用于 cpu: 样本数与 CPU 时间推算出的平均采样周期和 Period 不一致 (可能是采集配置异常或样本丢失) 时的处理方式: warn (默认，在结果中附加警告)、error (返回错误，适合 CI) 或 off (不检查)"`
+	CPUPeriodTolerance    float64            `json:"cpu_period_tolerance,omitempty" jsonschema:"仅用于 cpu: 平均采样周期与 Period 之间允许的相对偏差，默认为 0.1 (10%)"`
+	IncludeSourceLocation bool               `json:"include_source_location,omitempty" jsonschema:"仅用于 cpu: 为 true 时按 '函数 (文件:行号)' 区分热点，同一函数的不同热点行分别列出，并在 text 和 JSON 输出中包含源文件和行号；没有行号信息的函数只显示已有的部分"`
+	AggregateBy           string             `json:"aggregate_by,omitempty" jsonschema:"汇总粒度: function (默认，按函数) 或 package (按包：从函数名中去掉 .Method/.func 等后缀得到包路径，同一个包的值相加后再排序取 Top N)。适用于所有 profile 类型"`
+	CollapseRecursion     bool               `json:"collapse_recursion,omitempty" jsonschema:"为 true 时折叠递归调用：每个样本的调用栈中同一函数只保留最靠近叶子的一帧，火焰图中递归深度不同的调用栈会合并。flat 值不变，cumulative 值本来就按每个样本每个函数只计一次"`
+	NormalizeByDuration   bool               `json:"normalize_by_duration,omitempty" jsonschema:"仅用于 cpu: 为 true 时按 profile 记录的采集时长 (DurationNanos) 归一化，额外报告每个函数的 CPU 秒数和占墙钟时间的百分比，使不同采集时长的 profile 可以直接比较"`
+	SizeBuckets           bool               `json:"size_buckets,omitempty" jsonschema:"仅用于 heap: 为 true 时按平均对象大小 (value/objects) 将所有分配位置分到 <64B、64B-1KB、1KB-1MB、>1MB 四个区间，并在 Top N 之外附加每个区间的字节数、对象数和分配位置数，用于区分大量小分配与少量大分配"`
+	CleanNames            bool               `json:"clean_names,omitempty" jsonschema:"为 true 时清理函数名后再分析：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]。适用于所有 profile 类型"`
+	StripModulePrefix     string             `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，使 'github.com/acme/svc/internal/db.Get' 显示为 'internal/db.Get'；可以单独使用，也可以与 clean_names 一起使用"`
+	MinPercent            float64            `json:"min_percent,omitempty" jsonschema:"仅用于 cpu、heap、mutex 和 block: 在应用 Top N 之前丢弃占总量百分比低于该值的函数 (例如 0.1 表示 0.1%)，并在结果中报告被过滤的函数数量和累计值；mutex 和 block 按 primary_metric 计算占比"`
+	GroupByLabel          string             `json:"group_by_label,omitempty" jsonschema:"仅用于 cpu 和 heap: 按该 pprof 标签键 (例如 'endpoint' 或 'tenant'，字符串或数值标签) 的值汇总样本，报告值最大的 Top N 个标签值而不是函数列表；没有该标签的样本计入 (missing)。只支持 text、markdown 和 json 输出"`
+	SortBy                string             `json:"sort_by,omitempty" jsonschema:"仅用于 cpu、heap、mutex 和 block: Top N 的排序方式。cpu 和 heap: flat (默认，按函数自身的值) 或 cum (按累计值，包括自身值为 0、只出现在调用栈中间的函数)；mutex 和 block: delay (按总延迟)、contentions (按竞争/阻塞次数) 或 avg_delay (按平均每次延迟，用于找出单次等待最长的锁)，默认与 primary_metric 相同"`
+	NoCache               bool               `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+	NumberStyle           string             `json:"number_style,omitempty" jsonschema:"报告中字节数、时长和计数的格式: human (默认，例如 1.50 MB、1.50 ms、1.2K)、raw (纯整数：字节数、纳秒数和计数，便于程序解析)、si (字节数按 1000 进制，kB/MB/GB) 或 iec (字节数使用 KiB/MiB/GiB)。适用于 text、markdown、json 和 compact 输出；结果所附的提示信息总是使用 human 格式"`
+	BinaryPath            string             `json:"binary_path,omitempty" jsonschema:"可选，生成该 profile 的 Go 二进制的本地路径 (ELF 或 Mach-O)。profile 只有地址没有函数名时 (例如在容器中采集后拷贝出来的 profile)，先用该二进制的符号表补全函数名、文件和行号再分析；profile 记录的 build ID 与二进制不一致时返回错误"`
 }
 
 // handleAnalyzePprof 处理分析 pprof 文件的请求。
-func handleAnalyzePprof(_ context.Context, _ *mcp.CallToolRequest, args AnalyzePprofArgs) (*mcp.CallToolResult, any, error) {
-	if args.ProfileURI == "" {
-		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+func handleAnalyzePprof(ctx context.Context, _ *mcp.CallToolRequest, args AnalyzePprofArgs) (*mcp.CallToolResult, any, error) {
+	report, notes, err := analyzePprof(ctx, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newTextResult(report, notes), nil, nil
+}
+
+// analyzePprof 执行 analyze_pprof 的分析，返回报告文本和附注。合并报告的每个分区也由它生成 (见 analyzeCombinedProfiles)。
+func analyzePprof(ctx context.Context, args AnalyzePprofArgs) (string, []string, error) {
+	if len(args.ProfileURI) == 0 || (len(args.ProfileURI) == 1 && args.ProfileURI[0] == "") {
+		return "", nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+	for i, uri := range args.ProfileURI {
+		if uri == "" {
+			return "", nil, NewInvalidArgumentError(fmt.Sprintf("profile_uri #%d is empty", i+1))
+		}
 	}
 	if args.ProfileType == "" {
-		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+		return "", nil, fmt.Errorf("missing required argument: profile_type")
+	}
+	sectionTopN, err := analyzer.NewSectionTopN(args.TopNByType)
+	if err != nil {
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("invalid top_n_by_type: %v", err))
+	}
+
+	// profile_type=auto 需要先加载 profile 才能确定类型，之后与类型相关的校验和分析都使用推断出的类型
+	var prof *profile.Profile
+	var notes []string
+	if args.ProfileType == "auto" {
+		if len(args.ProfileURI) > 1 {
+			// 类型不同的多个 profile 无法合并，改为生成每种类型一个分区的合并报告
+			groups, err := groupProfilesByType(ctx, args.ProfileURI, args.NoCache)
+			if err != nil {
+				return "", nil, err
+			}
+			if len(groups) > 1 {
+				return analyzeCombinedProfiles(ctx, args, groups, sectionTopN)
+			}
+		}
+		prof, notes, err = loadAnalyzeProfile(ctx, args.ProfileURI, "", args.NoCache)
+		if err != nil {
+			return "", nil, err
+		}
+		detected, note, err := inferProfileType(prof, args.ProfileURI[0])
+		if err != nil {
+			return "", nil, err
+		}
+		args.ProfileType = detected
+		notes = append(notes, note)
 	}
 
 	// 设置默认值
@@ -38,546 +136,2685 @@ func handleAnalyzePprof(_ context.Context, _ *mcp.CallToolRequest, args AnalyzeP
 	}
 	if args.OutputFormat == "" {
 		args.OutputFormat = "flamegraph-json"
+		if args.GroupByLabel != "" {
+			// 按标签汇总的结果没有调用栈，默认输出 markdown 表格
+			args.OutputFormat = "markdown"
+		}
+	}
+	if err := validateFormat(args.OutputFormat, analyzeFormats); err != nil {
+		return "", nil, err
+	}
+	if args.PrimaryMetric == "" {
+		args.PrimaryMetric = analyzer.PrimaryMetricDelay
+	}
+	if args.PrimaryMetric != analyzer.PrimaryMetricDelay && args.PrimaryMetric != analyzer.PrimaryMetricContentions {
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("unsupported primary_metric: '%s' (expected delay or contentions)", args.PrimaryMetric))
+	}
+	switch args.CPUPeriodCheck {
+	case "":
+		args.CPUPeriodCheck = "warn"
+	case "warn", "error", "off":
+	default:
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("unsupported cpu_period_check: '%s' (expected warn, error or off)", args.CPUPeriodCheck))
+	}
+	if args.CPUPeriodTolerance < 0 {
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("cpu_period_tolerance must not be negative, got %v", args.CPUPeriodTolerance))
+	}
+	switch args.AggregateBy {
+	case "":
+		args.AggregateBy = "function"
+	case "function", "package":
+	default:
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("unsupported aggregate_by: '%s' (expected function or package)", args.AggregateBy))
+	}
+	if args.AggregateBy == "package" && args.IncludeSourceLocation {
+		return "", nil, NewInvalidArgumentError("include_source_location cannot be combined with aggregate_by=package")
+	}
+	if args.MinPercent < 0 || args.MinPercent > 100 {
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("min_percent must be between 0 and 100, got %v", args.MinPercent))
+	}
+	if args.SortBy != "" {
+		var sortKeys []string
+		switch args.ProfileType {
+		case "cpu", "heap":
+			sortKeys = analyzer.FunctionSortKeys
+		case "mutex", "block":
+			sortKeys = analyzer.ContentionSortKeys
+		default:
+			return "", nil, NewInvalidArgumentError(fmt.Sprintf("sort_by is not supported for %s profiles (only cpu, heap, mutex and block)", args.ProfileType))
+		}
+		if !slices.Contains(sortKeys, args.SortBy) {
+			return "", nil, NewInvalidArgumentError(fmt.Sprintf("unsupported sort_by for %s profiles: '%s' (expected %s)", args.ProfileType, args.SortBy, strings.Join(sortKeys, ", ")))
+		}
+	}
+	if args.UnsampleHeap && args.ProfileType != "heap" && args.ProfileType != "allocs" {
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("unsample_heap is only supported for heap and allocs profiles, got %s", args.ProfileType))
 	}
 
-	topN := int(args.TopN)
-	log.Printf("Handling analyze_pprof: URI=%s, Type=%s, TopN=%d, Format=%s", args.ProfileURI, args.ProfileType, topN, args.OutputFormat)
-
-	filePath, cleanup, err := getProfileAsFile(args.ProfileURI)
+	numbers, err := analyzer.NewNumberFormatter(args.NumberStyle)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get profile file: %w", err)
+		return "", nil, NewInvalidArgumentError(err.Error())
 	}
-	defer cleanup()
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Printf("Error opening profile file '%s': %v", filePath, err)
-		return nil, nil, fmt.Errorf("failed to open profile file '%s': %w", filePath, err)
+	if args.GroupByLabel != "" {
+		if args.ProfileType != "cpu" && args.ProfileType != "heap" {
+			return "", nil, NewInvalidArgumentError(fmt.Sprintf("group_by_label is only supported for cpu and heap profiles, got %s", args.ProfileType))
+		}
+		if !slices.Contains(reportFormats, args.OutputFormat) {
+			return "", nil, NewInvalidArgumentError(fmt.Sprintf("group_by_label does not support output_format %s (expected %s)", args.OutputFormat, strings.Join(reportFormats, ", ")))
+		}
 	}
-	defer file.Close()
 
-	prof, err := profile.Parse(file)
-	if err != nil {
-		log.Printf("Error parsing profile file '%s': %v", filePath, err)
-		return nil, nil, fmt.Errorf("failed to parse profile file '%s': %w", filePath, err)
+	topN := sectionTopN.For(args.ProfileType, int(args.TopN))
+	logInfo("Handling analyze_pprof: URI=%s, Type=%s, TopN=%d, Format=%s", strings.Join(args.ProfileURI, ", "), args.ProfileType, topN, args.OutputFormat)
+
+	if prof == nil {
+		prof, notes, err = loadAnalyzeProfile(ctx, args.ProfileURI, args.ProfileType, args.NoCache)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if args.BinaryPath != "" {
+		symbolized, summary, err := analyzer.SymbolizeProfile(prof, args.BinaryPath)
+		if errors.Is(err, analyzer.ErrBuildIDMismatch) {
+			return "", nil, NewInvalidArgumentError(err.Error())
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to symbolize profile with binary_path '%s': %w", args.BinaryPath, err)
+		}
+		prof = symbolized
+		notes = append(notes, summary.String())
+	}
+
+	if warning := analyzer.ValueColumnWarning(prof, args.ProfileType); warning != "" {
+		notes = append(notes, warning)
+	}
+	if args.PeriodOverride != 0 {
+		if args.PeriodOverride < 0 || args.PeriodOverride != float64(int64(args.PeriodOverride)) {
+			return "", nil, NewInvalidArgumentError(fmt.Sprintf("period_override must be a positive integer, got %v", args.PeriodOverride))
+		}
+		recordedPeriod := prof.Period
+		prof, err = analyzer.OverridePeriod(prof, int64(args.PeriodOverride))
+		if err != nil {
+			return "", nil, NewInvalidArgumentError(err.Error())
+		}
+		notes = append(notes, fmt.Sprintf("已使用 period_override=%d 替代 profile 中记录的采样周期 %d，并据此修正了由周期推导出的样本值。",
+			int64(args.PeriodOverride), recordedPeriod))
+	}
+	if args.UnsampleHeap {
+		var scaled int
+		prof, scaled, err = analyzer.UnsampleHeapProfile(prof)
+		if err != nil {
+			return "", nil, NewInvalidArgumentError(fmt.Sprintf("unsample_heap: %v", err))
+		}
+		notes = append(notes, fmt.Sprintf("已按采样率 %d 字节修正 %d 个样本的对象数和字节数 (unsample_heap)。如果该 profile 来自 Go runtime，其中的值已经修正过，再次修正会高估内存用量。",
+			prof.Period, scaled))
+	}
+	if args.ProfileType == "cpu" && args.CPUPeriodCheck != "off" {
+		if warning := analyzer.CPUPeriodWarning(prof, args.CPUPeriodTolerance); warning != "" {
+			if args.CPUPeriodCheck == "error" {
+				return "", nil, fmt.Errorf("cpu period check failed (cpu_period_check=error): %s", warning)
+			}
+			notes = append(notes, warning)
+		}
+	}
+	// 在过滤和 root_function 之前清理，使正则表达式匹配的是报告中显示的函数名
+	if args.CleanNames || args.StripModulePrefix != "" {
+		prof = analyzer.CleanFunctionNames(prof, cleanNamesOptions(args.CleanNames, args.StripModulePrefix))
+	}
+	filterOpts := analyzer.SampleFilterOptions{Focus: args.Focus, Ignore: args.Ignore, Hide: args.Hide, Show: args.Show, TagFocus: args.TagFocus}
+	if filterOpts != (analyzer.SampleFilterOptions{}) {
+		var summary analyzer.SampleFilterSummary
+		prof, summary, err = analyzer.FilterSamples(prof, filterOpts)
+		if err != nil {
+			return "", nil, NewInvalidArgumentError(err.Error())
+		}
+		notes = append(notes, fmt.Sprintf("已按 focus/ignore/hide/show/tagfocus 过滤样本：保留 %d/%d 个样本，百分比相对于过滤后的总值。",
+			summary.KeptSamples, summary.TotalSamples))
+		if len(summary.Unmatched) > 0 {
+			notes = append(notes, fmt.Sprintf("以下过滤条件没有匹配任何函数或标签：%s。", strings.Join(summary.Unmatched, ", ")))
+		}
+	}
+	// 在过滤之后脱敏，使 tagfocus 匹配的是标签的原始值
+	if len(args.RedactLabels) > 0 {
+		prof = analyzer.RedactLabels(prof, args.RedactLabels)
+	}
+	if args.RootFunction != "" {
+		re, err := regexp.Compile(args.RootFunction)
+		if err != nil {
+			return "", nil, NewInvalidArgumentError(fmt.Sprintf("invalid root_function regex '%s': %v", args.RootFunction, err))
+		}
+		totalSamples := len(prof.Sample)
+		prof, err = analyzer.RerootProfile(prof, re)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to re-root profile at '%s': %w", args.RootFunction, err)
+		}
+		notes = append(notes, fmt.Sprintf("已以匹配 '%s' 的函数为根重新计算报告：保留 %d/%d 个样本，百分比相对于该子树的总值。",
+			args.RootFunction, len(prof.Sample), totalSamples))
+	}
+	if args.AggregateBy == "package" {
+		prof = analyzer.AggregateByPackage(prof)
+		notes = append(notes, "已按包汇总 (aggregate_by=package)：报告中的每一项是一个包，其值为该包中所有函数的值之和。")
+	}
+	if args.CollapseRecursion {
+		prof = analyzer.CollapseRecursion(prof)
+		notes = append(notes, "已折叠递归调用 (collapse_recursion)：调用栈中重复出现的函数只保留最靠近叶子的一帧。")
+	}
+
+	if args.GroupByLabel != "" {
+		// 按标签值汇总时不再按函数展示，函数维度的选项 (min_percent 等) 不适用
+		result, err := analyzer.AnalyzeLabelPivot(prof, args.ProfileType, analyzer.LabelPivotOptions{
+			Keys:      []string{args.GroupByLabel},
+			MaxValues: topN,
+			Numbers:   numbers,
+		}, args.OutputFormat)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to group by label '%s': %w", args.GroupByLabel, err)
+		}
+		if args.MinPercent > 0 {
+			notes = append(notes, "min_percent 只适用于函数列表，按 group_by_label 汇总的结果未做过滤。")
+		}
+		return result, notes, nil
+	}
+
+	if args.MinPercent > 0 {
+		switch {
+		case args.ProfileType == "goroutine" || args.ProfileType == "allocs":
+			notes = append(notes, fmt.Sprintf("min_percent 只适用于 cpu、heap、mutex 和 block，%s profile 未做过滤。", args.ProfileType))
+		case args.OutputFormat == "flamegraph-json" || args.OutputFormat == "openmetrics":
+			notes = append(notes, fmt.Sprintf("min_percent 只影响 Top N 列表，%s 输出未做过滤。", args.OutputFormat))
+		}
+	}
+
+	if args.OutputFormat == "openmetrics" {
+		// openmetrics 对所有 profile 类型使用同一个导出器
+		metrics, err := analyzer.ExportOpenMetrics(prof, args.ProfileType, topN)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to export OpenMetrics: %w", err)
+		}
+		return metrics, notes, nil
 	}
-	log.Printf("Successfully parsed profile file from path: %s", filePath)
 
 	var analysisResult string
 	var analysisErr error
 
 	switch args.ProfileType {
 	case "cpu":
-		analysisResult, analysisErr = analyzer.AnalyzeCPUProfile(prof, topN, args.OutputFormat)
+		analysisResult, analysisErr = analyzer.AnalyzeCPUProfileContext(ctx, prof, topN, args.OutputFormat, analyzer.CPUAnalysisOptions{
+			IncludeSourceLocation: args.IncludeSourceLocation,
+			NormalizeByDuration:   args.NormalizeByDuration,
+			MinPercent:            args.MinPercent,
+			Numbers:               numbers,
+			SortBy:                args.SortBy,
+		})
 	case "heap":
-		analysisResult, analysisErr = analyzer.AnalyzeHeapProfile(prof, topN, args.OutputFormat)
+		analysisResult, analysisErr = analyzer.AnalyzeHeapProfileContext(ctx, prof, topN, args.OutputFormat, analyzer.HeapAnalysisOptions{
+			SizeBuckets: args.SizeBuckets,
+			MinPercent:  args.MinPercent,
+			Numbers:     numbers,
+			SortBy:      args.SortBy,
+		})
 	case "goroutine":
-		analysisResult, analysisErr = analyzer.AnalyzeGoroutineProfile(prof, topN, args.OutputFormat)
+		analysisResult, analysisErr = analyzer.AnalyzeGoroutineProfileContext(ctx, prof, topN, args.OutputFormat, analyzer.GoroutineAnalysisOptions{Numbers: numbers})
 	case "allocs":
-		analysisResult, analysisErr = analyzer.AnalyzeAllocsProfile(prof, topN, args.OutputFormat)
+		analysisResult, analysisErr = analyzer.AnalyzeAllocsProfileContext(ctx, prof, topN, args.OutputFormat, analyzer.AllocsAnalysisOptions{Numbers: numbers})
 	case "mutex":
-		analysisResult, analysisErr = analyzer.AnalyzeMutexProfile(prof, topN, args.OutputFormat)
+		analysisResult, analysisErr = analyzer.AnalyzeMutexProfileContext(ctx, prof, topN, args.OutputFormat, analyzer.ContentionAnalysisOptions{
+			PrimaryMetric: args.PrimaryMetric,
+			MinPercent:    args.MinPercent,
+			SortBy:        args.SortBy,
+			Numbers:       numbers,
+		})
 	case "block":
-		analysisResult, analysisErr = analyzer.AnalyzeBlockProfile(prof, topN, args.OutputFormat)
+		analysisResult, analysisErr = analyzer.AnalyzeBlockProfileContext(ctx, prof, topN, args.OutputFormat, analyzer.ContentionAnalysisOptions{
+			PrimaryMetric: args.PrimaryMetric,
+			MinPercent:    args.MinPercent,
+			SortBy:        args.SortBy,
+			Numbers:       numbers,
+		})
 	default:
 		analysisErr = fmt.Errorf("unsupported profile type: '%s'", args.ProfileType)
 	}
 
 	if analysisErr != nil {
-		log.Printf("Analysis error for type '%s': %v", args.ProfileType, analysisErr)
-		return nil, nil, analysisErr
+		logError("Analysis error for type '%s': %v", args.ProfileType, analysisErr)
+		return "", nil, wrapAnalysisError("分析 profile", "", analysisErr)
 	}
 
-	log.Printf("Analysis successful for type '%s'. Result length: %d", args.ProfileType, len(analysisResult))
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				
-				Text: analysisResult,
-			},
-		},
-	}, nil, nil
+	logDebug("Analysis successful for type '%s'. Result length: %d", args.ProfileType, len(analysisResult))
+	return analysisResult, notes, nil
+}
+
+// loadAnalyzeProfile 加载 analyze_pprof 的 profile_uri：单个 URI 直接加载，多个 URI 合并为一个 (见 loadMergedProfile)。
+// 文件名、profileType 与内容不一致时在附注中给出警告 (例如把 heap profile 保存成了 cpu.pb.gz)，profileType 为空时只检查文件名。
+func loadAnalyzeProfile(ctx context.Context, uris []string, profileType string, noCache bool) (*profile.Profile, []string, error) {
+	if len(uris) > 1 {
+		return loadMergedProfile(ctx, uris, profileType, noCache)
+	}
+	prof, err := loadProfile(ctx, uris[0], noCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+	return prof, analyzer.CheckProfileTypeMismatch(prof, profileType, profileNameFromURI(uris[0])), nil
+}
+
+// inferProfileType 为 profile_type=auto 根据样本类型推断 profile 类型 (见 analyzer.DetectProfileType)，返回推断出的类型和说明推断依据的附注。
+// mutex 与 block 的样本类型相同：文件名暗示 block (例如 block.pb.gz) 时按 block 分析，否则按 mutex 分析并在附注中提示。无法推断时返回参数错误。
+func inferProfileType(prof *profile.Profile, uri string) (string, string, error) {
+	sampleTypes := make([]string, len(prof.SampleType))
+	for i, st := range prof.SampleType {
+		sampleTypes[i] = st.Type + "/" + st.Unit
+	}
+	detected := analyzer.DetectProfileType(prof)
+	if detected == "" {
+		return "", "", NewInvalidArgumentError(fmt.Sprintf("profile_type=auto could not infer the profile type from sample types (%s); specify profile_type explicitly (%s)",
+			strings.Join(sampleTypes, ", "), strings.Join(analyzeProfileTypes, ", ")))
+	}
+	if detected == "mutex" && analyzer.ProfileTypeFromName(profileNameFromURI(uri)) == "block" {
+		return "block", fmt.Sprintf("profile_type=auto：根据样本类型 (%s) 和文件名推断为 block profile。", strings.Join(sampleTypes, ", ")), nil
+	}
+	note := fmt.Sprintf("profile_type=auto：根据样本类型 (%s) 推断为 %s profile。", strings.Join(sampleTypes, ", "), detected)
+	if detected == "mutex" {
+		note += "mutex 与 block profile 的样本类型相同，如果这是 block profile 请指定 profile_type=block。"
+	}
+	return detected, note, nil
+}
+
+// loadMergedProfile 加载 uris 中的所有 profile 并合并为一个，用于 analyze_pprof 的 profile_uri 数组。
+// 所有 profile 的内容必须属于同一类型 (见 analyzer.DetectProfileType)，样本类型也必须一致 (见 analyzer.MergeProfiles)；
+// 返回的附注包含合并的数量以及每个 profile 与 profileType 不一致的警告。
+func loadMergedProfile(ctx context.Context, uris []string, profileType string, noCache bool) (*profile.Profile, []string, error) {
+	fetched := fetchProfilesConcurrently(ctx, uris, 0, noCache)
+	profiles := make([]*profile.Profile, len(fetched))
+	detected := make([]string, len(fetched))
+	var notes []string
+	for i, f := range fetched {
+		if f.Err != nil {
+			return nil, nil, fmt.Errorf("failed to load profile #%d (%s): %w", i+1, uris[i], f.Err)
+		}
+		profiles[i] = f.Profile
+		detected[i] = analyzer.DetectProfileType(f.Profile)
+		for _, note := range analyzer.CheckProfileTypeMismatch(f.Profile, profileType, profileNameFromURI(uris[i])) {
+			notes = append(notes, fmt.Sprintf("profile #%d: %s", i+1, note))
+		}
+	}
+	for i := range detected {
+		if detected[i] != detected[0] {
+			var b strings.Builder
+			for j, t := range detected {
+				if t == "" {
+					t = "unknown"
+				}
+				fmt.Fprintf(&b, "\n  #%d %s: %s", j+1, uris[j], t)
+			}
+			return nil, nil, NewInvalidArgumentError("all profiles in profile_uri must be of the same type to be merged, got:" + b.String())
+		}
+	}
+
+	merged, err := analyzer.MergeProfiles(profiles)
+	if err != nil {
+		return nil, nil, NewInvalidArgumentError(err.Error())
+	}
+	notes = append(notes, fmt.Sprintf("已合并 %d 个 profile 后再分析：合并后 %d 个样本 (相同调用栈的值已相加)，合计采集时长 %s。",
+		len(profiles), len(merged.Sample), time.Duration(merged.DurationNanos)))
+	return merged, notes, nil
+}
+
+// profileTypeGroup 是 profile_uri 中推断为同一类型的一组 URI
+type profileTypeGroup struct {
+	ProfileType string
+	URIs        []string
+}
+
+// groupProfilesByType 加载 uris 中的所有 profile，按推断出的类型 (见 inferProfileType) 分组，组按该类型第一次出现的顺序排列。
+// 无法推断类型的 profile 返回参数错误。profile 经过缓存 (见 loadProfile)，之后分析各组时不会重新下载或解析。
+func groupProfilesByType(ctx context.Context, uris []string, noCache bool) ([]profileTypeGroup, error) {
+	var groups []profileTypeGroup
+	index := make(map[string]int)
+	for i, f := range fetchProfilesConcurrently(ctx, uris, 0, noCache) {
+		if f.Err != nil {
+			return nil, fmt.Errorf("failed to load profile #%d (%s): %w", i+1, uris[i], f.Err)
+		}
+		profileType, _, err := inferProfileType(f.Profile, uris[i])
+		if err != nil {
+			return nil, fmt.Errorf("profile #%d (%s): %w", i+1, uris[i], err)
+		}
+		j, ok := index[profileType]
+		if !ok {
+			j = len(groups)
+			index[profileType] = j
+			groups = append(groups, profileTypeGroup{ProfileType: profileType})
+		}
+		groups[j].URIs = append(groups[j].URIs, uris[i])
+	}
+	return groups, nil
+}
+
+// combinedReport 是合并报告的 JSON 输出，每个分区的 report 是该类型的 analyze_pprof JSON 报告
+type combinedReport struct {
+	Sections []combinedReportSection `json:"sections"`
+}
+
+// combinedReportSection 是合并报告中一种 profile 类型的分区
+type combinedReportSection struct {
+	ProfileType string          `json:"profileType"`
+	ProfileURI  []string        `json:"profileUri"`
+	TopN        int             `json:"topN"` // 该分区请求的 Top N (top_n_by_type 中的值或 top_n)
+	Report      json.RawMessage `json:"report"`
+}
+
+// analyzeCombinedProfiles 为 profile_type=auto 下包含多种类型的 profile_uri 生成合并报告：每种类型一个分区，
+// 同类型的多个 profile 先合并，每个分区与单独调用 analyze_pprof 的结果相同，Top N 取 top_n_by_type 中该类型的值，未指定时使用 top_n。
+// 只支持 text、markdown 和 json 输出 (默认 markdown)；每个分区的附注加上类型前缀后合并。
+func analyzeCombinedProfiles(ctx context.Context, args AnalyzePprofArgs, groups []profileTypeGroup, sectionTopN analyzer.SectionTopN) (string, []string, error) {
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if !slices.Contains(reportFormats, args.OutputFormat) {
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("profiles of different types are analyzed as a combined report, which does not support output_format %s (expected %s)",
+			args.OutputFormat, strings.Join(reportFormats, ", ")))
+	}
+	topN := int(args.TopN)
+	if topN <= 0 {
+		topN = 5
+	}
+	logInfo("Handling analyze_pprof: combined report of %d profile types, Format=%s", len(groups), args.OutputFormat)
+
+	var b strings.Builder
+	var combined combinedReport
+	var notes []string
+	for i, group := range groups {
+		sectionArgs := args
+		sectionArgs.ProfileURI = group.URIs
+		sectionArgs.ProfileType = group.ProfileType
+		sectionArgs.TopN = float64(sectionTopN.For(group.ProfileType, topN))
+		sectionArgs.TopNByType = nil
+		report, sectionNotes, err := analyzePprof(ctx, sectionArgs)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s section: %w", group.ProfileType, err)
+		}
+		for _, note := range sectionNotes {
+			notes = append(notes, fmt.Sprintf("[%s] %s", group.ProfileType, note))
+		}
+
+		switch args.OutputFormat {
+		case "json":
+			combined.Sections = append(combined.Sections, combinedReportSection{
+				ProfileType: group.ProfileType,
+				ProfileURI:  group.URIs,
+				TopN:        int(sectionArgs.TopN),
+				Report:      json.RawMessage(report),
+			})
+		case "markdown":
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "## %s (%d 个 profile, Top %d)\n\n%s", group.ProfileType, len(group.URIs), int(sectionArgs.TopN), report)
+		default:
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "=== %s (%d 个 profile, Top %d) ===\n%s", group.ProfileType, len(group.URIs), int(sectionArgs.TopN), report)
+		}
+	}
+	if args.OutputFormat == "json" {
+		jsonBytes, err := json.MarshalIndent(combined, "", "  ")
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to marshal combined report: %w", err)
+		}
+		return string(jsonBytes), notes, nil
+	}
+	return b.String(), notes, nil
 }
 
 // GenerateFlamegraphArgs 定义 generate_flamegraph 工具的输入参数
 type GenerateFlamegraphArgs struct {
-	ProfileURI    string `json:"profile_uri" jsonschema:"要生成火焰图的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
-	ProfileType   string `json:"profile_type" jsonschema:"要生成火焰图的 pprof profile 的类型 (cpu, heap, allocs, goroutine, mutex, block)"`
-	OutputSVGPath string `json:"output_svg_path" jsonschema:"生成的 SVG 火焰图文件的保存路径 (必须是绝对路径或相对于工作区的路径)"`
+	ProfileURI        string   `json:"profile_uri" jsonschema:"要生成火焰图的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	ProfileType       string   `json:"profile_type" jsonschema:"要生成火焰图的 pprof profile 的类型 (cpu, heap, allocs, goroutine, mutex, block, heap_growth)"`
+	OutputSVGPath     string   `json:"output_svg_path" jsonschema:"生成的 SVG 火焰图文件的保存路径 (必须是绝对路径或相对于工作区的路径)"`
+	RedactLabels      []string `json:"redact_labels,omitempty" jsonschema:"需要脱敏的标签键列表，这些标签的值在 SVG 中会被替换为哈希值"`
+	Engine            string   `json:"engine,omitempty" jsonschema:"渲染引擎: go_tool (使用 go tool pprof，需要 Graphviz) 或 builtin (纯 Go 实现，输出可复现，无需 Graphviz)。未指定时使用 go_tool，找不到 Graphviz 时自动改用 builtin"`
+	ReturnContent     *bool    `json:"return_content,omitempty" jsonschema:"是否在返回值中以 image/svg+xml 图片内容内联 SVG，默认为 true。对于很大的 profile，设为 false 时只返回文件路径、大小和指向文件的资源链接，避免读取整个文件和过大的响应"`
+	MaxInlineBytes    float64  `json:"max_inline_bytes,omitempty" jsonschema:"内联 SVG 的大小上限 (字节)，默认为 1048576 (1 MiB)。SVG 超过该大小时即使 return_content 为 true 也只返回文件路径和资源链接"`
+	OutputFormat      string   `json:"output_format,omitempty" jsonschema:"输出格式: svg (默认) 或 collapsed。collapsed 时以纯 Go 生成 Brendan Gregg 折叠调用栈文本 (每行 'func1;func2;func3 <value>'，可直接交给 flamegraph.pl)，直接作为文本返回，不需要 Graphviz，也不需要 output_svg_path"`
+	CleanNames        bool     `json:"clean_names,omitempty" jsonschema:"为 true 时清理函数名后再生成火焰图，规则同 analyze_pprof 的 clean_names：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]"`
+	StripModulePrefix string   `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，可以单独使用，也可以与 clean_names 一起使用"`
+	TimeoutSeconds    float64  `json:"timeout_seconds,omitempty" jsonschema:"engine 为 go_tool 时 go tool pprof 子进程的超时时间 (秒)，默认 120。超时后终止子进程并返回 TIMEOUT 错误"`
 }
 
 // handleGenerateFlamegraph 处理生成火焰图的请求。
-func handleGenerateFlamegraph(_ context.Context, _ *mcp.CallToolRequest, args GenerateFlamegraphArgs) (*mcp.CallToolResult, any, error) {
+func handleGenerateFlamegraph(ctx context.Context, _ *mcp.CallToolRequest, args GenerateFlamegraphArgs) (*mcp.CallToolResult, any, error) {
 	if args.ProfileURI == "" {
 		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
 	}
 	if args.ProfileType == "" {
 		return nil, nil, fmt.Errorf("missing required argument: profile_type")
 	}
-	if args.OutputSVGPath == "" {
+	switch args.OutputFormat {
+	case "", "svg", "collapsed":
+	default:
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported output_format: '%s' (expected svg or collapsed)", args.OutputFormat))
+	}
+	if args.OutputSVGPath == "" && args.OutputFormat != "collapsed" {
 		return nil, nil, fmt.Errorf("missing required argument: output_svg_path")
 	}
+	if args.MaxInlineBytes < 0 || args.MaxInlineBytes != float64(int64(args.MaxInlineBytes)) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("max_inline_bytes must be a positive integer, got %v", args.MaxInlineBytes))
+	}
+	if args.MaxInlineBytes == 0 {
+		args.MaxInlineBytes = defaultMaxInlineFlamegraphBytes
+	}
+	timeout, err := pprofTimeout(args.TimeoutSeconds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch args.Engine {
+	case "", "go_tool", "builtin":
+	default:
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported engine: '%s' (expected go_tool or builtin)", args.Engine))
+	}
 
-	log.Printf("Handling generate_flamegraph: URI=%s, Type=%s, Output=%s", args.ProfileURI, args.ProfileType, args.OutputSVGPath)
+	logInfo("Handling generate_flamegraph: URI=%s, Type=%s, Output=%s, Engine=%s, Format=%s", args.ProfileURI, args.ProfileType, args.OutputSVGPath, args.Engine, args.OutputFormat)
 
-	inputFilePath, cleanup, err := getProfileAsFile(args.ProfileURI)
+	inputFilePath, cleanup, err := getProfileAsFile(ctx, args.ProfileURI)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get profile file for flamegraph: %w", err)
 	}
 	defer cleanup()
 
+	if len(args.RedactLabels) > 0 || args.CleanNames || args.StripModulePrefix != "" {
+		// go tool pprof 和折叠调用栈直接读取文件，因此先写出一份脱敏、清理函数名后的 profile 供其使用
+		transformedPath, transformedCleanup, err := writeTransformedProfile(inputFilePath, func(p *profile.Profile) *profile.Profile {
+			if len(args.RedactLabels) > 0 {
+				p = analyzer.RedactLabels(p, args.RedactLabels)
+			}
+			return cleanProfileNames(p, args.CleanNames, args.StripModulePrefix)
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to prepare profile for flamegraph: %w", err)
+		}
+		defer transformedCleanup()
+		inputFilePath = transformedPath
+	}
+
+	if args.OutputFormat == "collapsed" {
+		folded, err := renderCollapsedStacks(inputFilePath, args.ProfileType)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newTextResult(folded, nil), nil, nil
+	}
+
 	if !filepath.IsAbs(args.OutputSVGPath) {
 		cwd, err := os.Getwd()
 		if err != nil {
-			log.Printf("无法获取当前工作目录: %v", err)
+			logError("无法获取当前工作目录: %v", err)
 		} else {
 			args.OutputSVGPath = filepath.Join(cwd, args.OutputSVGPath)
-			log.Printf("将相对输出路径转换为绝对路径: %s", args.OutputSVGPath)
+			logDebug("将相对输出路径转换为绝对路径: %s", args.OutputSVGPath)
 		}
 	}
 
-	cmdArgs := []string{"tool", "pprof"}
-	switch args.ProfileType {
-	case "heap":
-		cmdArgs = append(cmdArgs, "-inuse_space")
-	case "allocs":
-		cmdArgs = append(cmdArgs, "-alloc_space")
-	case "cpu", "goroutine", "mutex", "block":
-		// No extra flags needed
-	default:
-		return nil, nil, fmt.Errorf("unsupported profile type for flamegraph: '%s'", args.ProfileType)
-	}
-	cmdArgs = append(cmdArgs, "-svg", "-output", args.OutputSVGPath, inputFilePath)
-
-	log.Printf("Executing command: go %s", strings.Join(cmdArgs, " "))
+	returnContent := args.ReturnContent == nil || *args.ReturnContent
 
-	_, err = exec.LookPath("dot")
-	if err != nil {
-		errMsg := "Graphviz (dot 命令) 未找到或不在 PATH 中。生成 SVG 火焰图需要 Graphviz。\n" +
-			"请先安装 Graphviz。常见安装方式：\n" +
-			"- macOS (Homebrew): brew install graphviz\n" +
-			"- Debian/Ubuntu: sudo apt-get update && sudo apt-get install graphviz\n" +
-			"- CentOS/Fedora: sudo yum install graphviz 或 sudo dnf install graphviz\n" +
-			"- Windows (Chocolatey): choco install graphviz"
-		log.Println(errMsg)
-		return nil, nil, fmt.Errorf(errMsg)
+	var notes []string
+	if args.Engine == "" {
+		args.Engine = "go_tool"
+		if _, err := exec.LookPath("dot"); err != nil {
+			args.Engine = "builtin"
+			notes = append(notes, "未找到 Graphviz (dot 命令)，已改用内置渲染器生成火焰图。如需 go tool pprof 的输出，请安装 Graphviz 并指定 engine: go_tool。")
+		}
+	}
+	if args.Engine == "builtin" {
+		if err := renderBuiltinFlamegraph(inputFilePath, args.ProfileType, args.OutputSVGPath); err != nil {
+			return nil, nil, err
+		}
+		return flamegraphResult(args.OutputSVGPath, returnContent, int64(args.MaxInlineBytes), notes), nil, nil
 	}
-	log.Println("Graphviz (dot) found.")
-
-	cmd := exec.CommandContext(context.Background(), "go", cmdArgs...)
-	cmdOutput, err := cmd.CombinedOutput()
 
+	sampleFlags, err := pprofSampleFlags(args.ProfileType)
 	if err != nil {
-		log.Printf("Error executing 'go tool pprof': %v\nOutput:\n%s", err, string(cmdOutput))
-		return nil, nil, fmt.Errorf("failed to generate flamegraph: %w. Output: %s", err, string(cmdOutput))
+		return nil, nil, err
 	}
+	cmdArgs := append([]string{"tool", "pprof"}, sampleFlags...)
+	cmdArgs = append(cmdArgs, "-svg", "-output", args.OutputSVGPath, inputFilePath)
 
-	log.Printf("Successfully generated flamegraph: %s", args.OutputSVGPath)
-	log.Printf("pprof output:\n%s", string(cmdOutput))
+	logDebug("Executing command: go %s", strings.Join(cmdArgs, " "))
 
-	resultText := fmt.Sprintf("火焰图已成功生成并保存到: %s", args.OutputSVGPath)
+	if err := checkGraphviz("或者指定 engine: builtin 使用不依赖 Graphviz 的内置渲染器。"); err != nil {
+		return nil, nil, err
+	}
 
-	svgBytes, readErr := os.ReadFile(args.OutputSVGPath)
-	if readErr != nil {
-		log.Printf("成功生成 SVG 文件 '%s' 但读取失败: %v", args.OutputSVGPath, readErr)
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{
-					
-					Text: resultText,
-				},
-			},
-		}, nil, nil
+	cmdOutput, err := runPprofCommand(ctx, "生成火焰图", timeout, maxPprofOutputBytes, "go", cmdArgs...)
+	if err != nil {
+		var appErr *AppError
+		if errors.As(err, &appErr) {
+			return nil, nil, err
+		}
+		logError("Error executing 'go tool pprof': %v\nOutput:\n%s", err, cmdOutput)
+		return nil, nil, fmt.Errorf("failed to generate flamegraph: %w. Output: %s", err, cmdOutput)
 	}
 
-	svgContentStr := string(svgBytes)
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				
-				Text: resultText,
-			},
-			&mcp.TextContent{
-				
-				Text: svgContentStr,
-			},
-		},
-	}, nil, nil
+	logInfo("Successfully generated flamegraph: %s", args.OutputSVGPath)
+	logDebug("pprof output:\n%s", cmdOutput)
+
+	return flamegraphResult(args.OutputSVGPath, returnContent, int64(args.MaxInlineBytes), notes), nil, nil
 }
 
-// DetectMemoryLeaksArgs 定义 detect_memory_leaks 工具的输入参数
-type DetectMemoryLeaksArgs struct {
-	OldProfileURI string  `json:"old_profile_uri" jsonschema:"较早的 heap profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
-	NewProfileURI string  `json:"new_profile_uri" jsonschema:"较新的 heap profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
-	Threshold     float64 `json:"threshold,omitempty" jsonschema:"检测内存泄漏的增长阈值 (0.1 表示 10%)"`
-	Limit         float64 `json:"limit,omitempty" jsonschema:"返回的潜在内存泄漏类型的最大数量"`
+// GenerateDiffFlamegraphArgs 定义 generate_diff_flamegraph 工具的输入参数
+type GenerateDiffFlamegraphArgs struct {
+	BaselineProfileURI string   `json:"baseline_profile_uri" jsonschema:"基线 profile 的 URI (旧版本)，支持 'file://', 'http://', 'https://' 协议"`
+	TargetProfileURI   string   `json:"target_profile_uri" jsonschema:"目标 profile 的 URI (新版本)，支持 'file://', 'http://', 'https://' 协议"`
+	ProfileType        string   `json:"profile_type" jsonschema:"两个 profile 的类型 (cpu, heap, allocs, goroutine, mutex, block)"`
+	OutputSVGPath      string   `json:"output_svg_path" jsonschema:"生成的 SVG 差分火焰图文件的保存路径 (必须是绝对路径或相对于工作区的路径)"`
+	RedactLabels       []string `json:"redact_labels,omitempty" jsonschema:"需要脱敏的标签键列表，这些标签的值在 SVG 中会被替换为哈希值"`
+	ReturnContent      *bool    `json:"return_content,omitempty" jsonschema:"是否在返回值中以 image/svg+xml 图片内容内联 SVG，默认为 true；设为 false 时只返回文件路径、大小和资源链接"`
+	MaxInlineBytes     float64  `json:"max_inline_bytes,omitempty" jsonschema:"内联 SVG 的大小上限 (字节)，默认为 1048576 (1 MiB)，超过时只返回文件路径和资源链接"`
+	TimeoutSeconds     float64  `json:"timeout_seconds,omitempty" jsonschema:"go tool pprof 子进程的超时时间 (秒)，默认 120。超时后终止子进程并返回 TIMEOUT 错误"`
 }
 
-// handleDetectMemoryLeaks 处理内存泄漏检测的请求。
-func handleDetectMemoryLeaks(_ context.Context, _ *mcp.CallToolRequest, args DetectMemoryLeaksArgs) (*mcp.CallToolResult, any, error) {
-	if args.OldProfileURI == "" {
-		return nil, nil, fmt.Errorf("missing required argument: old_profile_uri")
+// handleGenerateDiffFlamegraph 处理生成差分火焰图的请求：使用 go tool pprof -diff_base 渲染 target 相对 baseline 的变化。
+func handleGenerateDiffFlamegraph(ctx context.Context, _ *mcp.CallToolRequest, args GenerateDiffFlamegraphArgs) (*mcp.CallToolResult, any, error) {
+	if args.BaselineProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: baseline_profile_uri")
 	}
-	if args.NewProfileURI == "" {
-		return nil, nil, fmt.Errorf("missing required argument: new_profile_uri")
+	if args.TargetProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: target_profile_uri")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+	if args.OutputSVGPath == "" {
+		return nil, nil, fmt.Errorf("missing required argument: output_svg_path")
+	}
+	if !slices.Contains(diffFlamegraphProfileTypes, args.ProfileType) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported profile_type for diff flamegraph: '%s' (expected one of: %s)", args.ProfileType, strings.Join(diffFlamegraphProfileTypes, ", ")))
+	}
+	if args.MaxInlineBytes < 0 || args.MaxInlineBytes != float64(int64(args.MaxInlineBytes)) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("max_inline_bytes must be a positive integer, got %v", args.MaxInlineBytes))
+	}
+	if args.MaxInlineBytes == 0 {
+		args.MaxInlineBytes = defaultMaxInlineFlamegraphBytes
+	}
+	timeout, err := pprofTimeout(args.TimeoutSeconds)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// 设置默认值
-	if args.Threshold == 0 {
-		args.Threshold = 0.1 // Default 10% growth
+	logInfo("Handling generate_diff_flamegraph: Baseline=%s, Target=%s, Type=%s, Output=%s",
+		args.BaselineProfileURI, args.TargetProfileURI, args.ProfileType, args.OutputSVGPath)
+
+	baselinePath, baselineCleanup, err := getProfileAsFile(ctx, args.BaselineProfileURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get baseline profile file: %w", err)
 	}
-	if args.Limit == 0 {
-		args.Limit = 10.0
+	defer baselineCleanup()
+	targetPath, targetCleanup, err := getProfileAsFile(ctx, args.TargetProfileURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get target profile file: %w", err)
 	}
+	defer targetCleanup()
 
-	limit := int(args.Limit)
-	if limit <= 0 {
-		limit = 10
+	// 在调用 go tool pprof 之前确认两个 profile 属于同一类型，否则 -diff_base 得到的差值没有意义
+	baselineProf, err := parseProfileFile(baselinePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse baseline profile: %w", err)
+	}
+	targetProf, err := parseProfileFile(targetPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse target profile: %w", err)
+	}
+	baselineType, targetType := analyzer.DetectProfileType(baselineProf), analyzer.DetectProfileType(targetProf)
+	if baselineType != targetType {
+		unknown := func(t string) string {
+			if t == "" {
+				return "unknown"
+			}
+			return t
+		}
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("baseline and target profiles must be of the same type to be diffed, got baseline: %s, target: %s",
+			unknown(baselineType), unknown(targetType)))
 	}
+	notes := analyzer.CheckProfileTypeMismatch(targetProf, args.ProfileType, profileNameFromURI(args.TargetProfileURI))
 
-	log.Printf("Handling detect_memory_leaks: OldURI=%s, NewURI=%s, Threshold=%.2f, Limit=%d",
-		args.OldProfileURI, args.NewProfileURI, args.Threshold, limit)
+	if len(args.RedactLabels) > 0 {
+		redactedBaseline, cleanup, err := writeRedactedProfile(baselinePath, args.RedactLabels)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to redact labels for baseline profile: %w", err)
+		}
+		defer cleanup()
+		redactedTarget, cleanup, err := writeRedactedProfile(targetPath, args.RedactLabels)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to redact labels for target profile: %w", err)
+		}
+		defer cleanup()
+		baselinePath, targetPath = redactedBaseline, redactedTarget
+	}
 
-	// Get the old profile file
-	oldFilePath, oldCleanup, err := getProfileAsFile(args.OldProfileURI)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get old profile file: %w", err)
+	if !filepath.IsAbs(args.OutputSVGPath) {
+		if cwd, err := os.Getwd(); err == nil {
+			args.OutputSVGPath = filepath.Join(cwd, args.OutputSVGPath)
+		}
+	}
+
+	sampleFlags, err := pprofSampleFlags(args.ProfileType)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmdArgs := append([]string{"tool", "pprof"}, sampleFlags...)
+	cmdArgs = append(cmdArgs, "-svg", "-diff_base="+baselinePath, "-output", args.OutputSVGPath, targetPath)
+	logDebug("Executing command: go %s", strings.Join(cmdArgs, " "))
+
+	if err := checkGraphviz(""); err != nil {
+		return nil, nil, err
+	}
+
+	if cmdOutput, err := runPprofCommand(ctx, "生成差分火焰图", timeout, maxPprofOutputBytes, "go", cmdArgs...); err != nil {
+		var appErr *AppError
+		if errors.As(err, &appErr) {
+			return nil, nil, err
+		}
+		logError("Error executing 'go tool pprof -diff_base': %v\nOutput:\n%s", err, cmdOutput)
+		return nil, nil, fmt.Errorf("failed to generate diff flamegraph: %w. Output: %s", err, cmdOutput)
+	}
+	logInfo("Successfully generated diff flamegraph: %s", args.OutputSVGPath)
+
+	notes = append(notes, "差分火焰图展示 target 相对 baseline 的变化：红色表示增加 (回归)，绿色表示减少 (改进)，颜色越深变化越大。")
+	returnContent := args.ReturnContent == nil || *args.ReturnContent
+	return flamegraphResult(args.OutputSVGPath, returnContent, int64(args.MaxInlineBytes), notes), nil, nil
+}
+
+const (
+	// defaultPprofTimeout 是 go tool pprof 子进程的默认超时时间
+	defaultPprofTimeout = 2 * time.Minute
+	// maxPprofOutputBytes 是保留的 go tool pprof 输出 (stdout 与 stderr) 的大小上限，超出的部分只计数不保存
+	maxPprofOutputBytes = 64 << 10
+	// maxCallgraphOutputBytes 是 generate_callgraph 返回的文本调用图的大小上限
+	maxCallgraphOutputBytes = 1 << 20
+	// pprofWaitDelay 是子进程被终止后等待其输出管道关闭的时间。无法终止整个进程组的平台上，
+	// go tool pprof 启动的 pprof 和 dot 进程可能在 go 进程退出后继续持有管道
+	pprofWaitDelay = 5 * time.Second
+)
+
+// pprofTimeout 将 timeout_seconds 参数转换为子进程的超时时间，未指定时使用 defaultPprofTimeout
+func pprofTimeout(seconds float64) (time.Duration, error) {
+	if seconds < 0 {
+		return 0, NewInvalidArgumentError(fmt.Sprintf("timeout_seconds must be positive, got %v", seconds))
+	}
+	if seconds == 0 {
+		return defaultPprofTimeout, nil
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// cappedBuffer 只保存写入内容的前 limit 字节，之后的写入只计数，避免失控的子进程输出耗尽内存
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	dropped int64
+}
+
+// Write 实现 io.Writer，总是报告写入成功，使子进程不会因为输出被截断而失败
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.dropped += int64(len(p) - max(room, 0))
+		p = p[:max(room, 0)]
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// String 返回保存的输出，有内容被丢弃时在末尾注明丢弃的字节数
+func (b *cappedBuffer) String() string {
+	if b.dropped == 0 {
+		return b.buf.String()
+	}
+	return fmt.Sprintf("%s\n... (%d more bytes of output truncated)", b.buf.String(), b.dropped)
+}
+
+// runPprofCommand 在 ctx 之上加 timeout 运行子进程并返回其输出 (stdout 与 stderr 合并，最多保留 outputLimit 字节)。
+// ctx 被取消时返回 CANCELED 错误，超时时返回 TIMEOUT 错误，子进程自身失败时返回 exec 的原始错误
+func runPprofCommand(ctx context.Context, operation string, timeout time.Duration, outputLimit int, name string, args ...string) (string, error) {
+	output := &cappedBuffer{limit: outputLimit}
+	err := runPprofSubprocess(ctx, operation, timeout, output, output, name, args...)
+	return output.String(), err
+}
+
+// runPprofCommandSeparate 与 runPprofCommand 相同，但分别返回 stdout 和 stderr (各自最多保留 outputLimit 字节)，
+// 用于 stdout 本身就是结果的命令，使 pprof 写到 stderr 的警告不混入结果
+func runPprofCommandSeparate(ctx context.Context, operation string, timeout time.Duration, outputLimit int, name string, args ...string) (stdout, stderr string, err error) {
+	outBuf, errBuf := &cappedBuffer{limit: outputLimit}, &cappedBuffer{limit: outputLimit}
+	err = runPprofSubprocess(ctx, operation, timeout, outBuf, errBuf, name, args...)
+	return outBuf.String(), errBuf.String(), err
+}
+
+// runPprofSubprocess 在 ctx 之上加 timeout 运行子进程，将 stdout 和 stderr 分别写入对应的 Writer，错误的含义见 runPprofCommand
+func runPprofSubprocess(ctx context.Context, operation string, timeout time.Duration, stdout, stderr io.Writer, name string, args ...string) error {
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, name, args...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	killProcessGroupOnCancel(cmd)
+	cmd.WaitDelay = pprofWaitDelay
+	err := cmd.Run()
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return NewCanceledError(operation, ctx.Err())
+	case runCtx.Err() != nil:
+		return NewTimeoutError(operation, timeout, "profile 过大或调用图过于复杂时可以增大 timeout_seconds。")
+	}
+	return err
+}
+
+// pprofStderrNotes 将 go tool pprof 写到 stderr 的内容 (例如找不到二进制或符号的警告) 按行转换为结果的提示信息，忽略空行
+func pprofStderrNotes(stderr string) []string {
+	var notes []string
+	for _, line := range strings.Split(stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			notes = append(notes, "go tool pprof: "+line)
+		}
+	}
+	return notes
+}
+
+// GenerateCallgraphArgs 定义 generate_callgraph 工具的输入参数
+type GenerateCallgraphArgs struct {
+	ProfileURI     string  `json:"profile_uri" jsonschema:"pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	ProfileType    string  `json:"profile_type" jsonschema:"profile 的类型 (cpu, heap, allocs, goroutine, mutex, block, heap_growth)"`
+	OutputFormat   string  `json:"output_format,omitempty" jsonschema:"输出格式: tree (默认，go tool pprof -tree，列出每个函数的调用方和被调用方) 或 text (go tool pprof -text，按 flat 值排序的函数列表)"`
+	NodeCount      float64 `json:"node_count,omitempty" jsonschema:"最多显示的节点 (函数) 数，对应 -nodecount。未指定时使用 go tool pprof 的默认值"`
+	Focus          string  `json:"focus,omitempty" jsonschema:"只保留经过匹配该正则表达式的函数的调用栈，对应 -focus"`
+	Ignore         string  `json:"ignore,omitempty" jsonschema:"丢弃经过匹配该正则表达式的函数的调用栈，对应 -ignore"`
+	Hide           string  `json:"hide,omitempty" jsonschema:"从调用栈中隐藏匹配该正则表达式的函数 (其值计入调用方)，对应 -hide"`
+	TimeoutSeconds float64 `json:"timeout_seconds,omitempty" jsonschema:"go tool pprof 子进程的超时时间 (秒)，默认 120。超时后终止子进程并返回 TIMEOUT 错误"`
+}
+
+// handleGenerateCallgraph 处理生成文本调用图的请求：运行 go tool pprof -tree 或 -text 并直接返回其输出，不需要 Graphviz。
+func handleGenerateCallgraph(ctx context.Context, _ *mcp.CallToolRequest, args GenerateCallgraphArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+	switch args.OutputFormat {
+	case "":
+		args.OutputFormat = "tree"
+	case "tree", "text":
+	default:
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported output_format: '%s' (expected tree or text)", args.OutputFormat))
+	}
+	if args.NodeCount < 0 || args.NodeCount != float64(int64(args.NodeCount)) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("node_count must be a positive integer, got %v", args.NodeCount))
+	}
+	sampleFlags, err := pprofSampleFlags(args.ProfileType)
+	if err != nil {
+		return nil, nil, NewInvalidArgumentError(err.Error())
+	}
+	cmdArgs := append([]string{"tool", "pprof"}, sampleFlags...)
+	cmdArgs = append(cmdArgs, "-"+args.OutputFormat)
+	if args.NodeCount > 0 {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-nodecount=%d", int64(args.NodeCount)))
+	}
+	for _, filter := range []struct{ name, pattern string }{{"focus", args.Focus}, {"ignore", args.Ignore}, {"hide", args.Hide}} {
+		if filter.pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(filter.pattern); err != nil {
+			return nil, nil, NewInvalidArgumentError(fmt.Sprintf("invalid %s regular expression: %v", filter.name, err))
+		}
+		cmdArgs = append(cmdArgs, "-"+filter.name+"="+filter.pattern)
+	}
+	timeout, err := pprofTimeout(args.TimeoutSeconds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logInfo("Handling generate_callgraph: URI=%s, Type=%s, Format=%s, NodeCount=%d, Focus=%q, Ignore=%q, Hide=%q",
+		args.ProfileURI, args.ProfileType, args.OutputFormat, int64(args.NodeCount), args.Focus, args.Ignore, args.Hide)
+
+	inputFilePath, cleanup, err := getProfileAsFile(ctx, args.ProfileURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get profile file for call graph: %w", err)
+	}
+	defer cleanup()
+	cmdArgs = append(cmdArgs, inputFilePath)
+	logDebug("Executing command: go %s", strings.Join(cmdArgs, " "))
+
+	// stderr 单独收集，pprof 的警告放在提示信息中，不混入调用图文本
+	output, stderr, err := runPprofCommandSeparate(ctx, "生成调用图", timeout, maxCallgraphOutputBytes, "go", cmdArgs...)
+	if err != nil {
+		var appErr *AppError
+		if errors.As(err, &appErr) {
+			return nil, nil, err
+		}
+		logError("Error executing 'go tool pprof -%s': %v\nStderr:\n%s\nOutput:\n%s", args.OutputFormat, err, stderr, output)
+		return nil, nil, fmt.Errorf("failed to generate call graph: %w. Output: %s", err, strings.TrimSpace(stderr+"\n"+output))
+	}
+	logDebug("Successfully generated call graph. Result length: %d", len(output))
+	return newTextResult(output, pprofStderrNotes(stderr)), nil, nil
+}
+
+// pprofSampleFlags 返回 go tool pprof 生成火焰图时为 profileType 选择样本类型的参数
+func pprofSampleFlags(profileType string) ([]string, error) {
+	switch profileType {
+	case "heap":
+		return []string{"-inuse_space"}, nil
+	case "allocs":
+		return []string{"-alloc_space"}, nil
+	case "cpu", "goroutine", "mutex", "block", "heap_growth":
+		// No extra flags needed
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported profile type for flamegraph: '%s'", profileType)
+}
+
+// checkGraphviz 确认 go tool pprof 生成 SVG 所需的 Graphviz (dot 命令) 可用，否则返回包含安装方式的错误，hint 附加在错误信息末尾。
+func checkGraphviz(hint string) error {
+	if _, err := exec.LookPath("dot"); err != nil {
+		errMsg := "Graphviz (dot 命令) 未找到或不在 PATH 中。生成 SVG 火焰图需要 Graphviz。\n" +
+			"请先安装 Graphviz。常见安装方式：\n" +
+			"- macOS (Homebrew): brew install graphviz\n" +
+			"- Debian/Ubuntu: sudo apt-get update && sudo apt-get install graphviz\n" +
+			"- CentOS/Fedora: sudo yum install graphviz 或 sudo dnf install graphviz\n" +
+			"- Windows (Chocolatey): choco install graphviz\n" + hint
+		logError("%s", errMsg)
+		return fmt.Errorf("%s", errMsg)
+	}
+	logDebug("Graphviz (dot) found.")
+	return nil
+}
+
+// renderBuiltinFlamegraph 使用内置渲染器将 filePath 处的 profile 渲染为 SVG 并写入 outputPath。
+func renderBuiltinFlamegraph(filePath, profileType, outputPath string) error {
+	switch profileType {
+	case "cpu", "heap", "allocs", "goroutine", "mutex", "block", "heap_growth":
+	default:
+		return fmt.Errorf("unsupported profile type for flamegraph: '%s'", profileType)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open profile file '%s': %w", filePath, err)
+	}
+	defer file.Close()
+
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse profile file: %w", newProfileParseError(filePath, err))
+	}
+
+	svg, err := analyzer.RenderFlameGraphSVG(prof, profileType)
+	if err != nil {
+		return fmt.Errorf("failed to render flamegraph: %w", err)
+	}
+	if err := os.WriteFile(outputPath, svg, 0644); err != nil {
+		return fmt.Errorf("failed to write flamegraph to '%s': %w", outputPath, err)
+	}
+	logInfo("Successfully rendered builtin flamegraph: %s", outputPath)
+	return nil
+}
+
+// renderCollapsedStacks 将 filePath 处的 profile 转换为折叠调用栈文本，不依赖 go tool pprof 和 Graphviz。
+func renderCollapsedStacks(filePath, profileType string) (string, error) {
+	switch profileType {
+	case "cpu", "heap", "allocs", "goroutine", "mutex", "block", "heap_growth":
+	default:
+		return "", fmt.Errorf("unsupported profile type for flamegraph: '%s'", profileType)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open profile file '%s': %w", filePath, err)
+	}
+	defer file.Close()
+
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse profile file: %w", newProfileParseError(filePath, err))
+	}
+
+	folded, err := analyzer.RenderFoldedStacks(prof, profileType)
+	if err != nil {
+		return "", fmt.Errorf("failed to fold stacks: %w", err)
+	}
+	logDebug("Successfully generated collapsed stacks. Result length: %d", len(folded))
+	return folded, nil
+}
+
+// defaultMaxInlineFlamegraphBytes 是 generate_flamegraph 默认内联 SVG 的大小上限
+const defaultMaxInlineFlamegraphBytes = 1 << 20
+
+// flamegraphResult 构造火焰图的返回结果：保存路径和大小、指向 SVG 文件的资源链接，
+// 以及 returnContent 为 true 且不超过 maxInlineBytes 时以 image/svg+xml 内联的 SVG，附注放在最后。
+// 客户端可以直接渲染图片内容，过大的 SVG 只返回路径，避免撑大对话上下文。
+func flamegraphResult(svgPath string, returnContent bool, maxInlineBytes int64, notes []string) *mcp.CallToolResult {
+	// file:// 资源链接需要绝对路径，相对路径按服务器的工作目录解析
+	if absPath, err := filepath.Abs(svgPath); err == nil {
+		svgPath = absPath
+	}
+	resultText := fmt.Sprintf("火焰图已成功生成并保存到: %s", svgPath)
+
+	info, statErr := os.Stat(svgPath)
+	if statErr != nil {
+		logWarn("成功生成 SVG 文件 '%s' 但获取文件信息失败: %v", svgPath, statErr)
+		return newTextResult(resultText, notes)
+	}
+	size := info.Size()
+	resultText = fmt.Sprintf("%s (大小: %s)", resultText, analyzer.FormatBytes(size))
+	if returnContent && size > maxInlineBytes {
+		resultText += fmt.Sprintf("\nSVG 超过内联上限 %s (max_inline_bytes)，只返回文件路径，请直接打开该文件查看。", analyzer.FormatBytes(maxInlineBytes))
+		returnContent = false
+	}
+
+	content := []mcp.Content{
+		&mcp.ResourceLink{
+			URI:      fileURI(svgPath),
+			Name:     filepath.Base(svgPath),
+			MIMEType: "image/svg+xml",
+			Size:     &size,
+		},
+	}
+	if returnContent {
+		svgBytes, readErr := os.ReadFile(svgPath)
+		if readErr != nil {
+			logWarn("成功生成 SVG 文件 '%s' 但读取失败: %v", svgPath, readErr)
+		} else {
+			content = append(content, &mcp.ImageContent{Data: svgBytes, MIMEType: "image/svg+xml"})
+		}
+	}
+
+	// 资源链接和 SVG 紧跟在保存路径之后，附注仍放在最后
+	result := newTextResult(resultText, notes)
+	result.Content = append(append(result.Content[:1:1], content...), result.Content[1:]...)
+	return result
+}
+
+// fileURI 返回绝对路径 path 的 file:// URI。Windows 的盘符路径 (C:\x) 前面补上 '/'，得到 file:///C:/x
+func fileURI(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// writeRedactedProfile 解析 filePath 处的 profile，对指定标签脱敏后写入临时文件，返回临时文件路径和清理函数。
+func writeRedactedProfile(filePath string, keys []string) (string, func(), error) {
+	return writeTransformedProfile(filePath, func(p *profile.Profile) *profile.Profile {
+		return analyzer.RedactLabels(p, keys)
+	})
+}
+
+// writeTransformedProfile 解析 filePath 处的 profile，经 transform 处理后写入临时文件，返回临时文件路径和清理函数。
+func writeTransformedProfile(filePath string, transform func(*profile.Profile) *profile.Profile) (string, func(), error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open profile file '%s': %w", filePath, err)
+	}
+	defer file.Close()
+
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse profile file: %w", newProfileParseError(filePath, err))
+	}
+
+	tmpFile, err := os.CreateTemp("", "pprof-transformed-*.pb.gz")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	cleanup := func() {
+		if err := os.Remove(tmpFile.Name()); err != nil && !os.IsNotExist(err) {
+			logWarn("failed to remove temporary file '%s': %v", tmpFile.Name(), err)
+		}
+	}
+
+	if err := transform(prof).Write(tmpFile); err != nil {
+		tmpFile.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write transformed profile: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to close transformed profile: %w", err)
+	}
+	return tmpFile.Name(), cleanup, nil
+}
+
+// DetectMemoryLeaksArgs 定义 detect_memory_leaks 工具的输入参数
+type DetectMemoryLeaksArgs struct {
+	OldProfileURI     string   `json:"old_profile_uri" jsonschema:"较早的 heap profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
+	NewProfileURI     string   `json:"new_profile_uri" jsonschema:"较新的 heap profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
+	Threshold         float64  `json:"threshold,omitempty" jsonschema:"检测内存泄漏的增长阈值 (0.1 表示 10%)"`
+	Limit             float64  `json:"limit,omitempty" jsonschema:"返回的潜在内存泄漏类型的最大数量 (与 top_n 相同，保留以兼容旧的调用)"`
+	TopN              float64  `json:"top_n,omitempty" jsonschema:"返回的内存泄漏候选数量上限，按增长的字节数排序 (默认 10，<= 0 时使用默认值)；设置后优先于 limit"`
+	Ignore            string   `json:"ignore,omitempty" jsonschema:"可选的正则表达式，调用栈中任意函数名匹配的样本会在比较前从两个 profile 中排除 (例如已知会持续增长的缓存)"`
+	Metric            string   `json:"metric,omitempty" jsonschema:"比较的样本类型：inuse_space (默认，存活内存)、alloc_space (累计分配的字节数)、inuse_objects 或 alloc_objects；两个 profile 都必须包含该样本类型"`
+	StackDepth        float64  `json:"stack_depth,omitempty" jsonschema:"每个泄漏候选的分配调用栈最多显示的帧数，从分配位置开始 (默认 0 表示显示完整调用栈)"`
+	RedactLabels      []string `json:"redact_labels,omitempty" jsonschema:"需要脱敏的标签键列表，这些标签的值在输出中会被替换为哈希值"`
+	CleanNames        bool     `json:"clean_names,omitempty" jsonschema:"为 true 时清理两个 profile 的函数名后再比较，规则同 analyze_pprof 的 clean_names：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]；ignore 匹配的是清理后的函数名"`
+	StripModulePrefix string   `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，可以单独使用，也可以与 clean_names 一起使用"`
+	NoCache           bool     `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleDetectMemoryLeaks 处理内存泄漏检测的请求。
+func handleDetectMemoryLeaks(ctx context.Context, _ *mcp.CallToolRequest, args DetectMemoryLeaksArgs) (*mcp.CallToolResult, any, error) {
+	if args.OldProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: old_profile_uri")
+	}
+	if args.NewProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: new_profile_uri")
+	}
+
+	// 设置默认值
+	if args.Threshold == 0 {
+		args.Threshold = 0.1 // Default 10% growth
+	}
+	if args.Limit == 0 {
+		args.Limit = 10.0
+	}
+	if args.TopN != 0 {
+		args.Limit = args.TopN
+	}
+
+	limit := int(args.Limit)
+	if limit <= 0 {
+		limit = 10
+	}
+
+	var ignoreRe *regexp.Regexp
+	if args.Ignore != "" {
+		re, err := regexp.Compile(args.Ignore)
+		if err != nil {
+			return nil, nil, NewInvalidArgumentError(fmt.Sprintf("invalid ignore regex '%s': %v", args.Ignore, err))
+		}
+		ignoreRe = re
+	}
+	if args.StackDepth < 0 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("stack_depth must not be negative, got %v", args.StackDepth))
+	}
+	if args.Metric == "" {
+		args.Metric = analyzer.LeakMetricInuseSpace
+	}
+	if !slices.Contains(analyzer.LeakMetrics, args.Metric) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported metric: '%s' (expected %s)", args.Metric, strings.Join(analyzer.LeakMetrics, ", ")))
+	}
+
+	logInfo("Handling detect_memory_leaks: OldURI=%s, NewURI=%s, Metric=%s, Threshold=%.2f, Limit=%d",
+		args.OldProfileURI, args.NewProfileURI, args.Metric, args.Threshold, limit)
+
+	// Get the old profile file
+	oldProf, err := loadProfile(ctx, args.OldProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load old profile: %w", err)
+	}
+	if len(args.RedactLabels) > 0 {
+		oldProf = analyzer.RedactLabels(oldProf, args.RedactLabels)
+	}
+	oldProf = cleanProfileNames(oldProf, args.CleanNames, args.StripModulePrefix)
+
+	// Get the new profile file
+	newProf, err := loadProfile(ctx, args.NewProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load new profile: %w", err)
+	}
+	if len(args.RedactLabels) > 0 {
+		newProf = analyzer.RedactLabels(newProf, args.RedactLabels)
+	}
+	newProf = cleanProfileNames(newProf, args.CleanNames, args.StripModulePrefix)
+
+	// Detect memory leaks
+	result, err := analyzer.DetectPotentialMemoryLeaksContext(ctx, oldProf, newProf, analyzer.LeakDetectionOptions{
+		Threshold:  args.Threshold,
+		Limit:      limit,
+		Ignore:     ignoreRe,
+		StackDepth: int(args.StackDepth),
+		Metric:     args.Metric,
+	})
+	if err != nil {
+		logError("Error detecting memory leaks: %v", err)
+		return nil, nil, wrapAnalysisError("检测内存泄漏", "failed to detect memory leaks", err)
+	}
+
+	logDebug("Memory leak detection completed successfully. Result length: %d", len(result))
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				
+				Text: result,
+			},
+		},
+	}, nil, nil
+}
+
+// OpenInteractivePprofArgs 定义 open_interactive_pprof 工具的输入参数
+type OpenInteractivePprofArgs struct {
+	ProfileURI  string `json:"profile_uri" jsonschema:"要分析的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 或本地路径)"`
+	HTTPAddress string `json:"http_address,omitempty" jsonschema:"指定 pprof Web UI 的监听地址和端口 (例如 'localhost:8081')，如果省略默认为 'localhost:0' (由系统选择空闲端口，实际地址在结果中返回)"`
+	OpenBrowser *bool  `json:"open_browser,omitempty" jsonschema:"是否在浏览器中打开 Web UI (macOS 使用 open，Linux 使用 xdg-open，Windows 使用 rundll32)。macOS 上默认为 true，其它系统默认为 false"`
+}
+
+// InteractivePprofSession 是 open_interactive_pprof 的结构化结果：启动的会话以及是否已在浏览器中打开
+type InteractivePprofSession struct {
+	pprofSession
+	BrowserOpened bool `json:"browserOpened"`
+}
+
+// handleOpenInteractivePprof 处理打开交互式 pprof 的请求。
+// 在所有平台上以 -no_browser 启动 go tool pprof -http，从其 stderr 读取实际监听的地址，
+// 返回 URL 和 PID；需要时再用当前系统的打开器在浏览器中打开。
+func handleOpenInteractivePprof(ctx context.Context, _ *mcp.CallToolRequest, args OpenInteractivePprofArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+
+	// 设置默认值
+	httpAddress := args.HTTPAddress
+	if httpAddress == "" {
+		httpAddress = "localhost:0" // 由系统选择空闲端口
+		logDebug("No http_address provided, using default: %s", httpAddress)
+	}
+	openInBrowser := runtime.GOOS == "darwin"
+	if args.OpenBrowser != nil {
+		openInBrowser = *args.OpenBrowser
+	}
+
+	logInfo("Handling open_interactive_pprof: URI=%s, Address=%s, OpenBrowser=%t", args.ProfileURI, httpAddress, openInBrowser)
+
+	inputFilePath, cleanup, err := getProfileAsFile(ctx, args.ProfileURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get profile file: %w", err)
+	}
+	// 注意：不能在这里 defer cleanup()，因为 pprof 进程需要持续访问文件
+
+	// 浏览器由本服务在拿到实际地址后打开，pprof 自己只负责提供 Web UI
+	cmdArgs := []string{"tool", "pprof", fmt.Sprintf("-http=%s", pprofHTTPFlagAddress(httpAddress)), "-no_browser", inputFilePath}
+
+	logDebug("Preparing to execute command in background: go %s", strings.Join(cmdArgs, " "))
+
+	_, err = exec.LookPath("go")
+	if err != nil {
+		logError("'go' command not found in PATH.")
+		cleanup()
+		return nil, nil, fmt.Errorf("'go' command not found in PATH, cannot start pprof")
+	}
+
+	// pprof 进程需要在本次请求结束后继续运行，因此不使用请求的 ctx
+	cmd := exec.CommandContext(context.Background(), "go", cmdArgs...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to capture 'go tool pprof' output: %w", err)
+	}
+	cmd.Stdout = cmd.Stderr
+	err = cmd.Start()
+
+	if err != nil {
+		logError("Error starting 'go tool pprof' in background: %v", err)
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to start 'go tool pprof': %w", err)
+	}
+
+	webURL, exited, err := waitForPprofURL(ctx, stderr)
+	if err != nil {
+		logError("Error waiting for 'go tool pprof' web UI: %v", err)
+		// 先 Interrupt 再 Kill，使 go tool 把信号转发给实际的 pprof 进程
+		if _, termErr := terminatePprofProcess(cmd.Process, nil, defaultPprofGracePeriod); termErr != nil {
+			logWarn("failed to terminate 'go tool pprof' PID %d: %v", cmd.Process.Pid, termErr)
+		}
+		cleanup()
+		return nil, nil, err
+	}
+
+	pid := cmd.Process.Pid
+	session := InteractivePprofSession{pprofSession: pprofSession{
+		PID:        pid,
+		ProfileURI: args.ProfileURI,
+		URL:        webURL,
+		StartedAt:  time.Now(),
+		process:    cmd.Process,
+		exited:     exited,
+	}}
+	if parsedURL, err := url.Parse(webURL); err == nil {
+		session.Port, _ = strconv.Atoi(parsedURL.Port())
+	}
+	pprofMutex.Lock()
+	runningPprofs[pid] = &session.pprofSession
+	pprofMutex.Unlock()
+
+	logInfo("Successfully started 'go tool pprof' in background with PID: %d, serving %s", pid, webURL)
+
+	resultText := fmt.Sprintf("已成功在后台启动 'go tool pprof' (PID: %d) 来分析 '%s'", pid, inputFilePath)
+	resultText += fmt.Sprintf("，Web UI 地址: %s", webURL)
+	if openInBrowser {
+		if err := openBrowser(webURL); err != nil {
+			logWarn("failed to open browser for %s: %v", webURL, err)
+			resultText += fmt.Sprintf("\n无法自动打开浏览器 (%v)，请手动访问上面的地址。", err)
+		} else {
+			session.BrowserOpened = true
+			resultText += "\n已在浏览器中打开。"
+		}
+	}
+	resultText += "\n你可以使用 'disconnect_pprof_session' 工具并提供 PID 来尝试终止此进程。"
+	resultText += "\n注意：如果是远程 URL，下载的临时 pprof 文件在进程结束前不会被自动删除。"
+
+	logInfo("%s", resultText)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				
+				Text: resultText,
+			},
+		},
+	}, session, nil
+}
+
+// DisconnectPprofSessionArgs 定义 disconnect_pprof_session 工具的输入参数
+type DisconnectPprofSessionArgs struct {
+	PID          float64 `json:"pid" jsonschema:"要终止的后台 pprof 进程的 PID (由 'open_interactive_pprof' 返回)"`
+	HTTPAddress  string  `json:"http_address,omitempty" jsonschema:"指定 pprof Web UI 的监听地址和端口 (例如 ':8081')，如果省略 pprof 会自动选择"`
+	GraceSeconds float64 `json:"grace_seconds,omitempty" jsonschema:"发送 Interrupt 信号后等待进程自行退出的秒数，超时后发送 Kill 信号 (默认 5)"`
+}
+
+// pprofDisconnectResult 是 disconnect_pprof_session 的结构化结果
+type pprofDisconnectResult struct {
+	pprofSession
+	Method        string `json:"method"`
+	AlreadyExited bool   `json:"alreadyExited"`
+}
+
+// handleDisconnectPprofSession 处理断开 pprof 会话的请求。
+func handleDisconnectPprofSession(_ context.Context, _ *mcp.CallToolRequest, args DisconnectPprofSessionArgs) (*mcp.CallToolResult, any, error) {
+	if args.PID <= 0 {
+		return nil, nil, fmt.Errorf("invalid PID: %d", int(args.PID))
+	}
+
+	if args.GraceSeconds < 0 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("grace_seconds must not be negative, got %v", args.GraceSeconds))
+	}
+	grace := defaultPprofGracePeriod
+	if args.GraceSeconds > 0 {
+		grace = time.Duration(args.GraceSeconds * float64(time.Second))
+	}
+
+	pid := int(args.PID)
+	logInfo("Handling disconnect_pprof_session for PID: %d (grace: %s)", pid, grace)
+
+	pprofMutex.Lock()
+	session, exists := runningPprofs[pid]
+	if !exists {
+		pprofMutex.Unlock()
+		logWarn("PID %d not found in running pprof sessions.", pid)
+		return nil, nil, fmt.Errorf("未找到 PID 为 %d 的正在运行的 pprof 会话 (可使用 'list_pprof_sessions' 查看所有会话)", pid)
+	}
+	// 无论终止结果如何都不再跟踪该会话
+	delete(runningPprofs, pid)
+	pprofMutex.Unlock()
+
+	logDebug("Attempting to terminate process with PID: %d", pid)
+	method, err := terminatePprofProcess(session.process, session.exited, grace)
+	if err != nil {
+		logError("Failed to send Kill signal to PID %d: %v", pid, err)
+		return nil, nil, fmt.Errorf("尝试终止 PID %d 失败：%w", pid, err)
+	}
+
+	var resultText string
+	switch method {
+	case pprofAlreadyExited:
+		resultText = fmt.Sprintf("PID %d 的 pprof 进程在断开之前已经退出，已停止跟踪该会话", pid)
+	case pprofTerminatedByInterrupt:
+		resultText = fmt.Sprintf("已通过 Interrupt 信号终止 PID %d 的 pprof 进程", pid)
+	default:
+		resultText = fmt.Sprintf("PID %d 的 pprof 进程在 %s 内未响应 Interrupt 信号，已通过 Kill 信号强制终止", pid, grace)
+	}
+	resultText += fmt.Sprintf(" (profile: %s, URL: %s)。", session.ProfileURI, session.URL)
+	logInfo("%s", resultText)
+
+	return newTextResult(resultText, nil), pprofDisconnectResult{
+		pprofSession:  *session,
+		Method:        method,
+		AlreadyExited: method == pprofAlreadyExited,
+	}, nil
+}
+
+// ListPprofSessionsArgs 定义 list_pprof_sessions 工具的输入参数 (无参数)
+type ListPprofSessionsArgs struct{}
+
+// pprofSessionList 是 list_pprof_sessions 的结构化结果
+type pprofSessionList struct {
+	Sessions []pprofSession `json:"sessions"`
+}
+
+// handleListPprofSessions 处理列出后台 pprof 会话的请求。
+func handleListPprofSessions(_ context.Context, _ *mcp.CallToolRequest, _ ListPprofSessionsArgs) (*mcp.CallToolResult, any, error) {
+	sessions := listPprofSessions()
+	logInfo("Handling list_pprof_sessions: %d active sessions", len(sessions))
+
+	if len(sessions) == 0 {
+		return newTextResult("当前没有正在运行的 pprof 会话。", nil), pprofSessionList{Sessions: sessions}, nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "正在运行的 pprof 会话 (%d 个):\n", len(sessions))
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tURL\tStarted\tUptime\tProfile")
+	for _, session := range sessions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			session.PID, session.URL, session.StartedAt.Format(time.RFC3339),
+			time.Since(session.StartedAt).Round(time.Second), session.ProfileURI)
+	}
+	w.Flush()
+	b.WriteString("\n可以使用 'disconnect_pprof_session' 工具并提供 PID 来终止会话。")
+
+	return newTextResult(b.String(), nil), pprofSessionList{Sessions: sessions}, nil
+}
+
+// cleanNamesOptions 返回 clean_names 和 strip_module_prefix 参数对应的函数名清理规则
+func cleanNamesOptions(cleanNames bool, stripModulePrefix string) analyzer.CleanNamesOptions {
+	return analyzer.CleanNamesOptions{
+		TrimClosures:     cleanNames,
+		CollapseGenerics: cleanNames,
+		StripPrefix:      stripModulePrefix,
+	}
+}
+
+// cleanProfileNames 在设置了 clean_names 或 strip_module_prefix 时返回清理函数名后的 profile，否则原样返回 p
+func cleanProfileNames(p *profile.Profile, cleanNames bool, stripModulePrefix string) *profile.Profile {
+	if !cleanNames && stripModulePrefix == "" {
+		return p
+	}
+	return analyzer.CleanFunctionNames(p, cleanNamesOptions(cleanNames, stripModulePrefix))
+}
+
+// CompareProfilesArgs 定义 compare_profiles 工具的输入参数
+type CompareProfilesArgs struct {
+	BaselineProfileURI              string   `json:"baseline_profile_uri" jsonschema:"基线 profile 的 URI (旧版本)，支持 'file://', 'http://', 'https://' 协议"`
+	TargetProfileURI                string   `json:"target_profile_uri" jsonschema:"目标 profile 的 URI (新版本)，支持 'file://', 'http://', 'https://' 协议"`
+	ProfileType                     string   `json:"profile_type" jsonschema:"要比较的 pprof profile 的类型 (cpu, heap, allocs, mutex, block)"`
+	TopN                            float64  `json:"top_n,omitempty" jsonschema:"返回结果的数量上限"`
+	OutputFormat                    string   `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json, benchstat)"`
+	RedactLabels                    []string `json:"redact_labels,omitempty" jsonschema:"需要脱敏的标签键列表，这些标签的值在输出中会被替换为哈希值"`
+	ExcludeLowConfidence            bool     `json:"exclude_low_confidence,omitempty" jsonschema:"为 true 时，样本数过少的低置信度差异不计入提升/回归统计，并排在结果末尾"`
+	Aggregation                     string   `json:"aggregation,omitempty" jsonschema:"差异的聚合方式: leaf (默认，只按叶子函数)、cumulative (计入调用栈上的每个函数，每个样本每个函数只计一次) 或 full_stack (按完整调用栈)"`
+	ValueType                       string   `json:"value_type,omitempty" jsonschema:"显式指定比较的样本类型 (例如 heap 的 inuse_space、inuse_objects、alloc_space、alloc_objects)。任意一个 profile 缺少该类型时报错；未指定时按 profile_type 选择"`
+	BaselineValueType               string   `json:"baseline_value_type,omitempty" jsonschema:"只为 baseline 指定比较的样本类型，优先于 value_type。与 target_value_type 一起用于跨指标比较 (例如 allocs profile 的 alloc_space 与 heap profile 的 inuse_space)：两边的单位必须相同，报告中会提示跨指标比较只是近似结果。baseline 缺少该类型时报错"`
+	TargetValueType                 string   `json:"target_value_type,omitempty" jsonschema:"只为 target 指定比较的样本类型，优先于 value_type，用法同 baseline_value_type。target 缺少该类型时报错"`
+	IncludeRegex                    string   `json:"include_regex,omitempty" jsonschema:"可选的正则表达式，只比较完整函数名匹配的函数 (例如 '^github.com/myorg/')；摘要中的函数统计只包含过滤后的函数"`
+	ExcludeRegex                    string   `json:"exclude_regex,omitempty" jsonschema:"可选的正则表达式，不比较完整函数名匹配的函数 (例如 '^runtime\\.')；与 include_regex 冲突时 exclude_regex 优先"`
+	NormalizeByDuration             bool     `json:"normalize_by_duration,omitempty" jsonschema:"为 true 时按采集时长 (DurationNanos) 将 target 的值缩放到 baseline 的时长再比较，避免采集时间更长的 target 被误判为回归；两个 profile 都必须记录了采集时长"`
+	RegressionThresholdPercent      float64  `json:"regression_threshold_percent,omitempty" jsonschema:"单函数回归阈值 (百分比)：设置后，值增长超过该百分比的函数判定为回归 (新增函数按 100% 计；exclude_low_confidence 时忽略低置信度差异)。结果中附带 hasRegression 和超过阈值的函数列表，并作为结构化结果返回，便于 CI 门禁"`
+	TotalRegressionThresholdPercent float64  `json:"total_regression_threshold_percent,omitempty" jsonschema:"总量回归阈值 (百分比)：设置后，profile 总值增长超过该百分比时判定为回归。与 regression_threshold_percent 相互独立，任意一个被超过时 hasRegression 为 true"`
+	CleanNames                      bool     `json:"clean_names,omitempty" jsonschema:"为 true 时清理两个 profile 的函数名后再比较：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]"`
+	StripModulePrefix               string   `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')；include_regex 和 exclude_regex 匹配的是清理后的函数名"`
+	SortBy                          string   `json:"sort_by,omitempty" jsonschema:"差异的排序方式: abs_percent (默认，按变化百分比的绝对值)、abs_value (按变化量的绝对值，避免基数很小的函数因百分比大而排在前面) 或 value (按变化量从大到小，回归最严重的函数排在前面)"`
+	CollapseRecursion               bool     `json:"collapse_recursion,omitempty" jsonschema:"为 true 时先折叠两个 profile 中的递归调用 (同一函数在一个样本的调用栈中只保留最靠近叶子的一帧)，使 full_stack 聚合时递归深度不同的调用栈合并为同一个"`
+	NoCache                         bool     `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleCompareProfiles 处理 profile 比较的请求。
+func handleCompareProfiles(ctx context.Context, _ *mcp.CallToolRequest, args CompareProfilesArgs) (*mcp.CallToolResult, any, error) {
+	if args.BaselineProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: baseline_profile_uri")
+	}
+	if args.TargetProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: target_profile_uri")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+
+	// 设置默认值
+	if args.TopN <= 0 {
+		args.TopN = 10
+	}
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if err := validateFormat(args.OutputFormat, compareFormats); err != nil {
+		return nil, nil, err
+	}
+	switch args.Aggregation {
+	case "":
+		args.Aggregation = analyzer.AggregationLeaf
+	case analyzer.AggregationLeaf, analyzer.AggregationCumulative, analyzer.AggregationFullStack:
+	default:
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported aggregation: '%s' (expected leaf, cumulative or full_stack)", args.Aggregation))
+	}
+	if args.RegressionThresholdPercent < 0 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("regression_threshold_percent must not be negative, got %v", args.RegressionThresholdPercent))
+	}
+	if args.TotalRegressionThresholdPercent < 0 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("total_regression_threshold_percent must not be negative, got %v", args.TotalRegressionThresholdPercent))
+	}
+	if args.SortBy != "" && !slices.Contains(analyzer.DiffSortKeys, args.SortBy) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported sort_by: '%s' (expected %s)", args.SortBy, strings.Join(analyzer.DiffSortKeys, ", ")))
+	}
+
+	var includeRe, excludeRe *regexp.Regexp
+	if args.IncludeRegex != "" {
+		re, err := regexp.Compile(args.IncludeRegex)
+		if err != nil {
+			return nil, nil, NewInvalidArgumentError(fmt.Sprintf("invalid include_regex '%s': %v", args.IncludeRegex, err))
+		}
+		includeRe = re
+	}
+	if args.ExcludeRegex != "" {
+		re, err := regexp.Compile(args.ExcludeRegex)
+		if err != nil {
+			return nil, nil, NewInvalidArgumentError(fmt.Sprintf("invalid exclude_regex '%s': %v", args.ExcludeRegex, err))
+		}
+		excludeRe = re
+	}
+
+	topN := int(args.TopN)
+	logInfo("Handling compare_profiles: Baseline=%s, Target=%s, Type=%s, TopN=%d, Format=%s",
+		args.BaselineProfileURI, args.TargetProfileURI, args.ProfileType, topN, args.OutputFormat)
+
+	// 获取基线 profile
+	baselineProf, err := loadProfile(ctx, args.BaselineProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load baseline profile: %w", err)
+	}
+
+	// 获取目标 profile
+	targetProf, err := loadProfile(ctx, args.TargetProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load target profile: %w", err)
+	}
+
+	if len(args.RedactLabels) > 0 {
+		baselineProf = analyzer.RedactLabels(baselineProf, args.RedactLabels)
+		targetProf = analyzer.RedactLabels(targetProf, args.RedactLabels)
+	}
+	if args.CleanNames || args.StripModulePrefix != "" {
+		opts := cleanNamesOptions(args.CleanNames, args.StripModulePrefix)
+		baselineProf = analyzer.CleanFunctionNames(baselineProf, opts)
+		targetProf = analyzer.CleanFunctionNames(targetProf, opts)
+	}
+	if args.CollapseRecursion {
+		baselineProf = analyzer.CollapseRecursion(baselineProf)
+		targetProf = analyzer.CollapseRecursion(targetProf)
+	}
+
+	// 执行比较
+	result, verdict, err := analyzer.CompareProfilesContext(ctx, baselineProf, targetProf, args.ProfileType, analyzer.CompareOptions{
+		TopN:                            topN,
+		Format:                          args.OutputFormat,
+		ExcludeLowConfidence:            args.ExcludeLowConfidence,
+		Aggregation:                     args.Aggregation,
+		ValueType:                       args.ValueType,
+		BaselineValueType:               args.BaselineValueType,
+		TargetValueType:                 args.TargetValueType,
+		Include:                         includeRe,
+		Exclude:                         excludeRe,
+		NormalizeByDuration:             args.NormalizeByDuration,
+		RegressionThresholdPercent:      args.RegressionThresholdPercent,
+		TotalRegressionThresholdPercent: args.TotalRegressionThresholdPercent,
+		SortBy:                          args.SortBy,
+	})
+	if err != nil {
+		return nil, nil, wrapAnalysisError("比较 profile", "failed to compare profiles", err)
+	}
+
+	var notes []string
+	for _, p := range []struct {
+		name      string
+		prof      *profile.Profile
+		valueType string
+	}{{"baseline", baselineProf, args.BaselineValueType}, {"target", targetProf, args.TargetValueType}} {
+		// 单独指定了样本类型的一边不按 profile_type 选择列，不需要提示
+		if p.valueType != "" {
+			continue
+		}
+		if warning := analyzer.ValueColumnWarning(p.prof, args.ProfileType); warning != "" {
+			notes = append(notes, p.name+": "+warning)
+		}
+	}
+
+	logDebug("Profile comparison completed successfully. Result length: %d", len(result))
+	if verdict != nil {
+		// 回归判定同时作为结构化结果返回，调用方无需解析报告即可根据 hasRegression 决定是否失败
+		return newTextResult(result, notes), verdict, nil
+	}
+	return newTextResult(result, notes), nil, nil
+}
+
+// AnalyzeHeapTimeSeriesArgs 定义 analyze_heap_time_series 工具的输入参数
+type AnalyzeHeapTimeSeriesArgs struct {
+	ProfileURIs           []string `json:"profile_uris" jsonschema:"多个 heap profile 的 URI 数组（按时间顺序），支持 'file://', 'http://', 'https://' 协议"`
+	Labels                []string `json:"labels,omitempty" jsonschema:"每个时间点的标签数组（可选），长度必须与 profile_uris 相同"`
+	OutputFormat          string   `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	RedactLabels          []string `json:"redact_labels,omitempty" jsonschema:"需要脱敏的标签键列表，这些标签的值在输出中会被替换为哈希值"`
+	AlertThresholdPercent float64  `json:"alert_threshold_percent,omitempty" jsonschema:"告警阈值 (百分比，默认 20)：增长百分比超过该值、且在所有时间点上单调增长 (不只是最后一个点高于第一个点) 的对象类型列入告警列表，排除只出现一次尖峰的噪声类型"`
+}
+
+// handleAnalyzeHeapTimeSeries 处理内存时序分析的请求。
+func handleAnalyzeHeapTimeSeries(ctx context.Context, _ *mcp.CallToolRequest, args AnalyzeHeapTimeSeriesArgs) (*mcp.CallToolResult, any, error) {
+	if len(args.ProfileURIs) < 3 {
+		return nil, nil, fmt.Errorf("至少需要 3 个 profile 来进行时序分析，当前只有 %d 个", len(args.ProfileURIs))
+	}
+
+	// 设置默认值
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+
+	// 如果没有提供标签，生成默认标签
+	labels := args.Labels
+	if len(labels) == 0 {
+		labels = make([]string, len(args.ProfileURIs))
+		for i := range args.ProfileURIs {
+			labels[i] = fmt.Sprintf("T%d", i+1)
+		}
+	} else if len(labels) != len(args.ProfileURIs) {
+		return nil, nil, fmt.Errorf("标签数量 (%d) 与 profile 数量 (%d) 不匹配", len(labels), len(args.ProfileURIs))
+	}
+	if args.AlertThresholdPercent < 0 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("alert_threshold_percent must not be negative, got %v", args.AlertThresholdPercent))
+	}
+
+	logInfo("Handling analyze_heap_time_series: profiles=%d, format=%s", len(args.ProfileURIs), args.OutputFormat)
+
+	// 依次获取所有 profile 文件，然后并发解析 (快照较多时解析耗时占主要部分)
+	filePaths := make([]string, len(args.ProfileURIs))
+	for i, uri := range args.ProfileURIs {
+		filePath, cleanup, err := getProfileAsFile(ctx, uri)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get profile file #%d: %w", i+1, err)
+		}
+		defer cleanup()
+		filePaths[i] = filePath
+	}
+
+	profiles, err := parseProfilesConcurrently(ctx, filePaths)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, prof := range profiles {
+		if len(args.RedactLabels) > 0 {
+			profiles[i] = analyzer.RedactLabels(prof, args.RedactLabels)
+		}
+		logDebug("Successfully parsed profile #%d: %d samples", i+1, len(prof.Sample))
+	}
+
+	// 执行时序分析
+	result, err := analyzer.AnalyzeHeapTimeSeriesContext(ctx, profiles, labels, args.OutputFormat, analyzer.TimeSeriesOptions{
+		AlertThresholdPercent: args.AlertThresholdPercent,
+	})
+	if err != nil {
+		return nil, nil, wrapAnalysisError("分析 heap 时序", "failed to analyze time series", err)
+	}
+
+	logDebug("Heap time series analysis completed successfully. Result length: %d", len(result))
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: result,
+			},
+		},
+	}, nil, nil
+}
+
+// DescribeProfileArgs 定义 describe_profile 工具的输入参数
+type DescribeProfileArgs struct {
+	ProfileURI   string `json:"profile_uri" jsonschema:"要查看的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	OutputFormat string `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	NoCache      bool   `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleDescribeProfile 处理查看 profile 概览的请求。
+func handleDescribeProfile(ctx context.Context, _ *mcp.CallToolRequest, args DescribeProfileArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+
+	// 设置默认值
+	if args.OutputFormat == "" {
+		args.OutputFormat = "text"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+
+	logInfo("Handling describe_profile: URI=%s, Format=%s", args.ProfileURI, args.OutputFormat)
+
+	prof, err := loadProfile(ctx, args.ProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+
+	result, err := analyzer.DescribeProfile(prof, args.OutputFormat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to describe profile: %w", err)
+	}
+
+	logDebug("Profile description completed successfully. Result length: %d", len(result))
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: result,
+			},
+		},
+	}, nil, nil
+}
+
+// ValidateProfileArgs 定义 validate_profile 工具的输入参数
+type ValidateProfileArgs struct {
+	ProfileURI   string `json:"profile_uri" jsonschema:"要校验的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	OutputFormat string `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+}
+
+// handleValidateProfile 处理校验 profile 内部一致性的请求。
+// profile 不经过缓存，也不经过会在第一个问题处失败的 profile.Parse，而是用 decodeProfileFile 解码后再逐项检查。
+// 无法解码的 profile 作为校验问题返回；文件不存在、下载失败等加载错误仍直接返回错误。
+func handleValidateProfile(ctx context.Context, _ *mcp.CallToolRequest, args ValidateProfileArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+
+	// 设置默认值
+	if args.OutputFormat == "" {
+		args.OutputFormat = "text"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+
+	logInfo("Handling validate_profile: URI=%s, Format=%s", args.ProfileURI, args.OutputFormat)
+
+	filePath, cleanup, err := getProfileAsFile(ctx, args.ProfileURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+	defer cleanup()
+
+	var validation analyzer.ProfileValidation
+	prof, err := decodeProfileFile(filePath)
+	var appErr *AppError
+	switch {
+	case errors.As(err, &appErr) && appErr.Code == ErrCodeParseFailed:
+		validation.Problems = []analyzer.ValidationProblem{{Check: analyzer.ValidationParse, Message: err.Error()}}
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
+	default:
+		validation = analyzer.ValidateProfile(prof)
+	}
+
+	result, err := analyzer.FormatProfileValidation(validation, args.OutputFormat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to format validation result: %w", err)
+	}
+
+	logDebug("Profile validation completed: valid=%t, problems=%d", validation.Valid, len(validation.Problems))
+	return newTextResult(result, nil), nil, nil
+}
+
+// CheckGoroutinesArgs 定义 check_goroutines 工具的输入参数
+type CheckGoroutinesArgs struct {
+	ProfileURI         string  `json:"profile_uri" jsonschema:"要检查的 goroutine profile 的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	MaxGoroutines      float64 `json:"max_goroutines,omitempty" jsonschema:"goroutine 总数的上限，超过即判定为未通过"`
+	BaselineProfileURI string  `json:"baseline_profile_uri,omitempty" jsonschema:"可选的基线 goroutine profile 的 URI，用于计算相对基线的变化"`
+	MaxIncrease        float64 `json:"max_increase,omitempty" jsonschema:"相对基线允许增长的 goroutine 数量 (默认为 0)"`
+	TopN               float64 `json:"top_n,omitempty" jsonschema:"未通过时展示的堆栈数量 (默认为 5)"`
+	OutputFormat       string  `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	NoCache            bool    `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleCheckGoroutines 处理 goroutine 数量健康检查的请求。
+func handleCheckGoroutines(ctx context.Context, _ *mcp.CallToolRequest, args CheckGoroutinesArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+	if args.MaxGoroutines <= 0 && args.BaselineProfileURI == "" {
+		return nil, nil, NewInvalidArgumentError("either max_goroutines or baseline_profile_uri is required")
+	}
+
+	// 设置默认值
+	if args.TopN <= 0 {
+		args.TopN = 5
+	}
+	if args.OutputFormat == "" {
+		args.OutputFormat = "text"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+
+	logInfo("Handling check_goroutines: URI=%s, Max=%d, Baseline=%s, MaxIncrease=%d, Format=%s",
+		args.ProfileURI, int64(args.MaxGoroutines), args.BaselineProfileURI, int64(args.MaxIncrease), args.OutputFormat)
+
+	prof, err := loadProfile(ctx, args.ProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+
+	opts := analyzer.GoroutineCheckOptions{
+		MaxGoroutines: int64(args.MaxGoroutines),
+		MaxIncrease:   int64(args.MaxIncrease),
+		TopN:          int(args.TopN),
+	}
+
+	if args.BaselineProfileURI != "" {
+		opts.Baseline, err = loadProfile(ctx, args.BaselineProfileURI, args.NoCache)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load baseline profile: %w", err)
+		}
+	}
+
+	result, err := analyzer.CheckGoroutines(prof, opts, args.OutputFormat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check goroutines: %w", err)
+	}
+
+	logDebug("Goroutine check completed successfully. Result length: %d", len(result))
+	return newTextResult(result, nil), nil, nil
+}
+
+// ExportHeapGrowthProfileArgs 定义 export_heap_growth_profile 工具的输入参数
+type ExportHeapGrowthProfileArgs struct {
+	ProfileURIs []string `json:"profile_uris" jsonschema:"多个 heap profile 的 URI 数组（按时间顺序，至少 2 个），支持 'file://', 'http://', 'https://' 协议"`
+	OutputPath  string   `json:"output_path" jsonschema:"生成的增长率 pprof 文件的保存路径 (必须是绝对路径或相对于工作区的路径)"`
+	NoCache     bool     `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleExportHeapGrowthProfile 处理将多个 heap profile 合成增长率 profile 的请求。
+func handleExportHeapGrowthProfile(ctx context.Context, _ *mcp.CallToolRequest, args ExportHeapGrowthProfileArgs) (*mcp.CallToolResult, any, error) {
+	if len(args.ProfileURIs) < 2 {
+		return nil, nil, fmt.Errorf("至少需要 2 个 profile 来计算增长率，当前只有 %d 个", len(args.ProfileURIs))
+	}
+	if args.OutputPath == "" {
+		return nil, nil, fmt.Errorf("missing required argument: output_path")
+	}
+
+	if !filepath.IsAbs(args.OutputPath) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			logError("无法获取当前工作目录: %v", err)
+		} else {
+			args.OutputPath = filepath.Join(cwd, args.OutputPath)
+		}
+	}
+
+	logInfo("Handling export_heap_growth_profile: profiles=%d, output=%s", len(args.ProfileURIs), args.OutputPath)
+
+	profiles := make([]*profile.Profile, len(args.ProfileURIs))
+	for i, uri := range args.ProfileURIs {
+		prof, err := loadProfile(ctx, uri, args.NoCache)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load profile #%d: %w", i+1, err)
+		}
+		profiles[i] = prof
+	}
+
+	growthProf, info, err := analyzer.BuildHeapGrowthProfile(profiles)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build heap growth profile: %w", err)
+	}
+
+	outFile, err := os.Create(args.OutputPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file '%s': %w", args.OutputPath, err)
+	}
+	defer outFile.Close()
+	if err := growthProf.Write(outFile); err != nil {
+		return nil, nil, fmt.Errorf("failed to write heap growth profile '%s': %w", args.OutputPath, err)
+	}
+
+	var totalRate int64
+	for _, s := range growthProf.Sample {
+		totalRate += s.Value[0]
+	}
+
+	resultText := fmt.Sprintf("增长率 profile 已保存到: %s\n"+
+		"样本类型: %s (bytes)\n"+
+		"时间跨度: %.1f 分钟 (%d 个快照)\n"+
+		"增长的调用栈: %d 个，合计增长率: %s/分钟\n"+
+		"可使用 generate_flamegraph (profile_type: heap_growth) 或 'go tool pprof -http=: %s' 查看增长最快的调用栈。",
+		args.OutputPath, analyzer.GrowthSampleType, info.TimeSpanMinutes, len(profiles),
+		len(growthProf.Sample), analyzer.FormatBytes(totalRate), args.OutputPath)
+
+	var notes []string
+	if info.TimestampsEstimated {
+		notes = append(notes, "部分 profile 缺少有效的采集时间戳 (TimeNanos)，已假设每个快照间隔 1 分钟计算增长率。")
+	}
+
+	logInfo("Heap growth profile written to %s", args.OutputPath)
+	return newTextResult(resultText, notes), nil, nil
+}
+
+// DiffProfileArgs 定义 diff_profile 工具的输入参数
+type DiffProfileArgs struct {
+	BaselineProfileURI string  `json:"baseline_profile_uri" jsonschema:"基线 profile 的 URI (旧版本)，支持 'file://', 'http://', 'https://' 协议"`
+	TargetProfileURI   string  `json:"target_profile_uri" jsonschema:"目标 profile 的 URI (新版本)，支持 'file://', 'http://', 'https://' 协议"`
+	ProfileType        string  `json:"profile_type" jsonschema:"profile 的类型 (cpu, heap, allocs, mutex, block)"`
+	TopN               float64 `json:"top_n,omitempty" jsonschema:"返回结果的数量上限"`
+	OutputFormat       string  `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	OutputPath         string  `json:"output_path,omitempty" jsonschema:"可选，将差值 profile (target - baseline) 保存为 pprof 文件的路径"`
+	CleanNames         bool    `json:"clean_names,omitempty" jsonschema:"为 true 时清理两个 profile 的函数名后再计算差值，规则同 analyze_pprof 的 clean_names：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]；output_path 保存的差值 profile 也使用清理后的函数名"`
+	StripModulePrefix  string  `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，可以单独使用，也可以与 clean_names 一起使用"`
+	NoCache            bool    `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleDiffProfile 处理差值 profile 分析的请求。
+func handleDiffProfile(ctx context.Context, _ *mcp.CallToolRequest, args DiffProfileArgs) (*mcp.CallToolResult, any, error) {
+	if args.BaselineProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: baseline_profile_uri")
+	}
+	if args.TargetProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: target_profile_uri")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+
+	// 设置默认值
+	if args.TopN <= 0 {
+		args.TopN = 10
+	}
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+
+	topN := int(args.TopN)
+	logInfo("Handling diff_profile: Baseline=%s, Target=%s, Type=%s, TopN=%d, Format=%s",
+		args.BaselineProfileURI, args.TargetProfileURI, args.ProfileType, topN, args.OutputFormat)
+
+	baselineProf, err := loadProfile(ctx, args.BaselineProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load baseline profile: %w", err)
+	}
+
+	targetProf, err := loadProfile(ctx, args.TargetProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load target profile: %w", err)
+	}
+	baselineProf = cleanProfileNames(baselineProf, args.CleanNames, args.StripModulePrefix)
+	targetProf = cleanProfileNames(targetProf, args.CleanNames, args.StripModulePrefix)
+
+	result, err := analyzer.AnalyzeDeltaProfile(baselineProf, targetProf, args.ProfileType, topN, args.OutputFormat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to analyze delta profile: %w", err)
+	}
+
+	var notes []string
+	if args.OutputPath != "" {
+		if !filepath.IsAbs(args.OutputPath) {
+			if cwd, err := os.Getwd(); err == nil {
+				args.OutputPath = filepath.Join(cwd, args.OutputPath)
+			}
+		}
+		delta, err := analyzer.DeltaProfile(baselineProf, targetProf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to build delta profile: %w", err)
+		}
+		outFile, err := os.Create(args.OutputPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create output file '%s': %w", args.OutputPath, err)
+		}
+		defer outFile.Close()
+		if err := delta.Write(outFile); err != nil {
+			return nil, nil, fmt.Errorf("failed to write delta profile '%s': %w", args.OutputPath, err)
+		}
+		notes = append(notes, fmt.Sprintf("差值 profile 已保存到: %s", args.OutputPath))
+	}
+
+	logDebug("Delta profile analysis completed successfully. Result length: %d", len(result))
+	return newTextResult(result, notes), nil, nil
+}
+
+// SanitizeProfileArgs 定义 sanitize_profile 工具的输入参数
+type SanitizeProfileArgs struct {
+	ProfileURI string `json:"profile_uri" jsonschema:"要脱敏的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	OutputPath string `json:"output_path" jsonschema:"脱敏后的 pprof 文件的保存路径 (必须是绝对路径或相对于工作区的路径)"`
+	KeepStdlib bool   `json:"keep_stdlib,omitempty" jsonschema:"为 true 时保留 Go 标准库函数名 (runtime、net/http 等)，便于排查问题"`
+	Salt       string `json:"salt,omitempty" jsonschema:"可选的哈希盐值；对多个 profile 使用相同的盐值可以保持它们之间的可比较性"`
+	NoCache    bool   `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleSanitizeProfile 处理 profile 脱敏的请求。
+func handleSanitizeProfile(ctx context.Context, _ *mcp.CallToolRequest, args SanitizeProfileArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+	if args.OutputPath == "" {
+		return nil, nil, fmt.Errorf("missing required argument: output_path")
+	}
+
+	if !filepath.IsAbs(args.OutputPath) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			logError("无法获取当前工作目录: %v", err)
+		} else {
+			args.OutputPath = filepath.Join(cwd, args.OutputPath)
+		}
+	}
+
+	logInfo("Handling sanitize_profile: URI=%s, Output=%s, KeepStdlib=%t", args.ProfileURI, args.OutputPath, args.KeepStdlib)
+
+	prof, err := loadProfile(ctx, args.ProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+
+	sanitized, stats := analyzer.SanitizeProfile(prof, analyzer.SanitizeOptions{
+		KeepStdlib: args.KeepStdlib,
+		Salt:       args.Salt,
+	})
+
+	outFile, err := os.Create(args.OutputPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file '%s': %w", args.OutputPath, err)
+	}
+	defer outFile.Close()
+	if err := sanitized.Write(outFile); err != nil {
+		return nil, nil, fmt.Errorf("failed to write sanitized profile '%s': %w", args.OutputPath, err)
+	}
+
+	resultText := fmt.Sprintf("脱敏后的 profile 已保存到: %s\n"+
+		"已哈希: %d 个函数名, %d 个文件路径, %d 个 mapping, %d 个标签值\n"+
+		"样本值和调用栈结构保持不变，相同的名字总是映射为相同的 token。",
+		args.OutputPath, stats.Functions, stats.Files, stats.Mappings, stats.Labels)
+
+	logInfo("Sanitized profile written to %s", args.OutputPath)
+	return newTextResult(resultText, nil), nil, nil
+}
+
+// profileNameFromURI 返回 URI 中的文件名部分，用于根据文件名推断 profile 类型
+func profileNameFromURI(uri string) string {
+	if parsed, err := url.Parse(uri); err == nil && parsed.Path != "" {
+		return filepath.Base(parsed.Path)
+	}
+	return filepath.Base(uri)
+}
+
+// AnalyzeLabelsArgs 定义 analyze_labels 工具的输入参数
+type AnalyzeLabelsArgs struct {
+	ProfileURI        string   `json:"profile_uri" jsonschema:"要分析的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	ProfileType       string   `json:"profile_type" jsonschema:"profile 的类型 (cpu, heap, allocs, goroutine, mutex, block)"`
+	LabelKeys         []string `json:"label_keys" jsonschema:"分组使用的标签键：1 个键按标签值分组，2 个键输出 行 × 列 的透视表 (例如 [\"endpoint\", \"status_code\"])"`
+	MaxValues         float64  `json:"max_values,omitempty" jsonschema:"每个标签维度保留的值数量上限，其余值合并为 (other) (默认为 10)"`
+	RedactLabels      []string `json:"redact_labels,omitempty" jsonschema:"需要脱敏的标签键列表，这些标签的值在输出中会被替换为哈希值"`
+	OutputFormat      string   `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	CleanNames        bool     `json:"clean_names,omitempty" jsonschema:"为 true 时清理函数名后再分析，规则同 analyze_pprof 的 clean_names：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]"`
+	StripModulePrefix string   `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，可以单独使用，也可以与 clean_names 一起使用"`
+	NoCache           bool     `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleAnalyzeLabels 处理按标签分组/交叉分析的请求。
+func handleAnalyzeLabels(ctx context.Context, _ *mcp.CallToolRequest, args AnalyzeLabelsArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+	if len(args.LabelKeys) == 0 {
+		return nil, nil, fmt.Errorf("missing required argument: label_keys")
+	}
+	if len(args.LabelKeys) > 2 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("label_keys accepts at most 2 keys, got %d", len(args.LabelKeys)))
+	}
+	if args.MaxValues < 0 || args.MaxValues != float64(int64(args.MaxValues)) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("max_values must be a positive integer, got %v", args.MaxValues))
+	}
+
+	// 设置默认值
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+
+	logInfo("Handling analyze_labels: URI=%s, Type=%s, Keys=%v, Format=%s", args.ProfileURI, args.ProfileType, args.LabelKeys, args.OutputFormat)
+
+	prof, err := loadProfile(ctx, args.ProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+	if len(args.RedactLabels) > 0 {
+		prof = analyzer.RedactLabels(prof, args.RedactLabels)
+	}
+	prof = cleanProfileNames(prof, args.CleanNames, args.StripModulePrefix)
+
+	result, err := analyzer.AnalyzeLabelPivot(prof, args.ProfileType, analyzer.LabelPivotOptions{
+		Keys:      args.LabelKeys,
+		MaxValues: int(args.MaxValues),
+	}, args.OutputFormat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to analyze labels: %w", err)
+	}
+
+	logDebug("Label analysis completed successfully. Result length: %d", len(result))
+	return newTextResult(result, nil), nil, nil
+}
+
+// EstimateImpactArgs 定义 estimate_optimization_impact 工具的输入参数
+type EstimateImpactArgs struct {
+	ProfileURI        string  `json:"profile_uri" jsonschema:"要分析的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	ProfileType       string  `json:"profile_type" jsonschema:"profile 的类型 (cpu, heap, allocs, goroutine, mutex, block)"`
+	Function          string  `json:"function" jsonschema:"要优化的函数名，例如 analyze_pprof 结果中的热点函数 (完整函数名，或只匹配一个函数的子串)"`
+	ReductionPercent  float64 `json:"reduction_percent" jsonschema:"假设该函数的开销降低的百分比，范围 (0, 100]，例如 50 表示快一倍"`
+	Attribution       string  `json:"attribution,omitempty" jsonschema:"归因方式: flat (默认，只计函数自身的开销) 或 cumulative (包含它调用的所有函数)"`
+	OutputFormat      string  `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	CleanNames        bool    `json:"clean_names,omitempty" jsonschema:"为 true 时清理函数名后再估算，规则同 analyze_pprof 的 clean_names：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]；function 匹配的是清理后的函数名"`
+	StripModulePrefix string  `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，可以单独使用，也可以与 clean_names 一起使用"`
+	NoCache           bool    `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleEstimateImpact 处理优化收益估算的请求。
+func handleEstimateImpact(ctx context.Context, _ *mcp.CallToolRequest, args EstimateImpactArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+	if args.Function == "" {
+		return nil, nil, fmt.Errorf("missing required argument: function")
+	}
+	if args.ReductionPercent <= 0 || args.ReductionPercent > 100 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("reduction_percent must be in (0, 100], got %v", args.ReductionPercent))
+	}
+	switch args.Attribution {
+	case "":
+		args.Attribution = analyzer.AttributionFlat
+	case analyzer.AttributionFlat, analyzer.AttributionCumulative:
+	default:
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported attribution: '%s' (expected flat or cumulative)", args.Attribution))
+	}
+
+	// 设置默认值
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+
+	logInfo("Handling estimate_optimization_impact: URI=%s, Type=%s, Function=%s, Reduction=%v%%, Attribution=%s, Format=%s",
+		args.ProfileURI, args.ProfileType, args.Function, args.ReductionPercent, args.Attribution, args.OutputFormat)
+
+	prof, err := loadProfile(ctx, args.ProfileURI, args.NoCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+	prof = cleanProfileNames(prof, args.CleanNames, args.StripModulePrefix)
+
+	result, err := analyzer.EstimateOptimizationImpactContext(ctx, prof, args.ProfileType, args.Function, args.ReductionPercent, args.Attribution, args.OutputFormat)
+	if err != nil {
+		return nil, nil, wrapAnalysisError("估算优化收益", "failed to estimate optimization impact", err)
+	}
+
+	var notes []string
+	if warning := analyzer.ValueColumnWarning(prof, args.ProfileType); warning != "" {
+		notes = append(notes, warning)
+	}
+
+	logDebug("Optimization impact estimate completed successfully. Result length: %d", len(result))
+	return newTextResult(result, notes), nil, nil
+}
+
+// DetectGoroutineLeaksArgs 定义 detect_goroutine_leaks 工具的输入参数
+type DetectGoroutineLeaksArgs struct {
+	BaselineProfileURI string `json:"baseline_profile_uri" jsonschema:"较早的 goroutine profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
+	TargetProfileURI   string `json:"target_profile_uri" jsonschema:"较新的 goroutine profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
+	OutputFormat       string `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	NoCache            bool   `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleDetectGoroutineLeaks 处理 goroutine 泄漏检测的请求。
+func handleDetectGoroutineLeaks(ctx context.Context, _ *mcp.CallToolRequest, args DetectGoroutineLeaksArgs) (*mcp.CallToolResult, any, error) {
+	if args.BaselineProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: baseline_profile_uri")
+	}
+	if args.TargetProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: target_profile_uri")
+	}
+
+	// 设置默认值
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
 	}
-	defer oldCleanup()
-
-	oldFile, err := os.Open(oldFilePath)
-	if err != nil {
-		log.Printf("Error opening old profile file '%s': %v", oldFilePath, err)
-		return nil, nil, fmt.Errorf("failed to open old profile file '%s': %w", oldFilePath, err)
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
 	}
-	defer oldFile.Close()
 
-	oldProf, err := profile.Parse(oldFile)
-	if err != nil {
-		log.Printf("Error parsing old profile file '%s': %v", oldFilePath, err)
-		return nil, nil, fmt.Errorf("failed to parse old profile file '%s': %w", oldFilePath, err)
-	}
-	log.Printf("Successfully parsed old profile file from path: %s", oldFilePath)
+	logInfo("Handling detect_goroutine_leaks: Baseline=%s, Target=%s, Format=%s",
+		args.BaselineProfileURI, args.TargetProfileURI, args.OutputFormat)
 
-	// Get the new profile file
-	newFilePath, newCleanup, err := getProfileAsFile(args.NewProfileURI)
+	// 获取基线 profile
+	baselineProf, err := loadProfile(ctx, args.BaselineProfileURI, args.NoCache)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get new profile file: %w", err)
+		return nil, nil, fmt.Errorf("failed to load baseline profile: %w", err)
 	}
-	defer newCleanup()
 
-	newFile, err := os.Open(newFilePath)
+	// 获取目标 profile
+	targetProf, err := loadProfile(ctx, args.TargetProfileURI, args.NoCache)
 	if err != nil {
-		log.Printf("Error opening new profile file '%s': %v", newFilePath, err)
-		return nil, nil, fmt.Errorf("failed to open new profile file '%s': %w", newFilePath, err)
+		return nil, nil, fmt.Errorf("failed to load target profile: %w", err)
 	}
-	defer newFile.Close()
 
-	newProf, err := profile.Parse(newFile)
+	result, err := analyzer.DetectGoroutineLeaks(baselineProf, targetProf, args.OutputFormat)
 	if err != nil {
-		log.Printf("Error parsing new profile file '%s': %v", newFilePath, err)
-		return nil, nil, fmt.Errorf("failed to parse new profile file '%s': %w", newFilePath, err)
+		return nil, nil, fmt.Errorf("failed to detect goroutine leaks: %w", err)
 	}
-	log.Printf("Successfully parsed new profile file from path: %s", newFilePath)
 
-	// Detect memory leaks
-	result, err := analyzer.DetectPotentialMemoryLeaks(oldProf, newProf, args.Threshold, limit)
-	if err != nil {
-		log.Printf("Error detecting memory leaks: %v", err)
-		return nil, nil, fmt.Errorf("failed to detect memory leaks: %w", err)
+	var notes []string
+	for _, p := range []struct {
+		name string
+		prof *profile.Profile
+	}{{"baseline", baselineProf}, {"target", targetProf}} {
+		if warning := analyzer.ValueColumnWarning(p.prof, "goroutine"); warning != "" {
+			notes = append(notes, p.name+": "+warning)
+		}
 	}
 
-	log.Printf("Memory leak detection completed successfully. Result length: %d", len(result))
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				
-				Text: result,
-			},
-		},
-	}, nil, nil
+	logDebug("Goroutine leak detection completed successfully. Result length: %d", len(result))
+	return newTextResult(result, notes), nil, nil
 }
 
-// OpenInteractivePprofArgs 定义 open_interactive_pprof 工具的输入参数
-type OpenInteractivePprofArgs struct {
-	ProfileURI  string `json:"profile_uri" jsonschema:"要分析的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 或本地路径)"`
-	HTTPAddress string `json:"http_address,omitempty" jsonschema:"指定 pprof Web UI 的监听地址和端口 (例如 ':8081')，如果省略默认为 ':8081'"`
+// CompareProfilesBatchArgs 定义 compare_profiles_batch 工具的输入参数
+type CompareProfilesBatchArgs struct {
+	BaselineProfileURI   string   `json:"baseline_profile_uri" jsonschema:"基线 profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
+	TargetProfileURIs    []string `json:"target_profile_uris" jsonschema:"多个目标 profile 的 URI 数组 (例如一周内的每日构建，按时间顺序)，每个都与基线比较"`
+	Labels               []string `json:"labels,omitempty" jsonschema:"每个目标 profile 的标签数组 (可选)，长度必须与 target_profile_uris 相同"`
+	ProfileType          string   `json:"profile_type" jsonschema:"要比较的 pprof profile 的类型 (cpu, heap, allocs, mutex, block)"`
+	OutputFormat         string   `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	ExcludeLowConfidence bool     `json:"exclude_low_confidence,omitempty" jsonschema:"为 true 时，样本数过少的低置信度差异不计入提升/回归统计"`
+	Aggregation          string   `json:"aggregation,omitempty" jsonschema:"差异的聚合方式: leaf (默认)、cumulative 或 full_stack，含义与 compare_profiles 相同"`
+	ValueType            string   `json:"value_type,omitempty" jsonschema:"显式指定比较的样本类型 (例如 inuse_space、alloc_space)，含义与 compare_profiles 相同"`
+	CleanNames           bool     `json:"clean_names,omitempty" jsonschema:"为 true 时清理所有 profile 的函数名后再比较，规则同 compare_profiles 的 clean_names"`
+	StripModulePrefix    string   `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，含义与 compare_profiles 相同"`
+	NoCache              bool     `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
 }
 
-// handleOpenInteractivePprof 处理打开交互式 pprof 的请求。
-func handleOpenInteractivePprof(_ context.Context, _ *mcp.CallToolRequest, args OpenInteractivePprofArgs) (*mcp.CallToolResult, any, error) {
-	if args.ProfileURI == "" {
-		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+// handleCompareProfilesBatch 处理一个基线与多个目标 profile 的批量比较请求。
+func handleCompareProfilesBatch(ctx context.Context, _ *mcp.CallToolRequest, args CompareProfilesBatchArgs) (*mcp.CallToolResult, any, error) {
+	if args.BaselineProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: baseline_profile_uri")
+	}
+	if len(args.TargetProfileURIs) == 0 {
+		return nil, nil, fmt.Errorf("missing required argument: target_profile_uris")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+	switch args.Aggregation {
+	case "":
+		args.Aggregation = analyzer.AggregationLeaf
+	case analyzer.AggregationLeaf, analyzer.AggregationCumulative, analyzer.AggregationFullStack:
+	default:
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported aggregation: '%s' (expected leaf, cumulative or full_stack)", args.Aggregation))
 	}
 
-	httpAddress := args.HTTPAddress
-	if httpAddress == "" {
-		httpAddress = ":8081" // 默认端口
-		log.Printf("No http_address provided, using default: %s", httpAddress)
+	// 设置默认值
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+
+	// 如果没有提供标签，生成默认标签
+	labels := args.Labels
+	if len(labels) == 0 {
+		labels = make([]string, len(args.TargetProfileURIs))
+		for i := range args.TargetProfileURIs {
+			labels[i] = fmt.Sprintf("T%d", i+1)
+		}
+	} else if len(labels) != len(args.TargetProfileURIs) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("标签数量 (%d) 与 target 数量 (%d) 不匹配", len(labels), len(args.TargetProfileURIs)))
 	}
 
-	log.Printf("Handling open_interactive_pprof: URI=%s, Address=%s", args.ProfileURI, httpAddress)
+	logInfo("Handling compare_profiles_batch: Baseline=%s, targets=%d, Type=%s, Format=%s",
+		args.BaselineProfileURI, len(args.TargetProfileURIs), args.ProfileType, args.OutputFormat)
 
-	inputFilePath, cleanup, err := getProfileAsFile(args.ProfileURI)
+	// 获取基线 profile
+	baselineProf, err := loadProfile(ctx, args.BaselineProfileURI, args.NoCache)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get profile file: %w", err)
+		return nil, nil, fmt.Errorf("failed to load baseline profile: %w", err)
 	}
-	// 注意：不能在这里 defer cleanup()，因为 pprof 进程需要持续访问文件
-
-	cmdArgs := []string{"tool", "pprof"}
-	cmdArgs = append(cmdArgs, fmt.Sprintf("-http=%s", httpAddress))
-	cmdArgs = append(cmdArgs, inputFilePath)
+	baselineProf = cleanProfileNames(baselineProf, args.CleanNames, args.StripModulePrefix)
 
-	log.Printf("Preparing to execute command in background: go %s", strings.Join(cmdArgs, " "))
+	// 解析所有目标 profile
+	targets := make([]*profile.Profile, len(args.TargetProfileURIs))
+	for i, uri := range args.TargetProfileURIs {
+		prof, err := loadProfile(ctx, uri, args.NoCache)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load target profile #%d: %w", i+1, err)
+		}
+		targets[i] = cleanProfileNames(prof, args.CleanNames, args.StripModulePrefix)
+	}
 
-	_, err = exec.LookPath("go")
+	result, err := analyzer.CompareProfilesBatchContext(ctx, baselineProf, targets, labels, args.ProfileType, analyzer.CompareOptions{
+		Format:               args.OutputFormat,
+		ExcludeLowConfidence: args.ExcludeLowConfidence,
+		Aggregation:          args.Aggregation,
+		ValueType:            args.ValueType,
+	})
 	if err != nil {
-		log.Println("Error: 'go' command not found in PATH.")
-		cleanup()
-		return nil, nil, fmt.Errorf("'go' command not found in PATH, cannot start pprof")
+		return nil, nil, wrapAnalysisError("比较 profile", "failed to compare profiles", err)
 	}
 
-	cmd := exec.CommandContext(context.Background(), "go", cmdArgs...)
-	err = cmd.Start()
+	logDebug("Batch profile comparison completed successfully. Result length: %d", len(result))
+	return newTextResult(result, nil), nil, nil
+}
 
-	if err != nil {
-		log.Printf("Error starting 'go tool pprof' in background: %v", err)
-		cleanup()
-		return nil, nil, fmt.Errorf("failed to start 'go tool pprof': %w", err)
+// CompareProfilesMultiArgs 定义 compare_profiles_multi 工具的输入参数
+type CompareProfilesMultiArgs struct {
+	ProfileURIs                []string `json:"profile_uris" jsonschema:"要比较的 profile URI 数组，第一个是基线，其余是候选版本 (例如 baseline、candidate-1、candidate-2)，至少 2 个"`
+	Labels                     []string `json:"labels,omitempty" jsonschema:"每个 profile 的标签数组 (可选)，长度必须与 profile_uris 相同；默认为 baseline、C1、C2..."`
+	ProfileType                string   `json:"profile_type" jsonschema:"要比较的 pprof profile 的类型 (cpu, heap, allocs, mutex, block)"`
+	TopN                       float64  `json:"top_n,omitempty" jsonschema:"矩阵中列出的函数数量上限 (默认 20)，只在部分候选版本中回归的函数优先列出"`
+	OutputFormat               string   `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	ExcludeLowConfidence       bool     `json:"exclude_low_confidence,omitempty" jsonschema:"为 true 时，样本数过少的低置信度差异不判定为回归"`
+	Aggregation                string   `json:"aggregation,omitempty" jsonschema:"差异的聚合方式: leaf (默认)、cumulative 或 full_stack，含义与 compare_profiles 相同"`
+	ValueType                  string   `json:"value_type,omitempty" jsonschema:"显式指定比较的样本类型 (例如 inuse_space、alloc_space)，含义与 compare_profiles 相同"`
+	RegressionThresholdPercent float64  `json:"regression_threshold_percent,omitempty" jsonschema:"函数相对基线的增长超过该百分比时判定为回归 (默认 5)"`
+	CleanNames                 bool     `json:"clean_names,omitempty" jsonschema:"为 true 时清理所有 profile 的函数名后再比较，规则同 compare_profiles 的 clean_names"`
+	StripModulePrefix          string   `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，含义与 compare_profiles 相同"`
+	NoCache                    bool     `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
+}
+
+// handleCompareProfilesMulti 处理一个基线与多个候选 profile 的矩阵比较请求。
+func handleCompareProfilesMulti(ctx context.Context, _ *mcp.CallToolRequest, args CompareProfilesMultiArgs) (*mcp.CallToolResult, any, error) {
+	if len(args.ProfileURIs) == 0 {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uris")
+	}
+	if len(args.ProfileURIs) < 2 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("profile_uris 至少需要 2 个 profile (1 个基线和至少 1 个候选版本)，got %d", len(args.ProfileURIs)))
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+	switch args.Aggregation {
+	case "":
+		args.Aggregation = analyzer.AggregationLeaf
+	case analyzer.AggregationLeaf, analyzer.AggregationCumulative, analyzer.AggregationFullStack:
+	default:
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("unsupported aggregation: '%s' (expected leaf, cumulative or full_stack)", args.Aggregation))
+	}
+	if args.RegressionThresholdPercent < 0 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("regression_threshold_percent must not be negative, got %v", args.RegressionThresholdPercent))
 	}
 
-	pid := cmd.Process.Pid
-	pprofMutex.Lock()
-	runningPprofs[pid] = cmd.Process
-	pprofMutex.Unlock()
+	// 设置默认值
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
 
-	log.Printf("Successfully started 'go tool pprof' in background with PID: %d", pid)
+	// 如果没有提供标签，生成默认标签
+	labels := args.Labels
+	if len(labels) == 0 {
+		labels = make([]string, len(args.ProfileURIs))
+		labels[0] = "baseline"
+		for i := 1; i < len(args.ProfileURIs); i++ {
+			labels[i] = fmt.Sprintf("C%d", i)
+		}
+	} else if len(labels) != len(args.ProfileURIs) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("标签数量 (%d) 与 profile 数量 (%d) 不匹配", len(labels), len(args.ProfileURIs)))
+	}
 
-	resultText := fmt.Sprintf("已成功在后台启动 'go tool pprof' (PID: %d) 来分析 '%s'", pid, inputFilePath)
-	resultText += fmt.Sprintf("，监听地址约为 %s。", httpAddress)
-	resultText += "\n你可以使用 'disconnect_pprof_session' 工具并提供 PID 来尝试终止此进程。"
-	resultText += "\n注意：如果是远程 URL，下载的临时 pprof 文件在进程结束前不会被自动删除。"
+	logInfo("Handling compare_profiles_multi: profiles=%d, Type=%s, Format=%s", len(args.ProfileURIs), args.ProfileType, args.OutputFormat)
 
-	log.Println(resultText)
+	profiles := make([]*profile.Profile, len(args.ProfileURIs))
+	for i, uri := range args.ProfileURIs {
+		prof, err := loadProfile(ctx, uri, args.NoCache)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load profile #%d (%s): %w", i+1, labels[i], err)
+		}
+		profiles[i] = cleanProfileNames(prof, args.CleanNames, args.StripModulePrefix)
+	}
 
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				
-				Text: resultText,
-			},
-		},
-	}, nil, nil
+	result, err := analyzer.CompareProfilesMultiContext(ctx, profiles, labels, args.ProfileType, analyzer.CompareOptions{
+		TopN:                       int(args.TopN),
+		Format:                     args.OutputFormat,
+		ExcludeLowConfidence:       args.ExcludeLowConfidence,
+		Aggregation:                args.Aggregation,
+		ValueType:                  args.ValueType,
+		RegressionThresholdPercent: args.RegressionThresholdPercent,
+	})
+	if err != nil {
+		return nil, nil, wrapAnalysisError("比较 profile", "failed to compare profiles", err)
+	}
+
+	logDebug("Multi profile comparison completed successfully. Result length: %d", len(result))
+	return newTextResult(result, nil), nil, nil
 }
 
-// DisconnectPprofSessionArgs 定义 disconnect_pprof_session 工具的输入参数
-type DisconnectPprofSessionArgs struct {
-	PID         float64 `json:"pid" jsonschema:"要终止的后台 pprof 进程的 PID (由 'open_interactive_pprof' 返回)"`
-	HTTPAddress string  `json:"http_address,omitempty" jsonschema:"指定 pprof Web UI 的监听地址和端口 (例如 ':8081')，如果省略 pprof 会自动选择"`
+// AnalyzeFlatCumulativeArgs 定义 analyze_flat_cumulative 工具的输入参数
+type AnalyzeFlatCumulativeArgs struct {
+	ProfileURI        string  `json:"profile_uri" jsonschema:"要分析的 pprof 文件的 URI (支持 'file://', 'http://', 'https://' 协议)"`
+	ProfileType       string  `json:"profile_type" jsonschema:"profile 的类型 (cpu, heap, allocs, goroutine, mutex, block)"`
+	TopN              float64 `json:"top_n,omitempty" jsonschema:"按 cumulative 排序后返回的函数数量 (默认 20)"`
+	OutputFormat      string  `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	CleanNames        bool    `json:"clean_names,omitempty" jsonschema:"为 true 时清理函数名后再分析，规则同 analyze_pprof 的 clean_names：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]"`
+	StripModulePrefix string  `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，可以单独使用，也可以与 clean_names 一起使用"`
+	NoCache           bool    `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
 }
 
-// handleDisconnectPprofSession 处理断开 pprof 会话的请求。
-func handleDisconnectPprofSession(_ context.Context, _ *mcp.CallToolRequest, args DisconnectPprofSessionArgs) (*mcp.CallToolResult, any, error) {
-	if args.PID <= 0 {
-		return nil, nil, fmt.Errorf("invalid PID: %d", int(args.PID))
+// handleAnalyzeFlatCumulative 处理 flat/cumulative 对照视图的请求。
+func handleAnalyzeFlatCumulative(ctx context.Context, _ *mcp.CallToolRequest, args AnalyzeFlatCumulativeArgs) (*mcp.CallToolResult, any, error) {
+	if args.ProfileURI == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uri")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
 	}
 
-	pid := int(args.PID)
-	log.Printf("Handling disconnect_pprof_session for PID: %d", pid)
-
-	pprofMutex.Lock()
-	process, exists := runningPprofs[pid]
-	if !exists {
-		pprofMutex.Unlock()
-		log.Printf("PID %d not found in running pprof sessions.", pid)
-		return nil, nil, fmt.Errorf("未找到 PID 为 %d 的正在运行的 pprof 会话", pid)
+	// 设置默认值
+	topN := int(args.TopN)
+	if topN <= 0 {
+		topN = 20
+	}
+	if args.OutputFormat == "" {
+		args.OutputFormat = "markdown"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
 	}
-	delete(runningPprofs, pid)
-	pprofMutex.Unlock()
 
-	log.Printf("Attempting to terminate process with PID: %d", pid)
-	err := process.Signal(os.Interrupt)
+	logInfo("Handling analyze_flat_cumulative: URI=%s, Type=%s, TopN=%d, Format=%s", args.ProfileURI, args.ProfileType, topN, args.OutputFormat)
+
+	prof, err := loadProfile(ctx, args.ProfileURI, args.NoCache)
 	if err != nil {
-		log.Printf("Failed to send Interrupt signal to PID %d: %v. Trying Kill signal.", pid, err)
-		err = process.Signal(os.Kill)
-		if err != nil {
-			log.Printf("Failed to send Kill signal to PID %d: %v", pid, err)
-			return nil, nil, fmt.Errorf("尝试终止 PID %d 失败：%w", pid, err)
-		}
+		return nil, nil, fmt.Errorf("failed to load profile: %w", err)
 	}
+	prof = cleanProfileNames(prof, args.CleanNames, args.StripModulePrefix)
 
-	_, err = process.Wait()
-	if err != nil && !strings.Contains(err.Error(), "wait: no child processes") && !strings.Contains(err.Error(), "signal:") {
-		log.Printf("Warning: Error waiting for process PID %d after signaling: %v", pid, err)
+	result, err := analyzer.AnalyzeFlatCumulativeContext(ctx, prof, args.ProfileType, topN, args.OutputFormat)
+	if err != nil {
+		return nil, nil, wrapAnalysisError("分析 flat/cumulative", "failed to analyze flat vs cumulative", err)
 	}
 
-	resultText := fmt.Sprintf("已成功向 PID %d 发送终止信号。", pid)
-	log.Println(resultText)
+	var notes []string
+	if warning := analyzer.ValueColumnWarning(prof, args.ProfileType); warning != "" {
+		notes = append(notes, warning)
+	}
 
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				
-				Text: resultText,
-			},
-		},
-	}, nil, nil
+	logDebug("Flat vs cumulative analysis completed successfully. Result length: %d", len(result))
+	return newTextResult(result, notes), nil, nil
 }
 
-// CompareProfilesArgs 定义 compare_profiles 工具的输入参数
-type CompareProfilesArgs struct {
-	BaselineProfileURI string  `json:"baseline_profile_uri" jsonschema:"基线 profile 的 URI (旧版本)，支持 'file://', 'http://', 'https://' 协议"`
-	TargetProfileURI   string  `json:"target_profile_uri" jsonschema:"目标 profile 的 URI (新版本)，支持 'file://', 'http://', 'https://' 协议"`
-	ProfileType        string  `json:"profile_type" jsonschema:"要比较的 pprof profile 的类型 (cpu, heap, allocs, mutex, block)"`
-	TopN               float64 `json:"top_n,omitempty" jsonschema:"返回结果的数量上限"`
-	OutputFormat       string  `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+// AssertComparableArgs 定义 assert_comparable 工具的输入参数
+type AssertComparableArgs struct {
+	BaselineProfileURI string  `json:"baseline_profile_uri" jsonschema:"基线 profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
+	TargetProfileURI   string  `json:"target_profile_uri" jsonschema:"目标 profile 的 URI，支持 'file://', 'http://', 'https://' 协议"`
+	ProfileType        string  `json:"profile_type,omitempty" jsonschema:"要比较的 profile 类型 (cpu, heap, allocs, goroutine, mutex, block)。指定时只检查用于比较的那一列，否则要求两个 profile 的样本类型完全一致"`
+	MaxDurationRatio   float64 `json:"max_duration_ratio,omitempty" jsonschema:"两个 profile 采集时长 (较长/较短) 允许的最大比值 (默认 2)"`
+	RequireSameBuild   bool    `json:"require_same_build,omitempty" jsonschema:"为 true 时主程序 build ID 不同判定为不可比较，否则只给出警告"`
+	OutputFormat       string  `json:"output_format,omitempty" jsonschema:"输出格式 (json, text, markdown)，默认为 json 便于 CI 解析"`
+	NoCache            bool    `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
 }
 
-// handleCompareProfiles 处理 profile 比较的请求。
-func handleCompareProfiles(_ context.Context, _ *mcp.CallToolRequest, args CompareProfilesArgs) (*mcp.CallToolResult, any, error) {
+// handleAssertComparable 处理两个 profile 可比性检查的请求。
+func handleAssertComparable(ctx context.Context, _ *mcp.CallToolRequest, args AssertComparableArgs) (*mcp.CallToolResult, any, error) {
 	if args.BaselineProfileURI == "" {
 		return nil, nil, fmt.Errorf("missing required argument: baseline_profile_uri")
 	}
 	if args.TargetProfileURI == "" {
 		return nil, nil, fmt.Errorf("missing required argument: target_profile_uri")
 	}
-	if args.ProfileType == "" {
-		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	if args.MaxDurationRatio < 0 || (args.MaxDurationRatio > 0 && args.MaxDurationRatio < 1) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("max_duration_ratio must be >= 1, got %v", args.MaxDurationRatio))
 	}
 
 	// 设置默认值
-	if args.TopN <= 0 {
-		args.TopN = 10
-	}
 	if args.OutputFormat == "" {
-		args.OutputFormat = "markdown"
+		args.OutputFormat = "json"
+	}
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
 	}
 
-	topN := int(args.TopN)
-	log.Printf("Handling compare_profiles: Baseline=%s, Target=%s, Type=%s, TopN=%d, Format=%s",
-		args.BaselineProfileURI, args.TargetProfileURI, args.ProfileType, topN, args.OutputFormat)
+	logInfo("Handling assert_comparable: Baseline=%s, Target=%s, Type=%s, Format=%s",
+		args.BaselineProfileURI, args.TargetProfileURI, args.ProfileType, args.OutputFormat)
 
-	// 获取基线 profile
-	baselinePath, baselineCleanup, err := getProfileAsFile(args.BaselineProfileURI)
+	baselineProf, err := loadProfile(ctx, args.BaselineProfileURI, args.NoCache)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get baseline profile file: %w", err)
+		return nil, nil, fmt.Errorf("failed to load baseline profile: %w", err)
 	}
-	defer baselineCleanup()
 
-	baselineFile, err := os.Open(baselinePath)
+	targetProf, err := loadProfile(ctx, args.TargetProfileURI, args.NoCache)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open baseline profile file '%s': %w", baselinePath, err)
+		return nil, nil, fmt.Errorf("failed to load target profile: %w", err)
 	}
-	defer baselineFile.Close()
 
-	baselineProf, err := profile.Parse(baselineFile)
+	result, err := analyzer.AssertComparable(baselineProf, targetProf, analyzer.ComparabilityOptions{
+		ProfileType:      args.ProfileType,
+		MaxDurationRatio: args.MaxDurationRatio,
+		RequireSameBuild: args.RequireSameBuild,
+	}, args.OutputFormat)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse baseline profile file '%s': %w", baselinePath, err)
+		return nil, nil, fmt.Errorf("failed to check comparability: %w", err)
 	}
 
-	// 获取目标 profile
-	targetPath, targetCleanup, err := getProfileAsFile(args.TargetProfileURI)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get target profile file: %w", err)
+	logDebug("Comparability check completed successfully. Result length: %d", len(result))
+	return newTextResult(result, nil), nil, nil
+}
+
+// MergeProfilesArgs 定义 merge_profiles 工具的输入参数
+type MergeProfilesArgs struct {
+	ProfileURIs []string `json:"profile_uris" jsonschema:"要合并的同类型 profile 的 URI 数组 (至少 2 个，例如集群中每个实例的 CPU profile)，支持 'file://', 'http://', 'https://' 协议"`
+	OutputPath  string   `json:"output_path" jsonschema:"合并后的 pprof 文件的保存路径 (必须是绝对路径或相对于工作区的路径)"`
+}
+
+// handleMergeProfiles 处理将多个同类型 profile 合并为一个的请求。
+func handleMergeProfiles(ctx context.Context, _ *mcp.CallToolRequest, args MergeProfilesArgs) (*mcp.CallToolResult, any, error) {
+	if len(args.ProfileURIs) < 2 {
+		return nil, nil, fmt.Errorf("至少需要 2 个 profile 才能合并，当前只有 %d 个", len(args.ProfileURIs))
+	}
+	if args.OutputPath == "" {
+		return nil, nil, fmt.Errorf("missing required argument: output_path")
+	}
+
+	if !filepath.IsAbs(args.OutputPath) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			logError("无法获取当前工作目录: %v", err)
+		} else {
+			args.OutputPath = filepath.Join(cwd, args.OutputPath)
+		}
+	}
+
+	logInfo("Handling merge_profiles: profiles=%d, output=%s", len(args.ProfileURIs), args.OutputPath)
+
+	filePaths := make([]string, len(args.ProfileURIs))
+	for i, uri := range args.ProfileURIs {
+		filePath, cleanup, err := getProfileAsFile(ctx, uri)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get profile file #%d: %w", i+1, err)
+		}
+		defer cleanup()
+		filePaths[i] = filePath
 	}
-	defer targetCleanup()
 
-	targetFile, err := os.Open(targetPath)
+	profiles, err := parseProfilesConcurrently(ctx, filePaths)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open target profile file '%s': %w", targetPath, err)
+		return nil, nil, err
 	}
-	defer targetFile.Close()
 
-	targetProf, err := profile.Parse(targetFile)
+	merged, err := analyzer.MergeProfiles(profiles)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse target profile file '%s': %w", targetPath, err)
+		return nil, nil, NewInvalidArgumentError(err.Error())
 	}
 
-	// 执行比较
-	result, err := analyzer.CompareProfiles(baselineProf, targetProf, args.ProfileType, topN, args.OutputFormat)
+	outFile, err := os.Create(args.OutputPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to compare profiles: %w", err)
+		return nil, nil, fmt.Errorf("failed to create output file '%s': %w", args.OutputPath, err)
+	}
+	defer outFile.Close()
+	if err := merged.Write(outFile); err != nil {
+		return nil, nil, fmt.Errorf("failed to write merged profile '%s': %w", args.OutputPath, err)
 	}
 
-	log.Printf("Profile comparison completed successfully. Result length: %d", len(result))
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: result,
-			},
-		},
-	}, nil, nil
+	sampleTypes := make([]string, len(merged.SampleType))
+	for i, st := range merged.SampleType {
+		sampleTypes[i] = st.Type + "/" + st.Unit
+	}
+	resultText := fmt.Sprintf("已合并 %d 个 profile，结果已保存到: %s\n"+
+		"样本类型: %s\n"+
+		"合并后: %d 个样本 (相同调用栈的值已相加)，合计采集时长 %s\n"+
+		"可使用 analyze_pprof (profile_uri: %s) 查看合并后的整体视图。",
+		len(profiles), args.OutputPath, strings.Join(sampleTypes, ", "),
+		len(merged.Sample), time.Duration(merged.DurationNanos), args.OutputPath)
+
+	logInfo("Merged %d profiles into %s", len(profiles), args.OutputPath)
+	return newTextResult(resultText, nil), nil, nil
 }
 
-// AnalyzeHeapTimeSeriesArgs 定义 analyze_heap_time_series 工具的输入参数
-type AnalyzeHeapTimeSeriesArgs struct {
-	ProfileURIs []string `json:"profile_uris" jsonschema:"多个 heap profile 的 URI 数组（按时间顺序），支持 'file://', 'http://', 'https://' 协议"`
-	Labels      []string `json:"labels,omitempty" jsonschema:"每个时间点的标签数组（可选），长度必须与 profile_uris 相同"`
-	OutputFormat string   `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+// AnalyzeFleetArgs 定义 analyze_fleet 工具的输入参数
+type AnalyzeFleetArgs struct {
+	ProfileURIs       []string `json:"profile_uris" jsonschema:"各副本的 pprof 端点或文件的 URI 数组 (例如每个 pod 的 http://host:port/debug/pprof/profile?seconds=30)，支持 'file://', 'http://', 'https://', 'grpc://' 协议"`
+	Labels            []string `json:"labels,omitempty" jsonschema:"每个副本的标签数组 (可选，例如 pod 名称)，长度必须与 profile_uris 相同；默认使用 URI 中的主机名"`
+	ProfileType       string   `json:"profile_type" jsonschema:"profile 的类型 (cpu, heap, allocs, goroutine, mutex, block)"`
+	TopN              float64  `json:"top_n,omitempty" jsonschema:"合并视图中返回的函数数量 (默认 10)"`
+	OutputFormat      string   `json:"output_format,omitempty" jsonschema:"输出格式 (text, markdown, json)"`
+	MaxConcurrency    float64  `json:"max_concurrency,omitempty" jsonschema:"同时获取的副本数上限 (默认 4)，避免同时对大量副本发起实时采集"`
+	CleanNames        bool     `json:"clean_names,omitempty" jsonschema:"为 true 时清理每个副本 profile 的函数名后再合并分析，规则同 analyze_pprof 的 clean_names：去掉 .funcN/.funcN.M 等闭包后缀 (闭包合并到外层函数)，并将泛型类型参数折叠为 [...]"`
+	StripModulePrefix string   `json:"strip_module_prefix,omitempty" jsonschema:"可选，从函数名开头去掉的 module path (例如 'github.com/acme/svc')，可以单独使用，也可以与 clean_names 一起使用"`
+	NoCache           bool     `json:"no_cache,omitempty" jsonschema:"为 true 时不使用已解析 profile 的缓存，总是重新读取或下载 profile"`
 }
 
-// handleAnalyzeHeapTimeSeries 处理内存时序分析的请求。
-func handleAnalyzeHeapTimeSeries(_ context.Context, _ *mcp.CallToolRequest, args AnalyzeHeapTimeSeriesArgs) (*mcp.CallToolResult, any, error) {
-	if len(args.ProfileURIs) < 3 {
-		return nil, nil, fmt.Errorf("至少需要 3 个 profile 来进行时序分析，当前只有 %d 个", len(args.ProfileURIs))
+// handleAnalyzeFleet 处理并发获取多个副本的 profile、合并分析并找出离群副本的请求。
+func handleAnalyzeFleet(ctx context.Context, _ *mcp.CallToolRequest, args AnalyzeFleetArgs) (*mcp.CallToolResult, any, error) {
+	if len(args.ProfileURIs) == 0 {
+		return nil, nil, fmt.Errorf("missing required argument: profile_uris")
+	}
+	if args.ProfileType == "" {
+		return nil, nil, fmt.Errorf("missing required argument: profile_type")
+	}
+	if len(args.Labels) > 0 && len(args.Labels) != len(args.ProfileURIs) {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("标签数量 (%d) 与副本数量 (%d) 不匹配", len(args.Labels), len(args.ProfileURIs)))
+	}
+	if args.MaxConcurrency < 0 {
+		return nil, nil, NewInvalidArgumentError(fmt.Sprintf("max_concurrency must not be negative, got %v", args.MaxConcurrency))
 	}
 
 	// 设置默认值
+	if args.TopN <= 0 {
+		args.TopN = 10
+	}
 	if args.OutputFormat == "" {
 		args.OutputFormat = "markdown"
 	}
-
-	// 如果没有提供标签，生成默认标签
+	if err := validateFormat(args.OutputFormat, reportFormats); err != nil {
+		return nil, nil, err
+	}
+	if args.MaxConcurrency == 0 {
+		args.MaxConcurrency = defaultFetchConcurrency
+	}
 	labels := args.Labels
 	if len(labels) == 0 {
-		labels = make([]string, len(args.ProfileURIs))
-		for i := range args.ProfileURIs {
-			labels[i] = fmt.Sprintf("T%d", i+1)
+		labels = replicaLabels(args.ProfileURIs)
+	}
+
+	logInfo("Handling analyze_fleet: replicas=%d, Type=%s, TopN=%d, Format=%s, concurrency=%d",
+		len(args.ProfileURIs), args.ProfileType, int(args.TopN), args.OutputFormat, int(args.MaxConcurrency))
+
+	fetched := fetchProfilesConcurrently(ctx, args.ProfileURIs, int(args.MaxConcurrency), args.NoCache)
+	replicas := make([]analyzer.FleetReplica, len(fetched))
+	var firstErr error
+	failed := 0
+	for i, f := range fetched {
+		replicas[i] = analyzer.FleetReplica{Label: labels[i], Profile: f.Profile}
+		if f.Err == nil {
+			replicas[i].Profile = cleanProfileNames(f.Profile, args.CleanNames, args.StripModulePrefix)
+		} else {
+			logError("Failed to fetch replica %s (%s): %v", labels[i], args.ProfileURIs[i], f.Err)
+			replicas[i].Error = f.Err.Error()
+			failed++
+			if firstErr == nil {
+				firstErr = f.Err
+			}
 		}
-	} else if len(labels) != len(args.ProfileURIs) {
-		return nil, nil, fmt.Errorf("标签数量 (%d) 与 profile 数量 (%d) 不匹配", len(labels), len(args.ProfileURIs))
+	}
+	if failed == len(fetched) {
+		return nil, nil, fmt.Errorf("failed to fetch all %d replica profiles, first error: %w", failed, firstErr)
 	}
 
-	log.Printf("Handling analyze_heap_time_series: profiles=%d, format=%s", len(args.ProfileURIs), args.OutputFormat)
+	result, err := analyzer.AnalyzeFleetContext(ctx, replicas, args.ProfileType, int(args.TopN), args.OutputFormat)
+	if err != nil {
+		return nil, nil, wrapAnalysisError("分析集群 profile", "failed to analyze fleet", err)
+	}
 
-	// 解析所有 profile
-	profiles := make([]*profile.Profile, len(args.ProfileURIs))
-	for i, uri := range args.ProfileURIs {
-		filePath, cleanup, err := getProfileAsFile(uri)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to get profile file #%d: %w", i+1, err)
-		}
-		defer cleanup()
+	var notes []string
+	if failed > 0 {
+		notes = append(notes, fmt.Sprintf("%d/%d 个副本获取失败，结果只包含成功获取的副本", failed, len(fetched)))
+	}
 
-		file, err := os.Open(filePath)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to open profile file #%d '%s': %w", i+1, filePath, err)
-		}
-		defer file.Close()
+	logDebug("Fleet analysis completed successfully. Result length: %d", len(result))
+	return newTextResult(result, notes), nil, nil
+}
 
-		prof, err := profile.Parse(file)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse profile file #%d '%s': %w", i+1, filePath, err)
+// replicaLabels 为每个副本生成默认标签：URI 中的主机名 (本地文件使用文件名)，重复时加上序号
+func replicaLabels(uris []string) []string {
+	labels := make([]string, len(uris))
+	counts := make(map[string]int)
+	for i, uri := range uris {
+		if parsed, err := url.Parse(uri); err == nil && parsed.Host != "" {
+			labels[i] = parsed.Host
+		} else {
+			labels[i] = profileNameFromURI(uri)
 		}
-
-		profiles[i] = prof
-		log.Printf("Successfully parsed profile #%d: %d samples", i+1, len(prof.Sample))
+		counts[labels[i]]++
 	}
-
-	// 执行时序分析
-	result, err := analyzer.AnalyzeHeapTimeSeries(profiles, labels, args.OutputFormat)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to analyze time series: %w", err)
+	for i, label := range labels {
+		if counts[label] > 1 {
+			labels[i] = fmt.Sprintf("%s #%d", label, i+1)
+		}
 	}
+	return labels
+}
 
-	log.Printf("Heap time series analysis completed successfully. Result length: %d", len(result))
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: result,
-			},
+// newTextResult 构造工具的文本返回值。
+// 附注 (notes) 单独放在结果之后的内容块中，避免破坏 JSON 等结构化输出。
+func newTextResult(text string, notes []string) *mcp.CallToolResult {
+	content := []mcp.Content{
+		&mcp.TextContent{
+			Text: text,
 		},
-	}, nil, nil
+	}
+	if len(notes) > 0 {
+		content = append(content, &mcp.TextContent{
+			Text: "注意:\n- " + strings.Join(notes, "\n- "),
+		})
+	}
+	return &mcp.CallToolResult{Content: content}
+}
+
+// 各工具支持的 output_format
+var (
+	analyzeFormats = []string{"text", "markdown", "json", "flamegraph-json", "compact", "openmetrics", "summary"}
+	compareFormats = []string{"text", "markdown", "json", "benchstat"}
+	reportFormats  = []string{"text", "markdown", "json"}
+)
+
+// validateFormat 检查 output_format 是否属于 allowed，否则返回列出可用格式的 INVALID_ARGUMENT 错误，
+// 避免拼写错误的格式在加载 profile 之后才失败，或者被某些分析器当作 text 处理
+func validateFormat(format string, allowed []string) error {
+	for _, f := range allowed {
+		if format == f {
+			return nil
+		}
+	}
+	return NewInvalidArgumentError(fmt.Sprintf("unsupported output_format: '%s' (expected one of: %s)", format, strings.Join(allowed, ", ")))
 }
 
 // getMimeTypeForFormat 根据输出格式返回对应的 MIME 类型
@@ -589,6 +2826,8 @@ func getMimeTypeForFormat(format string) string {
 		return "text/markdown"
 	case "json", "flamegraph-json":
 		return "application/json"
+	case "openmetrics":
+		return "application/openmetrics-text; version=1.0.0; charset=utf-8"
 	default:
 		return "text/plain"
 	}
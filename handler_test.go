@@ -0,0 +1,765 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/ZephyrDeng/pprof-analyzer-mcp/analyzer"
+)
+
+// TestValidateOutputFormat 测试不支持的 output_format 在加载 profile 之前就返回 INVALID_ARGUMENT 错误
+func TestValidateOutputFormat(t *testing.T) {
+	// profile 文件不存在：如果格式校验发生在加载之后，会得到加载失败而不是参数错误
+	missing := "/nonexistent/cpu.pprof"
+	var appErr *AppError
+
+	_, _, err := handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{missing}, ProfileType: "cpu", OutputFormat: "yaml"})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument || !containsAll(err.Error(), "yaml", "flamegraph-json", "openmetrics") {
+		t.Errorf("handleAnalyzePprof(yaml) error = %v, want %s listing allowed formats", err, ErrCodeInvalidArgument)
+	}
+	_, _, err = handleCompareProfiles(context.Background(), nil, CompareProfilesArgs{BaselineProfileURI: missing, TargetProfileURI: missing, ProfileType: "cpu", OutputFormat: "compact"})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument || !containsAll(err.Error(), "benchstat") {
+		t.Errorf("handleCompareProfiles(compact) error = %v, want %s", err, ErrCodeInvalidArgument)
+	}
+	_, _, err = handleDescribeProfile(context.Background(), nil, DescribeProfileArgs{ProfileURI: missing, OutputFormat: "flamegraph-json"})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument {
+		t.Errorf("handleDescribeProfile(flamegraph-json) error = %v, want %s", err, ErrCodeInvalidArgument)
+	}
+
+	for _, format := range analyzeFormats {
+		if err := validateFormat(format, analyzeFormats); err != nil {
+			t.Errorf("validateFormat(%s) error = %v", format, err)
+		}
+	}
+}
+
+func containsAll(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestAnalyzePprofMultipleURIs 测试 profile_uri 为数组时合并同类型 profile 后分析，指定的类型与内容不一致时报错
+func TestAnalyzePprofMultipleURIs(t *testing.T) {
+	dir := t.TempDir()
+	writeProfile := func(name string, sampleType *profile.ValueType, values map[string]int64) string {
+		p := &profile.Profile{SampleType: []*profile.ValueType{sampleType}, PeriodType: sampleType, Period: 1, DurationNanos: int64(time.Second)}
+		id := uint64(1)
+		for fnName, v := range values {
+			fn := &profile.Function{ID: id, Name: fnName}
+			loc := &profile.Location{ID: id, Line: []profile.Line{{Function: fn}}}
+			p.Function = append(p.Function, fn)
+			p.Location = append(p.Location, loc)
+			p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{v}})
+			id++
+		}
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := p.Write(f); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	a := writeProfile("a.pprof", cpuType, map[string]int64{"main.work": 100, "main.parse": 300})
+	b := writeProfile("b.pprof", cpuType, map[string]int64{"main.work": 400})
+	heap := writeProfile("heap.pprof", &profile.ValueType{Type: "inuse_space", Unit: "bytes"}, map[string]int64{"main.alloc": 100})
+
+	var uris profileURIs
+	if err := json.Unmarshal([]byte(`"`+a+`"`), &uris); err != nil || len(uris) != 1 {
+		t.Fatalf("Unmarshal(string) = %v, %v", uris, err)
+	}
+	if err := json.Unmarshal([]byte(`["`+a+`", "`+b+`"]`), &uris); err != nil || len(uris) != 2 {
+		t.Fatalf("Unmarshal(array) = %v, %v", uris, err)
+	}
+
+	result, _, err := handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: uris, ProfileType: "cpu", OutputFormat: "json", NoCache: true})
+	if err != nil {
+		t.Fatalf("handleAnalyzePprof(merged) error = %v", err)
+	}
+	var stats analyzer.CPUAnalysisResult
+	if err := json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &stats); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if stats.TotalValue != 800 || stats.Functions[0].FunctionName != "main.work" || stats.Functions[0].FlatValue != 500 {
+		t.Errorf("Unexpected merged result: %+v", stats)
+	}
+	if len(result.Content) < 2 || !strings.Contains(result.Content[1].(*mcp.TextContent).Text, "已合并 2 个 profile") {
+		t.Errorf("Expected a note reporting the merged count, got %+v", result.Content)
+	}
+
+	var appErr *AppError
+	_, _, err = handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{a, heap}, ProfileType: "cpu", OutputFormat: "json", NoCache: true})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument || !strings.Contains(err.Error(), "heap") {
+		t.Errorf("handleAnalyzePprof(cpu + heap) error = %v, want %s naming the types", err, ErrCodeInvalidArgument)
+	}
+}
+
+// TestAnalyzePprofCombinedReport 测试 profile_type=auto 下不同类型的 profile_uri 生成每种类型一个分区的合并报告，
+// 每个分区的 Top N 取 top_n_by_type 中该类型的值，未指定的类型使用 top_n
+func TestAnalyzePprofCombinedReport(t *testing.T) {
+	writeProfile := func(sampleTypes []*profile.ValueType, values map[string]int64) string {
+		p := &profile.Profile{SampleType: sampleTypes, PeriodType: sampleTypes[len(sampleTypes)-1], Period: 1}
+		id := uint64(1)
+		for fnName, v := range values {
+			fn := &profile.Function{ID: id, Name: fnName}
+			loc := &profile.Location{ID: id, Line: []profile.Line{{Function: fn}}}
+			p.Function = append(p.Function, fn)
+			p.Location = append(p.Location, loc)
+			sample := &profile.Sample{Location: []*profile.Location{loc}}
+			for range sampleTypes {
+				sample.Value = append(sample.Value, v)
+			}
+			p.Sample = append(p.Sample, sample)
+			id++
+		}
+		return writeTestProfile(t, p)
+	}
+	cpuTypes := []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}}
+	mutexTypes := []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}
+	cpuA := writeProfile(cpuTypes, map[string]int64{"main.work": 300, "main.parse": 200, "main.encode": 100})
+	mutex := writeProfile(mutexTypes, map[string]int64{"main.lockA": 30, "main.lockB": 20, "main.lockC": 10})
+	cpuB := writeProfile(cpuTypes, map[string]int64{"main.work": 100})
+
+	args := AnalyzePprofArgs{
+		ProfileURI:   profileURIs{cpuA, mutex, cpuB},
+		ProfileType:  "auto",
+		TopN:         1,
+		TopNByType:   map[string]float64{"cpu": 2},
+		OutputFormat: "json",
+		NoCache:      true,
+	}
+	result, _, err := handleAnalyzePprof(context.Background(), nil, args)
+	if err != nil {
+		t.Fatalf("handleAnalyzePprof(combined) error = %v", err)
+	}
+	var combined combinedReport
+	if err := json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &combined); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(combined.Sections) != 2 {
+		t.Fatalf("Expected cpu and mutex sections, got %+v", combined.Sections)
+	}
+	cpuSection, mutexSection := combined.Sections[0], combined.Sections[1]
+	if cpuSection.ProfileType != "cpu" || !slices.Equal(cpuSection.ProfileURI, []string{cpuA, cpuB}) || cpuSection.TopN != 2 {
+		t.Errorf("Unexpected cpu section: %+v", cpuSection)
+	}
+	var cpuStats analyzer.CPUAnalysisResult
+	if err := json.Unmarshal(cpuSection.Report, &cpuStats); err != nil {
+		t.Fatalf("Invalid cpu section report: %v", err)
+	}
+	// 两个 cpu profile 合并后 main.work 为 400
+	if len(cpuStats.Functions) != 2 || cpuStats.Functions[0].FunctionName != "main.work" || cpuStats.Functions[0].FlatValue != 400 {
+		t.Errorf("Expected the merged top 2 cpu functions, got %+v", cpuStats.Functions)
+	}
+	var mutexStats analyzer.MutexAnalysisResult
+	if err := json.Unmarshal(mutexSection.Report, &mutexStats); err != nil {
+		t.Fatalf("Invalid mutex section report: %v", err)
+	}
+	if mutexSection.ProfileType != "mutex" || mutexSection.TopN != 1 || mutexStats.TopN != 1 || mutexStats.Contentions[0].FunctionName != "main.lockA" {
+		t.Errorf("Expected the mutex section to fall back to top_n=1, got %+v", mutexSection)
+	}
+	if len(result.Content) < 2 || !containsAll(result.Content[1].(*mcp.TextContent).Text, "[cpu] 已合并 2 个 profile") {
+		t.Errorf("Expected section notes prefixed with their type, got %+v", result.Content)
+	}
+
+	args.OutputFormat = ""
+	result, _, err = handleAnalyzePprof(context.Background(), nil, args)
+	if err != nil {
+		t.Fatalf("handleAnalyzePprof(combined, markdown) error = %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !containsAll(text, "## cpu (2 个 profile, Top 2)", "## mutex (1 个 profile, Top 1)") {
+		t.Errorf("Expected one markdown section per type:\n%s", text)
+	}
+
+	var appErr *AppError
+	for name, bad := range map[string]AnalyzePprofArgs{
+		"flamegraph-json":  {ProfileURI: args.ProfileURI, ProfileType: "auto", OutputFormat: "flamegraph-json", NoCache: true},
+		"unknown section":  {ProfileURI: args.ProfileURI, ProfileType: "auto", TopNByType: map[string]float64{"gpu": 3}, NoCache: true},
+		"fractional top n": {ProfileURI: profileURIs{cpuA}, ProfileType: "cpu", TopNByType: map[string]float64{"cpu": 2.5}, NoCache: true},
+	} {
+		if _, _, err := handleAnalyzePprof(context.Background(), nil, bad); !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument {
+			t.Errorf("%s: error = %v, want %s", name, err, ErrCodeInvalidArgument)
+		}
+	}
+
+	// 单一类型时 top_n_by_type 中对应的值覆盖 top_n
+	result, _, err = handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{cpuA}, ProfileType: "cpu", TopN: 1, TopNByType: map[string]float64{"cpu": 3, "mutex": 1}, OutputFormat: "json", NoCache: true})
+	if err != nil {
+		t.Fatalf("handleAnalyzePprof(cpu, top_n_by_type) error = %v", err)
+	}
+	if err := json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &cpuStats); err != nil || len(cpuStats.Functions) != 3 {
+		t.Errorf("Expected top_n_by_type.cpu=3 to override top_n, got %+v (%v)", cpuStats.Functions, err)
+	}
+}
+
+// TestAnalyzePprofGroupByLabel 测试 group_by_label 按标签值 (包括数值标签) 汇总 CPU profile，并拒绝不支持的 profile 类型
+func TestAnalyzePprofGroupByLabel(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handle"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	p := &profile.Profile{SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1, Function: []*profile.Function{fn}, Location: []*profile.Location{loc}}
+	for _, s := range []struct {
+		endpoint string
+		tenant   int64
+		value    int64
+	}{{"/api/search", 7, 600}, {"/api/search", 8, 200}, {"/health", 7, 100}, {"", 0, 100}} {
+		sample := &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{s.value}}
+		if s.endpoint != "" {
+			sample.Label = map[string][]string{"endpoint": {s.endpoint}}
+			sample.NumLabel = map[string][]int64{"tenant": {s.tenant}}
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	result, _, err := handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{path}, ProfileType: "cpu", GroupByLabel: "endpoint", OutputFormat: "json", NoCache: true})
+	if err != nil {
+		t.Fatalf("handleAnalyzePprof(group_by_label) error = %v", err)
+	}
+	var pivot analyzer.LabelPivotResult
+	if err := json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &pivot); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(pivot.Rows) != 3 || pivot.Rows[0] != "/api/search" || pivot.RowTotals[0] != 800 || pivot.Unlabeled != 100 {
+		t.Errorf("Unexpected endpoint breakdown: %+v", pivot)
+	}
+
+	// 数值标签，默认输出 markdown
+	result, _, err = handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{path}, ProfileType: "cpu", GroupByLabel: "tenant", NoCache: true})
+	if err != nil {
+		t.Fatalf("handleAnalyzePprof(numeric label) error = %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !containsAll(text, "# 标签分组分析 (cpu, tenant)", "| 7 | 700ns (70.0%) |") {
+		t.Errorf("Unexpected tenant breakdown:\n%s", text)
+	}
+
+	var appErr *AppError
+	_, _, err = handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{path}, ProfileType: "mutex", GroupByLabel: "endpoint"})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument {
+		t.Errorf("handleAnalyzePprof(mutex, group_by_label) error = %v, want %s", err, ErrCodeInvalidArgument)
+	}
+}
+
+// TestAnalyzeLabelsRedactLabels 测试 analyze_labels 的透视表中不出现 redact_labels 指定的标签的原始值
+func TestAnalyzeLabelsRedactLabels(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handle"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	p := &profile.Profile{SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1, Function: []*profile.Function{fn}, Location: []*profile.Location{loc}}
+	for _, user := range []string{"alice@example.com", "bob@example.com", "alice@example.com"} {
+		p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{100}, Label: map[string][]string{"user": {user}, "endpoint": {"/api"}}})
+	}
+	path := writeTestProfile(t, p)
+
+	result, _, err := handleAnalyzeLabels(context.Background(), nil, AnalyzeLabelsArgs{ProfileURI: path, ProfileType: "cpu", LabelKeys: []string{"user", "endpoint"}, RedactLabels: []string{"user"}, NoCache: true})
+	if err != nil {
+		t.Fatalf("handleAnalyzeLabels(redact_labels) error = %v", err)
+	}
+	text := result.Content[0].(*mcp.TextContent).Text
+	if strings.Contains(text, "@example.com") || !containsAll(text, "<redacted:", "/api") {
+		t.Errorf("Expected user values to be redacted:\n%s", text)
+	}
+}
+
+// TestAnalyzePprofTagFocusRedactLabels 测试 tagfocus 按标签的原始值过滤，之后再对 redact_labels 指定的标签脱敏
+func TestAnalyzePprofTagFocusRedactLabels(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handle"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	p := &profile.Profile{SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1, Function: []*profile.Function{fn}, Location: []*profile.Location{loc}}
+	for _, user := range []string{"alice", "bob", "alice"} {
+		p.Sample = append(p.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{100}, Label: map[string][]string{"user": {user}}})
+	}
+	path := writeTestProfile(t, p)
+
+	result, _, err := handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{path}, ProfileType: "cpu", GroupByLabel: "user",
+		TagFocus: "user=^alice$", RedactLabels: []string{"user"}, OutputFormat: "json", NoCache: true})
+	if err != nil {
+		t.Fatalf("handleAnalyzePprof(tagfocus + redact_labels) error = %v", err)
+	}
+	var pivot analyzer.LabelPivotResult
+	if err := json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &pivot); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(pivot.Rows) != 1 || !strings.HasPrefix(pivot.Rows[0], "<redacted:") || pivot.RowTotals[0] != 200 {
+		t.Errorf("Expected only the redacted alice row with 200ns, got %+v", pivot)
+	}
+}
+
+// writeTestProfile 将 p 写入临时目录中的 profile 文件并返回其路径
+func writeTestProfile(t *testing.T, p *profile.Profile) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.pprof")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestAnalyzeCanceledReturnsCanceledError 测试请求被取消时分析类工具返回 CANCELED 错误，而不是包装后的普通错误
+func TestAnalyzeCanceledReturnsCanceledError(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	p := &profile.Profile{SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1, Function: []*profile.Function{fn}, Location: []*profile.Location{loc},
+		Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{100}}}}
+	path := writeTestProfile(t, p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var appErr *AppError
+	_, _, err := handleAnalyzePprof(ctx, nil, AnalyzePprofArgs{ProfileURI: profileURIs{path}, ProfileType: "cpu", NoCache: true})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeCanceled || !errors.Is(err, context.Canceled) {
+		t.Errorf("handleAnalyzePprof(canceled) error = %v, want %s", err, ErrCodeCanceled)
+	}
+	_, _, err = handleCompareProfiles(ctx, nil, CompareProfilesArgs{BaselineProfileURI: path, TargetProfileURI: path, ProfileType: "cpu", NoCache: true})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeCanceled {
+		t.Errorf("handleCompareProfiles(canceled) error = %v, want %s", err, ErrCodeCanceled)
+	}
+}
+
+// TestAnalyzePprofAutoProfileType 测试 profile_type=auto 根据样本类型选择分析器并在附注中报告推断出的类型
+func TestAnalyzePprofAutoProfileType(t *testing.T) {
+	dir := t.TempDir()
+	writeProfile := func(name string, sampleTypes ...*profile.ValueType) string {
+		fn := &profile.Function{ID: 1, Name: "main.work"}
+		loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+		p := &profile.Profile{SampleType: sampleTypes, Function: []*profile.Function{fn}, Location: []*profile.Location{loc}}
+		values := make([]int64, len(sampleTypes))
+		for i := range values {
+			values[i] = 1024
+		}
+		p.Sample = []*profile.Sample{{Location: []*profile.Location{loc}, Value: values}}
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := p.Write(f); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	heap := writeProfile("profile.pprof", &profile.ValueType{Type: "inuse_objects", Unit: "count"}, &profile.ValueType{Type: "inuse_space", Unit: "bytes"})
+	contentionTypes := []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}}
+	block := writeProfile("block.pprof", contentionTypes...)
+	mutex := writeProfile("contention.pprof", contentionTypes...)
+	unknown := writeProfile("custom.pprof", &profile.ValueType{Type: "widgets", Unit: "count"})
+
+	result, _, err := handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{heap}, ProfileType: "auto", OutputFormat: "json", NoCache: true})
+	if err != nil {
+		t.Fatalf("handleAnalyzePprof(auto, heap) error = %v", err)
+	}
+	var stats analyzer.HeapAnalysisResult
+	if err := json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &stats); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if stats.ValueType != "inuse_space" || stats.TotalValue != 1024 {
+		t.Errorf("Unexpected heap result: %+v", stats)
+	}
+	if len(result.Content) < 2 || !containsAll(result.Content[1].(*mcp.TextContent).Text, "profile_type=auto", "inuse_space/bytes", "heap profile") {
+		t.Errorf("Expected a note reporting the inferred type, got %+v", result.Content)
+	}
+
+	// mutex 与 block 的样本类型相同，按文件名区分
+	for path, want := range map[string]string{block: "block profile", mutex: "profile_type=block"} {
+		result, _, err = handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{path}, ProfileType: "auto", OutputFormat: "text", NoCache: true})
+		if err != nil {
+			t.Fatalf("handleAnalyzePprof(auto, %s) error = %v", path, err)
+		}
+		if len(result.Content) < 2 || !strings.Contains(result.Content[1].(*mcp.TextContent).Text, want) {
+			t.Errorf("handleAnalyzePprof(auto, %s): expected a note containing %q, got %+v", path, want, result.Content)
+		}
+	}
+
+	var appErr *AppError
+	_, _, err = handleAnalyzePprof(context.Background(), nil, AnalyzePprofArgs{ProfileURI: profileURIs{unknown}, ProfileType: "auto", NoCache: true})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument || !strings.Contains(err.Error(), "widgets/count") {
+		t.Errorf("handleAnalyzePprof(auto, unknown) error = %v, want %s naming the sample types", err, ErrCodeInvalidArgument)
+	}
+}
+
+// TestGenerateFlamegraphImageContent 测试火焰图以资源链接和 image/svg+xml 图片返回，超过 max_inline_bytes 时只返回路径
+func TestGenerateFlamegraphImageContent(t *testing.T) {
+	dir := t.TempDir()
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	p := &profile.Profile{SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1, Function: []*profile.Function{fn}, Location: []*profile.Location{loc},
+		Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{100}}}}
+	profilePath := filepath.Join(dir, "cpu.pprof")
+	f, err := os.Create(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	svgPath := filepath.Join(dir, "cpu.svg")
+
+	result, _, err := handleGenerateFlamegraph(context.Background(), nil, GenerateFlamegraphArgs{ProfileURI: profilePath, ProfileType: "cpu", OutputSVGPath: svgPath, Engine: "builtin"})
+	if err != nil {
+		t.Fatalf("handleGenerateFlamegraph() error = %v", err)
+	}
+	if len(result.Content) != 3 {
+		t.Fatalf("Expected path, resource link and image content, got %+v", result.Content)
+	}
+	link, ok := result.Content[1].(*mcp.ResourceLink)
+	if !ok || link.URI != "file://"+filepath.ToSlash(svgPath) || link.MIMEType != "image/svg+xml" || link.Size == nil {
+		t.Errorf("Unexpected resource link: %+v", result.Content[1])
+	}
+	image, ok := result.Content[2].(*mcp.ImageContent)
+	if !ok || image.MIMEType != "image/svg+xml" || !strings.Contains(string(image.Data), "<svg") {
+		t.Errorf("Unexpected image content: %+v", result.Content[2])
+	}
+
+	result, _, err = handleGenerateFlamegraph(context.Background(), nil, GenerateFlamegraphArgs{ProfileURI: profilePath, ProfileType: "cpu", OutputSVGPath: svgPath, Engine: "builtin", MaxInlineBytes: 16})
+	if err != nil {
+		t.Fatalf("handleGenerateFlamegraph(max_inline_bytes) error = %v", err)
+	}
+	if len(result.Content) != 2 || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "超过内联上限") {
+		t.Errorf("Expected only the path and resource link above max_inline_bytes, got %+v", result.Content)
+	}
+
+	// 相对的 output_svg_path 按工作目录解析为绝对路径后再生成资源链接
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	result, _, err = handleGenerateFlamegraph(context.Background(), nil, GenerateFlamegraphArgs{ProfileURI: profilePath, ProfileType: "cpu", OutputSVGPath: "relative.svg", Engine: "builtin"})
+	if err != nil {
+		t.Fatalf("handleGenerateFlamegraph(relative path) error = %v", err)
+	}
+	absPath, err := filepath.Abs("relative.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link, ok := result.Content[1].(*mcp.ResourceLink); !ok || link.URI != fileURI(absPath) || !strings.HasPrefix(link.URI, "file:///") {
+		t.Errorf("Expected a resource link to %s, got %+v", absPath, result.Content[1])
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, absPath) {
+		t.Errorf("Expected the absolute path in the result text:\n%s", text)
+	}
+}
+
+// TestGenerateDiffFlamegraphTypeMismatch 测试 baseline 与 target 类型不一致时在调用 go tool pprof 之前返回 INVALID_ARGUMENT 错误
+func TestGenerateDiffFlamegraphTypeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeProfile := func(name string, sampleType *profile.ValueType) string {
+		fn := &profile.Function{ID: 1, Name: "main.work"}
+		loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+		p := &profile.Profile{SampleType: []*profile.ValueType{sampleType}, Function: []*profile.Function{fn}, Location: []*profile.Location{loc},
+			Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{100}}}}
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := p.Write(f); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	cpu := writeProfile("cpu.pprof", &profile.ValueType{Type: "cpu", Unit: "nanoseconds"})
+	heap := writeProfile("heap.pprof", &profile.ValueType{Type: "inuse_space", Unit: "bytes"})
+
+	var appErr *AppError
+	_, _, err := handleGenerateDiffFlamegraph(context.Background(), nil, GenerateDiffFlamegraphArgs{
+		BaselineProfileURI: cpu, TargetProfileURI: heap, ProfileType: "cpu", OutputSVGPath: filepath.Join(dir, "diff.svg"),
+	})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument || !containsAll(err.Error(), "baseline: cpu", "target: heap") {
+		t.Errorf("handleGenerateDiffFlamegraph(cpu vs heap) error = %v, want %s naming both types", err, ErrCodeInvalidArgument)
+	}
+	_, _, err = handleGenerateDiffFlamegraph(context.Background(), nil, GenerateDiffFlamegraphArgs{
+		BaselineProfileURI: cpu, TargetProfileURI: cpu, ProfileType: "heap_growth", OutputSVGPath: filepath.Join(dir, "diff.svg"),
+	})
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument {
+		t.Errorf("handleGenerateDiffFlamegraph(heap_growth) error = %v, want %s", err, ErrCodeInvalidArgument)
+	}
+}
+
+// TestRunPprofCommand 测试子进程超时返回 TIMEOUT 错误 (而不是普通的执行失败)，并且只保留输出的前 maxPprofOutputBytes 字节
+func TestRunPprofCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found in PATH")
+	}
+	ctx := context.Background()
+	var appErr *AppError
+	start := time.Now()
+	_, err := runPprofCommand(ctx, "生成火焰图", 100*time.Millisecond, maxPprofOutputBytes, "sh", "-c", "sleep 10")
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeTimeout || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("runPprofCommand(sleep) error = %v, want %s", err, ErrCodeTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > pprofWaitDelay {
+		t.Errorf("runPprofCommand(sleep) took %s, want the subprocess to be killed at the timeout", elapsed)
+	}
+
+	output, err := runPprofCommand(ctx, "生成火焰图", time.Minute, maxPprofOutputBytes, "sh", "-c", "head -c 200000 /dev/zero | tr '\\0' x")
+	if err != nil {
+		t.Fatalf("runPprofCommand(large output) error = %v", err)
+	}
+	if !strings.HasPrefix(output, strings.Repeat("x", maxPprofOutputBytes)+"\n...") || !strings.Contains(output, "134464 more bytes of output truncated") {
+		t.Errorf("runPprofCommand(large output) kept %d bytes, want the first %d and a truncation note", len(output), maxPprofOutputBytes)
+	}
+
+	output, err = runPprofCommand(ctx, "生成火焰图", time.Minute, maxPprofOutputBytes, "sh", "-c", "echo broken profile >&2; exit 3")
+	if err == nil || errors.As(err, &appErr) || !strings.Contains(output, "broken profile") {
+		t.Errorf("runPprofCommand(exit 3) = %q, %v, want the plain exit error and its output", output, err)
+	}
+
+	stdout, stderr, err := runPprofCommandSeparate(ctx, "生成调用图", time.Minute, maxCallgraphOutputBytes, "sh", "-c", "echo graph; echo 'Main binary filename not available.' >&2; echo more graph")
+	if err != nil || stdout != "graph\nmore graph\n" || stderr != "Main binary filename not available.\n" {
+		t.Errorf("runPprofCommandSeparate() = %q, %q, %v, want stdout and stderr kept apart", stdout, stderr, err)
+	}
+	if notes := pprofStderrNotes(stderr + "\n  \n"); !slices.Equal(notes, []string{"go tool pprof: Main binary filename not available."}) {
+		t.Errorf("pprofStderrNotes() = %q, want one note per non-empty stderr line", notes)
+	}
+
+	if _, _, err := handleGenerateFlamegraph(ctx, nil, GenerateFlamegraphArgs{ProfileURI: "cpu.pprof", ProfileType: "cpu", OutputSVGPath: "cpu.svg", TimeoutSeconds: -1}); !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument {
+		t.Errorf("handleGenerateFlamegraph(timeout_seconds: -1) error = %v, want %s", err, ErrCodeInvalidArgument)
+	}
+}
+
+// TestGenerateCallgraph 测试 generate_callgraph 返回 go tool pprof 的文本输出，focus 只保留匹配的调用栈，pprof 的警告放在提示信息中，
+// 无效的正则表达式在运行 pprof 之前被拒绝
+func TestGenerateCallgraph(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found in PATH")
+	}
+	work := &profile.Function{ID: 1, Name: "main.work"}
+	idle := &profile.Function{ID: 2, Name: "main.idle"}
+	workLoc := &profile.Location{ID: 1, Line: []profile.Line{{Function: work}}}
+	idleLoc := &profile.Location{ID: 2, Line: []profile.Line{{Function: idle}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	p := &profile.Profile{SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1,
+		Function: []*profile.Function{work, idle}, Location: []*profile.Location{workLoc, idleLoc},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{workLoc}, Value: []int64{3000000}},
+			{Location: []*profile.Location{idleLoc}, Value: []int64{1000000}},
+		}}
+	profilePath := filepath.Join(t.TempDir(), "cpu.pprof")
+	f, err := os.Create(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	ctx := context.Background()
+	result, _, err := handleGenerateCallgraph(ctx, nil, GenerateCallgraphArgs{ProfileURI: profilePath, ProfileType: "cpu", OutputFormat: "text"})
+	if err != nil {
+		t.Fatalf("handleGenerateCallgraph(text) error = %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !containsAll(text, "flat%", "main.work", "main.idle") {
+		t.Errorf("Unexpected text output:\n%s", text)
+	}
+
+	result, _, err = handleGenerateCallgraph(ctx, nil, GenerateCallgraphArgs{ProfileURI: profilePath, ProfileType: "cpu", Focus: "main\\.work"})
+	if err != nil {
+		t.Fatalf("handleGenerateCallgraph(tree, focus) error = %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "main.work") || strings.Contains(text, "main.idle") {
+		t.Errorf("Expected focus to keep only main.work:\n%s", text)
+	}
+
+	// pprof 的警告 (这里是 ignore 没有匹配的函数) 写到 stderr，放在提示信息中而不是调用图文本中
+	result, _, err = handleGenerateCallgraph(ctx, nil, GenerateCallgraphArgs{ProfileURI: profilePath, ProfileType: "cpu", Ignore: "main\\.missing"})
+	if err != nil {
+		t.Fatalf("handleGenerateCallgraph(tree, ignore) error = %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "main.work") || strings.Contains(text, "matched no samples") {
+		t.Errorf("Expected the call graph without pprof warnings:\n%s", text)
+	}
+	if len(result.Content) != 2 || !strings.Contains(result.Content[1].(*mcp.TextContent).Text, "go tool pprof: Ignore expression matched no samples") {
+		t.Errorf("Expected the pprof warning in the notes, got %d content items", len(result.Content))
+	}
+
+	var appErr *AppError
+	if _, _, err := handleGenerateCallgraph(ctx, nil, GenerateCallgraphArgs{ProfileURI: profilePath, ProfileType: "cpu", Hide: "main.(work"}); !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument {
+		t.Errorf("handleGenerateCallgraph(invalid hide) error = %v, want %s", err, ErrCodeInvalidArgument)
+	}
+}
+
+// TestValidateProfileTool 测试 validate_profile 将无法解析的文件作为校验问题返回、列出损坏文件的所有问题，文件不存在时仍返回加载错误
+func TestValidateProfileTool(t *testing.T) {
+	dir := t.TempDir()
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1}}},
+	}
+	validPath := filepath.Join(dir, "cpu.pprof")
+	f, err := os.Create(validPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	corruptPath := filepath.Join(dir, "corrupt.pprof")
+	if err := os.WriteFile(corruptPath, []byte("not a profile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, _, err := handleValidateProfile(context.Background(), nil, ValidateProfileArgs{ProfileURI: validPath})
+	if err != nil {
+		t.Fatalf("handleValidateProfile(valid) error = %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "valid: 未发现问题 (1 个样本)") {
+		t.Errorf("handleValidateProfile(valid) = %s", text)
+	}
+
+	result, _, err = handleValidateProfile(context.Background(), nil, ValidateProfileArgs{ProfileURI: corruptPath, OutputFormat: "json"})
+	if err != nil {
+		t.Fatalf("handleValidateProfile(corrupt) error = %v", err)
+	}
+	var validation analyzer.ProfileValidation
+	if err := json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &validation); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if validation.Valid || len(validation.Problems) != 1 || validation.Problems[0].Check != analyzer.ValidationParse {
+		t.Errorf("handleValidateProfile(corrupt) = %+v", validation)
+	}
+
+	// 样本值数量与样本类型数量不一致的文件能被解码，CheckValid 的错误和逐个样本的问题都要列出，而不是只有第一个解析错误
+	mismatch := p.Copy()
+	for i := 0; i < 3; i++ {
+		mismatch.Sample = append(mismatch.Sample, &profile.Sample{Location: []*profile.Location{mismatch.Location[0]}, Value: []int64{1, 2}})
+	}
+	mismatchPath := filepath.Join(dir, "mismatch.pprof")
+	f, err = os.Create(mismatchPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mismatch.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	result, _, err = handleValidateProfile(context.Background(), nil, ValidateProfileArgs{ProfileURI: mismatchPath, OutputFormat: "json"})
+	if err != nil {
+		t.Fatalf("handleValidateProfile(mismatch) error = %v", err)
+	}
+	validation = analyzer.ProfileValidation{}
+	if err := json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &validation); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, problem := range validation.Problems {
+		counts[problem.Check]++
+	}
+	if validation.Valid || validation.SampleCount != 4 || counts[analyzer.ValidationCheckValid] != 1 || counts[analyzer.ValidationValueCount] != 3 || counts[analyzer.ValidationParse] != 0 {
+		t.Errorf("handleValidateProfile(mismatch) = %+v", validation)
+	}
+
+	if _, _, err := handleValidateProfile(context.Background(), nil, ValidateProfileArgs{ProfileURI: filepath.Join(dir, "missing.pprof")}); err == nil {
+		t.Error("handleValidateProfile(missing) should return the load error")
+	}
+}
+
+// TestCleanNamesAcrossTools 测试 clean_names 在 analyze_pprof 和 compare_profiles 之外的工具中同样生效，闭包合并到外层函数
+func TestCleanNamesAcrossTools(t *testing.T) {
+	outer := &profile.Function{ID: 1, Name: "main.handle"}
+	closure := &profile.Function{ID: 2, Name: "main.handle.func1"}
+	outerLoc := &profile.Location{ID: 1, Line: []profile.Line{{Function: outer}}}
+	closureLoc := &profile.Location{ID: 2, Line: []profile.Line{{Function: closure}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	newProfile := func(scale int64) *profile.Profile {
+		return &profile.Profile{
+			SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1,
+			Function: []*profile.Function{outer, closure}, Location: []*profile.Location{outerLoc, closureLoc},
+			Sample: []*profile.Sample{
+				{Location: []*profile.Location{outerLoc}, Value: []int64{100 * scale}, Label: map[string][]string{"endpoint": {"/api"}}},
+				{Location: []*profile.Location{closureLoc, outerLoc}, Value: []int64{300 * scale}, Label: map[string][]string{"endpoint": {"/api"}}},
+			},
+		}
+	}
+	baseline, target := writeTestProfile(t, newProfile(1)), writeTestProfile(t, newProfile(2))
+
+	ctx := context.Background()
+	tools := map[string]func() (*mcp.CallToolResult, error){
+		"analyze_flat_cumulative": func() (*mcp.CallToolResult, error) {
+			r, _, err := handleAnalyzeFlatCumulative(ctx, nil, AnalyzeFlatCumulativeArgs{ProfileURI: target, ProfileType: "cpu", OutputFormat: "text", CleanNames: true})
+			return r, err
+		},
+		"estimate_optimization_impact": func() (*mcp.CallToolResult, error) {
+			r, _, err := handleEstimateImpact(ctx, nil, EstimateImpactArgs{ProfileURI: target, ProfileType: "cpu", Function: "main.handle", ReductionPercent: 50, OutputFormat: "text", CleanNames: true})
+			return r, err
+		},
+		"diff_profile": func() (*mcp.CallToolResult, error) {
+			r, _, err := handleDiffProfile(ctx, nil, DiffProfileArgs{BaselineProfileURI: baseline, TargetProfileURI: target, ProfileType: "cpu", OutputFormat: "text", CleanNames: true})
+			return r, err
+		},
+		"compare_profiles_batch": func() (*mcp.CallToolResult, error) {
+			r, _, err := handleCompareProfilesBatch(ctx, nil, CompareProfilesBatchArgs{BaselineProfileURI: baseline, TargetProfileURIs: []string{target}, ProfileType: "cpu", OutputFormat: "text", CleanNames: true})
+			return r, err
+		},
+		"compare_profiles_multi": func() (*mcp.CallToolResult, error) {
+			r, _, err := handleCompareProfilesMulti(ctx, nil, CompareProfilesMultiArgs{ProfileURIs: []string{baseline, target}, ProfileType: "cpu", OutputFormat: "text", CleanNames: true})
+			return r, err
+		},
+		"analyze_fleet": func() (*mcp.CallToolResult, error) {
+			r, _, err := handleAnalyzeFleet(ctx, nil, AnalyzeFleetArgs{ProfileURIs: []string{baseline, target}, ProfileType: "cpu", OutputFormat: "text", CleanNames: true})
+			return r, err
+		},
+		"generate_flamegraph": func() (*mcp.CallToolResult, error) {
+			r, _, err := handleGenerateFlamegraph(ctx, nil, GenerateFlamegraphArgs{ProfileURI: target, ProfileType: "cpu", OutputFormat: "collapsed", CleanNames: true})
+			return r, err
+		},
+	}
+	for name, call := range tools {
+		result, err := call()
+		if err != nil {
+			t.Errorf("%s: error = %v", name, err)
+			continue
+		}
+		text := result.Content[0].(*mcp.TextContent).Text
+		if strings.Contains(text, ".func1") || !strings.Contains(text, "main.handle") {
+			t.Errorf("%s: expected closures to be merged into main.handle:\n%s", name, text)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"log"
 	"os"
+
+	"github.com/ZephyrDeng/pprof-analyzer-mcp/analyzer"
 )
 
 // 全局日志配置
@@ -11,11 +14,15 @@ var (
 	logLevel = os.Getenv("LOG_LEVEL")
 )
 
-// initLogging 初始化日志系统
+// initLogging 初始化日志系统：日志写到 stderr (stdout 由 stdio MCP 传输使用)，并按 LOG_LEVEL 设置日志级别。
+// LOG_LEVEL 无效时使用 info 并输出一条警告
 func initLogging() {
-	// 设置默认日志级别
-	if logLevel == "" {
-		logLevel = "info"
+	log.SetOutput(os.Stderr)
+	level, err := analyzer.ParseLogLevel(logLevel)
+	analyzer.SetLogLevel(level)
+	logLevel = level.String()
+	if err != nil {
+		logWarn("invalid LOG_LEVEL: %v, using %s", err, logLevel)
 	}
 }
 
@@ -23,3 +30,15 @@ func initLogging() {
 func getLogLevel() string {
 	return logLevel
 }
+
+// logDebug 输出 debug 级别的日志，默认的 info 级别下不输出
+func logDebug(format string, args ...any) { analyzer.Logf(analyzer.LogLevelDebug, format, args...) }
+
+// logInfo 输出 info 级别的日志
+func logInfo(format string, args ...any) { analyzer.Logf(analyzer.LogLevelInfo, format, args...) }
+
+// logWarn 输出 warn 级别的日志
+func logWarn(format string, args ...any) { analyzer.Logf(analyzer.LogLevelWarn, format, args...) }
+
+// logError 输出 error 级别的日志
+func logError(format string, args ...any) { analyzer.Logf(analyzer.LogLevelError, format, args...) }
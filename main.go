@@ -3,11 +3,38 @@ package main
 import (
 	"context"
 	"log"
+	"os"
+	"slices"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/ZephyrDeng/pprof-analyzer-mcp/analyzer"
 )
 
 func main() {
+	initLogging()
+	server := newServer()
+
+	// 设置信号处理程序以进行清理
+	setupSignalHandler()
+
+	// 使用 stdio transport 启动服务器
+	logInfo("Starting PprofAnalyzer MCP server via stdio (log level: %s)...", getLogLevel())
+	if err := server.Run(context.Background(), newStdioTransport()); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
+
+// newStdioTransport 返回通过进程的 stdin/stdout 收发协议消息的传输，并把 os.Stdout 重定向到 stderr。
+// stdout 只承载协议消息，之后对 os.Stdout 的任何写入 (例如调试时留下的 fmt.Println) 都会写到 stderr，不会破坏协议
+func newStdioTransport() mcp.Transport {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	return &mcp.IOTransport{Reader: os.Stdin, Writer: stdout}
+}
+
+// newServer 创建 MCP 服务器并注册所有工具
+func newServer() *mcp.Server {
 	// 1. 初始化 MCP 服务器
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "PprofAnalyzer",
@@ -19,50 +46,227 @@ func main() {
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "analyze_pprof",
 		Description: "分析指定的 Go pprof 文件，并返回序列化的分析结果 (例如 Top N 列表或火焰图 JSON)。",
+		InputSchema: inputSchema[AnalyzePprofArgs](map[string][]string{
+			"profile_type":     analyzePprofProfileTypes,
+			"output_format":    analyzeFormats,
+			"primary_metric":   {analyzer.PrimaryMetricDelay, analyzer.PrimaryMetricContentions},
+			"cpu_period_check": {"warn", "error", "off"},
+			"aggregate_by":     {"function", "package"},
+			"sort_by":          append(slices.Clone(analyzer.FunctionSortKeys), analyzer.ContentionSortKeys...),
+			"number_style":     analyzer.NumberStyles,
+		}),
 	}, handleAnalyzePprof)
 
 	// generate_flamegraph 工具
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "generate_flamegraph",
-		Description: "使用 'go tool pprof' 为指定的 pprof 文件生成火焰图 (SVG 格式)，将其保存到指定路径，并返回路径和 SVG 内容。",
+		Description: "使用 'go tool pprof' 或内置渲染器 (engine: builtin，无需 Graphviz) 为指定的 pprof 文件生成火焰图 (SVG 格式)，将其保存到指定路径，并返回路径、指向文件的资源链接和 image/svg+xml 图片内容 (超过 max_inline_bytes 时只返回路径)。output_format: collapsed 时直接返回折叠调用栈文本 (可交给 flamegraph.pl)，无需 Graphviz 和输出路径。",
+		InputSchema: inputSchema[GenerateFlamegraphArgs](map[string][]string{
+			"profile_type":  flamegraphProfileTypes,
+			"output_format": flamegraphFormats,
+			"engine":        {"go_tool", "builtin"},
+		}),
 	}, handleGenerateFlamegraph)
 
+	// generate_diff_flamegraph 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "generate_diff_flamegraph",
+		Description: "使用 'go tool pprof -diff_base' 为两个同类型的 profile 生成差分火焰图 (SVG 格式)：红色表示 target 相对 baseline 增加 (回归)，绿色表示减少 (改进)。将其保存到指定路径，并返回路径、资源链接和 image/svg+xml 图片内容。需要 Graphviz。",
+		InputSchema: inputSchema[GenerateDiffFlamegraphArgs](map[string][]string{
+			"profile_type": diffFlamegraphProfileTypes,
+		}),
+	}, handleGenerateDiffFlamegraph)
+
+	// generate_callgraph 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "generate_callgraph",
+		Description: "使用 'go tool pprof -tree' 或 '-text' 为指定的 pprof 文件生成文本调用图并直接返回，不需要 Graphviz。支持 node_count 以及 focus/ignore/hide 正则表达式，便于只查看某个子系统。",
+		InputSchema: inputSchema[GenerateCallgraphArgs](map[string][]string{
+			"profile_type":  flamegraphProfileTypes,
+			"output_format": callgraphFormats,
+		}),
+	}, handleGenerateCallgraph)
+
 	// detect_memory_leaks 工具
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "detect_memory_leaks",
 		Description: "比较两个 heap profile 文件以识别潜在的内存泄漏。",
+		InputSchema: inputSchema[DetectMemoryLeaksArgs](map[string][]string{
+			"metric": analyzer.LeakMetrics,
+		}),
 	}, handleDetectMemoryLeaks)
 
-	// open_interactive_pprof 工具 (仅限 macOS)
+	// open_interactive_pprof 工具
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "open_interactive_pprof",
-		Description: "【仅限 macOS】尝试在后台启动 'go tool pprof' 交互式 Web UI。成功启动后会返回进程 PID，用于后续手动断开连接。",
+		Description: "在后台启动 'go tool pprof' 交互式 Web UI (支持所有平台)。成功启动后返回 Web UI 的 URL 和进程 PID，PID 用于后续手动断开连接；可通过 open_browser 在浏览器中打开 (macOS 上默认打开)。",
+		InputSchema: inputSchema[OpenInteractivePprofArgs](nil),
 	}, handleOpenInteractivePprof)
 
 	// disconnect_pprof_session 工具
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "disconnect_pprof_session",
 		Description: "尝试终止由 'open_interactive_pprof' 启动的指定后台 pprof 进程。",
+		InputSchema: inputSchema[DisconnectPprofSessionArgs](nil),
 	}, handleDisconnectPprofSession)
 
+	// list_pprof_sessions 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_pprof_sessions",
+		Description: "列出由 'open_interactive_pprof' 启动且仍在跟踪的所有后台 pprof 会话，包括 PID、profile URI、Web UI 地址/端口和启动时间。",
+		InputSchema: inputSchema[ListPprofSessionsArgs](nil),
+	}, handleListPprofSessions)
+
 	// compare_profiles 工具
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "compare_profiles",
 		Description: "比较两个 profile 文件（如同一服务的不同版本），生成差异分析报告，识别性能回归或改进。",
+		InputSchema: inputSchema[CompareProfilesArgs](map[string][]string{
+			"profile_type":  compareProfileTypes,
+			"output_format": compareFormats,
+			"aggregation":   aggregations,
+			"sort_by":       analyzer.DiffSortKeys,
+		}),
 	}, handleCompareProfiles)
 
 	// analyze_heap_time_series 工具
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "analyze_heap_time_series",
 		Description: "分析多个 heap profile 的时序数据（至少 3 个），识别内存增长趋势和潜在的内存泄漏。",
+		InputSchema: inputSchema[AnalyzeHeapTimeSeriesArgs](map[string][]string{"output_format": reportFormats}),
 	}, handleAnalyzeHeapTimeSeries)
 
-	// 3. 设置信号处理程序以进行清理
-	setupSignalHandler()
+	// describe_profile 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "describe_profile",
+		Description: "查看 profile 的概览信息：列出所有样本类型 (type/unit) 及其在全部样本上的总值，便于在分析前确定使用哪种 profile_type；给出采样周期、采集时间和时长以及注释；并按 Mapping (主程序、插件、共享库) 汇总样本数、值和符号情况。",
+		InputSchema: inputSchema[DescribeProfileArgs](map[string][]string{"output_format": reportFormats}),
+	}, handleDescribeProfile)
 
-	// 4. 使用 stdio transport 启动服务器
-	log.Println("Starting PprofAnalyzer MCP server via stdio...")
-	if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
-		log.Fatalf("Server error: %v", err)
-	}
+	// validate_profile 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "validate_profile",
+		Description: "在分析前检查 profile 是否完整、内部一致：能否解析、profile.CheckValid 是否通过、每个样本的值数量是否与样本类型数量一致、引用的 Location/Function/Mapping 是否都存在、样本类型单位能否识别。返回 valid 或问题列表，可以在浪费时间分析之前发现损坏的采集文件。",
+		InputSchema: inputSchema[ValidateProfileArgs](map[string][]string{"output_format": reportFormats}),
+	}, handleValidateProfile)
+
+	// check_goroutines 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "check_goroutines",
+		Description: "轻量级的 goroutine 泄漏健康检查：将 goroutine 总数与阈值或基线 profile 比较，返回通过/未通过、相对基线的变化，以及未通过时增长最多的堆栈。",
+		InputSchema: inputSchema[CheckGoroutinesArgs](map[string][]string{"output_format": reportFormats}),
+	}, handleCheckGoroutines)
+
+	// export_heap_growth_profile 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "export_heap_growth_profile",
+		Description: "将按时间顺序排列的多个 heap profile 合成一个增长率 pprof 文件 (样本类型 growth_bytes_per_min)，每个调用栈的值为其内存增长率，可直接用火焰图查看增长最快的部分。",
+		InputSchema: inputSchema[ExportHeapGrowthProfileArgs](nil),
+	}, handleExportHeapGrowthProfile)
+
+	// diff_profile 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "diff_profile",
+		Description: "构造差值 profile (target - baseline) 并执行常规的 Top N 分析，以单一排序列表展示每个函数的净变化 (负值表示改进)，可选将差值 profile 保存为 pprof 文件。",
+		InputSchema: inputSchema[DiffProfileArgs](map[string][]string{
+			"profile_type":  compareProfileTypes,
+			"output_format": reportFormats,
+		}),
+	}, handleDiffProfile)
+
+	// sanitize_profile 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "sanitize_profile",
+		Description: "对 profile 进行脱敏：将函数名、文件路径、mapping 和标签替换为确定性的哈希 token，保留样本值和调用栈结构，生成可以安全分享 (例如提交 issue) 的 profile 文件。",
+		InputSchema: inputSchema[SanitizeProfileArgs](nil),
+	}, handleSanitizeProfile)
+
+	// analyze_labels 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "analyze_labels",
+		Description: "按 pprof 标签对样本值分组：指定 1 个标签键时按标签值汇总，指定 2 个标签键时输出透视表 (例如 endpoint × status_code)，可以看出某个接口在某种响应下消耗了多少 CPU 或内存。",
+		InputSchema: inputSchema[AnalyzeLabelsArgs](map[string][]string{
+			"profile_type":  analyzeProfileTypes,
+			"output_format": reportFormats,
+		}),
+	}, handleAnalyzeLabels)
+
+	// estimate_optimization_impact 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "estimate_optimization_impact",
+		Description: "估算优化收益 (what-if 分析)：假设某个热点函数的开销降低一定百分比，计算 profile 的新总值和总体改善百分比。默认只按函数自身 (flat) 的开销估算，可选按 cumulative 估算包含其调用的函数在内的上限，便于决定优先优化哪个热点。",
+		InputSchema: inputSchema[EstimateImpactArgs](map[string][]string{
+			"profile_type":  analyzeProfileTypes,
+			"output_format": reportFormats,
+			"attribution":   {"flat", "cumulative"},
+		}),
+	}, handleEstimateImpact)
+
+	// detect_goroutine_leaks 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "detect_goroutine_leaks",
+		Description: "比较两个 goroutine profile 以识别 goroutine 泄漏：按堆栈对 goroutine 分组，列出 goroutine 数量增长最多的堆栈及其增量，并标记只出现在较新 profile 中的堆栈。",
+		InputSchema: inputSchema[DetectGoroutineLeaksArgs](map[string][]string{"output_format": reportFormats}),
+	}, handleDetectGoroutineLeaks)
+
+	// compare_profiles_batch 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "compare_profiles_batch",
+		Description: "将多个目标 profile (例如一周内的每日构建) 分别与同一个基线 profile 比较，返回每个目标的差异摘要 (总值变化、回归/提升/新增/移除的函数数、增长最多的函数) 以及总值随目标序列变化的趋势表，一次调用即可跟踪多个构建的性能回归。",
+		InputSchema: inputSchema[CompareProfilesBatchArgs](map[string][]string{
+			"profile_type":  compareProfileTypes,
+			"output_format": reportFormats,
+			"aggregation":   aggregations,
+		}),
+	}, handleCompareProfilesBatch)
+
+	// compare_profiles_multi 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "compare_profiles_multi",
+		Description: "将多个候选 profile (例如 candidate-1、candidate-2) 与同一个基线比较，生成每个函数在所有 profile 中的值矩阵 (宽表)，标记只在部分候选版本中回归的函数，并给出相对基线总值增长最少的候选版本，用于判断哪个方案的回归更少。",
+		InputSchema: inputSchema[CompareProfilesMultiArgs](map[string][]string{
+			"profile_type":  compareProfileTypes,
+			"output_format": reportFormats,
+			"aggregation":   aggregations,
+		}),
+	}, handleCompareProfilesMulti)
+
+	// analyze_flat_cumulative 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "analyze_flat_cumulative",
+		Description: "并列展示函数的 flat (自身) 值和 cumulative (含调用的函数) 值，按 cumulative 排序，并标记自身开销很小但 cumulative 很大的透传 (passthrough) 函数，帮助区分应直接优化的热点和只是调用了热点的函数。",
+		InputSchema: inputSchema[AnalyzeFlatCumulativeArgs](map[string][]string{
+			"profile_type":  analyzeProfileTypes,
+			"output_format": reportFormats,
+		}),
+	}, handleAnalyzeFlatCumulative)
+
+	// assert_comparable 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "assert_comparable",
+		Description: "在比较前快速检查两个 profile 是否可比较 (不做完整分析)：样本类型兼容、单位一致、主程序 build ID 一致、采集时长比值在允许范围内。返回 comparable 布尔值以及每个检查项的状态和原因 (默认 JSON)，适合在 CI 中作为 compare_profiles 之前的门禁。",
+		InputSchema: inputSchema[AssertComparableArgs](map[string][]string{
+			"profile_type":  analyzeProfileTypes,
+			"output_format": reportFormats,
+		}),
+	}, handleAssertComparable)
+
+	// merge_profiles 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "merge_profiles",
+		Description: "将多个同类型的 profile (例如集群中每个实例的 CPU profile) 合并为一个 pprof 文件：相同调用栈的样本值相加，可再交给 analyze_pprof 查看整体视图。所有 profile 的样本类型必须一致，否则拒绝合并并说明差异。",
+		InputSchema: inputSchema[MergeProfilesArgs](nil),
+	}, handleMergeProfiles)
+
+	// analyze_fleet 工具
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "analyze_fleet",
+		Description: "并发获取多个副本 (例如同一服务的每个 pod) 的 pprof 端点，合并兼容的 profile 给出集群整体热点，并按偏离集群平均水平的程度 (按采集时长归一化的总量偏差和函数占比分布差异) 对副本排序，找出 \"只有一个 pod 很慢\" 的那个副本。部分副本获取失败时仍分析其余副本，并列出失败原因。",
+		InputSchema: inputSchema[AnalyzeFleetArgs](map[string][]string{
+			"profile_type":  analyzeProfileTypes,
+			"output_format": reportFormats,
+		}),
+	}, handleAnalyzeFleet)
+
+	return server
 }
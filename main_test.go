@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/ZephyrDeng/pprof-analyzer-mcp/analyzer"
+)
+
+// syncBuffer 是可以被读取协议消息的 goroutine 并发写入的 bytes.Buffer
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// readCloser 组合 io.Reader 与另一个对象的 Close
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// TestStdioTransportOnlyWritesProtocolFrames 测试通过 stdio 传输调用分析工具时 stdout 上只有 JSON-RPC 消息：
+// debug 级别的日志写到 stderr，传输建立后对 os.Stdout 的写入也不会出现在协议流中
+func TestStdioTransportOnlyWritesProtocolFrames(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{cpuType}, PeriodType: cpuType, Period: 1,
+		Function: []*profile.Function{fn}, Location: []*profile.Location{loc},
+		Sample: []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1000}}},
+	}
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevStdin, prevStdout, prevLevel := os.Stdin, os.Stdout, analyzer.CurrentLogLevel()
+	os.Stdin, os.Stdout = stdinReader, stdoutWriter
+	analyzer.SetLogLevel(analyzer.LogLevelDebug)
+	defer func() {
+		os.Stdin, os.Stdout = prevStdin, prevStdout
+		analyzer.SetLogLevel(prevLevel)
+	}()
+
+	ctx := context.Background()
+	transport := newStdioTransport()
+	if os.Stdout == stdoutWriter {
+		t.Fatal("newStdioTransport() left os.Stdout pointing at the protocol stream")
+	}
+	serverSession, err := newServer().Connect(ctx, transport, nil)
+	if err != nil {
+		t.Fatalf("server.Connect() error = %v", err)
+	}
+	defer serverSession.Close()
+
+	var frames syncBuffer
+	client := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil)
+	session, err := client.Connect(ctx, &mcp.IOTransport{
+		Reader: readCloser{io.TeeReader(stdoutReader, &frames), stdoutReader},
+		Writer: stdinWriter,
+	}, nil)
+	if err != nil {
+		t.Fatalf("client.Connect() error = %v", err)
+	}
+	defer session.Close()
+
+	fmt.Println("stray write to stdout")
+	for _, format := range []string{"text", "json", "flamegraph-json"} {
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "analyze_pprof", Arguments: map[string]any{
+			"profile_uri": path, "profile_type": "cpu", "output_format": format,
+		}})
+		if err != nil || result.IsError {
+			t.Fatalf("CallTool(analyze_pprof, %s) = %+v, %v", format, result, err)
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewBufferString(frames.String()))
+	scanner.Buffer(nil, 1<<20)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+		var frame struct {
+			JSONRPC string `json:"jsonrpc"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil || frame.JSONRPC != "2.0" {
+			t.Errorf("stdout contains a non-protocol line: %q", scanner.Text())
+		}
+	}
+	if lines == 0 {
+		t.Error("no protocol frames were written to stdout")
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// s3 和 gs URI 直接下载对象 (与 HTTP profile 共用大小限制、超时和熔断)，凭证则交给云厂商的 SDK 解析：
+//   - s3://bucket/key 使用 SigV4 签名的 GetObject 请求。凭证和区域由 aws-sdk-go-v2/config 的默认链解析：
+//     环境变量、共享配置和凭证文件 (AWS_PROFILE，包括 SSO 和 assume-role profile)、AWS_WEB_IDENTITY_TOKEN_FILE、
+//     ECS 容器凭证和 EC2 实例角色；没有配置区域时使用 us-east-1。AWS_ENDPOINT_URL_S3 / AWS_ENDPOINT_URL 可指定兼容 S3 的服务 (例如 MinIO)。
+//   - gs://bucket/object 使用 JSON API 的 alt=media 下载。访问令牌依次读取 GOOGLE_OAUTH_ACCESS_TOKEN 和
+//     golang.org/x/oauth2/google 的 Application Default Credentials (GOOGLE_APPLICATION_CREDENTIALS、gcloud 的
+//     application_default_credentials.json、workload identity federation 和 GCE 元数据服务器)；
+//     设置 STORAGE_EMULATOR_HOST 时访问模拟器且不需要凭证。
+const (
+	defaultS3Region = "us-east-1"
+	// s3UnsignedPayload 表示请求体不参与签名，GET 请求没有请求体
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	gcsReadOnlyScope   = "https://www.googleapis.com/auth/devstorage.read_only"
+	defaultGCSEndpoint = "https://storage.googleapis.com"
+)
+
+// fetchObjectStorageProfile 下载 s3:// 或 gs:// URI 指向的对象到临时文件，下载大小和超时与 HTTP profile 相同
+func fetchObjectStorageProfile(ctx context.Context, parsedURI *url.URL) (string, func(), error) {
+	uriStr := parsedURI.String()
+	bucket := parsedURI.Host
+	key := strings.TrimPrefix(parsedURI.Path, "/")
+	if bucket == "" || key == "" {
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("invalid object storage URI '%s', expected %s://bucket/path/to/object", uriStr, parsedURI.Scheme))
+	}
+
+	var req *http.Request
+	var err error
+	if parsedURI.Scheme == "s3" {
+		req, err = newS3Request(ctx, bucket, key)
+	} else {
+		req, err = newGCSRequest(ctx, bucket, key)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	host := req.URL.Host
+	if ok, retryAfter := remoteBreaker.allow(host); !ok {
+		logWarn("Circuit breaker open for host %s, failing fast (retry after %s)", host, retryAfter)
+		return "", nil, NewSourceUnavailableError(host, retryAfter)
+	}
+	logInfo("Downloading object %s (timeout %s)", uriStr, httpTimeout)
+	download, err := doProfileDownload(ctx, &http.Client{Timeout: httpTimeout}, req, uriStr, host, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return download.FilePath, download.Cleanup, nil
+}
+
+// awsConfigCache 按选择凭证来源的环境变量缓存已成功取得凭证的 AWS 配置，
+// 使 SDK 的凭证缓存 (assume-role、SSO、实例角色等临时凭证) 在多次下载之间复用
+var awsConfigCache = struct {
+	sync.Mutex
+	configs map[string]aws.Config
+}{configs: make(map[string]aws.Config)}
+
+// awsConfigEnv 是影响默认凭证链和区域解析结果的环境变量
+var awsConfigEnv = []string{
+	"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_CONFIG_FILE", "AWS_SHARED_CREDENTIALS_FILE",
+	"AWS_ACCESS_KEY_ID", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_REGION", "AWS_DEFAULT_REGION",
+}
+
+// newS3Request 创建已签名的 S3 GetObject 请求。没有设置 endpoint 时使用虚拟主机风格 (bucket.s3.region.amazonaws.com)，
+// bucket 名称包含 "." 或指定了 endpoint 时使用路径风格。
+func newS3Request(ctx context.Context, bucket, key string) (*http.Request, error) {
+	cfg, creds, err := loadAWSCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	region := cfg.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	escapedKey := awsURIEncode(key, false)
+	var rawURL string
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		rawURL = strings.TrimSuffix(endpoint, "/") + "/" + awsURIEncode(bucket, true) + "/" + escapedKey
+	} else if strings.Contains(bucket, ".") {
+		rawURL = fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", region, bucket, escapedKey)
+	} else {
+		rawURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapedKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 request URL '%s': %w", rawURL, err)
+	}
+	if err := signS3Request(ctx, req, creds, region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign S3 request: %w", err)
+	}
+	return req, nil
+}
+
+// loadAWSCredentials 通过 SDK 的默认凭证链取得 AWS 配置和凭证，没有可用凭证时返回 CREDENTIALS_MISSING 错误
+func loadAWSCredentials(ctx context.Context) (aws.Config, aws.Credentials, error) {
+	var cacheKey strings.Builder
+	for _, name := range awsConfigEnv {
+		cacheKey.WriteString(name + "=" + os.Getenv(name) + "\n")
+	}
+
+	awsConfigCache.Lock()
+	cfg, ok := awsConfigCache.configs[cacheKey.String()]
+	awsConfigCache.Unlock()
+	if !ok {
+		var err error
+		cfg, err = awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return aws.Config{}, aws.Credentials{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+		}
+	}
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return aws.Config{}, aws.Credentials{}, NewCanceledError("获取 AWS 凭证", ctx.Err())
+		}
+		return aws.Config{}, aws.Credentials{}, NewCredentialsMissingError("s3", fmt.Sprintf("set AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY, configure a profile in ~/.aws/config or ~/.aws/credentials (selected by AWS_PROFILE), or run with an IAM role (EC2, ECS or AWS_WEB_IDENTITY_TOKEN_FILE): %v", err))
+	}
+	if !ok {
+		awsConfigCache.Lock()
+		awsConfigCache.configs[cacheKey.String()] = cfg
+		awsConfigCache.Unlock()
+	}
+	return cfg, creds, nil
+}
+
+// signS3Request 使用 SDK 的 SigV4 签名器为 req 添加 Authorization 头。
+// 没有 x-amz-content-sha256 时使用 UNSIGNED-PAYLOAD；S3 的路径不做二次编码。
+func signS3Request(ctx context.Context, req *http.Request, creds aws.Credentials, region string, now time.Time) error {
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = s3UnsignedPayload
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	signer := v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true })
+	return signer.SignHTTP(ctx, creds, req, payloadHash, "s3", region, now)
+}
+
+// awsURIEncode 按 SigV4 规则编码：只保留 A-Z a-z 0-9 - _ . ~，其余字节编码为 %XX；encodeSlash 为 false 时保留 "/"
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// newGCSRequest 创建 GCS JSON API 的对象下载请求并添加访问令牌。设置 STORAGE_EMULATOR_HOST 时不需要凭证。
+func newGCSRequest(ctx context.Context, bucket, object string) (*http.Request, error) {
+	endpoint := defaultGCSEndpoint
+	emulator := os.Getenv("STORAGE_EMULATOR_HOST")
+	if emulator != "" {
+		endpoint = strings.TrimSuffix(emulator, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+	rawURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", endpoint, url.PathEscape(bucket), url.PathEscape(object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GCS request URL '%s': %w", rawURL, err)
+	}
+	if emulator == "" {
+		token, err := gcsAccessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// gcsTokenSources 按 GOOGLE_APPLICATION_CREDENTIALS 缓存 Application Default Credentials 的令牌源，
+// 令牌源自带缓存，只在令牌过期时重新换取
+var gcsTokenSources = struct {
+	sync.Mutex
+	sources map[string]oauth2.TokenSource
+}{sources: make(map[string]oauth2.TokenSource)}
+
+// gcsAccessToken 返回访问 GCS 的 OAuth2 令牌，没有任何可用凭证时返回 CREDENTIALS_MISSING 错误
+func gcsAccessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	gcsTokenSources.Lock()
+	source, ok := gcsTokenSources.sources[path]
+	gcsTokenSources.Unlock()
+	if !ok {
+		// 令牌源会在之后的请求中继续使用，不能绑定到本次请求的 ctx
+		creds, err := google.FindDefaultCredentials(context.Background(), gcsReadOnlyScope)
+		if err != nil {
+			if path != "" {
+				return "", fmt.Errorf("failed to load Google credentials from '%s': %w", path, err)
+			}
+			return "", NewCredentialsMissingError("gs", "set GOOGLE_APPLICATION_CREDENTIALS to a service account key or workload identity configuration, set GOOGLE_OAUTH_ACCESS_TOKEN (e.g. from `gcloud auth print-access-token`), run `gcloud auth application-default login`, or run on GCP with an attached service account")
+		}
+		source = creds.TokenSource
+		gcsTokenSources.Lock()
+		gcsTokenSources.sources[path] = source
+		gcsTokenSources.Unlock()
+	}
+
+	token, err := source.Token()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", NewCanceledError("获取 GCS 访问令牌", ctx.Err())
+		}
+		return "", fmt.Errorf("failed to obtain GCS access token: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// firstEnv 返回第一个非空的环境变量值
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
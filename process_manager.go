@@ -1,20 +1,59 @@
 package main
 
 import (
-	
-	"log"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/exec"
 	"os/signal"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
+// pprofSession 是 open_interactive_pprof 启动的一个后台 pprof 会话
+type pprofSession struct {
+	PID        int       `json:"pid"`
+	ProfileURI string    `json:"profileUri"`
+	URL        string    `json:"url"`
+	Port       int       `json:"port"`
+	StartedAt  time.Time `json:"startedAt"`
+	process    *os.Process
+	exited     <-chan struct{} // pprof 的输出关闭 (进程已退出) 时关闭，可能为 nil
+}
+
 // 全局变量，用于跟踪由本服务器启动的 pprof 进程
 var (
-	runningPprofs = make(map[int]*os.Process) // 存储 PID 到 Process 指针的映射
-	pprofMutex    sync.Mutex                  // 用于保护 runningPprofs 的互斥锁
+	runningPprofs = make(map[int]*pprofSession) // 存储 PID 到会话信息的映射
+	pprofMutex    sync.Mutex                    // 用于保护 runningPprofs 的互斥锁
 )
 
+// listPprofSessions 返回所有正在运行的 pprof 会话，按启动时间排序
+func listPprofSessions() []pprofSession {
+	pprofMutex.Lock()
+	sessions := make([]pprofSession, 0, len(runningPprofs))
+	for _, session := range runningPprofs {
+		sessions = append(sessions, *session)
+	}
+	pprofMutex.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].StartedAt.Equal(sessions[j].StartedAt) {
+			return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+		}
+		return sessions[i].PID < sessions[j].PID
+	})
+	return sessions
+}
+
 // setupSignalHandler 设置信号处理，用于在服务器退出时清理 pprof 进程。
 // 这个函数应该在 main 函数中被调用一次。
 func setupSignalHandler() {
@@ -23,42 +62,196 @@ func setupSignalHandler() {
 
 	go func() {
 		sig := <-sigs
-		log.Printf("Received signal: %s. Cleaning up running pprof processes...", sig)
+		logInfo("Received signal: %s. Cleaning up running pprof processes...", sig)
 
 		pprofMutex.Lock()
 		pidsToTerminate := make([]int, 0, len(runningPprofs))
 		processesToTerminate := make([]*os.Process, 0, len(runningPprofs))
-		for pid, process := range runningPprofs {
+		for pid, session := range runningPprofs {
 			pidsToTerminate = append(pidsToTerminate, pid)
-			processesToTerminate = append(processesToTerminate, process)
+			processesToTerminate = append(processesToTerminate, session.process)
 		}
-		runningPprofs = make(map[int]*os.Process) // 清空 map
+		runningPprofs = make(map[int]*pprofSession) // 清空 map
 		pprofMutex.Unlock()
 
 		if len(pidsToTerminate) == 0 {
-			log.Println("No running pprof processes to terminate.")
+			logInfo("No running pprof processes to terminate.")
 			return
 		}
 
-		log.Printf("Terminating %d pprof processes: %v", len(pidsToTerminate), pidsToTerminate)
+		logInfo("Terminating %d pprof processes: %v", len(pidsToTerminate), pidsToTerminate)
 		var wg sync.WaitGroup
 		wg.Add(len(processesToTerminate))
 
 		for i, process := range processesToTerminate {
 			go func(p *os.Process, pid int) {
 				defer wg.Done()
-				log.Printf("Sending Interrupt signal to PID %d...", pid)
+				logDebug("Sending Interrupt signal to PID %d...", pid)
 				err := p.Signal(os.Interrupt)
 				if err != nil {
-					log.Printf("Failed to send Interrupt to PID %d: %v. Trying Kill.", pid, err)
+					logError("Failed to send Interrupt to PID %d: %v. Trying Kill.", pid, err)
 					err = p.Signal(os.Kill)
 					if err != nil {
-						log.Printf("Failed to send Kill to PID %d: %v", pid, err)
+						logError("Failed to send Kill to PID %d: %v", pid, err)
 					}
 				}
 			}(process, pidsToTerminate[i])
 		}
 		wg.Wait() // 等待所有终止 goroutine 完成尝试
-		log.Println("Cleanup finished.")
+		logInfo("Cleanup finished.")
+	}()
+}
+
+// defaultPprofGracePeriod 是 disconnect_pprof_session 发送 Interrupt 后等待进程自行退出的默认时间
+const defaultPprofGracePeriod = 5 * time.Second
+
+// 终止 pprof 进程的结果
+const (
+	pprofTerminatedByInterrupt = "interrupt"      // 进程在 Interrupt 之后自行退出
+	pprofTerminatedByKill      = "kill"           // 等待超时或无法发送 Interrupt，强制 Kill
+	pprofAlreadyExited         = "already_exited" // 进程在终止之前已经退出
+)
+
+// terminatePprofProcess 终止 pprof 进程：exited 已关闭时认为进程已经退出；否则先发送 Interrupt 并最多等待 grace 让进程退出 (go tool 会把信号转发给实际的 pprof 进程)，
+// 超时或无法发送 Interrupt (例如 Windows) 时再 Kill。返回终止进程的方式，见 pprofTerminatedByInterrupt 等常量。
+func terminatePprofProcess(process *os.Process, exited <-chan struct{}, grace time.Duration) (string, error) {
+	select {
+	case <-exited:
+		// 进程已经退出，只需回收
+		_, _ = process.Wait()
+		return pprofAlreadyExited, nil
+	default:
+	}
+
+	interruptErr := process.Signal(os.Interrupt)
+	if errors.Is(interruptErr, os.ErrProcessDone) {
+		return pprofAlreadyExited, nil
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		// 回收进程；进程已被回收或不是子进程时的错误不影响终止结果
+		if _, err := process.Wait(); err != nil {
+			logWarn("Error waiting for process PID %d: %v", process.Pid, err)
+		}
+		close(waited)
 	}()
+
+	if interruptErr == nil {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-waited:
+			return pprofTerminatedByInterrupt, nil
+		case <-timer.C:
+			logWarn("PID %d did not exit within %s after Interrupt. Trying Kill.", process.Pid, grace)
+		}
+	} else {
+		logError("Failed to send Interrupt signal to PID %d: %v. Trying Kill signal.", process.Pid, interruptErr)
+	}
+
+	if err := process.Kill(); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			// 在等待超时和 Kill 之间退出
+			return pprofTerminatedByInterrupt, nil
+		}
+		return "", err
+	}
+	<-waited
+	return pprofTerminatedByKill, nil
+}
+
+// pprofHTTPFlagAddress 返回传给 go tool pprof -http 的地址。
+// pprof 只有在端口为空时才自己选择空闲端口并在 stderr 中报告实际端口，端口 0 会被原样输出，因此转换为空端口。
+func pprofHTTPFlagAddress(httpAddress string) string {
+	if host, port, err := net.SplitHostPort(httpAddress); err == nil && port == "0" {
+		return net.JoinHostPort(host, "")
+	}
+	return httpAddress
+}
+
+// pprofStartTimeout 是等待 go tool pprof 输出 Web UI 地址的最长时间 (下载远程 profile 或符号化可能较慢)
+const pprofStartTimeout = 30 * time.Second
+
+// pprofServingPattern 匹配 go tool pprof -http 启动后输出到 stderr 的 "Serving web UI on http://localhost:53412"
+var pprofServingPattern = regexp.MustCompile(`Serving web UI on (\S+)`)
+
+// waitForPprofURL 从 go tool pprof 的 stderr 中读取 Web UI 的地址，并等到该地址可以连接后返回。
+// 找到地址后在后台继续读取并记录剩余输出，避免管道写满阻塞 pprof；进程在 Web UI 可用之前退出时返回它的输出。
+// 返回的 channel 在 pprof 的输出关闭 (即进程已退出) 时关闭。
+func waitForPprofURL(ctx context.Context, stderr io.Reader) (string, <-chan struct{}, error) {
+	found := make(chan string, 1)
+	exited := make(chan string, 1)
+	outputClosed := make(chan struct{})
+	go func() {
+		defer close(outputClosed)
+		var output []string
+		scanner := bufio.NewScanner(stderr)
+		reported := false
+		for scanner.Scan() {
+			line := scanner.Text()
+			logDebug("pprof: %s", line)
+			if reported {
+				continue
+			}
+			if m := pprofServingPattern.FindStringSubmatch(line); m != nil {
+				found <- m[1]
+				reported = true
+				continue
+			}
+			output = append(output, line)
+		}
+		exited <- strings.Join(output, "\n")
+	}()
+
+	timer := time.NewTimer(pprofStartTimeout)
+	defer timer.Stop()
+	var webURL string
+	select {
+	case webURL = <-found:
+	case output := <-exited:
+		return "", nil, fmt.Errorf("'go tool pprof' exited before serving the web UI. Output: %s", output)
+	case <-timer.C:
+		return "", nil, fmt.Errorf("'go tool pprof' did not report a web UI address within %s", pprofStartTimeout)
+	case <-ctx.Done():
+		return "", nil, NewCanceledError("启动 pprof Web UI", ctx.Err())
+	}
+
+	// pprof 在开始监听之前就输出地址，等到端口可以连接再返回，避免调用方立即访问时连接被拒绝
+	hostport := strings.TrimPrefix(webURL, "http://")
+	for {
+		conn, err := net.DialTimeout("tcp", hostport, time.Second)
+		if err == nil {
+			conn.Close()
+			return webURL, outputClosed, nil
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case output := <-exited:
+			return "", nil, fmt.Errorf("'go tool pprof' exited before serving the web UI. Output: %s", output)
+		case <-timer.C:
+			return "", nil, fmt.Errorf("'go tool pprof' web UI at %s did not accept connections within %s", webURL, pprofStartTimeout)
+		case <-ctx.Done():
+			return "", nil, NewCanceledError("启动 pprof Web UI", ctx.Err())
+		}
+	}
+}
+
+// openBrowser 使用当前操作系统的默认方式在浏览器中打开 url：macOS 使用 open，Windows 使用 rundll32，其它系统使用 xdg-open
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// 打开器很快退出，回收进程避免僵尸进程
+	go cmd.Wait()
+	return nil
 }
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// TestPprofHTTPFlagAddress 测试端口 0 被转换为空端口，使 pprof 自己选择空闲端口并报告实际地址
+func TestPprofHTTPFlagAddress(t *testing.T) {
+	tests := map[string]string{
+		"localhost:0":    "localhost:",
+		"127.0.0.1:0":    "127.0.0.1:",
+		"[::1]:0":        "[::1]:",
+		":0":             ":",
+		"localhost:8080": "localhost:8080",
+		"localhost:":     "localhost:",
+		"localhost":      "localhost",
+	}
+	for in, want := range tests {
+		if got := pprofHTTPFlagAddress(in); got != want {
+			t.Errorf("pprofHTTPFlagAddress(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestWaitForPprofURL 测试从 pprof 的 stderr 中取出 Web UI 地址，等到地址可以连接后返回，并在 pprof 提前退出时返回它的输出
+func TestWaitForPprofURL(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	liveURL := "http://" + listener.Addr().String()
+
+	// 已关闭的监听地址不再接受连接
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadURL := "http://" + closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		stderr  string
+		wantURL string
+		wantErr []string
+	}{
+		{
+			name:    "serving",
+			stderr:  "Fetching profile over HTTP\nServing web UI on " + liveURL + "\nlater output\n",
+			wantURL: liveURL,
+		},
+		{
+			name:    "exited before serving",
+			stderr:  "failed to fetch profile\nunrecognized profile format\n",
+			wantErr: []string{"exited before serving the web UI", "failed to fetch profile\nunrecognized profile format"},
+		},
+		{
+			name:    "exited before accepting connections",
+			stderr:  "Serving web UI on " + deadURL + "\n",
+			wantErr: []string{"exited before serving the web UI"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webURL, exited, err := waitForPprofURL(context.Background(), strings.NewReader(tt.stderr))
+			if len(tt.wantErr) > 0 {
+				if err == nil || !containsAll(err.Error(), tt.wantErr...) {
+					t.Fatalf("waitForPprofURL() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("waitForPprofURL() error = %v", err)
+			}
+			if webURL != tt.wantURL {
+				t.Errorf("waitForPprofURL() = %q, want %q", webURL, tt.wantURL)
+			}
+			select {
+			case <-exited:
+			case <-time.After(5 * time.Second):
+				t.Error("exited channel should be closed once stderr reaches EOF")
+			}
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		reader, writer := io.Pipe()
+		defer writer.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, _, err := waitForPprofURL(ctx, reader); !isCanceled(err) {
+			t.Errorf("waitForPprofURL(canceled) error = %v, want a CANCELED error", err)
+		}
+	})
+}
+
+// TestOpenBrowser 用 PATH 中的假打开器测试 openBrowser 调用当前系统的打开命令并传入 URL，打开命令不存在时返回错误
+func TestOpenBrowser(t *testing.T) {
+	var opener string
+	switch runtime.GOOS {
+	case "darwin":
+		opener = "open"
+	case "linux", "freebsd", "openbsd", "netbsd":
+		opener = "xdg-open"
+	default:
+		t.Skipf("fake opener is a shell script, not supported on %s", runtime.GOOS)
+	}
+
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "opened")
+	script := "#!/bin/sh\necho \"$1\" > " + outPath + "\n"
+	if err := os.WriteFile(filepath.Join(dir, opener), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	const webURL = "http://localhost:53412"
+	if err := openBrowser(webURL); err != nil {
+		t.Fatalf("openBrowser() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(outPath)
+		if strings.TrimSpace(string(data)) == webURL {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was called with %q, want %q", opener, data, webURL)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if err := openBrowser(webURL); err == nil {
+		t.Errorf("openBrowser() without %s in PATH should fail", opener)
+	}
+}
+
+// startTestProcess 用 sh 启动一个测试子进程，并等到脚本输出第一行 (或退出) 后返回，使脚本中的 trap 在发送信号之前生效
+func startTestProcess(t *testing.T, script string) *os.Process {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", script)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start %q: %v", script, err)
+	}
+	bufio.NewReader(stdout).ReadString('\n')
+	return cmd.Process
+}
+
+// TestTerminatePprofProcess 测试先 Interrupt、超过等待时间后再 Kill 的终止顺序，以及进程已经退出时的结果
+func TestTerminatePprofProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("os.Interrupt is not supported on windows")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found in PATH")
+	}
+
+	t.Run("interrupt", func(t *testing.T) {
+		process := startTestProcess(t, "echo ready; exec sleep 30")
+		how, err := terminatePprofProcess(process, nil, 10*time.Second)
+		if err != nil || how != pprofTerminatedByInterrupt {
+			t.Errorf("terminatePprofProcess() = %q, %v, want %q", how, err, pprofTerminatedByInterrupt)
+		}
+	})
+
+	t.Run("kill after grace period", func(t *testing.T) {
+		// 忽略的信号在 exec 之后仍然被忽略，sleep 不会响应 Interrupt
+		process := startTestProcess(t, "trap '' INT; echo ready; exec sleep 30")
+		const grace = 200 * time.Millisecond
+		start := time.Now()
+		how, err := terminatePprofProcess(process, nil, grace)
+		if err != nil || how != pprofTerminatedByKill {
+			t.Errorf("terminatePprofProcess() = %q, %v, want %q", how, err, pprofTerminatedByKill)
+		}
+		if elapsed := time.Since(start); elapsed < grace || elapsed > 10*time.Second {
+			t.Errorf("terminatePprofProcess() took %s, want Kill shortly after the %s grace period", elapsed, grace)
+		}
+	})
+
+	t.Run("already exited", func(t *testing.T) {
+		process := startTestProcess(t, "exit 0")
+		exited := make(chan struct{})
+		close(exited)
+		how, err := terminatePprofProcess(process, exited, time.Second)
+		if err != nil || how != pprofAlreadyExited {
+			t.Errorf("terminatePprofProcess(exited channel closed) = %q, %v, want %q", how, err, pprofAlreadyExited)
+		}
+	})
+
+	t.Run("already reaped", func(t *testing.T) {
+		process := startTestProcess(t, "exit 0")
+		if _, err := process.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		how, err := terminatePprofProcess(process, nil, time.Second)
+		if err != nil || how != pprofAlreadyExited {
+			t.Errorf("terminatePprofProcess(reaped) = %q, %v, want %q", how, err, pprofAlreadyExited)
+		}
+	})
+}
+
+// TestListPprofSessions 测试会话按启动时间排序 (时间相同时按 PID)，list_pprof_sessions 的文本和结构化结果使用同样的顺序
+func TestListPprofSessions(t *testing.T) {
+	pprofMutex.Lock()
+	original := runningPprofs
+	runningPprofs = make(map[int]*pprofSession)
+	pprofMutex.Unlock()
+	t.Cleanup(func() {
+		pprofMutex.Lock()
+		runningPprofs = original
+		pprofMutex.Unlock()
+	})
+
+	result, structured, err := handleListPprofSessions(context.Background(), nil, ListPprofSessionsArgs{})
+	if err != nil {
+		t.Fatalf("handleListPprofSessions() error = %v", err)
+	}
+	if list := structured.(pprofSessionList); len(list.Sessions) != 0 || !strings.Contains(result.Content[0].(*mcp.TextContent).Text, "没有正在运行的 pprof 会话") {
+		t.Errorf("handleListPprofSessions() without sessions = %+v", list)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, s := range []pprofSession{
+		{PID: 300, URL: "http://localhost:3", ProfileURI: "c.pprof", StartedAt: base.Add(2 * time.Minute)},
+		{PID: 200, URL: "http://localhost:2", ProfileURI: "b.pprof", StartedAt: base},
+		{PID: 100, URL: "http://localhost:1", ProfileURI: "a.pprof", StartedAt: base},
+		{PID: 400, URL: "http://localhost:4", ProfileURI: "d.pprof", StartedAt: base.Add(time.Minute)},
+	} {
+		session := s
+		runningPprofs[session.PID] = &session
+	}
+
+	sessions := listPprofSessions()
+	var pids []int
+	for _, s := range sessions {
+		pids = append(pids, s.PID)
+	}
+	if want := []int{100, 200, 400, 300}; !slices.Equal(pids, want) {
+		t.Errorf("listPprofSessions() PIDs = %v, want %v", pids, want)
+	}
+	// 返回的是副本，修改它不影响正在跟踪的会话
+	sessions[0].URL = "changed"
+	if runningPprofs[100].URL != "http://localhost:1" {
+		t.Error("listPprofSessions() should return copies of the sessions")
+	}
+
+	result, structured, err = handleListPprofSessions(context.Background(), nil, ListPprofSessionsArgs{})
+	if err != nil {
+		t.Fatalf("handleListPprofSessions() error = %v", err)
+	}
+	if list := structured.(pprofSessionList); len(list.Sessions) != 4 || list.Sessions[0].PID != 100 || list.Sessions[3].PID != 300 {
+		t.Errorf("handleListPprofSessions() structured sessions = %+v", list.Sessions)
+	}
+	text := result.Content[0].(*mcp.TextContent).Text
+	if !strings.Contains(text, "(4 个)") {
+		t.Errorf("Expected the session count in:\n%s", text)
+	}
+	last := -1
+	for _, profileURI := range []string{"a.pprof", "b.pprof", "d.pprof", "c.pprof"} {
+		i := strings.Index(text, profileURI)
+		if i <= last {
+			t.Fatalf("Expected sessions in start order, %s is out of place:\n%s", profileURI, text)
+		}
+		last = i
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// defaultProfileCacheSize 是未设置 PPROF_CACHE_SIZE 时缓存的已解析 profile 数量
+const defaultProfileCacheSize = 8
+
+// profileCacheEntry 是缓存中的一个已解析 profile，以及判断它是否仍然有效所需的信息
+type profileCacheEntry struct {
+	uri          string
+	fileStamp    string // 本地文件的修改时间和大小
+	etag         string // HTTP 响应的 ETag
+	lastModified string // HTTP 响应的 Last-Modified
+	prof         *profile.Profile
+}
+
+// profileLoad 是对同一 URI 正在进行的一次加载，并发的请求等待这次加载的结果而不是重复下载
+type profileLoad struct {
+	done chan struct{}
+	prof *profile.Profile
+	err  error
+}
+
+// profileCache 是按 URI 缓存已解析 profile 的 LRU 缓存。
+// 本地文件按修改时间和大小、HTTP 下载按 ETag/Last-Modified (条件请求) 判断缓存是否有效；
+// 实时采集的 /debug/pprof/ 端点和 grpc:// 每次都是新的采集，不会缓存，只合并并发的请求。
+type profileCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // 元素为 *profileCacheEntry，最近使用的在前
+	entries  map[string]*list.Element
+	inflight map[string]*profileLoad
+}
+
+// profileCacheInstance 是加载 profile 时使用的全局缓存，大小由环境变量 PPROF_CACHE_SIZE 设置 (0 表示禁用)
+var profileCacheInstance = newProfileCache(profileCacheSizeFromEnv())
+
+// newProfileCache 创建一个最多保存 capacity 个 profile 的缓存
+func newProfileCache(capacity int) *profileCache {
+	return &profileCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		inflight: make(map[string]*profileLoad),
+	}
+}
+
+// profileCacheSizeFromEnv 读取 PPROF_CACHE_SIZE，未设置或无效时使用 defaultProfileCacheSize
+func profileCacheSizeFromEnv() int {
+	value := strings.TrimSpace(os.Getenv("PPROF_CACHE_SIZE"))
+	if value == "" {
+		return defaultProfileCacheSize
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		logWarn("invalid PPROF_CACHE_SIZE '%s', using default %d", value, defaultProfileCacheSize)
+		return defaultProfileCacheSize
+	}
+	return size
+}
+
+// loadProfile 获取并解析 uri 指向的 profile，优先使用缓存。noCache 为 true 或缓存被禁用时总是重新获取。
+// 缓存中的 profile 可能被多个调用方使用，因此总是返回一份副本，调用方可以任意修改。
+// ctx 被取消时下载立即中止，等待其它调用方加载结果的请求也会立即返回 CANCELED 错误。
+func loadProfile(ctx context.Context, uriStr string, noCache bool) (*profile.Profile, error) {
+	if noCache || profileCacheInstance.capacity == 0 {
+		return fetchAndParseProfile(ctx, uriStr)
+	}
+	return profileCacheInstance.load(ctx, uriStr)
+}
+
+// load 从缓存加载 profile；同一 URI 已有加载正在进行时等待它的结果
+func (c *profileCache) load(ctx context.Context, uriStr string) (*profile.Profile, error) {
+	c.mu.Lock()
+	if l, ok := c.inflight[uriStr]; ok {
+		c.mu.Unlock()
+		logDebug("Waiting for in-flight load of profile %s", uriStr)
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return nil, NewCanceledError(fmt.Sprintf("加载 profile '%s'", uriStr), ctx.Err())
+		}
+		if l.err != nil {
+			// 发起加载的请求被取消不代表本次请求也被取消，重新加载
+			if isCanceled(l.err) && ctx.Err() == nil {
+				return c.load(ctx, uriStr)
+			}
+			return nil, l.err
+		}
+		return l.prof.Copy(), nil
+	}
+	l := &profileLoad{done: make(chan struct{})}
+	c.inflight[uriStr] = l
+	var cached *profileCacheEntry
+	if elem, ok := c.entries[uriStr]; ok {
+		cached = elem.Value.(*profileCacheEntry)
+	}
+	c.mu.Unlock()
+
+	l.prof, l.err = c.fetch(ctx, uriStr, cached)
+
+	c.mu.Lock()
+	delete(c.inflight, uriStr)
+	c.mu.Unlock()
+	close(l.done)
+
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.prof.Copy(), nil
+}
+
+// fetch 在缓存的 profile 仍然有效时直接返回它，否则重新获取并解析，能够校验有效性的 profile 写入缓存
+func (c *profileCache) fetch(ctx context.Context, uriStr string, cached *profileCacheEntry) (*profile.Profile, error) {
+	if path, ok := localProfilePath(uriStr); ok {
+		info, err := os.Stat(path)
+		if err != nil {
+			// 由 getProfileAsFile 和打开文件给出原有的错误
+			return fetchAndParseProfile(ctx, uriStr)
+		}
+		stamp := fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+		if cached != nil && cached.fileStamp == stamp {
+			logDebug("Using cached profile for %s", uriStr)
+			c.store(cached)
+			return cached.prof, nil
+		}
+		prof, err := fetchAndParseProfile(ctx, uriStr)
+		if err != nil {
+			return nil, err
+		}
+		c.store(&profileCacheEntry{uri: uriStr, fileStamp: stamp, prof: prof})
+		return prof, nil
+	}
+
+	parsedURI, err := url.Parse(uriStr)
+	if err != nil || (parsedURI.Scheme != "http" && parsedURI.Scheme != "https") || strings.Contains(parsedURI.Path, "/debug/pprof/") {
+		return fetchAndParseProfile(ctx, uriStr)
+	}
+	var etag, lastModified string
+	if cached != nil {
+		etag, lastModified = cached.etag, cached.lastModified
+	}
+	download, err := downloadHTTPProfile(ctx, uriStr, parsedURI, etag, lastModified)
+	if err != nil {
+		return nil, err
+	}
+	if download.NotModified {
+		logDebug("Profile %s not modified, using cached profile", uriStr)
+		c.store(cached)
+		return cached.prof, nil
+	}
+	defer download.Cleanup()
+	prof, err := parseProfileFile(download.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	// 没有 ETag 和 Last-Modified 的响应无法判断之后是否变化，不缓存
+	if download.ETag != "" || download.LastModified != "" {
+		c.store(&profileCacheEntry{uri: uriStr, etag: download.ETag, lastModified: download.LastModified, prof: prof})
+	}
+	return prof, nil
+}
+
+// store 写入或刷新缓存条目并将其标记为最近使用，超出容量时淘汰最久未使用的条目
+func (c *profileCache) store(entry *profileCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.uri]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.uri] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*profileCacheEntry).uri)
+	}
+}
+
+// localProfilePath 返回本地路径或 file:// URI 对应的文件路径，其它 URI 返回 false
+func localProfilePath(uriStr string) (string, bool) {
+	if isStdinURI(uriStr) {
+		return "", false
+	}
+	if !strings.Contains(uriStr, "://") {
+		absPath, err := filepath.Abs(uriStr)
+		if err != nil {
+			return "", false
+		}
+		return absPath, true
+	}
+	parsedURI, err := url.Parse(uriStr)
+	if err != nil || parsedURI.Scheme != "file" || parsedURI.Path == "" {
+		return "", false
+	}
+	return parsedURI.Path, true
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// newCacheTestProfile 构造只有一个 CPU 样本的 profile，用样本值区分不同版本
+func newCacheTestProfile(value int64) *profile.Profile {
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	cpuType := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{cpuType},
+		PeriodType: cpuType,
+		Period:     1,
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{value}}},
+	}
+}
+
+// cachedProfile 返回缓存中 uri 对应的 profile，不存在时返回 nil
+func cachedProfile(c *profileCache, uri string) *profile.Profile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[uri]; ok {
+		return elem.Value.(*profileCacheEntry).prof
+	}
+	return nil
+}
+
+// TestProfileCacheLocalFileRevalidation 测试本地文件的修改时间和大小不变时使用缓存，文件变化后重新解析
+func TestProfileCacheLocalFileRevalidation(t *testing.T) {
+	c := newProfileCache(4)
+	path := writeTestProfile(t, newCacheTestProfile(100))
+
+	first, err := c.load(context.Background(), path)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	cached := cachedProfile(c, path)
+	if cached == nil || cached == first {
+		t.Fatal("load() should cache the profile and return a copy of it")
+	}
+	if _, err := c.load(context.Background(), path); err != nil {
+		t.Fatalf("second load() error = %v", err)
+	}
+	if cachedProfile(c, path) != cached {
+		t.Error("unchanged file should be served from the cache")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newCacheTestProfile(200).Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := c.load(context.Background(), path)
+	if err != nil {
+		t.Fatalf("load() after modification error = %v", err)
+	}
+	if got := updated.Sample[0].Value[0]; got != 200 {
+		t.Errorf("load() after modification returned sample value %d, want 200", got)
+	}
+}
+
+// TestProfileCacheHTTPRevalidation 测试 HTTP 下载用 If-None-Match 条件请求校验缓存，304 时使用缓存，ETag 变化后重新下载
+func TestProfileCacheHTTPRevalidation(t *testing.T) {
+	var mu sync.Mutex
+	etag, value := `"v1"`, int64(100)
+	var fullResponses, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		var buf bytes.Buffer
+		if err := newCacheTestProfile(value).Write(&buf); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	c := newProfileCache(4)
+	uri := server.URL + "/cpu.pprof"
+	for i := 0; i < 2; i++ {
+		prof, err := c.load(context.Background(), uri)
+		if err != nil {
+			t.Fatalf("load() #%d error = %v", i+1, err)
+		}
+		if got := prof.Sample[0].Value[0]; got != 100 {
+			t.Errorf("load() #%d returned sample value %d, want 100", i+1, got)
+		}
+	}
+	if fullResponses != 1 || notModified != 1 {
+		t.Errorf("expected 1 full download and 1 not-modified response, got %d and %d", fullResponses, notModified)
+	}
+
+	mu.Lock()
+	etag, value = `"v2"`, 200
+	mu.Unlock()
+	prof, err := c.load(context.Background(), uri)
+	if err != nil {
+		t.Fatalf("load() after ETag change error = %v", err)
+	}
+	if got := prof.Sample[0].Value[0]; got != 200 || fullResponses != 2 {
+		t.Errorf("load() after ETag change returned sample value %d with %d full downloads, want 200 and 2", got, fullResponses)
+	}
+}
+
+// TestProfileCacheCoalescesInflightLoads 测试同一 URI 正在加载时，并发的请求等待这次加载的结果并各自得到一份副本
+func TestProfileCacheCoalescesInflightLoads(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		newCacheTestProfile(100).Write(w)
+	}))
+	defer server.Close()
+
+	c := newProfileCache(4)
+	uri := server.URL + "/debug/pprof/heap"
+	const loaders = 5
+	results := make([]*profile.Profile, loaders)
+	errs := make([]error, loaders)
+	var wg sync.WaitGroup
+	for i := 0; i < loaders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = c.load(context.Background(), uri)
+		}(i)
+	}
+	// 第一个请求到达服务端后等待其余请求加入正在进行的加载
+	for atomic.LoadInt32(&requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected concurrent loads to share 1 request, got %d", got)
+	}
+	for i := 0; i < loaders; i++ {
+		if errs[i] != nil {
+			t.Fatalf("load() #%d error = %v", i, errs[i])
+		}
+		for j := 0; j < i; j++ {
+			if results[i] == results[j] {
+				t.Errorf("loads #%d and #%d returned the same profile instead of copies", j, i)
+			}
+		}
+	}
+	if cachedProfile(c, uri) != nil {
+		t.Error("live /debug/pprof/ profiles should not be cached")
+	}
+}
+
+// TestProfileCacheInflightCanceled 测试发起加载的请求被取消时，仍然有效的等待方重新加载，而自身被取消的等待方返回 CANCELED 错误
+func TestProfileCacheInflightCanceled(t *testing.T) {
+	c := newProfileCache(4)
+	path := writeTestProfile(t, newCacheTestProfile(100))
+	l := &profileLoad{done: make(chan struct{})}
+	c.inflight[path] = l
+
+	waiterCtx, cancelWaiter := context.WithCancel(context.Background())
+	cancelWaiter()
+	if _, err := c.load(waiterCtx, path); !isCanceled(err) {
+		t.Errorf("canceled waiter: expected a CANCELED error, got %v", err)
+	}
+
+	var prof *profile.Profile
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		prof, err = c.load(context.Background(), path)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.mu.Lock()
+	l.err = NewCanceledError("加载 profile", context.Canceled)
+	delete(c.inflight, path)
+	c.mu.Unlock()
+	close(l.done)
+	<-done
+
+	if err != nil {
+		t.Fatalf("live waiter should reload after the initiating load was canceled, got %v", err)
+	}
+	if got := prof.Sample[0].Value[0]; got != 100 {
+		t.Errorf("reloaded profile has sample value %d, want 100", got)
+	}
+}
+
+// TestProfileCacheLRUEviction 测试超出容量时淘汰最久未使用的条目，使用过的条目被刷新为最近使用
+func TestProfileCacheLRUEviction(t *testing.T) {
+	c := newProfileCache(2)
+	for _, uri := range []string{"a", "b", "a", "c"} {
+		c.store(&profileCacheEntry{uri: uri, prof: newCacheTestProfile(1)})
+	}
+	for uri, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if got := cachedProfile(c, uri) != nil; got != want {
+			t.Errorf("entry %q cached = %t, want %t", uri, got, want)
+		}
+	}
+	if c.order.Len() != 2 {
+		t.Errorf("cache holds %d entries, want 2", c.order.Len())
+	}
+}
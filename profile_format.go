@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// profileSniffBytes 是判断 profile 格式时读取的文件头长度
+const profileSniffBytes = 512
+
+// legacyTextPrefixes 是 Go runtime 旧版文本格式 profile 的开头
+var legacyTextPrefixes = []string{"heap profile:", "goroutine profile:", "--- contention:", "--- mutex:", "--- heapz", "threadcreate profile:"}
+
+// perfDataMagics 是 Linux perf.data 文件开头的 magic：小端和大端机器写出的 "PERFILE2"，以及旧版本的 "PERFFILE"
+var perfDataMagics = [][]byte{[]byte("PERFILE2"), []byte("2ELIFREP"), []byte("PERFFILE")}
+
+// perfDataFormat 是 perf.data 的格式名称，perfDataHint 是无法自动转换时给用户的提示
+const (
+	perfDataFormat = "Linux perf.data"
+	perfDataHint   = "perf.data 需要先转换为 pprof 格式：安装 perf_data_converter (https://github.com/google/perf_data_converter) 提供的 perf_to_profile 并加入 PATH 后会自动转换 (与 go tool pprof 的做法相同)，" +
+		"或者手动运行 'perf_to_profile -i perf.data -o perf.pb.gz -f' 后分析生成的文件。"
+)
+
+// profileFormat 描述从文件头推断出的 profile 格式，以及解析失败时可能的原因
+type profileFormat struct {
+	Name string // 格式名称
+	Hint string // 解析失败时给用户的提示
+}
+
+// detectProfileFormat 读取文件开头的字节，判断文件是 gzip 压缩的 protobuf、未压缩的 protobuf、
+// 旧版文本格式，还是明显不是 profile 的内容 (例如 pprof URL 返回的 HTML 错误页面)。
+func detectProfileFormat(path string) profileFormat {
+	file, err := os.Open(path)
+	if err != nil {
+		return profileFormat{Name: "未知", Hint: "无法读取文件以判断格式。"}
+	}
+	defer file.Close()
+
+	head := make([]byte, profileSniffBytes)
+	n, _ := io.ReadFull(file, head)
+	head = head[:n]
+	trimmed := bytes.TrimSpace(head)
+	lower := bytes.ToLower(trimmed)
+
+	switch {
+	case n == 0:
+		return profileFormat{Name: "空文件", Hint: "文件为空，下载或采集可能没有完成。"}
+	case hasPerfDataMagic(head):
+		return profileFormat{Name: perfDataFormat, Hint: perfDataHint}
+	case len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b:
+		if _, err := file.Seek(0, io.SeekStart); err == nil {
+			if gz, err := gzip.NewReader(file); err == nil {
+				_, err = io.Copy(io.Discard, gz)
+				if err != nil {
+					return profileFormat{Name: "gzip 压缩的 protobuf", Hint: "gzip 数据不完整，文件可能被截断 (例如下载或采集中断)。"}
+				}
+			}
+		}
+		return profileFormat{Name: "gzip 压缩的 protobuf", Hint: "解压后的 protobuf 数据已损坏或不是 pprof profile。"}
+	case bytes.HasPrefix(lower, []byte("<!doctype html")) || bytes.HasPrefix(lower, []byte("<html")) || bytes.Contains(lower, []byte("<body")):
+		return profileFormat{Name: "HTML 页面", Hint: "这是一个 HTML 页面而不是 profile，pprof URL 很可能返回了错误页面 (例如 HTTP 500) 或登录页。"}
+	case bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")):
+		return profileFormat{Name: "JSON", Hint: "这是 JSON 内容而不是 profile，可能是 API 的错误响应或其它工具的输出。"}
+	}
+	for _, prefix := range legacyTextPrefixes {
+		if bytes.HasPrefix(trimmed, []byte(prefix)) {
+			return profileFormat{Name: "旧版文本格式", Hint: "文本格式的 profile 内容不完整或包含无法识别的行。"}
+		}
+	}
+	if utf8.Valid(head) && !bytes.ContainsRune(head, 0) {
+		return profileFormat{Name: "纯文本", Hint: "文件是纯文本，不是 pprof 格式 (protobuf 或 Go 的旧版文本格式)。"}
+	}
+	return profileFormat{Name: "未压缩的 protobuf", Hint: "protobuf 数据已损坏、被截断或不是 pprof profile。"}
+}
+
+// newProfileParseError 在 profile.Parse 失败后检测文件格式，返回说明检测到的格式和失败原因的解析错误
+func newProfileParseError(path string, err error) error {
+	format := detectProfileFormat(path)
+	return NewParseFailedError(path, format.Name, format.Hint, err)
+}
+
+// hasPerfDataMagic 判断文件头是否以 perf.data 的 magic 开头
+func hasPerfDataMagic(head []byte) bool {
+	for _, magic := range perfDataMagics {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPerfDataFile 判断 path 处的文件是否是 Linux perf.data
+func isPerfDataFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, len(perfDataMagics[0]))
+	n, _ := io.ReadFull(file, head)
+	return hasPerfDataMagic(head[:n])
+}
+
+// convertPerfData 使用 PATH 中的 perf_to_profile 将 path 处的 perf.data 转换为临时的 pprof 文件，返回临时文件路径和清理函数。
+// go tool pprof 读取 perf.data 时同样依赖 perf_to_profile；找不到它或转换失败时返回说明如何手动转换的 PARSE_FAILED 错误。
+func convertPerfData(ctx context.Context, path string) (string, func(), error) {
+	converter, err := exec.LookPath("perf_to_profile")
+	if err != nil {
+		return "", nil, NewParseFailedError(path, perfDataFormat, "未在 PATH 中找到 perf_to_profile。"+perfDataHint, nil)
+	}
+
+	tmpFile, err := os.CreateTemp("", "pprof-perf-*.pb.gz")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpFile.Close()
+	cleanup := func() {
+		if err := os.Remove(tmpFile.Name()); err != nil && !os.IsNotExist(err) {
+			logWarn("failed to remove temporary file '%s': %v", tmpFile.Name(), err)
+		}
+	}
+
+	logInfo("Converting perf.data %s to pprof format with %s", path, converter)
+	// -f 允许覆盖刚创建的临时文件
+	output, err := exec.CommandContext(ctx, converter, "-i", path, "-o", tmpFile.Name(), "-f").CombinedOutput()
+	if err != nil {
+		cleanup()
+		if ctx.Err() != nil {
+			return "", nil, NewCanceledError(fmt.Sprintf("转换 perf.data '%s'", path), ctx.Err())
+		}
+		return "", nil, NewParseFailedError(path, perfDataFormat,
+			fmt.Sprintf("perf_to_profile 转换失败: %s。%s", strings.TrimSpace(string(output)), perfDataHint), err)
+	}
+	return tmpFile.Name(), cleanup, nil
+}
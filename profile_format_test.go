@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDetectProfileFormat 测试按文件头识别 gzip/未压缩的 protobuf、旧版文本格式以及明显不是 profile 的内容
+func TestDetectProfileFormat(t *testing.T) {
+	var gzipped, uncompressed bytes.Buffer
+	if err := newCacheTestProfile(100).Write(&gzipped); err != nil {
+		t.Fatal(err)
+	}
+	if err := newCacheTestProfile(100).WriteUncompressed(&uncompressed); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		wantName string
+		wantHint string
+	}{
+		{name: "gzip", content: gzipped.Bytes(), wantName: "gzip 压缩的 protobuf", wantHint: "解压后的 protobuf 数据已损坏"},
+		{name: "truncated gzip", content: gzipped.Bytes()[:gzipped.Len()/2], wantName: "gzip 压缩的 protobuf", wantHint: "文件可能被截断"},
+		{name: "uncompressed proto", content: uncompressed.Bytes(), wantName: "未压缩的 protobuf", wantHint: "protobuf 数据已损坏"},
+		{name: "legacy heap text", content: []byte("heap profile: 1: 2048 [3: 4096] @ heap/1048576\n1: 2048 [3: 4096] @ 0x1\n"), wantName: "旧版文本格式"},
+		{name: "legacy contention text", content: []byte("--- contention:\ncycles/second=1000\n"), wantName: "旧版文本格式"},
+		{name: "perf.data", content: append([]byte("PERFILE2"), make([]byte, 64)...), wantName: perfDataFormat, wantHint: "perf_to_profile"},
+		{name: "html error page", content: []byte("  <!DOCTYPE html><html><body>500 Internal Server Error</body></html>"), wantName: "HTML 页面"},
+		{name: "json", content: []byte(`{"error": "unauthorized"}`), wantName: "JSON"},
+		{name: "plain text", content: []byte("hello, this is not a profile\n"), wantName: "纯文本"},
+		{name: "empty", content: nil, wantName: "空文件"},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.Repeat("f", i+1))
+			if err := os.WriteFile(path, tt.content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got := detectProfileFormat(path)
+			if got.Name != tt.wantName {
+				t.Errorf("detectProfileFormat() name = %q, want %q", got.Name, tt.wantName)
+			}
+			if !strings.Contains(got.Hint, tt.wantHint) {
+				t.Errorf("detectProfileFormat() hint = %q, want it to contain %q", got.Hint, tt.wantHint)
+			}
+		})
+	}
+
+	if got := detectProfileFormat(filepath.Join(dir, "missing.pprof")); got.Name != "未知" {
+		t.Errorf("detectProfileFormat(missing file) name = %q, want %q", got.Name, "未知")
+	}
+}
+
+// TestNewProfileParseError 测试解析错误是 PARSE_FAILED，说明检测到的格式和原因，并保留原始错误
+func TestNewProfileParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "error.html")
+	if err := os.WriteFile(path, []byte("<html><body>502 Bad Gateway</body></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	parseErr := errors.New("parsing profile: unrecognized profile format")
+
+	err := newProfileParseError(path, parseErr)
+	var appErr *AppError
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeParseFailed {
+		t.Fatalf("newProfileParseError() = %v, want a %s error", err, ErrCodeParseFailed)
+	}
+	if !errors.Is(err, parseErr) {
+		t.Error("newProfileParseError() should wrap the original parse error")
+	}
+	if !containsAll(appErr.Message, path, "检测到的格式: HTML 页面", "pprof URL 很可能返回了错误页面") {
+		t.Errorf("Unexpected message: %s", appErr.Message)
+	}
+}
@@ -1,32 +1,115 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	// liveProfileTimeoutMargin 是从 /debug/pprof/ 实时采集 profile 时在采集时长之外额外允许的时间
+	liveProfileTimeoutMargin = 15 * time.Second
+	// defaultLiveProfileSeconds 是 net/http/pprof 在未指定 seconds 时的 CPU profile / trace 采集时长
+	defaultLiveProfileSeconds = 30
+	// defaultMaxDownloadBytes 是未设置 PPROF_MAX_DOWNLOAD_BYTES 时单个远程 profile 允许下载的最大字节数
+	defaultMaxDownloadBytes = 256 << 20
+	// defaultHTTPTimeout 是未设置 PPROF_HTTP_TIMEOUT 时下载远程 profile 的 HTTP 超时时间
+	defaultHTTPTimeout = 2 * time.Minute
 )
 
+var (
+	// maxDownloadBytes 是单个远程 profile 允许下载的最大字节数，由环境变量 PPROF_MAX_DOWNLOAD_BYTES 设置
+	maxDownloadBytes = maxDownloadBytesFromEnv()
+	// httpTimeout 是下载远程 profile 的 HTTP 超时时间 (包括读取响应体)，由环境变量 PPROF_HTTP_TIMEOUT 设置
+	httpTimeout = httpTimeoutFromEnv()
+)
+
+// maxDownloadBytesFromEnv 读取 PPROF_MAX_DOWNLOAD_BYTES，未设置或无效时使用 defaultMaxDownloadBytes
+func maxDownloadBytesFromEnv() int64 {
+	value := strings.TrimSpace(os.Getenv("PPROF_MAX_DOWNLOAD_BYTES"))
+	if value == "" {
+		return defaultMaxDownloadBytes
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		logWarn("invalid PPROF_MAX_DOWNLOAD_BYTES '%s', using default %d", value, defaultMaxDownloadBytes)
+		return defaultMaxDownloadBytes
+	}
+	return size
+}
+
+// httpTimeoutFromEnv 读取 PPROF_HTTP_TIMEOUT (Go duration 如 "90s"，或秒数)，未设置或无效时使用 defaultHTTPTimeout
+func httpTimeoutFromEnv() time.Duration {
+	value := strings.TrimSpace(os.Getenv("PPROF_HTTP_TIMEOUT"))
+	if value == "" {
+		return defaultHTTPTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.ParseFloat(value, 64)
+		if convErr != nil {
+			timeout = 0
+		} else {
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	if timeout <= 0 {
+		logWarn("invalid PPROF_HTTP_TIMEOUT '%s', using default %s", value, defaultHTTPTimeout)
+		return defaultHTTPTimeout
+	}
+	return timeout
+}
+
 // getProfileAsFile 获取 profile 文件。
-// - 如果输入不包含 "://", 则视为本地文件路径（相对或绝对）。
-// - 如果是 file:// URI，直接使用其路径。
-// - 如果是 http:// 或 https:// URI，下载到临时文件并返回其路径。
+//   - 如果输入不包含 "://", 则视为本地文件路径（相对或绝对）。
+//   - 如果是 file:// URI，直接使用其路径。
+//   - 如果是 http:// 或 https:// URI，下载到临时文件并返回其路径。下载大小不能超过 maxDownloadBytes，HTTP 超时为 httpTimeout；
+//     路径包含 /debug/pprof/ 时视为从运行中的服务实时采集，HTTP 超时按 seconds 查询参数 (见 liveProfileTimeout) 设置为至少略长于采集时长。
+//   - 如果是 grpc:// URI，调用服务的 profiling RPC (约定见 defaultGRPCProfileMethod)，保存到临时文件并返回其路径。
+//   - 如果是 s3:// 或 gs:// URI，从对象存储下载到临时文件并返回其路径 (凭证读取方式见 object_storage.go)，下载限制与 HTTP 相同。
+//   - "-" 和 "stdin:" 表示标准输入，会被明确拒绝 (见 isStdinURI)。
+//   - 取得的文件是 Linux perf.data 时，用 perf_to_profile 转换为 pprof 格式的临时文件 (见 convertPerfData)，无法转换时返回 PARSE_FAILED 错误。
+//
 // 返回最终的文件路径、一个用于清理临时文件的函数（如果创建了临时文件）以及错误。
-func getProfileAsFile(uriStr string) (filePath string, cleanup func(), err error) {
+func getProfileAsFile(ctx context.Context, uriStr string) (filePath string, cleanup func(), err error) {
+	filePath, cleanup, err = fetchProfileFile(ctx, uriStr)
+	if err != nil || !isPerfDataFile(filePath) {
+		return filePath, cleanup, err
+	}
+	// 转换后原始的 perf.data 不再需要，下载的临时文件随即删除
+	defer cleanup()
+	return convertPerfData(ctx, filePath)
+}
+
+// fetchProfileFile 按 URI 协议取得 profile 文件，规则见 getProfileAsFile
+func fetchProfileFile(ctx context.Context, uriStr string) (filePath string, cleanup func(), err error) {
 	cleanup = func() {} // 默认清理函数为空操作
 
+	if isStdinURI(uriStr) {
+		return "", nil, NewInvalidArgumentError(fmt.Sprintf("profile_uri '%s' refers to stdin, which cannot be used: this server talks to the MCP client over the stdio transport, so stdin carries JSON-RPC messages rather than profile data. Save the profile to a file first (e.g. curl -o /tmp/cpu.pprof ...) and pass its path", uriStr))
+	}
+
 	// 检查输入是否包含协议头，如果没有，则假定为本地文件路径
 	if !strings.Contains(uriStr, "://") {
-		log.Printf("Input '%s' does not contain '://', treating as local file path.", uriStr)
+		logDebug("Input '%s' does not contain '://', treating as local file path.", uriStr)
 		absPath, err := filepath.Abs(uriStr)
 		if err != nil {
 			return "", nil, fmt.Errorf("failed to get absolute path for '%s': %w", uriStr, err)
 		}
-		log.Printf("Using absolute local path: %s", absPath)
+		logDebug("Using absolute local path: %s", absPath)
 		// 可以在这里添加 os.Stat 检查文件是否存在且可读
 		// _, statErr := os.Stat(absPath)
 		// if statErr != nil {
@@ -47,53 +130,328 @@ func getProfileAsFile(uriStr string) (filePath string, cleanup func(), err error
 		if filePath == "" {
 			return "", nil, fmt.Errorf("invalid file path derived from URI '%s'", uriStr)
 		}
-		log.Printf("Using local profile file: %s", filePath)
+		logDebug("Using local profile file: %s", filePath)
 		return filePath, cleanup, nil
 
 	case "http", "https":
-		log.Printf("Attempting to download profile from URL: %s", uriStr)
-		resp, err := http.Get(uriStr)
+		download, err := downloadHTTPProfile(ctx, uriStr, parsedURI, "", "")
 		if err != nil {
-			return "", nil, fmt.Errorf("failed to download profile from '%s': %w", uriStr, err)
+			return "", nil, err
 		}
-		defer resp.Body.Close()
+		return download.FilePath, download.Cleanup, nil
 
-		if resp.StatusCode != http.StatusOK {
-			return "", nil, fmt.Errorf("failed to download profile from '%s': received status code %d", uriStr, resp.StatusCode)
-		}
+	case "grpc":
+		return fetchGRPCProfile(ctx, parsedURI)
+
+	case "s3", "gs":
+		return fetchObjectStorageProfile(ctx, parsedURI)
+
+	default:
+		return "", nil, fmt.Errorf("unsupported URI scheme '%s', only 'file://', 'http://', 'https://', 'grpc://', 's3://', 'gs://', or a plain local path are supported", parsedURI.Scheme)
+	}
+}
 
-		// 创建临时文件来存储下载的内容
-		tempFile, err := os.CreateTemp("", "pprof-*") // 使用通用模式
+// httpDownload 是一次 HTTP profile 下载的结果
+type httpDownload struct {
+	FilePath     string
+	Cleanup      func() // 删除临时文件
+	ETag         string // 响应的 ETag，用于之后的条件请求
+	LastModified string // 响应的 Last-Modified，用于之后的条件请求
+	NotModified  bool   // 服务端对条件请求返回 304，没有下载内容 (FilePath 为空)
+}
+
+// downloadHTTPProfile 将 http:// 或 https:// URI 指向的 profile 下载到临时文件。路径包含 /debug/pprof/ 时视为实时采集，
+// HTTP 超时按 seconds 查询参数设置 (不短于 httpTimeout)。响应超过 maxDownloadBytes 时返回 DOWNLOAD_FAILED 错误，失败时删除已写入的临时文件。
+// etag 或 lastModified 不为空时发送条件请求，服务端返回 304 时 NotModified 为 true。
+// ctx 被取消时请求立即中止并返回 CANCELED 错误，不计入熔断。
+func downloadHTTPProfile(ctx context.Context, uriStr string, parsedURI *url.URL, etag, lastModified string) (*httpDownload, error) {
+	host := parsedURI.Host
+	if ok, retryAfter := remoteBreaker.allow(host); !ok {
+		logWarn("Circuit breaker open for host %s, failing fast (retry after %s)", host, retryAfter)
+		return nil, NewSourceUnavailableError(host, retryAfter)
+	}
+
+	client := &http.Client{Timeout: httpTimeout}
+	if strings.Contains(parsedURI.Path, "/debug/pprof/") {
+		timeout, err := liveProfileTimeout(parsedURI)
 		if err != nil {
-			return "", nil, fmt.Errorf("failed to create temporary file for download: %w", err)
+			return nil, err
 		}
-		filePath = tempFile.Name()
-		log.Printf("Downloading profile to temporary file: %s", filePath)
-
-		// 定义清理函数，用于删除临时文件
-		cleanup = func() {
-			log.Printf("Cleaning up temporary file: %s", filePath)
-			err := os.Remove(filePath)
-			if err != nil && !os.IsNotExist(err) {
-				log.Printf("Warning: failed to remove temporary file '%s': %v", filePath, err)
-			}
+		if timeout > client.Timeout {
+			client.Timeout = timeout
+		}
+		logInfo("Fetching live profile from pprof endpoint: %s (timeout %s)", uriStr, client.Timeout)
+	} else {
+		logInfo("Attempting to download profile from URL: %s (timeout %s)", uriStr, client.Timeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uriStr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile URI '%s': %w", uriStr, err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	return doProfileDownload(ctx, client, req, uriStr, host, etag != "" || lastModified != "")
+}
+
+// doProfileDownload 发送 req 并将响应写入临时文件，host 用于熔断统计。conditional 为 true 时 304 响应视为未修改。
+// 下载大小受 maxDownloadBytes 限制，失败时删除已写入的临时文件。
+func doProfileDownload(ctx context.Context, client *http.Client, req *http.Request, uriStr, host string, conditional bool) (*httpDownload, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, NewCanceledError(fmt.Sprintf("下载 profile '%s'", uriStr), ctx.Err())
 		}
+		remoteBreaker.recordFailure(host)
+		return nil, fmt.Errorf("failed to download profile from '%s': %w", uriStr, err)
+	}
+	defer resp.Body.Close()
 
-		_, err = io.Copy(tempFile, resp.Body)
-		closeErr := tempFile.Close()
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		remoteBreaker.recordSuccess(host)
+		return &httpDownload{NotModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		// 只有服务端错误才计入熔断，4xx 通常是 URL 本身有误
+		if resp.StatusCode >= http.StatusInternalServerError {
+			remoteBreaker.recordFailure(host)
+		}
+		return nil, fmt.Errorf("failed to download profile from '%s': received status code %d", uriStr, resp.StatusCode)
+	}
+	if resp.ContentLength > maxDownloadBytes {
+		return nil, NewDownloadFailedError(uriStr, fmt.Errorf("response size %d bytes exceeds the download limit of %d bytes (PPROF_MAX_DOWNLOAD_BYTES)", resp.ContentLength, maxDownloadBytes))
+	}
 
+	// 创建临时文件来存储下载的内容
+	tempFile, err := os.CreateTemp("", "pprof-*") // 使用通用模式
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for download: %w", err)
+	}
+	filePath := tempFile.Name()
+	logDebug("Downloading profile to temporary file: %s", filePath)
+
+	// 定义清理函数，用于删除临时文件
+	cleanup := func() {
+		logDebug("Cleaning up temporary file: %s", filePath)
+		err := os.Remove(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			logWarn("failed to remove temporary file '%s': %v", filePath, err)
+		}
+	}
+
+	// 多读 1 个字节用于判断响应是否超过限制 (没有 Content-Length 或 Content-Length 不准确时)
+	written, err := io.Copy(tempFile, io.LimitReader(resp.Body, maxDownloadBytes+1))
+	closeErr := tempFile.Close()
+	if err == nil && written > maxDownloadBytes {
+		cleanup()
+		return nil, NewDownloadFailedError(uriStr, fmt.Errorf("response exceeds the download limit of %d bytes (PPROF_MAX_DOWNLOAD_BYTES)", maxDownloadBytes))
+	}
+
+	if err != nil {
+		cleanup() // 如果复制失败，尝试清理临时文件
+		if ctx.Err() != nil {
+			return nil, NewCanceledError(fmt.Sprintf("下载 profile '%s'", uriStr), ctx.Err())
+		}
+		remoteBreaker.recordFailure(host)
+		return nil, fmt.Errorf("failed to write downloaded content to temporary file '%s': %w", filePath, err)
+	}
+	if closeErr != nil {
+		logWarn("failed to close temporary file handle for '%s': %v", filePath, closeErr)
+	}
+
+	remoteBreaker.recordSuccess(host)
+	logDebug("Successfully downloaded profile to %s", filePath)
+	return &httpDownload{
+		FilePath:     filePath,
+		Cleanup:      cleanup,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// fetchAndParseProfile 获取并解析 uri 指向的 profile (不使用缓存)，下载的临时文件在解析完成后立即删除
+func fetchAndParseProfile(ctx context.Context, uriStr string) (*profile.Profile, error) {
+	filePath, cleanup, err := getProfileAsFile(ctx, uriStr)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	return parseProfileFile(filePath)
+}
+
+// parseProfileFile 打开并解析本地 profile 文件，解析失败时返回说明检测到的文件格式的错误
+func parseProfileFile(filePath string) (*profile.Profile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profile file '%s': %w", filePath, err)
+	}
+	defer file.Close()
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return nil, newProfileParseError(filePath, err)
+	}
+	logDebug("Successfully parsed profile file from path: %s", filePath)
+	return prof, nil
+}
+
+// decodeProfileFile 解码本地 profile 文件但不执行 CheckValid，用于需要看到所有一致性问题的校验。
+// profile.Parse 会在第一个问题处失败，这里改为自行解压后调用 profile.ParseUncompressed；
+// protobuf 解码失败时 (例如旧版文本格式) 回退到 parseProfileFile，由它转换旧版格式或给出说明文件格式的解析错误。
+func decodeProfileFile(filePath string) (*profile.Profile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profile file '%s': %w", filePath, err)
+	}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err == nil {
+			data, err = io.ReadAll(gz)
+		}
 		if err != nil {
-			cleanup() // 如果复制失败，尝试清理临时文件
-			return "", nil, fmt.Errorf("failed to write downloaded content to temporary file '%s': %w", filePath, err)
+			return nil, newProfileParseError(filePath, err)
+		}
+	}
+	prof, err := profile.ParseUncompressed(data)
+	if err != nil {
+		return parseProfileFile(filePath)
+	}
+	logDebug("Decoded profile file without validation from path: %s", filePath)
+	return prof, nil
+}
+
+// isStdinURI 判断 profile URI 是否指向标准输入 ("-" 或 "stdin:")。
+// 服务通过 stdio transport 与 MCP 客户端通信，读取标准输入会吞掉 JSON-RPC 消息并破坏连接，
+// 而不加识别时 "-" 会被当作名为 "-" 的本地文件，得到令人困惑的文件不存在错误。
+func isStdinURI(uriStr string) bool {
+	trimmed := strings.TrimSpace(uriStr)
+	return trimmed == "-" || strings.EqualFold(trimmed, "stdin:")
+}
+
+// liveProfileTimeout 返回从 /debug/pprof/ 端点实时采集 profile 的 HTTP 超时时间。
+// 服务端会先采集 seconds 秒再返回：/profile 和 /trace 未指定 seconds 时默认采集 30 秒，
+// 其它端点 (例如 heap?seconds=10 的增量 profile) 只在指定了 seconds 时才需要等待。
+func liveProfileTimeout(u *url.URL) (time.Duration, error) {
+	seconds := int64(0)
+	if strings.HasSuffix(u.Path, "/profile") || strings.HasSuffix(u.Path, "/trace") {
+		seconds = defaultLiveProfileSeconds
+	}
+	if s := u.Query().Get("seconds"); s != "" {
+		var err error
+		seconds, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || seconds < 0 {
+			return 0, NewInvalidArgumentError(fmt.Sprintf("invalid 'seconds' query parameter '%s' in pprof URL", s))
 		}
-		if closeErr != nil {
-			log.Printf("Warning: failed to close temporary file handle for '%s': %v", filePath, closeErr)
+	}
+	return time.Duration(seconds)*time.Second + liveProfileTimeoutMargin, nil
+}
+
+// parseProfilesConcurrently 使用最多 GOMAXPROCS 个 worker 并发解析多个本地 profile 文件，
+// 返回的切片与 paths 顺序一致。任一文件打开或解析失败时，取消尚未开始的解析并返回最先发生的错误；
+// parent 被取消时同样停止分发，并返回 CANCELED 错误。
+func parseProfilesConcurrently(parent context.Context, paths []string) ([]*profile.Profile, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	profiles := make([]*profile.Profile, len(paths))
+	jobs := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				file, err := os.Open(paths[i])
+				if err != nil {
+					fail(fmt.Errorf("failed to open profile file #%d '%s': %w", i+1, paths[i], err))
+					continue
+				}
+				prof, err := profile.Parse(file)
+				file.Close()
+				if err != nil {
+					fail(fmt.Errorf("failed to parse profile file #%d: %w", i+1, newProfileParseError(paths[i], err)))
+					continue
+				}
+				profiles[i] = prof
+			}
+		}()
+	}
+
+feed:
+	for i := range paths {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
 		}
+	}
+	close(jobs)
+	wg.Wait()
 
-		log.Printf("Successfully downloaded profile to %s", filePath)
-		return filePath, cleanup, nil
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if parent.Err() != nil {
+		return nil, NewCanceledError("解析 profile", parent.Err())
+	}
+	return profiles, nil
+}
 
-	default:
-		return "", nil, fmt.Errorf("unsupported URI scheme '%s', only 'file://', 'http://', 'https://', or a plain local path are supported", parsedURI.Scheme)
+// defaultFetchConcurrency 是并发获取多个 profile 时同时进行的请求数上限，避免同时向大量副本发起实时采集
+const defaultFetchConcurrency = 4
+
+// fetchedProfile 是并发获取单个 profile 的结果，Err 不为 nil 时 Profile 为 nil
+type fetchedProfile struct {
+	Profile *profile.Profile
+	Err     error
+}
+
+// fetchProfilesConcurrently 最多同时获取并解析 concurrency 个 profile，返回的切片与 uris 顺序一致。
+// 与 parseProfilesConcurrently 不同，单个 profile 失败不会中断其它 profile，错误记录在对应的结果中。
+// 下载的临时文件在解析完成后立即删除；noCache 为 true 时不使用 profile 缓存 (见 loadProfile)。
+// ctx 被取消后，尚未开始的获取直接以 CANCELED 错误结束。
+func fetchProfilesConcurrently(ctx context.Context, uris []string, concurrency int, noCache bool) []fetchedProfile {
+	if concurrency <= 0 {
+		concurrency = defaultFetchConcurrency
+	}
+	results := make([]fetchedProfile, len(uris))
+	limiter := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, uri := range uris {
+		wg.Add(1)
+		go func(i int, uri string) {
+			defer wg.Done()
+			select {
+			case limiter <- struct{}{}:
+			case <-ctx.Done():
+				results[i].Err = NewCanceledError(fmt.Sprintf("获取 profile '%s'", uri), ctx.Err())
+				return
+			}
+			defer func() { <-limiter }()
+
+			results[i].Profile, results[i].Err = loadProfile(ctx, uri, noCache)
+		}(i, uri)
 	}
+	wg.Wait()
+	return results
 }
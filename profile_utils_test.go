@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestGetProfileAsFileDownloadLimit 测试远程 profile 超过下载大小限制或 HTTP 超时时返回错误，并删除已写入的临时文件
+func TestGetProfileAsFileDownloadLimit(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	oldMax, oldTimeout := maxDownloadBytes, httpTimeout
+	t.Cleanup(func() { maxDownloadBytes, httpTimeout = oldMax, oldTimeout })
+	maxDownloadBytes = 1024
+
+	chunk := strings.Repeat("x", 512)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			// 不带 Content-Length 持续输出，超过限制后才能发现
+			for i := 0; i < 8; i++ {
+				w.Write([]byte(chunk))
+				w.(http.Flusher).Flush()
+			}
+		case "/sized":
+			w.Header().Set("Content-Length", "4096")
+			w.Write([]byte(strings.Repeat("x", 4096)))
+		case "/small":
+			w.Write([]byte(chunk))
+		case "/slow":
+			w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+			time.Sleep(500 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	leftover := func() []string {
+		matches, _ := filepath.Glob(filepath.Join(tempDir, "pprof-*"))
+		return matches
+	}
+
+	for _, path := range []string{"/stream", "/sized"} {
+		_, _, err := getProfileAsFile(context.Background(), server.URL+path)
+		var appErr *AppError
+		if !errors.As(err, &appErr) || appErr.Code != ErrCodeDownloadFailed {
+			t.Errorf("getProfileAsFile(%s) error = %v, want %s", path, err, ErrCodeDownloadFailed)
+		}
+		if files := leftover(); len(files) != 0 {
+			t.Errorf("getProfileAsFile(%s) left temporary files %v", path, files)
+		}
+	}
+
+	filePath, cleanup, err := getProfileAsFile(context.Background(), server.URL+"/small")
+	if err != nil {
+		t.Fatalf("getProfileAsFile(/small) error = %v", err)
+	}
+	if info, err := os.Stat(filePath); err != nil || info.Size() != int64(len(chunk)) {
+		t.Errorf("downloaded file = %v, %v, want %d bytes", info, err, len(chunk))
+	}
+	cleanup()
+
+	httpTimeout = 100 * time.Millisecond
+	if _, _, err := getProfileAsFile(context.Background(), server.URL+"/slow"); err == nil {
+		t.Error("getProfileAsFile(/slow) error = nil, want timeout")
+	}
+	if files := leftover(); len(files) != 0 {
+		t.Errorf("getProfileAsFile(/slow) left temporary files %v", files)
+	}
+}
+
+// TestGetProfileAsFilePerfData 测试 perf.data 在 PATH 中没有 perf_to_profile 时返回说明如何转换的 PARSE_FAILED 错误，有时则被转换为 pprof 文件
+func TestGetProfileAsFilePerfData(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake perf_to_profile is a shell script")
+	}
+	dir := t.TempDir()
+	perfPath := filepath.Join(dir, "perf.data")
+	if err := os.WriteFile(perfPath, append([]byte("PERFILE2"), make([]byte, 64)...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	_, _, err := getProfileAsFile(context.Background(), perfPath)
+	var appErr *AppError
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeParseFailed || !strings.Contains(appErr.Message, "perf_to_profile") {
+		t.Fatalf("getProfileAsFile(perf.data) error = %v, want %s with conversion guidance", err, ErrCodeParseFailed)
+	}
+
+	// 假的 perf_to_profile 把一个现成的 pprof 文件复制到 -o 指定的路径
+	converted := filepath.Join(dir, "converted.pb.gz")
+	p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "cycles", Unit: "count"}}}
+	f, err := os.Create(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	binDir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\ncp %s \"$4\"\n", converted)
+	if err := os.WriteFile(filepath.Join(binDir, "perf_to_profile"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+"/bin")
+
+	filePath, cleanup, err := getProfileAsFile(context.Background(), perfPath)
+	if err != nil {
+		t.Fatalf("getProfileAsFile(perf.data) with perf_to_profile error = %v", err)
+	}
+	defer cleanup()
+	if prof, err := parseProfileFile(filePath); err != nil || prof.SampleType[0].Type != "cycles" {
+		t.Errorf("converted profile = %v, %v", prof, err)
+	}
+}
+
+// TestGetProfileAsFileStdin 测试 "-" 和 "stdin:" 返回说明原因的 INVALID_ARGUMENT 错误，而不是文件不存在错误
+func TestGetProfileAsFileStdin(t *testing.T) {
+	for _, uri := range []string{"-", " stdin: ", "STDIN:"} {
+		_, _, err := getProfileAsFile(context.Background(), uri)
+		var appErr *AppError
+		if !errors.As(err, &appErr) || appErr.Code != ErrCodeInvalidArgument || !strings.Contains(appErr.Message, "stdio transport") {
+			t.Errorf("getProfileAsFile(%q) error = %v, want %s explaining stdin is unavailable", uri, err, ErrCodeInvalidArgument)
+		}
+	}
+}
+
+// TestDownloadLimitsFromEnv 测试 PPROF_MAX_DOWNLOAD_BYTES 和 PPROF_HTTP_TIMEOUT 的解析
+func TestDownloadLimitsFromEnv(t *testing.T) {
+	tests := []struct {
+		maxBytes string
+		wantMax  int64
+		timeout  string
+		want     time.Duration
+	}{
+		{"", defaultMaxDownloadBytes, "", defaultHTTPTimeout},
+		{"1048576", 1048576, "90s", 90 * time.Second},
+		{"0", defaultMaxDownloadBytes, "2.5", 2500 * time.Millisecond},
+		{"big", defaultMaxDownloadBytes, "-1s", defaultHTTPTimeout},
+	}
+	for _, tt := range tests {
+		t.Setenv("PPROF_MAX_DOWNLOAD_BYTES", tt.maxBytes)
+		t.Setenv("PPROF_HTTP_TIMEOUT", tt.timeout)
+		if got := maxDownloadBytesFromEnv(); got != tt.wantMax {
+			t.Errorf("maxDownloadBytesFromEnv(%q) = %d, want %d", tt.maxBytes, got, tt.wantMax)
+		}
+		if got := httpTimeoutFromEnv(); got != tt.want {
+			t.Errorf("httpTimeoutFromEnv(%q) = %s, want %s", tt.timeout, got, tt.want)
+		}
+	}
+}
+
+// TestParseProfilesConcurrently 测试并发解析的结果与输入顺序一致，解析失败时返回失败文件的错误，parent 被取消时返回 CANCELED 错误
+func TestParseProfilesConcurrently(t *testing.T) {
+	const count = 16
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = writeTestProfile(t, newCacheTestProfile(int64(i+1)))
+	}
+
+	profiles, err := parseProfilesConcurrently(context.Background(), paths)
+	if err != nil {
+		t.Fatalf("parseProfilesConcurrently() error = %v", err)
+	}
+	if len(profiles) != count {
+		t.Fatalf("parseProfilesConcurrently() returned %d profiles, want %d", len(profiles), count)
+	}
+	for i, p := range profiles {
+		if got := p.Sample[0].Value[0]; got != int64(i+1) {
+			t.Errorf("profile #%d has sample value %d, want %d", i+1, got, i+1)
+		}
+	}
+
+	badPath := filepath.Join(t.TempDir(), "bad.pprof")
+	if err := os.WriteFile(badPath, []byte("not a profile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withBad := append(append([]string{}, paths[:3]...), badPath)
+	withBad = append(withBad, paths[3:]...)
+	if _, err := parseProfilesConcurrently(context.Background(), withBad); err == nil || !strings.Contains(err.Error(), "profile file #4") {
+		t.Errorf("parseProfilesConcurrently(with invalid file) error = %v, want the error for file #4", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := parseProfilesConcurrently(ctx, paths); !isCanceled(err) {
+		t.Errorf("parseProfilesConcurrently(canceled) error = %v, want a CANCELED error", err)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestParseProfilesConcurrentlyCancelsRemaining 测试第一个错误会取消其余的解析：
+// 失败的文件之后是一个 FIFO，打开它会一直阻塞到有写入方为止，因此只有在取消生效时解析才会及时返回
+func TestParseProfilesConcurrentlyCancelsRemaining(t *testing.T) {
+	// 只用一个 worker，使失败的文件一定在 FIFO 之前被处理
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	dir := t.TempDir()
+	badPath := filepath.Join(dir, "bad.pprof")
+	if err := os.WriteFile(badPath, []byte("not a profile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fifoPath := filepath.Join(dir, "pending.pprof")
+	if err := syscall.Mkfifo(fifoPath, 0o644); err != nil {
+		t.Skipf("mkfifo not supported: %v", err)
+	}
+	paths := []string{writeTestProfile(t, newCacheTestProfile(1)), badPath, fifoPath}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := parseProfilesConcurrently(context.Background(), paths)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "profile file #2") {
+			t.Errorf("parseProfilesConcurrently() error = %v, want the error for file #2", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("parseProfilesConcurrently() kept parsing after the first error")
+		// 反复打开写入端，让阻塞在 FIFO 上的 worker 继续执行
+		for {
+			if f, err := os.OpenFile(fifoPath, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+				f.Close()
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+}
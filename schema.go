@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/jsonschema-go/jsonschema"
+
+	"github.com/ZephyrDeng/pprof-analyzer-mcp/analyzer"
+)
+
+// 工具参数的可选值，作为 input schema 中的 enum
+var (
+	analyzeProfileTypes        = []string{"cpu", "heap", "goroutine", "allocs", "mutex", "block"}
+	analyzePprofProfileTypes   = []string{"cpu", "heap", "goroutine", "allocs", "mutex", "block", "auto"}
+	compareProfileTypes        = []string{"cpu", "heap", "allocs", "mutex", "block"}
+	flamegraphProfileTypes     = []string{"cpu", "heap", "allocs", "goroutine", "mutex", "block", "heap_growth"}
+	diffFlamegraphProfileTypes = []string{"cpu", "heap", "allocs", "goroutine", "mutex", "block"}
+	flamegraphFormats          = []string{"svg", "collapsed"}
+	callgraphFormats           = []string{"tree", "text"}
+	aggregations               = []string{analyzer.AggregationLeaf, analyzer.AggregationCumulative, analyzer.AggregationFullStack}
+)
+
+// integerArgs 是以 float64 接收但只有整数才有意义的参数 (数量、PID、秒数等)，在 input schema 中声明为 integer
+var integerArgs = map[string]bool{
+	"top_n":            true,
+	"limit":            true,
+	"pid":              true,
+	"grace_seconds":    true,
+	"period_override":  true,
+	"max_goroutines":   true,
+	"max_increase":     true,
+	"max_values":       true,
+	"max_concurrency":  true,
+	"max_inline_bytes": true,
+	"stack_depth":      true,
+	"node_count":       true,
+	"timeout_seconds":  true,
+}
+
+// argTypeSchemas 是无法从 Go 类型直接推断的参数类型的 schema
+var argTypeSchemas = map[reflect.Type]*jsonschema.Schema{
+	// profileURIs 接受单个字符串或非空字符串数组
+	reflect.TypeFor[profileURIs](): {AnyOf: []*jsonschema.Schema{
+		{Type: "string"},
+		{Type: "array", Items: &jsonschema.Schema{Type: "string"}, MinItems: jsonschema.Ptr(1)},
+	}},
+}
+
+// inputSchema 从参数结构体 T 推断工具的 input schema (与 mcp.AddTool 默认推断的相同)，并补充约束：
+// integerArgs 中的参数 (以及 top_n_by_type 的值) 声明为 integer，enums 中的参数只允许列出的取值。
+// SDK 在调用 handler 之前按该 schema 校验参数，客户端也可以据此补全和预先校验。
+// enums 引用了 T 中不存在的参数时 panic，避免参数改名后约束被悄悄丢掉。
+func inputSchema[T any](enums map[string][]string) *jsonschema.Schema {
+	schema, err := jsonschema.For[T](&jsonschema.ForOptions{TypeSchemas: argTypeSchemas})
+	if err != nil {
+		panic(fmt.Sprintf("failed to infer input schema for %T: %v", *new(T), err))
+	}
+	for name, prop := range schema.Properties {
+		if integerArgs[name] && prop.Type == "number" {
+			prop.Type = "integer"
+		}
+	}
+	if prop := schema.Properties["top_n_by_type"]; prop != nil && prop.AdditionalProperties != nil {
+		prop.AdditionalProperties.Type = "integer"
+	}
+	for name, values := range enums {
+		prop, ok := schema.Properties[name]
+		if !ok {
+			panic(fmt.Sprintf("input schema for %T has no property %q", *new(T), name))
+		}
+		prop.Enum = make([]any, len(values))
+		for i, v := range values {
+			prop.Enum[i] = v
+		}
+	}
+	return schema
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// TestToolInputSchemas 测试注册的工具带有 enum 和 integer 约束，并且 SDK 在调用 handler 之前拒绝不符合 schema 的参数
+func TestToolInputSchemas(t *testing.T) {
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := newServer().Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server.Connect() error = %v", err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client.Connect() error = %v", err)
+	}
+	defer session.Close()
+
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	var schema map[string]any
+	for _, tool := range tools.Tools {
+		if tool.Name == "analyze_pprof" {
+			schema, _ = tool.InputSchema.(map[string]any)
+		}
+	}
+	props, _ := schema["properties"].(map[string]any)
+	profileType, _ := props["profile_type"].(map[string]any)
+	topN, _ := props["top_n"].(map[string]any)
+	enum, _ := profileType["enum"].([]any)
+	if len(enum) != len(analyzePprofProfileTypes) || topN["type"] != "integer" {
+		t.Errorf("analyze_pprof schema: profile_type = %v, top_n = %v", profileType, topN)
+	}
+
+	for _, args := range []map[string]any{
+		{"profile_uri": "cpu.pprof", "profile_type": "cpu", "output_format": "yaml"},
+		{"profile_uri": "cpu.pprof", "profile_type": "threads"},
+		{"profile_uri": "cpu.pprof", "profile_type": "cpu", "top_n": 2.5},
+	} {
+		// schema 校验失败是协议错误 (err)，handler 返回的错误 (例如文件不存在) 则是 IsError 结果
+		if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "analyze_pprof", Arguments: args}); err == nil || !strings.Contains(err.Error(), "validating") {
+			t.Errorf("CallTool(%v) error = %v, want schema validation error", args, err)
+		}
+	}
+
+	// profile_uri 数组通过 schema 校验，在 handler 中因文件不存在而失败
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "analyze_pprof", Arguments: map[string]any{
+		"profile_uri": []string{"a.pprof", "b.pprof"}, "profile_type": "cpu",
+	}})
+	if err != nil || !result.IsError {
+		t.Errorf("CallTool(profile_uri array) = %+v, %v, want a handler error", result, err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killProcessGroupOnCancel 在不支持进程组的平台上不做处理：context 结束时只终止 cmd 本身，
+// 遗留的子进程持有的输出管道由 WaitDelay 兜底
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
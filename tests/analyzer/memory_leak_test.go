@@ -1,6 +1,7 @@
 package analyzer_test
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 
@@ -108,3 +109,204 @@ func TestDetectPotentialMemoryLeaks(t *testing.T) {
 		t.Error("Expected error for missing inuse_space sample type, but got nil")
 	}
 }
+
+func TestDetectPotentialMemoryLeaksIgnore(t *testing.T) {
+	newSample := func(funcName, typeName string, bytes, objects int64) *profile.Sample {
+		return &profile.Sample{
+			Location: []*profile.Location{
+				{
+					Line: []profile.Line{
+						{Function: &profile.Function{Name: funcName}},
+					},
+				},
+			},
+			Value: []int64{bytes, objects},
+			Label: map[string][]string{"type": {typeName}},
+		}
+	}
+	sampleTypes := []*profile.ValueType{
+		{Type: "inuse_space", Unit: "bytes"},
+		{Type: "inuse_objects", Unit: "count"},
+	}
+
+	beforeProfile := &profile.Profile{
+		SampleType: sampleTypes,
+		Sample: []*profile.Sample{
+			newSample("main.(*Cache).Put", "CacheEntry", 1000, 10),
+			newSample("main.handleRequest", "Session", 1000, 10),
+		},
+	}
+	afterProfile := &profile.Profile{
+		SampleType: sampleTypes,
+		Sample: []*profile.Sample{
+			newSample("main.(*Cache).Put", "CacheEntry", 50000, 500),
+			newSample("main.handleRequest", "Session", 3000, 30),
+		},
+	}
+
+	result, err := analyzer.DetectPotentialMemoryLeaksWithOptions(beforeProfile, afterProfile, analyzer.LeakDetectionOptions{
+		Threshold: 0.1,
+		Limit:     10,
+		Ignore:    regexp.MustCompile(`Cache`),
+	})
+	if err != nil {
+		t.Fatalf("Error detecting memory leaks: %v", err)
+	}
+
+	for _, expected := range []string{"Session", "Ignore pattern: Cache", "Excluded types: CacheEntry"} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected result to contain '%s', but it doesn't.\nResult: %s", expected, result)
+		}
+	}
+	if strings.Contains(result, "CacheEntry ") {
+		t.Errorf("Expected ignored type to be excluded from the leak table.\nResult: %s", result)
+	}
+}
+
+func TestDetectPotentialMemoryLeaksTopN(t *testing.T) {
+	sampleTypes := []*profile.ValueType{
+		{Type: "inuse_space", Unit: "bytes"},
+		{Type: "inuse_objects", Unit: "count"},
+	}
+	beforeProfile := &profile.Profile{SampleType: sampleTypes}
+	afterProfile := &profile.Profile{SampleType: sampleTypes}
+	for i, typeName := range []string{"Small", "Medium", "Large", "Huge"} {
+		location := []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: "main.alloc" + typeName}}}}}
+		beforeProfile.Sample = append(beforeProfile.Sample, &profile.Sample{
+			Location: location, Value: []int64{1000, 10}, Label: map[string][]string{"type": {typeName}},
+		})
+		afterProfile.Sample = append(afterProfile.Sample, &profile.Sample{
+			Location: location, Value: []int64{1000 * int64(i+2), 10}, Label: map[string][]string{"type": {typeName}},
+		})
+	}
+
+	result, err := analyzer.DetectPotentialMemoryLeaksWithOptions(beforeProfile, afterProfile, analyzer.LeakDetectionOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("Error detecting memory leaks: %v", err)
+	}
+	for _, expected := range []string{"Found 4 types", "Showing top 2 of 4 candidates", "2 more not shown", "Huge", "Large"} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected result to contain '%s', but it doesn't.\nResult: %s", expected, result)
+		}
+	}
+	if strings.Contains(result, "Small ") || strings.Contains(result, "Medium ") {
+		t.Errorf("Expected only the 2 largest growths to be listed.\nResult: %s", result)
+	}
+}
+
+func TestDetectPotentialMemoryLeaksAllocationStack(t *testing.T) {
+	sampleTypes := []*profile.ValueType{
+		{Type: "inuse_space", Unit: "bytes"},
+		{Type: "inuse_objects", Unit: "count"},
+	}
+	newStack := func(names ...string) []*profile.Location {
+		var stack []*profile.Location
+		for i, name := range names {
+			stack = append(stack, &profile.Location{Line: []profile.Line{
+				{Function: &profile.Function{Name: name, Filename: "main.go"}, Line: int64(10 * (i + 1))},
+			}})
+		}
+		return stack
+	}
+	cached := newStack("main.newEntry", "main.(*Cache).Put", "main.handleRequest", "net/http.HandlerFunc.ServeHTTP", "main.main")
+	stable := newStack("main.newEntry", "main.loadConfig", "main.main")
+	label := map[string][]string{"type": {"Entry"}}
+
+	beforeProfile := &profile.Profile{
+		SampleType: sampleTypes,
+		Sample: []*profile.Sample{
+			{Location: cached, Value: []int64{1000, 10}, Label: label},
+			{Location: stable, Value: []int64{500, 5}, Label: label},
+		},
+	}
+	afterProfile := &profile.Profile{
+		SampleType: sampleTypes,
+		Sample: []*profile.Sample{
+			{Location: cached, Value: []int64{9000, 90}, Label: label},
+			{Location: stable, Value: []int64{500, 5}, Label: label},
+		},
+	}
+
+	result, err := analyzer.DetectPotentialMemoryLeaksWithOptions(beforeProfile, afterProfile, analyzer.LeakDetectionOptions{})
+	if err != nil {
+		t.Fatalf("Error detecting memory leaks: %v", err)
+	}
+	// The full call path of the growing stack is shown, not just the leaf, and the stable stack is not
+	for _, expected := range []string{"Allocation Stacks", "+7.81 KB (now 8.79 KB)", "main.newEntry (main.go:10)", "main.(*Cache).Put (main.go:20)", "main.main (main.go:50)"} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected result to contain '%s', but it doesn't.\nResult: %s", expected, result)
+		}
+	}
+	if strings.Contains(result, "main.loadConfig") {
+		t.Errorf("Expected only the growing allocation stack to be shown.\nResult: %s", result)
+	}
+
+	result, err = analyzer.DetectPotentialMemoryLeaksWithOptions(beforeProfile, afterProfile, analyzer.LeakDetectionOptions{StackDepth: 2})
+	if err != nil {
+		t.Fatalf("Error detecting memory leaks: %v", err)
+	}
+	if !strings.Contains(result, "main.(*Cache).Put") || strings.Contains(result, "main.handleRequest") || !strings.Contains(result, "... 3 more frames") {
+		t.Errorf("Expected stack_depth to cap the stack at 2 frames.\nResult: %s", result)
+	}
+}
+
+func TestDetectPotentialMemoryLeaksMetric(t *testing.T) {
+	sampleTypes := []*profile.ValueType{
+		{Type: "alloc_objects", Unit: "count"},
+		{Type: "alloc_space", Unit: "bytes"},
+		{Type: "inuse_objects", Unit: "count"},
+		{Type: "inuse_space", Unit: "bytes"},
+	}
+	location := []*profile.Location{{Line: []profile.Line{{Function: &profile.Function{Name: "main.buildResponse"}}}}}
+	newProfile := func(allocObjects, allocBytes, inuseObjects, inuseBytes int64) *profile.Profile {
+		return &profile.Profile{
+			SampleType: sampleTypes,
+			Sample: []*profile.Sample{{
+				Location: location,
+				Value:    []int64{allocObjects, allocBytes, inuseObjects, inuseBytes},
+				Label:    map[string][]string{"type": {"Response"}},
+			}},
+		}
+	}
+	// Live memory is flat, but the allocation totals (and the allocated object count) doubled
+	beforeProfile := newProfile(100, 102400, 10, 2048)
+	afterProfile := newProfile(200, 204800, 10, 2048)
+
+	result, err := analyzer.DetectPotentialMemoryLeaksWithOptions(beforeProfile, afterProfile, analyzer.LeakDetectionOptions{})
+	if err != nil {
+		t.Fatalf("Error detecting memory leaks: %v", err)
+	}
+	if !strings.Contains(result, "Metric: inuse_space") || !strings.Contains(result, "No significant memory growth detected") {
+		t.Errorf("Expected no inuse_space growth by default.\nResult: %s", result)
+	}
+
+	result, err = analyzer.DetectPotentialMemoryLeaksWithOptions(beforeProfile, afterProfile, analyzer.LeakDetectionOptions{Metric: analyzer.LeakMetricAllocSpace})
+	if err != nil {
+		t.Fatalf("Error detecting memory leaks: %v", err)
+	}
+	for _, expected := range []string{"Metric: alloc_space", "allocation churn", "Response", "100.00 KB", "200.00 KB", "(Objects: 100 → 200"} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected alloc_space result to contain '%s', but it doesn't.\nResult: %s", expected, result)
+		}
+	}
+
+	result, err = analyzer.DetectPotentialMemoryLeaksWithOptions(beforeProfile, afterProfile, analyzer.LeakDetectionOptions{Metric: analyzer.LeakMetricAllocObjects})
+	if err != nil {
+		t.Fatalf("Error detecting memory leaks: %v", err)
+	}
+	for _, expected := range []string{"Old Count", "+100 (now 200)"} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected alloc_objects result to contain '%s', but it doesn't.\nResult: %s", expected, result)
+		}
+	}
+
+	// The metric must be present in both profiles
+	inuseOnly := &profile.Profile{SampleType: sampleTypes[2:], Sample: []*profile.Sample{{Location: location, Value: []int64{10, 2048}}}}
+	_, err = analyzer.DetectPotentialMemoryLeaksWithOptions(inuseOnly, afterProfile, analyzer.LeakDetectionOptions{Metric: analyzer.LeakMetricAllocSpace})
+	if err == nil || !strings.Contains(err.Error(), "alloc_space") || !strings.Contains(err.Error(), "old profile") {
+		t.Errorf("Expected an error naming the missing alloc_space sample type, got %v", err)
+	}
+	if _, err := analyzer.DetectPotentialMemoryLeaksWithOptions(beforeProfile, afterProfile, analyzer.LeakDetectionOptions{Metric: "delay"}); err == nil {
+		t.Error("Expected an error for an unsupported metric, but got nil")
+	}
+}